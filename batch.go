@@ -357,6 +357,14 @@ type batchInternal struct {
 
 	commitErr error
 
+	// prepared is set for the batches through which Batch.Prepare,
+	// DB.CommitPrepared and DB.RollbackPrepared write their markers to the WAL.
+	prepared *preparedOp
+
+	// conditions are the preconditions checked when the batch is committed.
+	// See Batch.ExpectAbsent and Batch.ExpectValue.
+	conditions []batchCondition
+
 	// Position bools together to reduce the sizeof the struct.
 
 	// ingestedSSTBatch indicates that the batch contains one or more key kinds
@@ -562,7 +570,8 @@ func (b *Batch) refreshMemTableSize() error {
 	return nil
 }
 
-// Apply the operations contained in the batch to the receiver batch.
+// Apply the operations contained in the batch to the receiver batch, along
+// with its preconditions.
 //
 // It is safe to modify the contents of the arguments after Apply returns.
 //
@@ -577,6 +586,7 @@ func (b *Batch) Apply(batch *Batch, _ *WriteOptions) error {
 	if len(batch.data) < batchrepr.HeaderLen {
 		return ErrInvalidBatch
 	}
+	b.conditions = append(b.conditions, batch.conditions...)
 
 	offset := len(b.data)
 	if offset == 0 {
@@ -662,7 +672,7 @@ func (b *Batch) Get(key []byte) ([]byte, io.Closer, error) {
 	if b.index == nil {
 		return nil, nil, ErrNotIndexed
 	}
-	return b.db.getInternal(key, b, nil /* snapshot */)
+	return b.db.getInternal(context.Background(), key, b, nil /* snapshot */)
 }
 
 func (b *Batch) prepareDeferredKeyValueRecord(keyLen, valueLen int, kind InternalKeyKind) {
@@ -1264,6 +1274,70 @@ func (b *Batch) NewBatchOnlyIter(ctx context.Context, o *IterOptions) (*Iterator
 	return b.db.newIter(ctx, b, newIterOpts{batch: batchIterOpts{batchOnly: true}}, o), nil
 }
 
+// RangeKeySpan describes the range keys set over the span [Start, End). See
+// Batch.RangeKeySpans.
+type RangeKeySpan struct {
+	Start, End []byte
+	Keys       []RangeKeyData
+}
+
+// RangeKeySpans returns the spans of range keys set by the batch's existing
+// mutations, in key order. The spans are fragmented and coalesced as observed
+// by an iterator over the batch's range keys: spans removed by RangeKeyUnset
+// or RangeKeyDelete aren't returned. Only indexed batches support RangeKeySpans.
+func (b *Batch) RangeKeySpans() ([]RangeKeySpan, error) {
+	iter, err := b.NewBatchOnlyIter(context.Background(), &IterOptions{
+		KeyTypes: IterKeyTypeRangesOnly,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var spans []RangeKeySpan
+	for valid := iter.First(); valid; valid = iter.Next() {
+		spans = append(spans, makeRangeKeySpan(iter))
+	}
+	return spans, iter.Close()
+}
+
+// RangeKeyGet returns the span of range keys set by the batch's existing
+// mutations that covers key, or nil if there is none. Unlike Get, RangeKeyGet
+// only reads the batch, and not the DB state. Only indexed batches support
+// RangeKeyGet.
+func (b *Batch) RangeKeyGet(key []byte) (*RangeKeySpan, error) {
+	iter, err := b.NewBatchOnlyIter(context.Background(), &IterOptions{
+		KeyTypes: IterKeyTypeRangesOnly,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var span *RangeKeySpan
+	if iter.SeekGE(key) {
+		if start, _ := iter.RangeBounds(); b.cmp(start, key) <= 0 {
+			s := makeRangeKeySpan(iter)
+			span = &s
+		}
+	}
+	return span, iter.Close()
+}
+
+// makeRangeKeySpan returns a copy of the range keys at the iterator's
+// position, which remains valid once the iterator is repositioned.
+func makeRangeKeySpan(iter *Iterator) RangeKeySpan {
+	start, end := iter.RangeBounds()
+	s := RangeKeySpan{
+		Start: append([]byte(nil), start...),
+		End:   append([]byte(nil), end...),
+		Keys:  make([]RangeKeyData, len(iter.RangeKeys())),
+	}
+	for i, k := range iter.RangeKeys() {
+		s.Keys[i] = RangeKeyData{
+			Suffix: append([]byte(nil), k.Suffix...),
+			Value:  append([]byte(nil), k.Value...),
+		}
+	}
+	return s
+}
+
 // newInternalIter creates a new internalIterator that iterates over the
 // contents of the batch.
 func (b *Batch) newInternalIter(o *IterOptions) *batchIter {
@@ -1462,6 +1536,12 @@ func (b *Batch) Commit(o *WriteOptions) error {
 	return b.db.Apply(b, o)
 }
 
+// CommitWithContext is like Commit, and additionally accepts a context for
+// tracing.
+func (b *Batch) CommitWithContext(ctx context.Context, o *WriteOptions) error {
+	return b.db.ApplyWithContext(ctx, b, o)
+}
+
 // Close closes the batch without committing it.
 func (b *Batch) Close() error {
 	// The storage engine commit pipeline may retain a pointer to b.data beyond
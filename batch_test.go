@@ -346,6 +346,38 @@ func TestBatchApplyNoSyncWait(t *testing.T) {
 	}
 }
 
+func TestBatchApplyAsync(t *testing.T) {
+	db, err := Open("", &Options{
+		FS: vfs.NewMem(),
+	})
+	require.NoError(t, err)
+	defer db.Close()
+	var batches []*Batch
+	var handles []*CommitHandle
+	for i := 0; i < 1000; i++ {
+		b := db.NewBatch()
+		str := fmt.Sprintf("a%d", i)
+		require.NoError(t, b.Set([]byte(str), []byte(str), nil))
+		h, err := db.ApplyAsync(b, &WriteOptions{Sync: i%2 == 0})
+		require.NoError(t, err)
+		// k-v pair is visible even if not yet synced.
+		val, closer, err := db.Get([]byte(str))
+		require.NoError(t, err)
+		require.Equal(t, str, string(val))
+		closer.Close()
+		batches = append(batches, b)
+		handles = append(handles, h)
+	}
+	for i, h := range handles {
+		if i%3 == 0 {
+			<-h.Done()
+		}
+		require.NoError(t, h.Err())
+		<-h.Done()
+		require.NoError(t, batches[i].Close())
+	}
+}
+
 func TestBatchReset(t *testing.T) {
 	db, err := Open("", &Options{
 		FS: vfs.NewMem(),
@@ -1004,6 +1036,73 @@ func TestBatchIter(t *testing.T) {
 	}
 }
 
+func TestBatchRangeKeySpans(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                 vfs.NewMem(),
+		Comparer:           testkeys.Comparer,
+		FormatMajorVersion: internalFormatNewest,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	_, err = d.NewBatch().RangeKeySpans()
+	require.ErrorIs(t, err, ErrNotIndexed)
+
+	b := d.NewIndexedBatch()
+	defer b.Close()
+	spans, err := b.RangeKeySpans()
+	require.NoError(t, err)
+	require.Empty(t, spans)
+
+	require.NoError(t, b.Set([]byte("b@3"), []byte("masked"), nil))
+	require.NoError(t, b.Set([]byte("b@9"), []byte("unmasked"), nil))
+	require.NoError(t, b.RangeKeySet([]byte("a"), []byte("c"), []byte("@5"), []byte("v1"), nil))
+	require.NoError(t, b.RangeKeySet([]byte("b"), []byte("d"), []byte("@7"), []byte("v2"), nil))
+	require.NoError(t, b.RangeKeyUnset([]byte("c"), []byte("d"), []byte("@7"), nil))
+
+	spans, err = b.RangeKeySpans()
+	require.NoError(t, err)
+	require.Equal(t, []RangeKeySpan{
+		{
+			Start: []byte("a"),
+			End:   []byte("b"),
+			Keys:  []RangeKeyData{{Suffix: []byte("@5"), Value: []byte("v1")}},
+		},
+		{
+			Start: []byte("b"),
+			End:   []byte("c"),
+			Keys: []RangeKeyData{
+				{Suffix: []byte("@7"), Value: []byte("v2")},
+				{Suffix: []byte("@5"), Value: []byte("v1")},
+			},
+		},
+	}, spans)
+
+	span, err := b.RangeKeyGet([]byte("b@3"))
+	require.NoError(t, err)
+	require.Equal(t, &spans[1], span)
+	for _, key := range []string{"0", "c", "d"} {
+		span, err = b.RangeKeyGet([]byte(key))
+		require.NoError(t, err)
+		require.Nil(t, span, key)
+	}
+
+	// Range keys written to the batch mask the batch's point keys.
+	iter, err := b.NewIter(&IterOptions{
+		KeyTypes:        IterKeyTypePointsAndRanges,
+		RangeKeyMasking: RangeKeyMasking{Suffix: []byte("@9")},
+	})
+	require.NoError(t, err)
+	var keys []string
+	for valid := iter.First(); valid; valid = iter.Next() {
+		if hasPoint, _ := iter.HasPointAndRange(); hasPoint {
+			keys = append(keys, string(iter.Key()))
+		}
+	}
+	require.NoError(t, iter.Close())
+	require.Equal(t, []string{"b@9"}, keys)
+}
+
 func TestBatchRangeOps(t *testing.T) {
 	var b *Batch
 
@@ -0,0 +1,125 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package batchrepr
+
+import (
+	"sync"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression identifies the algorithm used to compress a batch
+// representation.
+type Compression uint8
+
+// The available compression algorithms.
+const (
+	NoCompression Compression = iota
+	SnappyCompression
+	ZstdCompression
+)
+
+// String implements fmt.Stringer.
+func (c Compression) String() string {
+	switch c {
+	case NoCompression:
+		return "none"
+	case SnappyCompression:
+		return "snappy"
+	case ZstdCompression:
+		return "zstd"
+	default:
+		return "unknown"
+	}
+}
+
+// A compressed batch representation retains the uncompressed batch's header,
+// followed by the compressed body of the batch. The sequence number of a batch
+// is always less than 2^56 (see base.InternalKeySeqNumMax), so the most
+// significant byte of the little-endian sequence number encoded in the header
+// of an uncompressed batch is always zero. A compressed batch records its
+// Compression within this byte, allowing compressed and uncompressed batches
+// to be distinguished without any additional framing. ReadSeqNum and ReadHeader
+// mask out the Compression, reading the batch's sequence number.
+const compressionOffset = countOffset - 1
+
+var zstdEncoder = sync.OnceValue(func() *zstd.Encoder {
+	e, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+	return e
+})
+
+var zstdDecoder = sync.OnceValue(func() *zstd.Decoder {
+	d, _ := zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+	return d
+})
+
+// IsCompressed returns true if the provided batch representation was produced
+// by Compress.
+func IsCompressed(repr []byte) bool {
+	return len(repr) >= HeaderLen && repr[compressionOffset] != 0
+}
+
+// Compress compresses the body of the provided batch representation using the
+// provided algorithm, appending the result to dst. If the batch is empty or
+// compression would not reduce its size, Compress returns ok=false and the
+// batch should be used uncompressed. The provided batch representation is not
+// modified.
+func Compress(dst, repr []byte, c Compression) (compressed []byte, ok bool) {
+	if c == NoCompression || IsEmpty(repr) || IsCompressed(repr) {
+		return dst, false
+	}
+	start := len(dst)
+	dst = append(dst, repr[:HeaderLen]...)
+	dst[start+compressionOffset] = byte(c)
+	switch c {
+	case SnappyCompression:
+		n := snappy.MaxEncodedLen(len(repr) - HeaderLen)
+		dst = append(dst, make([]byte, n)...)
+		n = len(snappy.Encode(dst[start+HeaderLen:], repr[HeaderLen:]))
+		dst = dst[:start+HeaderLen+n]
+	case ZstdCompression:
+		dst = zstdEncoder().EncodeAll(repr[HeaderLen:], dst)
+	default:
+		return dst[:start], false
+	}
+	if len(dst)-start >= len(repr) {
+		return dst[:start], false
+	}
+	return dst, true
+}
+
+// Decompress decompresses a batch representation produced by Compress,
+// appending the uncompressed batch representation to dst.
+func Decompress(dst, repr []byte) ([]byte, error) {
+	if !IsCompressed(repr) {
+		return dst, base.CorruptionErrorf("pebble: batch is not compressed")
+	}
+	start := len(dst)
+	dst = append(dst, repr[:HeaderLen]...)
+	dst[start+compressionOffset] = 0
+	switch c := Compression(repr[compressionOffset]); c {
+	case SnappyCompression:
+		n, err := snappy.DecodedLen(repr[HeaderLen:])
+		if err != nil {
+			return dst[:start], base.MarkCorruptionError(err)
+		}
+		dst = append(dst, make([]byte, n)...)
+		if _, err := snappy.Decode(dst[start+HeaderLen:], repr[HeaderLen:]); err != nil {
+			return dst[:start], base.MarkCorruptionError(err)
+		}
+		return dst, nil
+	case ZstdCompression:
+		out, err := zstdDecoder().DecodeAll(repr[HeaderLen:], dst)
+		if err != nil {
+			return dst[:start], base.MarkCorruptionError(err)
+		}
+		return out, nil
+	default:
+		return dst[:start], base.CorruptionErrorf("pebble: unknown batch compression: %d", errors.Safe(c))
+	}
+}
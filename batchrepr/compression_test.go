@@ -0,0 +1,60 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package batchrepr
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompression(t *testing.T) {
+	repr := make([]byte, HeaderLen)
+	SetSeqNum(repr, base.InternalKeySeqNumMax)
+	SetCount(repr, 1)
+	repr = append(repr, bytes.Repeat([]byte("pebble"), 100)...)
+
+	for _, c := range []Compression{SnappyCompression, ZstdCompression} {
+		t.Run(c.String(), func(t *testing.T) {
+			require.False(t, IsCompressed(repr))
+			prefix := []byte("prefix")
+			compressed, ok := Compress(prefix, repr, c)
+			require.True(t, ok)
+			require.Equal(t, prefix, compressed[:len(prefix)])
+			compressed = compressed[len(prefix):]
+			require.True(t, IsCompressed(compressed))
+			require.Less(t, len(compressed), len(repr))
+			h, ok := ReadHeader(compressed)
+			require.True(t, ok)
+			require.Equal(t, Header{SeqNum: base.InternalKeySeqNumMax, Count: 1}, h)
+
+			decompressed, err := Decompress(nil, compressed)
+			require.NoError(t, err)
+			require.Equal(t, repr, decompressed)
+			h, ok = ReadHeader(decompressed)
+			require.True(t, ok)
+			require.Equal(t, Header{SeqNum: base.InternalKeySeqNumMax, Count: 1}, h)
+
+			// Corrupting the compressed body surfaces a corruption error.
+			compressed[len(compressed)-1] ^= 0xff
+			_, err = Decompress(nil, compressed)
+			require.True(t, errors.Is(err, base.ErrCorruption))
+		})
+	}
+
+	// Batches that don't compress are left uncompressed.
+	incompressible := make([]byte, HeaderLen+100)
+	rand.New(rand.NewSource(0)).Read(incompressible[HeaderLen:])
+	_, ok := Compress(nil, incompressible, SnappyCompression)
+	require.False(t, ok)
+	_, ok = Compress(nil, repr[:HeaderLen], SnappyCompression)
+	require.False(t, ok)
+	_, ok = Compress(nil, repr, NoCompression)
+	require.False(t, ok)
+}
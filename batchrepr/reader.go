@@ -62,8 +62,11 @@ func (h Header) String() string {
 // does not validate that the repr is valid. It's exported only for very
 // performance sensitive code paths that should not necessarily read the rest of
 // the header as well.
+//
+// The compression tag of a batch produced by Compress is masked out, so the
+// sequence numbers of compressed and uncompressed batches may be compared.
 func ReadSeqNum(repr []byte) uint64 {
-	return binary.LittleEndian.Uint64(repr[:countOffset])
+	return binary.LittleEndian.Uint64(repr[:countOffset]) & base.InternalKeySeqNumMax
 }
 
 // Read constructs a Reader from an encoded batch representation, ignoring the
@@ -0,0 +1,338 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/objstorage"
+	"github.com/cockroachdb/pebble/sstable"
+	"github.com/cockroachdb/pebble/sstable/blob"
+)
+
+// Blob files hold the values that flushes and compactions separate from the
+// sstables they write (see Options.Experimental.BlobValueThreshold). An
+// sstable holds a blob handle in place of each separated value, and the blob
+// files an sstable references are recorded in its FileMetadata.BlobFiles.
+//
+// Blob files are objects managed by the objstorage provider, but they're
+// always created locally. Their lifetime is tied to that of the physical
+// sstables referencing them: a blob file becomes obsolete once all the
+// sstable backings referencing it are obsolete (see blobFileRefs).
+// Compactions pass blob handles through to their outputs rather than
+// rewriting the values they reference, except for handles into the oldest
+// blob files, whose values are rewritten so that these files, which are
+// likely to hold mostly garbage, eventually become obsolete (see
+// Options.Experimental.BlobGCAgeCutoff).
+
+// blobFileRefs tracks the blob files referenced by the live sstable backings
+// of a versionSet. It is protected by DB.mu.
+type blobFileRefs struct {
+	// backings maps each live backing that references blob files to the blob
+	// files it references.
+	backings map[base.DiskFileNum][]base.DiskFileNum
+	// refs maps each live blob file to the number of backings referencing it.
+	refs map[base.DiskFileNum]int
+}
+
+func (r *blobFileRefs) init() {
+	r.backings = make(map[base.DiskFileNum][]base.DiskFileNum)
+	r.refs = make(map[base.DiskFileNum]int)
+}
+
+// addTable records the blob files referenced by the table's backing, if the
+// backing isn't already tracked.
+func (r *blobFileRefs) addTable(m *fileMetadata) {
+	if len(m.BlobFiles) == 0 {
+		return
+	}
+	if _, ok := r.backings[m.FileBacking.DiskFileNum]; ok {
+		return
+	}
+	r.backings[m.FileBacking.DiskFileNum] = m.BlobFiles
+	for _, fileNum := range m.BlobFiles {
+		r.refs[fileNum]++
+	}
+}
+
+// removeBacking releases the references of an obsolete backing, appending the
+// blob files that are no longer referenced by any backing to obsolete.
+func (r *blobFileRefs) removeBacking(
+	backing base.DiskFileNum, obsolete []base.DiskFileNum,
+) []base.DiskFileNum {
+	blobFiles, ok := r.backings[backing]
+	if !ok {
+		return obsolete
+	}
+	delete(r.backings, backing)
+	for _, fileNum := range blobFiles {
+		if r.refs[fileNum]--; r.refs[fileNum] == 0 {
+			delete(r.refs, fileNum)
+			obsolete = append(obsolete, fileNum)
+		}
+	}
+	return obsolete
+}
+
+// isLive returns true if the blob file is referenced by a live backing.
+func (r *blobFileRefs) isLive(fileNum base.DiskFileNum) bool {
+	_, ok := r.refs[fileNum]
+	return ok
+}
+
+// gcCutoff returns the file number below which values are rewritten by
+// compactions, given the fraction of the oldest live blob files that are
+// garbage collected (see Options.Experimental.BlobGCAgeCutoff).
+func (r *blobFileRefs) gcCutoff(ageCutoff float64) base.DiskFileNum {
+	if ageCutoff <= 0 || len(r.refs) == 0 {
+		return 0
+	}
+	fileNums := make([]base.DiskFileNum, 0, len(r.refs))
+	for fileNum := range r.refs {
+		fileNums = append(fileNums, fileNum)
+	}
+	slices.Sort(fileNums)
+	n := int(float64(len(fileNums)) * ageCutoff)
+	if n >= len(fileNums) {
+		return fileNums[len(fileNums)-1] + 1
+	}
+	return fileNums[n]
+}
+
+// blobFileCache holds the open readers of a DB's blob files, through which it
+// fetches the values separated into them. It's provided to sstable readers as
+// their ReaderOptions.BlobValueFetcher.
+type blobFileCache struct {
+	objProvider objstorage.Provider
+	mu          struct {
+		sync.Mutex
+		readers map[base.DiskFileNum]*blob.FileReader
+	}
+}
+
+var _ base.ValueFetcher = (*blobFileCache)(nil)
+
+func newBlobFileCache(objProvider objstorage.Provider) *blobFileCache {
+	c := &blobFileCache{objProvider: objProvider}
+	c.mu.readers = make(map[base.DiskFileNum]*blob.FileReader)
+	return c
+}
+
+// Fetch implements base.ValueFetcher.
+func (c *blobFileCache) Fetch(
+	handle []byte, valLen int32, buf []byte,
+) (val []byte, callerOwned bool, err error) {
+	h, err := blob.DecodeHandle(handle)
+	if err != nil {
+		return nil, false, err
+	}
+	if val, err = c.readValue(context.TODO(), h, buf); err != nil {
+		return nil, false, err
+	}
+	return val, true, nil
+}
+
+// readValue reads the value identified by the handle, using buf if it has
+// sufficient capacity.
+func (c *blobFileCache) readValue(ctx context.Context, h blob.Handle, buf []byte) ([]byte, error) {
+	r, err := c.getReader(ctx, h.FileNum)
+	if err != nil {
+		return nil, err
+	}
+	return r.ReadValue(ctx, h, buf)
+}
+
+func (c *blobFileCache) getReader(
+	ctx context.Context, fileNum base.DiskFileNum,
+) (*blob.FileReader, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if r, ok := c.mu.readers[fileNum]; ok {
+		return r, nil
+	}
+	readable, err := c.objProvider.OpenForReading(ctx, fileTypeBlob, fileNum, objstorage.OpenOptions{MustExist: true})
+	if err != nil {
+		return nil, err
+	}
+	r, err := blob.NewFileReader(ctx, fileNum, readable)
+	if err != nil {
+		_ = readable.Close()
+		return nil, err
+	}
+	c.mu.readers[fileNum] = r
+	return r, nil
+}
+
+// evict closes the reader of a blob file that is about to be deleted.
+func (c *blobFileCache) evict(fileNum base.DiskFileNum) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if r, ok := c.mu.readers[fileNum]; ok {
+		_ = r.Close()
+		delete(c.mu.readers, fileNum)
+	}
+}
+
+func (c *blobFileCache) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var err error
+	for fileNum, r := range c.mu.readers {
+		err = firstError(err, r.Close())
+		delete(c.mu.readers, fileNum)
+	}
+	return err
+}
+
+// blobRef is a reference to a value stored in a blob file, returned by the
+// compactionIter in place of the value.
+type blobRef struct {
+	handle    blob.Handle
+	attribute base.ShortAttribute
+	valid     bool
+}
+
+// compactionBlobWriter writes the point keys of a flush or compaction to its
+// output sstables, separating large values into blob files and rewriting the
+// values of blob files that are being garbage collected.
+type compactionBlobWriter struct {
+	d *DB
+	c *compaction
+	// threshold is the minimum length of the values that are separated. Values
+	// are not separated if it's zero.
+	threshold int
+	// gcCutoff is the file number below which the values of blob files are
+	// rewritten rather than referenced by the outputs.
+	gcCutoff base.DiskFileNum
+	// targetFileSize is the size at which a blob file is finished and a new
+	// one started.
+	targetFileSize uint64
+
+	fw *blob.FileWriter
+	// created holds the blob files created by the compaction, which are
+	// removed if the compaction fails.
+	created []base.DiskFileNum
+	// bytesWritten is the total size of the finished blob files.
+	bytesWritten uint64
+	buf          []byte
+}
+
+// add adds the point key and its value to tw, separating the value into a blob
+// file if it's large enough.
+func (w *compactionBlobWriter) add(
+	tw *sstable.Writer, key InternalKey, value []byte, forceObsolete bool,
+) error {
+	if w.threshold == 0 || key.Kind() != InternalKeyKindSet || len(value) < w.threshold {
+		return tw.AddWithForceObsolete(key, value, forceObsolete)
+	}
+	var attribute base.ShortAttribute
+	if extract := w.d.opts.Experimental.ShortAttributeExtractor; extract != nil {
+		var err error
+		attribute, err = extract(key.UserKey, w.d.opts.Comparer.Split(key.UserKey), value)
+		if err != nil {
+			return err
+		}
+	}
+	h, err := w.addValue(value)
+	if err != nil {
+		return err
+	}
+	return tw.AddWithBlobHandle(key, h, attribute, forceObsolete)
+}
+
+// addRef adds the point key to tw, referencing the value in a blob file. If
+// the blob file is being garbage collected, the value is rewritten instead.
+func (w *compactionBlobWriter) addRef(
+	tw *sstable.Writer, key InternalKey, ref blobRef, forceObsolete bool,
+) error {
+	if ref.handle.FileNum >= w.gcCutoff {
+		return tw.AddWithBlobHandle(key, ref.handle, ref.attribute, forceObsolete)
+	}
+	value, err := w.d.blobFiles.readValue(context.TODO(), ref.handle, w.buf)
+	if err != nil {
+		return err
+	}
+	w.buf = value
+	return w.add(tw, key, value, forceObsolete)
+}
+
+func (w *compactionBlobWriter) addValue(value []byte) (blob.Handle, error) {
+	if w.fw == nil {
+		if err := w.newFile(); err != nil {
+			return blob.Handle{}, err
+		}
+	}
+	h, err := w.fw.AddValue(value)
+	if err != nil {
+		return blob.Handle{}, err
+	}
+	if w.fw.Size() >= w.targetFileSize {
+		if err := w.finishFile(); err != nil {
+			return blob.Handle{}, err
+		}
+	}
+	return h, nil
+}
+
+func (w *compactionBlobWriter) newFile() error {
+	if w.c.cancel.Load() {
+		return ErrCancelledCompaction
+	}
+	w.d.mu.Lock()
+	fileNum := w.d.mu.versions.getNextDiskFileNum()
+	w.d.mu.Unlock()
+
+	writable, _, err := w.d.objProvider.Create(context.TODO(), fileTypeBlob, fileNum, objstorage.CreateOptions{})
+	if err != nil {
+		return err
+	}
+	if w.c.kind != compactionKindFlush {
+		writable = &compactionWritable{
+			Writable: writable,
+			versions: w.d.mu.versions,
+			written:  &w.c.bytesWritten,
+			limiter:  w.c.limiter,
+			cancel:   &w.c.cancel,
+		}
+	}
+	writable = w.d.rateLimitWritable(w.c, writable)
+	w.created = append(w.created, fileNum)
+	w.fw = blob.NewFileWriter(fileNum, writable)
+	return nil
+}
+
+func (w *compactionBlobWriter) finishFile() error {
+	fw := w.fw
+	w.fw = nil
+	stats, err := fw.Close()
+	if err != nil {
+		return err
+	}
+	w.bytesWritten += stats.FileSize
+	return nil
+}
+
+// finish finishes the blob file being written, if any.
+func (w *compactionBlobWriter) finish() error {
+	if w.fw == nil {
+		return nil
+	}
+	return w.finishFile()
+}
+
+// abort aborts the blob file being written, if any, and removes the blob files
+// created by the compaction.
+func (w *compactionBlobWriter) abort() {
+	if w.fw != nil {
+		w.fw.Abort()
+		w.fw = nil
+	}
+	for _, fileNum := range w.created {
+		_ = w.d.objProvider.Remove(fileTypeBlob, fileNum)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlobFileRefs(t *testing.T) {
+	var r blobFileRefs
+	r.init()
+	m := func(backing base.DiskFileNum, blobFiles ...base.DiskFileNum) *fileMetadata {
+		f := &fileMetadata{FileNum: base.FileNum(backing), BlobFiles: blobFiles}
+		f.InitPhysicalBacking()
+		return f
+	}
+	r.addTable(m(10, 1, 2))
+	r.addTable(m(11, 2, 3))
+	// A backing is only tracked once.
+	r.addTable(m(11, 2, 3))
+	r.addTable(m(12))
+	require.True(t, r.isLive(2))
+	require.Equal(t, base.DiskFileNum(0), r.gcCutoff(0))
+	require.Equal(t, base.DiskFileNum(1), r.gcCutoff(0.25))
+	require.Equal(t, base.DiskFileNum(2), r.gcCutoff(0.5))
+	require.Equal(t, base.DiskFileNum(4), r.gcCutoff(1))
+
+	require.Nil(t, r.removeBacking(12, nil))
+	require.Equal(t, []base.DiskFileNum{1}, r.removeBacking(10, nil))
+	require.True(t, r.isLive(2))
+	obsolete := r.removeBacking(11, nil)
+	sort.Slice(obsolete, func(i, j int) bool { return obsolete[i] < obsolete[j] })
+	require.Equal(t, []base.DiskFileNum{2, 3}, obsolete)
+	require.False(t, r.isLive(2))
+	require.Equal(t, base.DiskFileNum(0), r.gcCutoff(1))
+}
+
+func TestBlobValues(t *testing.T) {
+	mem := vfs.NewMem()
+	opts := &Options{
+		FS:                          mem,
+		FormatMajorVersion:          FormatBlobValues,
+		DisableAutomaticCompactions: true,
+	}
+	opts.Experimental.BlobValueThreshold = 100
+	opts.Experimental.BlobGCAgeCutoff = -1
+	d, err := Open("", opts)
+	require.NoError(t, err)
+
+	blobFiles := func() []string {
+		d.cleanupManager.Wait()
+		ls, err := mem.List("")
+		require.NoError(t, err)
+		var names []string
+		for _, name := range ls {
+			if ft, _, ok := base.ParseFilename(mem, name); ok && ft == base.FileTypeBlob {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		return names
+	}
+	large := func(k string, i int) []byte {
+		return bytes.Repeat([]byte(fmt.Sprintf("%s-%d.", k, i)), 50)
+	}
+	write := func(i int) {
+		for _, k := range []string{"a", "b", "c"} {
+			require.NoError(t, d.Set([]byte(k), large(k, i), nil))
+		}
+		require.NoError(t, d.Set([]byte("small"), []byte(fmt.Sprint(i)), nil))
+		require.NoError(t, d.Flush())
+	}
+	check := func(i int) {
+		for _, k := range []string{"a", "b", "c"} {
+			v, closer, err := d.Get([]byte(k))
+			require.NoError(t, err)
+			require.Equal(t, large(k, i), v)
+			require.NoError(t, closer.Close())
+		}
+		v, closer, err := d.Get([]byte("small"))
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprint(i), string(v))
+		require.NoError(t, closer.Close())
+
+		iter, _ := d.NewIter(nil)
+		var n int
+		for valid := iter.First(); valid; valid = iter.Next() {
+			n++
+		}
+		require.Equal(t, 4, n)
+		require.NoError(t, iter.Close())
+	}
+
+	// Flushes separate the large values into a blob file.
+	write(1)
+	check(1)
+	require.Len(t, blobFiles(), 1)
+	require.NotZero(t, d.Metrics().Levels[0].Additional.BytesWrittenBlobFiles)
+
+	// Values survive a reopen.
+	require.NoError(t, d.Close())
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	check(1)
+
+	// A compaction passes the handles of the live values through rather than
+	// rewriting them, so the blob file of the first flush is obsolete once the
+	// compaction removes the sstables referencing it, while that of the second
+	// flush remains.
+	write(2)
+	require.Len(t, blobFiles(), 2)
+	first := blobFiles()[0]
+	require.NoError(t, d.Compact([]byte("a"), []byte("z"), false))
+	check(2)
+	require.Zero(t, d.Metrics().Levels[numLevels-1].Additional.BytesWrittenBlobFiles)
+	files := blobFiles()
+	require.Len(t, files, 1)
+	require.NotEqual(t, first, files[0])
+	require.NoError(t, d.Close())
+
+	// With garbage collection enabled, a compaction rewrites the values of the
+	// oldest blob files into a new blob file. Flush an overlapping sstable, so
+	// that the compaction isn't a move.
+	opts.Experimental.BlobGCAgeCutoff = 1
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	require.NoError(t, d.Set([]byte("small"), []byte("2"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Compact([]byte("a"), []byte("z"), false))
+	check(2)
+	require.NotZero(t, d.Metrics().Levels[numLevels-1].Additional.BytesWrittenBlobFiles)
+	require.Len(t, blobFiles(), 1)
+	require.NotEqual(t, files, blobFiles())
+	require.NoError(t, d.Close())
+}
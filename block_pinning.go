@@ -0,0 +1,216 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"slices"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/sstable"
+)
+
+// Blocks of tables are pinned in the block cache for the spans passed to
+// DB.PinTables, and for the levels at or below
+// Options.Experimental.PinnedBlocksMinLevel. Pinned blocks are never evicted to
+// make room for other blocks, until the table is deleted and evicted from the
+// cache, or unpinned.
+//
+// Whenever a new version is installed, a pinning pass is requested. A pass
+// computes the tables whose blocks should be pinned in the current version,
+// pins the blocks of the tables that aren't pinned yet, and unpins the tables
+// that are no longer desired (e.g. because they moved to a level above
+// PinnedBlocksMinLevel, or to stay within PinnedBlocksMaxBytes). Only one
+// pass runs at a time; requests made while a pass is running are coalesced
+// into a single subsequent pass.
+
+// PinTables pins blocks of the tables overlapping span in the block cache: the
+// index, filter, range deletion and range key blocks of the tables, and the
+// data blocks that may hold keys within span. The span remains pinned for the
+// lifetime of the DB, so the blocks of the tables created by flushes,
+// compactions and ingestions within span are pinned too. PinTables returns once
+// the blocks of the tables currently overlapping span are pinned.
+//
+// The total size of pinned blocks is limited by
+// Options.Experimental.PinnedBlocksMaxBytes, and is reported by
+// Metrics.Table.PinnedBlocksSize.
+func (d *DB) PinTables(span KeyRange) error {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if !span.Valid() || d.cmp(span.Start, span.End) >= 0 {
+		return errors.Errorf("pebble: invalid pin span [%q, %q)", span.Start, span.End)
+	}
+	span = KeyRange{Start: slices.Clone(span.Start), End: slices.Clone(span.End)}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	p := &d.mu.blockPinning
+	p.spans = append(p.spans, span)
+	p.requested++
+	pass := p.requested
+	d.maybeUpdatePinnedBlocksLocked()
+	for p.completed < pass {
+		if d.closed.Load() != nil {
+			return ErrClosed
+		}
+		p.cond.Wait()
+	}
+	return p.err
+}
+
+// requestPinnedBlocksUpdateLocked requests a pinning pass, if block pinning is
+// enabled. It's called whenever a new version is installed. DB.mu must be
+// locked when calling.
+func (d *DB) requestPinnedBlocksUpdateLocked() {
+	if d.opts.Experimental.PinnedBlocksMinLevel == 0 && len(d.mu.blockPinning.spans) == 0 {
+		return
+	}
+	d.mu.blockPinning.requested++
+	d.maybeUpdatePinnedBlocksLocked()
+}
+
+// maybeUpdatePinnedBlocksLocked starts a pinning pass if one was requested and
+// none is running. DB.mu must be locked when calling.
+func (d *DB) maybeUpdatePinnedBlocksLocked() {
+	p := &d.mu.blockPinning
+	// A nil cond.L indicates the DB is still being opened; the pass requested
+	// meanwhile is started once the DB is open.
+	if p.running || p.completed >= p.requested || p.cond.L == nil || d.closed.Load() != nil {
+		return
+	}
+	p.running = true
+	go d.updatePinnedBlocks()
+}
+
+// pinnedTable describes a table whose blocks are pinned in the block cache.
+type pinnedTable struct {
+	// spans holds the indexes of the spans passed to DB.PinTables the table's
+	// data blocks are pinned for.
+	spans []int
+	// size is the total size of the table's pinned blocks.
+	size uint64
+}
+
+// updatePinnedBlocks runs a pinning pass against the current version.
+func (d *DB) updatePinnedBlocks() {
+	d.mu.Lock()
+	p := &d.mu.blockPinning
+	pass := p.requested
+	spans := p.spans
+	pinned := p.tables
+	// Drop DB.mu before performing IO.
+	d.mu.Unlock()
+
+	rs := d.loadReadState()
+	tables, err := d.pinBlocks(rs.current, spans, pinned)
+	rs.unref()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	p.running = false
+	p.completed = pass
+	p.err = err
+	p.tables = tables
+	p.count, p.size = len(tables), 0
+	for _, t := range tables {
+		p.size += t.size
+	}
+	p.cond.Broadcast()
+	d.maybeUpdatePinnedBlocksLocked()
+}
+
+// pinBlocks pins the blocks of the tables of the version overlapping spans and
+// of the levels at or below Options.Experimental.PinnedBlocksMinLevel, and
+// unpins the other tables of pinned. It returns the tables that are pinned,
+// keyed by the file number of their backing sstable.
+func (d *DB) pinBlocks(
+	v *version, spans []KeyRange, pinned map[base.DiskFileNum]pinnedTable,
+) (map[base.DiskFileNum]pinnedTable, error) {
+	type desiredTable struct {
+		meta  *fileMetadata
+		spans []int
+	}
+	desired := make(map[base.DiskFileNum]*desiredTable)
+	var order []base.DiskFileNum
+	add := func(f *fileMetadata, span int) {
+		t, ok := desired[f.FileBacking.DiskFileNum]
+		if !ok {
+			t = &desiredTable{meta: f}
+			desired[f.FileBacking.DiskFileNum] = t
+			order = append(order, f.FileBacking.DiskFileNum)
+		}
+		// Virtual tables sharing a backing may overlap the same span.
+		if span >= 0 && !slices.Contains(t.spans, span) {
+			t.spans = append(t.spans, span)
+		}
+	}
+	// The spans passed to DB.PinTables take precedence over the levels.
+	for i, span := range spans {
+		for level := range v.Levels {
+			overlaps := v.Overlaps(level, span.UserKeyBounds())
+			iter := overlaps.Iter()
+			for f := iter.First(); f != nil; f = iter.Next() {
+				add(f, i)
+			}
+		}
+	}
+	if minLevel := d.opts.Experimental.PinnedBlocksMinLevel; minLevel > 0 {
+		for level := numLevels - 1; level >= minLevel; level-- {
+			iter := v.Levels[level].Iter()
+			for f := iter.First(); f != nil; f = iter.Next() {
+				add(f, -1)
+			}
+		}
+	}
+
+	maxBytes := uint64(d.opts.Experimental.PinnedBlocksMaxBytes)
+	if maxBytes == 0 {
+		maxBytes = uint64(d.opts.Cache.MaxSize() / 4)
+	}
+	var firstErr error
+	var size uint64
+	tables := make(map[base.DiskFileNum]pinnedTable, len(order))
+	for _, fileNum := range order {
+		if size >= maxBytes {
+			// The remaining tables are unpinned below.
+			break
+		}
+		t := desired[fileNum]
+		if prev, ok := pinned[fileNum]; ok && slices.Equal(prev.spans, t.spans) {
+			tables[fileNum] = prev
+			size += prev.size
+			delete(pinned, fileNum)
+			continue
+		}
+		// Pinning is idempotent, so the blocks of a table that's already
+		// pinned for fewer spans are pinned again.
+		bounds := make([]base.UserKeyBounds, len(t.spans))
+		for i, span := range t.spans {
+			bounds[i] = spans[span].UserKeyBounds()
+		}
+		var tableSize uint64
+		err := d.tableCache.withBackingReader(t.meta, func(r *sstable.Reader) (err error) {
+			tableSize, err = r.PinBlocks(context.Background(), bounds)
+			return err
+		})
+		if err != nil {
+			d.opts.Logger.Infof("pebble: unable to pin blocks of %s: %s", fileNum, err)
+			firstErr = firstError(firstErr, err)
+			// Unpin the blocks pinned before the error.
+			d.opts.Cache.UnpinFile(d.cacheID, fileNum)
+			delete(pinned, fileNum)
+			continue
+		}
+		tables[fileNum] = pinnedTable{spans: t.spans, size: tableSize}
+		size += tableSize
+		delete(pinned, fileNum)
+	}
+	for fileNum := range pinned {
+		d.opts.Cache.UnpinFile(d.cacheID, fileNum)
+	}
+	return tables, firstErr
+}
@@ -0,0 +1,91 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPinTables(t *testing.T) {
+	opts := &Options{
+		FS:     vfs.NewMem(),
+		Levels: []LevelOptions{{BlockSize: 256}},
+	}
+	opts.Experimental.PinnedBlocksMinLevel = 6
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	write := func(value string) {
+		for i := 0; i < 1000; i++ {
+			require.NoError(t, d.Set([]byte(fmt.Sprintf("k%04d", i)), []byte(value), nil))
+		}
+		require.NoError(t, d.Compact([]byte("k"), []byte("l"), false /* parallelize */))
+	}
+	requirePinned := func(count int64) *Metrics {
+		var m *Metrics
+		require.Eventually(t, func() bool {
+			m = d.Metrics()
+			return m.Table.PinnedBlocksCount == count
+		}, 10*time.Second, time.Millisecond)
+		require.Greater(t, m.Table.PinnedBlocksSize, uint64(0))
+		require.Equal(t, int64(m.Table.PinnedBlocksSize), m.BlockCache.PinnedSize)
+		return m
+	}
+
+	// The index blocks of the L6 table are pinned.
+	write("a")
+	require.Equal(t, int64(1), d.Metrics().Levels[6].NumFiles)
+	m := requirePinned(1)
+	indexSize := m.Table.PinnedBlocksSize
+
+	// The data blocks within pinned spans are pinned too, once PinTables
+	// returns.
+	require.NoError(t, d.PinTables(KeyRange{Start: []byte("k0100"), End: []byte("k0200")}))
+	m = d.Metrics()
+	require.Equal(t, int64(1), m.Table.PinnedBlocksCount)
+	require.Greater(t, m.Table.PinnedBlocksSize, indexSize)
+
+	// The table replacing the L6 table is pinned in its stead, along with its
+	// data blocks within the pinned span.
+	write("b")
+	require.Eventually(t, func() bool {
+		m = d.Metrics()
+		return m.BlockCache.PinnedSize == int64(m.Table.PinnedBlocksSize)
+	}, 10*time.Second, time.Millisecond)
+	require.Equal(t, int64(1), m.Table.PinnedBlocksCount)
+	require.Greater(t, m.Table.PinnedBlocksSize, indexSize)
+
+	err = d.PinTables(KeyRange{Start: []byte("b"), End: []byte("a")})
+	require.EqualError(t, err, `pebble: invalid pin span ["b", "a")`)
+}
+
+func TestPinTablesMaxBytes(t *testing.T) {
+	opts := &Options{
+		FS:     vfs.NewMem(),
+		Levels: []LevelOptions{{BlockSize: 256}},
+	}
+	opts.Experimental.PinnedBlocksMaxBytes = 1
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	for _, k := range []string{"a", "b"} {
+		require.NoError(t, d.Set([]byte(k), []byte(k), nil))
+		require.NoError(t, d.Flush())
+	}
+	require.Equal(t, int64(2), d.Metrics().Levels[0].NumFiles)
+
+	// Only one of the tables is pinned, as its blocks exceed the limit.
+	require.NoError(t, d.PinTables(KeyRange{Start: []byte("a"), End: []byte("c")}))
+	m := d.Metrics()
+	require.Equal(t, int64(1), m.Table.PinnedBlocksCount)
+	require.Equal(t, int64(m.Table.PinnedBlocksSize), m.BlockCache.PinnedSize)
+}
@@ -278,7 +278,9 @@ func (d *DB) Checkpoint(
 	// Set of FileBacking.DiskFileNum which will be required by virtual sstables
 	// in the checkpoint.
 	requiredVirtualBackingFiles := make(map[base.DiskFileNum]struct{})
-	// Link or copy the sstables.
+	// Set of blob files referenced by the sstables in the checkpoint.
+	linkedBlobFiles := make(map[base.DiskFileNum]struct{})
+	// Link or copy the sstables, and the blob files they reference.
 	for l := range current.Levels {
 		iter := current.Levels[l].Iter()
 		for f := iter.First(); f != nil; f = iter.Next() {
@@ -322,6 +324,19 @@ func (d *DB) Checkpoint(
 			if ckErr != nil {
 				return ckErr
 			}
+
+			for _, blobFileNum := range f.BlobFiles {
+				if _, ok := linkedBlobFiles[blobFileNum]; ok {
+					continue
+				}
+				linkedBlobFiles[blobFileNum] = struct{}{}
+				srcPath := base.MakeFilepath(fs, d.dirname, fileTypeBlob, blobFileNum)
+				destPath := fs.PathJoin(destDir, fs.PathBase(srcPath))
+				ckErr = vfs.LinkOrCopy(fs, srcPath, destPath)
+				if ckErr != nil {
+					return ckErr
+				}
+			}
 		}
 	}
 
@@ -30,7 +30,7 @@ type ArchiveCleaner = base.ArchiveCleaner
 type cleanupManager struct {
 	opts            *Options
 	objProvider     objstorage.Provider
-	onTableDeleteFn func(fileSize uint64, isLocal bool)
+	onTableDeleteFn func(fileNum base.DiskFileNum, fileSize uint64, isLocal bool)
 	deletePacer     *deletionPacer
 
 	// jobsCh is used as the cleanup job queue.
@@ -78,7 +78,7 @@ type cleanupJob struct {
 func openCleanupManager(
 	opts *Options,
 	objProvider objstorage.Provider,
-	onTableDeleteFn func(fileSize uint64, isLocal bool),
+	onTableDeleteFn func(fileNum base.DiskFileNum, fileSize uint64, isLocal bool),
 	getDeletePacerInfo func() deletionPacerInfo,
 ) *cleanupManager {
 	cm := &cleanupManager{
@@ -163,8 +163,10 @@ func (cm *cleanupManager) mainLoop() {
 			switch of.fileType {
 			case fileTypeTable:
 				cm.maybePace(&tb, of.fileType, of.nonLogFile.fileNum, of.nonLogFile.fileSize)
-				cm.onTableDeleteFn(of.nonLogFile.fileSize, of.nonLogFile.isLocal)
+				cm.onTableDeleteFn(of.nonLogFile.fileNum, of.nonLogFile.fileSize, of.nonLogFile.isLocal)
 				cm.deleteObsoleteObject(fileTypeTable, job.jobID, of.nonLogFile.fileNum)
+			case fileTypeBlob:
+				cm.deleteObsoleteObject(fileTypeBlob, job.jobID, of.nonLogFile.fileNum)
 			case fileTypeLog:
 				cm.deleteObsoleteFile(of.logFile.FS, fileTypeLog, job.jobID, of.logFile.Path,
 					base.DiskFileNum(of.logFile.NumWAL), of.logFile.ApproxFileSize)
@@ -258,7 +260,7 @@ func (cm *cleanupManager) deleteObsoleteFile(
 func (cm *cleanupManager) deleteObsoleteObject(
 	fileType fileType, jobID JobID, fileNum base.DiskFileNum,
 ) {
-	if fileType != fileTypeTable {
+	if fileType != fileTypeTable && fileType != fileTypeBlob {
 		panic("not an object")
 	}
 
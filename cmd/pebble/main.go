@@ -58,7 +58,12 @@ func main() {
 	rootCmd.AddCommand(benchCmd)
 
 	t := tool.New(tool.Comparers(mvccComparer, testkeys.Comparer), tool.Mergers(fauxMVCCMerger))
-	rootCmd.AddCommand(t.Commands...)
+	for _, cmd := range t.Commands {
+		// The tool's bench commands are superseded by benchCmd.
+		if cmd.Name() != benchCmd.Name() {
+			rootCmd.AddCommand(cmd)
+		}
+	}
 
 	for _, cmd := range []*cobra.Command{replayCmd, scanCmd, syncCmd, tombstoneCmd, writeBenchCmd, ycsbCmd} {
 		cmd.Flags().BoolVarP(
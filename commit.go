@@ -10,6 +10,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/batchrepr"
 	"github.com/cockroachdb/pebble/record"
 )
@@ -139,6 +140,10 @@ type commitEnv struct {
 	// the memtable the batch should be applied to. Serial execution enforced by
 	// commitPipeline.mu.
 	write func(b *Batch, wg *sync.WaitGroup, err *error) (*memTable, error)
+	// Check the preconditions of the batch, once all the batches sequenced
+	// before it have been applied. Only invoked for batches with preconditions.
+	// Serial execution enforced by commitPipeline.mu.
+	checkConditions func(b *Batch) error
 }
 
 // A commitPipeline manages the stages of committing a set of mutations
@@ -247,6 +252,17 @@ type commitPipeline struct {
 	// The mutex to use for synchronizing access to logSeqNum and serializing
 	// calls to commitEnv.write().
 	mu sync.Mutex
+	// visibleWaiter is set while a goroutine holding mu waits for
+	// visibleSeqNum to reach a sequence number, and is notified by the publish
+	// of that sequence number. See waitVisibleLocked.
+	visibleWaiter atomic.Pointer[visibleSeqNumWaiter]
+}
+
+// visibleSeqNumWaiter is notified, by closing ch, once visibleSeqNum reaches
+// seqNum.
+type visibleSeqNumWaiter struct {
+	seqNum uint64
+	ch     chan struct{}
 }
 
 func newCommitPipeline(env commitEnv) *commitPipeline {
@@ -314,7 +330,11 @@ func (p *commitPipeline) Commit(b *Batch, syncWAL bool, noSyncWait bool) error {
 	// NB: We set Batch.commitErr on error so that the batch won't be a candidate
 	// for reuse. See Batch.release().
 	mem, err := p.prepare(b, syncWAL, noSyncWait)
-	if err != nil {
+	if errors.Is(err, errBatchNotCommitted) {
+		// The batch's preconditions weren't satisfied: it wasn't enqueued, and
+		// may be reused.
+		return err
+	} else if err != nil {
 		b.db = nil // prevent batch reuse on error
 		// NB: we are not doing <-p.commitQueueSem since the batch is still
 		// sitting in the pending queue. We should consider fixing this by also
@@ -430,6 +450,26 @@ func (p *commitPipeline) prepare(b *Batch, syncWAL bool, noSyncWait bool) (*memT
 	if n == invalidBatchCount {
 		return nil, ErrInvalidBatch
 	}
+
+	p.mu.Lock()
+
+	if len(b.conditions) > 0 {
+		// Wait for the batches sequenced before this one to be applied, as
+		// AllocateSeqNum does, so that the preconditions are checked against
+		// their mutations. No other batch is sequenced until p.mu is released.
+		p.waitVisibleLocked(p.env.logSeqNum.Load())
+		if err := p.env.checkConditions(b); err != nil {
+			p.mu.Unlock()
+			// The batch isn't enqueued, so release the semaphores acquired by
+			// Commit.
+			<-p.commitQueueSem
+			if syncWAL {
+				<-p.logSyncQSem
+			}
+			return nil, errors.Mark(err, errBatchNotCommitted)
+		}
+	}
+
 	var syncWG *sync.WaitGroup
 	var syncErr *error
 	switch {
@@ -451,8 +491,6 @@ func (p *commitPipeline) prepare(b *Batch, syncWAL bool, noSyncWait bool) (*memT
 		b.commit.Add(2)
 	}
 
-	p.mu.Lock()
-
 	// Enqueue the batch in the pending queue. Note that while the pending queue
 	// is lock-free, we want the order of batches to be the same as the sequence
 	// number order.
@@ -471,6 +509,24 @@ func (p *commitPipeline) prepare(b *Batch, syncWAL bool, noSyncWait bool) (*memT
 	return mem, err
 }
 
+// waitVisibleLocked waits for visibleSeqNum to reach seqNum, which must have
+// been assigned to a batch that's pending publish. Unlike the spin loop of
+// AllocateSeqNum, it blocks until notified by publish. p.mu must be held by
+// the caller, so at most one goroutine waits at a time.
+func (p *commitPipeline) waitVisibleLocked(seqNum uint64) {
+	if p.env.visibleSeqNum.Load() >= seqNum {
+		return
+	}
+	w := &visibleSeqNumWaiter{seqNum: seqNum, ch: make(chan struct{})}
+	p.visibleWaiter.Store(w)
+	// The sequence number may have been published before the waiter was set,
+	// in which case publish may not have observed it.
+	if p.env.visibleSeqNum.Load() >= seqNum && p.visibleWaiter.CompareAndSwap(w, nil) {
+		return
+	}
+	<-w.ch
+}
+
 func (p *commitPipeline) publish(b *Batch) {
 	// Mark the batch as applied.
 	b.applied.Store(true)
@@ -508,7 +564,12 @@ func (p *commitPipeline) publish(b *Batch) {
 				break
 			}
 			if p.env.visibleSeqNum.CompareAndSwap(curSeqNum, newSeqNum) {
-				// We successfully published t's sequence number.
+				// We successfully published t's sequence number. Notify the
+				// goroutine waiting for it, if any.
+				if w := p.visibleWaiter.Load(); w != nil && w.seqNum <= newSeqNum &&
+					p.visibleWaiter.CompareAndSwap(w, nil) {
+					close(w.ch)
+				}
 				break
 			}
 		}
@@ -208,6 +208,55 @@ func TestCommitPipelineAllocateSeqNum(t *testing.T) {
 	}
 }
 
+func TestCommitPipelineConditionsWait(t *testing.T) {
+	var e testCommitEnv
+	env := e.env()
+	// The apply of the first batch blocks until unblockApply is closed.
+	unblockApply := make(chan struct{})
+	env.apply = func(b *Batch, mem *memTable) error {
+		if b.SeqNum() == 0 {
+			<-unblockApply
+		}
+		return e.apply(b, mem)
+	}
+	var checkedVisibleSeqNum atomic.Uint64
+	env.checkConditions = func(b *Batch) error {
+		checkedVisibleSeqNum.Store(e.visibleSeqNum.Load())
+		return nil
+	}
+	p := newCommitPipeline(env)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		var b Batch
+		_ = b.Set([]byte("a"), nil, nil)
+		require.NoError(t, p.Commit(&b, false, false))
+	}()
+	for e.logSeqNum.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	go func() {
+		defer wg.Done()
+		var b Batch
+		b.ExpectAbsent([]byte("a"))
+		_ = b.Set([]byte("b"), nil, nil)
+		require.NoError(t, p.Commit(&b, false, false))
+	}()
+
+	// The batch with preconditions waits for the first batch to be published,
+	// rather than spinning.
+	for p.visibleWaiter.Load() == nil {
+		time.Sleep(time.Millisecond)
+	}
+	close(unblockApply)
+	wg.Wait()
+	require.Equal(t, uint64(1), checkedVisibleSeqNum.Load())
+	require.Nil(t, p.visibleWaiter.Load())
+	require.Equal(t, uint64(2), e.visibleSeqNum.Load())
+}
+
 type syncDelayFile struct {
 	vfs.File
 	done chan struct{}
@@ -14,6 +14,7 @@ import (
 	"runtime/pprof"
 	"slices"
 	"sort"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -30,10 +31,10 @@ import (
 	"github.com/cockroachdb/pebble/internal/rangekey"
 	"github.com/cockroachdb/pebble/objstorage"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider/objiotracing"
-	"github.com/cockroachdb/pebble/objstorage/remote"
 	"github.com/cockroachdb/pebble/sstable"
 	"github.com/cockroachdb/pebble/vfs"
 	"github.com/cockroachdb/pebble/wal"
+	"github.com/cockroachdb/tokenbucket"
 )
 
 var errEmptyTable = errors.New("pebble: empty table")
@@ -122,10 +123,21 @@ type compactionWritable struct {
 
 	versions *versionSet
 	written  *int64
+	// limiter, if non-nil, paces writes. It's set for manual compactions
+	// scheduled through DB.CompactRange with a write rate limit.
+	limiter *compactionRateLimiter
+	// cancel is the owning compaction's cancel bool, consulted while waiting on
+	// the limiter so that a preempted compaction doesn't linger.
+	cancel *atomic.Bool
 }
 
 // Write is part of the objstorage.Writable interface.
 func (c *compactionWritable) Write(p []byte) error {
+	if c.limiter != nil {
+		if err := c.limiter.wait(len(p), c.cancel); err != nil {
+			return err
+		}
+	}
 	if err := c.Writable.Write(p); err != nil {
 		return err
 	}
@@ -135,6 +147,50 @@ func (c *compactionWritable) Write(p []byte) error {
 	return nil
 }
 
+// compactionRateLimiter limits the rate at which the compactions of a single
+// DB.CompactRange call write output bytes. It's shared by all the compactions
+// of the call, which may run concurrently when the range is parallelized.
+type compactionRateLimiter struct {
+	ctx context.Context
+	mu  sync.Mutex
+	tb  tokenbucket.TokenBucket
+}
+
+func newCompactionRateLimiter(ctx context.Context, bytesPerSecond int64) *compactionRateLimiter {
+	l := &compactionRateLimiter{ctx: ctx}
+	// Each token corresponds to a byte written. Allow bursts of up to a second
+	// worth of writes.
+	l.tb.Init(tokenbucket.TokensPerSecond(bytesPerSecond), tokenbucket.Tokens(bytesPerSecond))
+	return l
+}
+
+// wait blocks until n bytes may be written. It returns early with
+// ErrCancelledCompaction if cancel is set while waiting, or with the context's
+// error if the context is done.
+func (l *compactionRateLimiter) wait(n int, cancel *atomic.Bool) error {
+	// maxWait bounds the time between checks of cancel.
+	const maxWait = 100 * time.Millisecond
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for {
+		if cancel.Load() {
+			return ErrCancelledCompaction
+		}
+		fulfilled, tryAgainAfter := l.tb.TryToFulfill(tokenbucket.Tokens(n))
+		if fulfilled {
+			return nil
+		}
+		if tryAgainAfter > maxWait {
+			tryAgainAfter = maxWait
+		}
+		select {
+		case <-time.After(tryAgainAfter):
+		case <-l.ctx.Done():
+			return l.ctx.Err()
+		}
+	}
+}
+
 type compactionKind int
 
 const (
@@ -151,6 +207,12 @@ const (
 	compactionKindRead
 	compactionKindRewrite
 	compactionKindIngestedFlushable
+	// compactionKindExpiry denotes a compaction that rewrites a table in place
+	// to drop its expired keys.
+	compactionKindExpiry
+	// compactionKindTombstoneDensity denotes a compaction of a table dominated
+	// by tombstones. See Options.Experimental.TombstoneDenseCompactionThreshold.
+	compactionKindTombstoneDensity
 )
 
 func (k compactionKind) String() string {
@@ -173,6 +235,10 @@ func (k compactionKind) String() string {
 		return "ingested-flushable"
 	case compactionKindCopy:
 		return "copy"
+	case compactionKindExpiry:
+		return "expiry"
+	case compactionKindTombstoneDensity:
+		return "tombstone-density"
 	}
 	return "?"
 }
@@ -180,11 +246,33 @@ func (k compactionKind) String() string {
 // rangeKeyCompactionTransform is used to transform range key spans as part of the
 // keyspanimpl.MergingIter. As part of this transformation step, we can elide range
 // keys in the last snapshot stripe, as well as coalesce range keys within
-// snapshot stripes.
+// snapshot stripes. If historyHorizon is non-zero, the range keys with sequence
+// numbers >= historyHorizon are each in a snapshot stripe of their own (see
+// historySnapshotIndex).
 func rangeKeyCompactionTransform(
-	eq base.Equal, snapshots []uint64, elideRangeKey func(start, end []byte) bool,
+	eq base.Equal,
+	allSnapshots []uint64,
+	historyHorizon uint64,
+	elideRangeKey func(start, end []byte) bool,
 ) keyspan.Transformer {
+	var historySnapshots []uint64
 	return keyspan.TransformerFunc(func(cmp base.Compare, s keyspan.Span, dst *keyspan.Span) error {
+		snapshots := allSnapshots
+		if historyHorizon != 0 {
+			// Replace the snapshots >= historyHorizon by snapshots at
+			// historyHorizon and above each of the keys >= historyHorizon.
+			n := sort.Search(len(allSnapshots), func(i int) bool {
+				return allSnapshots[i] >= historyHorizon
+			})
+			historySnapshots = append(historySnapshots[:0], allSnapshots[:n]...)
+			historySnapshots = append(historySnapshots, historyHorizon)
+			for j := len(s.Keys) - 1; j >= 0; j-- {
+				if seq := s.Keys[j].SeqNum(); seq >= historyHorizon && seq+1 > historySnapshots[len(historySnapshots)-1] {
+					historySnapshots = append(historySnapshots, seq+1)
+				}
+			}
+			snapshots = historySnapshots
+		}
 		elideInLastStripe := func(keys []keyspan.Key) []keyspan.Key {
 			// Unsets and deletes in the last snapshot stripe can be elided.
 			k := 0
@@ -241,8 +329,17 @@ func rangeKeyCompactionTransform(
 type compaction struct {
 	// cancel is a bool that can be used by other goroutines to signal a compaction
 	// to cancel, such as if a conflicting excise operation raced it to manifest
-	// application. Only holders of the manifest lock will write to this atomic.
+	// application. Only holders of the manifest lock will write to this atomic,
+	// with the exception of the preemption of low-priority compactions by
+	// flushes; see DB.preemptLowPriorityCompactionsLocked.
 	cancel atomic.Bool
+	// lowPriority is true if this compaction was scheduled through
+	// DB.CompactRange with CompactionPriorityLow. Low-priority compactions only
+	// run when the DB is otherwise idle and are cancelled as soon as a flush or
+	// another compaction needs to run.
+	lowPriority bool
+	// limiter, if non-nil, paces the writes of this compaction's outputs.
+	limiter *compactionRateLimiter
 
 	kind compactionKind
 	// isDownload is true if this compaction was started as part of a Download
@@ -263,6 +360,9 @@ type compaction struct {
 	// goroutine is still cleaning up (eg, deleting obsolete files).
 	versionEditApplied bool
 	bufferPool         sstable.BufferPool
+	// historyHorizon is the horizon of the history retained by the compaction,
+	// or zero if the DB doesn't retain history. See historyState.horizon.
+	historyHorizon uint64
 
 	// startLevel is the level that is being compacted. Inputs from startLevel
 	// and outputLevel will be merged to produce a set of outputLevel files.
@@ -440,17 +540,25 @@ func newCompaction(
 	c.kind = pc.kind
 
 	if c.kind == compactionKindDefault && c.outputLevel.files.Empty() && !c.hasExtraLevelData() &&
-		c.startLevel.files.Len() == 1 && c.grandparents.SizeSum() <= c.maxOverlapBytes {
+		c.startLevel.files.Len() == 1 && c.grandparents.SizeSum() <= c.maxOverlapBytes &&
+		levelsShareBlockSettings(opts, c.startLevel.level, c.outputLevel.level) {
 		// This compaction can be converted into a move or copy from one level
 		// to the next. We avoid such a move if there is lots of overlapping
 		// grandparent data. Otherwise, the move could create a parent file
-		// that will require a very expensive merge later on.
+		// that will require a very expensive merge later on. We also avoid it
+		// if the levels are configured with differing compression or block
+		// sizes, so that the file is rewritten with the output level's
+		// settings.
 		iter := c.startLevel.files.Iter()
 		meta := iter.First()
-		isRemote := false
+		isRemote, isShared := false, false
 		// We should always be passed a provider, except in some unit tests.
 		if provider != nil {
-			isRemote = !objstorage.MustIsLocalTable(provider, meta.FileBacking.DiskFileNum)
+			objMeta, err := provider.Lookup(base.FileTypeTable, meta.FileBacking.DiskFileNum)
+			if err != nil {
+				panic(err)
+			}
+			isRemote, isShared = objMeta.IsRemote(), objMeta.IsShared()
 		}
 		// Avoid a trivial move or copy if all of these are true, as rewriting a
 		// new file is better:
@@ -458,20 +566,41 @@ func newCompaction(
 		// 1) The source file is a virtual sstable
 		// 2) The existing file `meta` is on non-remote storage
 		// 3) The output level prefers shared storage
-		mustCopy := !isRemote && remote.ShouldCreateShared(opts.Experimental.CreateOnShared, c.outputLevel.level)
-		if mustCopy {
+		mustCopy := !isRemote && opts.createOnShared(c.outputLevel.level)
+		switch {
+		case isShared && !opts.createOnShared(c.outputLevel.level):
+			// The output level places its tables on local storage (see
+			// LevelOptions.Placement), so the file is rewritten locally.
+		case mustCopy:
 			// If the source is virtual, it's best to just rewrite the file as all
 			// conditions in the above comment are met.
 			if !meta.Virtual {
 				c.kind = compactionKindCopy
 			}
-		} else {
+		default:
 			c.kind = compactionKindMove
 		}
 	}
 	return c
 }
 
+// levelsShareBlockSettings returns true if the tables written to the two
+// levels use the same compression and block size, in which case a table may
+// be moved between the levels without being rewritten.
+func levelsShareBlockSettings(opts *Options, a, b int) bool {
+	la, lb := opts.Level(a), opts.Level(b)
+	if la.BlockSize != lb.BlockSize {
+		return false
+	}
+	compression := func(l LevelOptions) Compression {
+		if l.Compression == nil {
+			return resolveDefaultCompression(DefaultCompression)
+		}
+		return resolveDefaultCompression(l.Compression())
+	}
+	return compression(la) == compression(lb)
+}
+
 func newDeleteOnlyCompaction(
 	opts *Options, cur *version, inputs []compactionLevel, beganAt time.Time,
 ) *compaction {
@@ -1103,7 +1232,7 @@ func (c *compaction) newInputIter(
 	// keyspanimpl.MergingIter, and then interleave them among the points.
 	if len(rangeKeyIters) > 0 {
 		mi := &keyspanimpl.MergingIter{}
-		mi.Init(c.cmp, rangeKeyCompactionTransform(c.equal, snapshots, c.elideRangeKey), new(keyspanimpl.MergingBuffers), rangeKeyIters...)
+		mi.Init(c.cmp, rangeKeyCompactionTransform(c.equal, snapshots, c.historyHorizon, c.elideRangeKey), new(keyspanimpl.MergingBuffers), rangeKeyIters...)
 		di := &keyspan.DefragmentingIter{}
 		di.Init(c.comparer, mi, keyspan.DefragmentInternal, keyspan.StaticDefragmentReducer, new(keyspan.DefragmentingBuffers))
 		c.rangeKeyInterleaving.Init(c.comparer, iter, di, keyspan.InterleavingIterOpts{})
@@ -1166,6 +1295,15 @@ type manualCompaction struct {
 	start       []byte
 	end         []byte
 	split       bool
+	// ctx is the context of the DB.CompactRange call that scheduled this
+	// compaction, if any. A manual compaction whose context is done is dropped
+	// instead of being scheduled.
+	ctx context.Context
+	// lowPriority is true if the compaction was scheduled with
+	// CompactionPriorityLow. Such compactions are queued in
+	// d.mu.compact.lowPriorityManual rather than d.mu.compact.manual.
+	lowPriority bool
+	limiter     *compactionRateLimiter
 }
 
 type readCompaction struct {
@@ -1276,6 +1414,7 @@ func (d *DB) clearCompactingState(c *compaction, rollback bool) {
 func (d *DB) calculateDiskAvailableBytes() uint64 {
 	if space, err := d.opts.FS.GetDiskUsage(d.dirname); err == nil {
 		d.diskAvailBytes.Store(space.AvailBytes)
+		d.updateLowDiskSpace(space)
 		return space.AvailBytes
 	} else if !errors.Is(err, vfs.ErrUnsupported) {
 		d.opts.EventListener.BackgroundError(err)
@@ -1283,6 +1422,43 @@ func (d *DB) calculateDiskAvailableBytes() uint64 {
 	return d.diskAvailBytes.Load()
 }
 
+// updateLowDiskSpace updates whether the DB is low on disk space according to
+// Options.LowDiskSpaceThreshold, invoking the LowDiskSpace event when the
+// available disk space falls below the threshold.
+func (d *DB) updateLowDiskSpace(space vfs.DiskUsage) {
+	threshold := d.opts.LowDiskSpaceThreshold
+	if threshold == 0 {
+		return
+	}
+	if space.AvailBytes >= threshold {
+		d.lowDiskSpace.Store(false)
+		return
+	}
+	if d.lowDiskSpace.CompareAndSwap(false, true) {
+		d.opts.EventListener.LowDiskSpace(LowDiskSpaceInfo{
+			AvailBytes: space.AvailBytes,
+			TotalBytes: space.TotalBytes,
+			Threshold:  threshold,
+			ReadOnly:   d.opts.ReadOnlyOnLowDiskSpace,
+		})
+	}
+}
+
+// checkLowDiskSpace returns ErrLowDiskSpace if writes should be rejected
+// because available disk space is below Options.LowDiskSpaceThreshold.
+func (d *DB) checkLowDiskSpace() error {
+	if !d.opts.ReadOnlyOnLowDiskSpace || !d.lowDiskSpace.Load() {
+		return nil
+	}
+	// Disk space may have been reclaimed by means other than the DB's own file
+	// deletions, so refresh the statistic before rejecting the write.
+	d.calculateDiskAvailableBytes()
+	if d.lowDiskSpace.Load() {
+		return ErrLowDiskSpace
+	}
+	return nil
+}
+
 func (d *DB) getDeletionPacerInfo() deletionPacerInfo {
 	var pacerInfo deletionPacerInfo
 	// Call GetDiskUsage after every file deletion. This may seem inefficient,
@@ -1298,7 +1474,8 @@ func (d *DB) getDeletionPacerInfo() deletionPacerInfo {
 }
 
 // onObsoleteTableDelete is called to update metrics when an sstable is deleted.
-func (d *DB) onObsoleteTableDelete(fileSize uint64, isLocal bool) {
+func (d *DB) onObsoleteTableDelete(fileNum base.DiskFileNum, fileSize uint64, isLocal bool) {
+	d.quarantine.remove(fileNum)
 	d.mu.Lock()
 	d.mu.versions.metrics.Table.ObsoleteCount--
 	d.mu.versions.metrics.Table.ObsoleteSize -= fileSize
@@ -1324,6 +1501,7 @@ func (d *DB) maybeScheduleFlush() {
 	}
 
 	d.mu.compact.flushing = true
+	d.preemptLowPriorityCompactionsLocked()
 	go d.flush()
 }
 
@@ -1331,13 +1509,13 @@ func (d *DB) passedFlushThreshold() bool {
 	var n int
 	var size uint64
 	for ; n < len(d.mu.mem.queue)-1; n++ {
-		if !d.mu.mem.queue[n].readyForFlush() {
+		if !d.mu.mem.queue[n].readyForFlush() || d.retainedForPreparedLocked(d.mu.mem.queue[n]) {
 			break
 		}
 		if d.mu.mem.queue[n].flushForced {
 			// A flush was forced. Pretend the memtable size is the configured
 			// size. See minFlushSize below.
-			size += d.opts.MemTableSize
+			size += d.memTableTargetSize.Load()
 		} else {
 			size += d.mu.mem.queue[n].totalBytes()
 		}
@@ -1351,7 +1529,7 @@ func (d *DB) passedFlushThreshold() bool {
 	// configured memtable size. This prevents flushing of memtables at startup
 	// while we're undergoing the ramp period on the memtable size. See
 	// DB.newMemTable().
-	minFlushSize := d.opts.MemTableSize / 2
+	minFlushSize := d.memTableTargetSize.Load() / 2
 	return size >= minFlushSize
 }
 
@@ -1589,6 +1767,11 @@ func (d *DB) flush1() (bytesFlushed uint64, err error) {
 	var inputBytes uint64
 	var ingest bool
 	for ; n < len(d.mu.mem.queue)-1; n++ {
+		if d.retainedForPreparedLocked(d.mu.mem.queue[n]) {
+			// The flushable's WAL, or an earlier one, holds prepared batches
+			// that couldn't be rewritten to a later WAL.
+			break
+		}
 		if f, ok := d.mu.mem.queue[n].flushable.(*ingestedFlushable); ok {
 			if n == 0 {
 				// The first flushable is of type ingestedFlushable. Since these
@@ -1656,6 +1839,10 @@ func (d *DB) flush1() (bytesFlushed uint64, err error) {
 		Ingest:     ingest,
 	})
 	startTime := d.timeNow()
+	if t := d.opts.Tracer; t != nil {
+		_, span := t.StartSpan(context.Background(), TraceOpFlush)
+		defer func() { span.Finish(c.makeTraceInfo(err)) }()
+	}
 
 	var ve *manifest.VersionEdit
 	var pendingOutputs []compactionOutput
@@ -1785,8 +1972,11 @@ func (d *DB) flush1() (bytesFlushed uint64, err error) {
 	if err == nil {
 		d.mu.snapshots.cumulativePinnedCount += stats.cumulativePinnedKeys
 		d.mu.snapshots.cumulativePinnedSize += stats.cumulativePinnedSize
+		d.mu.history.cumulativePinnedCount += stats.cumulativeHistoryPinnedKeys
+		d.mu.history.cumulativePinnedSize += stats.cumulativeHistoryPinnedSize
 		d.mu.versions.metrics.Keys.MissizedTombstonesCount += stats.countMissizedDels
 		d.maybeUpdateDeleteCompactionHints(c)
+		d.iterTracker.compactionCompleted()
 	}
 
 	d.clearCompactingState(c, err != nil)
@@ -1994,8 +2184,13 @@ func (d *DB) maybeScheduleCompactionPicker(
 	}
 	maxCompactions := d.opts.MaxConcurrentCompactions()
 	maxDownloads := d.opts.MaxConcurrentDownloads()
+	// Low-priority compactions don't count against the compaction concurrency
+	// limit; they're preempted by any other compaction that gets scheduled.
+	compactingCount := func() int {
+		return d.mu.compact.compactingCount - d.mu.compact.lowPriorityCount
+	}
 
-	if d.mu.compact.compactingCount >= maxCompactions &&
+	if compactingCount() >= maxCompactions &&
 		(len(d.mu.compact.downloads) == 0 || d.mu.compact.downloadingCount >= maxDownloads) {
 		if len(d.mu.compact.manual) > 0 {
 			// Inability to run head blocks later manual compactions.
@@ -2021,9 +2216,15 @@ func (d *DB) maybeScheduleCompactionPicker(
 		diskAvailBytes:          d.diskAvailBytes.Load(),
 		earliestSnapshotSeqNum:  d.mu.snapshots.earliest(),
 		earliestUnflushedSeqNum: d.getEarliestUnflushedSeqNumLocked(),
+		now:                     d.timeNow(),
+	}
+	if h := d.mu.history.horizon; h != 0 && h < env.earliestSnapshotSeqNum {
+		// The keys newer than the history horizon are retained as if there were
+		// a snapshot at the horizon.
+		env.earliestSnapshotSeqNum = h
 	}
 
-	if d.mu.compact.compactingCount < maxCompactions {
+	if compactingCount() < maxCompactions {
 		// Check for delete-only compactions first, because they're expected to be
 		// cheap and reduce future compaction work.
 		if !d.opts.private.disableDeleteOnlyCompactions &&
@@ -2032,7 +2233,7 @@ func (d *DB) maybeScheduleCompactionPicker(
 			d.tryScheduleDeleteOnlyCompaction()
 		}
 
-		for len(d.mu.compact.manual) > 0 && d.mu.compact.compactingCount < maxCompactions {
+		for len(d.mu.compact.manual) > 0 && compactingCount() < maxCompactions {
 			if manual := d.mu.compact.manual[0]; !d.tryScheduleManualCompaction(env, manual) {
 				// Inability to run head blocks later manual compactions.
 				manual.retries++
@@ -2041,11 +2242,30 @@ func (d *DB) maybeScheduleCompactionPicker(
 			d.mu.compact.manual = d.mu.compact.manual[1:]
 		}
 
-		for !d.opts.DisableAutomaticCompactions && d.mu.compact.compactingCount < maxCompactions &&
+		for !d.opts.DisableAutomaticCompactions && compactingCount() < maxCompactions &&
 			d.tryScheduleAutoCompaction(env, pickFunc) {
 		}
 	}
 
+	// Drop any queued low-priority compactions whose callers have given up on
+	// them. These may otherwise wait a long time for the DB to become idle.
+	queue := d.mu.compact.lowPriorityManual[:0]
+	for _, manual := range d.mu.compact.lowPriorityManual {
+		if err := manual.ctx.Err(); err != nil {
+			manual.done <- err
+			continue
+		}
+		queue = append(queue, manual)
+	}
+	d.mu.compact.lowPriorityManual = queue
+
+	if compactingCount() > 0 || d.mu.compact.flushing {
+		// Other work is running; get low-priority compactions out of its way.
+		d.preemptLowPriorityCompactionsLocked()
+	} else if d.mu.compact.lowPriorityCount == 0 {
+		d.tryScheduleLowPriorityCompaction(env)
+	}
+
 	for len(d.mu.compact.downloads) > 0 && d.mu.compact.downloadingCount < maxDownloads &&
 		d.tryScheduleDownloadCompaction(env) {
 	}
@@ -2058,7 +2278,8 @@ func (d *DB) maybeScheduleCompactionPicker(
 func (d *DB) tryScheduleDeleteOnlyCompaction() {
 	v := d.mu.versions.currentVersion()
 	snapshots := d.mu.snapshots.toSlice()
-	inputs, unresolvedHints := checkDeleteCompactionHints(d.cmp, v, d.mu.compact.deletionHints, snapshots)
+	inputs, unresolvedHints := checkDeleteCompactionHints(d.cmp, v, d.mu.compact.deletionHints, snapshots,
+		d.mu.history.horizon)
 	d.mu.compact.deletionHints = unresolvedHints
 
 	if len(inputs) > 0 {
@@ -2075,6 +2296,12 @@ func (d *DB) tryScheduleDeleteOnlyCompaction() {
 //
 // Requires d.mu to be held.
 func (d *DB) tryScheduleManualCompaction(env compactionEnv, manual *manualCompaction) bool {
+	if manual.ctx != nil {
+		if err := manual.ctx.Err(); err != nil {
+			manual.done <- err
+			return true
+		}
+	}
 	v := d.mu.versions.currentVersion()
 	env.inProgressCompactions = d.getInProgressCompactionInfoLocked(nil)
 	pc, retryLater := pickManualCompaction(v, d.opts, env, d.mu.versions.picker.getBaseLevel(), manual)
@@ -2089,12 +2316,52 @@ func (d *DB) tryScheduleManualCompaction(env compactionEnv, manual *manualCompac
 	}
 
 	c := newCompaction(pc, d.opts, d.timeNow(), d.ObjProvider())
+	c.lowPriority = manual.lowPriority
+	c.limiter = manual.limiter
 	d.mu.compact.compactingCount++
+	if c.lowPriority {
+		d.mu.compact.lowPriorityCount++
+	}
 	d.addInProgressCompaction(c)
 	go d.compact(c, manual.done)
 	return true
 }
 
+// tryScheduleLowPriorityCompaction tries to kick off the next queued
+// low-priority manual compaction. Only one low-priority compaction runs at a
+// time, and only while no other flushes or compactions are running.
+//
+// Requires d.mu to be held.
+func (d *DB) tryScheduleLowPriorityCompaction(env compactionEnv) {
+	for len(d.mu.compact.lowPriorityManual) > 0 && d.mu.compact.lowPriorityCount == 0 {
+		if manual := d.mu.compact.lowPriorityManual[0]; !d.tryScheduleManualCompaction(env, manual) {
+			manual.retries++
+			return
+		}
+		d.mu.compact.lowPriorityManual = d.mu.compact.lowPriorityManual[1:]
+	}
+}
+
+// preemptLowPriorityCompactionsLocked cancels all running low-priority
+// compactions. The cancelled compactions return ErrCancelledCompaction to
+// DB.CompactRange, which requeues them to be retried once the DB is idle.
+//
+// Unlike other writers of compaction.cancel, this may be called without
+// holding the manifest lock (when a flush is starting). A preempted compaction
+// that has already passed its final cancellation check simply completes.
+//
+// Requires d.mu to be held.
+func (d *DB) preemptLowPriorityCompactionsLocked() {
+	if d.mu.compact.lowPriorityCount == 0 {
+		return
+	}
+	for c := range d.mu.compact.inProgress {
+		if c.lowPriority {
+			c.cancel.Store(true)
+		}
+	}
+}
+
 // tryScheduleAutoCompaction tries to kick off an automatic compaction.
 //
 // Returns false if no automatic compactions are necessary or able to run at
@@ -2213,7 +2480,9 @@ func (h deleteCompactionHint) String() string {
 	)
 }
 
-func (h *deleteCompactionHint) canDelete(cmp Compare, m *fileMetadata, snapshots []uint64) bool {
+func (h *deleteCompactionHint) canDelete(
+	cmp Compare, m *fileMetadata, snapshots []uint64, historyHorizon uint64,
+) bool {
 	// The file can only be deleted if all of its keys are older than the
 	// earliest tombstone aggregated into the hint.
 	if m.LargestSeqNum >= h.tombstoneSmallestSeqNum || m.SmallestSeqNum < h.fileSmallestSeqNum {
@@ -2225,8 +2494,8 @@ func (h *deleteCompactionHint) canDelete(cmp Compare, m *fileMetadata, snapshots
 	// but this file's oldest sequence number might be lower than the hint's
 	// smallest sequence number despite the file falling within the key range
 	// if this file was constructed after the hint by a compaction.
-	ti, _ := snapshotIndex(h.tombstoneLargestSeqNum, snapshots)
-	fi, _ := snapshotIndex(m.SmallestSeqNum, snapshots)
+	ti, _ := historySnapshotIndex(h.tombstoneLargestSeqNum, snapshots, historyHorizon)
+	fi, _ := historySnapshotIndex(m.SmallestSeqNum, snapshots, historyHorizon)
 	if ti != fi {
 		return false
 	}
@@ -2306,7 +2575,7 @@ func (d *DB) maybeUpdateDeleteCompactionHints(c *compaction) {
 }
 
 func checkDeleteCompactionHints(
-	cmp Compare, v *version, hints []deleteCompactionHint, snapshots []uint64,
+	cmp Compare, v *version, hints []deleteCompactionHint, snapshots []uint64, historyHorizon uint64,
 ) ([]compactionLevel, []deleteCompactionHint) {
 	var files map[*fileMetadata]bool
 	var byLevel [numLevels][]*fileMetadata
@@ -2353,8 +2622,8 @@ func checkDeleteCompactionHints(
 		// ______________________________________________________________
 		//     a b c d e f g h i j k l m n o p q r s t u v w x y z
 
-		ti, _ := snapshotIndex(h.tombstoneLargestSeqNum, snapshots)
-		fi, _ := snapshotIndex(h.fileSmallestSeqNum, snapshots)
+		ti, _ := historySnapshotIndex(h.tombstoneLargestSeqNum, snapshots, historyHorizon)
+		fi, _ := historySnapshotIndex(h.fileSmallestSeqNum, snapshots, historyHorizon)
 		if ti != fi {
 			// Cannot resolve yet.
 			unresolvedHints = append(unresolvedHints, h)
@@ -2367,7 +2636,7 @@ func checkDeleteCompactionHints(
 			overlaps := v.Overlaps(l, base.UserKeyBoundsEndExclusive(h.start, h.end))
 			iter := overlaps.Iter()
 			for m := iter.First(); m != nil; m = iter.Next() {
-				if m.IsCompacting() || !h.canDelete(cmp, m, snapshots) || files[m] {
+				if m.IsCompacting() || !h.canDelete(cmp, m, snapshots, historyHorizon) || files[m] {
 					continue
 				}
 				if files == nil {
@@ -2407,6 +2676,9 @@ func (d *DB) compact(c *compaction, errChannel chan error) {
 			d.mu.compact.downloadingCount--
 		} else {
 			d.mu.compact.compactingCount--
+			if c.lowPriority {
+				d.mu.compact.lowPriorityCount--
+			}
 		}
 		delete(d.mu.compact.inProgress, c)
 		// Add this compaction's duration to the cumulative duration. NB: This
@@ -2437,6 +2709,10 @@ func (d *DB) compact1(c *compaction, errChannel chan error) (err error) {
 	info := c.makeInfo(jobID)
 	d.opts.EventListener.CompactionBegin(info)
 	startTime := d.timeNow()
+	if t := d.opts.Tracer; t != nil {
+		_, span := t.StartSpan(context.Background(), TraceOpCompaction)
+		defer func() { span.Finish(c.makeTraceInfo(err)) }()
+	}
 
 	ve, pendingOutputs, stats, err := d.runCompaction(jobID, c)
 
@@ -2492,8 +2768,11 @@ func (d *DB) compact1(c *compaction, errChannel chan error) (err error) {
 		}
 		d.mu.snapshots.cumulativePinnedCount += stats.cumulativePinnedKeys
 		d.mu.snapshots.cumulativePinnedSize += stats.cumulativePinnedSize
+		d.mu.history.cumulativePinnedCount += stats.cumulativeHistoryPinnedKeys
+		d.mu.history.cumulativePinnedSize += stats.cumulativeHistoryPinnedSize
 		d.mu.versions.metrics.Keys.MissizedTombstonesCount += stats.countMissizedDels
 		d.maybeUpdateDeleteCompactionHints(c)
+		d.iterTracker.compactionCompleted()
 	}
 
 	// NB: clearing compacting state must occur before updating the read state;
@@ -2521,7 +2800,11 @@ func (d *DB) compact1(c *compaction, errChannel chan error) (err error) {
 type compactStats struct {
 	cumulativePinnedKeys uint64
 	cumulativePinnedSize uint64
-	countMissizedDels    uint64
+	// cumulativeHistoryPinnedKeys and cumulativeHistoryPinnedSize are the count
+	// and size of the snapshot-pinned keys newer than the history horizon.
+	cumulativeHistoryPinnedKeys uint64
+	cumulativeHistoryPinnedSize uint64
+	countMissizedDels           uint64
 }
 
 // runCopyCompaction runs a copy compaction where a new FileNum is created that
@@ -2545,7 +2828,7 @@ func (d *DB) runCopyCompaction(
 
 	ve = versionEdit
 	if !objMeta.IsExternal() {
-		if objMeta.IsRemote() || !remote.ShouldCreateShared(d.opts.Experimental.CreateOnShared, c.outputLevel.level) {
+		if objMeta.IsRemote() || !d.opts.createOnShared(c.outputLevel.level) {
 			panic("pebble: scheduled a copy compaction that is not actually moving files to shared storage")
 		}
 		// Note that based on logic in the compaction picker, we're guaranteed
@@ -2570,6 +2853,7 @@ func (d *DB) runCopyCompaction(
 		Virtual:         inputMeta.Virtual,
 		SyntheticPrefix: inputMeta.SyntheticPrefix,
 		SyntheticSuffix: inputMeta.SyntheticSuffix,
+		BlobFiles:       inputMeta.BlobFiles,
 	}
 	if inputMeta.HasPointKeys {
 		newMeta.ExtendPointKeyBounds(c.cmp, inputMeta.SmallestPointKey, inputMeta.LargestPointKey)
@@ -2624,7 +2908,7 @@ func (d *DB) runCopyCompaction(
 		w, outObjMeta, err := d.objProvider.Create(
 			ctx, fileTypeTable, base.PhysicalTableDiskFileNum(newMeta.FileNum),
 			objstorage.CreateOptions{
-				PreferSharedStorage: remote.ShouldCreateShared(d.opts.Experimental.CreateOnShared, c.outputLevel.level),
+				PreferSharedStorage: d.opts.createOnShared(c.outputLevel.level),
 			},
 		)
 		if err != nil {
@@ -2688,6 +2972,24 @@ type compactionOutput struct {
 	isLocal bool
 }
 
+// outputTableFormat returns the table format of the sstables written by flushes
+// and compactions at the format major version formatVers.
+func (d *DB) outputTableFormat(formatVers FormatMajorVersion) sstable.TableFormat {
+	// The table is typically written at the maximum allowable format implied by
+	// the current format major version of the DB.
+	tableFormat := formatVers.MaxTableFormat()
+
+	// In format major versions with maximum table formats of Pebblev3, value
+	// blocks were conditional on an experimental setting. In format major
+	// versions with maximum table formats of Pebblev4 and higher, value blocks
+	// are always enabled.
+	if tableFormat == sstable.TableFormatPebblev3 &&
+		(d.opts.Experimental.EnableValueBlocks == nil || !d.opts.Experimental.EnableValueBlocks()) {
+		tableFormat = sstable.TableFormatPebblev2
+	}
+	return tableFormat
+}
+
 // runCompactions runs a compaction that produces new on-disk tables from
 // memtables or old on-disk tables.
 //
@@ -2785,6 +3087,7 @@ func (d *DB) runCompaction(
 	}()
 
 	snapshots := d.mu.snapshots.toSlice()
+	c.historyHorizon = d.mu.history.horizon
 	formatVers := d.FormatMajorVersion()
 
 	if c.flushing == nil {
@@ -2803,6 +3106,20 @@ func (d *DB) runCompaction(
 		return ve, nil, stats, ErrCancelledCompaction
 	}
 
+	// Blob files are always created locally, so values are not separated from
+	// (nor referenced by) outputs created on shared storage.
+	var bw *compactionBlobWriter
+	if formatVers >= FormatBlobValues &&
+		!d.opts.createOnShared(c.outputLevel.level) {
+		bw = &compactionBlobWriter{
+			d:              d,
+			c:              c,
+			threshold:      max(d.opts.Experimental.BlobValueThreshold, 0),
+			gcCutoff:       d.mu.versions.blobFiles.gcCutoff(d.opts.Experimental.BlobGCAgeCutoff),
+			targetFileSize: c.maxOutputFileSize,
+		}
+	}
+
 	// Release the d.mu lock while doing I/O.
 	// Note the unusual order: Unlock and then Lock.
 	d.mu.Unlock()
@@ -2840,11 +3157,16 @@ func (d *DB) runCompaction(
 	}
 	c.allowedZeroSeqNum = c.allowZeroSeqNum()
 	iiter = invalidating.MaybeWrapIfInvariants(iiter)
-	iter := newCompactionIter(c.cmp, c.equal, c.formatKey, d.merge, iiter, snapshots,
-		&c.rangeDelFrag, &c.rangeKeyFrag, c.allowedZeroSeqNum, c.elideTombstone,
+	var blobs *blobFileCache
+	if bw != nil {
+		blobs = d.blobFiles
+	}
+	iter := newCompactionIter(c.cmp, c.equal, c.formatKey, d.merge, d.opts.Merger.CollapseChains, iiter, snapshots,
+		c.historyHorizon, &c.rangeDelFrag, &c.rangeKeyFrag, c.allowedZeroSeqNum, c.elideTombstone,
 		c.elideRangeTombstone, d.opts.Experimental.IneffectualSingleDeleteCallback,
 		d.opts.Experimental.SingleDeleteInvariantViolationCallback,
-		d.FormatMajorVersion())
+		makeExpiredFunc(d.opts.Experimental.ExpirationFunc, c.beganAt),
+		blobs, d.FormatMajorVersion())
 
 	var (
 		createdFiles    []base.DiskFileNum
@@ -2864,6 +3186,9 @@ func (d *DB) runCompaction(
 			for _, fileNum := range createdFiles {
 				_ = d.objProvider.Remove(fileTypeTable, fileNum)
 			}
+			if bw != nil {
+				bw.abort()
+			}
 		}
 		for _, closer := range c.closers {
 			retErr = firstError(retErr, closer.Close())
@@ -2897,20 +3222,7 @@ func (d *DB) runCompaction(
 		outputMetrics.MultiLevel.BytesRead = outputMetrics.BytesRead
 	}
 
-	// The table is typically written at the maximum allowable format implied by
-	// the current format major version of the DB.
-	tableFormat := formatVers.MaxTableFormat()
-
-	// In format major versions with maximum table formats of Pebblev3, value
-	// blocks were conditional on an experimental setting. In format major
-	// versions with maximum table formats of Pebblev4 and higher, value blocks
-	// are always enabled.
-	if tableFormat == sstable.TableFormatPebblev3 &&
-		(d.opts.Experimental.EnableValueBlocks == nil || !d.opts.Experimental.EnableValueBlocks()) {
-		tableFormat = sstable.TableFormatPebblev2
-	}
-
-	writerOpts := d.opts.MakeWriterOptions(c.outputLevel.level, tableFormat)
+	writerOpts := d.opts.MakeWriterOptions(c.outputLevel.level, d.outputTableFormat(formatVers))
 
 	// prevPointKey is a sstable.WriterOption that provides access to
 	// the last point key written to a writer's sstable. When a new
@@ -2951,7 +3263,7 @@ func (d *DB) runCompaction(
 		}
 		// Prefer shared storage if present.
 		createOpts := objstorage.CreateOptions{
-			PreferSharedStorage: remote.ShouldCreateShared(d.opts.Experimental.CreateOnShared, c.outputLevel.level),
+			PreferSharedStorage: d.opts.createOnShared(c.outputLevel.level),
 		}
 		diskFileNum := base.PhysicalTableDiskFileNum(fileNum)
 		writable, objMeta, err := d.objProvider.Create(ctx, fileTypeTable, diskFileNum, createOpts)
@@ -2980,8 +3292,11 @@ func (d *DB) runCompaction(
 				Writable: writable,
 				versions: d.mu.versions,
 				written:  &c.bytesWritten,
+				limiter:  c.limiter,
+				cancel:   &c.cancel,
 			}
 		}
+		writable = d.rateLimitWritable(c, writable)
 		createdFiles = append(createdFiles, diskFileNum)
 		cacheOpts := private.SSTableCacheOpts(d.cacheID, diskFileNum).(sstable.WriterOption)
 
@@ -3124,6 +3439,7 @@ func (d *DB) runCompaction(
 		meta.Size = writerMeta.Size
 		meta.SmallestSeqNum = writerMeta.SmallestSeqNum
 		meta.LargestSeqNum = writerMeta.LargestSeqNum
+		meta.BlobFiles = writerMeta.BlobFiles
 		meta.InitPhysicalBacking()
 
 		// If the file didn't contain any range deletions, we can fill its
@@ -3268,6 +3584,10 @@ func (d *DB) runCompaction(
 	// to a grandparent file largest key, or nil. Taken together, these
 	// progress guarantees ensure that eventually the input iterator will be
 	// exhausted and the range tombstone fragments will all be flushed.
+	//
+	// The bytes read from the input sstables, as tracked by c.bytesIterated,
+	// are submitted to Options.RateLimiter as the input iterator advances.
+	var bytesReadRateLimited uint64
 	for key, val := iter.First(); key != nil || !c.rangeDelFrag.Empty() || !c.rangeKeyFrag.Empty(); {
 		var firstKey []byte
 		if key != nil {
@@ -3297,6 +3617,12 @@ func (d *DB) runCompaction(
 			if split := splitter.ShouldSplitBefore(key, tw); split == compact.SplitNow {
 				break
 			}
+			if d.rateLimiter != nil && c.kind != compactionKindFlush {
+				if n := c.bytesIterated - bytesReadRateLimited; n >= compactionReadRateLimitBytes {
+					d.rateLimiter.wait(RateLimitCompactionRead, int(n))
+					bytesReadRateLimited += n
+				}
+			}
 
 			switch key.Kind() {
 			case InternalKeyKindRangeDelete:
@@ -3356,7 +3682,17 @@ func (d *DB) runCompaction(
 					return nil, pendingOutputs, stats, err
 				}
 			}
-			if err := tw.AddWithForceObsolete(*key, val, iter.forceObsoleteDueToRangeDel); err != nil {
+			valueLen := len(val)
+			switch {
+			case iter.valueBlob.valid:
+				valueLen = int(iter.valueBlob.handle.ValueLen)
+				err = bw.addRef(tw, *key, iter.valueBlob, iter.forceObsoleteDueToRangeDel)
+			case bw != nil:
+				err = bw.add(tw, *key, val, iter.forceObsoleteDueToRangeDel)
+			default:
+				err = tw.AddWithForceObsolete(*key, val, iter.forceObsoleteDueToRangeDel)
+			}
+			if err != nil {
 				return nil, pendingOutputs, stats, err
 			}
 			if iter.snapshotPinned {
@@ -3365,7 +3701,11 @@ func (d *DB) runCompaction(
 				// its elision. Increment the stats.
 				pinnedCount++
 				pinnedKeySize += uint64(len(key.UserKey)) + base.InternalTrailerLen
-				pinnedValueSize += uint64(len(val))
+				pinnedValueSize += uint64(valueLen)
+				if c.historyHorizon != 0 && key.SeqNum() >= c.historyHorizon {
+					stats.cumulativeHistoryPinnedKeys++
+					stats.cumulativeHistoryPinnedSize += uint64(len(key.UserKey)) + base.InternalTrailerLen + uint64(valueLen)
+				}
 			}
 		}
 
@@ -3396,6 +3736,9 @@ func (d *DB) runCompaction(
 			return nil, pendingOutputs, stats, err
 		}
 	}
+	if d.rateLimiter != nil && c.kind != compactionKindFlush {
+		d.rateLimiter.wait(RateLimitCompactionRead, int(c.bytesIterated-bytesReadRateLimited))
+	}
 
 	for _, cl := range c.inputs {
 		iter := cl.files.Iter()
@@ -3412,6 +3755,13 @@ func (d *DB) runCompaction(
 	// compactStats.
 	stats.countMissizedDels = iter.stats.countMissizedDels
 
+	if bw != nil {
+		if err := bw.finish(); err != nil {
+			return nil, pendingOutputs, stats, err
+		}
+		outputMetrics.Additional.BytesWrittenBlobFiles += bw.bytesWritten
+	}
+
 	if err := d.objProvider.Sync(); err != nil {
 		return nil, pendingOutputs, stats, err
 	}
@@ -3489,6 +3839,7 @@ func (d *DB) scanObsoleteFiles(list []string) {
 	manifestFileNum := d.mu.versions.manifestFileNum
 
 	var obsoleteTables []tableInfo
+	var obsoleteBlobFiles []fileInfo
 	var obsoleteManifests []fileInfo
 	var obsoleteOptions []fileInfo
 
@@ -3516,7 +3867,7 @@ func (d *DB) scanObsoleteFiles(list []string) {
 				fi.FileSize = uint64(stat.Size())
 			}
 			obsoleteOptions = append(obsoleteOptions, fi)
-		case fileTypeTable:
+		case fileTypeTable, fileTypeBlob:
 			// Objects are handled through the objstorage provider below.
 		default:
 			// Don't delete files we don't know about.
@@ -3540,6 +3891,17 @@ func (d *DB) scanObsoleteFiles(list []string) {
 				fileInfo: fileInfo,
 				isLocal:  !obj.IsRemote(),
 			})
+		case fileTypeBlob:
+			if d.mu.versions.blobFiles.isLive(obj.DiskFileNum) {
+				continue
+			}
+			fileInfo := fileInfo{
+				FileNum: obj.DiskFileNum,
+			}
+			if size, err := d.objProvider.Size(obj); err == nil {
+				fileInfo.FileSize = uint64(size)
+			}
+			obsoleteBlobFiles = append(obsoleteBlobFiles, fileInfo)
 
 		default:
 			// Ignore object types we don't know about.
@@ -3548,6 +3910,7 @@ func (d *DB) scanObsoleteFiles(list []string) {
 
 	d.mu.versions.obsoleteTables = mergeTableInfos(d.mu.versions.obsoleteTables, obsoleteTables)
 	d.mu.versions.updateObsoleteTableMetricsLocked()
+	d.mu.versions.obsoleteBlobFiles = merge(d.mu.versions.obsoleteBlobFiles, obsoleteBlobFiles)
 	d.mu.versions.obsoleteManifests = merge(d.mu.versions.obsoleteManifests, obsoleteManifests)
 	d.mu.versions.obsoleteOptions = merge(d.mu.versions.obsoleteOptions, obsoleteOptions)
 }
@@ -3629,12 +3992,16 @@ func (d *DB) deleteObsoleteFiles(jobID JobID) {
 	obsoleteOptions := d.mu.versions.obsoleteOptions
 	d.mu.versions.obsoleteOptions = nil
 
+	obsoleteBlobFiles := d.mu.versions.obsoleteBlobFiles
+	d.mu.versions.obsoleteBlobFiles = nil
+
 	// Release d.mu while preparing the cleanup job and possibly waiting.
 	// Note the unusual order: Unlock and then Lock.
 	d.mu.Unlock()
 	defer d.mu.Lock()
 
-	filesToDelete := make([]obsoleteFile, 0, len(obsoleteLogs)+len(obsoleteTables)+len(obsoleteManifests)+len(obsoleteOptions))
+	filesToDelete := make([]obsoleteFile, 0,
+		len(obsoleteLogs)+len(obsoleteTables)+len(obsoleteBlobFiles)+len(obsoleteManifests)+len(obsoleteOptions))
 	for _, f := range obsoleteLogs {
 		filesToDelete = append(filesToDelete, obsoleteFile{fileType: fileTypeLog, logFile: f})
 	}
@@ -3655,6 +4022,21 @@ func (d *DB) deleteObsoleteFiles(jobID JobID) {
 			},
 		})
 	}
+	slices.SortFunc(obsoleteBlobFiles, func(a, b fileInfo) int {
+		return cmp.Compare(a.FileNum, b.FileNum)
+	})
+	for _, f := range obsoleteBlobFiles {
+		d.blobFiles.evict(f.FileNum)
+		filesToDelete = append(filesToDelete, obsoleteFile{
+			fileType: fileTypeBlob,
+			nonLogFile: deletableFile{
+				dir:      d.dirname,
+				fileNum:  f.FileNum,
+				fileSize: f.FileSize,
+				isLocal:  true,
+			},
+		})
+	}
 	files := [2]struct {
 		fileType fileType
 		obsolete []fileInfo
@@ -3696,7 +4078,7 @@ func (d *DB) maybeScheduleObsoleteTableDeletion() {
 }
 
 func (d *DB) maybeScheduleObsoleteTableDeletionLocked() {
-	if len(d.mu.versions.obsoleteTables) > 0 {
+	if len(d.mu.versions.obsoleteTables) > 0 || len(d.mu.versions.obsoleteBlobFiles) > 0 {
 		d.deleteObsoleteFiles(d.newJobIDLocked())
 	}
 }
@@ -5,6 +5,7 @@
 package pebble
 
 import (
+	"context"
 	"encoding/binary"
 	"io"
 	"sort"
@@ -16,6 +17,7 @@ import (
 	"github.com/cockroachdb/pebble/internal/compact"
 	"github.com/cockroachdb/pebble/internal/keyspan"
 	"github.com/cockroachdb/pebble/internal/rangekey"
+	"github.com/cockroachdb/pebble/sstable"
 	"github.com/cockroachdb/redact"
 )
 
@@ -151,8 +153,10 @@ import (
 type compactionIter struct {
 	equal Equal
 	merge Merge
-	iter  internalIterator
-	err   error
+	// collapseMergeChains is Merger.CollapseChains.
+	collapseMergeChains bool
+	iter                internalIterator
+	err                 error
 	// `key.UserKey` is set to `keyBuf` caused by saving `i.iterKey.UserKey`
 	// and `key.Trailer` is set to `i.iterKey.Trailer`. This is the
 	// case on return from all public methods -- these methods return `key`.
@@ -221,6 +225,10 @@ type compactionIter struct {
 	// numbers define the snapshot stripes (see the Snapshots description
 	// above). The sequence numbers are in ascending order.
 	snapshots []uint64
+	// historyHorizon is the horizon of the retained history, or zero. Every
+	// sequence number >= historyHorizon is treated as a snapshot. See
+	// historySnapshotIndex.
+	historyHorizon uint64
 	// frontiers holds a heap of user keys that affect compaction behavior when
 	// they're exceeded. Before a new key is returned, the compaction iterator
 	// advances the frontier, notifying any code that subscribed to be notified
@@ -249,6 +257,21 @@ type compactionIter struct {
 	elideRangeTombstone                    func(start, end []byte) bool
 	ineffectualSingleDeleteCallback        func(userKey []byte)
 	singleDeleteInvariantViolationCallback func(userKey []byte)
+	// expired, if non-nil, reports whether a SET's key and value have expired
+	// (see Options.Experimental.ExpirationFunc).
+	expired func(key, value []byte) bool
+	// blobs, if non-nil, allows the values of SETs that are stored in blob
+	// files to be returned by reference rather than fetched, so that the
+	// compaction may write the reference to its output without rewriting the
+	// value (see iterBlob and valueBlob). The values are fetched through blobs
+	// when they're needed, e.g. to merge them.
+	blobs *blobFileCache
+	// iterBlob references the value of iterKey if it's stored in a blob file
+	// and hasn't been fetched, in which case iterValue is nil.
+	iterBlob blobRef
+	// valueBlob references the returned value if it's stored in a blob file, in
+	// which case value is empty. Only SETs are returned by reference.
+	valueBlob blobRef
 	// The on-disk format major version. This informs the types of keys that
 	// may be written to disk during a compaction.
 	formatVersion FormatMajorVersion
@@ -263,8 +286,10 @@ func newCompactionIter(
 	equal Equal,
 	formatKey base.FormatKey,
 	merge Merge,
+	collapseMergeChains bool,
 	iter internalIterator,
 	snapshots []uint64,
+	historyHorizon uint64,
 	rangeDelFrag *keyspan.Fragmenter,
 	rangeKeyFrag *keyspan.Fragmenter,
 	allowZeroSeqNum bool,
@@ -272,13 +297,17 @@ func newCompactionIter(
 	elideRangeTombstone func(start, end []byte) bool,
 	ineffectualSingleDeleteCallback func(userKey []byte),
 	singleDeleteInvariantViolationCallback func(userKey []byte),
+	expired func(key, value []byte) bool,
+	blobs *blobFileCache,
 	formatVersion FormatMajorVersion,
 ) *compactionIter {
 	i := &compactionIter{
 		equal:                                  equal,
 		merge:                                  merge,
+		collapseMergeChains:                    collapseMergeChains,
 		iter:                                   iter,
 		snapshots:                              snapshots,
+		historyHorizon:                         historyHorizon,
 		rangeDelFrag:                           rangeDelFrag,
 		rangeKeyFrag:                           rangeKeyFrag,
 		allowZeroSeqNum:                        allowZeroSeqNum,
@@ -286,6 +315,8 @@ func newCompactionIter(
 		elideRangeTombstone:                    elideRangeTombstone,
 		ineffectualSingleDeleteCallback:        ineffectualSingleDeleteCallback,
 		singleDeleteInvariantViolationCallback: singleDeleteInvariantViolationCallback,
+		expired:                                expired,
+		blobs:                                  blobs,
 		formatVersion:                          formatVersion,
 	}
 	i.frontiers.Init(cmp)
@@ -304,12 +335,11 @@ func (i *compactionIter) First() (*InternalKey, []byte) {
 	}
 	var iterValue LazyValue
 	i.iterKey, iterValue = i.iter.First()
-	i.iterValue, _, i.err = iterValue.Value(nil)
-	if i.err != nil {
+	if !i.loadIterValue(iterValue) {
 		return nil, nil
 	}
 	if i.iterKey != nil {
-		i.curSnapshotIdx, i.curSnapshotSeqNum = snapshotIndex(i.iterKey.SeqNum(), i.snapshots)
+		i.curSnapshotIdx, i.curSnapshotSeqNum = i.snapshotIndex(i.iterKey.SeqNum())
 	}
 	i.pos = iterPosNext
 	i.iterStripeChange = newStripeNewKey
@@ -347,6 +377,7 @@ func (i *compactionIter) Next() (*InternalKey, []byte) {
 
 	i.pos = iterPosCurForward
 	i.valid = false
+	i.valueBlob = blobRef{}
 
 	for i.iterKey != nil {
 		// If we entered a new snapshot stripe with the same key, any key we
@@ -480,6 +511,33 @@ func (i *compactionIter) Next() (*InternalKey, []byte) {
 			}
 
 		case InternalKeyKindSet, InternalKeyKindSetWithDelete:
+			// Only the keys in the newest stripe, which are not visible to any
+			// snapshot or retained history, may expire. Determining whether the
+			// key has expired requires its value.
+			expirable := i.expired != nil && i.curSnapshotSeqNum == InternalKeySeqNumMax
+			if expirable && !i.fetchIterValue() {
+				i.valid = false
+				return nil, nil
+			}
+			if expirable && i.expired(i.iterKey.UserKey, i.iterValue) {
+				// The key has expired. It shadows the remaining keys in the stripe,
+				// which may be skipped.
+				i.saveKey()
+				if i.curSnapshotIdx == 0 && i.elideTombstone(i.iterKey.UserKey) {
+					// There are no snapshots, and no older versions of the key exist
+					// beneath the compaction, so the key can be dropped entirely.
+					i.skipInStripe()
+					continue
+				}
+				// Older versions of the key may exist in older stripes or lower
+				// levels. Replace the key with a tombstone so that they remain
+				// shadowed.
+				i.key.SetKind(InternalKeyKindDelete)
+				i.value = nil
+				i.valid = true
+				i.skip = true
+				return &i.key, i.value
+			}
 			// The key we emit for this entry is a function of the current key
 			// kind, and whether this entry is followed by a DEL/SINGLEDEL
 			// entry. setNext() does the work to move the iterator forward,
@@ -509,6 +567,14 @@ func (i *compactionIter) Next() (*InternalKey, []byte) {
 				case InternalKeyKindSet, InternalKeyKindSetWithDelete:
 					includesBase = true
 				case InternalKeyKindMerge:
+					// The merge chain ended without reaching an older value. If
+					// it's in the last snapshot stripe and no older keys exist
+					// beneath the compaction, the oldest merge operand was part
+					// of the merge, and the chain may be collapsed into a SET.
+					if i.collapseMergeChains && origSnapshotIdx == 0 && i.elideTombstone(i.key.UserKey) {
+						i.key.SetKind(InternalKeyKindSet)
+						includesBase = true
+					}
 				default:
 					panic(errors.AssertionFailedf(
 						"unexpected kind %s", redact.SafeString(i.key.Kind().String())))
@@ -570,6 +636,12 @@ func snapshotIndex(seq uint64, snapshots []uint64) (int, uint64) {
 	return index, snapshots[index]
 }
 
+// snapshotIndex returns the index and sequence number of the snapshot stripe
+// of seq, accounting for the retained history.
+func (i *compactionIter) snapshotIndex(seq uint64) (int, uint64) {
+	return historySnapshotIndex(seq, i.snapshots, i.historyHorizon)
+}
+
 // skipInStripe skips over skippable keys in the same stripe and user key. It
 // may set i.err, in which case i.iterKey will be nil.
 func (i *compactionIter) skipInStripe() {
@@ -588,13 +660,54 @@ func (i *compactionIter) skipInStripe() {
 func (i *compactionIter) iterNext() bool {
 	var iterValue LazyValue
 	i.iterKey, iterValue = i.iter.Next()
-	i.iterValue, _, i.err = iterValue.Value(nil)
-	if i.err != nil {
+	if !i.loadIterValue(iterValue) {
 		i.iterKey = nil
 	}
 	return i.iterKey != nil
 }
 
+// loadIterValue sets iterValue, or iterBlob if the value of iterKey is stored
+// in a blob file and may be returned by reference. It returns false if an
+// error was encountered, in which case i.err is set.
+func (i *compactionIter) loadIterValue(lv LazyValue) bool {
+	i.iterBlob = blobRef{}
+	if i.blobs != nil && i.iterKey != nil && i.iterKey.Kind() == InternalKeyKindSet {
+		h, attribute, ok, err := sstable.BlobHandle(lv)
+		if err != nil {
+			i.iterValue, i.err = nil, err
+			return false
+		}
+		if ok {
+			i.iterValue = nil
+			i.iterBlob = blobRef{handle: h, attribute: attribute, valid: true}
+			return true
+		}
+	}
+	i.iterValue, _, i.err = lv.Value(nil)
+	return i.err == nil
+}
+
+// fetchIterValue fetches the value of iterKey if it's stored in a blob file
+// and hasn't been fetched. It returns false if an error was encountered, in
+// which case i.err is set.
+func (i *compactionIter) fetchIterValue() bool {
+	if !i.iterBlob.valid {
+		return true
+	}
+	i.iterValue, i.err = i.blobs.readValue(context.TODO(), i.iterBlob.handle, nil)
+	i.iterBlob = blobRef{}
+	return i.err == nil
+}
+
+// iterValueLen returns the length of the value of iterKey, without fetching it
+// if it's stored in a blob file.
+func (i *compactionIter) iterValueLen() int {
+	if i.iterBlob.valid {
+		return int(i.iterBlob.handle.ValueLen)
+	}
+	return len(i.iterValue)
+}
+
 // stripeChangeType indicates how the snapshot stripe changed relative to the
 // previous key. If the snapshot stripe changed, it also indicates whether the
 // new stripe was entered because the iterator progressed onto an entirely new
@@ -646,7 +759,7 @@ func (i *compactionIter) nextInStripeHelper() stripeChangeType {
 		//    of these keys, we consider the new key a `newStripeNewKey` to
 		//    reflect that it's the beginning of a new stream of point keys.
 		if i.key.IsExclusiveSentinel() || !i.equal(i.key.UserKey, key.UserKey) {
-			i.curSnapshotIdx, i.curSnapshotSeqNum = snapshotIndex(key.SeqNum(), i.snapshots)
+			i.curSnapshotIdx, i.curSnapshotSeqNum = i.snapshotIndex(key.SeqNum())
 			return newStripeNewKey
 		}
 
@@ -667,7 +780,7 @@ func (i *compactionIter) nextInStripeHelper() stripeChangeType {
 			panic(errors.AssertionFailedf("pebble: invariant violation: %s and %s out of order", prevKey, key))
 		}
 
-		i.curSnapshotIdx, i.curSnapshotSeqNum = snapshotIndex(key.SeqNum(), i.snapshots)
+		i.curSnapshotIdx, i.curSnapshotSeqNum = i.snapshotIndex(key.SeqNum())
 		switch key.Kind() {
 		case InternalKeyKindRangeKeySet, InternalKeyKindRangeKeyUnset, InternalKeyKindRangeKeyDelete,
 			InternalKeyKindRangeDelete:
@@ -701,6 +814,7 @@ func (i *compactionIter) setNext() {
 	// Save the current key.
 	i.saveKey()
 	i.value = i.iterValue
+	i.valueBlob = i.iterBlob
 	i.valid = true
 	i.maybeZeroSeqnum(i.curSnapshotIdx)
 
@@ -734,6 +848,16 @@ func (i *compactionIter) setNext() {
 			case InternalKeyKindDelete, InternalKeyKindSingleDelete, InternalKeyKindDeleteSized:
 				i.key.SetKind(InternalKeyKindSetWithDelete)
 				i.skip = true
+				if i.valueBlob.valid {
+					// Only SETs are returned by reference, so the value must be
+					// fetched.
+					i.valueBuf, i.err = i.blobs.readValue(context.TODO(), i.valueBlob.handle, i.valueBuf[:0])
+					i.value = i.valueBuf
+					i.valueBlob = blobRef{}
+					if i.err != nil {
+						i.valid = false
+					}
+				}
 				return
 			case InternalKeyKindSet, InternalKeyKindMerge, InternalKeyKindSetWithDelete:
 				// Do nothing
@@ -798,6 +922,10 @@ func (i *compactionIter) mergeNext(valueMerger ValueMerger) {
 			// value and return. We change the kind of the resulting key to a
 			// Set so that it shadows keys in lower levels. That is:
 			// MERGE + (SET*) -> SET.
+			if !i.fetchIterValue() {
+				i.valid = false
+				return
+			}
 			i.err = valueMerger.MergeOlder(i.iterValue)
 			if i.err != nil {
 				i.valid = false
@@ -1143,7 +1271,7 @@ func (i *compactionIter) deleteSizedNext() (*base.InternalKey, []byte) {
 				i.valid = false
 				return nil, nil
 			}
-			elidedSize := uint64(len(i.iterKey.UserKey)) + uint64(len(i.iterValue))
+			elidedSize := uint64(len(i.iterKey.UserKey)) + uint64(i.iterValueLen())
 			if elidedSize != expectedSize {
 				// The original DELSIZED key was missized. It's unclear what to
 				// do. The user-provided size was wrong, so it's unlikely to be
@@ -1277,7 +1405,7 @@ func (i *compactionIter) emitRangeDelChunk(fragmented keyspan.Span) {
 	currentIdx := -1
 	keys := fragmented.Keys[:0]
 	for _, k := range fragmented.Keys {
-		idx, _ := snapshotIndex(k.SeqNum(), i.snapshots)
+		idx, _ := i.snapshotIndex(k.SeqNum())
 		if currentIdx == idx {
 			continue
 		}
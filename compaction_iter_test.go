@@ -78,13 +78,16 @@ func (m *debugMerger) Finish(includesBase bool) ([]byte, io.Closer, error) {
 
 func TestCompactionIter(t *testing.T) {
 	var merge Merge
+	var collapseMergeChains bool
 	var keys []InternalKey
 	var rangeKeys []keyspan.Span
 	var rangeDels []keyspan.Span
 	var vals [][]byte
 	var snapshots []uint64
+	var historyHorizon uint64
 	var elideTombstones bool
 	var allowZeroSeqnum bool
+	var expired func(key, value []byte) bool
 	var rangeKeyInterleaving *keyspan.InterleavingIter
 	var rangeDelInterleaving *keyspan.InterleavingIter
 
@@ -135,8 +138,10 @@ func TestCompactionIter(t *testing.T) {
 			DefaultComparer.Equal,
 			DefaultComparer.FormatKey,
 			merge,
+			collapseMergeChains,
 			iter,
 			snapshots,
+			historyHorizon,
 			&keyspan.Fragmenter{},
 			&keyspan.Fragmenter{},
 			allowZeroSeqnum,
@@ -152,6 +157,8 @@ func TestCompactionIter(t *testing.T) {
 			func(userKey []byte) {
 				invariantViolationSingleDeleteKeys = append(invariantViolationSingleDeleteKeys, string(userKey))
 			},
+			expired,
+			nil, /* blobs */
 			formatVersion,
 		)
 	}
@@ -165,6 +172,7 @@ func TestCompactionIter(t *testing.T) {
 					len(d.CmdArgs[0].Vals) > 0 && d.CmdArgs[0].Vals[0] == "deletable" {
 					merge = newDeletableSumValueMerger
 				}
+				collapseMergeChains = d.HasArg("collapse-merge-chains")
 				keys = keys[:0]
 				vals = vals[:0]
 				rangeKeys = rangeKeys[:0]
@@ -215,8 +223,10 @@ func TestCompactionIter(t *testing.T) {
 
 			case "iter":
 				snapshots = snapshots[:0]
+				historyHorizon = 0
 				elideTombstones = false
 				allowZeroSeqnum = false
+				expired = nil
 				printSnapshotPinned := false
 				printMissizedDels := false
 				printForceObsolete := false
@@ -230,6 +240,12 @@ func TestCompactionIter(t *testing.T) {
 							}
 							snapshots = append(snapshots, uint64(seqNum))
 						}
+					case "history-horizon":
+						var err error
+						historyHorizon, err = strconv.ParseUint(arg.Vals[0], 10, 64)
+						if err != nil {
+							return err.Error()
+						}
 					case "elide-tombstones":
 						var err error
 						elideTombstones, err = strconv.ParseBool(arg.Vals[0])
@@ -242,6 +258,11 @@ func TestCompactionIter(t *testing.T) {
 						if err != nil {
 							return err.Error()
 						}
+					case "expired-values":
+						expiredValues := arg.Vals
+						expired = func(_, value []byte) bool {
+							return slices.Contains(expiredValues, string(value))
+						}
 					case "print-snapshot-pinned":
 						printSnapshotPinned = true
 					case "print-missized-dels":
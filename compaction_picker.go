@@ -10,6 +10,7 @@ import (
 	"math"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
@@ -37,6 +38,9 @@ type compactionEnv struct {
 	earliestSnapshotSeqNum  uint64
 	inProgressCompactions   []compactionInfo
 	readCompactionEnv       readCompactionEnv
+	// now is the current time, used to determine which tables' keys have
+	// expired. Expiry compactions are not picked if it is zero.
+	now time.Time
 }
 
 type compactionPicker interface {
@@ -592,6 +596,9 @@ func newCompactionPickerByScore(
 		virtualBackings: virtualBackings,
 	}
 	p.initLevelMaxBytes(inProgressCompactions)
+	if factory := opts.Experimental.CompactionPickerFactory; factory != nil {
+		p.custom = factory(&CompactionPickerVersion{vers: v, baseLevel: p.baseLevel})
+	}
 	return p
 }
 
@@ -698,6 +705,9 @@ type compactionPickerByScore struct {
 	// levelMaxBytes holds the dynamically adjusted max bytes setting for each
 	// level.
 	levelMaxBytes [numLevels]int64
+	// custom is the CompactionPicker constructed through
+	// Options.Experimental.CompactionPickerFactory, if any.
+	custom CompactionPicker
 }
 
 var _ compactionPicker = &compactionPickerByScore{}
@@ -1216,6 +1226,13 @@ func (p *compactionPickerByScore) pickAuto(env compactionEnv) (pc *pickedCompact
 
 	scores := p.calculateLevelScores(env.inProgressCompactions)
 
+	// Check for a compaction proposed by a custom picker.
+	if p.custom != nil {
+		if pc := p.pickCustomCompaction(env, scores); pc != nil {
+			return pc
+		}
+	}
+
 	// TODO(bananabrick): Either remove, or change this into an event sent to the
 	// EventListener.
 	logCompaction := func(pc *pickedCompaction) {
@@ -1317,6 +1334,20 @@ func (p *compactionPickerByScore) pickAuto(env compactionEnv) (pc *pickedCompact
 		}
 	}
 
+	// Check for files dominated by tombstones. Compacting them early reclaims
+	// the space of the keys they delete, and avoids iterating over the
+	// tombstones in scans.
+	if pc := p.pickTombstoneDensityCompaction(env); pc != nil {
+		return pc
+	}
+
+	// Check for files whose keys have all expired. Like elision-only
+	// compactions, these reclaim disk space without helping us keep up with
+	// writes, but they may reclaim entire tables.
+	if pc := p.pickExpiryCompaction(env); pc != nil {
+		return pc
+	}
+
 	// Check for L6 files with tombstones that may be elided. These files may
 	// exist if a snapshot prevented the elision of a tombstone or because of
 	// a move compaction. These are low-priority compactions because they
@@ -1488,6 +1519,108 @@ func (a markedForCompactionAnnotator) Merge(v interface{}, accum interface{}) in
 	return accum
 }
 
+// expiryAnnotator implements the manifest.Annotator interface, annotating
+// B-Tree nodes with the *fileMetadata of the file with the earliest MaxExpiry
+// within the subtree, considering only files containing keys with an expiry.
+type expiryAnnotator struct{}
+
+var _ manifest.Annotator = expiryAnnotator{}
+
+func (a expiryAnnotator) Zero(interface{}) interface{} {
+	return nil
+}
+
+func (a expiryAnnotator) Accumulate(f *fileMetadata, dst interface{}) (interface{}, bool) {
+	if f.IsCompacting() {
+		return dst, true
+	}
+	if !f.StatsValid() {
+		return dst, false
+	}
+	if f.Stats.MaxExpiry == 0 {
+		return dst, true
+	}
+	return expiryMergeHelper(f, dst), true
+}
+
+func (a expiryAnnotator) Merge(v interface{}, accum interface{}) interface{} {
+	if v == nil {
+		return accum
+	}
+	return expiryMergeHelper(v.(*fileMetadata), accum)
+}
+
+// tombstoneDensity returns the tombstone density of a table with the given
+// stats: the larger of the fraction of its entries that are point tombstones,
+// and of the estimated size of the data dropped by its range tombstones
+// relative to its size.
+func tombstoneDensity(stats *manifest.TableStats, size uint64) float64 {
+	var pointDensity, rangeDensity float64
+	if stats.NumEntries > 0 {
+		pointDensity = float64(stats.NumDeletions-stats.NumRangeDeletions) / float64(stats.NumEntries)
+	}
+	if size > 0 {
+		rangeDensity = float64(stats.RangeDeletionsBytesEstimate) / float64(size)
+	}
+	return max(pointDensity, rangeDensity)
+}
+
+// tombstoneDensityAnnotator implements the manifest.Annotator interface,
+// annotating B-Tree nodes with the *fileMetadata of the file with the highest
+// tombstone density within the subtree, considering only files whose density
+// is at least the threshold.
+type tombstoneDensityAnnotator struct {
+	threshold float64
+}
+
+var _ manifest.Annotator = tombstoneDensityAnnotator{}
+
+func (a tombstoneDensityAnnotator) Zero(interface{}) interface{} {
+	return nil
+}
+
+func (a tombstoneDensityAnnotator) Accumulate(
+	f *fileMetadata, dst interface{},
+) (interface{}, bool) {
+	if f.IsCompacting() {
+		return dst, true
+	}
+	if !f.StatsValid() {
+		return dst, false
+	}
+	if tombstoneDensity(&f.Stats, f.Size) < a.threshold {
+		return dst, true
+	}
+	return tombstoneDensityMergeHelper(f, dst), true
+}
+
+func (a tombstoneDensityAnnotator) Merge(v interface{}, accum interface{}) interface{} {
+	if v == nil {
+		return accum
+	}
+	return tombstoneDensityMergeHelper(v.(*fileMetadata), accum)
+}
+
+// REQUIRES: f is non-nil.
+func tombstoneDensityMergeHelper(f *fileMetadata, dst interface{}) interface{} {
+	if dst == nil {
+		return f
+	} else if dstV := dst.(*fileMetadata); tombstoneDensity(&dstV.Stats, dstV.Size) < tombstoneDensity(&f.Stats, f.Size) {
+		return f
+	}
+	return dst
+}
+
+// REQUIRES: f is non-nil, and f.Stats.MaxExpiry > 0.
+func expiryMergeHelper(f *fileMetadata, dst interface{}) interface{} {
+	if dst == nil {
+		return f
+	} else if dstV := dst.(*fileMetadata); dstV.Stats.MaxExpiry > f.Stats.MaxExpiry {
+		return f
+	}
+	return dst
+}
+
 // REQUIRES: f is non-nil, and f.MarkedForCompaction=true.
 func markedMergeHelper(f *fileMetadata, dst interface{}) (interface{}, bool) {
 	if dst == nil {
@@ -1535,6 +1668,120 @@ func (p *compactionPickerByScore) pickElisionOnlyCompaction(
 	return nil
 }
 
+// pickExpiryCompaction looks for a table all of whose keys have expired (see
+// Options.Experimental.ExpirationFunc), and constructs a compaction that
+// rewrites it in place, dropping the expired keys.
+func (p *compactionPickerByScore) pickExpiryCompaction(env compactionEnv) (pc *pickedCompaction) {
+	// Only the keys that are not visible to any snapshot or retained history
+	// may expire, so compacting a table while there are snapshots may not
+	// make progress.
+	if p.opts.Experimental.ExpirationFunc == nil || env.now.IsZero() ||
+		env.earliestSnapshotSeqNum != math.MaxUint64 {
+		return nil
+	}
+	now := expiryNanos(env.now)
+	for l := numLevels - 1; l >= 0; l-- {
+		v := p.vers.Levels[l].Annotation(expiryAnnotator{})
+		if v == nil {
+			continue
+		}
+		candidate := v.(*fileMetadata)
+		if candidate.IsCompacting() || candidate.Stats.MaxExpiry > now {
+			continue
+		}
+		lf := p.vers.Levels[l].Find(p.opts.Comparer.Compare, candidate)
+		if lf == nil {
+			panic(fmt.Sprintf("file %s not found in level %d as expected", candidate.FileNum, l))
+		}
+		inputs := lf.Slice()
+		if anyTablesCompacting(inputs) {
+			continue
+		}
+
+		pc = newPickedCompaction(p.opts, p.vers, l, l, p.baseLevel)
+		pc.outputLevel.level = l
+		pc.kind = compactionKindExpiry
+		pc.startLevel.files = inputs
+		pc.smallest, pc.largest = manifest.KeyRange(pc.cmp, pc.startLevel.files.Iter())
+
+		// Fail-safe to protect against compacting the same sstable concurrently.
+		if !inputRangeAlreadyCompacting(env, pc) {
+			if pc.startLevel.level == 0 {
+				pc.startLevel.l0SublevelInfo = generateSublevelInfo(pc.cmp, pc.startLevel.files)
+			}
+			return pc
+		}
+	}
+	return nil
+}
+
+// pickTombstoneDensityCompaction looks for a table whose tombstone density is
+// at least Options.Experimental.TombstoneDenseCompactionThreshold, and
+// constructs a compaction of it into the next level, or a compaction that
+// rewrites it in place if it's in the bottommost level. The levels are
+// considered from the top, as the tombstones of the higher levels delete the
+// keys of the lower levels.
+func (p *compactionPickerByScore) pickTombstoneDensityCompaction(
+	env compactionEnv,
+) (pc *pickedCompaction) {
+	threshold := p.opts.Experimental.TombstoneDenseCompactionThreshold
+	if threshold <= 0 {
+		return nil
+	}
+	a := tombstoneDensityAnnotator{threshold: threshold}
+	for l := max(1, p.baseLevel); l < numLevels; l++ {
+		v := p.vers.Levels[l].Annotation(a)
+		if v == nil {
+			continue
+		}
+		candidate := v.(*fileMetadata)
+		if candidate.IsCompacting() {
+			continue
+		}
+		lf := p.vers.Levels[l].Find(p.opts.Comparer.Compare, candidate)
+		if lf == nil {
+			panic(fmt.Sprintf("file %s not found in level %d as expected", candidate.FileNum, l))
+		}
+		if l < numLevels-1 {
+			cInfo := candidateLevelInfo{
+				level:       l,
+				outputLevel: defaultOutputLevel(l, p.baseLevel),
+				file:        *lf,
+			}
+			pc = pickAutoLPositive(env, p.opts, p.vers, cInfo, p.baseLevel, p.levelMaxBytes)
+			if pc == nil {
+				continue
+			}
+			pc.kind = compactionKindTombstoneDensity
+			// Fail-safe to protect against compacting the same sstable
+			// concurrently.
+			if !inputRangeAlreadyCompacting(env, pc) {
+				return pc
+			}
+			continue
+		}
+
+		// The tombstones of a table in the bottommost level are only dropped by
+		// rewriting it if they aren't visible to any open snapshot.
+		if candidate.LargestSeqNum >= env.earliestSnapshotSeqNum {
+			continue
+		}
+		inputs := lf.Slice()
+		if anyTablesCompacting(inputs) {
+			continue
+		}
+		pc = newPickedCompaction(p.opts, p.vers, l, l, p.baseLevel)
+		pc.kind = compactionKindTombstoneDensity
+		pc.startLevel.files = inputs
+		pc.smallest, pc.largest = manifest.KeyRange(pc.cmp, pc.startLevel.files.Iter())
+		// Fail-safe to protect against compacting the same sstable concurrently.
+		if !inputRangeAlreadyCompacting(env, pc) {
+			return pc
+		}
+	}
+	return nil
+}
+
 // pickRewriteCompaction attempts to construct a compaction that
 // rewrites a file marked for compaction. pickRewriteCompaction will
 // pull in adjacent files in the file's atomic compaction unit if
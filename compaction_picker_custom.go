@@ -0,0 +1,181 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"time"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/manifest"
+)
+
+// CompactionPickerFactory constructs the CompactionPicker of a version of the
+// LSM. It's invoked whenever a new version is installed, and the returned
+// picker is consulted until the next version is installed. See
+// Options.Experimental.CompactionPickerFactory.
+type CompactionPickerFactory func(v *CompactionPickerVersion) CompactionPicker
+
+// CompactionPicker picks automatic compactions according to a custom policy.
+//
+// Whenever an automatic compaction may be scheduled, Pebble first asks the
+// CompactionPicker of the current version for a compaction. If it doesn't
+// propose one, or the proposal can't be scheduled (e.g. because its tables
+// are already compacting), Pebble falls back to its built-in heuristics.
+// Either way, the concurrency of automatic compactions remains limited by
+// Options.MaxConcurrentCompactions and the compaction concurrency
+// heuristics.
+type CompactionPicker interface {
+	// PickCompaction returns the compaction to schedule, and whether there is
+	// one. It's invoked with the DB mutex held, and must neither block nor
+	// call into the DB. Compactions are picked for as long as one is
+	// proposed, so a picker must stop proposing a compaction once it's no
+	// longer beneficial (e.g. rewriting a table of the bottommost level in
+	// place).
+	PickCompaction(env CompactionPickerEnv) (CompactionProposal, bool)
+}
+
+// CompactionPickerEnv holds the state of the DB, beyond the LSM, relevant to
+// a CompactionPicker.
+type CompactionPickerEnv struct {
+	// Scores holds the score of each level, as computed by the built-in
+	// heuristics while accounting for in-progress compactions. A level with a
+	// score of at least 1 is eligible for a score-based compaction.
+	Scores [numLevels]float64
+	// InProgressCompactions is the number of compactions (and flushes) in
+	// progress.
+	InProgressCompactions int
+	// EarliestSnapshotSeqNum is the sequence number of the earliest open
+	// snapshot, or of the next write if there is no open snapshot. Keys
+	// shadowed by a newer key with a sequence number below it may be dropped
+	// by a compaction.
+	EarliestSnapshotSeqNum uint64
+	// Now is the current time, as reported by the DB's clock.
+	Now time.Time
+}
+
+// CompactionProposal describes a compaction proposed by a CompactionPicker.
+type CompactionProposal struct {
+	// StartLevel is the level of the tables to compact. The compaction
+	// outputs to the next level (the base level for L0), or to the bottommost
+	// level itself if StartLevel is the bottommost level.
+	StartLevel int
+	// Tables are the file numbers of tables in StartLevel. The compaction
+	// reads all the tables of StartLevel within the key range spanned by
+	// Tables, and is expanded with the overlapping tables of the output level
+	// as needed to preserve the invariants of the LSM.
+	Tables []FileNum
+}
+
+// CompactionPickerVersion is a read-only view of a version of the LSM, handed
+// to a CompactionPickerFactory. Its methods may only be called from within the
+// factory or from within the PickCompaction method of the CompactionPicker it
+// constructs.
+type CompactionPickerVersion struct {
+	vers      *version
+	baseLevel int
+}
+
+// CompactionPickerTable describes a table of the LSM.
+type CompactionPickerTable struct {
+	TableInfo
+	// Compacting is true if the table is the input of an in-progress
+	// compaction. A proposal including it isn't scheduled.
+	Compacting bool
+	// StatsValid is true if the table's statistics have been loaded. They're
+	// loaded asynchronously after the table is created; see
+	// Options.DisableTableStats.
+	StatsValid bool
+	// Stats holds the table's statistics, if StatsValid is true.
+	Stats manifest.TableStats
+}
+
+// BaseLevel returns the level L0 compacts into. The levels between L0 and the
+// base level are empty.
+func (v *CompactionPickerVersion) BaseLevel() int {
+	return v.baseLevel
+}
+
+// Tables returns the tables of the given level in key order, or in the order
+// of their sequence numbers for L0.
+func (v *CompactionPickerVersion) Tables(level int) []CompactionPickerTable {
+	var tables []CompactionPickerTable
+	iter := v.vers.Levels[level].Iter()
+	for f := iter.First(); f != nil; f = iter.Next() {
+		t := CompactionPickerTable{
+			TableInfo:  f.TableInfo(),
+			Compacting: f.IsCompacting(),
+			StatsValid: f.StatsValid(),
+		}
+		if t.StatsValid {
+			t.Stats = f.Stats
+		}
+		tables = append(tables, t)
+	}
+	return tables
+}
+
+// pickCustomCompaction asks the CompactionPicker constructed through
+// Options.Experimental.CompactionPickerFactory for a compaction. It returns
+// nil if there's no proposal, or if the proposal can't be scheduled.
+func (p *compactionPickerByScore) pickCustomCompaction(
+	env compactionEnv, scores [numLevels]candidateLevelInfo,
+) *pickedCompaction {
+	pickerEnv := CompactionPickerEnv{
+		InProgressCompactions:  len(env.inProgressCompactions),
+		EarliestSnapshotSeqNum: env.earliestSnapshotSeqNum,
+		Now:                    env.now,
+	}
+	for i := range scores {
+		pickerEnv.Scores[scores[i].level] = scores[i].compensatedScoreRatio
+	}
+	proposal, ok := p.custom.PickCompaction(pickerEnv)
+	if !ok || len(proposal.Tables) == 0 {
+		return nil
+	}
+	level := proposal.StartLevel
+	if level < 0 || level >= numLevels || (level > 0 && level < p.baseLevel) {
+		return nil
+	}
+
+	// Look up the proposed tables, ignoring the proposal if any of them isn't
+	// in the level.
+	fileNums := make(map[base.FileNum]struct{}, len(proposal.Tables))
+	for _, fileNum := range proposal.Tables {
+		fileNums[fileNum] = struct{}{}
+	}
+	files := make([]*fileMetadata, 0, len(fileNums))
+	iter := p.vers.Levels[level].Iter()
+	for f := iter.First(); f != nil; f = iter.Next() {
+		if _, ok := fileNums[f.FileNum]; ok {
+			files = append(files, f)
+		}
+	}
+	if len(files) != len(fileNums) {
+		return nil
+	}
+	cmp := p.opts.Comparer.Compare
+	smallest, largest := files[0].Smallest, files[0].Largest
+	for _, f := range files[1:] {
+		if base.InternalCompare(cmp, f.Smallest, smallest) < 0 {
+			smallest = f.Smallest
+		}
+		if base.InternalCompare(cmp, f.Largest, largest) > 0 {
+			largest = f.Largest
+		}
+	}
+
+	pc := newPickedCompaction(p.opts, p.vers, level, defaultOutputLevel(level, p.baseLevel), p.baseLevel)
+	pc.startLevel.files = p.vers.Overlaps(level, base.UserKeyBoundsFromInternal(smallest, largest))
+	if !pc.setupInputs(p.opts, env.diskAvailBytes, pc.startLevel) {
+		return nil
+	}
+	// Fail-safe to protect against compacting the same sstable concurrently.
+	if inputRangeAlreadyCompacting(env, pc) {
+		return nil
+	}
+	p.addScoresToPickedCompactionMetrics(pc, scores)
+	pc.score = pickerEnv.Scores[level]
+	return pc
+}
@@ -0,0 +1,87 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+type compactionPickerFunc func(env CompactionPickerEnv) (CompactionProposal, bool)
+
+func (f compactionPickerFunc) PickCompaction(env CompactionPickerEnv) (CompactionProposal, bool) {
+	return f(env)
+}
+
+func TestCustomCompactionPicker(t *testing.T) {
+	var versions, picks, bogusPicks atomic.Int64
+	var bogus atomic.Bool
+	opts := &Options{
+		FS: vfs.NewMem(),
+		// The built-in heuristics never compact L0.
+		L0CompactionThreshold: 1000,
+		L0StopWritesThreshold: 1000,
+	}
+	opts.Experimental.CompactionPickerFactory = func(v *CompactionPickerVersion) CompactionPicker {
+		versions.Add(1)
+		return compactionPickerFunc(func(env CompactionPickerEnv) (CompactionProposal, bool) {
+			if bogus.Load() {
+				// Proposals of unknown tables are ignored.
+				bogusPicks.Add(1)
+				return CompactionProposal{StartLevel: 0, Tables: []FileNum{1 << 40}}, true
+			}
+			tables := v.Tables(0)
+			if len(tables) < 3 {
+				return CompactionProposal{}, false
+			}
+			proposal := CompactionProposal{StartLevel: 0}
+			for _, t := range tables {
+				if t.Compacting {
+					return CompactionProposal{}, false
+				}
+				proposal.Tables = append(proposal.Tables, t.FileNum)
+			}
+			picks.Add(1)
+			return proposal, true
+		})
+	}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	flush := func(n int) {
+		for i := 0; i < n; i++ {
+			require.NoError(t, d.Set([]byte(fmt.Sprintf("k%d", i)), []byte("v"), nil))
+			require.NoError(t, d.Flush())
+		}
+	}
+	numL0Files := func() int64 {
+		return d.Metrics().Levels[0].NumFiles
+	}
+
+	flush(2)
+	require.Equal(t, int64(2), numL0Files())
+	require.Zero(t, picks.Load())
+
+	// Once there are 3 tables in L0, the custom picker compacts them.
+	flush(1)
+	require.Eventually(t, func() bool {
+		return numL0Files() == 0
+	}, 10*time.Second, time.Millisecond)
+	require.Equal(t, int64(1), picks.Load())
+	require.Equal(t, int64(1), d.Metrics().Levels[6].NumFiles)
+	require.Greater(t, versions.Load(), int64(3))
+
+	bogus.Store(true)
+	flush(3)
+	require.Greater(t, bogusPicks.Load(), int64(0))
+	require.Equal(t, int64(3), numL0Files())
+	require.Equal(t, int64(1), picks.Load())
+}
@@ -1337,6 +1337,64 @@ func TestCompactionPickerCompensatedSize(t *testing.T) {
 	}
 }
 
+func TestCompactionPickerTombstoneDensity(t *testing.T) {
+	opts := (*Options)(nil).EnsureDefaults()
+	newFile := func(fileNum base.FileNum, smallest, largest string, entries, deletions uint64) *fileMetadata {
+		m := (&fileMetadata{
+			FileNum: fileNum,
+			Size:    1 << 20,
+		}).ExtendPointKeyBounds(
+			opts.Comparer.Compare,
+			base.ParseInternalKey(smallest),
+			base.ParseInternalKey(largest),
+		)
+		m.InitPhysicalBacking()
+		m.SmallestSeqNum = m.Smallest.SeqNum()
+		m.LargestSeqNum = m.Largest.SeqNum()
+		m.Stats.NumEntries = entries
+		m.Stats.NumDeletions = deletions
+		m.StatsMarkValid()
+		return m
+	}
+	pick := func(
+		threshold float64, earliestSnapshotSeqNum uint64, files [numLevels][]*fileMetadata,
+	) string {
+		opts.Experimental.TombstoneDenseCompactionThreshold = threshold
+		vers := newVersion(opts, files)
+		vb := manifest.MakeVirtualBackings()
+		picker := newCompactionPickerByScore(vers, &vb, opts, nil)
+		pc := picker.pickTombstoneDensityCompaction(compactionEnv{
+			earliestUnflushedSeqNum: math.MaxUint64,
+			earliestSnapshotSeqNum:  earliestSnapshotSeqNum,
+		})
+		if pc == nil {
+			return "nil"
+		}
+		require.Equal(t, compactionKindTombstoneDensity, pc.kind)
+		return fmt.Sprintf("L%d %s -> L%d %s", pc.startLevel.level, fileNums(pc.startLevel.files),
+			pc.outputLevel.level, fileNums(pc.outputLevel.files))
+	}
+
+	var files [numLevels][]*fileMetadata
+	files[5] = []*fileMetadata{
+		newFile(1, "a.SET.10", "c.SET.11", 10, 2),
+		newFile(2, "d.DEL.12", "f.SET.13", 10, 8),
+	}
+	files[6] = []*fileMetadata{newFile(3, "a.SET.1", "f.SET.2", 100, 0)}
+	// The densest table is compacted into the next level.
+	require.Equal(t, "L5 000002 -> L6 000003", pick(0.5, math.MaxUint64, files))
+	require.Equal(t, "L5 000002 -> L6 000003", pick(0.1, math.MaxUint64, files))
+	require.Equal(t, "nil", pick(0.9, math.MaxUint64, files))
+	require.Equal(t, "nil", pick(0, math.MaxUint64, files))
+
+	// A dense table in the bottommost level is rewritten in place, unless its
+	// tombstones are visible to a snapshot.
+	files[5] = nil
+	files[6] = []*fileMetadata{newFile(3, "a.SET.1", "f.SET.2", 100, 60)}
+	require.Equal(t, "L6 000003 -> L6 ", pick(0.5, math.MaxUint64, files))
+	require.Equal(t, "nil", pick(0.5, 2, files))
+}
+
 func TestCompactionPickerPickFile(t *testing.T) {
 	fs := vfs.NewMem()
 	opts := &Options{
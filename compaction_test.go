@@ -773,7 +773,7 @@ func TestCompactionTransform(t *testing.T) {
 				disableSpanElision: disableElision,
 				inuseKeyRanges:     keyRanges,
 			}
-			transformer := rangeKeyCompactionTransform(base.DefaultComparer.Equal, snapshots, c.elideRangeTombstone)
+			transformer := rangeKeyCompactionTransform(base.DefaultComparer.Equal, snapshots, 0 /* historyHorizon */, c.elideRangeTombstone)
 			if err := transformer.Transform(base.DefaultComparer.Compare, span, &outSpan); err != nil {
 				return fmt.Sprintf("error: %s", err)
 			}
@@ -849,6 +849,214 @@ func TestCompactionCPUGranterDefault(t *testing.T) {
 	}
 }
 
+func TestCompactRangeLowPriority(t *testing.T) {
+	mem := vfs.NewMem()
+	opts := (&Options{FS: mem, DisableAutomaticCompactions: true}).WithFSDefaults()
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer d.Close()
+
+	for i := 0; i < 100; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("%03d", i)), bytes.Repeat([]byte{'x'}, 100), nil))
+	}
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.DeleteRange([]byte("000"), []byte("050"), nil))
+	require.NoError(t, d.Flush())
+
+	m := d.Metrics()
+	require.EqualValues(t, 2, m.Levels[0].NumFiles)
+
+	// A low-priority, rate-limited compaction of the range runs once the DB is
+	// idle and moves all the data out of L0.
+	err = <-d.CompactRange(context.Background(), []byte("000"), []byte("100"), CompactRangeOptions{
+		Priority:            CompactionPriorityLow,
+		LimitBytesPerSecond: 1 << 20,
+	})
+	require.NoError(t, err)
+	m = d.Metrics()
+	require.EqualValues(t, 0, m.Levels[0].NumFiles)
+
+	d.mu.Lock()
+	require.Equal(t, 0, d.mu.compact.lowPriorityCount)
+	require.Empty(t, d.mu.compact.lowPriorityManual)
+	d.mu.Unlock()
+
+	// Invalid ranges and cancelled contexts are reported through the channel.
+	require.Error(t, <-d.CompactRange(context.Background(), []byte("b"), []byte("a"), CompactRangeOptions{}))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, <-d.CompactRange(ctx, []byte("000"), []byte("100"), CompactRangeOptions{
+		Priority: CompactionPriorityLow,
+	}), context.Canceled)
+}
+
+func TestCompactionExpiry(t *testing.T) {
+	// Values are the Unix time, in seconds, at which the key expires, or "never".
+	var nowSecs atomic.Int64
+	nowSecs.Store(50)
+	mem := vfs.NewMem()
+	opts := (&Options{FS: mem}).WithFSDefaults()
+	opts.Experimental.ExpirationFunc = func(key, value []byte) time.Time {
+		secs, err := strconv.ParseInt(string(value), 10, 64)
+		if err != nil {
+			return time.Time{}
+		}
+		return time.Unix(secs, 0)
+	}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer d.Close()
+	d.mu.Lock()
+	d.timeNow = func() time.Time { return time.Unix(nowSecs.Load(), 0) }
+	d.mu.Unlock()
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("a%d", i)), []byte("100"), nil))
+	}
+	require.NoError(t, d.Compact([]byte("a"), []byte("b"), false))
+
+	d.mu.Lock()
+	files := d.mu.versions.currentVersion().Levels[numLevels-1].Slice()
+	d.mu.Unlock()
+	require.Equal(t, 1, files.Len())
+	iter := files.Iter()
+	f := iter.First()
+	require.True(t, f.StatsValid())
+	require.Equal(t, uint64(100*time.Second), f.Stats.MaxExpiry)
+
+	// None of the keys have expired yet, so flushing a table, which schedules
+	// compactions, doesn't compact the table.
+	require.NoError(t, d.Set([]byte("b"), []byte("never"), nil))
+	require.NoError(t, d.Flush())
+	require.Zero(t, d.Metrics().Compact.ExpiryCount)
+	v, closer, err := d.Get([]byte("a0"))
+	require.NoError(t, err)
+	require.Equal(t, "100", string(v))
+	require.NoError(t, closer.Close())
+
+	// Once the keys have expired, they remain visible to an open snapshot, and
+	// the table isn't picked for an expiry compaction.
+	nowSecs.Store(200)
+	snap := d.NewSnapshot()
+	require.NoError(t, d.Set([]byte("c"), []byte("never"), nil))
+	require.NoError(t, d.Flush())
+	v, closer, err = snap.Get([]byte("a0"))
+	require.NoError(t, err)
+	require.Equal(t, "100", string(v))
+	require.NoError(t, closer.Close())
+	require.Zero(t, d.Metrics().Compact.ExpiryCount)
+
+	// Once the snapshot is closed, the table is compacted and the keys are
+	// dropped.
+	require.NoError(t, snap.Close())
+	require.NoError(t, d.Set([]byte("d"), []byte("never"), nil))
+	require.NoError(t, d.Flush())
+	require.Eventually(t, func() bool {
+		return d.Metrics().Compact.ExpiryCount == 1
+	}, 10*time.Second, time.Millisecond)
+	_, _, err = d.Get([]byte("a0"))
+	require.ErrorIs(t, err, ErrNotFound)
+	require.Zero(t, d.Metrics().Levels[numLevels-1].NumFiles)
+	v, closer, err = d.Get([]byte("b"))
+	require.NoError(t, err)
+	require.Equal(t, "never", string(v))
+	require.NoError(t, closer.Close())
+}
+
+func TestCompactionTombstoneDensity(t *testing.T) {
+	mem := vfs.NewMem()
+	opts := (&Options{FS: mem}).WithFSDefaults()
+	opts.Experimental.TombstoneDenseCompactionThreshold = 0.25
+	opts.private.disableElisionOnlyCompactions = true
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer d.Close()
+
+	// The snapshot prevents the compaction from dropping the deleted keys and
+	// their tombstones.
+	for i := 0; i < 10; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("a%d", i)), []byte("v"), nil))
+	}
+	snap := d.NewSnapshot()
+	for i := 0; i < 10; i++ {
+		require.NoError(t, d.Delete([]byte(fmt.Sprintf("a%d", i)), nil))
+	}
+	require.NoError(t, d.Compact([]byte("a"), []byte("b"), false))
+	require.NoError(t, d.Flush())
+	d.mu.Lock()
+	d.waitTableStats()
+	files := d.mu.versions.currentVersion().Levels[numLevels-1].Slice()
+	d.mu.Unlock()
+	require.Equal(t, 1, files.Len())
+	iter := files.Iter()
+	f := iter.First()
+	require.True(t, f.StatsValid())
+	require.Equal(t, uint64(10), f.Stats.NumDeletions)
+	require.Zero(t, d.Metrics().Compact.TombstoneDensityCount)
+
+	// Once the snapshot is closed, flushing a table schedules the compaction of
+	// the dense table, which drops the tombstones.
+	require.NoError(t, snap.Close())
+	require.NoError(t, d.Set([]byte("b"), []byte("v"), nil))
+	require.NoError(t, d.Flush())
+	require.Eventually(t, func() bool {
+		return d.Metrics().Compact.TombstoneDensityCount == 1
+	}, 10*time.Second, time.Millisecond)
+	require.Zero(t, d.Metrics().Levels[numLevels-1].NumFiles)
+}
+
+func TestCompactRangeLowPriorityPreemption(t *testing.T) {
+	var preempted atomic.Int32
+	mem := vfs.NewMem()
+	opts := (&Options{
+		FS:                          mem,
+		DisableAutomaticCompactions: true,
+		EventListener: &EventListener{
+			CompactionEnd: func(info CompactionInfo) {
+				if errors.Is(info.Err, ErrCancelledCompaction) {
+					preempted.Add(1)
+				}
+			},
+		},
+	}).WithFSDefaults()
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer d.Close()
+
+	// Write two overlapping L0 files, so that the compaction can't be a move.
+	for j := 0; j < 2; j++ {
+		for i := 0; i < 100; i++ {
+			require.NoError(t, d.Set([]byte(fmt.Sprintf("%03d", i)), bytes.Repeat([]byte{'x'}, 1000), nil))
+		}
+		require.NoError(t, d.Flush())
+	}
+
+	// Schedule a compaction that is throttled heavily enough that it can't
+	// complete before it's preempted.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := d.CompactRange(ctx, []byte("000"), []byte("100"), CompactRangeOptions{
+		Priority:            CompactionPriorityLow,
+		LimitBytesPerSecond: 1,
+	})
+	require.Eventually(t, func() bool {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return d.mu.compact.lowPriorityCount > 0
+	}, 10*time.Second, time.Millisecond)
+
+	// A flush preempts the low-priority compaction, which is requeued.
+	require.NoError(t, d.Set([]byte("foo"), []byte("bar"), nil))
+	require.NoError(t, d.Flush())
+	require.Eventually(t, func() bool {
+		return preempted.Load() > 0
+	}, 10*time.Second, time.Millisecond)
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+	m := d.Metrics()
+	require.EqualValues(t, 3, m.Levels[0].NumFiles)
+}
+
 func TestCompaction(t *testing.T) {
 	const memTableSize = 10000
 	// Tuned so that 2 values can reside in the memtable before a flush, but a
@@ -1758,6 +1966,40 @@ func TestCompactionOutputLevel(t *testing.T) {
 		})
 }
 
+func TestCompactionPerLevelCompression(t *testing.T) {
+	opts := &Options{
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+		Levels:                      make([]LevelOptions, numLevels),
+	}
+	for i := range opts.Levels {
+		opts.Levels[i].Compression = func() Compression { return SnappyCompression }
+	}
+	opts.Levels[numLevels-1].Compression = func() Compression { return ZstdCompression }
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Set([]byte("b"), []byte("2"), nil))
+	require.NoError(t, d.Flush())
+
+	// The flushed table would ordinarily be moved to L6, but it's rewritten in
+	// order to recompress its blocks with L6's compression.
+	require.NoError(t, d.Compact([]byte("a"), []byte("c"), false))
+	m := d.Metrics()
+	require.Zero(t, m.Compact.MoveCount)
+	tables, err := d.SSTables(WithProperties())
+	require.NoError(t, err)
+	require.Len(t, tables[numLevels-1], 1)
+	require.Equal(t, "ZSTD", tables[numLevels-1][0].Properties.CompressionName)
+
+	require.True(t, levelsShareBlockSettings(opts, 0, 5))
+	require.False(t, levelsShareBlockSettings(opts, 5, 6))
+	opts.Levels[5].BlockSize = 2 * opts.Levels[4].BlockSize
+	require.False(t, levelsShareBlockSettings(opts, 4, 5))
+}
+
 func TestCompactionDeleteOnlyHints(t *testing.T) {
 	parseUint64 := func(s string) uint64 {
 		v, err := strconv.ParseUint(s, 10, 64)
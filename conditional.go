@@ -0,0 +1,149 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"context"
+	"slices"
+
+	"github.com/cockroachdb/errors"
+)
+
+// ErrConditionFailed is returned when a batch isn't committed because one of its
+// preconditions isn't satisfied. See Batch.ExpectAbsent and Batch.ExpectValue.
+var ErrConditionFailed = errors.New("pebble: batch precondition failed")
+
+// errBatchNotCommitted marks the errors returned by the commit pipeline for
+// batches that weren't committed, and may be committed again.
+var errBatchNotCommitted = errors.New("pebble: batch not committed")
+
+// batchCondition is a precondition of a batch, on the point key key.
+type batchCondition struct {
+	key []byte
+	// absent is set if the key must not exist. Otherwise, the key must exist,
+	// holding a value equal to value.
+	absent bool
+	value  []byte
+	equal  Equal
+}
+
+// ExpectAbsent adds a precondition to the batch: the batch is only committed if
+// the DB doesn't hold a point key key when the batch is committed. Otherwise,
+// the batch's commit fails with an error satisfying
+// errors.Is(err, ErrConditionFailed), and none of its mutations are applied.
+//
+// The preconditions of a batch are checked by the commit pipeline atomically
+// with its commit: once all the batches committed before it have been applied,
+// and before any batch committed after it is sequenced. They're checked against
+// the state of the DB preceding the batch, and thus aren't affected by the
+// batch's own mutations. The preconditions of an empty batch aren't checked.
+//
+// Committing a batch with preconditions reduces the write throughput of the
+// DB: no other batch is sequenced from the time the batch is sequenced until
+// the batches committed before it have been applied to the memtable and its
+// preconditions have been checked, so the commit of the batch isn't pipelined
+// with the commits of other batches. Preconditions should be reserved for
+// batches that need them, rather than added to every batch.
+//
+// It is safe to modify the contents of the argument after ExpectAbsent
+// returns.
+func (b *Batch) ExpectAbsent(key []byte) {
+	b.conditions = append(b.conditions, batchCondition{key: slices.Clone(key), absent: true})
+}
+
+// ExpectValue adds a precondition to the batch: the batch is only committed if
+// the DB holds a point key key whose value is equal to value, as determined by
+// equal, when the batch is committed. If equal is nil, values are compared
+// bytewise. Merge operands are merged before the values are compared. See
+// ExpectAbsent, including for the cost of preconditions to write throughput.
+//
+// Checking the preconditions of a batch blocks the commit of other batches, so
+// equal must be cheap, and must not call into the DB.
+//
+// It is safe to modify the contents of the arguments after ExpectValue
+// returns.
+func (b *Batch) ExpectValue(key, value []byte, equal Equal) {
+	if equal == nil {
+		equal = bytes.Equal
+	}
+	b.conditions = append(b.conditions, batchCondition{
+		key:   slices.Clone(key),
+		value: slices.Clone(value),
+		equal: equal,
+	})
+}
+
+// SetIfAbsent sets the value for the given key if the DB doesn't hold the key,
+// atomically. It returns an error satisfying errors.Is(err, ErrConditionFailed)
+// if the key exists.
+//
+// It is safe to modify the contents of the arguments after SetIfAbsent
+// returns.
+func (d *DB) SetIfAbsent(key, value []byte, opts *WriteOptions) error {
+	b := newBatch(d)
+	b.ExpectAbsent(key)
+	_ = b.Set(key, value, opts)
+	if err := d.Apply(b, opts); err != nil {
+		if errors.Is(err, errBatchNotCommitted) {
+			// The batch wasn't committed, so it may be released.
+			_ = b.Close()
+		}
+		return err
+	}
+	return b.Close()
+}
+
+// CompareAndSwap sets the value for the given key to newValue if the DB holds
+// the key with a value equal to oldValue, as determined by equal, atomically.
+// If equal is nil, values are compared bytewise. It returns an error
+// satisfying errors.Is(err, ErrConditionFailed) if the key doesn't exist, or
+// holds a different value.
+//
+// It is safe to modify the contents of the arguments after CompareAndSwap
+// returns.
+func (d *DB) CompareAndSwap(key, oldValue, newValue []byte, equal Equal, opts *WriteOptions) error {
+	b := newBatch(d)
+	b.ExpectValue(key, oldValue, equal)
+	_ = b.Set(key, newValue, opts)
+	if err := d.Apply(b, opts); err != nil {
+		if errors.Is(err, errBatchNotCommitted) {
+			// The batch wasn't committed, so it may be released.
+			_ = b.Close()
+		}
+		return err
+	}
+	return b.Close()
+}
+
+// checkBatchConditions checks the preconditions of the batch against the
+// current state of the DB. It's invoked by the commit pipeline with
+// commitPipeline.mu held, once all the batches sequenced before b have been
+// applied.
+func (d *DB) checkBatchConditions(b *Batch) error {
+	for i := range b.conditions {
+		c := &b.conditions[i]
+		value, closer, err := d.getInternal(context.Background(), c.key, nil /* batch */, nil /* snapshot */)
+		if errors.Is(err, ErrNotFound) {
+			if c.absent {
+				continue
+			}
+			return errors.Wrapf(ErrConditionFailed, "pebble: key %s not found", d.opts.Comparer.FormatKey(c.key))
+		} else if err != nil {
+			return err
+		}
+		ok := !c.absent && c.equal(value, c.value)
+		if err := closer.Close(); err != nil {
+			return err
+		}
+		if !ok {
+			if c.absent {
+				return errors.Wrapf(ErrConditionFailed, "pebble: key %s exists", d.opts.Comparer.FormatKey(c.key))
+			}
+			return errors.Wrapf(ErrConditionFailed, "pebble: value of key %s differs", d.opts.Comparer.FormatKey(c.key))
+		}
+	}
+	return nil
+}
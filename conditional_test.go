@@ -0,0 +1,153 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConditionalWrites(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	get := func(key string) string {
+		v, closer, err := d.Get([]byte(key))
+		if errors.Is(err, ErrNotFound) {
+			return "<not found>"
+		}
+		require.NoError(t, err)
+		defer closer.Close()
+		return string(v)
+	}
+
+	require.NoError(t, d.SetIfAbsent([]byte("a"), []byte("1"), nil))
+	err = d.SetIfAbsent([]byte("a"), []byte("2"), nil)
+	require.True(t, errors.Is(err, ErrConditionFailed), "%v", err)
+	require.Equal(t, "1", get("a"))
+
+	require.NoError(t, d.CompareAndSwap([]byte("a"), []byte("1"), []byte("3"), nil, nil))
+	require.Equal(t, "3", get("a"))
+	err = d.CompareAndSwap([]byte("a"), []byte("1"), []byte("4"), nil, nil)
+	require.True(t, errors.Is(err, ErrConditionFailed), "%v", err)
+	err = d.CompareAndSwap([]byte("b"), []byte("1"), []byte("4"), nil, nil)
+	require.True(t, errors.Is(err, ErrConditionFailed), "%v", err)
+	require.Equal(t, "3", get("a"))
+	require.Equal(t, "<not found>", get("b"))
+
+	// A user-provided comparator.
+	caseInsensitive := func(a, b []byte) bool { return bytes.EqualFold(a, b) }
+	require.NoError(t, d.Set([]byte("c"), []byte("Foo"), nil))
+	require.NoError(t, d.CompareAndSwap([]byte("c"), []byte("FOO"), []byte("bar"), caseInsensitive, nil))
+	require.Equal(t, "bar", get("c"))
+
+	// A deleted key is absent.
+	require.NoError(t, d.Delete([]byte("c"), nil))
+	require.NoError(t, d.SetIfAbsent([]byte("c"), []byte("baz"), nil))
+	require.Equal(t, "baz", get("c"))
+
+	// Preconditions are checked against the flushed state too.
+	require.NoError(t, d.Flush())
+	err = d.SetIfAbsent([]byte("c"), []byte("qux"), nil)
+	require.True(t, errors.Is(err, ErrConditionFailed), "%v", err)
+
+	// None of the mutations of a batch are applied if any precondition fails,
+	// and the batch may be committed again.
+	b := d.NewBatch()
+	b.ExpectValue([]byte("a"), []byte("3"), nil)
+	b.ExpectAbsent([]byte("d"))
+	require.NoError(t, b.Set([]byte("a"), []byte("5"), nil))
+	require.NoError(t, b.Set([]byte("d"), []byte("6"), nil))
+	require.NoError(t, d.Set([]byte("d"), []byte("7"), nil))
+	err = b.Commit(nil)
+	require.True(t, errors.Is(err, ErrConditionFailed), "%v", err)
+	require.Equal(t, "3", get("a"))
+	require.Equal(t, "7", get("d"))
+	require.NoError(t, d.Delete([]byte("d"), nil))
+	require.NoError(t, b.Commit(nil))
+	require.Equal(t, "5", get("a"))
+	require.Equal(t, "6", get("d"))
+	require.NoError(t, b.Close())
+
+	// Preconditions don't observe the batch's own mutations.
+	b = d.NewBatch()
+	require.NoError(t, b.Set([]byte("e"), []byte("1"), nil))
+	b.ExpectAbsent([]byte("e"))
+	require.NoError(t, b.Commit(nil))
+	require.NoError(t, b.Close())
+
+	// ApplyAll checks the preconditions of all the batches.
+	b1, b2 := d.NewBatch(), d.NewBatch()
+	require.NoError(t, b1.Set([]byte("f"), []byte("1"), nil))
+	b2.ExpectAbsent([]byte("e"))
+	require.NoError(t, b2.Set([]byte("g"), []byte("1"), nil))
+	err = d.ApplyAll([]*Batch{b1, b2}, nil)
+	require.True(t, errors.Is(err, ErrConditionFailed), "%v", err)
+	require.Equal(t, "<not found>", get("f"))
+	require.NoError(t, b1.Close())
+	require.NoError(t, b2.Close())
+
+	// Batches with preconditions can't be prepared.
+	b = d.NewBatch()
+	b.ExpectAbsent([]byte("h"))
+	require.NoError(t, b.Set([]byte("h"), []byte("1"), nil))
+	require.Error(t, b.Prepare([]byte("txn")))
+	require.NoError(t, b.Close())
+}
+
+func TestConditionalWritesConcurrent(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// Concurrently increment a counter through CompareAndSwap. Each increment
+	// is retried until its precondition is satisfied, so that none is lost.
+	key := []byte("counter")
+	require.NoError(t, d.Set(key, []byte("0"), nil))
+	const goroutines, increments = 8, 50
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < increments; {
+				v, closer, err := d.Get(key)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				n, _ := strconv.Atoi(string(v))
+				old := []byte(strconv.Itoa(n))
+				_ = closer.Close()
+				err = d.CompareAndSwap(key, old, []byte(strconv.Itoa(n+1)), nil, NoSync)
+				if errors.Is(err, ErrConditionFailed) {
+					continue
+				} else if err != nil {
+					t.Error(err)
+					return
+				}
+				// Interleave a blind write to another key.
+				if err := d.Set([]byte(strconv.Itoa(j)), nil, NoSync); err != nil {
+					t.Error(err)
+					return
+				}
+				j++
+			}
+		}()
+	}
+	wg.Wait()
+
+	v, closer, err := d.Get(key)
+	require.NoError(t, err)
+	require.Equal(t, strconv.Itoa(goroutines*increments), string(v))
+	require.NoError(t, closer.Close())
+}
@@ -0,0 +1,198 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/manifest"
+	"github.com/cockroachdb/pebble/sstable"
+)
+
+// CorruptionRecoveryHook recovers a block of a table of the DB that failed its
+// checksum, e.g. by fetching it from a replica of the table maintained by the
+// application. It returns the length bytes of the block at the given offset of
+// the table followed by its 5-byte trailer, or an error if the block cannot be
+// recovered. The recovered bytes are validated against the checksum of their
+// trailer before being used.
+//
+// The hook is invoked by the reads and compactions that read the block, may be
+// invoked concurrently, and must not call into the DB.
+type CorruptionRecoveryHook func(
+	ctx context.Context, fileNum base.DiskFileNum, offset, length uint64,
+) ([]byte, error)
+
+// QuarantinedBlock is a block of a table of the DB that failed its checksum.
+type QuarantinedBlock struct {
+	FileNum base.DiskFileNum
+	// Offset and Length are the offset and length of the block within the
+	// table, excluding its trailer.
+	Offset, Length uint64
+	// Recovered is true if the block was recovered by
+	// Options.CorruptionRecoveryHook.
+	Recovered bool
+}
+
+var errNoCorruptionRecoveryHook = errors.New("pebble: no CorruptionRecoveryHook is configured")
+
+// corruptionQuarantine records the blocks of the tables of a DB that failed
+// their checksum, until the tables are deleted, and recovers them with
+// Options.CorruptionRecoveryHook. The tables with recovered blocks are marked
+// for rewrite compactions, which rewrite them with the recovered blocks.
+type corruptionQuarantine struct {
+	d  *DB
+	mu struct {
+		sync.Mutex
+		blocks map[base.DiskFileNum][]QuarantinedBlock
+		// rewrites are the tables with recovered blocks that remain to be
+		// marked for compaction.
+		rewrites       map[base.DiskFileNum]struct{}
+		recoveredCount int64
+	}
+}
+
+var _ sstable.CorruptBlockHandler = (*corruptionQuarantine)(nil)
+
+// RecoverBlock implements sstable.CorruptBlockHandler.
+func (q *corruptionQuarantine) RecoverBlock(
+	ctx context.Context, b sstable.CorruptBlock,
+) ([]byte, error) {
+	if q.d.opts.CorruptionRecoveryHook == nil {
+		return nil, errNoCorruptionRecoveryHook
+	}
+	return q.d.opts.CorruptionRecoveryHook(ctx, b.FileNum, b.Handle.Offset, b.Handle.Length)
+}
+
+// ReportCorruptBlock implements sstable.CorruptBlockHandler.
+func (q *corruptionQuarantine) ReportCorruptBlock(b sstable.CorruptBlock, err error) {
+	recovered := err == nil
+	q.mu.Lock()
+	if q.mu.blocks == nil {
+		q.mu.blocks = make(map[base.DiskFileNum][]QuarantinedBlock)
+	}
+	blocks := q.mu.blocks[b.FileNum]
+	i := slices.IndexFunc(blocks, func(qb QuarantinedBlock) bool {
+		return qb.Offset == b.Handle.Offset
+	})
+	quarantined := i < 0
+	if quarantined {
+		blocks = append(blocks, QuarantinedBlock{
+			FileNum: b.FileNum,
+			Offset:  b.Handle.Offset,
+			Length:  b.Handle.Length,
+		})
+		i = len(blocks) - 1
+		q.mu.blocks[b.FileNum] = blocks
+	}
+	// The table is rewritten the first time one of its blocks is recovered.
+	// The recovered block is then read from the block cache, or recovered
+	// again, by the rewrite compaction.
+	rewrite := recovered && !blocks[i].Recovered
+	if recovered {
+		blocks[i].Recovered = true
+		q.mu.recoveredCount++
+	}
+	if rewrite {
+		if q.mu.rewrites == nil {
+			q.mu.rewrites = make(map[base.DiskFileNum]struct{})
+		}
+		q.mu.rewrites[b.FileNum] = struct{}{}
+	}
+	q.mu.Unlock()
+
+	if quarantined {
+		q.d.opts.EventListener.TableCorrupted(TableCorruptedInfo{
+			FileNum:   b.FileNum,
+			Offset:    b.Handle.Offset,
+			Length:    b.Handle.Length,
+			Err:       b.Err,
+			Recovered: recovered,
+		})
+	}
+	if rewrite {
+		// The corrupt block may be read with DB.mu held, so the tables are
+		// marked asynchronously.
+		q.d.compactionSchedulers.Add(1)
+		go q.d.markQuarantinedTablesAsync()
+	}
+}
+
+// remove removes the blocks of a deleted table from the quarantine.
+func (q *corruptionQuarantine) remove(fileNum base.DiskFileNum) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.mu.blocks, fileNum)
+	delete(q.mu.rewrites, fileNum)
+}
+
+// markQuarantinedTablesAsync marks the tables with recovered blocks for
+// compaction, and schedules the rewrite compactions.
+func (d *DB) markQuarantinedTablesAsync() {
+	defer d.compactionSchedulers.Done()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed.Load() != nil || d.opts.ReadOnly {
+		return
+	}
+	d.quarantine.mu.Lock()
+	rewrites := d.quarantine.mu.rewrites
+	d.quarantine.mu.rewrites = nil
+	d.quarantine.mu.Unlock()
+	if len(rewrites) == 0 {
+		return
+	}
+
+	// Lock the manifest for a coherent view of the LSM, as markFilesLocked
+	// does. Unlike markFilesLocked, the mark isn't persisted by rotating the
+	// manifest: if the DB is reopened before the tables are rewritten, their
+	// corruption is detected again by the next reads of the blocks.
+	d.mu.versions.logLock()
+	vers := d.mu.versions.currentVersion()
+	for l := range vers.Levels {
+		marked := false
+		iter := vers.Levels[l].Iter()
+		for f := iter.First(); f != nil; f = iter.Next() {
+			if _, ok := rewrites[f.FileBacking.DiskFileNum]; !ok ||
+				f.CompactionState == manifest.CompactionStateCompacted || f.MarkedForCompaction {
+				continue
+			}
+			vers.Stats.MarkedForCompaction++
+			f.MarkedForCompaction = true
+			marked = true
+		}
+		if marked {
+			vers.Levels[l].InvalidateAnnotation(markedForCompactionAnnotator{})
+		}
+	}
+	d.mu.versions.logUnlock()
+	d.maybeScheduleCompaction()
+}
+
+// Quarantine returns the blocks of the live tables of the DB that failed their
+// checksum when read, ordered by table and offset. The blocks of a table leave
+// the quarantine once the table is deleted, e.g. after it has been rewritten
+// by a compaction using the blocks recovered by
+// Options.CorruptionRecoveryHook.
+func (d *DB) Quarantine() []QuarantinedBlock {
+	d.quarantine.mu.Lock()
+	defer d.quarantine.mu.Unlock()
+	var blocks []QuarantinedBlock
+	for _, b := range d.quarantine.mu.blocks {
+		blocks = append(blocks, b...)
+	}
+	slices.SortFunc(blocks, func(a, b QuarantinedBlock) int {
+		if c := cmp.Compare(a.FileNum, b.FileNum); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Offset, b.Offset)
+	})
+	return blocks
+}
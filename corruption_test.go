@@ -0,0 +1,156 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/sstable"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCorruptionQuarantine(t *testing.T) {
+	mem := vfs.NewMem()
+	var mu sync.Mutex
+	var events []string
+	o := func(hook CorruptionRecoveryHook) *Options {
+		opts := &Options{
+			FS:                     mem,
+			CorruptionRecoveryHook: hook,
+			EventListener: &EventListener{
+				TableCorrupted: func(info TableCorruptedInfo) {
+					mu.Lock()
+					defer mu.Unlock()
+					events = append(events, info.String())
+				},
+			},
+		}
+		opts.Levels = []LevelOptions{{BlockSize: 32}}
+		return opts
+	}
+	lastEvent := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(events) == 0 {
+			return ""
+		}
+		return events[len(events)-1]
+	}
+
+	d, err := Open("", o(nil))
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("key%02d", i)), []byte(fmt.Sprint(i)), nil))
+	}
+	require.NoError(t, d.Flush())
+	tables, err := d.SSTables()
+	require.NoError(t, err)
+	require.Len(t, tables[0], 1)
+	fileNum := tables[0][0].BackingSSTNum
+	require.NoError(t, d.Close())
+
+	// Corrupt the second data block of the table.
+	path := base.MakeFilepath(mem, "", fileTypeTable, fileNum)
+	f, err := mem.Open(path)
+	require.NoError(t, err)
+	readable, err := sstable.NewSimpleReadable(f)
+	require.NoError(t, err)
+	r, err := sstable.NewReader(readable, sstable.ReaderOptions{})
+	require.NoError(t, err)
+	layout, err := r.Layout()
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.Greater(t, len(layout.Data), 1)
+	bh := layout.Data[1].BlockHandle
+	f, err = mem.Open(path)
+	require.NoError(t, err)
+	orig, err := io.ReadAll(f)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	corrupted := slices.Clone(orig)
+	corrupted[bh.Offset] ^= 0xff
+	f, err = mem.Create(path)
+	require.NoError(t, err)
+	_, err = f.Write(corrupted)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	scan := func(d *DB) (int, error) {
+		iter, err := d.NewIter(nil)
+		require.NoError(t, err)
+		n := 0
+		for valid := iter.First(); valid; valid = iter.Next() {
+			n++
+		}
+		return n, iter.Close()
+	}
+	corruptEvent := func(recovered bool) string {
+		s := fmt.Sprintf("table %s corrupted at block %d/%d", fileNum, bh.Offset, bh.Length)
+		if recovered {
+			s += " (recovered)"
+		}
+		return s + fmt.Sprintf(": pebble/table: invalid table %s (checksum mismatch at %d/%d)",
+			fileNum, bh.Offset, bh.Length)
+	}
+
+	// Without a hook, the corrupt block fails the read, and is quarantined.
+	d, err = Open("", o(nil))
+	require.NoError(t, err)
+	_, err = scan(d)
+	require.True(t, errors.Is(err, base.ErrCorruption))
+	require.Equal(t, corruptEvent(false), lastEvent())
+	require.Equal(t, []QuarantinedBlock{{FileNum: fileNum, Offset: bh.Offset, Length: bh.Length}}, d.Quarantine())
+	m := d.Metrics()
+	require.Equal(t, 1, m.Corruption.QuarantinedTables)
+	require.Equal(t, 1, m.Corruption.QuarantinedBlocks)
+	require.Zero(t, m.Corruption.RecoveredCount)
+	require.NoError(t, d.Close())
+
+	// With a hook, the corrupt block is recovered, and the table is rewritten.
+	var recoveries []string
+	d, err = Open("", o(func(
+		_ context.Context, fn base.DiskFileNum, offset, length uint64,
+	) ([]byte, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		recoveries = append(recoveries, fmt.Sprintf("%s %d/%d", fn, offset, length))
+		return orig[offset : offset+length+5], nil
+	}))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	n, err := scan(d)
+	require.NoError(t, err)
+	require.Equal(t, 10, n)
+	require.Equal(t, corruptEvent(true), lastEvent())
+	mu.Lock()
+	require.Equal(t, []string{fmt.Sprintf("%s %d/%d", fileNum, bh.Offset, bh.Length)}, recoveries[:1])
+	mu.Unlock()
+	require.Equal(t, int64(1), d.Metrics().Corruption.RecoveredCount)
+
+	// The rewritten table leaves the quarantine once the corrupt table is
+	// deleted.
+	deadline := time.Now().Add(10 * time.Second)
+	for len(d.Quarantine()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("table %s not rewritten: %+v", fileNum, d.Quarantine())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	tables, err = d.SSTables()
+	require.NoError(t, err)
+	require.Len(t, tables[0], 1)
+	require.NotEqual(t, fileNum, tables[0][0].BackingSSTNum)
+	require.Equal(t, int64(1), d.Metrics().Compact.RewriteCount)
+	require.Zero(t, d.Metrics().Corruption.QuarantinedTables)
+}
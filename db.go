@@ -9,12 +9,14 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"slices"
 	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/batchrepr"
 	"github.com/cockroachdb/pebble/internal/arenaskl"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/invalidating"
@@ -54,6 +56,10 @@ var (
 	// ErrReadOnly is returned when a write operation is performed on a read-only
 	// database.
 	ErrReadOnly = errors.New("pebble: read-only")
+	// ErrLowDiskSpace is returned from write operations while available disk
+	// space is below Options.LowDiskSpaceThreshold, if
+	// Options.ReadOnlyOnLowDiskSpace is set.
+	ErrLowDiskSpace = errors.New("pebble: available disk space below threshold")
 	// errNoSplit indicates that the user is trying to perform a range key
 	// operation but the configured Comparer does not provide a Split
 	// implementation.
@@ -268,12 +274,20 @@ type DB struct {
 	// memtable allocation will reuse this memtable if it has not already been
 	// recycled.
 	memTableRecycle atomic.Pointer[memTable]
+	// memTableTargetSize is the steady state size of memtables. It is
+	// Options.MemTableSize, unless adaptive memtable sizing is enabled, in
+	// which case it's adjusted within the Options.AdaptiveMemTable bounds by
+	// adaptMemTableSizeLocked. It's only modified while holding DB.mu.
+	memTableTargetSize atomic.Uint64
 
 	// The logical size of the current WAL.
 	logSize atomic.Uint64
 
 	// The number of bytes available on disk.
 	diskAvailBytes atomic.Uint64
+	// lowDiskSpace is true while diskAvailBytes is below
+	// Options.LowDiskSpaceThreshold.
+	lowDiskSpace atomic.Bool
 
 	cacheID        uint64
 	dirname        string
@@ -297,7 +311,12 @@ type DB struct {
 	fileLock *Lock
 	dataDir  vfs.File
 
+	// eventLog is the event log of the DB, if Options.EventLog is enabled.
+	eventLog *eventLog
+
 	tableCache           *tableCacheContainer
+	blobFiles            *blobFileCache
+	quarantine           corruptionQuarantine
 	newIters             tableNewIters
 	tableNewRangeKeyIter keyspanimpl.TableNewSpanIter
 
@@ -399,12 +418,27 @@ type DB struct {
 			queue flushableList
 			// nextSize is the size of the next memtable. The memtable size starts at
 			// min(256KB,Options.MemTableSize) and doubles each time a new memtable
-			// is allocated up to Options.MemTableSize. This reduces the memory
-			// footprint of memtables when lots of DB instances are used concurrently
-			// in test environments.
+			// is allocated up to the target size (see DB.memTableTargetSize). This
+			// reduces the memory footprint of memtables when lots of DB instances
+			// are used concurrently in test environments.
 			nextSize uint64
+			// adaptive holds the state of adaptive memtable sizing. See
+			// DB.adaptMemTableSizeLocked.
+			adaptive struct {
+				// calmRotations is the number of consecutive memtable rotations
+				// without flush pressure.
+				calmRotations int
+				// bytesIn and bytesWritten are the bytes written to the WAL and the
+				// bytes written by flushes and compactions as of the last
+				// memtable rotation.
+				bytesIn      uint64
+				bytesWritten uint64
+			}
 		}
 
+		// follower is the state of a DB opened with OpenReadOnly.
+		follower followerState
+
 		compact struct {
 			// Condition variable used to signal when a flush or compaction has
 			// completed. Used by the write-stall mechanism to wait for the stall
@@ -422,6 +456,13 @@ type DB struct {
 			// The list of manual compactions. The next manual compaction to perform
 			// is at the start of the list. New entries are added to the end.
 			manual []*manualCompaction
+			// The list of low-priority manual compactions scheduled through
+			// DB.CompactRange. These are only run while no other flush or
+			// compaction is running.
+			lowPriorityManual []*manualCompaction
+			// The number of ongoing low-priority compactions. These are included
+			// in compactingCount.
+			lowPriorityCount int
 			// downloads is the list of suggested download tasks. The next download to
 			// perform is at the start of the list. New entries are added to the end.
 			downloads []*downloadSpan
@@ -465,6 +506,14 @@ type DB struct {
 			cumulativePinnedSize  uint64
 		}
 
+		// history is the state of the history retained by the DB. See
+		// Options.RetainHistory.
+		history historyState
+
+		// prepared holds the prepared batches that have been neither committed
+		// nor rolled back. See Batch.Prepare.
+		prepared preparedBatches
+
 		tableStats struct {
 			// Condition variable used to signal the completion of a
 			// job to collect table stats.
@@ -483,6 +532,31 @@ type DB struct {
 			pending []manifest.NewFileEntry
 		}
 
+		blockPinning struct {
+			// cond is a condition variable used to signal the completion of a
+			// pinning pass.
+			cond sync.Cond
+			// spans holds the spans passed to DB.PinTables. It's only ever
+			// appended to.
+			spans []KeyRange
+			// requested and completed count the pinning passes requested, and
+			// the passes completed (i.e. the value of requested at the start
+			// of the last completed pass).
+			requested, completed uint64
+			// running is set to true while a pinning pass is running.
+			running bool
+			// err is the error of the last completed pass, if any.
+			err error
+			// tables holds the tables whose blocks are pinned, keyed by the
+			// file number of their backing sstable. It's owned by the running
+			// pass, if any.
+			tables map[base.DiskFileNum]pinnedTable
+			// count and size are the count of tables, and the total size of
+			// the blocks pinned, as of the last completed pass.
+			count int
+			size  uint64
+		}
+
 		tableValidation struct {
 			// cond is a condition variable used to signal the completion of a
 			// job to validate one or more sstables.
@@ -496,6 +570,16 @@ type DB struct {
 		}
 	}
 
+	// iterTracker tracks the open iterators if Options.DebugIterators is set,
+	// and is nil otherwise.
+	iterTracker *iterTracker
+	// hotKeys samples the keys read and written if Options.HotKeys is set, and
+	// is nil otherwise.
+	hotKeys *hotKeySampler
+	// rateLimiter submits I/O to Options.RateLimiter if it's set, and is nil
+	// otherwise.
+	rateLimiter *dbRateLimiter
+
 	// Normally equal to time.Now() but may be overridden in tests.
 	timeNow func() time.Time
 	// the time at database Open; may be used to compute metrics like effective
@@ -519,7 +603,12 @@ func (d *DB) TestOnlyWaitForCleaning() {
 // slice will remain valid until the returned Closer is closed. On success, the
 // caller MUST call closer.Close() or a memory leak will occur.
 func (d *DB) Get(key []byte) ([]byte, io.Closer, error) {
-	return d.getInternal(key, nil /* batch */, nil /* snapshot */)
+	return d.GetWithContext(context.Background(), key)
+}
+
+// GetWithContext is like Get, and additionally accepts a context for tracing.
+func (d *DB) GetWithContext(ctx context.Context, key []byte) ([]byte, io.Closer, error) {
+	return d.getInternal(ctx, key, nil /* batch */, nil /* snapshot */)
 }
 
 type getIterAlloc struct {
@@ -534,10 +623,18 @@ var getIterAllocPool = sync.Pool{
 	},
 }
 
-func (d *DB) getInternal(key []byte, b *Batch, s *Snapshot) ([]byte, io.Closer, error) {
+func (d *DB) getInternal(
+	ctx context.Context, key []byte, b *Batch, s *Snapshot,
+) ([]byte, io.Closer, error) {
 	if err := d.closed.Load(); err != nil {
 		panic(err)
 	}
+	var span TraceSpan
+	if t := d.opts.Tracer; t != nil {
+		ctx, span = t.StartSpan(ctx, TraceOpGet)
+	}
+
+	d.hotKeys.sample(key)
 
 	// Grab and reference the current readState. This prevents the underlying
 	// files in the associated version from being deleted if there is a current
@@ -557,6 +654,7 @@ func (d *DB) getInternal(key []byte, b *Batch, s *Snapshot) ([]byte, io.Closer,
 
 	get := &buf.get
 	*get = getIter{
+		ctx:      ctx,
 		logger:   d.opts.Logger,
 		comparer: d.opts.Comparer,
 		newIters: d.newIters,
@@ -581,7 +679,7 @@ func (d *DB) getInternal(key []byte, b *Batch, s *Snapshot) ([]byte, io.Closer,
 	i := &buf.dbi
 	pointIter := get
 	*i = Iterator{
-		ctx:          context.Background(),
+		ctx:          ctx,
 		getIterAlloc: buf,
 		iter:         pointIter,
 		pointIter:    pointIter,
@@ -590,8 +688,15 @@ func (d *DB) getInternal(key []byte, b *Batch, s *Snapshot) ([]byte, io.Closer,
 		readState:    readState,
 		keyBuf:       buf.keyBuf,
 	}
+	if span != nil {
+		get.stats = &i.stats.InternalStats
+	}
 
-	if !i.First() {
+	found := i.First()
+	if span != nil {
+		span.Finish(makeReadTraceInfo(&i.stats.InternalStats, i.Error()))
+	}
+	if !found {
 		err := i.Close()
 		if err != nil {
 			return nil, nil, err
@@ -601,6 +706,89 @@ func (d *DB) getInternal(key []byte, b *Batch, s *Snapshot) ([]byte, io.Closer,
 	return i.Value(), i, nil
 }
 
+// MultiGet gets the values for the given keys. The returned slice has one
+// entry per key, in the same order as keys. The entry for a key that the DB
+// does not contain is nil; the entry for a key whose value is empty is a
+// non-nil, empty slice.
+//
+// MultiGet is more efficient than calling Get for each key: the keys are
+// looked up in sorted order using a single iterator, so that blocks and
+// per-sstable iterators are reused across keys that are near one another.
+//
+// The caller owns the returned values, which remain valid after MultiGet
+// returns. It is safe to modify the contents of the argument after MultiGet
+// returns.
+func (d *DB) MultiGet(keys [][]byte) ([][]byte, error) {
+	return d.multiGetInternal(keys, nil /* snapshot */)
+}
+
+func (d *DB) multiGetInternal(keys [][]byte, s *Snapshot) ([][]byte, error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	var internalOpts newIterOpts
+	if s != nil {
+		internalOpts.snapshot.seqNum = s.seqNum
+	}
+	iter := d.newIter(context.Background(), nil /* batch */, internalOpts, nil /* opts */)
+
+	// Seeking in ascending key order allows each seek to move the iterator
+	// forward from its current position (see TrySeekUsingNext), rather than
+	// seeking from scratch in each level.
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return d.cmp(keys[a], keys[b])
+	})
+
+	// The values are copied into a single buffer. Since the buffer may be
+	// reallocated as it grows, the offsets of each value are recorded and the
+	// returned slices are constructed at the end.
+	type span struct {
+		start, end int
+		found      bool
+	}
+	spans := make([]span, len(keys))
+	var buf []byte
+	for j, idx := range order {
+		key := keys[idx]
+		if j > 0 && d.equal(key, keys[order[j-1]]) {
+			spans[idx] = spans[order[j-1]]
+			continue
+		}
+		if !iter.SeekPrefixGE(key) || !d.equal(iter.Key(), key) {
+			if err := iter.Error(); err != nil {
+				return nil, errors.CombineErrors(err, iter.Close())
+			}
+			continue
+		}
+		value, err := iter.ValueAndErr()
+		if err != nil {
+			return nil, errors.CombineErrors(err, iter.Close())
+		}
+		spans[idx] = span{start: len(buf), end: len(buf) + len(value), found: true}
+		buf = append(buf, value...)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	values := make([][]byte, len(keys))
+	for i := range spans {
+		if !spans[i].found {
+			continue
+		}
+		values[i] = buf[spans[i].start:spans[i].end:spans[i].end]
+		if values[i] == nil {
+			// buf is nil if all of the values found are empty.
+			values[i] = []byte{}
+		}
+	}
+	return values, nil
+}
+
 // Set sets the value for the given key. It overwrites any previous value
 // for that key; a DB is not a multi-map.
 //
@@ -771,7 +959,13 @@ func (d *DB) RangeKeyDelete(start, end []byte, opts *WriteOptions) error {
 //
 // Apply returns ErrInvalidBatch if the provided batch is invalid in any way.
 func (d *DB) Apply(batch *Batch, opts *WriteOptions) error {
-	return d.applyInternal(batch, opts, false)
+	return d.ApplyWithContext(context.Background(), batch, opts)
+}
+
+// ApplyWithContext is like Apply, and additionally accepts a context for
+// tracing.
+func (d *DB) ApplyWithContext(ctx context.Context, batch *Batch, opts *WriteOptions) error {
+	return d.applyInternal(ctx, batch, opts, false)
 }
 
 // ApplyNoSyncWait must only be used when opts.Sync is true and the caller
@@ -790,11 +984,129 @@ func (d *DB) ApplyNoSyncWait(batch *Batch, opts *WriteOptions) error {
 	if !opts.Sync {
 		return errors.Errorf("cannot request asynchonous apply when WriteOptions.Sync is false")
 	}
-	return d.applyInternal(batch, opts, true)
+	return d.applyInternal(context.Background(), batch, opts, true)
+}
+
+// CommitHandle is returned by DB.ApplyAsync, and tracks the durability of
+// the committed batch.
+type CommitHandle struct {
+	batch *Batch
+	// doneOnce starts the goroutine closing done, the first time Done is
+	// called.
+	doneOnce sync.Once
+	done     chan struct{}
+	// waitOnce waits for the WAL fsync of the batch, and records its error.
+	waitOnce sync.Once
+	err      error
+}
+
+// Done returns a channel that's closed once the batch is durable, or failed
+// to be made durable, after which Err returns the error of the WAL fsync.
+func (h *CommitHandle) Done() <-chan struct{} {
+	h.doneOnce.Do(func() {
+		// The goroutine is only started if Done is called, so that callers
+		// awaiting the commits in bulk with Err don't pay for it.
+		go func() {
+			h.wait()
+			close(h.done)
+		}()
+	})
+	return h.done
+}
+
+// Err waits for the batch to be durable, and returns the error of the WAL
+// fsync, if any. The batch may be closed once Err returns.
+func (h *CommitHandle) Err() error {
+	h.wait()
+	return h.err
+}
+
+func (h *CommitHandle) wait() {
+	h.waitOnce.Do(func() {
+		h.err = h.batch.SyncWait()
+	})
+}
+
+// ApplyAsync applies the batch to the DB like Apply, but doesn't wait for the
+// WAL fsync requested by opts.Sync: it returns once the mutations of the batch
+// are visible, with a handle to await the durability of the batch. This lets a
+// caller pipeline many commits from a single goroutine, and await their
+// durability in bulk, while the commits still share WAL syncs. If opts.Sync is
+// false, the returned handle is already done.
+//
+// The caller must not Close the batch before Err returns or the channel
+// returned by Done is closed.
+//
+// ApplyAsync returns an error, and no handle, if the batch fails to be
+// applied.
+func (d *DB) ApplyAsync(batch *Batch, opts *WriteOptions) (*CommitHandle, error) {
+	if err := d.applyInternal(context.Background(), batch, opts, opts.GetSync()); err != nil {
+		return nil, err
+	}
+	return &CommitHandle{batch: batch, done: make(chan struct{})}, nil
+}
+
+// ApplyAll atomically applies the operations contained in the batches to the
+// DB. The batches are committed as a single batch, through a single write to
+// the WAL, and are assigned a contiguous block of sequence numbers in the order
+// in which they're specified: once ApplyAll returns, the SeqNum of each batch
+// is the sequence number of its first record. The LogData records of each
+// batch are written to the WAL in place, so readers of the WAL, such as
+// replication followers, observe the boundaries between the batches.
+//
+// The batches must not be applied again, and must be closed by the caller.
+// The Options.BatchCommitHook, if set, is invoked once, for the combined batch.
+//
+// It is safe to modify the contents of the batches after ApplyAll returns.
+func (d *DB) ApplyAll(batches []*Batch, opts *WriteOptions) error {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	size := batchrepr.HeaderLen
+	for _, b := range batches {
+		if b.committing {
+			panic("pebble: batch already committing")
+		}
+		if b.applied.Load() {
+			panic("pebble: batch already applied")
+		}
+		if b.db != nil && b.db != d {
+			panic(fmt.Sprintf("pebble: batch db mismatch: %p != %p", b.db, d))
+		}
+		size += max(len(b.data)-batchrepr.HeaderLen, 0)
+	}
+	combined := newBatchWithSize(d, size)
+	defer combined.Close()
+	for _, b := range batches {
+		if err := combined.Apply(b, nil); err != nil {
+			return err
+		}
+		combined.minimumFormatMajorVersion = max(combined.minimumFormatMajorVersion, b.minimumFormatMajorVersion)
+	}
+	if err := d.applyInternal(context.Background(), combined, opts, false); err != nil {
+		return err
+	}
+	// The contents of a large batch are cleared once committed, so its sequence
+	// number is read from its flushable batch.
+	seqNum := combined.SeqNum()
+	if combined.flushable != nil {
+		seqNum = combined.flushable.seqNum
+	}
+	for _, b := range batches {
+		if len(b.data) == 0 {
+			b.init(batchrepr.HeaderLen)
+		}
+		b.setSeqNum(seqNum)
+		b.applied.Store(true)
+		seqNum += uint64(b.Count())
+	}
+	return nil
 }
 
 // REQUIRES: noSyncWait => opts.Sync
-func (d *DB) applyInternal(batch *Batch, opts *WriteOptions, noSyncWait bool) error {
+func (d *DB) applyInternal(
+	ctx context.Context, batch *Batch, opts *WriteOptions, noSyncWait bool,
+) (err error) {
 	if err := d.closed.Load(); err != nil {
 		panic(err)
 	}
@@ -807,9 +1119,36 @@ func (d *DB) applyInternal(batch *Batch, opts *WriteOptions, noSyncWait bool) er
 	if d.opts.ReadOnly {
 		return ErrReadOnly
 	}
+	if err := d.checkLowDiskSpace(); err != nil {
+		return err
+	}
 	if batch.db != nil && batch.db != d {
 		panic(fmt.Sprintf("pebble: batch db mismatch: %p != %p", batch.db, d))
 	}
+	var bytesWritten uint64
+	if t := d.opts.Tracer; t != nil {
+		_, span := t.StartSpan(ctx, TraceOpCommit)
+		defer func() {
+			span.Finish(TraceInfo{BytesWritten: bytesWritten, Err: err})
+		}()
+	}
+	// Invoke the commit hook before validating the batch, since the hook may
+	// add mutations that affect the validation (eg, range keys).
+	if hook := d.opts.BatchCommitHook; hook != nil && !batch.Empty() {
+		if err := hook(batch); err != nil {
+			return err
+		}
+	}
+
+	if a := d.opts.WriteAdmission; a != nil && !batch.Empty() {
+		info, err := makeWriteAdmissionInfo(batch, d.cmp)
+		if err != nil {
+			return err
+		}
+		if err := a.Admit(ctx, info); err != nil {
+			return err
+		}
+	}
 
 	sync := opts.GetSync()
 	if sync && d.opts.DisableWAL {
@@ -842,7 +1181,16 @@ func (d *DB) applyInternal(batch *Batch, opts *WriteOptions, noSyncWait bool) er
 			return err
 		}
 	}
+	bytesWritten = uint64(len(batch.data))
+	d.hotKeys.sampleBatch(batch)
 	if err := d.commit.Commit(batch, sync, noSyncWait); err != nil {
+		if errors.Is(err, errBatchNotCommitted) {
+			// The batch's preconditions weren't satisfied, or couldn't be
+			// checked. The batch wasn't committed, and may be committed again.
+			batch.committing = false
+			batch.flushable = nil
+			return err
+		}
 		// There isn't much we can do on an error here. The commit pipeline will be
 		// horked at this point.
 		d.opts.Logger.Fatalf("pebble: fatal commit error: %v", err)
@@ -913,10 +1261,11 @@ func (d *DB) commitWrite(b *Batch, syncWG *sync.WaitGroup, syncErr *error) (*mem
 		b.flushable.setSeqNum(b.SeqNum())
 		if !d.opts.DisableWAL {
 			var err error
-			size, err = d.mu.log.writer.WriteRecord(repr, wal.SyncOptions{Done: syncWG, Err: syncErr}, b.refData)
+			size, err = d.writeWALRecord(b, repr, syncWG, syncErr)
 			if err != nil {
 				panic(err)
 			}
+			d.notePreparedOp(b)
 		}
 	}
 
@@ -951,16 +1300,33 @@ func (d *DB) commitWrite(b *Batch, syncWG *sync.WaitGroup, syncErr *error) (*mem
 	}
 
 	if b.flushable == nil {
-		size, err = d.mu.log.writer.WriteRecord(repr, wal.SyncOptions{Done: syncWG, Err: syncErr}, b.refData)
+		size, err = d.writeWALRecord(b, repr, syncWG, syncErr)
 		if err != nil {
 			panic(err)
 		}
+		d.notePreparedOp(b)
 	}
 
 	d.logSize.Store(uint64(size))
 	return mem, err
 }
 
+// writeWALRecord writes the batch's representation to the WAL, compressing it
+// if Options.WALCompression is set and the format major version permits it.
+func (d *DB) writeWALRecord(
+	b *Batch, repr []byte, syncWG *sync.WaitGroup, syncErr *error,
+) (logicalOffset int64, err error) {
+	if c := d.opts.walCompression(); c != batchrepr.NoCompression &&
+		d.FormatMajorVersion() >= FormatWALCompression {
+		if compressed, ok := batchrepr.Compress(nil, repr, c); ok {
+			// The compressed record is never reused, so the WAL writer may
+			// retain it without a reference.
+			return d.mu.log.writer.WriteRecord(compressed, wal.SyncOptions{Done: syncWG, Err: syncErr}, nil /* ref */)
+		}
+	}
+	return d.mu.log.writer.WriteRecord(repr, wal.SyncOptions{Done: syncWG, Err: syncErr}, b.refData)
+}
+
 type iterAlloc struct {
 	dbi                 Iterator
 	keyBuf              []byte
@@ -1091,6 +1457,15 @@ func (d *DB) newIter(
 	if batch != nil {
 		dbi.batchSeqNum = dbi.batch.nextSeqNum()
 	}
+	if d.iterTracker != nil && (readState != nil || dbi.version != nil) {
+		d.iterTracker.track(dbi)
+	}
+	if !dbi.batchOnlyIter {
+		dbi.hotKeys = d.hotKeys
+	}
+	if d.opts.Tracer != nil && !dbi.batchOnlyIter {
+		ctx = dbi.startTraceSpan(d.opts.Tracer)
+	}
 	return finishInitializingIter(ctx, buf)
 }
 
@@ -1456,7 +1831,11 @@ func (i *Iterator) constructPointIter(
 		addLevelIterForFiles := func(files manifest.LevelIterator, level manifest.Level) {
 			li := &levels[levelsIndex]
 
-			li.init(ctx, i.opts, &i.comparer, i.newIters, files, level, internalOpts)
+			// Attribute the stats of the tables to their level. See
+			// Iterator.Stats.
+			levelOpts := internalOpts
+			levelOpts.stats = &i.levelStats[manifest.LevelToInt(level)]
+			li.init(ctx, i.opts, &i.comparer, i.newIters, files, level, levelOpts)
 			li.initRangeDel(&mlevels[mlevelsIndex].rangeDelIter)
 			li.initBoundaryContext(&mlevels[mlevelsIndex].levelIterBoundaryContext)
 			li.initCombinedIterState(&i.lazyCombinedIter.combinedIterState)
@@ -1612,6 +1991,14 @@ func (d *DB) Close() error {
 
 	defer d.opts.Cache.Unref()
 
+	// Queued low-priority compactions will never be scheduled; fail them so
+	// that their DB.CompactRange callers are notified.
+	for _, manual := range d.mu.compact.lowPriorityManual {
+		manual.done <- ErrClosed
+	}
+	d.mu.compact.lowPriorityManual = nil
+	d.preemptLowPriorityCompactionsLocked()
+
 	for d.mu.compact.compactingCount > 0 || d.mu.compact.downloadingCount > 0 || d.mu.compact.flushing {
 		d.mu.compact.cond.Wait()
 	}
@@ -1621,6 +2008,11 @@ func (d *DB) Close() error {
 	for d.mu.tableValidation.validating {
 		d.mu.tableValidation.cond.Wait()
 	}
+	for d.mu.blockPinning.running {
+		d.mu.blockPinning.cond.Wait()
+	}
+	// Wake up the PinTables callers waiting for a pass that won't run.
+	d.mu.blockPinning.cond.Broadcast()
 
 	var err error
 	if n := len(d.mu.compact.inProgress); n > 0 {
@@ -1628,6 +2020,7 @@ func (d *DB) Close() error {
 	}
 	err = firstError(err, d.mu.formatVers.marker.Close())
 	err = firstError(err, d.tableCache.close())
+	err = firstError(err, d.blobFiles.close())
 	if !d.opts.ReadOnly {
 		if d.mu.log.writer != nil {
 			_, err2 := d.mu.log.writer.Close()
@@ -1637,7 +2030,12 @@ func (d *DB) Close() error {
 		panic("pebble: log-writer should be nil in read-only mode")
 	}
 	err = firstError(err, d.mu.log.manager.Close())
-	err = firstError(err, d.fileLock.Close())
+	if d.eventLog != nil {
+		err = firstError(err, d.eventLog.close())
+	}
+	if d.fileLock != nil {
+		err = firstError(err, d.fileLock.Close())
+	}
 
 	// Note that versionSet.close() only closes the MANIFEST. The versions list
 	// is still valid for the checks below.
@@ -1647,6 +2045,11 @@ func (d *DB) Close() error {
 
 	d.readState.val.unrefLocked()
 
+	// If iterators are tracked, report the creation stacks of any leaked
+	// iterators.
+	if d.iterTracker != nil {
+		err = firstError(err, d.iterTracker.leakedErr())
+	}
 	current := d.mu.versions.currentVersion()
 	for v := d.mu.versions.versions.Front(); true; v = v.Next() {
 		refs := v.Refs()
@@ -1678,7 +2081,7 @@ func (d *DB) Close() error {
 
 	// Since we called d.readState.val.unrefLocked() above, we are expected to
 	// manually schedule deletion of obsolete files.
-	if len(d.mu.versions.obsoleteTables) > 0 {
+	if len(d.mu.versions.obsoleteTables) > 0 || len(d.mu.versions.obsoleteBlobFiles) > 0 {
 		d.deleteObsoleteFiles(d.newJobIDLocked())
 	}
 
@@ -1720,11 +2123,93 @@ func (d *DB) Close() error {
 	return err
 }
 
+// CompactionPriority is the priority of a manual compaction scheduled through
+// DB.CompactRange.
+type CompactionPriority int8
+
+const (
+	// CompactionPriorityNormal compactions are scheduled ahead of automatic
+	// compactions, like those performed by DB.Compact.
+	CompactionPriorityNormal CompactionPriority = iota
+	// CompactionPriorityLow compactions only run while no flush or other
+	// compaction is running, and are preempted (and later retried) as soon as
+	// one needs to run. At most one low-priority compaction runs at a time, and
+	// it does not count against Options.MaxConcurrentCompactions.
+	CompactionPriorityLow
+)
+
+// String implements fmt.Stringer.
+func (p CompactionPriority) String() string {
+	switch p {
+	case CompactionPriorityNormal:
+		return "normal"
+	case CompactionPriorityLow:
+		return "low"
+	default:
+		return fmt.Sprintf("CompactionPriority(%d)", int8(p))
+	}
+}
+
+// CompactRangeOptions configures a manual compaction scheduled through
+// DB.CompactRange.
+type CompactRangeOptions struct {
+	// Priority is the priority of the compactions of the range.
+	Priority CompactionPriority
+	// LimitBytesPerSecond limits the rate at which the compactions write output
+	// bytes. A value of 0 indicates that there is no limit. Flushes of
+	// memtables overlapping the range are never rate limited.
+	LimitBytesPerSecond int64
+	// Parallelize, if true, splits the compaction of each level into
+	// compactions of non-overlapping key ranges which can run concurrently.
+	// Low-priority compactions never run concurrently.
+	Parallelize bool
+}
+
 // Compact the specified range of keys in the database.
 func (d *DB) Compact(start, end []byte, parallelize bool) error {
 	if err := d.closed.Load(); err != nil {
 		panic(err)
 	}
+	if err := d.validateCompactRange(start, end); err != nil {
+		return err
+	}
+	return d.compactRange(context.Background(), start, end, CompactRangeOptions{
+		Parallelize: parallelize,
+	})
+}
+
+// CompactRange schedules a compaction of the specified range of keys in the
+// database and returns without waiting for it. The returned channel receives
+// exactly one value once the compaction completes: nil on success, or the
+// error that caused it to fail. If ctx is cancelled, any compactions of the
+// range that have not yet started are abandoned and the context's error is
+// returned.
+//
+// Unlike Compact, CompactRange can run at a low priority and with a limited
+// write rate, which makes it suitable for reclaiming space (e.g. from range
+// deletions) without hurting the latency of foreground operations. See
+// CompactRangeOptions.
+func (d *DB) CompactRange(
+	ctx context.Context, start, end []byte, opts CompactRangeOptions,
+) <-chan error {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	done := make(chan error, 1)
+	if err := d.validateCompactRange(start, end); err != nil {
+		done <- err
+		return done
+	}
+	// The caller may reuse the key buffers once we return.
+	start = slices.Clone(start)
+	end = slices.Clone(end)
+	go func() {
+		done <- d.compactRange(ctx, start, end, opts)
+	}()
+	return done
+}
+
+func (d *DB) validateCompactRange(start, end []byte) error {
 	if d.opts.ReadOnly {
 		return ErrReadOnly
 	}
@@ -1732,6 +2217,14 @@ func (d *DB) Compact(start, end []byte, parallelize bool) error {
 		return errors.Errorf("Compact start %s is not less than end %s",
 			d.opts.Comparer.FormatKey(start), d.opts.Comparer.FormatKey(end))
 	}
+	return nil
+}
+
+func (d *DB) compactRange(ctx context.Context, start, end []byte, opts CompactRangeOptions) error {
+	var limiter *compactionRateLimiter
+	if opts.LimitBytesPerSecond > 0 {
+		limiter = newCompactionRateLimiter(ctx, opts.LimitBytesPerSecond)
+	}
 
 	d.mu.Lock()
 	maxLevelWithFiles := 1
@@ -1792,8 +2285,13 @@ func (d *DB) Compact(start, end []byte, parallelize bool) error {
 
 	for level := 0; level < maxLevelWithFiles; {
 		for {
-			if err := d.manualCompact(
-				start, end, level, parallelize); err != nil {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if d.closed.Load() != nil {
+				return ErrClosed
+			}
+			if err := d.manualCompact(ctx, start, end, level, opts, limiter); err != nil {
 				if errors.Is(err, ErrCancelledCompaction) {
 					continue
 				}
@@ -1811,7 +2309,13 @@ func (d *DB) Compact(start, end []byte, parallelize bool) error {
 	return nil
 }
 
-func (d *DB) manualCompact(start, end []byte, level int, parallelize bool) error {
+func (d *DB) manualCompact(
+	ctx context.Context,
+	start, end []byte,
+	level int,
+	opts CompactRangeOptions,
+	limiter *compactionRateLimiter,
+) error {
 	d.mu.Lock()
 	curr := d.mu.versions.currentVersion()
 	files := curr.Overlaps(level, base.UserKeyBoundsInclusive(start, end))
@@ -1821,7 +2325,7 @@ func (d *DB) manualCompact(start, end []byte, level int, parallelize bool) error
 	}
 
 	var compactions []*manualCompaction
-	if parallelize {
+	if opts.Parallelize {
 		compactions = append(compactions, d.splitManualCompaction(start, end, level)...)
 	} else {
 		compactions = append(compactions, &manualCompaction{
@@ -1831,7 +2335,17 @@ func (d *DB) manualCompact(start, end []byte, level int, parallelize bool) error
 			end:   end,
 		})
 	}
-	d.mu.compact.manual = append(d.mu.compact.manual, compactions...)
+	lowPriority := opts.Priority == CompactionPriorityLow
+	for _, c := range compactions {
+		c.ctx = ctx
+		c.lowPriority = lowPriority
+		c.limiter = limiter
+	}
+	if lowPriority {
+		d.mu.compact.lowPriorityManual = append(d.mu.compact.lowPriorityManual, compactions...)
+	} else {
+		d.mu.compact.manual = append(d.mu.compact.manual, compactions...)
+	}
 	d.maybeScheduleCompaction()
 	d.mu.Unlock()
 
@@ -2111,7 +2625,11 @@ func (d *DB) Metrics() *Metrics {
 	}
 	metrics.Snapshots.PinnedKeys = d.mu.snapshots.cumulativePinnedCount
 	metrics.Snapshots.PinnedSize = d.mu.snapshots.cumulativePinnedSize
+	metrics.History.Horizon = d.mu.history.horizon
+	metrics.History.PinnedKeys = d.mu.history.cumulativePinnedCount
+	metrics.History.PinnedSize = d.mu.history.cumulativePinnedSize
 	metrics.MemTable.Count = int64(len(d.mu.mem.queue))
+	metrics.MemTable.TargetSize = d.memTableTargetSize.Load()
 	metrics.MemTable.ZombieCount = d.memTableCount.Load() - metrics.MemTable.Count
 	metrics.MemTable.ZombieSize = uint64(d.memTableReserved.Load()) - metrics.MemTable.Size
 	metrics.WAL.ObsoleteFiles = int64(walStats.ObsoleteFileCount)
@@ -2138,7 +2656,16 @@ func (d *DB) Metrics() *Metrics {
 			metrics.Levels[level].Score = score
 		}
 	}
+	metrics.Table.PinnedBlocksCount = int64(d.mu.blockPinning.count)
+	metrics.Table.PinnedBlocksSize = d.mu.blockPinning.size
 	metrics.Table.ZombieCount = int64(len(d.mu.versions.zombieTables))
+	d.quarantine.mu.Lock()
+	metrics.Corruption.QuarantinedTables = len(d.quarantine.mu.blocks)
+	for _, blocks := range d.quarantine.mu.blocks {
+		metrics.Corruption.QuarantinedBlocks += len(blocks)
+	}
+	metrics.Corruption.RecoveredCount = d.quarantine.mu.recoveredCount
+	d.quarantine.mu.Unlock()
 	for _, info := range d.mu.versions.zombieTables {
 		metrics.Table.ZombieSize += info.FileSize
 		if info.isLocal {
@@ -2168,6 +2695,7 @@ func (d *DB) Metrics() *Metrics {
 	}
 	for i := 0; i < numLevels; i++ {
 		metrics.Levels[i].Additional.ValueBlocksSize = valueBlocksSizeForLevel(vers, i)
+		sizeHistogramsForLevel(vers, i, &metrics.Levels[i])
 	}
 
 	d.mu.Unlock()
@@ -2180,6 +2708,7 @@ func (d *DB) Metrics() *Metrics {
 	metrics.SecondaryCacheMetrics = d.objProvider.Metrics()
 
 	metrics.Uptime = d.timeNow().Sub(d.openedAt)
+	metrics.RateLimit = d.rateLimiter.metrics()
 
 	return metrics
 }
@@ -2268,6 +2797,9 @@ type SSTableInfo struct {
 	// Properties is the sstable properties of this table. If Virtual is true,
 	// then the Properties are associated with the backing sst.
 	Properties *sstable.Properties
+	// TableFormat is the format of this table, or of the backing sst if Virtual
+	// is true. Like Properties, it's only set by the WithProperties option.
+	TableFormat sstable.TableFormat
 }
 
 // SSTables retrieves the current sstables. The returned slice is indexed by
@@ -2315,13 +2847,13 @@ func (d *DB) SSTables(opts ...SSTablesOption) ([][]SSTableInfo, error) {
 			}
 			destTables[j] = SSTableInfo{TableInfo: m.TableInfo()}
 			if opt.withProperties {
-				p, err := d.tableCache.getTableProperties(
-					m,
-				)
-				if err != nil {
+				if err := d.tableCache.withBackingReader(m, func(r *sstable.Reader) (err error) {
+					destTables[j].Properties = &r.Properties
+					destTables[j].TableFormat, err = r.TableFormat()
+					return err
+				}); err != nil {
 					return nil, err
 				}
-				destTables[j].Properties = p
 			}
 			destTables[j].Virtual = m.Virtual
 			destTables[j].BackingSSTNum = m.FileBacking.DiskFileNum
@@ -2410,6 +2942,7 @@ func (d *DB) EstimateDiskUsageByBackingType(
 	readState := d.loadReadState()
 	defer readState.unref()
 
+	var u diskUsageByBackingType
 	for level, files := range readState.current.Levels {
 		iter := files.Iter()
 		if level > 0 {
@@ -2424,56 +2957,44 @@ func (d *DB) EstimateDiskUsageByBackingType(
 				d.opts.Comparer.Compare(file.Largest.UserKey, end) <= 0 {
 				// The range fully contains the file, so skip looking it up in
 				// table cache/looking at its indexes, and add the full file size.
-				meta, err := d.objProvider.Lookup(fileTypeTable, file.FileBacking.DiskFileNum)
-				if err != nil {
+				if err := u.add(d, file, file.Size); err != nil {
 					return 0, 0, 0, err
 				}
-				if meta.IsRemote() {
-					remoteSize += file.Size
-					if meta.Remote.CleanupMethod == objstorage.SharedNoCleanup {
-						externalSize += file.Size
-					}
-				}
-				totalSize += file.Size
 			} else if d.opts.Comparer.Compare(file.Smallest.UserKey, end) <= 0 &&
 				d.opts.Comparer.Compare(start, file.Largest.UserKey) <= 0 {
-				var size uint64
-				var err error
-				if file.Virtual {
-					err = d.tableCache.withVirtualReader(
-						file.VirtualMeta(),
-						func(r sstable.VirtualReader) (err error) {
-							size, err = r.EstimateDiskUsage(start, end)
-							return err
-						},
-					)
-				} else {
-					err = d.tableCache.withReader(
-						file.PhysicalMeta(),
-						func(r *sstable.Reader) (err error) {
-							size, err = r.EstimateDiskUsage(start, end)
-							return err
-						},
-					)
-				}
+				size, err := d.tableCache.estimateSize(file, start, end)
 				if err != nil {
 					return 0, 0, 0, err
 				}
-				meta, err := d.objProvider.Lookup(fileTypeTable, file.FileBacking.DiskFileNum)
-				if err != nil {
+				if err := u.add(d, file, size); err != nil {
 					return 0, 0, 0, err
 				}
-				if meta.IsRemote() {
-					remoteSize += size
-					if meta.Remote.CleanupMethod == objstorage.SharedNoCleanup {
-						externalSize += size
-					}
-				}
-				totalSize += size
 			}
 		}
 	}
-	return totalSize, remoteSize, externalSize, nil
+	return u.total, u.remote, u.external, nil
+}
+
+// diskUsageByBackingType accumulates the disk usage of sstables, tracking the
+// subsets of it in remote and external files.
+type diskUsageByBackingType struct {
+	total, remote, external uint64
+}
+
+// add adds size bytes of the file to the disk usage.
+func (u *diskUsageByBackingType) add(d *DB, file *fileMetadata, size uint64) error {
+	meta, err := d.objProvider.Lookup(fileTypeTable, file.FileBacking.DiskFileNum)
+	if err != nil {
+		return err
+	}
+	if meta.IsRemote() {
+		u.remote += size
+		if meta.Remote.CleanupMethod == objstorage.SharedNoCleanup {
+			u.external += size
+		}
+	}
+	u.total += size
+	return nil
 }
 
 func (d *DB) walPreallocateSize() int {
@@ -2485,17 +3006,17 @@ func (d *DB) walPreallocateSize() int {
 	// TODO(peter): 110% of the memtable size is quite hefty for a block
 	// size. This logic is taken from GetWalPreallocateBlockSize in
 	// RocksDB. Could a smaller preallocation block size be used?
-	size := d.opts.MemTableSize
+	size := d.memTableTargetSize.Load()
 	size = (size / 10) + size
 	return int(size)
 }
 
 func (d *DB) newMemTable(logNum base.DiskFileNum, logSeqNum uint64) (*memTable, *flushableEntry) {
 	size := d.mu.mem.nextSize
-	if d.mu.mem.nextSize < d.opts.MemTableSize {
+	if targetSize := d.memTableTargetSize.Load(); d.mu.mem.nextSize < targetSize {
 		d.mu.mem.nextSize *= 2
-		if d.mu.mem.nextSize > d.opts.MemTableSize {
-			d.mu.mem.nextSize = d.opts.MemTableSize
+		if d.mu.mem.nextSize > targetSize {
+			d.mu.mem.nextSize = targetSize
 		}
 	}
 
@@ -2592,19 +3113,37 @@ func (d *DB) makeRoomForWrite(b *Batch) error {
 
 	force := b == nil || b.flushable != nil
 	stalled := false
+	var stallCause WriteStallCause
+	var stallStart time.Time
+	stallBegin := func(cause WriteStallCause) {
+		if !stalled {
+			stalled = true
+			stallCause = cause
+			stallStart = time.Now()
+			d.opts.EventListener.WriteStallBegin(WriteStallBeginInfo{
+				Reason: cause.String(),
+				Cause:  cause,
+			})
+		}
+	}
+	stallEnd := func() {
+		if stalled {
+			d.opts.EventListener.WriteStallEnd()
+			d.opts.EventListener.WriteStallEndWithInfo(WriteStallEndInfo{
+				Cause:    stallCause,
+				Duration: time.Since(stallStart),
+			})
+		}
+	}
 	for {
 		if b != nil && b.flushable == nil {
 			err := d.mu.mem.mutable.prepare(b)
 			if err != arenaskl.ErrArenaFull {
-				if stalled {
-					d.opts.EventListener.WriteStallEnd()
-				}
+				stallEnd()
 				return err
 			}
 		} else if !force {
-			if stalled {
-				d.opts.EventListener.WriteStallEnd()
-			}
+			stallEnd()
 			return nil
 		}
 		// force || err == ErrArenaFull, so we need to rotate the current memtable.
@@ -2622,16 +3161,18 @@ func (d *DB) makeRoomForWrite(b *Batch) error {
 			// primary will go unnoticed until the OOM -- CockroachDB is monitoring
 			// disk stalls, and we expect it to fail the node after ~60s if the
 			// primary is stalled.
-			if size >= uint64(d.opts.MemTableStopWritesThreshold)*d.opts.MemTableSize &&
+			if size >= uint64(d.opts.MemTableStopWritesThreshold)*d.memTableTargetSize.Load() &&
 				!d.mu.log.manager.ElevateWriteStallThresholdForFailover() {
+				if err := d.mu.prepared.relogErr; err != nil {
+					// The queued memtables can't be flushed until the prepared
+					// batches are rewritten to a new WAL, which requires room
+					// for a new memtable, so waiting for them would never end.
+					stallEnd()
+					return err
+				}
 				// We have filled up the current memtable, but already queued memtables
 				// are still flushing, so we wait.
-				if !stalled {
-					stalled = true
-					d.opts.EventListener.WriteStallBegin(WriteStallBeginInfo{
-						Reason: "memtable count limit reached",
-					})
-				}
+				stallBegin(WriteStallMemTableCount)
 				now := time.Now()
 				d.mu.compact.cond.Wait()
 				if b != nil {
@@ -2643,12 +3184,7 @@ func (d *DB) makeRoomForWrite(b *Batch) error {
 		l0ReadAmp := d.mu.versions.currentVersion().L0Sublevels.ReadAmplification()
 		if l0ReadAmp >= d.opts.L0StopWritesThreshold {
 			// There are too many level-0 files, so we wait.
-			if !stalled {
-				stalled = true
-				d.opts.EventListener.WriteStallBegin(WriteStallBeginInfo{
-					Reason: "L0 file count limit exceeded",
-				})
-			}
+			stallBegin(WriteStallL0FileCount)
 			now := time.Now()
 			d.mu.compact.cond.Wait()
 			if b != nil {
@@ -2657,11 +3193,25 @@ func (d *DB) makeRoomForWrite(b *Batch) error {
 			continue
 		}
 
+		var logSeqNum uint64
+		if b != nil {
+			logSeqNum = b.SeqNum()
+			if b.flushable != nil {
+				logSeqNum += uint64(b.Count())
+			}
+		} else {
+			logSeqNum = d.mu.versions.logSeqNum.Load()
+		}
+
 		var newLogNum base.DiskFileNum
 		var prevLogSize uint64
+		var relogErr error
 		if !d.opts.DisableWAL {
 			now := time.Now()
+			prevLogNum := d.mu.mem.queue[len(d.mu.mem.queue)-1].logNum
 			newLogNum, prevLogSize = d.recycleWAL()
+			relogErr = d.relogPreparedLocked(logSeqNum)
+			d.notePreparedRelogLocked(relogErr, prevLogNum)
 			if b != nil {
 				b.commitStats.WALRotationDuration += time.Since(now)
 			}
@@ -2697,18 +3247,19 @@ func (d *DB) makeRoomForWrite(b *Batch) error {
 			// for it until it is flushed.
 			entry.releaseMemAccounting = d.opts.Cache.Reserve(int(b.flushable.totalBytes()))
 			d.mu.mem.queue = append(d.mu.mem.queue, entry)
+		} else if b != nil && d.opts.AdaptiveMemTable.MaxSize > 0 {
+			// The memtable filled up.
+			d.adaptMemTableSizeLocked()
 		}
 
-		var logSeqNum uint64
-		if b != nil {
-			logSeqNum = b.SeqNum()
-			if b.flushable != nil {
-				logSeqNum += uint64(b.Count())
-			}
-		} else {
-			logSeqNum = d.mu.versions.logSeqNum.Load()
-		}
 		d.rotateMemtable(newLogNum, logSeqNum, immMem)
+		if relogErr != nil && b == nil {
+			// The rotated memtable can't be flushed until the prepared batches
+			// are rewritten to a later WAL, so a manual flush fails. A batch is
+			// written regardless, and the next rotation retries the rewrite.
+			stallEnd()
+			return relogErr
+		}
 		force = false
 	}
 }
@@ -19,9 +19,12 @@ import (
 
 	"github.com/cockroachdb/datadriven"
 	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/batchrepr"
+	"github.com/cockroachdb/pebble/bloom"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/cache"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/record"
 	"github.com/cockroachdb/pebble/sstable"
 	"github.com/cockroachdb/pebble/vfs"
 	"github.com/cockroachdb/pebble/vfs/errorfs"
@@ -485,6 +488,129 @@ func TestGetMerge(t *testing.T) {
 	require.NoError(t, d.Close())
 }
 
+func TestMultiGet(t *testing.T) {
+	d, err := Open("", testingRandomized(t, &Options{
+		FS: vfs.NewMem(),
+	}))
+	require.NoError(t, err)
+	defer d.Close()
+
+	rng := rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
+	key := func(i int) []byte { return []byte(fmt.Sprintf("%04d", i)) }
+	for i := 0; i < 1000; i++ {
+		switch rng.Intn(4) {
+		case 0:
+			require.NoError(t, d.Set(key(rng.Intn(500)), []byte(fmt.Sprint(i)), nil))
+		case 1:
+			require.NoError(t, d.Delete(key(rng.Intn(500)), nil))
+		case 2:
+			require.NoError(t, d.Merge(key(rng.Intn(500)), []byte(fmt.Sprint(i)), nil))
+		case 3:
+			require.NoError(t, d.Set(key(rng.Intn(500)), nil, nil))
+		}
+		if i%250 == 0 {
+			require.NoError(t, d.Flush())
+		}
+	}
+	snap := d.NewSnapshot()
+	defer snap.Close()
+	require.NoError(t, d.DeleteRange(key(100), key(200), nil))
+
+	// MultiGet must return the same results as Get, for keys in any order and
+	// including duplicates.
+	check := func(r Reader, multiGet func([][]byte) ([][]byte, error)) {
+		keys := make([][]byte, 200)
+		for i := range keys {
+			keys[i] = key(rng.Intn(600))
+		}
+		values, err := multiGet(keys)
+		require.NoError(t, err)
+		require.Len(t, values, len(keys))
+		for i, k := range keys {
+			v, closer, err := r.Get(k)
+			if errors.Is(err, ErrNotFound) {
+				require.Nil(t, values[i], "key %s", k)
+				continue
+			}
+			require.NoError(t, err)
+			require.NotNil(t, values[i], "key %s", k)
+			require.Equal(t, string(v), string(values[i]), "key %s", k)
+			require.NoError(t, closer.Close())
+		}
+	}
+	for i := 0; i < 10; i++ {
+		check(d, d.MultiGet)
+		check(snap, snap.MultiGet)
+	}
+
+	values, err := d.MultiGet(nil)
+	require.NoError(t, err)
+	require.Empty(t, values)
+}
+
+func TestBatchCommitHook(t *testing.T) {
+	// The hook maintains an index from value to key for keys with the prefix
+	// "k/", and rejects any batch that sets the key "invalid".
+	errInvalid := errors.New("invalid key")
+	var calls int
+	hook := func(b *Batch) error {
+		calls++
+		for r := b.Reader(); ; {
+			kind, ukey, value, ok, err := r.Next()
+			if err != nil {
+				return err
+			} else if !ok {
+				return nil
+			}
+			if string(ukey) == "invalid" {
+				return errInvalid
+			}
+			if kind == InternalKeyKindSet && bytes.HasPrefix(ukey, []byte("k/")) {
+				idxKey := fmt.Sprintf("idx/%s/%s", value, ukey[len("k/"):])
+				if err := b.Set([]byte(idxKey), nil, nil); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	d, err := Open("", testingRandomized(t, &Options{
+		FS:              vfs.NewMem(),
+		BatchCommitHook: hook,
+	}))
+	require.NoError(t, err)
+	defer d.Close()
+
+	b := d.NewBatch()
+	require.NoError(t, b.Set([]byte("k/a"), []byte("red"), nil))
+	require.NoError(t, b.Set([]byte("k/b"), []byte("blue"), nil))
+	require.NoError(t, b.Set([]byte("other"), []byte("green"), nil))
+	require.NoError(t, b.Commit(nil))
+	require.NoError(t, b.Close())
+	require.NoError(t, d.Set([]byte("k/c"), []byte("red"), nil))
+
+	// Empty batches don't invoke the hook.
+	require.NoError(t, d.Apply(d.NewBatch(), nil))
+	require.Equal(t, 2, calls)
+
+	// An error returned by the hook prevents the batch from committing.
+	b = d.NewBatch()
+	require.NoError(t, b.Set([]byte("k/d"), []byte("red"), nil))
+	require.NoError(t, b.Set([]byte("invalid"), nil, nil))
+	require.ErrorIs(t, b.Commit(nil), errInvalid)
+	require.NoError(t, b.Close())
+
+	iter, err := d.NewIter(nil)
+	require.NoError(t, err)
+	var keys []string
+	for valid := iter.First(); valid; valid = iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	require.NoError(t, iter.Close())
+	require.Equal(t, []string{
+		"idx/blue/b", "idx/red/a", "idx/red/c", "k/a", "k/b", "k/c", "other",
+	}, keys)
+}
+
 func TestMergeOrderSameAfterFlush(t *testing.T) {
 	// Ensure compaction iterator (used by flush) and user iterator process merge
 	// operands in the same order
@@ -1229,6 +1355,94 @@ func TestDBApplyBatchMismatch(t *testing.T) {
 	require.NoError(t, applyDB.Close())
 }
 
+func TestDBApplyAll(t *testing.T) {
+	mem := vfs.NewMem()
+	var hookCalls int
+	d, err := Open("", &Options{
+		FS: mem,
+		BatchCommitHook: func(b *Batch) error {
+			hookCalls++
+			return nil
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, d.Set([]byte("z"), nil, nil))
+
+	b1 := d.NewBatch()
+	require.NoError(t, b1.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, b1.LogData([]byte("entry-1"), nil))
+	b2 := d.NewBatch()
+	require.NoError(t, b2.LogData([]byte("entry-2"), nil))
+	require.NoError(t, b2.Set([]byte("b"), []byte("2"), nil))
+	require.NoError(t, b2.Delete([]byte("z"), nil))
+	b3 := d.NewBatch()
+	b4 := &Batch{}
+	require.NoError(t, b4.Set([]byte("c"), []byte("3"), nil))
+	batches := []*Batch{b1, b2, b3, b4}
+	require.NoError(t, d.ApplyAll(batches, nil))
+	require.Equal(t, 2, hookCalls)
+
+	// The batches are assigned contiguous sequence numbers.
+	seqNum := b1.SeqNum()
+	for _, b := range batches {
+		require.Equal(t, seqNum, b.SeqNum())
+		seqNum += uint64(b.Count())
+	}
+	require.Equal(t, b1.SeqNum()+4, d.mu.versions.visibleSeqNum.Load())
+	for k, v := range map[string]string{"a": "1", "b": "2", "c": "3"} {
+		value, closer, err := d.Get([]byte(k))
+		require.NoError(t, err)
+		require.Equal(t, v, string(value))
+		require.NoError(t, closer.Close())
+	}
+	_, _, err = d.Get([]byte("z"))
+	require.ErrorIs(t, err, ErrNotFound)
+	require.Panics(t, func() { _ = d.ApplyAll([]*Batch{b2}, nil) })
+	for _, b := range batches {
+		require.NoError(t, b.Close())
+	}
+	require.NoError(t, d.Close())
+
+	// The batches are written to the WAL as a single batch, preserving the
+	// LogData records of each batch.
+	ls, err := mem.List("")
+	require.NoError(t, err)
+	var records []string
+	for _, filename := range ls {
+		logNum, _, ok := wal.ParseLogFilename(filename)
+		if !ok {
+			continue
+		}
+		f, err := mem.Open(filename)
+		require.NoError(t, err)
+		rr := record.NewReader(f, base.DiskFileNum(logNum))
+		for {
+			r, err := rr.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			data, err := io.ReadAll(r)
+			require.NoError(t, err)
+			var buf strings.Builder
+			for br := batchrepr.Read(data); ; {
+				kind, ukey, _, ok, err := br.Next()
+				require.NoError(t, err)
+				if !ok {
+					break
+				}
+				fmt.Fprintf(&buf, "%s:%s ", kind, ukey)
+			}
+			records = append(records, strings.TrimSpace(buf.String()))
+		}
+		require.NoError(t, f.Close())
+	}
+	require.Equal(t, []string{
+		"SET:z",
+		"SET:a LOGDATA:entry-1 LOGDATA:entry-2 SET:b DEL:z SET:c",
+	}, records)
+}
+
 func TestCloseCleanerRace(t *testing.T) {
 	mem := vfs.NewMem()
 	for i := 0; i < 20; i++ {
@@ -1434,7 +1648,7 @@ func TestTracing(t *testing.T) {
 	_, closer, err := d.Get([]byte("hello"))
 	require.NoError(t, err)
 	closer.Close()
-	readerInitTraceString := "reading 37 bytes took 5ms\nreading 419 bytes took 5ms\n"
+	readerInitTraceString := "reading 37 bytes took 5ms\nreading 518 bytes took 5ms\n"
 	iterTraceString := "reading 27 bytes took 5ms\nreading 29 bytes took 5ms\n"
 	require.Equal(t, readerInitTraceString+iterTraceString, tracer.buf.String())
 
@@ -2320,3 +2534,48 @@ func parseOrderingTokens(tokens []string) (orderingNode, int) {
 		return leaf(v), 1
 	}
 }
+
+func TestPrefixExtractor(t *testing.T) {
+	opts := &Options{
+		FS: vfs.NewMem(),
+		PrefixExtractor: &PrefixExtractor{
+			Name:    "first-two",
+			Extract: func(prefix []byte) int { return 2 },
+		},
+	}
+	opts.Levels = []LevelOptions{{FilterPolicy: bloom.FilterPolicy(10)}}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	for _, k := range []string{"apple", "apricot", "banana"} {
+		require.NoError(t, d.Set([]byte(k), []byte(k), nil))
+	}
+	check := func() {
+		for _, k := range []string{"apple", "apricot", "banana"} {
+			v, closer, err := d.Get([]byte(k))
+			require.NoError(t, err)
+			require.Equal(t, k, string(v))
+			require.NoError(t, closer.Close())
+		}
+		for _, k := range []string{"aardvark", "apq", "cherry"} {
+			_, _, err := d.Get([]byte(k))
+			require.ErrorIs(t, err, ErrNotFound)
+		}
+		iter, _ := d.NewIter(nil)
+		require.True(t, iter.SeekPrefixGE([]byte("apple")))
+		require.Equal(t, "apple", string(iter.Key()))
+		require.False(t, iter.SeekPrefixGE([]byte("aardvark")))
+		require.NoError(t, iter.Close())
+	}
+	// The memtable's prefix filter excludes aardvark, but isn't reflected in
+	// the filter metrics, which are those of sstables.
+	check()
+	require.Zero(t, d.Metrics().Filter.Hits)
+
+	// And through the filter of the sstable, which excludes aardvark, whose
+	// extracted prefix is absent, for both the Get and the SeekPrefixGE.
+	require.NoError(t, d.Flush())
+	check()
+	require.Equal(t, int64(2), d.Metrics().Filter.Hits)
+}
@@ -287,6 +287,91 @@ func (i ManifestDeleteInfo) SafeFormat(w redact.SafePrinter, _ rune) {
 	w.Printf("[JOB %d] MANIFEST deleted %s", redact.Safe(i.JobID), i.FileNum)
 }
 
+// MemTableResizeInfo contains the info for a memtable resize event.
+type MemTableResizeInfo struct {
+	// PrevSize is the previous target size of memtables.
+	PrevSize uint64
+	// Size is the new target size of memtables.
+	Size uint64
+	// Reason is the reason for the resize: "flush backlog", "write
+	// amplification", or "low flush pressure".
+	Reason string
+	// FlushBacklog is the number of immutable memtables (or large batches)
+	// that were queued for flushing when the memtable filled.
+	FlushBacklog int
+	// WriteAmp is the write amplification since the previous memtable
+	// rotation.
+	WriteAmp float64
+}
+
+func (i MemTableResizeInfo) String() string {
+	return redact.StringWithoutMarkers(i)
+}
+
+// SafeFormat implements redact.SafeFormatter.
+func (i MemTableResizeInfo) SafeFormat(w redact.SafePrinter, _ rune) {
+	w.Printf("memtable resized from %s to %s (%s): flush backlog %d, w-amp %.1f",
+		redact.Safe(humanize.Bytes.Uint64(i.PrevSize)), redact.Safe(humanize.Bytes.Uint64(i.Size)),
+		redact.Safe(i.Reason), redact.Safe(i.FlushBacklog), redact.Safe(i.WriteAmp))
+}
+
+// OptionChange describes the change of an option by DB.SetOptions.
+type OptionChange struct {
+	// Name is the name of the field of MutableOptions.
+	Name string
+	// Prev and New are the previous and new values of the option.
+	Prev, New int64
+}
+
+// OptionsChangedInfo contains the info for an options change event.
+type OptionsChangedInfo struct {
+	// Changes are the options changed by DB.SetOptions, in the order of the
+	// fields of MutableOptions.
+	Changes []OptionChange
+}
+
+func (i OptionsChangedInfo) String() string {
+	return redact.StringWithoutMarkers(i)
+}
+
+// SafeFormat implements redact.SafeFormatter.
+func (i OptionsChangedInfo) SafeFormat(w redact.SafePrinter, _ rune) {
+	w.Printf("options changed:")
+	for j, c := range i.Changes {
+		if j > 0 {
+			w.Printf(",")
+		}
+		w.Printf(" %s %d -> %d", redact.Safe(c.Name), redact.Safe(c.Prev), redact.Safe(c.New))
+	}
+}
+
+// TableCorruptedInfo contains the info for a table corruption event, when a
+// block of a table is first found to fail its checksum.
+type TableCorruptedInfo struct {
+	FileNum base.DiskFileNum
+	// Offset and Length are the offset and length of the corrupt block within
+	// the table.
+	Offset, Length uint64
+	// Err is the checksum mismatch error.
+	Err error
+	// Recovered is true if the block was recovered by
+	// Options.CorruptionRecoveryHook.
+	Recovered bool
+}
+
+func (i TableCorruptedInfo) String() string {
+	return redact.StringWithoutMarkers(i)
+}
+
+// SafeFormat implements redact.SafeFormatter.
+func (i TableCorruptedInfo) SafeFormat(w redact.SafePrinter, _ rune) {
+	w.Printf("table %s corrupted at block %d/%d", i.FileNum, redact.Safe(i.Offset), redact.Safe(i.Length))
+	if i.Recovered {
+		w.Printf(" (recovered)")
+	}
+	w.Printf(": %s", i.Err)
+}
+
 // TableCreateInfo contains the info for a table creation event.
 type TableCreateInfo struct {
 	JobID int
@@ -467,9 +552,81 @@ func (i WALDeleteInfo) SafeFormat(w redact.SafePrinter, _ rune) {
 	w.Printf("[JOB %d] WAL deleted %s", redact.Safe(i.JobID), i.FileNum)
 }
 
+// WALReplayTruncatedInfo contains the info for a WAL replay truncation event,
+// which reports the WAL records dropped by Open because of
+// Options.RecoverUpToSeqNum.
+type WALReplayTruncatedInfo struct {
+	// JobID is the ID of the job that replayed the WALs.
+	JobID int
+	// RecoverUpToSeqNum is the configured Options.RecoverUpToSeqNum.
+	RecoverUpToSeqNum uint64
+	// FileNums are the WALs holding the dropped records.
+	FileNums []base.DiskFileNum
+	// Batches and Keys are the number of batches dropped, and the number of
+	// keys they held.
+	Batches, Keys uint64
+	// SmallestSeqNum and LargestSeqNum bound the sequence numbers of the
+	// dropped keys.
+	SmallestSeqNum, LargestSeqNum uint64
+}
+
+func (i WALReplayTruncatedInfo) String() string {
+	return redact.StringWithoutMarkers(i)
+}
+
+// SafeFormat implements redact.SafeFormatter.
+func (i WALReplayTruncatedInfo) SafeFormat(w redact.SafePrinter, _ rune) {
+	w.Printf("[JOB %d] WAL replay truncated at seqnum %d: dropped %d keys in %d batches",
+		redact.Safe(i.JobID), redact.Safe(i.RecoverUpToSeqNum), redact.Safe(i.Keys), redact.Safe(i.Batches))
+	if i.Keys > 0 {
+		w.Printf(" with seqnums %d-%d", redact.Safe(i.SmallestSeqNum), redact.Safe(i.LargestSeqNum))
+	}
+	if len(i.FileNums) > 0 {
+		w.Printf(" from WALs")
+		for _, fileNum := range i.FileNums {
+			w.Printf(" %s", fileNum)
+		}
+	}
+}
+
+// WriteStallCause identifies the condition that caused writes to be stalled.
+//
+// Low disk space is not a cause of write stalls: writes aren't delayed until
+// disk space is reclaimed, but rejected with ErrLowDiskSpace if
+// Options.ReadOnlyOnLowDiskSpace is set, and the condition is reported by the
+// separate EventListener.LowDiskSpace event.
+type WriteStallCause int8
+
+const (
+	// WriteStallMemTableCount indicates that writes were stalled because the
+	// queued memtables reached MemTableStopWritesThreshold.
+	WriteStallMemTableCount WriteStallCause = iota
+	// WriteStallL0FileCount indicates that writes were stalled because L0's
+	// read amplification reached L0StopWritesThreshold.
+	WriteStallL0FileCount
+)
+
+// String implements fmt.Stringer.
+func (c WriteStallCause) String() string {
+	switch c {
+	case WriteStallMemTableCount:
+		return "memtable count limit reached"
+	case WriteStallL0FileCount:
+		return "L0 file count limit exceeded"
+	default:
+		return "unknown"
+	}
+}
+
+// SafeValue implements redact.SafeValue.
+func (c WriteStallCause) SafeValue() {}
+
 // WriteStallBeginInfo contains the info for a write stall begin event.
 type WriteStallBeginInfo struct {
+	// Reason is a description of Cause.
 	Reason string
+	// Cause is the condition that caused writes to be stalled.
+	Cause WriteStallCause
 }
 
 func (i WriteStallBeginInfo) String() string {
@@ -481,6 +638,52 @@ func (i WriteStallBeginInfo) SafeFormat(w redact.SafePrinter, _ rune) {
 	w.Printf("write stall beginning: %s", redact.Safe(i.Reason))
 }
 
+// WriteStallEndInfo contains the info for a write stall end event.
+type WriteStallEndInfo struct {
+	// Cause is the condition that caused writes to be stalled, as reported by
+	// the corresponding write stall begin event. Writes may have remained
+	// stalled due to a different condition after the initial one cleared.
+	Cause WriteStallCause
+	// Duration is the length of time for which writes were stalled.
+	Duration time.Duration
+}
+
+func (i WriteStallEndInfo) String() string {
+	return redact.StringWithoutMarkers(i)
+}
+
+// SafeFormat implements redact.SafeFormatter.
+func (i WriteStallEndInfo) SafeFormat(w redact.SafePrinter, _ rune) {
+	w.Printf("write stall ending: %s; stalled for %.1fs", i.Cause, redact.Safe(i.Duration.Seconds()))
+}
+
+// LowDiskSpaceInfo contains the info for a low disk space event.
+type LowDiskSpaceInfo struct {
+	// AvailBytes is the disk space available to the DB, in bytes.
+	AvailBytes uint64
+	// TotalBytes is the total disk space, in bytes.
+	TotalBytes uint64
+	// Threshold is the configured Options.LowDiskSpaceThreshold.
+	Threshold uint64
+	// ReadOnly is true if writes are rejected until available disk space
+	// rises above the threshold (see Options.ReadOnlyOnLowDiskSpace).
+	ReadOnly bool
+}
+
+func (i LowDiskSpaceInfo) String() string {
+	return redact.StringWithoutMarkers(i)
+}
+
+// SafeFormat implements redact.SafeFormatter.
+func (i LowDiskSpaceInfo) SafeFormat(w redact.SafePrinter, _ rune) {
+	w.Printf("low disk space: %s available of %s, below threshold of %s",
+		humanize.Bytes.Uint64(i.AvailBytes), humanize.Bytes.Uint64(i.TotalBytes),
+		humanize.Bytes.Uint64(i.Threshold))
+	if i.ReadOnly {
+		w.Printf("; rejecting writes")
+	}
+}
+
 // EventListener contains a set of functions that will be invoked when various
 // significant DB events occur. Note that the functions should not run for an
 // excessive amount of time as they are invoked synchronously by the DB and may
@@ -521,12 +724,29 @@ type EventListener struct {
 	// is upgraded.
 	FormatUpgrade func(FormatMajorVersion)
 
+	// LowDiskSpace is invoked when the disk space available to the DB falls
+	// below Options.LowDiskSpaceThreshold. It is invoked again only after
+	// available disk space has risen above the threshold and then fallen below
+	// it again.
+	LowDiskSpace func(LowDiskSpaceInfo)
+
 	// ManifestCreated is invoked after a manifest has been created.
 	ManifestCreated func(ManifestCreateInfo)
 
 	// ManifestDeleted is invoked after a manifest has been deleted.
 	ManifestDeleted func(ManifestDeleteInfo)
 
+	// MemTableResized is invoked when adaptive memtable sizing changes the
+	// target size of memtables. See Options.AdaptiveMemTable.
+	MemTableResized func(MemTableResizeInfo)
+
+	// OptionsChanged is invoked after DB.SetOptions changes options.
+	OptionsChanged func(OptionsChangedInfo)
+
+	// TableCorrupted is invoked when a block of a table is first found to fail
+	// its checksum. See Options.CorruptionRecoveryHook.
+	TableCorrupted func(TableCorruptedInfo)
+
 	// TableCreated is invoked when a table has been created.
 	TableCreated func(TableCreateInfo)
 
@@ -550,11 +770,20 @@ type EventListener struct {
 	// WALDeleted is invoked after a WAL has been deleted.
 	WALDeleted func(WALDeleteInfo)
 
+	// WALReplayTruncated is invoked by Open when it drops WAL records because
+	// of Options.RecoverUpToSeqNum.
+	WALReplayTruncated func(WALReplayTruncatedInfo)
+
 	// WriteStallBegin is invoked when writes are intentionally delayed.
 	WriteStallBegin func(WriteStallBeginInfo)
 
-	// WriteStallEnd is invoked when delayed writes are released.
+	// WriteStallEnd is invoked when delayed writes are released. See
+	// WriteStallEndWithInfo for the cause and duration of the stall.
 	WriteStallEnd func()
+
+	// WriteStallEndWithInfo is invoked when delayed writes are released, after
+	// WriteStallEnd.
+	WriteStallEndWithInfo func(WriteStallEndInfo)
 }
 
 // EnsureDefaults ensures that background error events are logged to the
@@ -589,12 +818,24 @@ func (l *EventListener) EnsureDefaults(logger Logger) {
 	if l.FormatUpgrade == nil {
 		l.FormatUpgrade = func(v FormatMajorVersion) {}
 	}
+	if l.LowDiskSpace == nil {
+		l.LowDiskSpace = func(info LowDiskSpaceInfo) {}
+	}
 	if l.ManifestCreated == nil {
 		l.ManifestCreated = func(info ManifestCreateInfo) {}
 	}
 	if l.ManifestDeleted == nil {
 		l.ManifestDeleted = func(info ManifestDeleteInfo) {}
 	}
+	if l.MemTableResized == nil {
+		l.MemTableResized = func(info MemTableResizeInfo) {}
+	}
+	if l.OptionsChanged == nil {
+		l.OptionsChanged = func(info OptionsChangedInfo) {}
+	}
+	if l.TableCorrupted == nil {
+		l.TableCorrupted = func(info TableCorruptedInfo) {}
+	}
 	if l.TableCreated == nil {
 		l.TableCreated = func(info TableCreateInfo) {}
 	}
@@ -616,12 +857,18 @@ func (l *EventListener) EnsureDefaults(logger Logger) {
 	if l.WALDeleted == nil {
 		l.WALDeleted = func(info WALDeleteInfo) {}
 	}
+	if l.WALReplayTruncated == nil {
+		l.WALReplayTruncated = func(info WALReplayTruncatedInfo) {}
+	}
 	if l.WriteStallBegin == nil {
 		l.WriteStallBegin = func(info WriteStallBeginInfo) {}
 	}
 	if l.WriteStallEnd == nil {
 		l.WriteStallEnd = func() {}
 	}
+	if l.WriteStallEndWithInfo == nil {
+		l.WriteStallEndWithInfo = func(info WriteStallEndInfo) {}
+	}
 }
 
 // MakeLoggingEventListener creates an EventListener that logs all events to the
@@ -653,12 +900,24 @@ func MakeLoggingEventListener(logger Logger) EventListener {
 		FormatUpgrade: func(v FormatMajorVersion) {
 			logger.Infof("upgraded to format version: %s", v)
 		},
+		LowDiskSpace: func(info LowDiskSpaceInfo) {
+			logger.Infof("%s", info)
+		},
 		ManifestCreated: func(info ManifestCreateInfo) {
 			logger.Infof("%s", info)
 		},
 		ManifestDeleted: func(info ManifestDeleteInfo) {
 			logger.Infof("%s", info)
 		},
+		MemTableResized: func(info MemTableResizeInfo) {
+			logger.Infof("%s", info)
+		},
+		OptionsChanged: func(info OptionsChangedInfo) {
+			logger.Infof("%s", info)
+		},
+		TableCorrupted: func(info TableCorruptedInfo) {
+			logger.Errorf("%s", info)
+		},
 		TableCreated: func(info TableCreateInfo) {
 			logger.Infof("%s", info)
 		},
@@ -680,11 +939,18 @@ func MakeLoggingEventListener(logger Logger) EventListener {
 		WALDeleted: func(info WALDeleteInfo) {
 			logger.Infof("%s", info)
 		},
+		WALReplayTruncated: func(info WALReplayTruncatedInfo) {
+			logger.Infof("%s", info)
+		},
 		WriteStallBegin: func(info WriteStallBeginInfo) {
 			logger.Infof("%s", info)
 		},
 		WriteStallEnd: func() {
-			logger.Infof("write stall ending")
+			// The end of the stall is logged, with its cause and duration, by
+			// WriteStallEndWithInfo.
+		},
+		WriteStallEndWithInfo: func(info WriteStallEndInfo) {
+			logger.Infof("%s", info)
 		},
 	}
 }
@@ -722,6 +988,10 @@ func TeeEventListener(a, b EventListener) EventListener {
 			a.FormatUpgrade(v)
 			b.FormatUpgrade(v)
 		},
+		LowDiskSpace: func(info LowDiskSpaceInfo) {
+			a.LowDiskSpace(info)
+			b.LowDiskSpace(info)
+		},
 		ManifestCreated: func(info ManifestCreateInfo) {
 			a.ManifestCreated(info)
 			b.ManifestCreated(info)
@@ -730,6 +1000,18 @@ func TeeEventListener(a, b EventListener) EventListener {
 			a.ManifestDeleted(info)
 			b.ManifestDeleted(info)
 		},
+		MemTableResized: func(info MemTableResizeInfo) {
+			a.MemTableResized(info)
+			b.MemTableResized(info)
+		},
+		OptionsChanged: func(info OptionsChangedInfo) {
+			a.OptionsChanged(info)
+			b.OptionsChanged(info)
+		},
+		TableCorrupted: func(info TableCorruptedInfo) {
+			a.TableCorrupted(info)
+			b.TableCorrupted(info)
+		},
 		TableCreated: func(info TableCreateInfo) {
 			a.TableCreated(info)
 			b.TableCreated(info)
@@ -758,6 +1040,10 @@ func TeeEventListener(a, b EventListener) EventListener {
 			a.WALDeleted(info)
 			b.WALDeleted(info)
 		},
+		WALReplayTruncated: func(info WALReplayTruncatedInfo) {
+			a.WALReplayTruncated(info)
+			b.WALReplayTruncated(info)
+		},
 		WriteStallBegin: func(info WriteStallBeginInfo) {
 			a.WriteStallBegin(info)
 			b.WriteStallBegin(info)
@@ -766,5 +1052,9 @@ func TeeEventListener(a, b EventListener) EventListener {
 			a.WriteStallEnd()
 			b.WriteStallEnd()
 		},
+		WriteStallEndWithInfo: func(info WriteStallEndInfo) {
+			a.WriteStallEndWithInfo(info)
+			b.WriteStallEndWithInfo(info)
+		},
 	}
 }
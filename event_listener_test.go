@@ -11,6 +11,7 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -251,6 +252,7 @@ func TestWriteStallEvents(t *testing.T) {
 			createReleased := make(chan struct{}, flushCount)
 			var log base.InMemLogger
 			var delayOnce sync.Once
+			var legacyStallEnds atomic.Int32
 			listener := &EventListener{
 				TableCreated: func(info TableCreateInfo) {
 					if c.delayFlush == (info.Reason == "flushing") {
@@ -264,7 +266,10 @@ func TestWriteStallEvents(t *testing.T) {
 					createReleased <- struct{}{}
 				},
 				WriteStallEnd: func() {
-					log.Infof("%s", writeStallEnd)
+					legacyStallEnds.Add(1)
+				},
+				WriteStallEndWithInfo: func(info WriteStallEndInfo) {
+					log.Infof("%s", info.String())
 					select {
 					case stallEnded <- struct{}{}:
 					default:
@@ -306,6 +311,7 @@ func TestWriteStallEvents(t *testing.T) {
 			events := log.String()
 			require.Contains(t, events, c.expected)
 			require.Contains(t, events, writeStallEnd)
+			require.Positive(t, legacyStallEnds.Load())
 			if testing.Verbose() {
 				t.Logf("\n%s", events)
 			}
@@ -313,6 +319,62 @@ func TestWriteStallEvents(t *testing.T) {
 	}
 }
 
+// diskUsageFS wraps a vfs.FS, reporting a configurable amount of available
+// disk space.
+type diskUsageFS struct {
+	vfs.FS
+	availBytes atomic.Uint64
+}
+
+func (fs *diskUsageFS) GetDiskUsage(string) (vfs.DiskUsage, error) {
+	return vfs.DiskUsage{AvailBytes: fs.availBytes.Load(), TotalBytes: 10 << 20}, nil
+}
+
+func TestLowDiskSpaceEvents(t *testing.T) {
+	fs := &diskUsageFS{FS: vfs.NewMem()}
+	fs.availBytes.Store(1 << 20)
+	var events []LowDiskSpaceInfo
+	d, err := Open("db", &Options{
+		FS:                     fs,
+		LowDiskSpaceThreshold:  2 << 20,
+		ReadOnlyOnLowDiskSpace: true,
+		EventListener: &EventListener{
+			LowDiskSpace: func(info LowDiskSpaceInfo) {
+				events = append(events, info)
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer d.Close()
+
+	// Available disk space is below the threshold at Open.
+	require.Equal(t, []LowDiskSpaceInfo{{
+		AvailBytes: 1 << 20,
+		TotalBytes: 10 << 20,
+		Threshold:  2 << 20,
+		ReadOnly:   true,
+	}}, events)
+	require.Equal(t, "low disk space: 1.0MB available of 10MB, below threshold of 2.0MB; rejecting writes",
+		events[0].String())
+	require.ErrorIs(t, d.Set([]byte("a"), nil, nil), ErrLowDiskSpace)
+	require.ErrorIs(t, d.Ingest(nil), ErrLowDiskSpace)
+
+	// Writes succeed once disk space is reclaimed.
+	fs.availBytes.Store(3 << 20)
+	require.NoError(t, d.Set([]byte("a"), nil, nil))
+	require.NoError(t, d.Flush())
+	require.Len(t, events, 1)
+
+	// The event is invoked again when a flush observes that available disk
+	// space has fallen below the threshold again.
+	fs.availBytes.Store(1 << 10)
+	require.NoError(t, d.Set([]byte("b"), nil, nil))
+	require.NoError(t, d.Flush())
+	require.Len(t, events, 2)
+	require.Equal(t, uint64(1<<10), events[1].AvailBytes)
+	require.ErrorIs(t, d.Set([]byte("c"), nil, nil), ErrLowDiskSpace)
+}
+
 type redactLogger struct {
 	logger Logger
 }
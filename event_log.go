@@ -0,0 +1,370 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/errors/oserror"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// The event log persists a subset of the events of the DB (see EventLogRecord)
+// as JSON lines in the data directory, in files named EVENTS-<seq>.jsonl. A new
+// file is started whenever the DB is opened, and whenever the current file
+// reaches EventLogOptions.MaxFileSize. Only the EventLogOptions.MaxFiles most
+// recent files are retained.
+
+const eventLogFilePrefix, eventLogFileSuffix = "EVENTS-", ".jsonl"
+
+// Event types of EventLogRecords.
+const (
+	EventTypeBackgroundError = "background-error"
+	EventTypeCompaction      = "compaction"
+	EventTypeDiskSlow        = "disk-slow"
+	EventTypeFlush           = "flush"
+	EventTypeIngest          = "ingest"
+	EventTypeWriteStallBegin = "write-stall-begin"
+	EventTypeWriteStallEnd   = "write-stall-end"
+)
+
+// EventLogRecord is a record of the event log. See Options.EventLog.
+type EventLogRecord struct {
+	// Time is the time the event was recorded at.
+	Time time.Time `json:"time"`
+	// Type is the type of the event (one of the EventType constants).
+	Type string `json:"type"`
+	// JobID is the ID of the job of the event, if any.
+	JobID int `json:"job,omitempty"`
+	// Message describes the event, in the format of the corresponding
+	// EventListener log line.
+	Message string `json:"msg"`
+	// Reason is the reason for the flush, compaction or write stall.
+	Reason string `json:"reason,omitempty"`
+	// Duration is the duration of the flush, compaction, write stall or slow
+	// disk operation.
+	Duration time.Duration `json:"duration,omitempty"`
+	// Input and Output are the input and output tables of a flush, compaction
+	// or ingestion, organized by level. The input of a flush isn't recorded.
+	Input  []EventLogLevel `json:"input,omitempty"`
+	Output []EventLogLevel `json:"output,omitempty"`
+	// Error is the error of the event, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// EventLogLevel holds the tables of a level of an EventLogRecord.
+type EventLogLevel struct {
+	Level  int       `json:"level"`
+	Tables []FileNum `json:"tables"`
+	// Size is the total size of the tables.
+	Size uint64 `json:"size"`
+}
+
+// appendEventLogTable appends the table to the last level of levels if it has
+// the given level, and to a new level otherwise.
+func appendEventLogTable(levels []EventLogLevel, level int, t TableInfo) []EventLogLevel {
+	if n := len(levels); n == 0 || levels[n-1].Level != level {
+		levels = append(levels, EventLogLevel{Level: level, Tables: []FileNum{}})
+	}
+	l := &levels[len(levels)-1]
+	l.Tables = append(l.Tables, t.FileNum)
+	l.Size += t.Size
+	return levels
+}
+
+func eventLogLevels(infos []LevelInfo) []EventLogLevel {
+	levels := make([]EventLogLevel, len(infos))
+	for i, info := range infos {
+		levels[i] = EventLogLevel{Level: info.Level, Tables: make([]FileNum, len(info.Tables))}
+		for j, t := range info.Tables {
+			levels[i].Tables[j] = t.FileNum
+			levels[i].Size += t.Size
+		}
+	}
+	return levels
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// eventLog writes the event log of a DB.
+type eventLog struct {
+	fs      vfs.FS
+	dirname string
+	opts    EventLogOptions
+	logger  Logger
+	now     func() time.Time
+
+	mu struct {
+		sync.Mutex
+		// seqs holds the sequence numbers of the event log files, in
+		// increasing order. The last one is the current file.
+		seqs []uint64
+		// f is the current file. It's nil once the event log is closed or
+		// failed.
+		f    vfs.File
+		size int64
+	}
+}
+
+func makeEventLogFilename(seq uint64) string {
+	return fmt.Sprintf("%s%06d%s", eventLogFilePrefix, seq, eventLogFileSuffix)
+}
+
+func parseEventLogFilename(filename string) (seq uint64, ok bool) {
+	if !strings.HasPrefix(filename, eventLogFilePrefix) || !strings.HasSuffix(filename, eventLogFileSuffix) {
+		return 0, false
+	}
+	s := strings.TrimSuffix(strings.TrimPrefix(filename, eventLogFilePrefix), eventLogFileSuffix)
+	seq, err := strconv.ParseUint(s, 10, 64)
+	return seq, err == nil
+}
+
+// eventLogSeqs returns the sequence numbers of the event log files of ls, in
+// increasing order.
+func eventLogSeqs(ls []string) []uint64 {
+	var seqs []uint64
+	for _, filename := range ls {
+		if seq, ok := parseEventLogFilename(filename); ok {
+			seqs = append(seqs, seq)
+		}
+	}
+	slices.Sort(seqs)
+	return seqs
+}
+
+// openEventLog starts a new file of the event log of the DB in dirname, whose
+// contents are ls.
+func openEventLog(
+	fs vfs.FS, dirname string, ls []string, opts EventLogOptions, logger Logger,
+) (*eventLog, error) {
+	l := &eventLog{
+		fs:      fs,
+		dirname: dirname,
+		opts:    opts,
+		logger:  logger,
+		now:     time.Now,
+	}
+	l.mu.seqs = eventLogSeqs(ls)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.rotateLocked(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// rotateLocked starts a new file, and deletes the files in excess of
+// EventLogOptions.MaxFiles.
+func (l *eventLog) rotateLocked() error {
+	if l.mu.f != nil {
+		err := firstError(l.mu.f.Sync(), l.mu.f.Close())
+		l.mu.f = nil
+		if err != nil {
+			return err
+		}
+	}
+	var seq uint64 = 1
+	if n := len(l.mu.seqs); n > 0 {
+		seq = l.mu.seqs[n-1] + 1
+	}
+	f, err := l.fs.Create(l.fs.PathJoin(l.dirname, makeEventLogFilename(seq)))
+	if err != nil {
+		return err
+	}
+	l.mu.f, l.mu.size = f, 0
+	l.mu.seqs = append(l.mu.seqs, seq)
+	for len(l.mu.seqs) > l.opts.MaxFiles {
+		path := l.fs.PathJoin(l.dirname, makeEventLogFilename(l.mu.seqs[0]))
+		if err := l.fs.Remove(path); err != nil && !oserror.IsNotExist(err) {
+			return err
+		}
+		l.mu.seqs = l.mu.seqs[1:]
+	}
+	return nil
+}
+
+// write appends the record to the event log. A failure to write disables the
+// event log, rather than failing the DB.
+func (l *eventLog) write(r EventLogRecord) {
+	r.Time = l.now()
+	b, err := json.Marshal(r)
+	if err != nil {
+		l.logger.Errorf("pebble: unable to encode event log record: %s", err)
+		return
+	}
+	b = append(b, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.mu.f == nil {
+		return
+	}
+	if l.mu.size > 0 && l.mu.size+int64(len(b)) > l.opts.MaxFileSize {
+		err = l.rotateLocked()
+	}
+	if err == nil {
+		// Records aren't synced, but they're written directly to the file so
+		// that they survive a crash of the process.
+		_, err = l.mu.f.Write(b)
+	}
+	if err != nil {
+		l.logger.Errorf("pebble: unable to write event log, disabling it: %s", err)
+		if l.mu.f != nil {
+			_ = l.mu.f.Close()
+			l.mu.f = nil
+		}
+		return
+	}
+	l.mu.size += int64(len(b))
+}
+
+// close syncs and closes the current file. Records written after close are
+// dropped.
+func (l *eventLog) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.mu.f == nil {
+		return nil
+	}
+	err := firstError(l.mu.f.Sync(), l.mu.f.Close())
+	l.mu.f = nil
+	return err
+}
+
+// eventListener returns the EventListener writing events to the event log.
+func (l *eventLog) eventListener() EventListener {
+	return EventListener{
+		BackgroundError: func(err error) {
+			l.write(EventLogRecord{
+				Type:    EventTypeBackgroundError,
+				Message: err.Error(),
+				Error:   err.Error(),
+			})
+		},
+		CompactionEnd: func(info CompactionInfo) {
+			r := EventLogRecord{
+				Type:     EventTypeCompaction,
+				JobID:    info.JobID,
+				Message:  info.String(),
+				Reason:   info.Reason,
+				Duration: info.TotalDuration,
+				Input:    eventLogLevels(info.Input),
+				Error:    errorString(info.Err),
+			}
+			if info.Err == nil {
+				r.Output = eventLogLevels([]LevelInfo{info.Output})
+			}
+			l.write(r)
+		},
+		DiskSlow: func(info DiskSlowInfo) {
+			l.write(EventLogRecord{
+				Type:     EventTypeDiskSlow,
+				Message:  info.String(),
+				Duration: info.Duration,
+			})
+		},
+		FlushEnd: func(info FlushInfo) {
+			r := EventLogRecord{
+				Type:     EventTypeFlush,
+				JobID:    info.JobID,
+				Message:  info.String(),
+				Reason:   info.Reason,
+				Duration: info.TotalDuration,
+				Error:    errorString(info.Err),
+			}
+			for i, t := range info.Output {
+				level := 0
+				if info.Ingest {
+					level = info.IngestLevels[i]
+				}
+				r.Output = appendEventLogTable(r.Output, level, t)
+			}
+			l.write(r)
+		},
+		TableIngested: func(info TableIngestInfo) {
+			r := EventLogRecord{
+				Type:    EventTypeIngest,
+				JobID:   info.JobID,
+				Message: info.String(),
+				Error:   errorString(info.Err),
+			}
+			for _, t := range info.Tables {
+				r.Output = appendEventLogTable(r.Output, t.Level, t.TableInfo)
+			}
+			l.write(r)
+		},
+		WriteStallBegin: func(info WriteStallBeginInfo) {
+			l.write(EventLogRecord{
+				Type:    EventTypeWriteStallBegin,
+				Message: info.String(),
+				Reason:  info.Reason,
+			})
+		},
+		WriteStallEndWithInfo: func(info WriteStallEndInfo) {
+			l.write(EventLogRecord{
+				Type:     EventTypeWriteStallEnd,
+				Message:  info.String(),
+				Reason:   info.Cause.String(),
+				Duration: info.Duration,
+			})
+		},
+	}
+}
+
+// ReadEventLog calls fn with each record of the event log of the DB in
+// dirname, in the order the records were written. See Options.EventLog.
+func ReadEventLog(fs vfs.FS, dirname string, fn func(EventLogRecord) error) error {
+	ls, err := fs.List(dirname)
+	if err != nil {
+		return err
+	}
+	for _, seq := range eventLogSeqs(ls) {
+		filename := makeEventLogFilename(seq)
+		f, err := fs.Open(fs.PathJoin(dirname, filename))
+		if err != nil {
+			if oserror.IsNotExist(err) {
+				// The file was deleted by a concurrent rotation.
+				continue
+			}
+			return err
+		}
+		err = readEventLogFile(f, fn)
+		err = firstError(err, f.Close())
+		if err != nil {
+			return errors.Wrapf(err, "pebble: reading event log %s", filename)
+		}
+	}
+	return nil
+}
+
+func readEventLogFile(f vfs.File, fn func(EventLogRecord) error) error {
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var r EventLogRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			// The last record may have been partially written when the
+			// process crashed.
+			continue
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
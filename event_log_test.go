@@ -0,0 +1,85 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventLog(t *testing.T) {
+	mem := vfs.NewMem()
+	opts := &Options{FS: mem}
+	opts.EventLog.Enabled = true
+	d, err := Open("db", opts)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("k%d", i)), nil, nil))
+		require.NoError(t, d.Flush())
+	}
+	require.NoError(t, d.Compact([]byte("k"), []byte("l"), false /* parallelize */))
+	require.NoError(t, d.Close())
+
+	read := func() []EventLogRecord {
+		var records []EventLogRecord
+		require.NoError(t, ReadEventLog(mem, "db", func(r EventLogRecord) error {
+			records = append(records, r)
+			return nil
+		}))
+		return records
+	}
+	records := read()
+	var types []string
+	for i, r := range records {
+		types = append(types, r.Type)
+		require.NotEmpty(t, r.Message)
+		require.False(t, r.Time.IsZero())
+		if i > 0 {
+			require.False(t, r.Time.Before(records[i-1].Time))
+		}
+	}
+	require.Equal(t, []string{
+		EventTypeFlush, EventTypeFlush, EventTypeFlush, EventTypeCompaction,
+	}, types)
+	require.Len(t, records[0].Output, 1)
+	require.Equal(t, 0, records[0].Output[0].Level)
+	require.Len(t, records[0].Output[0].Tables, 1)
+	require.Greater(t, records[0].Output[0].Size, uint64(0))
+	require.Len(t, records[3].Input[0].Tables, 3)
+	require.Equal(t, 6, records[3].Output[0].Level)
+
+	// A new file is started whenever the DB is opened or the current file is
+	// full, and only the most recent files are retained. Records of the
+	// deleted files are lost.
+	opts.EventLog.MaxFiles = 2
+	opts.EventLog.MaxFileSize = 1
+	d, err = Open("db", opts)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("k%d", i)), nil, nil))
+		require.NoError(t, d.Flush())
+	}
+	require.NoError(t, d.Close())
+	ls, err := mem.List("db")
+	require.NoError(t, err)
+	require.Equal(t, []uint64{3, 4}, eventLogSeqs(ls))
+	records = read()
+	require.Len(t, records, 2)
+	for _, r := range records {
+		require.Equal(t, EventTypeFlush, r.Type)
+	}
+
+	// A DB opened in read-only mode doesn't write the event log.
+	opts.ReadOnly = true
+	d, err = Open("db", opts)
+	require.NoError(t, err)
+	require.NoError(t, d.Close())
+	ls, err = mem.List("db")
+	require.NoError(t, err)
+	require.Equal(t, []uint64{3, 4}, eventLogSeqs(ls))
+}
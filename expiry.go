@@ -0,0 +1,114 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"math"
+	"time"
+
+	"github.com/cockroachdb/pebble/sstable"
+)
+
+// expiryPropertyName is the name of the block property collector that records
+// the range of expiry times, as determined by
+// Options.Experimental.ExpirationFunc, of the point keys within each block and
+// sstable.
+const expiryPropertyName = "pebble.expiry"
+
+// neverExpires is the expiry recorded for keys that never expire. It is the
+// largest value that may be the lower bound of a non-empty interval.
+const neverExpires = math.MaxUint64 - 1
+
+// expiryNanos converts an expiry time returned by an ExpirationFunc into the
+// encoding used by the expiry block property: nanoseconds since the Unix epoch,
+// clamped to [1, neverExpires]. Zero is reserved to indicate that a table has
+// no keys with an expiry.
+func expiryNanos(t time.Time) uint64 {
+	if t.IsZero() {
+		return neverExpires
+	}
+	n := t.UnixNano()
+	if n <= 0 {
+		return 1
+	}
+	return min(uint64(n), neverExpires)
+}
+
+// makeExpiredFunc returns a function that reports whether a key and value had
+// expired as of now according to fn, or nil if fn is nil.
+func makeExpiredFunc(
+	fn func(key, value []byte) time.Time, now time.Time,
+) func(key, value []byte) bool {
+	if fn == nil {
+		return nil
+	}
+	return func(key, value []byte) bool {
+		t := fn(key, value)
+		return !t.IsZero() && !t.After(now)
+	}
+}
+
+// newExpiryCollector returns a constructor for the block property collector
+// that records the expiry interval of point keys.
+func newExpiryCollector(fn func(key, value []byte) time.Time) func() BlockPropertyCollector {
+	return func() BlockPropertyCollector {
+		return sstable.NewBlockIntervalCollector(
+			expiryPropertyName, &expiryIntervalCollector{fn: fn}, nil /* rangeCollector */)
+	}
+}
+
+// expiryIntervalCollector implements sstable.DataBlockIntervalCollector,
+// collecting the [min, max+1) interval of the expiry times of a block's keys.
+// Tombstones are ignored. Merge operands are never dropped due to expiry, so
+// they are considered to never expire.
+type expiryIntervalCollector struct {
+	fn           func(key, value []byte) time.Time
+	lower, upper uint64
+}
+
+var _ sstable.DataBlockIntervalCollector = (*expiryIntervalCollector)(nil)
+
+// Add implements the sstable.DataBlockIntervalCollector interface.
+func (c *expiryIntervalCollector) Add(key InternalKey, value []byte) error {
+	var expiry uint64
+	switch key.Kind() {
+	case InternalKeyKindSet, InternalKeyKindSetWithDelete:
+		expiry = expiryNanos(c.fn(key.UserKey, value))
+	case InternalKeyKindMerge:
+		expiry = neverExpires
+	default:
+		return nil
+	}
+	if c.lower >= c.upper {
+		c.lower, c.upper = expiry, expiry+1
+		return nil
+	}
+	c.lower = min(c.lower, expiry)
+	c.upper = max(c.upper, expiry+1)
+	return nil
+}
+
+// FinishDataBlock implements the sstable.DataBlockIntervalCollector interface.
+func (c *expiryIntervalCollector) FinishDataBlock() (lower uint64, upper uint64, err error) {
+	lower, upper = c.lower, c.upper
+	c.lower, c.upper = 0, 0
+	return lower, upper, nil
+}
+
+// tableMaxExpiry returns the maximum expiry of the point keys within an
+// sstable with the given user properties, in the encoding returned by
+// expiryNanos. It returns zero if the sstable contains no keys with an expiry
+// or was written without the expiry block property collector.
+func tableMaxExpiry(userProps map[string]string) (uint64, error) {
+	prop, ok := userProps[expiryPropertyName]
+	if !ok {
+		return 0, nil
+	}
+	lower, upper, err := sstable.DecodeTableInterval(prop)
+	if err != nil || lower >= upper {
+		return 0, err
+	}
+	return upper - 1, nil
+}
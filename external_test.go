@@ -60,6 +60,9 @@ func TestIteratorErrors(t *testing.T) {
 	{
 		testOpts.Opts.DisableTableStats = true
 		testOpts.Opts.DisableAutomaticCompactions = true
+		// Pinning blocks reads them in the background, consuming injected
+		// errors that aren't surfaced by the operations.
+		testOpts.Opts.Experimental.PinnedBlocksMinLevel = 0
 
 		// Create an errorfs injector that injects ErrInjected on 5% of reads.
 		// Wrap it in both a counter and a toggle so that we a) know whether an
@@ -19,4 +19,5 @@ const (
 	fileTypeOptions  = base.FileTypeOptions
 	fileTypeTemp     = base.FileTypeTemp
 	fileTypeOldTemp  = base.FileTypeOldTemp
+	fileTypeBlob     = base.FileTypeBlob
 )
@@ -76,7 +76,7 @@ func TestIngestedSSTFlushableAPI(t *testing.T) {
 		}
 
 		// Verify the sstables do not overlap.
-		if err := ingestSortAndVerify(d.cmp, lr, KeyRange{}); err != nil {
+		if err := ingestSortAndVerify(d.cmp, lr, nil /* exciseSpans */); err != nil {
 			panic("unsorted sstables")
 		}
 
@@ -0,0 +1,325 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/vfs/atomicfs"
+	"github.com/cockroachdb/pebble/wal"
+)
+
+// FollowerOptions configures a DB opened with OpenReadOnly.
+type FollowerOptions struct {
+	// RefreshInterval is the interval at which the DB refreshes its state from
+	// the directory; see DB.Refresh. If zero, the state is only refreshed by
+	// explicit calls to DB.Refresh.
+	RefreshInterval time.Duration
+	// TailWAL indicates that the writes in the unflushed WALs are served too,
+	// rather than only the writes flushed to sstables. On every refresh, the
+	// WAL being written is read again from its start.
+	TailWAL bool
+}
+
+// OpenReadOnly opens the DB in the given directory read-only, following the
+// DB while another process has it open for writing (the primary). Unlike Open
+// with Options.ReadOnly set, OpenReadOnly doesn't acquire the directory's
+// LOCK file. The DB serves the state of the directory at Open, and is brought
+// up to date by refreshes (see DB.Refresh and FollowerOptions), making it
+// suitable for sidecar analytics and debugging against a live store.
+//
+// The follower and the primary don't coordinate: the primary deletes the
+// files it no longer needs regardless of the follower. Iterators and reads of
+// the follower may fail if they access sstables deleted since the last
+// refresh, and a refresh may fail if the files it reads are deleted
+// concurrently; refreshing again resolves both. Snapshots of the follower are
+// not stable across refreshes when tailing the WAL. Remote storage is not
+// supported.
+func OpenReadOnly(dirname string, opts *Options, followerOpts FollowerOptions) (*DB, error) {
+	opts = opts.Clone()
+	if opts.Experimental.RemoteStorage != nil {
+		return nil, errors.New("pebble: remote storage is not supported by OpenReadOnly")
+	}
+	opts.ReadOnly = true
+	opts.private.follower = &followerOpts
+	return Open(dirname, opts)
+}
+
+// followerState is the state of a DB opened with OpenReadOnly. It's protected
+// by DB.mu.
+type followerState struct {
+	opts *FollowerOptions
+	// walDirs are the directories scanned for WALs.
+	walDirs []wal.Dir
+	// manifestFileNum and manifestSize describe the MANIFEST read by the last
+	// refresh.
+	manifestFileNum base.DiskFileNum
+	manifestSize    int64
+	// wals holds the flushables replayed from the WALs that were complete when
+	// they were replayed, i.e. which were followed by newer WALs, so that they
+	// aren't replayed again by later refreshes.
+	wals map[base.DiskFileNum]flushableList
+}
+
+// initFollowerLocked initializes the follower state once the DB is open, and
+// starts the periodic refreshes. d.mu must be held.
+func (d *DB) initFollowerLocked(walDirs []wal.Dir) {
+	f := &d.mu.follower
+	f.opts = d.opts.private.follower
+	f.walDirs = walDirs
+	f.manifestFileNum = d.mu.versions.manifestFileNum
+	f.manifestSize = -1
+	f.wals = make(map[base.DiskFileNum]flushableList)
+
+	// The sstables of the follower's versions are owned by the primary, so
+	// removing a version must not delete them.
+	d.mu.versions.obsoleteFn = d.evictFollowerTablesLocked
+	d.mu.versions.currentVersion().Deleted = d.mu.versions.obsoleteFn
+
+	if f.opts.RefreshInterval > 0 {
+		d.compactionSchedulers.Add(1)
+		go d.followerRefreshLoop(f.opts.RefreshInterval)
+	}
+}
+
+func (d *DB) followerRefreshLoop(interval time.Duration) {
+	defer d.compactionSchedulers.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.closedCh:
+			return
+		case <-ticker.C:
+		}
+		d.mu.Lock()
+		if d.closed.Load() != nil {
+			d.mu.Unlock()
+			return
+		}
+		if err := d.refreshFollowerLocked(); err != nil {
+			d.opts.Logger.Errorf("pebble: refreshing read-only DB: %s", err)
+		}
+		d.mu.Unlock()
+	}
+}
+
+// Refresh brings the state of a DB opened with OpenReadOnly up to date with
+// the directory: the sstables of the current MANIFEST are picked up, and, if
+// FollowerOptions.TailWAL is set, the unflushed WALs are replayed. Iterators
+// created before Refresh returns continue to read the previous state. If
+// Refresh fails, the DB continues to serve its previous state.
+func (d *DB) Refresh() error {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.mu.follower.opts == nil {
+		return errors.New("pebble: Refresh requires a DB opened with OpenReadOnly")
+	}
+	return d.refreshFollowerLocked()
+}
+
+// refreshFollowerLocked implements Refresh. d.mu must be held.
+func (d *DB) refreshFollowerLocked() error {
+	if err := d.refreshFollowerVersionLocked(); err != nil {
+		return err
+	}
+	if d.mu.follower.opts.TailWAL {
+		if err := d.refreshFollowerMemTablesLocked(); err != nil {
+			return err
+		}
+	}
+	d.updateReadStateLocked(d.opts.DebugCheck)
+	return nil
+}
+
+// refreshFollowerVersionLocked installs the version described by the current
+// MANIFEST, if it changed since the last refresh. d.mu must be held.
+func (d *DB) refreshFollowerVersionLocked() error {
+	f := &d.mu.follower
+	ls, err := d.opts.FS.List(d.dirname)
+	if err != nil {
+		return err
+	}
+	filename, err := atomicfs.ReadMarker(d.opts.FS, d.dirname, manifestMarkerName)
+	if err != nil {
+		return err
+	}
+	_, manifestFileNum, ok := base.ParseFilename(d.opts.FS, filename)
+	if !ok {
+		return base.CorruptionErrorf("pebble: MANIFEST name %q is malformed", errors.Safe(filename))
+	}
+	stat, err := d.opts.FS.Stat(base.MakeFilepath(d.opts.FS, d.dirname, fileTypeManifest, manifestFileNum))
+	if err != nil {
+		return err
+	}
+	if manifestFileNum == f.manifestFileNum && stat.Size() == f.manifestSize {
+		return nil
+	}
+
+	// Load the MANIFEST into a new version set, and transfer its version into
+	// the DB's version set.
+	d.objProvider.AddLocalObjects(ls)
+	loaded := &versionSet{}
+	if err := loaded.load(
+		d.dirname, d.objProvider, d.opts, manifestFileNum, nil /* marker */, d.FormatMajorVersion, &d.mu.Mutex,
+	); err != nil {
+		return err
+	}
+	vs := d.mu.versions
+	v := loaded.currentVersion()
+	loaded.versions.Remove(v)
+	vs.virtualBackings = loaded.virtualBackings
+	vs.blobFiles = loaded.blobFiles
+	vs.minUnflushedLogNum = loaded.minUnflushedLogNum
+	vs.manifestFileNum = manifestFileNum
+	for i := range vs.metrics.Levels {
+		vs.metrics.Levels[i].NumFiles = loaded.metrics.Levels[i].NumFiles
+		vs.metrics.Levels[i].Size = loaded.metrics.Levels[i].Size
+	}
+	vs.metrics.Table.Local.LiveSize = loaded.metrics.Table.Local.LiveSize
+	// The loaded version holds the reference taken when it was appended to the
+	// loaded version set, so it's appended directly to the version list rather
+	// than through versionSet.append.
+	vs.versions.Back().UnrefLocked()
+	v.Deleted = vs.obsoleteFn
+	vs.versions.PushBack(v)
+	vs.picker = newCompactionPickerByScore(v, &vs.virtualBackings, vs.opts, nil)
+	d.ratchetFollowerSeqNumLocked(loaded.logSeqNum.Load())
+
+	f.manifestFileNum, f.manifestSize = manifestFileNum, stat.Size()
+	return nil
+}
+
+// refreshFollowerMemTablesLocked replays the WALs that aren't flushed as of
+// the current version into the memtables. The flushables of WALs that were
+// complete at a previous refresh are reused. d.mu must be held.
+func (d *DB) refreshFollowerMemTablesLocked() error {
+	f := &d.mu.follower
+	minUnflushedLogNum := d.mu.versions.minUnflushedLogNum
+
+	// Drop the flushables of the WALs that are flushed as of the current
+	// version, even if the replay below fails, as their writes are now read
+	// from sstables.
+	queue := d.mu.mem.queue[:0:0]
+	for _, entry := range d.mu.mem.queue {
+		if entry.logNum < minUnflushedLogNum {
+			entry.readerUnrefLocked(false /* deleteFiles */)
+			continue
+		}
+		queue = append(queue, entry)
+	}
+	d.mu.mem.queue = queue
+	for num := range f.wals {
+		if num < minUnflushedLogNum {
+			delete(f.wals, num)
+		}
+	}
+
+	wals, err := wal.Scan(f.walDirs...)
+	if err != nil {
+		return err
+	}
+	queue = nil
+	complete := make(map[base.DiskFileNum]flushableList)
+	for i, ll := range wals {
+		num := base.DiskFileNum(ll.Num)
+		if num < minUnflushedLogNum {
+			continue
+		}
+		if entries, ok := f.wals[num]; ok {
+			queue = append(queue, entries...)
+			complete[num] = entries
+			continue
+		}
+		entries, err := d.replayFollowerWALLocked(ll)
+		if err != nil {
+			for _, entry := range queue {
+				if _, ok := f.wals[entry.logNum]; !ok {
+					entry.readerUnrefLocked(false /* deleteFiles */)
+				}
+			}
+			return err
+		}
+		queue = append(queue, entries...)
+		// The last WAL may still be appended to, and is replayed again by the
+		// next refresh.
+		if i < len(wals)-1 {
+			complete[num] = entries
+		}
+	}
+
+	// Drop the previous flushables that aren't in the new queue, which were
+	// replayed from the WAL that was being written (or from WALs no longer
+	// found).
+	inQueue := make(map[*flushableEntry]struct{}, len(queue))
+	for _, entry := range queue {
+		inQueue[entry] = struct{}{}
+	}
+	for _, entry := range d.mu.mem.queue {
+		if _, ok := inQueue[entry]; !ok {
+			entry.readerUnrefLocked(false /* deleteFiles */)
+		}
+	}
+	f.wals = complete
+	d.mu.mem.queue = queue
+	d.mu.mem.mutable = nil
+	return nil
+}
+
+// replayFollowerWALLocked replays the WAL into new flushables. d.mu must be
+// held.
+func (d *DB) replayFollowerWALLocked(ll wal.LogicalLog) (flushableList, error) {
+	// In read-only mode, replayWAL appends the flushables it creates to the
+	// memtable queue, which is swapped out for the duration of the replay.
+	mutable, queue := d.mu.mem.mutable, d.mu.mem.queue
+	d.mu.mem.mutable, d.mu.mem.queue = nil, nil
+	defer func() {
+		d.mu.mem.mutable, d.mu.mem.queue = mutable, queue
+	}()
+	var ve versionEdit
+	_, maxSeqNum, err := d.replayWAL(d.newJobIDLocked(), &ve, ll, false /* strictWALTail */, nil /* truncated */)
+	entries := d.mu.mem.queue
+	if err != nil {
+		for _, entry := range entries {
+			entry.readerUnrefLocked(false /* deleteFiles */)
+		}
+		return nil, err
+	}
+	d.ratchetFollowerSeqNumLocked(maxSeqNum)
+	return entries, nil
+}
+
+// ratchetFollowerSeqNumLocked makes the writes with sequence numbers below
+// seqNum visible. d.mu must be held.
+func (d *DB) ratchetFollowerSeqNumLocked(seqNum uint64) {
+	if d.mu.versions.logSeqNum.Load() < seqNum {
+		d.mu.versions.logSeqNum.Store(seqNum)
+	}
+	if d.mu.versions.visibleSeqNum.Load() < seqNum {
+		d.mu.versions.visibleSeqNum.Store(seqNum)
+	}
+}
+
+// evictFollowerTablesLocked is the versionSet.obsoleteFn of a DB opened with
+// OpenReadOnly. The obsolete backings aren't deleted, since they're owned by
+// the primary; the tables that aren't part of the current version are only
+// evicted from the table cache. d.mu must be held.
+func (d *DB) evictFollowerTablesLocked(obsolete []*fileBacking) {
+	if len(obsolete) == 0 {
+		return
+	}
+	live := make(map[base.DiskFileNum]struct{})
+	d.mu.versions.addLiveFileNums(live)
+	for _, b := range obsolete {
+		if _, ok := live[b.DiskFileNum]; !ok {
+			d.tableCache.evict(b.DiskFileNum)
+		}
+	}
+}
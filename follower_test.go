@@ -0,0 +1,135 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func requireGet(t *testing.T, d *DB, key, expected string) {
+	t.Helper()
+	v, closer, err := d.Get([]byte(key))
+	if expected == "" {
+		require.True(t, errors.Is(err, ErrNotFound), "%s: %v", key, err)
+		return
+	}
+	require.NoError(t, err, key)
+	require.Equal(t, expected, string(v), key)
+	require.NoError(t, closer.Close())
+}
+
+func TestOpenReadOnlyFollower(t *testing.T) {
+	mem := vfs.NewMem()
+	primary, err := Open("db", &Options{FS: mem})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, primary.Close()) }()
+	require.NoError(t, primary.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, primary.Flush())
+
+	// The directory is locked by the primary.
+	_, err = Open("db", &Options{FS: mem, ReadOnly: true})
+	require.Error(t, err)
+
+	follower, err := OpenReadOnly("db", &Options{FS: mem}, FollowerOptions{})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, follower.Close()) }()
+	requireGet(t, follower, "a", "1")
+	require.ErrorIs(t, follower.Set([]byte("b"), nil, nil), ErrReadOnly)
+
+	// Without tailing the WAL, unflushed writes aren't visible.
+	require.NoError(t, primary.Set([]byte("b"), []byte("2"), nil))
+	require.NoError(t, follower.Refresh())
+	requireGet(t, follower, "b", "")
+
+	// An iterator reads the state as of its creation.
+	iter, err := follower.NewIter(nil)
+	require.NoError(t, err)
+	require.NoError(t, primary.Flush())
+	require.NoError(t, primary.Compact([]byte("a"), []byte("c"), false /* parallelize */))
+	require.NoError(t, follower.Refresh())
+	requireGet(t, follower, "b", "2")
+	var keys []string
+	for valid := iter.First(); valid; valid = iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	require.NoError(t, iter.Close())
+	require.Equal(t, []string{"a"}, keys)
+
+	// Refresh requires a DB opened with OpenReadOnly.
+	require.Error(t, primary.Refresh())
+}
+
+func TestOpenReadOnlyFollowerTailWAL(t *testing.T) {
+	mem := vfs.NewMem()
+	primary, err := Open("db", &Options{FS: mem})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, primary.Close()) }()
+	require.NoError(t, primary.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, primary.Merge([]byte("m"), []byte("x"), nil))
+
+	follower, err := OpenReadOnly("db", &Options{FS: mem}, FollowerOptions{TailWAL: true})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, follower.Close()) }()
+	requireGet(t, follower, "a", "1")
+	requireGet(t, follower, "m", "x")
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, primary.Merge([]byte("m"), []byte("y"), nil))
+		require.NoError(t, primary.Set([]byte(fmt.Sprintf("k%d", i)), []byte("v"), nil))
+		require.NoError(t, follower.Refresh())
+		requireGet(t, follower, fmt.Sprintf("k%d", i), "v")
+		if i == 1 {
+			// Rotate the WAL without flushing the previous one.
+			require.NoError(t, primary.Set([]byte("z"), make([]byte, 4<<20), nil))
+			require.NoError(t, follower.Refresh())
+		}
+	}
+	requireGet(t, follower, "m", "xyyy")
+
+	// Once the WALs are flushed, their writes are read from the sstables
+	// rather than the memtables, and aren't merged twice.
+	require.NoError(t, primary.Flush())
+	require.NoError(t, primary.Merge([]byte("m"), []byte("z"), nil))
+	require.NoError(t, follower.Refresh())
+	requireGet(t, follower, "m", "xyyyz")
+	requireGet(t, follower, "k0", "v")
+	m := follower.Metrics()
+	require.Greater(t, m.Total().NumFiles, int64(0))
+	require.Equal(t, int64(1), m.MemTable.Count)
+}
+
+func TestOpenReadOnlyFollowerRefreshInterval(t *testing.T) {
+	mem := vfs.NewMem()
+	primary, err := Open("db", &Options{FS: mem})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, primary.Close()) }()
+
+	follower, err := OpenReadOnly("db", &Options{FS: mem}, FollowerOptions{
+		RefreshInterval: time.Millisecond,
+		TailWAL:         true,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, follower.Close()) }()
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprintf("k%d", i)
+		require.NoError(t, primary.Set([]byte(key), []byte("v"), nil))
+		if i%2 == 0 {
+			require.NoError(t, primary.Flush())
+		}
+		require.Eventually(t, func() bool {
+			_, closer, err := follower.Get([]byte(key))
+			if err != nil {
+				return false
+			}
+			return closer.Close() == nil
+		}, 10*time.Second, time.Millisecond)
+	}
+}
@@ -187,6 +187,13 @@ const (
 
 	// TODO(msbutler): add major version for synthetic suffixes
 
+	// FormatWALCompression is a format major version that adds support for
+	// compressing the batches written to the WAL (see Options.WALCompression).
+	// Older versions of Pebble are unable to replay compressed WAL records, so
+	// compression is only enabled once the database's format major version has
+	// been ratcheted to FormatWALCompression.
+	FormatWALCompression
+
 	// -- Add new versions here --
 
 	// FormatNewest is the most recent format major version.
@@ -195,6 +202,14 @@ const (
 	// Experimental versions, which are excluded by FormatNewest (but can be used
 	// in tests) can be defined here.
 
+	// FormatBlobValues is a format major version that adds support for
+	// separating large values into blob files (see
+	// Options.Experimental.BlobValueThreshold). The blob files referenced by
+	// each sstable are recorded in new, backward-incompatible fields in the
+	// Manifest, and sstables hold blob handles in place of the separated
+	// values, which older versions of Pebble are unable to read.
+	FormatBlobValues
+
 	// -- Add experimental versions here --
 
 	// internalFormatNewest is the most recent, possibly experimental format major
@@ -222,7 +237,8 @@ func (v FormatMajorVersion) MaxTableFormat() sstable.TableFormat {
 	switch v {
 	case FormatDefault, FormatFlushableIngest, FormatPrePebblev1MarkedCompacted:
 		return sstable.TableFormatPebblev3
-	case FormatDeleteSizedAndObsolete, FormatVirtualSSTables, FormatSyntheticPrefixSuffix:
+	case FormatDeleteSizedAndObsolete, FormatVirtualSSTables, FormatSyntheticPrefixSuffix,
+		FormatWALCompression, FormatBlobValues:
 		return sstable.TableFormatPebblev4
 	default:
 		panic(fmt.Sprintf("pebble: unsupported format major version: %s", v))
@@ -234,7 +250,8 @@ func (v FormatMajorVersion) MaxTableFormat() sstable.TableFormat {
 func (v FormatMajorVersion) MinTableFormat() sstable.TableFormat {
 	switch v {
 	case FormatDefault, FormatFlushableIngest, FormatPrePebblev1MarkedCompacted,
-		FormatDeleteSizedAndObsolete, FormatVirtualSSTables, FormatSyntheticPrefixSuffix:
+		FormatDeleteSizedAndObsolete, FormatVirtualSSTables, FormatSyntheticPrefixSuffix,
+		FormatWALCompression, FormatBlobValues:
 		return sstable.TableFormatPebblev1
 	default:
 		panic(fmt.Sprintf("pebble: unsupported format major version: %s", v))
@@ -271,6 +288,12 @@ var formatMajorVersionMigrations = map[FormatMajorVersion]func(*DB) error{
 	FormatSyntheticPrefixSuffix: func(d *DB) error {
 		return d.finalizeFormatVersUpgrade(FormatSyntheticPrefixSuffix)
 	},
+	FormatWALCompression: func(d *DB) error {
+		return d.finalizeFormatVersUpgrade(FormatWALCompression)
+	},
+	FormatBlobValues: func(d *DB) error {
+		return d.finalizeFormatVersUpgrade(FormatBlobValues)
+	},
 }
 
 const formatVersionMarkerName = `format-version`
@@ -439,15 +462,62 @@ func (d *DB) compactMarkedFilesLocked() error {
 	return nil
 }
 
+// RewriteOutdatedTables rewrites the sstables written in a table format older
+// than the one written by compactions at the database's format major version
+// (typically FormatMajorVersion.MaxTableFormat), so that all the sstables
+// benefit from the features of the newer table format, and returns the number
+// of sstables rewritten. Ratcheting the format major version doesn't rewrite
+// sstables by itself.
+//
+// The sstables are durably marked for compaction, and rewritten by rewrite
+// compactions, which are subject to Options.RateLimiter. RewriteOutdatedTables
+// returns once all of the marked sstables have been rewritten. It requires
+// automatic compactions, which run the rewrite compactions.
+func (d *DB) RewriteOutdatedTables() (int, error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.opts.ReadOnly {
+		return 0, ErrReadOnly
+	}
+	if d.opts.DisableAutomaticCompactions {
+		return 0, errors.New("pebble: rewriting sstables requires automatic compactions")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	tableFormat := d.outputTableFormat(d.FormatMajorVersion())
+	var n int
+	err := d.markFilesLocked(func(v *version) (found bool, files [numLevels][]*fileMetadata, _ error) {
+		for l := range v.Levels {
+			iter := v.Levels[l].Iter()
+			for f := iter.First(); f != nil; f = iter.Next() {
+				var tf sstable.TableFormat
+				if err := d.tableCache.withBackingReader(f, func(r *sstable.Reader) (err error) {
+					tf, err = r.TableFormat()
+					return err
+				}); err != nil {
+					return false, files, err
+				}
+				if tf < tableFormat {
+					files[l] = append(files[l], f)
+					n++
+				}
+			}
+		}
+		return n > 0, files, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, d.compactMarkedFilesLocked()
+}
+
 // findFilesFunc scans the LSM for files, returning true if at least one
 // file was found. The returned array contains the matched files, if any, per
 // level.
 type findFilesFunc func(v *version) (found bool, files [numLevels][]*fileMetadata, _ error)
 
-// This method is not used currently, but it will be useful the next time we need
-// to mark files for compaction.
-var _ = (*DB)(nil).markFilesLocked
-
 // markFilesLocked durably marks the files that match the given findFilesFunc for
 // compaction.
 func (d *DB) markFilesLocked(findFn findFilesFunc) error {
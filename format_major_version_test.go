@@ -24,11 +24,13 @@ func TestFormatMajorVersionStableValues(t *testing.T) {
 	require.Equal(t, FormatDeleteSizedAndObsolete, FormatMajorVersion(15))
 	require.Equal(t, FormatVirtualSSTables, FormatMajorVersion(16))
 	require.Equal(t, FormatSyntheticPrefixSuffix, FormatMajorVersion(17))
+	require.Equal(t, FormatWALCompression, FormatMajorVersion(18))
+	require.Equal(t, FormatBlobValues, FormatMajorVersion(19))
 
 	// When we add a new version, we should add a check for the new version in
 	// addition to updating these expected values.
-	require.Equal(t, FormatNewest, FormatMajorVersion(17))
-	require.Equal(t, internalFormatNewest, FormatMajorVersion(17))
+	require.Equal(t, FormatNewest, FormatMajorVersion(18))
+	require.Equal(t, internalFormatNewest, FormatMajorVersion(19))
 }
 
 func TestFormatMajorVersion_MigrationDefined(t *testing.T) {
@@ -53,6 +55,10 @@ func TestRatchetFormat(t *testing.T) {
 	require.Equal(t, FormatVirtualSSTables, d.FormatMajorVersion())
 	require.NoError(t, d.RatchetFormatMajorVersion(FormatSyntheticPrefixSuffix))
 	require.Equal(t, FormatSyntheticPrefixSuffix, d.FormatMajorVersion())
+	require.NoError(t, d.RatchetFormatMajorVersion(FormatWALCompression))
+	require.Equal(t, FormatWALCompression, d.FormatMajorVersion())
+	require.NoError(t, d.RatchetFormatMajorVersion(FormatBlobValues))
+	require.Equal(t, FormatBlobValues, d.FormatMajorVersion())
 
 	require.NoError(t, d.Close())
 
@@ -208,6 +214,8 @@ func TestFormatMajorVersions_TableFormat(t *testing.T) {
 		FormatDeleteSizedAndObsolete:     {sstable.TableFormatPebblev1, sstable.TableFormatPebblev4},
 		FormatVirtualSSTables:            {sstable.TableFormatPebblev1, sstable.TableFormatPebblev4},
 		FormatSyntheticPrefixSuffix:      {sstable.TableFormatPebblev1, sstable.TableFormatPebblev4},
+		FormatWALCompression:             {sstable.TableFormatPebblev1, sstable.TableFormatPebblev4},
+		FormatBlobValues:                 {sstable.TableFormatPebblev1, sstable.TableFormatPebblev4},
 	}
 
 	// Valid versions.
@@ -222,3 +230,62 @@ func TestFormatMajorVersions_TableFormat(t *testing.T) {
 	require.Panics(t, func() { _ = fmv.MaxTableFormat() })
 	require.Panics(t, func() { _ = fmv.MinTableFormat() })
 }
+
+func TestRewriteOutdatedTables(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                 vfs.NewMem(),
+		FormatMajorVersion: FormatFlushableIngest,
+		// Prevent compactions of the flushed tables other than the rewrites.
+		L0CompactionThreshold: 100,
+		L0StopWritesThreshold: 1000,
+	})
+	require.NoError(t, err)
+	defer d.Close()
+
+	tableFormats := func() []sstable.TableFormat {
+		tables, err := d.SSTables(WithProperties())
+		require.NoError(t, err)
+		var formats []sstable.TableFormat
+		for _, level := range tables {
+			for _, table := range level {
+				formats = append(formats, table.TableFormat)
+			}
+		}
+		return formats
+	}
+	for _, k := range []string{"a", "b", "c"} {
+		require.NoError(t, d.Set([]byte(k), []byte(k), nil))
+		require.NoError(t, d.Flush())
+	}
+	require.Equal(t, []sstable.TableFormat{
+		sstable.TableFormatPebblev2, sstable.TableFormatPebblev2, sstable.TableFormatPebblev2,
+	}, tableFormats())
+
+	// The tables are already in the format written at this version.
+	n, err := d.RewriteOutdatedTables()
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	d.opts.DisableAutomaticCompactions = true
+	_, err = d.RewriteOutdatedTables()
+	require.Error(t, err)
+	d.opts.DisableAutomaticCompactions = false
+
+	require.NoError(t, d.RatchetFormatMajorVersion(FormatNewest))
+	n, err = d.RewriteOutdatedTables()
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+	for _, f := range tableFormats() {
+		require.Equal(t, sstable.TableFormatPebblev4, f)
+	}
+	n, err = d.RewriteOutdatedTables()
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	for _, k := range []string{"a", "b", "c"} {
+		v, closer, err := d.Get([]byte(k))
+		require.NoError(t, err)
+		require.Equal(t, k, string(v))
+		require.NoError(t, closer.Close())
+	}
+}
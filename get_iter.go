@@ -19,6 +19,7 @@ import (
 // internalIterator, but specialized for Get operations so that it loads data
 // lazily.
 type getIter struct {
+	ctx          context.Context
 	logger       Logger
 	comparer     *Comparer
 	newIters     tableNewIters
@@ -36,6 +37,8 @@ type getIter struct {
 	iterKey      *InternalKey
 	iterValue    base.LazyValue
 	err          error
+	// stats, if non-nil, accumulates the stats of the sstable iterators.
+	stats *base.InternalIteratorStats
 }
 
 // TODO(sumeer): CockroachDB code doesn't use getIter, but, for completeness,
@@ -164,7 +167,8 @@ func (g *getIter) Next() (*InternalKey, base.LazyValue) {
 			g.iter = m.newIter(nil)
 			g.rangeDelIter = m.newRangeDelIter(nil)
 			g.mem = g.mem[:n-1]
-			g.iterKey, g.iterValue = g.iter.SeekGE(g.key, base.SeekGEFlagsNone)
+			prefix := g.key[:g.comparer.Split(g.key)]
+			g.iterKey, g.iterValue = g.iter.SeekPrefixGE(prefix, g.key, base.SeekGEFlagsNone)
 			if err := g.iter.Error(); err != nil {
 				g.err = err
 				return nil, base.LazyValue{}
@@ -185,8 +189,8 @@ func (g *getIter) Next() (*InternalKey, base.LazyValue) {
 					},
 					logger:                        g.logger,
 					snapshotForHideObsoletePoints: g.snapshot}
-				g.levelIter.init(context.Background(), iterOpts, g.comparer, g.newIters,
-					files, manifest.L0Sublevel(n), internalIterOpts{})
+				g.levelIter.init(g.ctx, iterOpts, g.comparer, g.newIters,
+					files, manifest.L0Sublevel(n), internalIterOpts{stats: g.stats})
 				g.levelIter.initRangeDel(&g.rangeDelIter)
 				bc := levelIterBoundaryContext{}
 				g.levelIter.initBoundaryContext(&bc)
@@ -222,8 +226,8 @@ func (g *getIter) Next() (*InternalKey, base.LazyValue) {
 				Category: "pebble-get",
 				QoSLevel: sstable.LatencySensitiveQoSLevel,
 			}, logger: g.logger, snapshotForHideObsoletePoints: g.snapshot}
-		g.levelIter.init(context.Background(), iterOpts, g.comparer, g.newIters,
-			g.version.Levels[g.level].Iter(), manifest.Level(g.level), internalIterOpts{})
+		g.levelIter.init(g.ctx, iterOpts, g.comparer, g.newIters,
+			g.version.Levels[g.level].Iter(), manifest.Level(g.level), internalIterOpts{stats: g.stats})
 		g.levelIter.initRangeDel(&g.rangeDelIter)
 		bc := levelIterBoundaryContext{}
 		g.levelIter.initBoundaryContext(&bc)
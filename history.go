@@ -0,0 +1,308 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/errors/oserror"
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// ErrHistoryNotRetained is returned when reading a past state of the DB that
+// isn't retained. See Options.RetainHistory.
+var ErrHistoryNotRetained = errors.New("pebble: history not retained")
+
+// historyFilename is the name of the file persisting the history samples of
+// a DB retaining history, in the data directory.
+const historyFilename = "HISTORY"
+
+// historySamplesPerWindow is the number of history samples taken during
+// Options.RetainHistory.
+const historySamplesPerWindow = 16
+
+// historySample records the visible sequence number of the DB at a point in
+// time.
+type historySample struct {
+	time   time.Time
+	seqNum uint64
+}
+
+// historyState is the state of a DB retaining history. See
+// Options.RetainHistory.
+type historyState struct {
+	// samples are the sequence numbers visible at points in time, in increasing
+	// order. The first sample is the sample of the horizon.
+	samples []historySample
+	// horizon is the sequence number above which the history of the DB is
+	// retained: flushes and compactions don't drop any version of a key with a
+	// sequence number >= horizon, nor the newest version of a key with a
+	// sequence number < horizon, so that the DB may be read at any sequence
+	// number >= horizon. The horizon only increases, and is persisted before
+	// it's used by flushes and compactions. It's zero if the DB doesn't retain
+	// history.
+	horizon uint64
+
+	// The cumulative count and size of the obsolete keys newer than the horizon
+	// written to sstables.
+	cumulativePinnedCount uint64
+	cumulativePinnedSize  uint64
+}
+
+// initHistoryLocked loads the persisted history samples of the DB, if it
+// retains history, and starts the periodic sampling. d.mu must be held.
+func (d *DB) initHistoryLocked(ls []string) error {
+	path := d.opts.FS.PathJoin(d.dirname, historyFilename)
+	exists := false
+	for _, filename := range ls {
+		exists = exists || filename == historyFilename
+	}
+	if d.opts.RetainHistory == 0 {
+		// The history retained while the DB was previously open may have been
+		// dropped since, so the samples must not be used if the DB retains
+		// history again.
+		if exists && !d.opts.ReadOnly {
+			if err := d.opts.FS.Remove(path); err != nil && !oserror.IsNotExist(err) {
+				return err
+			}
+		}
+		return nil
+	}
+
+	h := &d.mu.history
+	if exists {
+		f, err := d.opts.FS.Open(path)
+		if err != nil {
+			return err
+		}
+		h.samples, h.horizon, err = readHistorySamples(f)
+		err = firstError(err, f.Close())
+		if err != nil {
+			return errors.Wrapf(err, "pebble: reading %q", path)
+		}
+	}
+	if h.horizon == 0 {
+		// The history before the DB is opened isn't retained.
+		h.horizon = d.mu.versions.visibleSeqNum.Load()
+		h.samples = []historySample{{time: d.timeNow(), seqNum: h.horizon}}
+	}
+	if d.opts.ReadOnly {
+		return nil
+	}
+	if err := d.writeHistoryLocked(h.samples, h.horizon); err != nil {
+		return err
+	}
+	interval := max(d.opts.RetainHistory/historySamplesPerWindow, time.Second)
+	d.compactionSchedulers.Add(1)
+	go d.historySampleLoop(interval)
+	return nil
+}
+
+func (d *DB) historySampleLoop(interval time.Duration) {
+	defer d.compactionSchedulers.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.closedCh:
+			return
+		case <-ticker.C:
+		}
+		if err := d.sampleHistory(); err != nil {
+			d.opts.Logger.Errorf("pebble: sampling history: %s", err)
+		}
+	}
+}
+
+// sampleHistory records the current visible sequence number of the DB,
+// advances the horizon past the history older than Options.RetainHistory, and
+// persists the samples.
+func (d *DB) sampleHistory() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed.Load() != nil {
+		return nil
+	}
+	h := &d.mu.history
+	now := d.timeNow()
+	seqNum := d.mu.versions.visibleSeqNum.Load()
+	if n := len(h.samples); n == 0 || h.samples[n-1].seqNum != seqNum {
+		h.samples = append(h.samples, historySample{time: now, seqNum: seqNum})
+	}
+	// The horizon is the newest sample taken at or before now-RetainHistory,
+	// so that the history is retained for at least RetainHistory.
+	cutoff := now.Add(-d.opts.RetainHistory)
+	i := sort.Search(len(h.samples), func(i int) bool {
+		return h.samples[i].time.After(cutoff)
+	})
+	if i == 0 || h.samples[i-1].seqNum <= h.horizon {
+		return d.writeHistoryLocked(h.samples, h.horizon)
+	}
+	samples := append([]historySample(nil), h.samples[i-1:]...)
+	horizon := samples[0].seqNum
+	if err := d.writeHistoryLocked(samples, horizon); err != nil {
+		return err
+	}
+	h.samples, h.horizon = samples, horizon
+	// The keys newer than the previous horizon may now be elided.
+	d.maybeScheduleCompactionPicker(pickElisionOnly)
+	return nil
+}
+
+// writeHistoryLocked persists the history samples, the first of which is the
+// sample of the horizon. The samples are written to a temporary file, renamed
+// to the history file, so that a crash doesn't corrupt the history file. d.mu
+// must be held, and is released while writing the file.
+func (d *DB) writeHistoryLocked(samples []historySample, horizon uint64) error {
+	fs := d.opts.FS
+	tmpPath := base.MakeFilepath(fs, d.dirname, fileTypeTemp, d.mu.versions.getNextDiskFileNum())
+	path := fs.PathJoin(d.dirname, historyFilename)
+
+	d.mu.Unlock()
+	defer d.mu.Lock()
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "horizon %d\n", horizon)
+	for _, s := range samples {
+		fmt.Fprintf(&buf, "%d %d\n", s.time.UnixNano(), s.seqNum)
+	}
+	f, err := fs.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		return errors.CombineErrors(err, f.Close())
+	}
+	if err := f.Sync(); err != nil {
+		return errors.CombineErrors(err, f.Close())
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := fs.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	return d.dataDir.Sync()
+}
+
+// readHistorySamples reads the history samples written by writeHistoryLocked.
+func readHistorySamples(r io.Reader) ([]historySample, uint64, error) {
+	var horizon uint64
+	var samples []historySample
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if horizon == 0 {
+			if _, err := fmt.Sscanf(scanner.Text(), "horizon %d", &horizon); err != nil || horizon == 0 {
+				return nil, 0, base.CorruptionErrorf("pebble: invalid history horizon %q", scanner.Text())
+			}
+			continue
+		}
+		var nanos int64
+		var seqNum uint64
+		if _, err := fmt.Sscanf(scanner.Text(), "%d %d", &nanos, &seqNum); err != nil {
+			return nil, 0, base.CorruptionErrorf("pebble: invalid history sample %q", scanner.Text())
+		}
+		samples = append(samples, historySample{time: time.Unix(0, nanos), seqNum: seqNum})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+	if len(samples) == 0 || samples[0].seqNum != horizon {
+		return nil, 0, base.CorruptionErrorf("pebble: history samples don't start at the horizon")
+	}
+	return samples, horizon, nil
+}
+
+// NewIterAtSeqNum returns an iterator over the state of the DB at the given
+// sequence number, i.e. over the keys written by the batches committed with
+// sequence numbers < seqNum. The state must be within the history retained by
+// the DB (see Options.RetainHistory): NewIterAtSeqNum returns an error
+// satisfying errors.Is(err, ErrHistoryNotRetained) if seqNum is older than
+// the retained history, and an error if seqNum is newer than the current
+// state of the DB. The current sequence number of the DB can be obtained from
+// the sequence number of a committed batch, or from SeqNumAt.
+//
+// The iterator isn't affected by the history expiring while it's open.
+func (d *DB) NewIterAtSeqNum(seqNum uint64, o *IterOptions) (*Iterator, error) {
+	return d.NewIterAtSeqNumWithContext(context.Background(), seqNum, o)
+}
+
+// NewIterAtSeqNumWithContext is like NewIterAtSeqNum, and additionally
+// accepts a context for tracing.
+func (d *DB) NewIterAtSeqNumWithContext(
+	ctx context.Context, seqNum uint64, o *IterOptions,
+) (*Iterator, error) {
+	if visible := d.mu.versions.visibleSeqNum.Load(); seqNum > visible {
+		return nil, errors.Errorf("pebble: sequence number %d is newer than the visible sequence number %d",
+			errors.Safe(seqNum), errors.Safe(visible))
+	}
+	iter := d.newIter(ctx, nil /* batch */, newIterOpts{
+		snapshot: snapshotIterOpts{seqNum: seqNum},
+	}, o)
+	// The history is checked once the iterator has loaded its read state: the
+	// sstables it reads were written by flushes and compactions that retained
+	// the history above the horizon at the time they started, which is <= the
+	// current horizon.
+	d.mu.Lock()
+	horizon := d.mu.history.horizon
+	d.mu.Unlock()
+	if horizon == 0 || seqNum < horizon {
+		return nil, errors.CombineErrors(
+			errors.Wrapf(ErrHistoryNotRetained, "pebble: sequence number %d is older than the retained history (%d)",
+				errors.Safe(seqNum), errors.Safe(horizon)),
+			iter.Close())
+	}
+	return iter, nil
+}
+
+// SeqNumAt returns the sequence number of the state of the DB at the given
+// time within the retained history, for use with NewIterAtSeqNum. The visible
+// sequence number of the DB is sampled periodically, every
+// Options.RetainHistory/16, and the sequence number returned is the one
+// sampled most recently at or before t. It returns an error satisfying
+// errors.Is(err, ErrHistoryNotRetained) if t is older than the retained
+// history.
+func (d *DB) SeqNumAt(t time.Time) (uint64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	h := &d.mu.history
+	i := sort.Search(len(h.samples), func(i int) bool {
+		return h.samples[i].time.After(t)
+	})
+	if h.horizon == 0 || i == 0 {
+		return 0, errors.Wrapf(ErrHistoryNotRetained, "pebble: %s is older than the retained history", t)
+	}
+	return h.samples[i-1].seqNum, nil
+}
+
+// historySnapshotIndex is like snapshotIndex, but additionally treats every
+// sequence number >= historyHorizon as a snapshot, if historyHorizon is
+// non-zero. The snapshots > historyHorizon are irrelevant. Every key with a
+// sequence number >= historyHorizon is thus in a snapshot stripe of its own,
+// so that no such key is dropped, and the keys < historyHorizon are in the
+// stripes of the snapshots < historyHorizon or in the stripe of
+// historyHorizon itself.
+func historySnapshotIndex(seq uint64, snapshots []uint64, historyHorizon uint64) (int, uint64) {
+	if historyHorizon == 0 {
+		return snapshotIndex(seq, snapshots)
+	}
+	n := sort.Search(len(snapshots), func(i int) bool {
+		return snapshots[i] >= historyHorizon
+	})
+	if seq >= historyHorizon {
+		return n + 1 + int(seq-historyHorizon), seq + 1
+	}
+	if index, snapshotSeqNum := snapshotIndex(seq, snapshots[:n]); index < n {
+		return index, snapshotSeqNum
+	}
+	return n, historyHorizon
+}
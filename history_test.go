@@ -0,0 +1,132 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistorySnapshotIndex(t *testing.T) {
+	testCases := []struct {
+		snapshots      []uint64
+		horizon        uint64
+		seq            uint64
+		expectedIndex  int
+		expectedSeqNum uint64
+	}{
+		{[]uint64{}, 0, 1, 0, InternalKeySeqNumMax},
+		{[]uint64{}, 5, 1, 0, 5},
+		{[]uint64{}, 5, 5, 1, 6},
+		{[]uint64{}, 5, 7, 3, 8},
+		{[]uint64{3}, 5, 1, 0, 3},
+		{[]uint64{3}, 5, 3, 1, 5},
+		{[]uint64{3}, 5, 5, 2, 6},
+		{[]uint64{3, 5, 9}, 5, 4, 1, 5},
+		{[]uint64{3, 5, 9}, 5, 10, 7, 11},
+	}
+	for _, c := range testCases {
+		t.Run("", func(t *testing.T) {
+			idx, seqNum := historySnapshotIndex(c.seq, c.snapshots, c.horizon)
+			require.Equal(t, c.expectedIndex, idx)
+			require.Equal(t, c.expectedSeqNum, seqNum)
+		})
+	}
+}
+
+func TestRetainHistory(t *testing.T) {
+	mem := vfs.NewMem()
+	opts := &Options{FS: mem, RetainHistory: time.Hour}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	var nowSecs atomic.Int64
+	nowSecs.Store(1000)
+	advance := func(d time.Duration) { nowSecs.Add(int64(d / time.Second)) }
+	d.timeNow = func() time.Time { return time.Unix(nowSecs.Load(), 0) }
+
+	readAt := func(seqNum uint64) string {
+		iter, err := d.NewIterAtSeqNum(seqNum, nil)
+		if err != nil {
+			return err.Error()
+		}
+		var buf strings.Builder
+		for valid := iter.First(); valid; valid = iter.Next() {
+			fmt.Fprintf(&buf, "%s:%s ", iter.Key(), iter.Value())
+		}
+		require.NoError(t, iter.Close())
+		return strings.TrimSpace(buf.String())
+	}
+	visible := func() uint64 { return d.mu.versions.visibleSeqNum.Load() }
+
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Set([]byte("b"), []byte("1"), nil))
+	seq1 := visible()
+	advance(10 * time.Minute)
+	require.NoError(t, d.sampleHistory())
+	sampled := time.Unix(nowSecs.Load(), 0)
+	advance(10 * time.Minute)
+	require.NoError(t, d.Set([]byte("a"), []byte("2"), nil))
+	require.NoError(t, d.Delete([]byte("b"), nil))
+	seq2 := visible()
+	require.NoError(t, d.Set([]byte("a"), []byte("3"), nil))
+	require.NoError(t, d.Compact([]byte("a"), []byte("c"), false))
+
+	// The history survives the compaction.
+	require.Equal(t, "a:1 b:1", readAt(seq1))
+	require.Equal(t, "a:2", readAt(seq2))
+	require.Equal(t, "a:3", readAt(visible()))
+	seqNum, err := d.SeqNumAt(sampled.Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, seq1, seqNum)
+	m := d.Metrics()
+	require.Less(t, m.History.Horizon, seq1)
+	require.Greater(t, m.History.PinnedKeys, uint64(0))
+	require.Contains(t, readAt(visible()+1), "newer than the visible sequence number")
+
+	// The history survives restarts.
+	horizon := m.History.Horizon
+	require.NoError(t, d.Close())
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	d.timeNow = func() time.Time { return time.Unix(nowSecs.Load(), 0) }
+	require.Equal(t, horizon, d.Metrics().History.Horizon)
+	require.Equal(t, "a:1 b:1", readAt(seq1))
+
+	// Once the sample is older than RetainHistory, the horizon advances to it,
+	// and the older history expires.
+	advance(55 * time.Minute)
+	require.NoError(t, d.sampleHistory())
+	require.Equal(t, seq1, d.Metrics().History.Horizon)
+	require.Equal(t, "a:1 b:1", readAt(seq1))
+	_, err = d.NewIterAtSeqNum(seq1-1, nil)
+	require.True(t, errors.Is(err, ErrHistoryNotRetained), "%v", err)
+	_, err = d.SeqNumAt(sampled.Add(-time.Minute))
+	require.True(t, errors.Is(err, ErrHistoryNotRetained), "%v", err)
+	require.NoError(t, d.Compact([]byte("a"), []byte("c"), false))
+	require.Equal(t, "a:1 b:1", readAt(seq1))
+	require.Equal(t, "a:2", readAt(seq2))
+
+	// Reopening the DB without retaining history drops the history.
+	require.NoError(t, d.Close())
+	opts.RetainHistory = 0
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	_, err = d.NewIterAtSeqNum(seq2, nil)
+	require.True(t, errors.Is(err, ErrHistoryNotRetained), "%v", err)
+	require.NoError(t, d.Close())
+	opts.RetainHistory = time.Hour
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	_, err = d.NewIterAtSeqNum(seq2, nil)
+	require.True(t, errors.Is(err, ErrHistoryNotRetained), "%v", err)
+	require.NoError(t, d.Close())
+}
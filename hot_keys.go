@@ -0,0 +1,293 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"cmp"
+	"hash/maphash"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// HotKeysOptions configures the sampling of hot keys. See Options.HotKeys.
+type HotKeysOptions struct {
+	// SamplingInterval is the interval at which the keys read and written are
+	// sampled: one in every SamplingInterval keys is sampled. The default value
+	// is 64.
+	SamplingInterval int
+	// TopK is the number of hot keys and hot key ranges that are tracked. The
+	// default value is 16.
+	TopK int
+	// RangePrefixLength is the length in bytes of the prefixes by which key
+	// ranges are tracked: the hottest key ranges are those of the key prefixes
+	// of RangePrefixLength bytes that are accessed the most. Key ranges are only
+	// meaningful if the Comparer orders keys bytewise, as the default Comparer
+	// does. The default value is 4.
+	RangePrefixLength int
+}
+
+// HotKeys describes the keys and key ranges that are accessed the most. See
+// DB.HotKeys.
+type HotKeys struct {
+	// Sampled is the number of keys sampled since the DB was opened.
+	Sampled int64
+	// Keys are the hottest keys, by decreasing Count.
+	Keys []HotKey
+	// Ranges are the hottest key ranges, by decreasing Count.
+	Ranges []HotKeyRange
+}
+
+// HotKey describes a hot key.
+type HotKey struct {
+	Key []byte
+	// Count is the estimated number of recent reads and writes of the key.
+	Count int64
+}
+
+// HotKeyRange describes a hot key range, holding the keys sharing a prefix of
+// HotKeysOptions.RangePrefixLength bytes.
+type HotKeyRange struct {
+	// Start and End are the inclusive start and exclusive end of the key
+	// range. End is nil if the range is unbounded.
+	Start, End []byte
+	// Count is the estimated number of recent reads and writes of the keys of
+	// the range.
+	Count int64
+}
+
+const (
+	// hotKeysSketchDepth and hotKeysSketchWidth are the dimensions of the
+	// count-min sketches estimating the counts of the sampled keys.
+	hotKeysSketchDepth = 4
+	hotKeysSketchWidth = 2048
+	// hotKeysDecayInterval is the number of samples after which all the counts
+	// are halved, so that the counts reflect recent accesses.
+	hotKeysDecayInterval = 1 << 16
+)
+
+// hotKeySampler samples the keys read and written when Options.HotKeys is set,
+// tracking the hottest keys and key ranges.
+type hotKeySampler struct {
+	interval  int64
+	prefixLen int
+	// n is the number of keys read and written since the DB was opened.
+	n atomic.Int64
+
+	mu struct {
+		sync.Mutex
+		sampled int64
+		keys    heavyHitters
+		ranges  heavyHitters
+	}
+}
+
+func newHotKeySampler(opts *Options) *hotKeySampler {
+	if opts.HotKeys == nil {
+		return nil
+	}
+	s := &hotKeySampler{
+		interval:  int64(opts.HotKeys.SamplingInterval),
+		prefixLen: opts.HotKeys.RangePrefixLength,
+	}
+	if s.interval <= 0 {
+		s.interval = 64
+	}
+	if s.prefixLen <= 0 {
+		s.prefixLen = 4
+	}
+	topK := opts.HotKeys.TopK
+	if topK <= 0 {
+		topK = 16
+	}
+	seed := maphash.MakeSeed()
+	s.mu.keys.init(topK, seed)
+	s.mu.ranges.init(topK, seed)
+	return s
+}
+
+// sample records an access of key, sampling one in every s.interval keys. It's
+// a no-op if s is nil.
+func (s *hotKeySampler) sample(key []byte) {
+	if s == nil || s.n.Add(1)%s.interval != 0 {
+		return
+	}
+	s.record(key)
+}
+
+// sampleBatch records the writes of the keys of the batch. It's a no-op if s
+// is nil.
+func (s *hotKeySampler) sampleBatch(b *Batch) {
+	if s == nil || b.Count() == 0 {
+		return
+	}
+	count := int64(b.Count())
+	end := s.n.Add(count)
+	start := end - count
+	if start/s.interval == end/s.interval {
+		// None of the batch's keys are sampled.
+		return
+	}
+	r := b.Reader()
+	for i := start + 1; i <= end; {
+		kind, key, _, ok, err := r.Next()
+		if !ok || err != nil {
+			return
+		}
+		// LogData records aren't included in the batch's count.
+		if kind == InternalKeyKindLogData {
+			continue
+		}
+		if i%s.interval == 0 {
+			s.record(key)
+		}
+		i++
+	}
+}
+
+func (s *hotKeySampler) record(key []byte) {
+	prefix := key
+	if len(prefix) > s.prefixLen {
+		prefix = prefix[:s.prefixLen]
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mu.sampled++
+	s.mu.keys.add(key)
+	s.mu.ranges.add(prefix)
+	if s.mu.sampled%hotKeysDecayInterval == 0 {
+		s.mu.keys.decay()
+		s.mu.ranges.decay()
+	}
+}
+
+// HotKeys returns the hottest keys and key ranges, as estimated from the keys
+// read and written if hot key sampling is enabled through Options.HotKeys. It
+// returns the zero HotKeys otherwise.
+//
+// Reads are sampled by Get and by the seeks of iterators, and writes by the
+// commit of batches. The counts are estimated from the sampled keys using
+// count-min sketches, and are periodically halved so that they reflect recent
+// accesses.
+//
+// HotKeys may be serialized as JSON, so that applications may expose hot keys
+// through a debug endpoint for use with the `pebble db hot-keys` tool command.
+func (d *DB) HotKeys() HotKeys {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	s := d.hotKeys
+	if s == nil {
+		return HotKeys{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hk := HotKeys{Sampled: s.mu.sampled}
+	for _, e := range s.mu.keys.top() {
+		hk.Keys = append(hk.Keys, HotKey{Key: []byte(e.key), Count: e.count * s.interval})
+	}
+	for _, e := range s.mu.ranges.top() {
+		hk.Ranges = append(hk.Ranges, HotKeyRange{
+			Start: []byte(e.key),
+			End:   prefixSuccessor([]byte(e.key)),
+			Count: e.count * s.interval,
+		})
+	}
+	return hk
+}
+
+// prefixSuccessor returns the smallest key that is greater than all the keys
+// prefixed by prefix, or nil if there is none.
+func prefixSuccessor(prefix []byte) []byte {
+	end := append([]byte(nil), prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] != 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+// heavyHitters tracks the k keys with the highest counts, as estimated by a
+// count-min sketch.
+type heavyHitters struct {
+	k      int
+	seed   maphash.Seed
+	sketch [hotKeysSketchDepth][hotKeysSketchWidth]int64
+	// entries holds up to k candidate keys and their estimated counts.
+	entries map[string]int64
+}
+
+type heavyHitter struct {
+	key   string
+	count int64
+}
+
+func (h *heavyHitters) init(k int, seed maphash.Seed) {
+	h.k = k
+	h.seed = seed
+	h.entries = make(map[string]int64, k)
+}
+
+// add increments the count of key, and tracks the key if its estimated count
+// is among the k highest.
+func (h *heavyHitters) add(key []byte) {
+	// Derive the hash of each row from two halves of the key's hash (see
+	// Kirsch and Mitzenmacher, "Less Hashing, Same Performance").
+	hash := maphash.Bytes(h.seed, key)
+	h1, h2 := uint32(hash), uint32(hash>>32)|1
+	est := int64(-1)
+	for i := range h.sketch {
+		c := &h.sketch[i][(h1+uint32(i)*h2)%hotKeysSketchWidth]
+		*c++
+		if est < 0 || *c < est {
+			est = *c
+		}
+	}
+	if _, ok := h.entries[string(key)]; ok || len(h.entries) < h.k {
+		h.entries[string(key)] = est
+		return
+	}
+	// Replace the tracked key with the lowest count, if its count is lower.
+	var minKey string
+	minCount := est
+	for k, c := range h.entries {
+		if c < minCount {
+			minKey, minCount = k, c
+		}
+	}
+	if minCount < est {
+		delete(h.entries, minKey)
+		h.entries[string(key)] = est
+	}
+}
+
+// decay halves all the counts.
+func (h *heavyHitters) decay() {
+	for i := range h.sketch {
+		for j := range h.sketch[i] {
+			h.sketch[i][j] /= 2
+		}
+	}
+	for k, c := range h.entries {
+		h.entries[k] = c / 2
+	}
+}
+
+// top returns the tracked keys by decreasing count.
+func (h *heavyHitters) top() []heavyHitter {
+	top := make([]heavyHitter, 0, len(h.entries))
+	for k, c := range h.entries {
+		top = append(top, heavyHitter{key: k, count: c})
+	}
+	slices.SortFunc(top, func(a, b heavyHitter) int {
+		if v := cmp.Compare(b.count, a.count); v != 0 {
+			return v
+		}
+		return cmp.Compare(a.key, b.key)
+	})
+	return top
+}
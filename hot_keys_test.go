@@ -0,0 +1,81 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHotKeys(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	require.Zero(t, d.HotKeys())
+	require.NoError(t, d.Close())
+
+	d, err = Open("", &Options{
+		FS:      vfs.NewMem(),
+		HotKeys: &HotKeysOptions{SamplingInterval: 1, TopK: 2, RangePrefixLength: 1},
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, d.Set([]byte("a1"), nil, nil))
+	}
+	for _, k := range []string{"b1", "b1", "b1", "b1", "b1", "b2", "b2", "b2"} {
+		_, _, err := d.Get([]byte(k))
+		require.ErrorIs(t, err, ErrNotFound)
+	}
+	iter, err := d.NewIter(nil)
+	require.NoError(t, err)
+	iter.SeekGE([]byte("c"))
+	require.NoError(t, iter.Close())
+
+	require.Equal(t, HotKeys{
+		Sampled: 19,
+		Keys: []HotKey{
+			{Key: []byte("a1"), Count: 10},
+			{Key: []byte("b1"), Count: 5},
+		},
+		Ranges: []HotKeyRange{
+			{Start: []byte("a"), End: []byte("b"), Count: 10},
+			{Start: []byte("b"), End: []byte("c"), Count: 8},
+		},
+	}, d.HotKeys())
+}
+
+func TestHotKeysSampleBatch(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:      vfs.NewMem(),
+		HotKeys: &HotKeysOptions{SamplingInterval: 4},
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// Every fourth key written is sampled; LogData records aren't counted.
+	b := d.NewBatch()
+	for i := 0; i < 10; i++ {
+		require.NoError(t, b.LogData([]byte("log"), nil))
+		require.NoError(t, b.Set([]byte(fmt.Sprint(i)), nil, nil))
+	}
+	require.NoError(t, b.Commit(nil))
+	hk := d.HotKeys()
+	require.Equal(t, int64(2), hk.Sampled)
+	require.Equal(t, []HotKey{
+		{Key: []byte("3"), Count: 4},
+		{Key: []byte("7"), Count: 4},
+	}, hk.Keys)
+}
+
+func TestPrefixSuccessor(t *testing.T) {
+	require.Equal(t, []byte("b"), prefixSuccessor([]byte("a")))
+	require.Equal(t, []byte("b"), prefixSuccessor([]byte("a\xff")))
+	require.Nil(t, prefixSuccessor([]byte("\xff\xff")))
+	require.Nil(t, prefixSuccessor(nil))
+}
@@ -9,9 +9,11 @@ import (
 	"fmt"
 	"slices"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/errors/oserror"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/invariants"
 	"github.com/cockroachdb/pebble/internal/keyspan"
@@ -87,6 +89,40 @@ func (k *KeyRange) OverlapsKeyRange(cmp Compare, span KeyRange) bool {
 	return cmp(k.Start, span.End) < 0 && cmp(k.End, span.Start) > 0
 }
 
+// keyRangesContain returns true if one of the key ranges contains both the
+// smallest and largest keys.
+func keyRangesContain(cmp Compare, spans []KeyRange, smallest, largest InternalKey) bool {
+	for i := range spans {
+		if spans[i].Contains(cmp, smallest) && spans[i].Contains(cmp, largest) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatKeyRanges formats the key ranges for error messages.
+func formatKeyRanges(spans []KeyRange) string {
+	var buf strings.Builder
+	for i := range spans {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		fmt.Fprintf(&buf, "[%s-%s)", spans[i].Start, spans[i].End)
+	}
+	return buf.String()
+}
+
+// keyRangesOverlap returns true if one of the key ranges overlaps with the
+// provided KeyRange.
+func keyRangesOverlap(cmp Compare, spans []KeyRange, span KeyRange) bool {
+	for i := range spans {
+		if spans[i].OverlapsKeyRange(cmp, span) {
+			return true
+		}
+	}
+	return false
+}
+
 func ingestValidateKey(opts *Options, key *InternalKey) error {
 	if key.Kind() == InternalKeyKindInvalid {
 		return base.CorruptionErrorf("pebble: external sstable has corrupted key: %s",
@@ -396,6 +432,10 @@ type ingestLoadResult struct {
 	external []ingestExternalMeta
 
 	externalFilesHaveLevel bool
+	// localFilesOverlap is set if the local files overlap each other (see
+	// DB.IngestOverlapping), in which case they're ordered by increasing
+	// precedence rather than by key.
+	localFilesOverlap bool
 }
 
 type ingestLocalMeta struct {
@@ -498,19 +538,19 @@ func ingestLoad(
 	return result, nil
 }
 
-func ingestSortAndVerify(cmp Compare, lr ingestLoadResult, exciseSpan KeyRange) error {
+func ingestSortAndVerify(cmp Compare, lr ingestLoadResult, exciseSpans []KeyRange) error {
 	// Verify that all the shared files (i.e. files in sharedMeta)
-	// fit within the exciseSpan.
+	// fit within one of the exciseSpans.
 	for _, f := range lr.shared {
-		if !exciseSpan.Contains(cmp, f.Smallest) || !exciseSpan.Contains(cmp, f.Largest) {
-			return errors.Newf("pebble: shared file outside of excise span, span [%s-%s), file = %s", exciseSpan.Start, exciseSpan.End, f.String())
+		if !keyRangesContain(cmp, exciseSpans, f.Smallest, f.Largest) {
+			return errors.Newf("pebble: shared file outside of excise spans %s, file = %s", formatKeyRanges(exciseSpans), f.String())
 		}
 	}
 
 	if lr.externalFilesHaveLevel {
 		for _, f := range lr.external {
-			if !exciseSpan.Contains(cmp, f.Smallest) || !exciseSpan.Contains(cmp, f.Largest) {
-				return base.AssertionFailedf("pebble: external file outside of excise span, span [%s-%s), file = %s", exciseSpan.Start, exciseSpan.End, f.String())
+			if !keyRangesContain(cmp, exciseSpans, f.Smallest, f.Largest) {
+				return base.AssertionFailedf("pebble: external file outside of excise spans %s, file = %s", formatKeyRanges(exciseSpans), f.String())
 			}
 		}
 	}
@@ -536,6 +576,14 @@ func ingestSortAndVerify(cmp Compare, lr ingestLoadResult, exciseSpan KeyRange)
 	if len(lr.local) <= 1 {
 		return nil
 	}
+	if lr.localFilesOverlap {
+		// The local files keep their order of precedence, in which they're
+		// assigned increasing sequence numbers (see ingestUpdateSeqNum).
+		if len(lr.shared) > 0 {
+			return base.AssertionFailedf("pebble: overlapping local sstables cannot be ingested alongside shared files")
+		}
+		return nil
+	}
 
 	// Sort according to the smallest key.
 	slices.SortFunc(lr.local, func(a, b ingestLocalMeta) int {
@@ -575,6 +623,24 @@ func ingestSortAndVerify(cmp Compare, lr ingestLoadResult, exciseSpan KeyRange)
 	return nil
 }
 
+// ingestLocalFilesOverlap returns true if any two of the local files overlap
+// each other.
+func ingestLocalFilesOverlap(cmp Compare, local []ingestLocalMeta) bool {
+	sorted := make([]*fileMetadata, len(local))
+	for i := range local {
+		sorted[i] = local[i].fileMetadata
+	}
+	slices.SortFunc(sorted, func(a, b *fileMetadata) int {
+		return cmp(a.Smallest.UserKey, b.Smallest.UserKey)
+	})
+	for i := 1; i < len(sorted); i++ {
+		if sstableKeyCompare(cmp, sorted[i-1].Largest, sorted[i].Smallest) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func ingestCleanup(objProvider objstorage.Provider, meta []ingestLocalMeta) error {
 	var firstErr error
 	for i := range meta {
@@ -1111,6 +1177,13 @@ func ingestTargetLevel(
 // need to already be present on the local vfs.FS. Foreign sstables must all fit
 // in an excise span, and are destined for a level specified in SharedSSTMeta.
 //
+// Paths of the form <locator>://<object-name> refer to sstables residing in
+// remote storage, when Options.Experimental.RemoteStorage is configured. These
+// are downloaded into the DB directory and ingested like local sstables; the
+// remote objects themselves are left in place. For example, if the
+// RemoteStorage factory resolves the locator "s3", the path
+// "s3://bucket/key.sst" refers to the object named "bucket/key.sst".
+//
 // All sstables *must* be Sync()'d by the caller after all bytes are written
 // and before its file handle is closed; failure to do so could violate
 // durability or lead to corrupted on-disk state. This method cannot, in a
@@ -1131,7 +1204,8 @@ func ingestTargetLevel(
 //  1. Allocate file numbers for every sstable being ingested.
 //  2. Load the metadata for all sstables being ingested.
 //  3. Sort the sstables by smallest key, verifying non overlap (for local
-//     sstables).
+//     sstables). Local sstables overlapping each other, which are only
+//     allowed by IngestOverlapping, keep their order of precedence instead.
 //  4. Hard link (or copy) the local sstables into the DB directory.
 //  5. Allocate a sequence number to use for all of the entries in the
 //     local sstables. This is the step where overlap with memtables is
@@ -1160,7 +1234,7 @@ func (d *DB) Ingest(paths []string) error {
 	if d.opts.ReadOnly {
 		return ErrReadOnly
 	}
-	_, err := d.ingest(paths, ingestTargetLevel, nil /* shared */, KeyRange{}, false, nil /* external */)
+	_, err := d.ingest(paths, ingestTargetLevel, nil /* shared */, nil /* exciseSpans */, false, nil /* external */, false /* allowOverlap */)
 	return err
 }
 
@@ -1248,7 +1322,30 @@ func (d *DB) IngestWithStats(paths []string) (IngestOperationStats, error) {
 	if d.opts.ReadOnly {
 		return IngestOperationStats{}, ErrReadOnly
 	}
-	return d.ingest(paths, ingestTargetLevel, nil, KeyRange{}, false, nil)
+	return d.ingest(paths, ingestTargetLevel, nil, nil, false, nil, false /* allowOverlap */)
+}
+
+// IngestOverlapping does the same as IngestWithStats, but the sstables may
+// overlap each other. The paths are ordered by increasing precedence: the
+// sstables are assigned increasing sequence numbers in the order of paths, so
+// that a key of an sstable shadows the keys with the same user key in the
+// sstables preceding it, and its range deletions delete the keys of the
+// sstables preceding it. The sstables are ingested atomically.
+//
+// An sstable overlapping a preceding sstable is ingested into a level above
+// it, which is L0 unless the lowest level the sstable could otherwise be
+// ingested into is above the level of the preceding sstable. Ingesting many
+// overlapping sstables thus fills L0. Additionally, overlapping sstables are
+// never ingested as flushables: if they overlap a memtable, the ingestion
+// waits for the memtable to be flushed.
+func (d *DB) IngestOverlapping(paths []string) (IngestOperationStats, error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.opts.ReadOnly {
+		return IngestOperationStats{}, ErrReadOnly
+	}
+	return d.ingest(paths, ingestTargetLevel, nil, nil, false, nil, true /* allowOverlap */)
 }
 
 // IngestExternalFiles does the same as IngestWithStats, and additionally
@@ -1266,7 +1363,7 @@ func (d *DB) IngestExternalFiles(external []ExternalFile) (IngestOperationStats,
 	if d.opts.Experimental.RemoteStorage == nil {
 		return IngestOperationStats{}, errors.New("pebble: cannot ingest external files without shared storage configured")
 	}
-	return d.ingest(nil, ingestTargetLevel, nil, KeyRange{}, false, external)
+	return d.ingest(nil, ingestTargetLevel, nil, nil, false, external, false /* allowOverlap */)
 }
 
 // IngestAndExcise does the same as IngestWithStats, and additionally accepts a
@@ -1307,7 +1404,133 @@ func (d *DB) IngestAndExcise(
 			v, FormatMinForSharedObjects,
 		)
 	}
-	return d.ingest(paths, ingestTargetLevel, shared, exciseSpan, sstsContainExciseTombstone, external)
+	var exciseSpans []KeyRange
+	if exciseSpan.Valid() {
+		exciseSpans = []KeyRange{exciseSpan}
+	}
+	return d.ingest(paths, ingestTargetLevel, shared, exciseSpans, sstsContainExciseTombstone, external, false /* allowOverlap */)
+}
+
+// Excise atomically deletes all data within the provided span, without reading
+// or rewriting any sstables. Sstables contained within the span are removed,
+// and sstables straddling its bounds are replaced by virtual sstables that
+// exclude it. Unflushed data overlapping the span is flushed first. The data is
+// removed from open snapshots too; only already-open iterators still observe
+// it.
+func (d *DB) Excise(span KeyRange) error {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.opts.ReadOnly {
+		return ErrReadOnly
+	}
+	if !span.Valid() || d.cmp(span.Start, span.End) >= 0 {
+		return errors.Errorf("pebble: invalid excise span [%q, %q)", span.Start, span.End)
+	}
+	if invariants.Enabled {
+		// Excise is only supported on prefix keys.
+		if d.opts.Comparer.Split(span.Start) != len(span.Start) {
+			panic("Excise called with suffixed start key")
+		}
+		if d.opts.Comparer.Split(span.End) != len(span.End) {
+			panic("Excise called with suffixed end key")
+		}
+	}
+	if v := d.FormatMajorVersion(); v < FormatVirtualSSTables {
+		return errors.Errorf(
+			"store has format major version %d; Excise requires at least %d",
+			v, FormatVirtualSSTables,
+		)
+	}
+	_, err := d.ingest(nil, ingestTargetLevel, nil, []KeyRange{span}, false /* sstsContainExciseTombstone */, nil, false /* allowOverlap */)
+	return err
+}
+
+// remoteIngestPathSeparator separates the locator from the object name in
+// ingestion paths that refer to sstables in remote storage.
+const remoteIngestPathSeparator = "://"
+
+// parseRemoteIngestPath parses an ingestion path of the form
+// <locator>://<object-name>. It returns ok=false if the path is not of that
+// form.
+func parseRemoteIngestPath(path string) (_ remote.Locator, objName string, ok bool) {
+	locator, objName, ok := strings.Cut(path, remoteIngestPathSeparator)
+	if !ok || locator == "" || objName == "" {
+		return "", "", false
+	}
+	return remote.Locator(locator), objName, true
+}
+
+// downloadRemoteIngestPaths downloads the sstables referenced by any remote
+// ingestion paths (see parseRemoteIngestPath) into temporary files in the DB
+// directory. It returns the paths to ingest, with remote paths replaced by the
+// paths of the downloaded files, along with the paths of the downloaded files.
+// The caller is responsible for removing the downloaded files, which are
+// returned even if an error occurs.
+//
+// If remote storage is not configured, paths is returned unchanged.
+func (d *DB) downloadRemoteIngestPaths(
+	paths []string,
+) (localPaths []string, downloaded []string, err error) {
+	if d.opts.Experimental.RemoteStorage == nil {
+		return paths, nil, nil
+	}
+	localPaths = paths
+	for i, path := range paths {
+		locator, objName, ok := parseRemoteIngestPath(path)
+		if !ok {
+			continue
+		}
+		if len(downloaded) == 0 {
+			// Don't modify the caller's slice.
+			localPaths = slices.Clone(paths)
+		}
+		d.mu.Lock()
+		fileNum := d.mu.versions.getNextDiskFileNum()
+		d.mu.Unlock()
+		// Use a temporary file name, so that the file is removed on Open if we
+		// crash before the ingestion completes.
+		tmpPath := base.MakeFilepath(d.opts.FS, d.dirname, fileTypeTemp, fileNum)
+		downloaded = append(downloaded, tmpPath)
+		if err := d.downloadRemoteObject(context.TODO(), locator, objName, tmpPath); err != nil {
+			return nil, downloaded, errors.Wrapf(err, "pebble: downloading %q for ingestion", path)
+		}
+		localPaths[i] = tmpPath
+	}
+	return localPaths, downloaded, nil
+}
+
+// downloadRemoteObject copies the named object in remote storage to the given
+// path in the DB's filesystem and syncs it.
+func (d *DB) downloadRemoteObject(
+	ctx context.Context, locator remote.Locator, objName string, path string,
+) error {
+	reader, size, err := d.objProvider.ReadExternalObject(ctx, locator, objName)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	f, err := d.opts.FS.Create(path)
+	if err != nil {
+		return err
+	}
+	const bufSize = 1 << 20 // 1 MB
+	buf := make([]byte, min(size, bufSize))
+	for off := int64(0); off < size; {
+		n := min(size-off, bufSize)
+		if err := reader.ReadAt(ctx, buf[:n], off); err != nil {
+			return errors.CombineErrors(err, f.Close())
+		}
+		if _, err := f.Write(buf[:n]); err != nil {
+			return errors.CombineErrors(err, f.Close())
+		}
+		off += n
+	}
+	if err := f.Sync(); err != nil {
+		return errors.CombineErrors(err, f.Close())
+	}
+	return f.Close()
 }
 
 // Both DB.mu and commitPipeline.mu must be held while this is called.
@@ -1400,10 +1623,15 @@ func (d *DB) handleIngestAsFlushable(
 		// This is WAL num of the next mutable memtable which comes after the
 		// ingestedFlushable in the flushable queue. The mutable memtable
 		// will be created below.
+		prevLogNum := newLogNum
 		newLogNum, _ = d.recycleWAL()
 		if err != nil {
 			return err
 		}
+		// A failure to rewrite the prepared batches retains the WAL of the
+		// current memtable, and is retried by the next rotation of the
+		// memtable. The ingest is unaffected.
+		d.notePreparedRelogLocked(d.relogPreparedLocked(nextSeqNum), prevLogNum)
 	}
 
 	d.mu.versions.metrics.Ingest.Count++
@@ -1426,14 +1654,18 @@ func (d *DB) ingest(
 	paths []string,
 	targetLevelFunc ingestTargetLevelFunc,
 	shared []SharedSSTMeta,
-	exciseSpan KeyRange,
+	exciseSpans []KeyRange,
 	sstsContainExciseTombstone bool,
 	external []ExternalFile,
+	allowOverlap bool,
 ) (IngestOperationStats, error) {
+	if err := d.checkLowDiskSpace(); err != nil {
+		return IngestOperationStats{}, err
+	}
 	if len(shared) > 0 && d.opts.Experimental.RemoteStorage == nil {
 		panic("cannot ingest shared sstables with nil SharedStorage")
 	}
-	if (exciseSpan.Valid() || len(shared) > 0 || len(external) > 0) && d.FormatMajorVersion() < FormatVirtualSSTables {
+	if (len(exciseSpans) > 0 || len(shared) > 0 || len(external) > 0) && d.FormatMajorVersion() < FormatVirtualSSTables {
 		return IngestOperationStats{}, errors.New("pebble: format major version too old for excise, shared or external sstable ingestion")
 	}
 	if len(external) > 0 && d.FormatMajorVersion() < FormatSyntheticPrefixSuffix {
@@ -1446,6 +1678,22 @@ func (d *DB) ingest(
 			}
 		}
 	}
+	// Download any sstables that reside in remote storage, so that they can be
+	// ingested as local sstables.
+	paths, downloaded, err := d.downloadRemoteIngestPaths(paths)
+	defer func() {
+		// On success, ingestion removes the downloaded files like any other
+		// local input; this only cleans up after failures.
+		for _, path := range downloaded {
+			if err := d.opts.FS.Remove(path); err != nil && !oserror.IsNotExist(err) {
+				d.opts.Logger.Errorf("ingest failed to remove downloaded file: %s", err)
+			}
+		}
+	}()
+	if err != nil {
+		return IngestOperationStats{}, err
+	}
+
 	// Allocate file numbers for all of the files being ingested and mark them as
 	// pending in order to prevent them from being deleted. Note that this causes
 	// the file number ordering to be out of alignment with sequence number
@@ -1467,13 +1715,17 @@ func (d *DB) ingest(
 		return IngestOperationStats{}, err
 	}
 
-	if loadResult.fileCount() == 0 {
+	if loadResult.fileCount() == 0 && len(exciseSpans) == 0 {
 		// All of the sstables to be ingested were empty. Nothing to do.
 		return IngestOperationStats{}, nil
 	}
 
-	// Verify the sstables do not overlap.
-	if err := ingestSortAndVerify(d.cmp, loadResult, exciseSpan); err != nil {
+	// Verify the sstables do not overlap, unless the local sstables are allowed
+	// to overlap each other.
+	if allowOverlap {
+		loadResult.localFilesOverlap = ingestLocalFilesOverlap(d.cmp, loadResult.local)
+	}
+	if err := ingestSortAndVerify(d.cmp, loadResult, exciseSpans); err != nil {
 		return IngestOperationStats{}, err
 	}
 
@@ -1511,9 +1763,9 @@ func (d *DB) ingest(
 		// Note that d.commit.mu is held by commitPipeline when calling prepare.
 
 		// Determine the set of bounds we care about for the purpose of checking
-		// for overlap among the flushables. If there's an excise span, we need
-		// to check for overlap with its bounds as well.
-		overlapBounds := make([]bounded, 0, loadResult.fileCount()+1)
+		// for overlap among the flushables. If there are excise spans, we need
+		// to check for overlap with their bounds as well.
+		overlapBounds := make([]bounded, 0, loadResult.fileCount()+len(exciseSpans))
 		for _, m := range loadResult.local {
 			overlapBounds = append(overlapBounds, m.fileMetadata)
 		}
@@ -1523,19 +1775,19 @@ func (d *DB) ingest(
 		for _, m := range loadResult.external {
 			overlapBounds = append(overlapBounds, m.fileMetadata)
 		}
-		if exciseSpan.Valid() {
-			overlapBounds = append(overlapBounds, &exciseSpan)
+		for i := range exciseSpans {
+			overlapBounds = append(overlapBounds, &exciseSpans[i])
 		}
 
 		d.mu.Lock()
 		defer d.mu.Unlock()
 
 		// Check if any of the currently-open EventuallyFileOnlySnapshots overlap
-		// in key ranges with the excise span. If so, we need to check for memtable
+		// in key ranges with the excise spans. If so, we need to check for memtable
 		// overlaps with all bounds of that EventuallyFileOnlySnapshot in addition
 		// to the ingestion's own bounds too.
 
-		if exciseSpan.Valid() {
+		if len(exciseSpans) > 0 {
 			for s := d.mu.snapshots.root.next; s != &d.mu.snapshots.root; s = s.next {
 				if s.efos == nil {
 					continue
@@ -1556,7 +1808,7 @@ func (d *DB) ingest(
 					}
 				}
 				for i := range s.efos.protectedRanges {
-					if !s.efos.protectedRanges[i].OverlapsKeyRange(d.cmp, exciseSpan) {
+					if !keyRangesOverlap(d.cmp, exciseSpans, s.efos.protectedRanges[i]) {
 						continue
 					}
 					// Our excise conflicts with this EFOS. We need to add its protected
@@ -1637,9 +1889,10 @@ func (d *DB) ingest(
 		hasRemoteFiles := len(shared) > 0 || len(external) > 0
 		canIngestFlushable := d.FormatMajorVersion() >= FormatFlushableIngest &&
 			(len(d.mu.mem.queue) < d.opts.MemTableStopWritesThreshold) &&
-			!d.opts.Experimental.DisableIngestAsFlushable() && !hasRemoteFiles
+			!d.opts.Experimental.DisableIngestAsFlushable() && !hasRemoteFiles &&
+			!loadResult.localFilesOverlap
 
-		if !canIngestFlushable || (exciseSpan.Valid() && !sstsContainExciseTombstone) {
+		if !canIngestFlushable || (len(exciseSpans) > 0 && !sstsContainExciseTombstone) || len(exciseSpans) > 1 {
 			// We're not able to ingest as a flushable,
 			// so we must synchronously flush.
 			//
@@ -1671,6 +1924,10 @@ func (d *DB) ingest(
 		for i := range fileMetas {
 			fileMetas[i] = loadResult.local[i].fileMetadata
 		}
+		var exciseSpan KeyRange
+		if len(exciseSpans) == 1 {
+			exciseSpan = exciseSpans[0]
+		}
 		err = d.handleIngestAsFlushable(fileMetas, seqNum, exciseSpan)
 	}
 
@@ -1688,11 +1945,11 @@ func (d *DB) ingest(
 			return
 		}
 
-		// If there's an excise being done atomically with the same ingest, we
+		// If there are excises being done atomically with the same ingest, we
 		// assign the lowest sequence number in the set of sequence numbers for this
-		// ingestion to the excise. Note that we've already allocated fileCount+1
+		// ingestion to the excises. Note that we've already allocated fileCount+1
 		// sequence numbers in this case.
-		if exciseSpan.Valid() {
+		if len(exciseSpans) > 0 {
 			seqNum++ // the first seqNum is reserved for the excise.
 		}
 		// Update the sequence numbers for all ingested sstables'
@@ -1720,7 +1977,7 @@ func (d *DB) ingest(
 
 		// Assign the sstables to the correct level in the LSM and apply the
 		// version edit.
-		ve, err = d.ingestApply(jobID, loadResult, targetLevelFunc, mut, exciseSpan, seqNum)
+		ve, err = d.ingestApply(jobID, loadResult, targetLevelFunc, mut, exciseSpans, seqNum)
 	}
 
 	// Only one ingest can occur at a time because if not, one would block waiting
@@ -1729,7 +1986,7 @@ func (d *DB) ingest(
 	// changes to the WAL and memtable. This will cause a bigger commit hiccup
 	// during ingestion.
 	seqNumCount := loadResult.fileCount()
-	if exciseSpan.Valid() {
+	if len(exciseSpans) > 0 {
 		seqNumCount++
 	}
 	d.commit.ingestSem <- struct{}{}
@@ -1751,6 +2008,11 @@ func (d *DB) ingest(
 		}
 	}
 
+	if loadResult.fileCount() == 0 {
+		// An excise without any sstables to ingest.
+		return IngestOperationStats{}, err
+	}
+
 	info := TableIngestInfo{
 		JobID:     int(jobID),
 		Err:       err,
@@ -1870,6 +2132,7 @@ func (d *DB) excise(
 			LargestSeqNum:   m.LargestSeqNum,
 			SyntheticPrefix: m.SyntheticPrefix,
 			SyntheticSuffix: m.SyntheticSuffix,
+			BlobFiles:       m.BlobFiles,
 		}
 		if m.HasPointKeys && !exciseSpan.ContainsInternalKey(d.cmp, m.SmallestPointKey) {
 			// This file will probably contain point keys.
@@ -1989,6 +2252,7 @@ func (d *DB) excise(
 		LargestSeqNum:   m.LargestSeqNum,
 		SyntheticPrefix: m.SyntheticPrefix,
 		SyntheticSuffix: m.SyntheticSuffix,
+		BlobFiles:       m.BlobFiles,
 	}
 	if m.HasPointKeys && !exciseSpan.ContainsInternalKey(d.cmp, m.LargestPointKey) {
 		// This file will probably contain point keys
@@ -2228,8 +2492,14 @@ func (d *DB) ingestSplit(
 		}
 		updateMetrics(splitFile, s.level, added)
 	}
-	// Flatten the version edit by removing any entries from ve.NewFiles that
-	// are also in ve.DeletedFiles.
+	flattenVersionEdit(ve)
+	return nil
+}
+
+// flattenVersionEdit flattens the version edit by removing any entries from
+// ve.NewFiles that are also in ve.DeletedFiles, i.e. the files that were
+// created and then excised or split by the same ingestion.
+func flattenVersionEdit(ve *versionEdit) {
 	newNewFiles := ve.NewFiles[:0]
 	for i := range ve.NewFiles {
 		fn := ve.NewFiles[i].Meta.FileNum
@@ -2241,7 +2511,6 @@ func (d *DB) ingestSplit(
 		}
 	}
 	ve.NewFiles = newNewFiles
-	return nil
 }
 
 func (d *DB) ingestApply(
@@ -2249,7 +2518,7 @@ func (d *DB) ingestApply(
 	lr ingestLoadResult,
 	findTargetLevel ingestTargetLevelFunc,
 	mut *memTable,
-	exciseSpan KeyRange,
+	exciseSpans []KeyRange,
 	exciseSeqNum uint64,
 ) (*versionEdit, error) {
 	d.mu.Lock()
@@ -2258,7 +2527,7 @@ func (d *DB) ingestApply(
 	ve := &versionEdit{
 		NewFiles: make([]newFileEntry, lr.fileCount()),
 	}
-	if exciseSpan.Valid() || (d.opts.Experimental.IngestSplit != nil && d.opts.Experimental.IngestSplit()) {
+	if len(exciseSpans) > 0 || (d.opts.Experimental.IngestSplit != nil && d.opts.Experimental.IngestSplit()) {
 		ve.DeletedFiles = map[manifest.DeletedFileEntry]*manifest.FileMetadata{}
 	}
 	metrics := make(map[int]*LevelMetrics)
@@ -2334,8 +2603,8 @@ func (d *DB) ingestApply(
 			f.Level = specifiedLevel
 		} else {
 			var splitFile *fileMetadata
-			if exciseSpan.Valid() && exciseSpan.Contains(d.cmp, m.Smallest) && exciseSpan.Contains(d.cmp, m.Largest) {
-				// This file fits perfectly within the excise span. We can slot it at
+			if keyRangesContain(d.cmp, exciseSpans, m.Smallest, m.Largest) {
+				// This file fits perfectly within an excise span. We can slot it at
 				// L6, or sharedLevelsStart - 1 if we have shared files.
 				if len(lr.shared) > 0 || lr.externalFilesHaveLevel {
 					f.Level = sharedLevelsStart - 1
@@ -2354,6 +2623,17 @@ func (d *DB) ingestApply(
 				// check from findTargetLevel, as that requires d.mu to be held.
 				f.Level, splitFile, err = findTargetLevel(
 					d.newIters, d.tableNewRangeKeyIter, iterOps, d.opts.Comparer, current, baseLevel, d.mu.compact.inProgress, m, shouldIngestSplit)
+				if lr.localFilesOverlap && i < len(lr.local) && f.Level > 0 {
+					// The file has a higher sequence number than the preceding
+					// local files, so it must be above those it overlaps.
+					bounds := m.UserKeyBounds()
+					for j := 0; j < i; j++ {
+						if prev := &ve.NewFiles[j]; prev.Level <= f.Level && prev.Meta.Overlaps(d.cmp, &bounds) {
+							f.Level, splitFile = 0, nil
+							break
+						}
+					}
+				}
 			}
 
 			if splitFile != nil {
@@ -2392,7 +2672,7 @@ func (d *DB) ingestApply(
 		levelMetrics.BytesIngested += m.Size
 		levelMetrics.TablesIngested++
 	}
-	// replacedFiles maps files excised due to exciseSpan (or splitFiles returned
+	// replacedFiles maps files excised due to exciseSpans (or splitFiles returned
 	// by ingestTargetLevel), to files that were created to replace it. This map
 	// is used to resolve references to split files in filesToSplit, as it is
 	// possible for a file that we want to split to no longer exist or have a
@@ -2412,8 +2692,9 @@ func (d *DB) ingestApply(
 			levelMetrics.Size += int64(added[i].Meta.Size)
 		}
 	}
-	if exciseSpan.Valid() {
-		// Iterate through all levels and find files that intersect with exciseSpan.
+	if len(exciseSpans) > 0 {
+		// Iterate through all levels and find files that intersect with each of
+		// exciseSpans.
 		//
 		// TODO(bilal): We could drop the DB mutex here as we don't need it for
 		// excises; we only need to hold the version lock which we already are
@@ -2428,27 +2709,52 @@ func (d *DB) ingestApply(
 		// see if any new compactions are conflicting with our chosen target levels
 		// for files, and if they are, we should signal those compactions to error
 		// out.
-		for level := range current.Levels {
-			overlaps := current.Overlaps(level, exciseSpan.UserKeyBounds())
-			iter := overlaps.Iter()
-
-			for m := iter.First(); m != nil; m = iter.Next() {
-				newFiles, err := d.excise(exciseSpan.UserKeyBounds(), m, ve, level)
-				if err != nil {
-					return nil, err
+		//
+		// A file overlapping with more than one of the excise spans is replaced
+		// by the excise of the first, so the excises of the later spans apply to
+		// the files that replaced it.
+		var exciseFile func(bounds base.UserKeyBounds, m *fileMetadata, level int) error
+		exciseFile = func(bounds base.UserKeyBounds, m *fileMetadata, level int) error {
+			if replaced, ok := replacedFiles[m.FileNum]; ok {
+				for i := range replaced {
+					if replaced[i].Meta.Overlaps(d.cmp, &bounds) {
+						if err := exciseFile(bounds, replaced[i].Meta, level); err != nil {
+							return err
+						}
+					}
 				}
+				return nil
+			}
+			newFiles, err := d.excise(bounds, m, ve, level)
+			if err != nil {
+				return err
+			}
 
-				if _, ok := ve.DeletedFiles[deletedFileEntry{
-					Level:   level,
-					FileNum: m.FileNum,
-				}]; !ok {
-					// We did not excise this file.
-					continue
+			if _, ok := ve.DeletedFiles[deletedFileEntry{
+				Level:   level,
+				FileNum: m.FileNum,
+			}]; !ok {
+				// We did not excise this file.
+				return nil
+			}
+			replacedFiles[m.FileNum] = newFiles
+			updateLevelMetricsOnExcise(m, level, newFiles)
+			return nil
+		}
+		for i := range exciseSpans {
+			bounds := exciseSpans[i].UserKeyBounds()
+			for level := range current.Levels {
+				overlaps := current.Overlaps(level, bounds)
+				iter := overlaps.Iter()
+
+				for m := iter.First(); m != nil; m = iter.Next() {
+					if err := exciseFile(bounds, m, level); err != nil {
+						return nil, err
+					}
 				}
-				replacedFiles[m.FileNum] = newFiles
-				updateLevelMetricsOnExcise(m, level, newFiles)
 			}
 		}
+		flattenVersionEdit(ve)
 	}
 	if len(filesToSplit) > 0 {
 		// For the same reasons as the above call to excise, we hold the db mutex
@@ -2457,7 +2763,7 @@ func (d *DB) ingestApply(
 			return nil, err
 		}
 	}
-	if len(filesToSplit) > 0 || exciseSpan.Valid() {
+	if len(filesToSplit) > 0 || len(exciseSpans) > 0 {
 		for c := range d.mu.compact.inProgress {
 			if c.versionEditApplied {
 				continue
@@ -2469,8 +2775,10 @@ func (d *DB) ingestApply(
 			// doing a [c,d) excise at the same time as this compaction, we will have
 			// to error out the whole compaction as we can't guarantee it hasn't/won't
 			// write a file overlapping with the excise span.
-			if exciseSpan.OverlapsInternalKeyRange(d.cmp, c.smallest, c.largest) {
-				c.cancel.Store(true)
+			for i := range exciseSpans {
+				if exciseSpans[i].OverlapsInternalKeyRange(d.cmp, c.smallest, c.largest) {
+					c.cancel.Store(true)
+				}
 			}
 			// Check if this compaction's inputs have been replaced due to an
 			// ingest-time split. In that case, cancel the compaction as a newly picked
@@ -2500,11 +2808,11 @@ func (d *DB) ingestApply(
 	}
 
 	// Check for any EventuallyFileOnlySnapshots that could be watching for
-	// an excise on this span. There should be none as the
+	// an excise on these spans. There should be none as the
 	// computePossibleOverlaps steps should have forced these EFOS to transition
 	// to file-only snapshots by now. If we see any that conflict with this
 	// excise, panic.
-	if exciseSpan.Valid() {
+	if len(exciseSpans) > 0 {
 		for s := d.mu.snapshots.root.next; s != &d.mu.snapshots.root; s = s.next {
 			// Skip non-EFOS snapshots, and also skip any EFOS that were created
 			// *after* the excise.
@@ -2517,7 +2825,7 @@ func (d *DB) ingestApply(
 			// global list of all protected ranges instead of having to peer into every
 			// snapshot.
 			for i := range efos.protectedRanges {
-				if efos.protectedRanges[i].OverlapsKeyRange(d.cmp, exciseSpan) {
+				if keyRangesOverlap(d.cmp, exciseSpans, efos.protectedRanges[i]) {
 					panic("unexpected excise of an EventuallyFileOnlySnapshot's bounds")
 				}
 			}
@@ -146,6 +146,47 @@ func TestIngestLoad(t *testing.T) {
 	})
 }
 
+func TestIngestBatchWriterPool(t *testing.T) {
+	mem := vfs.NewMem()
+	opts := &Options{FS: mem}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	p := sstable.NewBatchWriterPool(sstable.BatchWriterPoolOptions{
+		WriterOptions:  d.opts.MakeWriterOptions(0, d.FormatMajorVersion().MaxTableFormat()),
+		TargetFileSize: 4 << 10,
+		Create: func(i int) (string, objstorage.Writable, error) {
+			path := fmt.Sprintf("ext%d.sst", i)
+			f, err := mem.Create(path)
+			if err != nil {
+				return "", nil, err
+			}
+			return path, objstorageprovider.NewFileWritable(f), nil
+		},
+	})
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, p.Set([]byte(fmt.Sprintf("k%04d", i)), []byte("v")))
+	}
+	tables, err := p.Finish()
+	require.NoError(t, err)
+	require.Greater(t, len(tables), 1)
+	var paths []string
+	for _, table := range tables {
+		paths = append(paths, table.Path)
+	}
+	require.NoError(t, d.Ingest(paths))
+
+	iter, _ := d.NewIter(nil)
+	var n int
+	for valid := iter.First(); valid; valid = iter.Next() {
+		require.Equal(t, fmt.Sprintf("k%04d", n), string(iter.Key()))
+		n++
+	}
+	require.NoError(t, iter.Close())
+	require.Equal(t, 1000, n)
+}
+
 func TestIngestLoadRand(t *testing.T) {
 	mem := vfs.NewMem()
 	rng := rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
@@ -210,6 +251,10 @@ func TestIngestLoadRand(t *testing.T) {
 			require.NoError(t, err)
 
 			expected[i].Size = meta.Size
+			expected[i].Stats.KeySizes = meta.Properties.KeySizes
+			expected[i].Stats.ValueSizes = meta.Properties.ValueSizes
+			expected[i].Stats.DataBlockSizes = meta.Properties.DataBlockSizes
+			expected[i].Stats.CompressedDataBlockSizes = meta.Properties.CompressedDataBlockSizes
 			expected[i].InitPhysicalBacking()
 		}()
 	}
@@ -281,7 +326,7 @@ func TestIngestSortAndVerify(t *testing.T) {
 					})
 				}
 				lr := ingestLoadResult{local: meta}
-				err := ingestSortAndVerify(cmp, lr, KeyRange{})
+				err := ingestSortAndVerify(cmp, lr, nil /* exciseSpans */)
 				if err != nil {
 					return fmt.Sprintf("%v\n", err)
 				}
@@ -717,6 +762,19 @@ func TestExcise(t *testing.T) {
 			}
 			return ""
 
+		case "excise-span":
+			// Excises the span without ingesting any sstables.
+			if len(td.CmdArgs) != 2 {
+				panic("insufficient args for excise-span command")
+			}
+			if err := d.Excise(KeyRange{
+				Start: []byte(td.CmdArgs[0].Key),
+				End:   []byte(td.CmdArgs[1].Key),
+			}); err != nil {
+				return err.Error()
+			}
+			return ""
+
 		case "file-only-snapshot":
 			if len(td.CmdArgs) != 1 {
 				panic("insufficient args for file-only-snapshot command")
@@ -2453,6 +2511,59 @@ func TestIngest(t *testing.T) {
 	})
 }
 
+func TestIngestRemotePath(t *testing.T) {
+	mem := vfs.NewMem()
+	storage := remote.NewInMem()
+	opts := &Options{FS: mem, Logger: testLogger{t}}
+	opts.Experimental.RemoteStorage = remote.MakeSimpleFactory(map[remote.Locator]remote.Storage{
+		"s3": storage,
+	})
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// Write an sstable directly to remote storage.
+	obj, err := storage.CreateObject("bucket/ext.sst")
+	require.NoError(t, err)
+	w := sstable.NewWriter(objstorageprovider.NewRemoteWritable(obj), sstable.WriterOptions{})
+	require.NoError(t, w.Set([]byte("a"), []byte("1")))
+	require.NoError(t, w.Set([]byte("b"), []byte("2")))
+	require.NoError(t, w.Close())
+
+	// Also ingest a local sstable alongside the remote one.
+	f, err := mem.Create("local.sst")
+	require.NoError(t, err)
+	w = sstable.NewWriter(objstorageprovider.NewFileWritable(f), sstable.WriterOptions{})
+	require.NoError(t, w.Set([]byte("c"), []byte("3")))
+	require.NoError(t, w.Close())
+
+	paths := []string{"s3://bucket/ext.sst", "local.sst"}
+	require.NoError(t, d.Ingest(paths))
+	// The caller's paths are unmodified.
+	require.Equal(t, []string{"s3://bucket/ext.sst", "local.sst"}, paths)
+
+	for k, v := range map[string]string{"a": "1", "b": "2", "c": "3"} {
+		val, closer, err := d.Get([]byte(k))
+		require.NoError(t, err)
+		require.Equal(t, v, string(val))
+		require.NoError(t, closer.Close())
+	}
+
+	// The remote object is left in place and no downloaded files linger.
+	_, err = storage.Size("bucket/ext.sst")
+	require.NoError(t, err)
+	ls, err := mem.List("")
+	require.NoError(t, err)
+	for _, name := range ls {
+		ft, _, ok := base.ParseFilename(mem, name)
+		require.False(t, ok && ft == fileTypeTemp, "unexpected temporary file %s", name)
+	}
+
+	// Unknown locators and missing objects are reported as errors.
+	require.Error(t, d.Ingest([]string{"gcs://bucket/ext.sst"}))
+	require.Error(t, d.Ingest([]string{"s3://bucket/missing.sst"}))
+}
+
 func TestIngestError(t *testing.T) {
 	for i := int32(0); ; i++ {
 		mem := vfs.NewMem()
@@ -2830,6 +2941,78 @@ func TestIngestStats(t *testing.T) {
 	require.NoError(t, d.Close())
 }
 
+func TestIngestOverlapping(t *testing.T) {
+	mem := vfs.NewMem()
+	opts := &Options{FS: mem}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	// The memtable overlaps the ingested sstables, and is older.
+	require.NoError(t, d.Set([]byte("a"), []byte("mem"), nil))
+
+	type op struct{ kind, start, end string }
+	write := func(name string, ops ...op) string {
+		f, err := mem.Create(name)
+		require.NoError(t, err)
+		w := sstable.NewWriter(objstorageprovider.NewFileWritable(f), sstable.WriterOptions{})
+		for _, o := range ops {
+			if o.kind == "del-range" {
+				require.NoError(t, w.DeleteRange([]byte(o.start), []byte(o.end)))
+			} else {
+				require.NoError(t, w.Set([]byte(o.start), []byte(o.end)))
+			}
+		}
+		require.NoError(t, w.Close())
+		return name
+	}
+	paths := func() []string {
+		return []string{
+			write("ext0", op{"set", "a", "0"}, op{"set", "b", "0"}, op{"set", "c", "0"}, op{"set", "d", "0"}),
+			write("ext1", op{"set", "b", "1"}, op{"del-range", "c", "d"}, op{"set", "e", "1"}),
+			write("ext2", op{"set", "a", "2"}),
+			write("ext3", op{"set", "z", "3"}),
+		}
+	}
+	read := func() string {
+		iter, err := d.NewIter(nil)
+		require.NoError(t, err)
+		var buf strings.Builder
+		for valid := iter.First(); valid; valid = iter.Next() {
+			fmt.Fprintf(&buf, "%s:%s ", iter.Key(), iter.Value())
+		}
+		require.NoError(t, iter.Close())
+		return strings.TrimSpace(buf.String())
+	}
+
+	// Ingest rejects overlapping sstables.
+	err = d.Ingest(paths())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "overlapping ranges")
+
+	_, err = d.IngestOverlapping(paths())
+	require.NoError(t, err)
+	const expected = "a:2 b:1 d:0 e:1 z:3"
+	require.Equal(t, expected, read())
+
+	// The order of precedence survives compactions and restarts.
+	require.NoError(t, d.Compact([]byte("a"), []byte("zz"), false))
+	require.Equal(t, expected, read())
+	require.NoError(t, d.Close())
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	require.Equal(t, expected, read())
+
+	// Sstables ingested together that don't overlap each other are ingested
+	// like with Ingest.
+	stats, err := d.IngestOverlapping([]string{
+		write("ext4", op{"set", "x", "4"}),
+		write("ext5", op{"set", "y", "5"}),
+	})
+	require.NoError(t, err)
+	require.EqualValues(t, 0, stats.ApproxIngestedIntoL0Bytes)
+	require.Equal(t, "a:2 b:1 d:0 e:1 x:4 y:5 z:3", read())
+	require.NoError(t, d.Close())
+}
+
 func TestIngestFlushQueuedLargeBatch(t *testing.T) {
 	// Verify that ingestion forces a flush of a queued large batch.
 
@@ -27,6 +27,8 @@ func TestParseFilename(t *testing.T) {
 		"abcdef.log":             false,
 		"000001ldb":              false,
 		"000001.sst":             true,
+		"000001.blob":            true,
+		"000001.blobx":           false,
 		"CURRENT":                false,
 		"LOCK":                   true,
 		"xLOCK":                  false,
@@ -65,6 +67,7 @@ func TestFilenameRoundTrip(t *testing.T) {
 		FileTypeOptions:  true,
 		FileTypeOldTemp:  true,
 		FileTypeTemp:     true,
+		FileTypeBlob:     true,
 		// NB: Log filenames are created and parsed elsewhere in the wal/
 		// package.
 		// FileTypeLog:      true,
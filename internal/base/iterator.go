@@ -368,11 +368,21 @@ type InternalIteratorStats struct {
 	BlockBytes uint64
 	// Subset of BlockBytes that were in the block cache.
 	BlockBytesInCache uint64
+	// The number of loaded blocks, corresponding to BlockBytes.
+	BlockReads uint64
+	// Subset of BlockReads that were in the block cache.
+	BlockReadsInCache uint64
 	// BlockReadDuration accumulates the duration spent fetching blocks
 	// due to block cache misses.
 	// TODO(sumeer): this currently excludes the time spent in Reader creation,
 	// and in reading the rangedel and rangekey blocks. Fix that.
 	BlockReadDuration time.Duration
+	// Bytes produced by decompressing the loaded blocks that were not in the
+	// block cache.
+	BlockBytesDecompressed uint64
+	// The number of SeekPrefixGE calls on sstables whose filter excluded the
+	// sought prefix, avoiding the loading of data blocks.
+	FilterNegatives uint64
 	// The following can repeatedly count the same points if they are iterated
 	// over multiple times. Additionally, they may count a point twice when
 	// switching directions. The latter could be improved if needed.
@@ -415,7 +425,11 @@ type InternalIteratorStats struct {
 func (s *InternalIteratorStats) Merge(from InternalIteratorStats) {
 	s.BlockBytes += from.BlockBytes
 	s.BlockBytesInCache += from.BlockBytesInCache
+	s.BlockReads += from.BlockReads
+	s.BlockReadsInCache += from.BlockReadsInCache
 	s.BlockReadDuration += from.BlockReadDuration
+	s.BlockBytesDecompressed += from.BlockBytesDecompressed
+	s.FilterNegatives += from.FilterNegatives
 	s.KeyBytes += from.KeyBytes
 	s.ValueBytes += from.ValueBytes
 	s.PointCount += from.PointCount
@@ -93,6 +93,16 @@ type Merger struct {
 	// Pebble stores the merger name on disk, and opening a database with a
 	// different merger from the one it was created with will result in an error.
 	Name string
+
+	// CollapseChains, if true, permits compactions to transform a chain of
+	// merge operands that isn't preceded by any older value of the key, either
+	// within the compaction or beneath it, into a SET of the result of
+	// Finish(true /* includesBase */). The collapsed value is then no longer
+	// merged by reads and later compactions. Since reads always finish merges
+	// with includesBase set, this is safe for any merger whose result doesn't
+	// depend on later merges with older values that may since have been
+	// deleted.
+	CollapseChains bool
 }
 
 // AppendValueMerger concatenates merge operands in order from oldest to newest.
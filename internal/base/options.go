@@ -64,6 +64,33 @@ type FilterPolicy interface {
 	NewWriter(ftype FilterType) FilterWriter
 }
 
+// PrefixExtractor extracts the prefixes of keys that are added to filters (see
+// FilterPolicy), in place of the prefixes returned by Comparer.Split. The
+// extractor is applied to the Split prefix of each key, and the filters are
+// checked by SeekPrefixGE with the extracted prefix of the prefix sought.
+// This allows filters to hold a coarser (e.g. fixed-length) prefix than the
+// one that defines the keys iterated by SeekPrefixGE.
+//
+// Like a FilterPolicy's name, a PrefixExtractor's name is written to the
+// sstables whose filters hold its prefixes. The filters of sstables written
+// with a different extractor are ignored, which does not affect correctness
+// but may affect performance.
+type PrefixExtractor struct {
+	// Name names the prefix extractor.
+	Name string
+
+	// Extract returns the length of the portion of prefix to add to filters,
+	// where prefix is the Split prefix of a key. Lengths beyond len(prefix)
+	// are truncated.
+	Extract func(prefix []byte) int
+}
+
+// FilterKey returns the portion of a key's Split prefix that is added to
+// filters.
+func (e *PrefixExtractor) FilterKey(prefix []byte) []byte {
+	return prefix[:min(e.Extract(prefix), len(prefix))]
+}
+
 // BlockPropertyFilter is used in an Iterator to filter sstables and blocks
 // within the sstable. It should not maintain any per-sstable state, and must
 // be thread-safe.
@@ -86,6 +86,13 @@ type shard struct {
 	blocks       blockMap // fileNum+offset -> block
 	files        blockMap // fileNum -> list of blocks
 
+	// pinned holds the pinned blocks, by file and offset. Pinned blocks are
+	// kept outside of the CLOCK-Pro lists, so the clock hands never evict
+	// them, and their size shrinks the target size of the shard.
+	pinned      map[fileKey]map[uint64]*Value
+	sizePinned  int64
+	countPinned int64
+
 	// The blocks and files maps store values in manually managed memory that is
 	// invisible to the Go GC. This is fine for Value and entry objects that are
 	// stored in manually managed memory, but when the "invariants" build tag is
@@ -119,6 +126,9 @@ func (c *shard) Get(id uint64, fileNum base.DiskFileNum, offset uint64) Handle {
 		if value != nil {
 			e.referenced.Store(true)
 		}
+	} else if v := c.pinned[fileKey{id, fileNum}][offset]; v != nil {
+		value = v
+		value.acquire()
 	}
 	c.mu.RUnlock()
 	if value == nil {
@@ -138,6 +148,17 @@ func (c *shard) Set(id uint64, fileNum base.DiskFileNum, offset uint64, value *V
 	defer c.mu.Unlock()
 
 	k := key{fileKey{id, fileNum}, offset}
+	if old := c.pinned[k.fileKey][offset]; old != nil {
+		// The block is pinned; replace the pinned value.
+		value.ref.trace("add-pinned")
+		value.acquire()
+		c.pinned[k.fileKey][offset] = value
+		c.sizePinned += int64(len(value.buf)) - int64(len(old.buf))
+		old.release()
+		c.clampColdTarget()
+		c.evict()
+		return Handle{value: value}
+	}
 	e, _ := c.blocks.Get(k)
 
 	switch {
@@ -210,6 +231,8 @@ func (c *shard) checkConsistency() {
 	case c.sizeHot < 0 || c.sizeCold < 0 || c.sizeTest < 0 || c.countHot < 0 || c.countCold < 0 || c.countTest < 0:
 		panic(fmt.Sprintf("pebble: unexpected negative: %d (%d bytes) hot, %d (%d bytes) cold, %d (%d bytes) test",
 			c.countHot, c.sizeHot, c.countCold, c.sizeCold, c.countTest, c.sizeTest))
+	case c.sizePinned < 0 || c.countPinned < 0:
+		panic(fmt.Sprintf("pebble: unexpected negative: %d (%d bytes) pinned", c.countPinned, c.sizePinned))
 	case c.sizeHot > 0 && c.countHot == 0:
 		panic(fmt.Sprintf("pebble: mismatch %d hot size, %d hot count", c.sizeHot, c.countHot))
 	case c.sizeCold > 0 && c.countCold == 0:
@@ -226,6 +249,9 @@ func (c *shard) Delete(id uint64, fileNum base.DiskFileNum, offset uint64) {
 	k := key{fileKey{id, fileNum}, offset}
 	c.mu.RLock()
 	_, exists := c.blocks.Get(k)
+	if !exists {
+		_, exists = c.pinned[k.fileKey][offset]
+	}
 	c.mu.RUnlock()
 	if !exists {
 		return
@@ -236,6 +262,14 @@ func (c *shard) Delete(id uint64, fileNum base.DiskFileNum, offset uint64) {
 		c.mu.Lock()
 		defer c.mu.Unlock()
 
+		if blocks := c.pinned[k.fileKey]; blocks[offset] != nil {
+			deletedValue = blocks[offset]
+			delete(blocks, offset)
+			c.sizePinned -= int64(len(deletedValue.buf))
+			c.countPinned--
+			c.clampColdTarget()
+			return
+		}
 		e, _ := c.blocks.Get(k)
 		if e == nil {
 			return
@@ -250,6 +284,7 @@ func (c *shard) Delete(id uint64, fileNum base.DiskFileNum, offset uint64) {
 
 // EvictFile evicts all of the cache values for the specified file.
 func (c *shard) EvictFile(id uint64, fileNum base.DiskFileNum) {
+	c.UnpinFile(id, fileNum)
 	fkey := key{fileKey{id, fileNum}, 0}
 	for c.evictFileRun(fkey) {
 		// Sched switch to give another goroutine an opportunity to acquire the
@@ -302,10 +337,85 @@ func (c *shard) evictFileRun(fkey key) (moreRemaining bool) {
 	return true
 }
 
+// Pin pins the cached value for the specified file and offset, returning a
+// handle to it. It returns an empty handle if no value is cached.
+func (c *shard) Pin(id uint64, fileNum base.DiskFileNum, offset uint64) Handle {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	k := key{fileKey{id, fileNum}, offset}
+	if value := c.pinned[k.fileKey][offset]; value != nil {
+		value.acquire()
+		return Handle{value: value}
+	}
+	e, _ := c.blocks.Get(k)
+	if e == nil || e.peekValue() == nil {
+		return Handle{}
+	}
+	// Move the value out of the CLOCK-Pro lists, transferring the entry's
+	// reference on it to the pinned map.
+	value := c.metaEvict(e)
+	value.ref.trace("pin")
+	if c.pinned == nil {
+		c.pinned = make(map[fileKey]map[uint64]*Value)
+	}
+	blocks := c.pinned[k.fileKey]
+	if blocks == nil {
+		blocks = make(map[uint64]*Value)
+		c.pinned[k.fileKey] = blocks
+	}
+	blocks[offset] = value
+	c.sizePinned += int64(len(value.buf))
+	c.countPinned++
+	c.clampColdTarget()
+	c.evict()
+	c.checkConsistency()
+
+	value.acquire()
+	return Handle{value: value}
+}
+
+// UnpinFile evicts the pinned values of the specified file.
+func (c *shard) UnpinFile(id uint64, fileNum base.DiskFileNum) {
+	var values []*Value
+	func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		fkey := fileKey{id, fileNum}
+		blocks := c.pinned[fkey]
+		if blocks == nil {
+			return
+		}
+		delete(c.pinned, fkey)
+		values = make([]*Value, 0, len(blocks))
+		for _, v := range blocks {
+			c.sizePinned -= int64(len(v.buf))
+			c.countPinned--
+			values = append(values, v)
+		}
+		c.clampColdTarget()
+		c.checkConsistency()
+	}()
+	// Release the values once the mutex has been dropped, as doing so may free
+	// their memory.
+	for _, v := range values {
+		v.release()
+	}
+}
+
 func (c *shard) Free() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	for fkey, blocks := range c.pinned {
+		for _, v := range blocks {
+			v.release()
+		}
+		delete(c.pinned, fkey)
+	}
+	c.sizePinned = 0
+	c.countPinned = 0
+
 	// NB: we use metaDel rather than metaEvict in order to avoid the expensive
 	// metaCheck call when the "invariants" build tag is specified.
 	for c.handHot != nil {
@@ -322,30 +432,41 @@ func (c *shard) Reserve(n int) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.reservedSize += int64(n)
+	c.clampColdTarget()
+	c.evict()
+	c.checkConsistency()
+}
 
-	// Changing c.reservedSize will either increase or decrease
-	// the targetSize. But we want coldTarget to be in the range
-	// [0, targetSize]. So, if c.targetSize decreases, make sure
-	// that the coldTarget fits within the limits.
-	targetSize := c.targetSize()
-	if c.coldTarget > targetSize {
-		c.coldTarget = targetSize
-	}
-
+// SetMaxSize sets the max size of the shard.
+func (c *shard) SetMaxSize(size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxSize = size
+	c.clampColdTarget()
 	c.evict()
 	c.checkConsistency()
 }
 
+// clampColdTarget ensures the coldTarget is within the range [0, targetSize].
+// Changing c.reservedSize or c.sizePinned will either increase or decrease the
+// targetSize, so if c.targetSize decreases, make sure that the coldTarget fits
+// within the limits.
+func (c *shard) clampColdTarget() {
+	if targetSize := c.targetSize(); c.coldTarget > targetSize {
+		c.coldTarget = targetSize
+	}
+}
+
 // Size returns the current space used by the cache.
 func (c *shard) Size() int64 {
 	c.mu.RLock()
-	size := c.sizeHot + c.sizeCold
+	size := c.sizeHot + c.sizeCold + c.sizePinned
 	c.mu.RUnlock()
 	return size
 }
 
 func (c *shard) targetSize() int64 {
-	target := c.maxSize - c.reservedSize
+	target := c.maxSize - c.reservedSize - c.sizePinned
 	// Always return a positive integer for targetSize. This is so that we don't
 	// end up in an infinite loop in evict(), in cases where reservedSize is
 	// greater than or equal to maxSize.
@@ -618,6 +739,10 @@ type Metrics struct {
 	Size int64
 	// The count of objects (blocks or tables) in the cache.
 	Count int64
+	// The number of bytes of pinned objects, included in Size.
+	PinnedSize int64
+	// The count of pinned objects, included in Count.
+	PinnedCount int64
 	// The number of cache hits.
 	Hits int64
 	// The number of cache misses.
@@ -662,7 +787,7 @@ type Metrics struct {
 // "tracing" produces a significant slowdown, while "invariants" does not.
 type Cache struct {
 	refs    atomic.Int64
-	maxSize int64
+	maxSize atomic.Int64
 	idAlloc atomic.Uint64
 	shards  []shard
 
@@ -715,9 +840,9 @@ func New(size int64) *Cache {
 
 func newShards(size int64, shards int) *Cache {
 	c := &Cache{
-		maxSize: size,
-		shards:  make([]shard, shards),
+		shards: make([]shard, shards),
 	}
+	c.maxSize.Store(size)
 	c.refs.Store(1)
 	c.idAlloc.Store(1)
 	c.trace("alloc", c.refs.Load())
@@ -833,9 +958,38 @@ func (c *Cache) EvictFile(id uint64, fileNum base.DiskFileNum) {
 	}
 }
 
+// Pin pins the cache value for the specified file and offset, so that it's
+// never evicted to make room for other values. The value remains pinned until
+// it's deleted, or until UnpinFile or EvictFile is called for the file. The
+// size of the pinned values shrinks the space available to other values. A
+// Handle to the pinned value is returned; it's empty if no value was cached.
+func (c *Cache) Pin(id uint64, fileNum base.DiskFileNum, offset uint64) Handle {
+	return c.getShard(id, fileNum, offset).Pin(id, fileNum, offset)
+}
+
+// UnpinFile evicts the pinned cache values for the specified file.
+func (c *Cache) UnpinFile(id uint64, fileNum base.DiskFileNum) {
+	if id == 0 {
+		panic("pebble: 0 cache ID is invalid")
+	}
+	for i := range c.shards {
+		c.shards[i].UnpinFile(id, fileNum)
+	}
+}
+
 // MaxSize returns the max size of the cache.
 func (c *Cache) MaxSize() int64 {
-	return c.maxSize
+	return c.maxSize.Load()
+}
+
+// SetMaxSize sets the max size of the cache, evicting values if the cache
+// shrinks below its current size. The size is that of the cache shared by all
+// the DBs it's associated with.
+func (c *Cache) SetMaxSize(size int64) {
+	c.maxSize.Store(size)
+	for i := range c.shards {
+		c.shards[i].SetMaxSize(size / int64(len(c.shards)))
+	}
 }
 
 // Size returns the current space used by the cache.
@@ -893,8 +1047,10 @@ func (c *Cache) Metrics() Metrics {
 	for i := range c.shards {
 		s := &c.shards[i]
 		s.mu.RLock()
-		m.Count += int64(s.blocks.Len())
-		m.Size += s.sizeHot + s.sizeCold
+		m.Count += int64(s.blocks.Len()) + s.countPinned
+		m.Size += s.sizeHot + s.sizeCold + s.sizePinned
+		m.PinnedCount += s.countPinned
+		m.PinnedSize += s.sizePinned
 		s.mu.RUnlock()
 		m.Hits += s.hits.Load()
 		m.Misses += s.misses.Load()
@@ -122,6 +122,63 @@ func TestEvictFile(t *testing.T) {
 	}
 }
 
+func TestPin(t *testing.T) {
+	cache := newShards(100, 1)
+	defer cache.Unref()
+
+	// A value that isn't cached can't be pinned.
+	require.Nil(t, cache.Pin(1, base.DiskFileNum(0), 0).Get())
+	cache.Set(1, base.DiskFileNum(0), 0, testValue(cache, "a", 10)).Release()
+	cache.Set(1, base.DiskFileNum(0), 1, testValue(cache, "b", 10)).Release()
+	h := cache.Pin(1, base.DiskFileNum(0), 0)
+	require.Equal(t, bytes.Repeat([]byte("a"), 10), h.Get())
+	h.Release()
+	cache.Pin(1, base.DiskFileNum(0), 0).Release()
+	m := cache.Metrics()
+	require.EqualValues(t, 20, m.Size)
+	require.EqualValues(t, 2, m.Count)
+	require.EqualValues(t, 10, m.PinnedSize)
+	require.EqualValues(t, 1, m.PinnedCount)
+
+	// Filling the cache doesn't evict the pinned value.
+	for i := 1; i <= 20; i++ {
+		cache.Set(1, base.DiskFileNum(i), 0, testValue(cache, "c", 10)).Release()
+	}
+	require.LessOrEqual(t, cache.Size(), int64(100))
+	h = cache.Get(1, base.DiskFileNum(0), 0)
+	require.Equal(t, bytes.Repeat([]byte("a"), 10), h.Get())
+	h.Release()
+
+	// Setting a pinned value replaces it, and it stays pinned.
+	cache.Set(1, base.DiskFileNum(0), 0, testValue(cache, "d", 20)).Release()
+	require.EqualValues(t, 20, cache.Metrics().PinnedSize)
+	h = cache.Get(1, base.DiskFileNum(0), 0)
+	require.Equal(t, bytes.Repeat([]byte("d"), 20), h.Get())
+	h.Release()
+
+	cache.UnpinFile(1, base.DiskFileNum(0))
+	require.Nil(t, cache.Get(1, base.DiskFileNum(0), 0).Get())
+	require.Zero(t, cache.Metrics().PinnedSize)
+
+	// Evicting a file evicts its pinned values.
+	cache.Set(1, base.DiskFileNum(30), 0, testValue(cache, "e", 5)).Release()
+	cache.Pin(1, base.DiskFileNum(30), 0).Release()
+	cache.EvictFile(1, base.DiskFileNum(30))
+	require.Nil(t, cache.Get(1, base.DiskFileNum(30), 0).Get())
+	require.Zero(t, cache.Metrics().PinnedCount)
+
+	// As does deleting the value.
+	cache.Set(1, base.DiskFileNum(31), 0, testValue(cache, "f", 5)).Release()
+	cache.Pin(1, base.DiskFileNum(31), 0).Release()
+	cache.Delete(1, base.DiskFileNum(31), 0)
+	require.Nil(t, cache.Get(1, base.DiskFileNum(31), 0).Get())
+	require.Zero(t, cache.Metrics().PinnedCount)
+
+	// The cache may be freed with pinned values.
+	cache.Set(1, base.DiskFileNum(32), 0, testValue(cache, "g", 5)).Release()
+	cache.Pin(1, base.DiskFileNum(32), 0).Release()
+}
+
 func TestEvictAll(t *testing.T) {
 	// Verify that it is okay to evict all of the data from a cache. Previously
 	// this would trigger a nil-pointer dereference.
@@ -185,6 +242,26 @@ func TestReserve(t *testing.T) {
 	require.EqualValues(t, 4, cache.Size())
 }
 
+func TestSetMaxSize(t *testing.T) {
+	cache := newShards(4, 2)
+	defer cache.Unref()
+
+	for i := uint64(1); i <= 4; i++ {
+		cache.Set(i, base.DiskFileNum(0), 0, testValue(cache, "a", 1)).Release()
+	}
+	require.EqualValues(t, 4, cache.Size())
+	// Shrinking the cache evicts values.
+	cache.SetMaxSize(2)
+	require.EqualValues(t, 2, cache.MaxSize())
+	require.LessOrEqual(t, cache.Size(), int64(2))
+	// Growing the cache makes room for more values.
+	cache.SetMaxSize(8)
+	for i := uint64(1); i <= 6; i++ {
+		cache.Set(i, base.DiskFileNum(0), 0, testValue(cache, "a", 1)).Release()
+	}
+	require.EqualValues(t, 6, cache.Size())
+}
+
 func TestReserveDoubleRelease(t *testing.T) {
 	cache := newShards(100, 1)
 	defer cache.Unref()
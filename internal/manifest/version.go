@@ -49,6 +49,8 @@ type TableStats struct {
 	NumEntries uint64
 	// The number of point and range deletion entries in the table.
 	NumDeletions uint64
+	// The number of range deletion entries in the table.
+	NumRangeDeletions uint64
 	// NumRangeKeySets is the total number of range key sets in the table.
 	//
 	// NB: If there's a chance that the sstable contains any range key sets,
@@ -72,6 +74,16 @@ type TableStats struct {
 	RangeDeletionsBytesEstimate uint64
 	// Total size of value blocks and value index block.
 	ValueBlocksSize uint64
+	// MaxExpiry is the latest expiry time of the table's point keys, in
+	// nanoseconds since the Unix epoch, as recorded by the expiry block
+	// property. It is zero if the table has no keys with an expiry.
+	MaxExpiry uint64
+	// Histograms of the sizes of the table's point keys and values, and of the
+	// uncompressed and compressed sizes of its data blocks. See
+	// sstable.Properties.KeySizes. They're empty for virtual tables, and for
+	// tables written before the histograms were recorded.
+	KeySizes, ValueSizes                     sstable.SizeHistogram
+	DataBlockSizes, CompressedDataBlockSizes sstable.SizeHistogram
 }
 
 // boundType represents the type of key (point or range) present as the smallest
@@ -276,6 +288,12 @@ type FileMetadata struct {
 
 	// SyntheticSuffix overrides all suffixes in a table; used for some virtual tables.
 	SyntheticSuffix sstable.SyntheticSuffix
+
+	// BlobFiles holds the blob files referenced by the table's backing, in
+	// increasing order. Blob files remain live while any backing referencing
+	// them is live. Virtual sstables inherit the BlobFiles of the physical
+	// sstable from which they're created.
+	BlobFiles []base.DiskFileNum
 }
 
 // InternalKeyBounds returns the set of overall table bounds.
@@ -69,6 +69,7 @@ const (
 	customTagVirtual           = 66
 	customTagSyntheticPrefix   = 67
 	customTagSyntheticSuffix   = 68
+	customTagBlobFiles         = 69
 )
 
 // DeletedFileEntry holds the state for a file deletion from a level. The file
@@ -344,6 +345,7 @@ func (v *VersionEdit) Decode(r io.Reader) error {
 			}{}
 			var syntheticPrefix sstable.SyntheticPrefix
 			var syntheticSuffix sstable.SyntheticSuffix
+			var blobFiles []base.DiskFileNum
 			if tag == tagNewFile4 || tag == tagNewFile5 {
 				for {
 					customTag, err := d.readUvarint()
@@ -396,6 +398,15 @@ func (v *VersionEdit) Decode(r io.Reader) error {
 							return err
 						}
 
+					case customTagBlobFiles:
+						field, err := d.readBytes()
+						if err != nil {
+							return err
+						}
+						if blobFiles, err = decodeBlobFiles(field); err != nil {
+							return err
+						}
+
 					default:
 						if (customTag & customTagNonSafeIgnoreMask) != 0 {
 							return base.CorruptionErrorf("new-file4: custom field not supported: %d", customTag)
@@ -416,6 +427,7 @@ func (v *VersionEdit) Decode(r io.Reader) error {
 				Virtual:             virtualState.virtual,
 				SyntheticPrefix:     syntheticPrefix,
 				SyntheticSuffix:     syntheticSuffix,
+				BlobFiles:           blobFiles,
 			}
 			if tag != tagNewFile5 { // no range keys present
 				m.SmallestPointKey = base.DecodeInternalKey(smallestPointKey)
@@ -641,7 +653,8 @@ func (v *VersionEdit) Encode(w io.Writer) error {
 		e.writeUvarint(uint64(x.FileNum))
 	}
 	for _, x := range v.NewFiles {
-		customFields := x.Meta.MarkedForCompaction || x.Meta.CreationTime != 0 || x.Meta.Virtual
+		customFields := x.Meta.MarkedForCompaction || x.Meta.CreationTime != 0 || x.Meta.Virtual ||
+			len(x.Meta.BlobFiles) > 0
 		var tag uint64
 		switch {
 		case x.Meta.HasRangeKeys:
@@ -706,6 +719,10 @@ func (v *VersionEdit) Encode(w io.Writer) error {
 				e.writeUvarint(customTagSyntheticSuffix)
 				e.writeBytes(x.Meta.SyntheticSuffix)
 			}
+			if len(x.Meta.BlobFiles) > 0 {
+				e.writeUvarint(customTagBlobFiles)
+				e.writeBytes(encodeBlobFiles(x.Meta.BlobFiles))
+			}
 			e.writeUvarint(customTagTerminate)
 		}
 	}
@@ -713,6 +730,37 @@ func (v *VersionEdit) Encode(w io.Writer) error {
 	return err
 }
 
+// encodeBlobFiles encodes the file numbers of the blob files referenced by a
+// table as a count followed by the file numbers, each as a uvarint.
+func encodeBlobFiles(blobFiles []base.DiskFileNum) []byte {
+	buf := binary.AppendUvarint(nil, uint64(len(blobFiles)))
+	for _, fileNum := range blobFiles {
+		buf = binary.AppendUvarint(buf, uint64(fileNum))
+	}
+	return buf
+}
+
+func decodeBlobFiles(field []byte) ([]base.DiskFileNum, error) {
+	n, m := binary.Uvarint(field)
+	if m <= 0 || n > uint64(len(field)) {
+		return nil, base.CorruptionErrorf("new-file4: invalid blob files")
+	}
+	field = field[m:]
+	blobFiles := make([]base.DiskFileNum, n)
+	for i := range blobFiles {
+		fileNum, m := binary.Uvarint(field)
+		if m <= 0 {
+			return nil, base.CorruptionErrorf("new-file4: invalid blob files")
+		}
+		blobFiles[i] = base.DiskFileNum(fileNum)
+		field = field[m:]
+	}
+	if len(field) != 0 {
+		return nil, base.CorruptionErrorf("new-file4: invalid blob files")
+	}
+	return blobFiles, nil
+}
+
 // versionEditDecoder should be used to decode version edits.
 type versionEditDecoder struct {
 	byteReader
@@ -131,6 +131,7 @@ func TestVersionEditRoundTrip(t *testing.T) {
 		LargestSeqNum:       5,
 		MarkedForCompaction: true,
 		SyntheticSuffix:     []byte("foo"),
+		BlobFiles:           []base.DiskFileNum{801, 803},
 	}).ExtendPointKeyBounds(
 		cmp,
 		base.DecodeInternalKey([]byte("A\x00\x01\x02\x03\x04\x05\x06\x07")),
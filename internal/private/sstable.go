@@ -16,12 +16,6 @@ var SSTableCacheOpts func(cacheID uint64, fileNum base.DiskFileNum) interface{}
 // the tombstones contained in an sstable.
 var SSTableRawTombstonesOpt interface{}
 
-// SSTableWriterDisableKeyOrderChecks is a hook for disabling the key ordering
-// invariant check performed by sstable.Writer. It is intended for internal use
-// only in the construction of invalid sstables for testing. See
-// tool/make_test_sstables.go.
-var SSTableWriterDisableKeyOrderChecks func(interface{})
-
 // SSTableInternalProperties is a func(*sstable.Writer) *sstable.Properties
 // function that allows Pebble-internal code to mutate properties that external
 // sstable writers are not permitted to edit. It's an untyped interface{} to
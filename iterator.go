@@ -7,7 +7,9 @@ package pebble
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"io"
+	"slices"
 	"sync"
 	"unsafe"
 
@@ -121,6 +123,43 @@ type IteratorStats struct {
 	ReverseStepCount [NumStatsKind]int
 	InternalStats    InternalIteratorStats
 	RangeKeyStats    RangeKeyIteratorStats
+	// Levels breaks down the stats of the iteration of the tables by level.
+	// The stats of the levels are included in InternalStats.
+	Levels [numLevels]LevelIteratorStats
+}
+
+// LevelIteratorStats contains the stats of the iteration of the tables of a
+// level. The stats of the L0 sublevels are combined.
+type LevelIteratorStats struct {
+	// BlockReads is the number of blocks loaded, and BlockReadsInCache the
+	// subset of them that were in the block cache.
+	BlockReads        uint64
+	BlockReadsInCache uint64
+	// BlockBytes is the number of bytes of the loaded blocks, before
+	// decompression, and BlockBytesInCache the subset of them that were in the
+	// block cache.
+	BlockBytes        uint64
+	BlockBytesInCache uint64
+	// BlockBytesDecompressed is the number of bytes produced by decompressing
+	// the loaded blocks that were not in the block cache.
+	BlockBytesDecompressed uint64
+	// FilterNegatives is the number of times the filter of a table (e.g. a
+	// bloom filter) excluded the prefix sought by SeekPrefixGE.
+	FilterNegatives uint64
+	// TombstonesSkipped is the number of points of the level that were skipped
+	// because they were covered by range tombstones.
+	TombstonesSkipped uint64
+}
+
+// Merge adds all of the argument's statistics to the receiver.
+func (s *LevelIteratorStats) Merge(o LevelIteratorStats) {
+	s.BlockReads += o.BlockReads
+	s.BlockReadsInCache += o.BlockReadsInCache
+	s.BlockBytes += o.BlockBytes
+	s.BlockBytesInCache += o.BlockBytesInCache
+	s.BlockBytesDecompressed += o.BlockBytesDecompressed
+	s.FilterNegatives += o.FilterNegatives
+	s.TombstonesSkipped += o.TombstonesSkipped
 }
 
 var _ redact.SafeFormatter = &IteratorStats{}
@@ -191,6 +230,16 @@ type Iterator struct {
 	// Either readState or version is set, but not both.
 	readState *readState
 	version   *version
+	// tracker is the iterTracker tracking the iterator, if any. See
+	// Options.DebugIterators.
+	tracker *iterTracker
+	// hotKeys samples the keys the iterator seeks to, if Options.HotKeys is
+	// set.
+	hotKeys *hotKeySampler
+	// tracer and traceSpan are set if the iterator is traced. See
+	// Options.Tracer.
+	tracer    Tracer
+	traceSpan TraceSpan
 	// rangeKey holds iteration state specific to iteration over range keys.
 	// The range key field may be nil if the Iterator has never been configured
 	// to iterate over range keys. Its non-nilness cannot be used to determine
@@ -227,7 +276,10 @@ type Iterator struct {
 	prefixOrFullSeekKey []byte
 	readSampling        readSampling
 	stats               IteratorStats
-	externalReaders     [][]*sstable.Reader
+	// levelStats holds the internal stats of the iteration of the tables of
+	// each level, which are merged into stats by Stats.
+	levelStats      [numLevels]InternalIteratorStats
+	externalReaders [][]*sstable.Reader
 
 	// Following fields used when constructing an iterator stack, eg, in Clone
 	// and SetOptions or when re-fragmenting a batch's range keys/range dels.
@@ -1251,6 +1303,7 @@ func (i *Iterator) SeekGE(key []byte) bool {
 // guarantees it will surface any range keys with bounds overlapping the
 // keyspace [key, limit).
 func (i *Iterator) SeekGEWithLimit(key []byte, limit []byte) IterValidityState {
+	i.hotKeys.sample(key)
 	if i.rangeKey != nil {
 		// NB: Check Valid() before clearing requiresReposition.
 		i.rangeKey.prevPosHadRangeKey = i.rangeKey.hasRangeKey && i.Valid()
@@ -1400,6 +1453,7 @@ func (i *Iterator) SeekGEWithLimit(key []byte, limit []byte) IterValidityState {
 // ImmediateSuccessor method. For example, a SeekPrefixGE("a@9") call with the
 // prefix "a" will truncate range key bounds to [a,ImmediateSuccessor(a)].
 func (i *Iterator) SeekPrefixGE(key []byte) bool {
+	i.hotKeys.sample(key)
 	if i.rangeKey != nil {
 		// NB: Check Valid() before clearing requiresReposition.
 		i.rangeKey.prevPosHadRangeKey = i.rangeKey.hasRangeKey && i.Valid()
@@ -1527,6 +1581,7 @@ func (i *Iterator) SeekLT(key []byte) bool {
 // guarantees it will surface any range keys with bounds overlapping the
 // keyspace up to limit.
 func (i *Iterator) SeekLTWithLimit(key []byte, limit []byte) IterValidityState {
+	i.hotKeys.sample(key)
 	if i.rangeKey != nil {
 		// NB: Check Valid() before clearing requiresReposition.
 		i.rangeKey.prevPosHadRangeKey = i.rangeKey.hasRangeKey && i.Valid()
@@ -2316,6 +2371,15 @@ func (i *Iterator) Close() error {
 	}
 	err := i.err
 
+	if i.tracker != nil {
+		i.tracker.untrack(i)
+	}
+	if i.traceSpan != nil {
+		stats := i.Stats()
+		i.traceSpan.Finish(makeReadTraceInfo(&stats.InternalStats, err))
+		i.traceSpan = nil
+	}
+
 	if i.readState != nil {
 		if i.readSampling.pendingCompactions.size > 0 {
 			// Copy pending read compactions using db.mu.Lock()
@@ -2737,11 +2801,72 @@ func (i *Iterator) Metrics() IteratorMetrics {
 // ResetStats resets the stats to 0.
 func (i *Iterator) ResetStats() {
 	i.stats = IteratorStats{}
+	i.levelStats = [numLevels]InternalIteratorStats{}
 }
 
 // Stats returns the current stats.
 func (i *Iterator) Stats() IteratorStats {
-	return i.stats
+	stats := i.stats
+	for level := range i.levelStats {
+		ls := &i.levelStats[level]
+		stats.InternalStats.Merge(*ls)
+		stats.Levels[level] = LevelIteratorStats{
+			BlockReads:             ls.BlockReads,
+			BlockReadsInCache:      ls.BlockReadsInCache,
+			BlockBytes:             ls.BlockBytes,
+			BlockBytesInCache:      ls.BlockBytesInCache,
+			BlockBytesDecompressed: ls.BlockBytesDecompressed,
+			FilterNegatives:        ls.FilterNegatives,
+			TombstonesSkipped:      ls.PointsCoveredByRangeTombstones,
+		}
+	}
+	return stats
+}
+
+// StatsJSON returns the current stats encoded as JSON, for logging. Unlike
+// IteratorStats.String, it includes the stats of each level.
+func (i *Iterator) StatsJSON() string {
+	type callStats struct {
+		ForwardSeeks int
+		ReverseSeeks int
+		ForwardSteps int
+		ReverseSteps int
+	}
+	type levelStats struct {
+		Level int
+		LevelIteratorStats
+	}
+	stats := i.Stats()
+	var j struct {
+		Interface     callStats
+		Internal      callStats
+		InternalStats InternalIteratorStats
+		RangeKeyStats RangeKeyIteratorStats
+		// Levels holds the stats of the levels that were read.
+		Levels []levelStats
+	}
+	for kind, c := range []*callStats{&j.Interface, &j.Internal} {
+		*c = callStats{
+			ForwardSeeks: stats.ForwardSeekCount[kind],
+			ReverseSeeks: stats.ReverseSeekCount[kind],
+			ForwardSteps: stats.ForwardStepCount[kind],
+			ReverseSteps: stats.ReverseStepCount[kind],
+		}
+	}
+	j.InternalStats = stats.InternalStats
+	j.RangeKeyStats = stats.RangeKeyStats
+	j.Levels = []levelStats{}
+	for level := range stats.Levels {
+		if stats.Levels[level] != (LevelIteratorStats{}) {
+			j.Levels = append(j.Levels, levelStats{Level: level, LevelIteratorStats: stats.Levels[level]})
+		}
+	}
+	b, err := json.Marshal(j)
+	if err != nil {
+		// The stats only hold numbers, which are always encodable.
+		panic(err)
+	}
+	return string(b)
 }
 
 // CloneOptions configures an iterator constructed through Iterator.Clone.
@@ -2826,6 +2951,7 @@ func (i *Iterator) CloneWithContext(ctx context.Context, opts CloneOptions) (*It
 		newIters:            i.newIters,
 		newIterRangeKey:     i.newIterRangeKey,
 		seqNum:              i.seqNum,
+		hotKeys:             i.hotKeys,
 	}
 	dbi.processBounds(dbi.opts.LowerBound, dbi.opts.UpperBound)
 
@@ -2834,10 +2960,80 @@ func (i *Iterator) CloneWithContext(ctx context.Context, opts CloneOptions) (*It
 	if i.batch != nil && opts.RefreshBatchView {
 		dbi.batchSeqNum = (uint64(len(i.batch.data)) | base.InternalKeySeqNumBatch)
 	}
+	if i.tracker != nil {
+		i.tracker.track(dbi)
+	}
+	if i.tracer != nil {
+		ctx = dbi.startTraceSpan(i.tracer)
+	}
 
 	return finishInitializingIter(ctx, buf), nil
 }
 
+// CloneRanges creates one clone of the iterator for each of the key ranges,
+// bounded to the range. A nil Start or End leaves the range unbounded below or
+// above. The clones read the same underlying data as the iterator, sharing its
+// snapshot and the readers of its sstables, and are otherwise configured with
+// the same IterOptions. The ranges must be disjoint, in which case the clones
+// partition the keys of the ranges, and may be used concurrently, e.g., to scan
+// the keys in parallel (see DB.ScanParallel).
+//
+// The clones are not positioned, and must each be closed.
+func (i *Iterator) CloneRanges(ctx context.Context, ranges []KeyRange) ([]*Iterator, error) {
+	if err := checkDisjointRanges(i.comparer.Compare, ranges); err != nil {
+		return nil, err
+	}
+	clones := make([]*Iterator, 0, len(ranges))
+	for _, r := range ranges {
+		clone, err := i.cloneBounded(ctx, r)
+		if err != nil {
+			for _, c := range clones {
+				_ = c.Close()
+			}
+			return nil, err
+		}
+		clones = append(clones, clone)
+	}
+	return clones, nil
+}
+
+// cloneBounded clones the iterator with its bounds set to the key range.
+func (i *Iterator) cloneBounded(ctx context.Context, r KeyRange) (*Iterator, error) {
+	opts := i.opts
+	opts.LowerBound, opts.UpperBound = r.Start, r.End
+	return i.CloneWithContext(ctx, CloneOptions{IterOptions: &opts})
+}
+
+// checkDisjointRanges returns an error if any of the key ranges is empty or
+// overlaps another. A nil Start or End leaves a range unbounded.
+func checkDisjointRanges(cmp Compare, ranges []KeyRange) error {
+	sorted := slices.Clone(ranges)
+	slices.SortFunc(sorted, func(a, b KeyRange) int {
+		switch {
+		case a.Start == nil && b.Start == nil:
+			return 0
+		case a.Start == nil:
+			return -1
+		case b.Start == nil:
+			return +1
+		}
+		return cmp(a.Start, b.Start)
+	})
+	for j, r := range sorted {
+		if r.Start != nil && r.End != nil && cmp(r.Start, r.End) >= 0 {
+			return errors.Errorf("pebble: empty key range [%q, %q)", r.Start, r.End)
+		}
+		if j > 0 {
+			prev := sorted[j-1]
+			if prev.End == nil || r.Start == nil || cmp(prev.End, r.Start) > 0 {
+				return errors.Errorf("pebble: overlapping key ranges [%q, %q) and [%q, %q)",
+					prev.Start, prev.End, r.Start, r.End)
+			}
+		}
+	}
+	return nil
+}
+
 // Merge adds all of the argument's statistics to the receiver. It may be used
 // to accumulate stats across multiple iterators.
 func (stats *IteratorStats) Merge(o IteratorStats) {
@@ -2849,6 +3045,9 @@ func (stats *IteratorStats) Merge(o IteratorStats) {
 	}
 	stats.InternalStats.Merge(o.InternalStats)
 	stats.RangeKeyStats.Merge(o.RangeKeyStats)
+	for level := range stats.Levels {
+		stats.Levels[level].Merge(o.Levels[level])
+	}
 }
 
 func (stats *IteratorStats) String() string {
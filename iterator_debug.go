@@ -0,0 +1,169 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+// DebugIteratorsOptions configures the tracking of open iterators. See
+// Options.DebugIterators.
+type DebugIteratorsOptions struct {
+	// LogAfterCompactions configures the logging of long-lived iterators. If
+	// positive, an iterator that remains open while LogAfterCompactions
+	// compactions (including flushes) complete is logged, along with the stack
+	// trace of its creation. Each iterator is logged at most once. Long-lived
+	// iterators pin the memtables and sstables they read, preventing their
+	// memory and disk space from being reclaimed.
+	//
+	// The default value is 0, i.e. long-lived iterators are not logged.
+	LogAfterCompactions int
+}
+
+// IteratorInfo describes an open iterator. See DB.OpenIterators.
+type IteratorInfo struct {
+	// Created is the time at which the iterator was created.
+	Created time.Time
+	// Compactions is the number of compactions that have completed while the
+	// iterator has been open.
+	Compactions int64
+	// Stack is the stack trace of the goroutine that created the iterator.
+	Stack string
+}
+
+// iterTracker tracks the open iterators of a DB when Options.DebugIterators is
+// set.
+type iterTracker struct {
+	logger              Logger
+	timeNow             func() time.Time
+	logAfterCompactions int64
+
+	mu struct {
+		sync.Mutex
+		// compactions is the number of compactions completed since the DB was
+		// opened.
+		compactions int64
+		iters       map[*Iterator]*trackedIter
+	}
+}
+
+type trackedIter struct {
+	created time.Time
+	// compactions is the value of iterTracker.mu.compactions when the iterator
+	// was created.
+	compactions int64
+	stack       []byte
+	logged      bool
+}
+
+func newIterTracker(opts *Options, timeNow func() time.Time) *iterTracker {
+	if opts.DebugIterators == nil {
+		return nil
+	}
+	t := &iterTracker{
+		logger:              opts.Logger,
+		timeNow:             timeNow,
+		logAfterCompactions: int64(opts.DebugIterators.LogAfterCompactions),
+	}
+	t.mu.iters = make(map[*Iterator]*trackedIter)
+	return t
+}
+
+// track begins tracking the provided iterator, which must subsequently be
+// untracked when it's closed.
+func (t *iterTracker) track(i *Iterator) {
+	ti := &trackedIter{created: t.timeNow(), stack: debug.Stack()}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ti.compactions = t.mu.compactions
+	t.mu.iters[i] = ti
+	i.tracker = t
+}
+
+func (t *iterTracker) untrack(i *Iterator) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.mu.iters, i)
+	i.tracker = nil
+}
+
+// compactionCompleted is invoked whenever a flush or compaction completes,
+// logging iterators that have been open for
+// Options.DebugIterators.LogAfterCompactions compactions. It's a no-op if t is
+// nil.
+func (t *iterTracker) compactionCompleted() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.mu.compactions++
+	if t.logAfterCompactions <= 0 {
+		return
+	}
+	for _, ti := range t.mu.iters {
+		if !ti.logged && t.mu.compactions-ti.compactions >= t.logAfterCompactions {
+			ti.logged = true
+			t.logger.Infof("iterator open across %d compactions since %s; created at:\n%s",
+				t.mu.compactions-ti.compactions, ti.created.Format(time.RFC3339), ti.stack)
+		}
+	}
+}
+
+// leakedErr returns an error describing the tracked iterators that remain
+// open, or nil if there are none.
+func (t *iterTracker) leakedErr() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.mu.iters) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	for _, ti := range t.mu.iters {
+		fmt.Fprintf(&buf, "%s\n", ti.stack)
+	}
+	return errors.Errorf("leaked iterators: %d\n%s", errors.Safe(len(t.mu.iters)), buf.String())
+}
+
+// OpenIterators returns descriptions of the DB's open iterators, ordered by
+// creation time, if iterator tracking is enabled through
+// Options.DebugIterators. It returns nil otherwise. Only iterators that read
+// the DB's state (including iterators over snapshots and indexed batches) are
+// tracked; iterators that read only a batch are not.
+//
+// IteratorInfo may be serialized as JSON, so that applications may expose open
+// iterators through a debug endpoint for use with the `pebble db iterators`
+// tool command.
+func (d *DB) OpenIterators() []IteratorInfo {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	t := d.iterTracker
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	infos := make([]IteratorInfo, 0, len(t.mu.iters))
+	for _, ti := range t.mu.iters {
+		infos = append(infos, IteratorInfo{
+			Created:     ti.created,
+			Compactions: t.mu.compactions - ti.compactions,
+			Stack:       string(ti.stack),
+		})
+	}
+	slices.SortStableFunc(infos, func(a, b IteratorInfo) int {
+		return cmp.Compare(a.Created.UnixNano(), b.Created.UnixNano())
+	})
+	return infos
+}
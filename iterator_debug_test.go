@@ -0,0 +1,71 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenIterators(t *testing.T) {
+	logger := &base.InMemLogger{}
+	d, err := Open("", &Options{
+		FS:             vfs.NewMem(),
+		Logger:         logger,
+		DebugIterators: &DebugIteratorsOptions{LogAfterCompactions: 2},
+	})
+	require.NoError(t, err)
+
+	iter, err := d.NewIter(nil)
+	require.NoError(t, err)
+	snap := d.NewSnapshot()
+	snapIter, err := snap.NewIter(nil)
+	require.NoError(t, err)
+	clone, err := iter.Clone(CloneOptions{})
+	require.NoError(t, err)
+	// Iterators over an indexed batch are tracked, but iterators that only
+	// read a batch are not.
+	b := d.NewIndexedBatch()
+	batchIter, err := b.NewIter(nil)
+	require.NoError(t, err)
+	batchOnlyIter, err := b.NewBatchOnlyIter(context.Background(), nil)
+	require.NoError(t, err)
+
+	iters := d.OpenIterators()
+	require.Len(t, iters, 4)
+	for _, it := range iters {
+		require.Contains(t, it.Stack, "TestOpenIterators")
+		require.Zero(t, it.Compactions)
+	}
+	require.NoError(t, batchOnlyIter.Close())
+	require.NoError(t, batchIter.Close())
+	require.NoError(t, b.Close())
+	require.NoError(t, clone.Close())
+	require.NoError(t, snapIter.Close())
+	require.NoError(t, snap.Close())
+	require.Len(t, d.OpenIterators(), 1)
+
+	// Iterators open across LogAfterCompactions compactions (including
+	// flushes) are logged.
+	require.NoError(t, d.Set([]byte("a"), nil, nil))
+	require.NoError(t, d.Flush())
+	require.NotContains(t, logger.String(), "iterator open across")
+	require.NoError(t, d.Set([]byte("b"), nil, nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Compact([]byte("a"), []byte("c"), false))
+	require.Contains(t, logger.String(), "iterator open across 2 compactions")
+	iters = d.OpenIterators()
+	require.Len(t, iters, 1)
+	require.Equal(t, int64(3), iters[0].Compactions)
+
+	// Leaked iterators are reported, with their stacks, when the DB is closed.
+	err = d.Close()
+	require.Error(t, err)
+	require.Regexp(t, `(?s)^leaked iterators: 1\n.*TestOpenIterators`, err.Error())
+}
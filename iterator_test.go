@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
@@ -20,6 +21,7 @@ import (
 
 	"github.com/cockroachdb/datadriven"
 	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/bloom"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/bytealloc"
 	"github.com/cockroachdb/pebble/internal/invalidating"
@@ -1600,6 +1602,8 @@ func TestIteratorStatsMerge(t *testing.T) {
 	s2.InternalStats.SeparatedPointValue.Count = 2
 	s2.InternalStats.SeparatedPointValue.ValueBytes = 10
 	s2.InternalStats.SeparatedPointValue.ValueBytesFetched = 6
+	s.Levels[6] = LevelIteratorStats{BlockReads: 1, FilterNegatives: 2, TombstonesSkipped: 3}
+	s2.Levels[6] = LevelIteratorStats{BlockReads: 4, BlockBytesDecompressed: 5}
 	s.Merge(s2)
 	expected := IteratorStats{
 		ForwardSeekCount: [NumStatsKind]int{2, 4},
@@ -1624,9 +1628,69 @@ func TestIteratorStatsMerge(t *testing.T) {
 	expected.InternalStats.SeparatedPointValue.Count = 3
 	expected.InternalStats.SeparatedPointValue.ValueBytes = 15
 	expected.InternalStats.SeparatedPointValue.ValueBytesFetched = 9
+	expected.Levels[6] = LevelIteratorStats{
+		BlockReads: 5, BlockBytesDecompressed: 5, FilterNegatives: 2, TombstonesSkipped: 3,
+	}
 	require.Equal(t, expected, s)
 }
 
+func TestIteratorStatsLevels(t *testing.T) {
+	opts := &Options{
+		FS:     vfs.NewMem(),
+		Levels: []LevelOptions{{FilterPolicy: bloom.FilterPolicy(10)}},
+	}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	for i := 0; i < 100; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("k%03d", i)), []byte("v"), nil))
+	}
+	require.NoError(t, d.Compact([]byte("k"), []byte("l"), false /* parallelize */))
+	require.NoError(t, d.DeleteRange([]byte("k000"), []byte("k050"), nil))
+	require.NoError(t, d.Flush())
+
+	iter, _ := d.NewIter(&IterOptions{UseL6Filters: true})
+	defer func() { require.NoError(t, iter.Close()) }()
+
+	// The points of L6 covered by the range deletion in L0 are skipped, by
+	// seeking past the range deletion once the first covered point is found.
+	require.True(t, iter.First())
+	require.Equal(t, "k050", string(iter.Key()))
+	stats := iter.Stats()
+	require.Equal(t, uint64(1), stats.Levels[6].TombstonesSkipped)
+	require.Greater(t, stats.Levels[6].BlockReads, uint64(0))
+	require.Greater(t, stats.Levels[6].BlockBytesDecompressed, uint64(0))
+	require.Zero(t, stats.Levels[6].FilterNegatives)
+	require.Zero(t, stats.Levels[0].TombstonesSkipped)
+	var total LevelIteratorStats
+	for _, ls := range stats.Levels {
+		total.Merge(ls)
+	}
+	require.Equal(t, stats.InternalStats.BlockReads, total.BlockReads)
+	require.Equal(t, stats.InternalStats.PointsCoveredByRangeTombstones, total.TombstonesSkipped)
+
+	// The filter of the L6 table excludes a missing prefix.
+	iter.ResetStats()
+	require.False(t, iter.SeekPrefixGE([]byte("k0705")))
+	stats = iter.Stats()
+	require.Equal(t, uint64(1), stats.Levels[6].FilterNegatives)
+	require.Equal(t, uint64(1), stats.InternalStats.FilterNegatives)
+
+	var decoded struct {
+		Interface struct{ ForwardSeeks int }
+		Levels    []struct {
+			Level           int
+			FilterNegatives uint64
+		}
+	}
+	require.NoError(t, json.Unmarshal([]byte(iter.StatsJSON()), &decoded))
+	require.Equal(t, 1, decoded.Interface.ForwardSeeks)
+	require.Len(t, decoded.Levels, 1)
+	require.Equal(t, 6, decoded.Levels[0].Level)
+	require.Equal(t, uint64(1), decoded.Levels[0].FilterNegatives)
+}
+
 // TestSetOptionsEquivalence tests equivalence between SetOptions to mutate an
 // iterator and constructing a new iterator with NewIter. The long-lived
 // iterator and the new iterator should surface identical iterator states.
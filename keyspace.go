@@ -0,0 +1,318 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"io"
+	"slices"
+	"sync/atomic"
+
+	"github.com/cockroachdb/errors"
+)
+
+// Keyspace is a partition of a DB's keyspace, similar to a column family. A
+// Keyspace namespaces keys by a fixed prefix: every key written through a
+// Keyspace is stored in the DB with the Keyspace's prefix prepended, and reads
+// through a Keyspace only observe keys with that prefix. Keys passed to and
+// returned by a Keyspace's methods never include the prefix.
+//
+// Keyspaces are not persisted; a Keyspace is a view over the keys with a
+// given prefix and may be recreated at any time with DB.NewKeyspace. The
+// caller is responsible for choosing prefixes such that no Keyspace's prefix
+// is a prefix of another's.
+type Keyspace struct {
+	db *DB
+	// prefix is prepended to all of the Keyspace's keys, and is the inclusive
+	// lower bound of the Keyspace's keys within the DB.
+	prefix []byte
+	// upper is the exclusive upper bound of the Keyspace's keys within the DB:
+	// the shortest key greater than all keys with the prefix.
+	upper []byte
+
+	metrics struct {
+		writes       atomic.Int64
+		bytesWritten atomic.Int64
+		reads        atomic.Int64
+		iters        atomic.Int64
+	}
+}
+
+// KeyspaceMetrics holds metrics for a Keyspace. The operation counts are
+// maintained in memory for the lifetime of the Keyspace, and do not include
+// operations performed on the Keyspace's keys through the DB directly.
+type KeyspaceMetrics struct {
+	// Writes is the number of point keys and range deletions written.
+	Writes int64
+	// BytesWritten is the sum of the sizes of the keys and values written,
+	// excluding the Keyspace's prefix.
+	BytesWritten int64
+	// Reads is the number of Gets performed.
+	Reads int64
+	// Iterators is the number of iterators opened.
+	Iterators int64
+	// DiskUsage is the estimated disk space used by the Keyspace's keys in
+	// sstables. See DB.EstimateDiskUsage.
+	DiskUsage uint64
+}
+
+// NewKeyspace returns a Keyspace that namespaces keys under the given prefix.
+// The prefix must be non-empty and must have a successor, i.e. it must
+// contain a byte other than 0xff.
+func (d *DB) NewKeyspace(prefix []byte) (*Keyspace, error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if len(prefix) == 0 {
+		return nil, errors.New("pebble: keyspace prefix must be non-empty")
+	}
+	upper := keyspaceUpperBound(prefix)
+	if upper == nil {
+		return nil, errors.Errorf("pebble: keyspace prefix %x has no successor", prefix)
+	}
+	return &Keyspace{
+		db:     d,
+		prefix: slices.Clone(prefix),
+		upper:  upper,
+	}, nil
+}
+
+// keyspaceUpperBound returns the shortest key that is greater than all keys
+// with the given prefix, or nil if there is no such key.
+func keyspaceUpperBound(prefix []byte) []byte {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] != 0xff {
+			upper := slices.Clone(prefix[:i+1])
+			upper[i]++
+			return upper
+		}
+	}
+	return nil
+}
+
+// Prefix returns the prefix of the Keyspace's keys within the DB. The caller
+// must not modify the returned slice.
+func (k *Keyspace) Prefix() []byte {
+	return k.prefix
+}
+
+// Key returns the DB key for the given Keyspace key, for use with APIs that
+// aren't exposed by Keyspace, such as batches.
+func (k *Keyspace) Key(key []byte) []byte {
+	buf := make([]byte, len(k.prefix)+len(key))
+	copy(buf, k.prefix)
+	copy(buf[len(k.prefix):], key)
+	return buf
+}
+
+func (k *Keyspace) recordWrite(key, value []byte) {
+	k.metrics.writes.Add(1)
+	k.metrics.bytesWritten.Add(int64(len(key) + len(value)))
+}
+
+// Get gets the value for the given key within the Keyspace. See DB.Get.
+func (k *Keyspace) Get(key []byte) ([]byte, io.Closer, error) {
+	k.metrics.reads.Add(1)
+	return k.db.Get(k.Key(key))
+}
+
+// Set sets the value for the given key within the Keyspace. See DB.Set.
+func (k *Keyspace) Set(key, value []byte, opts *WriteOptions) error {
+	if err := k.db.Set(k.Key(key), value, opts); err != nil {
+		return err
+	}
+	k.recordWrite(key, value)
+	return nil
+}
+
+// Delete deletes the value for the given key within the Keyspace. See
+// DB.Delete.
+func (k *Keyspace) Delete(key []byte, opts *WriteOptions) error {
+	if err := k.db.Delete(k.Key(key), opts); err != nil {
+		return err
+	}
+	k.recordWrite(key, nil)
+	return nil
+}
+
+// SingleDelete performs a single delete of the given key within the Keyspace.
+// See DB.SingleDelete.
+func (k *Keyspace) SingleDelete(key []byte, opts *WriteOptions) error {
+	if err := k.db.SingleDelete(k.Key(key), opts); err != nil {
+		return err
+	}
+	k.recordWrite(key, nil)
+	return nil
+}
+
+// DeleteRange deletes all of the keys within the Keyspace in the range
+// [start,end). See DB.DeleteRange.
+func (k *Keyspace) DeleteRange(start, end []byte, opts *WriteOptions) error {
+	if err := k.db.DeleteRange(k.Key(start), k.Key(end), opts); err != nil {
+		return err
+	}
+	k.recordWrite(start, end)
+	return nil
+}
+
+// Merge adds an action to the DB that merges the value at key within the
+// Keyspace with the new value. See DB.Merge. Note that the Merger is invoked
+// with the DB key, which includes the Keyspace's prefix.
+func (k *Keyspace) Merge(key, value []byte, opts *WriteOptions) error {
+	if err := k.db.Merge(k.Key(key), value, opts); err != nil {
+		return err
+	}
+	k.recordWrite(key, value)
+	return nil
+}
+
+// Drop deletes all of the Keyspace's keys. The keys are deleted with a range
+// deletion and, if the DB's format major version supports it, the sstables
+// containing the keys are excised so that their disk space is reclaimed
+// without waiting for compactions.
+func (k *Keyspace) Drop() error {
+	if err := k.db.DeleteRange(k.prefix, k.upper, Sync); err != nil {
+		return err
+	}
+	k.metrics.writes.Add(1)
+	// Excising requires virtual sstables, and is only supported on keys that
+	// are entirely prefixes (see IngestAndExcise).
+	split := k.db.opts.Comparer.Split
+	if k.db.FormatMajorVersion() < FormatMinForSharedObjects ||
+		split(k.prefix) != len(k.prefix) || split(k.upper) != len(k.upper) {
+		return nil
+	}
+	_, err := k.db.IngestAndExcise(nil, nil, nil, KeyRange{Start: k.prefix, End: k.upper}, false)
+	return err
+}
+
+// Metrics returns metrics for the Keyspace.
+func (k *Keyspace) Metrics() (KeyspaceMetrics, error) {
+	m := KeyspaceMetrics{
+		Writes:       k.metrics.writes.Load(),
+		BytesWritten: k.metrics.bytesWritten.Load(),
+		Reads:        k.metrics.reads.Load(),
+		Iterators:    k.metrics.iters.Load(),
+	}
+	var err error
+	m.DiskUsage, err = k.db.EstimateDiskUsage(k.prefix, k.upper)
+	return m, err
+}
+
+// NewIter returns an iterator over the Keyspace's point keys. The bounds in
+// the provided IterOptions, if any, are relative to the Keyspace and are
+// additionally constrained to the Keyspace's keys. The provided IterOptions
+// are not modified.
+func (k *Keyspace) NewIter(o *IterOptions) (*KeyspaceIterator, error) {
+	var opts IterOptions
+	if o != nil {
+		opts = *o
+	}
+	k.setBounds(&opts, opts.LowerBound, opts.UpperBound)
+	iter, err := k.db.NewIter(&opts)
+	if err != nil {
+		return nil, err
+	}
+	k.metrics.iters.Add(1)
+	return &KeyspaceIterator{keyspace: k, iter: iter}, nil
+}
+
+// setBounds sets the bounds of o to the given Keyspace-relative bounds,
+// constrained to the Keyspace's keys.
+func (k *Keyspace) setBounds(o *IterOptions, lower, upper []byte) {
+	o.LowerBound = k.Key(lower)
+	if upper != nil {
+		o.UpperBound = k.Key(upper)
+	} else {
+		o.UpperBound = k.upper
+	}
+}
+
+// KeyspaceIterator iterates over the point keys within a Keyspace. Keys passed
+// to and returned by the iterator are relative to the Keyspace.
+type KeyspaceIterator struct {
+	keyspace *Keyspace
+	iter     *Iterator
+	// buf holds the last seek key, including the Keyspace's prefix.
+	buf []byte
+}
+
+func (i *KeyspaceIterator) seekKey(key []byte) []byte {
+	i.buf = append(append(i.buf[:0], i.keyspace.prefix...), key...)
+	return i.buf
+}
+
+// SeekGE moves the iterator to the first key/value pair whose key is greater
+// than or equal to the given key. See Iterator.SeekGE.
+func (i *KeyspaceIterator) SeekGE(key []byte) bool {
+	return i.iter.SeekGE(i.seekKey(key))
+}
+
+// SeekPrefixGE moves the iterator to the first key/value pair whose key is
+// greater than or equal to the given key and shares its prefix. See
+// Iterator.SeekPrefixGE.
+func (i *KeyspaceIterator) SeekPrefixGE(key []byte) bool {
+	return i.iter.SeekPrefixGE(i.seekKey(key))
+}
+
+// SeekLT moves the iterator to the last key/value pair whose key is less than
+// the given key. See Iterator.SeekLT.
+func (i *KeyspaceIterator) SeekLT(key []byte) bool {
+	return i.iter.SeekLT(i.seekKey(key))
+}
+
+// First moves the iterator to the first key/value pair. See Iterator.First.
+func (i *KeyspaceIterator) First() bool {
+	return i.iter.First()
+}
+
+// Last moves the iterator to the last key/value pair. See Iterator.Last.
+func (i *KeyspaceIterator) Last() bool {
+	return i.iter.Last()
+}
+
+// Next moves the iterator to the next key/value pair. See Iterator.Next.
+func (i *KeyspaceIterator) Next() bool {
+	return i.iter.Next()
+}
+
+// Prev moves the iterator to the previous key/value pair. See Iterator.Prev.
+func (i *KeyspaceIterator) Prev() bool {
+	return i.iter.Prev()
+}
+
+// Valid returns true if the iterator is positioned at a valid key/value pair.
+func (i *KeyspaceIterator) Valid() bool {
+	return i.iter.Valid()
+}
+
+// Key returns the key of the current key/value pair, relative to the
+// Keyspace. See Iterator.Key.
+func (i *KeyspaceIterator) Key() []byte {
+	return i.iter.Key()[len(i.keyspace.prefix):]
+}
+
+// ValueAndErr returns the value of the current key/value pair. See
+// Iterator.ValueAndErr.
+func (i *KeyspaceIterator) ValueAndErr() ([]byte, error) {
+	return i.iter.ValueAndErr()
+}
+
+// SetBounds sets the lower and upper bounds for the iterator, relative to the
+// Keyspace. See Iterator.SetBounds.
+func (i *KeyspaceIterator) SetBounds(lower, upper []byte) {
+	var o IterOptions
+	i.keyspace.setBounds(&o, lower, upper)
+	i.iter.SetBounds(o.LowerBound, o.UpperBound)
+}
+
+// Error returns any accumulated error.
+func (i *KeyspaceIterator) Error() error {
+	return i.iter.Error()
+}
+
+// Close closes the iterator. See Iterator.Close.
+func (i *KeyspaceIterator) Close() error {
+	return i.iter.Close()
+}
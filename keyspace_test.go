@@ -0,0 +1,99 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyspace(t *testing.T) {
+	opts := &Options{FS: vfs.NewMem(), FormatMajorVersion: FormatNewest}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer d.Close()
+
+	_, err = d.NewKeyspace(nil)
+	require.Error(t, err)
+	_, err = d.NewKeyspace([]byte{0xff, 0xff})
+	require.Error(t, err)
+
+	// The keyspaces' upper bounds are "b" and "c".
+	ks1, err := d.NewKeyspace([]byte("a"))
+	require.NoError(t, err)
+	ks2, err := d.NewKeyspace([]byte{'b', 0xff, 0xff})
+	require.NoError(t, err)
+	require.Equal(t, []byte("c"), ks2.upper)
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, ks1.Set([]byte(fmt.Sprintf("%d", i)), []byte("one"), nil))
+		require.NoError(t, ks2.Set([]byte(fmt.Sprintf("%d", i)), []byte("two"), nil))
+	}
+	require.NoError(t, d.Set([]byte("b"), []byte("outside"), nil))
+	require.NoError(t, ks1.Delete([]byte("9"), nil))
+	require.NoError(t, ks2.DeleteRange([]byte("5"), []byte("9"), nil))
+
+	v, closer, err := ks1.Get([]byte("3"))
+	require.NoError(t, err)
+	require.Equal(t, "one", string(v))
+	require.NoError(t, closer.Close())
+	v, closer, err = d.Get([]byte("b\xff\xff3"))
+	require.NoError(t, err)
+	require.Equal(t, "two", string(v))
+	require.NoError(t, closer.Close())
+
+	scan := func(ks *Keyspace, o *IterOptions) string {
+		iter, err := ks.NewIter(o)
+		require.NoError(t, err)
+		var s string
+		for valid := iter.First(); valid; valid = iter.Next() {
+			v, err := iter.ValueAndErr()
+			require.NoError(t, err)
+			s += fmt.Sprintf("%s:%s ", iter.Key(), v)
+		}
+		require.NoError(t, iter.Close())
+		return s
+	}
+	require.Equal(t, "0:one 1:one 2:one 3:one 4:one 5:one 6:one 7:one 8:one ", scan(ks1, nil))
+	require.Equal(t, "0:two 1:two 2:two 3:two 4:two 9:two ", scan(ks2, nil))
+	require.Equal(t, "3:one 4:one ", scan(ks1, &IterOptions{LowerBound: []byte("3"), UpperBound: []byte("5")}))
+
+	iter, err := ks2.NewIter(nil)
+	require.NoError(t, err)
+	require.True(t, iter.SeekGE([]byte("2")))
+	require.Equal(t, "2", string(iter.Key()))
+	require.True(t, iter.SeekLT([]byte("9")))
+	require.Equal(t, "4", string(iter.Key()))
+	require.False(t, iter.SeekGE([]byte("a")))
+	iter.SetBounds([]byte("1"), []byte("3"))
+	require.True(t, iter.Last())
+	require.Equal(t, "2", string(iter.Key()))
+	require.NoError(t, iter.Close())
+
+	m, err := ks1.Metrics()
+	require.NoError(t, err)
+	require.Equal(t, KeyspaceMetrics{Writes: 11, BytesWritten: 41, Reads: 1, Iterators: 2}, m)
+
+	// Dropping a keyspace deletes its keys, excising them from sstables, and
+	// leaves other keys intact.
+	require.NoError(t, d.Flush())
+	m, err = ks2.Metrics()
+	require.NoError(t, err)
+	require.NotZero(t, m.DiskUsage)
+	require.NoError(t, ks2.Drop())
+	require.Equal(t, "", scan(ks2, nil))
+	require.Equal(t, "0:one 1:one 2:one 3:one 4:one 5:one 6:one 7:one 8:one ", scan(ks1, nil))
+	v, closer, err = d.Get([]byte("b"))
+	require.NoError(t, err)
+	require.Equal(t, "outside", string(v))
+	require.NoError(t, closer.Close())
+	require.NoError(t, d.Flush())
+	m, err = ks2.Metrics()
+	require.NoError(t, err)
+	require.Zero(t, m.DiskUsage)
+}
@@ -157,17 +157,18 @@ func TestCheckLevelsCornerCases(t *testing.T) {
 					return err.Error()
 				}
 				writeUnfragmented := false
-				w := sstable.NewWriter(objstorageprovider.NewFileWritable(f), sstable.WriterOptions{})
+				var writerOpts sstable.WriterOptions
 				for _, arg := range d.CmdArgs {
 					switch arg.Key {
 					case "disable-key-order-checks":
-						private.SSTableWriterDisableKeyOrderChecks(w)
+						writerOpts.Unsafe.DisableKeyOrderChecks = true
 					case "write-unfragmented":
 						writeUnfragmented = true
 					default:
 						return fmt.Sprintf("unknown arg: %s", arg.Key)
 					}
 				}
+				w := sstable.NewWriter(objstorageprovider.NewFileWritable(f), writerOpts)
 				var tombstones []keyspan.Span
 				frag := keyspan.Fragmenter{
 					Cmp:    DefaultComparer.Compare,
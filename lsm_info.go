@@ -0,0 +1,139 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// LSMInfo describes the shape of the LSM at a point in time. See DB.LSMInfo.
+//
+// LSMInfo is designed to be serialized as JSON and sampled periodically: each
+// level and each in-progress compaction is a flat record, so that consecutive
+// samples may be plotted as time series.
+type LSMInfo struct {
+	// Time is the time at which the LSM was sampled.
+	Time time.Time
+	// Levels describes each level of the LSM, from L0 to L6.
+	Levels [numLevels]LSMLevelInfo
+	// Compactions describes the flushes and compactions in progress, ordered
+	// by the time at which they began.
+	Compactions []LSMCompactionInfo
+}
+
+// LSMLevelInfo describes a level of the LSM.
+type LSMLevelInfo struct {
+	Level int
+	// Sublevels is the number of sublevels of L0, and 1 for the other levels
+	// if they're non-empty.
+	Sublevels int32
+	// NumFiles is the number of sstables in the level, and Size their total
+	// size in bytes.
+	NumFiles int64
+	Size     int64
+	// Score is the compaction score of the level. See LevelMetrics.Score.
+	Score float64
+}
+
+// LSMCompactionInfo describes an in-progress flush or compaction.
+type LSMCompactionInfo struct {
+	// Kind is the kind of the compaction, e.g. "flush", "default" or "move".
+	Kind string
+	// StartLevel is the level being compacted, or -1 for flushes, and
+	// OutputLevel the level the compaction writes to, or -1 for compactions
+	// that don't write sstables (delete-only compactions).
+	StartLevel  int
+	OutputLevel int
+	// Smallest and Largest are the formatted bounds of the user keys being
+	// compacted. They're empty if the bounds aren't known.
+	Smallest string `json:",omitempty"`
+	Largest  string `json:",omitempty"`
+	// BeganAt is the time at which the compaction began.
+	BeganAt time.Time
+}
+
+// LSMInfo returns a description of the shape of the LSM: the number of files,
+// size and compaction score of each level, and the in-progress flushes and
+// compactions. Keys are formatted with the Comparer's FormatKey.
+//
+// See LSMHandler to serve the description of the LSM of a running DB, and the
+// `pebble db lsm --format=json` tool command to print that of a DB that isn't
+// in use.
+func (d *DB) LSMInfo() LSMInfo {
+	m := d.Metrics()
+	info := LSMInfo{Time: d.timeNow()}
+	for i := range info.Levels {
+		l := &m.Levels[i]
+		info.Levels[i] = LSMLevelInfo{
+			Level:    i,
+			NumFiles: l.NumFiles,
+			Size:     l.Size,
+			Score:    l.Score,
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// The sublevels are computed from the current version, as the metrics only
+	// reflect them once a version edit has been applied since the DB was
+	// opened.
+	v := d.mu.versions.currentVersion()
+	info.Levels[0].Sublevels = int32(len(v.L0SublevelFiles))
+	for i := 1; i < numLevels; i++ {
+		if !v.Levels[i].Empty() {
+			info.Levels[i].Sublevels = 1
+		}
+	}
+	info.Compactions = d.inProgressCompactionsLocked()
+	return info
+}
+
+// inProgressCompactionsLocked returns descriptions of the in-progress flushes
+// and compactions. d.mu must be held.
+func (d *DB) inProgressCompactionsLocked() []LSMCompactionInfo {
+	infos := make([]LSMCompactionInfo, 0, len(d.mu.compact.inProgress))
+	for c := range d.mu.compact.inProgress {
+		ci := LSMCompactionInfo{
+			Kind:        c.kind.String(),
+			StartLevel:  c.startLevel.level,
+			OutputLevel: -1,
+			BeganAt:     c.beganAt,
+		}
+		if c.outputLevel != nil {
+			ci.OutputLevel = c.outputLevel.level
+		}
+		if c.smallest.UserKey != nil || c.largest.UserKey != nil {
+			ci.Smallest = fmt.Sprint(d.opts.Comparer.FormatKey(c.smallest.UserKey))
+			ci.Largest = fmt.Sprint(d.opts.Comparer.FormatKey(c.largest.UserKey))
+		}
+		infos = append(infos, ci)
+	}
+	slices.SortStableFunc(infos, func(a, b LSMCompactionInfo) int {
+		if v := a.BeganAt.Compare(b.BeganAt); v != 0 {
+			return v
+		}
+		return cmp.Compare(a.StartLevel, b.StartLevel)
+	})
+	return infos
+}
+
+// LSMHandler returns an http.Handler serving the JSON encoding of LSMInfo,
+// sampled on every request. Applications may register it with their debug
+// endpoints to monitor the shape of the LSM of a running DB.
+func (d *DB) LSMHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := json.Marshal(d.LSMInfo())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	})
+}
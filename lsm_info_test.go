@@ -0,0 +1,63 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLSMInfo(t *testing.T) {
+	var d *DB
+	var compactions []LSMCompactionInfo
+	d, err := Open("", &Options{
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+		EventListener: &EventListener{
+			// The listener is invoked with d.mu held.
+			CompactionBegin: func(CompactionInfo) {
+				compactions = d.inProgressCompactionsLocked()
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// Each flush writes an sstable overlapping the previous ones.
+	for _, k := range []string{"a", "c", "e"} {
+		require.NoError(t, d.Set([]byte(k), []byte(k), nil))
+		require.NoError(t, d.Set([]byte("b"), []byte(k), nil))
+		require.NoError(t, d.Flush())
+	}
+	info := d.LSMInfo()
+	require.Equal(t, int64(3), info.Levels[0].NumFiles)
+	require.Equal(t, int32(3), info.Levels[0].Sublevels)
+	require.Positive(t, info.Levels[0].Size)
+	require.Empty(t, info.Compactions)
+
+	require.NoError(t, d.Compact([]byte("a"), []byte("f"), false))
+	require.Len(t, compactions, 1)
+	require.Equal(t, "default", compactions[0].Kind)
+	require.Equal(t, 0, compactions[0].StartLevel)
+	require.Equal(t, numLevels-1, compactions[0].OutputLevel)
+	require.Equal(t, "a", compactions[0].Smallest)
+	require.Equal(t, "e", compactions[0].Largest)
+
+	w := httptest.NewRecorder()
+	d.LSMHandler().ServeHTTP(w, httptest.NewRequest("GET", "/lsm", nil))
+	require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var served LSMInfo
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &served))
+	require.Zero(t, served.Levels[0].NumFiles)
+	l6 := served.Levels[numLevels-1]
+	require.Equal(t, numLevels-1, l6.Level)
+	require.Equal(t, int32(1), l6.Sublevels)
+	require.Equal(t, int64(1), l6.NumFiles)
+	require.Empty(t, served.Compactions)
+}
@@ -0,0 +1,130 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"sync"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/wal"
+)
+
+// CompactManifest rewrites the current MANIFEST of the database in dirname into
+// a new MANIFEST holding a single snapshot version edit, so that a MANIFEST
+// bloated by many version edits doesn't have to be replayed when the database
+// is opened. The database must not be open: CompactManifest acquires the lock
+// of the database directory, and doesn't replay the WAL.
+//
+// The previous MANIFEST isn't removed. It's deleted as obsolete when the
+// database is next opened, subject to Options.NumPrevManifest.
+func CompactManifest(dirname string, opts *Options) (err error) {
+	opts = opts.Clone()
+	opts = opts.EnsureDefaults()
+
+	lock, err := LockDirectory(dirname, opts.FS)
+	if err != nil {
+		return err
+	}
+	defer func() { err = firstError(err, lock.Close()) }()
+
+	ls, err := opts.FS.List(dirname)
+	if err != nil {
+		return err
+	}
+	formatVersion, formatVersionMarker, err := lookupFormatMajorVersion(opts.FS, dirname, ls)
+	if err != nil {
+		return err
+	}
+	if err := formatVersionMarker.Close(); err != nil {
+		return err
+	}
+	manifestMarker, manifestFileNum, exists, err := findCurrentManifest(opts.FS, dirname, ls)
+	if err != nil {
+		return errors.Wrapf(err, "pebble: database %q", dirname)
+	}
+	if !exists {
+		return firstError(errors.Errorf("pebble: database %q does not exist", dirname), manifestMarker.Close())
+	}
+
+	providerSettings := objstorageprovider.Settings{
+		Logger:              opts.Logger,
+		FS:                  opts.FS,
+		FSDirName:           dirname,
+		FSDirInitialListing: ls,
+		NoSyncOnClose:       opts.NoSyncOnClose,
+		BytesPerSync:        opts.BytesPerSync,
+	}
+	providerSettings.Remote.StorageFactory = opts.Experimental.RemoteStorage
+	providerSettings.Remote.CreateOnShared = opts.Experimental.CreateOnShared
+	providerSettings.Remote.CreateOnSharedLocator = opts.Experimental.CreateOnSharedLocator
+	provider, err := objstorageprovider.Open(providerSettings)
+	if err != nil {
+		return firstError(err, manifestMarker.Close())
+	}
+	defer func() { err = firstError(err, provider.Close()) }()
+
+	var mu sync.Mutex
+	mu.Lock()
+	defer mu.Unlock()
+	vs := &versionSet{}
+	// The version set takes ownership of the marker, which is closed by
+	// vs.close.
+	defer func() { err = firstError(err, vs.close()) }()
+	if err := vs.load(dirname, provider, opts, manifestFileNum, manifestMarker,
+		func() FormatMajorVersion { return formatVersion }, &mu); err != nil {
+		return err
+	}
+
+	// Don't reuse the file numbers of any of the files of the database, as Open
+	// does. The manifest's next file number may not account for the most recent
+	// OPTIONS file or WAL.
+	for _, filename := range ls {
+		if _, fn, ok := base.ParseFilename(opts.FS, filename); ok {
+			vs.markFileNumUsed(fn)
+		}
+	}
+	walOpts := wal.Options{Primary: wal.Dir{FS: opts.FS, Dirname: dirname}}
+	if opts.WALDir != "" {
+		walOpts.Primary.Dirname = opts.WALDir
+	}
+	if opts.WALFailover != nil {
+		walOpts.Secondary = opts.WALFailover.Secondary
+	}
+	wals, err := wal.Scan(append(walOpts.Dirs(), opts.WALRecoveryDirs...)...)
+	if err != nil {
+		return err
+	}
+	if n := len(wals); n > 0 {
+		vs.markFileNumUsed(base.DiskFileNum(wals[n-1].Num))
+	}
+	for _, obj := range provider.List() {
+		vs.markFileNumUsed(obj.DiskFileNum)
+	}
+
+	// The snapshot is the only version edit of the new manifest, so it must
+	// include the last sequence number.
+	var lastSeqNum uint64
+	if logSeqNum := vs.logSeqNum.Load(); logSeqNum > 0 {
+		lastSeqNum = logSeqNum - 1
+	}
+	newManifestFileNum := vs.getNextDiskFileNum()
+	if err := vs.createManifest(dirname, newManifestFileNum, vs.minUnflushedLogNum, vs.nextFileNum,
+		lastSeqNum, vs.virtualBackings.Backings()); err != nil {
+		return errors.Wrap(err, "MANIFEST create failed")
+	}
+	if err := vs.manifest.Flush(); err != nil {
+		return errors.Wrap(err, "MANIFEST flush failed")
+	}
+	if err := vs.manifestFile.Sync(); err != nil {
+		return errors.Wrap(err, "MANIFEST sync failed")
+	}
+	// NB: Move() is responsible for syncing the data directory.
+	if err := vs.manifestMarker.Move(base.MakeFilename(fileTypeManifest, newManifestFileNum)); err != nil {
+		return errors.Wrap(err, "MANIFEST set current failed")
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompactManifest(t *testing.T) {
+	mem := vfs.NewMem()
+	require.Error(t, CompactManifest("", &Options{FS: mem}))
+
+	opts := &Options{
+		FS:                          mem,
+		DisableAutomaticCompactions: true,
+		Logger:                      testLogger{t: t},
+	}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprint(i)), []byte("a"), nil))
+		require.NoError(t, d.Flush())
+	}
+	// Leave a write in the WAL.
+	require.NoError(t, d.Set([]byte("wal"), []byte("b"), nil))
+	// The directory is locked while the DB is open.
+	require.Error(t, CompactManifest("", opts))
+	require.NoError(t, d.Close())
+
+	before, edits := countManifestEdits(t, mem, "")
+	require.Greater(t, edits, 10)
+	require.NoError(t, CompactManifest("", opts))
+	after, edits := countManifestEdits(t, mem, "")
+	require.NotEqual(t, before, after)
+	require.Equal(t, 1, edits)
+
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	defer d.Close()
+	// The tables of the 10 flushes, and of the flush of the WAL at Open.
+	require.Equal(t, int64(11), d.Metrics().Levels[0].NumFiles)
+	for _, k := range []string{"0", "9", "wal"} {
+		_, closer, err := d.Get([]byte(k))
+		require.NoError(t, err)
+		require.NoError(t, closer.Close())
+	}
+	// The sequence numbers of new writes are higher than those of the existing
+	// keys.
+	require.NoError(t, d.Set([]byte("0"), []byte("c"), nil))
+	v, closer, err := d.Get([]byte("0"))
+	require.NoError(t, err)
+	require.Equal(t, "c", string(v))
+	require.NoError(t, closer.Close())
+}
@@ -11,6 +11,7 @@ import (
 	"sync"
 	"sync/atomic"
 
+	"github.com/cespare/xxhash/v2"
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/arenaskl"
 	"github.com/cockroachdb/pebble/internal/base"
@@ -70,6 +71,9 @@ type memTable struct {
 	skl         arenaskl.Skiplist
 	rangeDelSkl arenaskl.Skiplist
 	rangeKeySkl arenaskl.Skiplist
+	// prefixFilter, if non-nil, holds the prefixes extracted by
+	// Options.PrefixExtractor from the point keys in the memtable.
+	prefixFilter *memTablePrefixFilter
 	// reserved tracks the amount of space used by the memtable, both by actual
 	// data stored in the memtable as well as inflight batch commit
 	// operations. This value is incremented pessimistically by prepare() in
@@ -160,6 +164,11 @@ func (m *memTable) init(opts memTableOptions) {
 	m.rangeDelSkl.Reset(arena, m.cmp)
 	m.rangeKeySkl.Reset(arena, m.cmp)
 	m.reserved = arena.Size()
+
+	if opts.PrefixExtractor != nil {
+		m.prefixFilter = newMemTablePrefixFilter(
+			opts.Comparer.Split, opts.PrefixExtractor, opts.size/memTablePrefixFilterBytesPerBit)
+	}
 }
 
 func (m *memTable) writerRef() {
@@ -233,6 +242,9 @@ func (m *memTable) apply(batch *Batch, seqNum uint64) error {
 		case InternalKeyKindIngestSST:
 			panic("pebble: cannot apply ingested sstable key kind to memtable")
 		default:
+			if m.prefixFilter != nil {
+				m.prefixFilter.add(ukey)
+			}
 			err = ins.Add(&m.skl, ikey, value)
 		}
 		if err != nil {
@@ -256,7 +268,11 @@ func (m *memTable) apply(batch *Batch, seqNum uint64) error {
 // unpositioned (Iterator.Valid() will return false). The iterator can be
 // positioned via a call to SeekGE, SeekLT, First or Last.
 func (m *memTable) newIter(o *IterOptions) internalIterator {
-	return m.skl.NewIter(o.GetLowerBound(), o.GetUpperBound())
+	iter := m.skl.NewIter(o.GetLowerBound(), o.GetUpperBound())
+	if m.prefixFilter != nil {
+		return &memTablePrefixFilterIter{Iterator: iter, filter: m.prefixFilter}
+	}
+	return iter
 }
 
 // newFlushIter is part of the flushable interface.
@@ -424,3 +440,91 @@ func (c *keySpanCache) get() []keyspan.Span {
 	}
 	return frags.get(c.skl, c.cmp, c.formatKey, c.constructSpan)
 }
+
+// memTablePrefixFilterBytesPerBit is the number of bytes of memtable capacity
+// per bit of its prefix filter.
+const memTablePrefixFilterBytesPerBit = 8
+
+// memTablePrefixFilterProbes is the number of bits set in the prefix filter
+// for each prefix.
+const memTablePrefixFilterProbes = 6
+
+// memTablePrefixFilter is a bloom filter of the prefixes extracted by
+// Options.PrefixExtractor from the point keys in a memtable. Unlike the
+// filters of sstables, it's built incrementally as keys are added to the
+// memtable, concurrently with the readers checking it, so its bits are set
+// and read atomically. Prefixes are added to the filter before the keys
+// become visible, so a reader never misses a key that it can see.
+type memTablePrefixFilter struct {
+	split     Split
+	extractor *PrefixExtractor
+	bits      []atomic.Uint32
+}
+
+func newMemTablePrefixFilter(
+	split Split, extractor *PrefixExtractor, numBits int,
+) *memTablePrefixFilter {
+	return &memTablePrefixFilter{
+		split:     split,
+		extractor: extractor,
+		bits:      make([]atomic.Uint32, max(1, (numBits+31)/32)),
+	}
+}
+
+// hash returns the index of the first of the filter's bits for the filter key,
+// and the delta between the indexes of successive bits. Like the filters of
+// sstables, the filter uses double hashing to derive its bits from a single
+// hash.
+func (f *memTablePrefixFilter) hash(filterKey []byte) (bit, delta uint32) {
+	h := xxhash.Sum64(filterKey)
+	return uint32(h), uint32(h>>32) | 1
+}
+
+// add adds the prefix of the user key to the filter.
+func (f *memTablePrefixFilter) add(ukey []byte) {
+	bit, delta := f.hash(f.extractor.FilterKey(ukey[:f.split(ukey)]))
+	n := uint32(len(f.bits) * 32)
+	for i := 0; i < memTablePrefixFilterProbes; i++ {
+		b := bit % n
+		word, mask := &f.bits[b/32], uint32(1)<<(b%32)
+		for {
+			old := word.Load()
+			if old&mask != 0 || word.CompareAndSwap(old, old|mask) {
+				break
+			}
+		}
+		bit += delta
+	}
+}
+
+// mayContain returns false if the memtable contains no point keys with the
+// prefix, where prefix is the Split prefix of a key.
+func (f *memTablePrefixFilter) mayContain(prefix []byte) bool {
+	bit, delta := f.hash(f.extractor.FilterKey(prefix))
+	n := uint32(len(f.bits) * 32)
+	for i := 0; i < memTablePrefixFilterProbes; i++ {
+		if b := bit % n; f.bits[b/32].Load()&(uint32(1)<<(b%32)) == 0 {
+			return false
+		}
+		bit += delta
+	}
+	return true
+}
+
+// memTablePrefixFilterIter wraps the iterator of a memtable with a prefix
+// filter, skipping the seek of SeekPrefixGE if the memtable contains no keys
+// with the prefix.
+type memTablePrefixFilterIter struct {
+	*arenaskl.Iterator
+	filter *memTablePrefixFilter
+}
+
+// SeekPrefixGE implements the base.InternalIterator interface.
+func (i *memTablePrefixFilterIter) SeekPrefixGE(
+	prefix, key []byte, flags base.SeekGEFlags,
+) (*base.InternalKey, base.LazyValue) {
+	if !i.filter.mayContain(prefix) {
+		return nil, base.LazyValue{}
+	}
+	return i.Iterator.SeekPrefixGE(prefix, key, flags)
+}
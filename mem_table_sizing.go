@@ -0,0 +1,91 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+// adaptiveMemTableCalmRotations is the number of consecutive memtable
+// rotations without flush pressure after which adaptive memtable sizing
+// shrinks memtables.
+const adaptiveMemTableCalmRotations = 4
+
+// largeBatchThreshold returns the size above which batches are flushable
+// batches rather than being applied to memtables. The threshold is half the
+// size of the smallest memtable, ensuring that a batch below the threshold
+// always fits in an empty memtable.
+func largeBatchThreshold(opts *Options) uint64 {
+	size := opts.MemTableSize
+	if a := opts.AdaptiveMemTable; a.MaxSize > 0 {
+		size = min(size, a.MinSize)
+	}
+	return (size - uint64(memTableEmptySize)) / 2
+}
+
+// adaptMemTableSizeLocked adjusts the target size of memtables when the
+// mutable memtable is full and about to be rotated, if adaptive memtable
+// sizing is enabled:
+//
+//   - If flushes have fallen behind, i.e. other immutable memtables are still
+//     queued for flushing, memtables are doubled in size (up to
+//     AdaptiveMemTable.MaxSize). This increases the memory budget before
+//     writes are stalled (see Options.MemTableStopWritesThreshold), and allows
+//     larger and fewer flushes.
+//   - Similarly, if the write amplification since the previous rotation
+//     exceeds AdaptiveMemTable.TargetWriteAmp, memtables are doubled in size.
+//   - Otherwise, after adaptiveMemTableCalmRotations consecutive rotations
+//     without flush pressure, memtables are halved in size (down to
+//     AdaptiveMemTable.MinSize).
+//
+// The new size applies to the memtable allocated by the rotation.
+//
+// DB.mu must be held by the caller.
+func (d *DB) adaptMemTableSizeLocked() {
+	a := &d.mu.mem.adaptive
+	bytesIn := d.mu.log.bytesIn
+	var bytesWritten uint64
+	for i := range d.mu.versions.metrics.Levels {
+		l := &d.mu.versions.metrics.Levels[i]
+		bytesWritten += l.BytesFlushed + l.BytesCompacted
+	}
+	var writeAmp float64
+	if in := bytesIn - a.bytesIn; in > 0 {
+		writeAmp = float64(in+bytesWritten-a.bytesWritten) / float64(in)
+	}
+	a.bytesIn, a.bytesWritten = bytesIn, bytesWritten
+
+	// The mutable memtable is at the end of the queue.
+	backlog := len(d.mu.mem.queue) - 1
+	opts := d.opts.AdaptiveMemTable
+	prevSize := d.memTableTargetSize.Load()
+	size := prevSize
+	var reason string
+	switch {
+	case backlog > 0:
+		size, reason = min(2*prevSize, opts.MaxSize), "flush backlog"
+	case opts.TargetWriteAmp > 0 && writeAmp > opts.TargetWriteAmp:
+		size, reason = min(2*prevSize, opts.MaxSize), "write amplification"
+	default:
+		if a.calmRotations++; a.calmRotations >= adaptiveMemTableCalmRotations {
+			size, reason = max(prevSize/2, opts.MinSize), "low flush pressure"
+		}
+	}
+	if reason != "" {
+		a.calmRotations = 0
+	}
+	if size == prevSize {
+		return
+	}
+	d.memTableTargetSize.Store(size)
+	// Apply the new size to the next memtable, cutting short the ramp up of
+	// memtable sizes when growing (see DB.newMemTable).
+	if size > prevSize || d.mu.mem.nextSize > size {
+		d.mu.mem.nextSize = size
+	}
+	d.opts.EventListener.MemTableResized(MemTableResizeInfo{
+		PrevSize:     prevSize,
+		Size:         size,
+		Reason:       reason,
+		FlushBacklog: backlog,
+		WriteAmp:     writeAmp,
+	})
+}
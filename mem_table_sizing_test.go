@@ -0,0 +1,116 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdaptiveMemTableSize(t *testing.T) {
+	const minSize, maxSize = 256 << 10, 2 << 20
+	var mu sync.Mutex
+	var resizes []MemTableResizeInfo
+	opts := &Options{
+		FS:                          vfs.NewMem(),
+		MemTableSize:                minSize,
+		MemTableStopWritesThreshold: 100,
+		AdaptiveMemTable: AdaptiveMemTableOptions{
+			MaxSize: maxSize,
+		},
+		EventListener: &EventListener{
+			MemTableResized: func(info MemTableResizeInfo) {
+				mu.Lock()
+				defer mu.Unlock()
+				resizes = append(resizes, info)
+			},
+		},
+	}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	require.Equal(t, uint64(minSize), d.opts.AdaptiveMemTable.MinSize)
+	require.Equal(t, uint64(minSize), d.Metrics().MemTable.TargetSize)
+	lastResize := func() MemTableResizeInfo {
+		mu.Lock()
+		defer mu.Unlock()
+		require.NotEmpty(t, resizes)
+		return resizes[len(resizes)-1]
+	}
+
+	value := make([]byte, 1<<10)
+	var n int
+	write := func(bytes int) {
+		for i := 0; i < bytes/len(value); i++ {
+			require.NoError(t, d.Set([]byte(fmt.Sprintf("%08d", n)), value, nil))
+			n++
+		}
+	}
+
+	// Prevent flushes, so that the immutable memtables back up and memtables
+	// grow to the maximum size.
+	d.mu.Lock()
+	d.mu.compact.flushing = true
+	d.mu.Unlock()
+	write(8 << 20)
+	require.Equal(t, uint64(maxSize), d.Metrics().MemTable.TargetSize)
+	info := lastResize()
+	require.Equal(t, "flush backlog", info.Reason)
+	require.Equal(t, uint64(maxSize), info.Size)
+	require.Equal(t, uint64(maxSize/2), info.PrevSize)
+	require.Greater(t, info.FlushBacklog, 0)
+
+	d.mu.Lock()
+	d.mu.compact.flushing = false
+	d.maybeScheduleFlush()
+	d.mu.Unlock()
+	require.NoError(t, d.Flush())
+
+	// Write while flushes keep up, waiting for the previous memtable to be
+	// flushed whenever one fills. Memtables shrink back to the minimum size.
+	for i := 0; i < 1000 && d.Metrics().MemTable.TargetSize > minSize; i++ {
+		write(64 << 10)
+		d.mu.Lock()
+		for len(d.mu.mem.queue) > 1 {
+			d.mu.compact.cond.Wait()
+		}
+		d.mu.Unlock()
+	}
+	require.Equal(t, uint64(minSize), d.Metrics().MemTable.TargetSize)
+	info = lastResize()
+	require.Equal(t, "low flush pressure", info.Reason)
+	require.Equal(t, uint64(minSize), info.Size)
+	require.Equal(t, 0, info.FlushBacklog)
+	require.Contains(t, info.String(), "memtable resized from 512KB to 256KB (low flush pressure)")
+}
+
+func TestAdaptiveMemTableSizeWriteAmp(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:           vfs.NewMem(),
+		MemTableSize: 256 << 10,
+		AdaptiveMemTable: AdaptiveMemTableOptions{
+			MaxSize: 1 << 20,
+			// Any flush exceeds the target.
+			TargetWriteAmp: 1,
+		},
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	value := make([]byte, 1<<10)
+	for i := 0; i < 4096 && d.Metrics().MemTable.TargetSize < 1<<20; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("%08d", i)), value, nil))
+		d.mu.Lock()
+		for len(d.mu.mem.queue) > 1 {
+			d.mu.compact.cond.Wait()
+		}
+		d.mu.Unlock()
+	}
+	require.Equal(t, uint64(1<<20), d.Metrics().MemTable.TargetSize)
+}
@@ -405,6 +405,47 @@ func TestMemTableReserved(t *testing.T) {
 	require.Equal(t, int(m.reserved), int(b.memTableSize)+int(prevReserved))
 }
 
+func TestMemTablePrefixFilter(t *testing.T) {
+	opts := &Options{
+		PrefixExtractor: &PrefixExtractor{
+			Name:    "first-two",
+			Extract: func(prefix []byte) int { return 2 },
+		},
+	}
+	m := newMemTable(memTableOptions{Options: opts})
+	b := newBatch(nil)
+	for _, k := range []string{"apple", "apricot", "banana"} {
+		require.NoError(t, b.Set([]byte(k), nil, nil))
+	}
+	// Range deletions aren't added to the filter.
+	require.NoError(t, b.DeleteRange([]byte("cherry"), []byte("date"), nil))
+	require.NoError(t, m.prepare(b))
+	require.NoError(t, m.apply(b, 1))
+	m.writerUnref()
+
+	require.True(t, m.prefixFilter.mayContain([]byte("apq")))
+	require.True(t, m.prefixFilter.mayContain([]byte("bandana")))
+	require.False(t, m.prefixFilter.mayContain([]byte("aardvark")))
+	require.False(t, m.prefixFilter.mayContain([]byte("cherry")))
+
+	seekPrefix := func(key string) string {
+		iter := m.newIter(nil)
+		defer iter.Close()
+		k, _ := iter.SeekPrefixGE([]byte(key), []byte(key), base.SeekGEFlagsNone)
+		if k == nil {
+			return ""
+		}
+		return string(k.UserKey)
+	}
+	require.Equal(t, "", seekPrefix("aardvark"))
+	require.Equal(t, "apricot", seekPrefix("apq"))
+	require.Equal(t, "banana", seekPrefix("banana"))
+
+	// Without a prefix extractor, there's no filter.
+	m = newMemTable(memTableOptions{})
+	require.Nil(t, m.prefixFilter)
+}
+
 func TestMemTable(t *testing.T) {
 	var m *memTable
 	var buf bytes.Buffer
@@ -0,0 +1,354 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package mergeops
+
+import (
+	"encoding/binary"
+	"io"
+	"math/bits"
+	"sort"
+
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// BitmapUnion is a Merger computing the union of sets of uint32s, encoded by
+// Bitmap.Encode.
+var BitmapUnion = &base.Merger{
+	Name: "pebble.mergeops.bitmap-union",
+	Merge: func(key, value []byte) (base.ValueMerger, error) {
+		m := &bitmapMerger{}
+		if err := m.MergeNewer(value); err != nil {
+			return nil, err
+		}
+		return m, nil
+	},
+	CollapseChains: true,
+}
+
+// Bitmap is a compressed set of uint32s, organized like a roaring bitmap: the
+// set is partitioned into containers by the high 16 bits of its elements, and
+// each container holds the low 16 bits of its elements either in a sorted
+// array, if it holds at most arrayContainerMaxCardinality elements, or in a
+// bitset.
+//
+// The zero value is an empty Bitmap.
+type Bitmap struct {
+	// containers is sorted by key, and holds non-empty containers.
+	containers []bitmapContainer
+}
+
+// arrayContainerMaxCardinality is the maximum cardinality of the containers
+// holding their elements in arrays, beyond which a bitset is smaller.
+const arrayContainerMaxCardinality = 4096
+
+// bitsetWords is the number of words of the bitset of a container.
+const bitsetWords = 1 << 16 / 64
+
+type bitmapContainer struct {
+	key uint16
+	// array holds the elements in sorted order if bitset is nil.
+	array  []uint16
+	bitset *[bitsetWords]uint64
+	card   int
+}
+
+// BitmapOf returns a Bitmap holding the values.
+func BitmapOf(values ...uint32) *Bitmap {
+	b := &Bitmap{}
+	for _, v := range values {
+		b.Add(v)
+	}
+	return b
+}
+
+func (b *Bitmap) container(key uint16) (int, bool) {
+	i := sort.Search(len(b.containers), func(i int) bool {
+		return b.containers[i].key >= key
+	})
+	return i, i < len(b.containers) && b.containers[i].key == key
+}
+
+// Add adds the value to the set.
+func (b *Bitmap) Add(v uint32) {
+	i, ok := b.container(uint16(v >> 16))
+	if !ok {
+		b.containers = append(b.containers, bitmapContainer{})
+		copy(b.containers[i+1:], b.containers[i:])
+		b.containers[i] = bitmapContainer{key: uint16(v >> 16)}
+	}
+	b.containers[i].add(uint16(v))
+}
+
+// Contains returns true if the value is in the set.
+func (b *Bitmap) Contains(v uint32) bool {
+	i, ok := b.container(uint16(v >> 16))
+	return ok && b.containers[i].contains(uint16(v))
+}
+
+// Cardinality returns the number of values in the set.
+func (b *Bitmap) Cardinality() int {
+	var n int
+	for i := range b.containers {
+		n += b.containers[i].card
+	}
+	return n
+}
+
+// Values returns the values in the set, in increasing order.
+func (b *Bitmap) Values() []uint32 {
+	values := make([]uint32, 0, b.Cardinality())
+	for i := range b.containers {
+		c := &b.containers[i]
+		high := uint32(c.key) << 16
+		if c.bitset == nil {
+			for _, low := range c.array {
+				values = append(values, high|uint32(low))
+			}
+			continue
+		}
+		for w, word := range c.bitset {
+			for ; word != 0; word &= word - 1 {
+				values = append(values, high|uint32(w*64+bits.TrailingZeros64(word)))
+			}
+		}
+	}
+	return values
+}
+
+// Or adds the values of o to the set.
+func (b *Bitmap) Or(o *Bitmap) {
+	merged := make([]bitmapContainer, 0, len(b.containers)+len(o.containers))
+	i, j := 0, 0
+	for i < len(b.containers) || j < len(o.containers) {
+		switch {
+		case j == len(o.containers) || (i < len(b.containers) && b.containers[i].key < o.containers[j].key):
+			merged = append(merged, b.containers[i])
+			i++
+		case i == len(b.containers) || o.containers[j].key < b.containers[i].key:
+			merged = append(merged, o.containers[j].clone())
+			j++
+		default:
+			c := b.containers[i]
+			c.or(&o.containers[j])
+			merged = append(merged, c)
+			i++
+			j++
+		}
+	}
+	b.containers = merged
+}
+
+// Encode encodes the set as an operand or value of BitmapUnion: the
+// uvarint-encoded number of containers, followed by each container's key as a
+// little-endian uint16 and its uvarint-encoded cardinality, followed by either
+// its elements as little-endian uint16s if its cardinality is at most 4096, or
+// its bitset as little-endian uint64s.
+func (b *Bitmap) Encode() []byte {
+	buf := binary.AppendUvarint(nil, uint64(len(b.containers)))
+	for i := range b.containers {
+		c := &b.containers[i]
+		buf = binary.LittleEndian.AppendUint16(buf, c.key)
+		buf = binary.AppendUvarint(buf, uint64(c.card))
+		if c.bitset == nil {
+			for _, low := range c.array {
+				buf = binary.LittleEndian.AppendUint16(buf, low)
+			}
+			continue
+		}
+		for _, word := range c.bitset {
+			buf = binary.LittleEndian.AppendUint64(buf, word)
+		}
+	}
+	return buf
+}
+
+// DecodeBitmap decodes an operand or value of BitmapUnion.
+func DecodeBitmap(value []byte) (*Bitmap, error) {
+	corrupt := func() (*Bitmap, error) {
+		return nil, base.CorruptionErrorf("mergeops: invalid bitmap value")
+	}
+	n, l := binary.Uvarint(value)
+	if l <= 0 || n > uint64(len(value)) {
+		return corrupt()
+	}
+	value = value[l:]
+	b := &Bitmap{containers: make([]bitmapContainer, n)}
+	for i := range b.containers {
+		if len(value) < 2 {
+			return corrupt()
+		}
+		c := &b.containers[i]
+		c.key = binary.LittleEndian.Uint16(value)
+		if i > 0 && c.key <= b.containers[i-1].key {
+			return corrupt()
+		}
+		card, l := binary.Uvarint(value[2:])
+		if l <= 0 || card == 0 || card > 1<<16 {
+			return corrupt()
+		}
+		value = value[2+l:]
+		c.card = int(card)
+		if c.card <= arrayContainerMaxCardinality {
+			if len(value) < 2*c.card {
+				return corrupt()
+			}
+			c.array = make([]uint16, c.card)
+			for j := range c.array {
+				c.array[j] = binary.LittleEndian.Uint16(value[2*j:])
+				if j > 0 && c.array[j] <= c.array[j-1] {
+					return corrupt()
+				}
+			}
+			value = value[2*c.card:]
+			continue
+		}
+		if len(value) < 8*bitsetWords {
+			return corrupt()
+		}
+		c.bitset = new([bitsetWords]uint64)
+		var popCount int
+		for w := range c.bitset {
+			c.bitset[w] = binary.LittleEndian.Uint64(value[8*w:])
+			popCount += bits.OnesCount64(c.bitset[w])
+		}
+		if popCount != c.card {
+			return corrupt()
+		}
+		value = value[8*bitsetWords:]
+	}
+	if len(value) != 0 {
+		return corrupt()
+	}
+	return b, nil
+}
+
+func (c *bitmapContainer) contains(low uint16) bool {
+	if c.bitset != nil {
+		return c.bitset[low/64]&(1<<(low%64)) != 0
+	}
+	i := sort.Search(len(c.array), func(i int) bool { return c.array[i] >= low })
+	return i < len(c.array) && c.array[i] == low
+}
+
+func (c *bitmapContainer) add(low uint16) {
+	if c.bitset != nil {
+		if c.bitset[low/64]&(1<<(low%64)) == 0 {
+			c.bitset[low/64] |= 1 << (low % 64)
+			c.card++
+		}
+		return
+	}
+	i := sort.Search(len(c.array), func(i int) bool { return c.array[i] >= low })
+	if i < len(c.array) && c.array[i] == low {
+		return
+	}
+	c.array = append(c.array, 0)
+	copy(c.array[i+1:], c.array[i:])
+	c.array[i] = low
+	c.card++
+	if c.card > arrayContainerMaxCardinality {
+		c.toBitset()
+	}
+}
+
+func (c *bitmapContainer) clone() bitmapContainer {
+	clone := *c
+	if c.bitset != nil {
+		bitset := *c.bitset
+		clone.bitset = &bitset
+	} else {
+		clone.array = append([]uint16(nil), c.array...)
+	}
+	return clone
+}
+
+func (c *bitmapContainer) toBitset() {
+	c.bitset = new([bitsetWords]uint64)
+	for _, low := range c.array {
+		c.bitset[low/64] |= 1 << (low % 64)
+	}
+	c.array = nil
+}
+
+// or adds the elements of o to the container.
+func (c *bitmapContainer) or(o *bitmapContainer) {
+	if c.bitset == nil && o.bitset == nil && c.card+o.card <= arrayContainerMaxCardinality {
+		merged := make([]uint16, 0, c.card+o.card)
+		i, j := 0, 0
+		for i < len(c.array) || j < len(o.array) {
+			switch {
+			case j == len(o.array) || (i < len(c.array) && c.array[i] < o.array[j]):
+				merged = append(merged, c.array[i])
+				i++
+			case i == len(c.array) || o.array[j] < c.array[i]:
+				merged = append(merged, o.array[j])
+				j++
+			default:
+				merged = append(merged, c.array[i])
+				i++
+				j++
+			}
+		}
+		c.array, c.card = merged, len(merged)
+		return
+	}
+	if c.bitset == nil {
+		c.toBitset()
+	} else {
+		// The bitset may be shared with the Bitmap the container was copied
+		// from.
+		bitset := *c.bitset
+		c.bitset = &bitset
+	}
+	if o.bitset != nil {
+		for w := range c.bitset {
+			c.bitset[w] |= o.bitset[w]
+		}
+	} else {
+		for _, low := range o.array {
+			c.bitset[low/64] |= 1 << (low % 64)
+		}
+	}
+	c.card = 0
+	for _, word := range c.bitset {
+		c.card += bits.OnesCount64(word)
+	}
+	if c.card <= arrayContainerMaxCardinality {
+		// The union of overlapping arrays may be small enough for an array.
+		c.array = make([]uint16, 0, c.card)
+		for w, word := range c.bitset {
+			for ; word != 0; word &= word - 1 {
+				c.array = append(c.array, uint16(w*64+bits.TrailingZeros64(word)))
+			}
+		}
+		c.bitset = nil
+	}
+}
+
+type bitmapMerger struct {
+	b Bitmap
+}
+
+var _ base.ValueMerger = (*bitmapMerger)(nil)
+
+// MergeNewer implements base.ValueMerger.
+func (m *bitmapMerger) MergeNewer(value []byte) error {
+	b, err := DecodeBitmap(value)
+	if err != nil {
+		return err
+	}
+	m.b.Or(b)
+	return nil
+}
+
+// MergeOlder implements base.ValueMerger.
+func (m *bitmapMerger) MergeOlder(value []byte) error {
+	return m.MergeNewer(value)
+}
+
+// Finish implements base.ValueMerger.
+func (m *bitmapMerger) Finish(includesBase bool) ([]byte, io.Closer, error) {
+	return finish(m.b.Encode())
+}
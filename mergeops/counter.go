@@ -0,0 +1,67 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package mergeops
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// Counter is a Merger summing signed 64-bit integers, encoded by
+// EncodeCounter. The sum wraps around on overflow. A counter may be reset by
+// setting it.
+var Counter = &base.Merger{
+	Name: "pebble.mergeops.counter",
+	Merge: func(key, value []byte) (base.ValueMerger, error) {
+		m := &counterMerger{}
+		if err := m.MergeNewer(value); err != nil {
+			return nil, err
+		}
+		return m, nil
+	},
+	CollapseChains: true,
+}
+
+// EncodeCounter encodes an operand or value of Counter.
+func EncodeCounter(v int64) []byte {
+	return binary.AppendVarint(nil, v)
+}
+
+// DecodeCounter decodes an operand or value of Counter.
+func DecodeCounter(value []byte) (int64, error) {
+	v, n := binary.Varint(value)
+	if n <= 0 || n != len(value) {
+		return 0, base.CorruptionErrorf("mergeops: invalid counter value %x", value)
+	}
+	return v, nil
+}
+
+type counterMerger struct {
+	sum int64
+}
+
+var _ base.ValueMerger = (*counterMerger)(nil)
+
+// MergeNewer implements base.ValueMerger.
+func (m *counterMerger) MergeNewer(value []byte) error {
+	v, err := DecodeCounter(value)
+	if err != nil {
+		return err
+	}
+	m.sum += v
+	return nil
+}
+
+// MergeOlder implements base.ValueMerger.
+func (m *counterMerger) MergeOlder(value []byte) error {
+	return m.MergeNewer(value)
+}
+
+// Finish implements base.ValueMerger.
+func (m *counterMerger) Finish(includesBase bool) ([]byte, io.Closer, error) {
+	return finish(EncodeCounter(m.sum))
+}
@@ -0,0 +1,103 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package mergeops
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// List is a Merger appending lists of elements, encoded by EncodeList. The
+// merged list holds the elements of the operands from the oldest to the
+// newest.
+var List = &base.Merger{
+	Name: "pebble.mergeops.list",
+	Merge: func(key, value []byte) (base.ValueMerger, error) {
+		m := &listMerger{}
+		if err := m.MergeNewer(value); err != nil {
+			return nil, err
+		}
+		return m, nil
+	},
+	CollapseChains: true,
+}
+
+// EncodeList encodes the elements as an operand or value of List: each element
+// prefixed by its uvarint-encoded length.
+func EncodeList(elems ...[]byte) []byte {
+	var n int
+	for _, e := range elems {
+		n += binary.MaxVarintLen32 + len(e)
+	}
+	buf := make([]byte, 0, n)
+	for _, e := range elems {
+		buf = binary.AppendUvarint(buf, uint64(len(e)))
+		buf = append(buf, e...)
+	}
+	return buf
+}
+
+// DecodeList decodes an operand or value of List. The returned elements alias
+// the value.
+func DecodeList(value []byte) ([][]byte, error) {
+	var elems [][]byte
+	for len(value) > 0 {
+		n, l := binary.Uvarint(value)
+		if l <= 0 || n > uint64(len(value)-l) {
+			return nil, base.CorruptionErrorf("mergeops: invalid list value")
+		}
+		elems = append(elems, value[l:l+int(n)])
+		value = value[l+int(n):]
+	}
+	return elems, nil
+}
+
+// listMerger buffers the operands, since prepending the older ones would be
+// quadratic.
+type listMerger struct {
+	// operands holds copies of the operands, from the newest to the oldest if
+	// they're merged through MergeOlder and from the oldest to the newest
+	// otherwise.
+	operands [][]byte
+	older    bool
+	size     int
+}
+
+var _ base.ValueMerger = (*listMerger)(nil)
+
+func (m *listMerger) add(value []byte) error {
+	if _, err := DecodeList(value); err != nil {
+		return err
+	}
+	m.operands = append(m.operands, append([]byte(nil), value...))
+	m.size += len(value)
+	return nil
+}
+
+// MergeNewer implements base.ValueMerger.
+func (m *listMerger) MergeNewer(value []byte) error {
+	return m.add(value)
+}
+
+// MergeOlder implements base.ValueMerger.
+func (m *listMerger) MergeOlder(value []byte) error {
+	m.older = true
+	return m.add(value)
+}
+
+// Finish implements base.ValueMerger.
+func (m *listMerger) Finish(includesBase bool) ([]byte, io.Closer, error) {
+	buf := make([]byte, 0, m.size)
+	for i := range m.operands {
+		if m.older {
+			buf = append(buf, m.operands[len(m.operands)-1-i]...)
+		} else {
+			buf = append(buf, m.operands[i]...)
+		}
+	}
+	return finish(buf)
+}
@@ -0,0 +1,48 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+// Package mergeops provides Merger implementations of common merge operations:
+// counters, append-only lists, bitmaps, and maximum and minimum values. Each
+// operation is associative, so that the merges of partial chains of operands
+// by compactions are equivalent to merging all of them, and each Merger sets
+// CollapseChains, permitting compactions to collapse the chains that aren't
+// preceded by an older value into SETs.
+//
+// A DB is configured with a single Merger (see Options.Merger). Compose routes
+// the merges of each key to one of several Mergers, allowing multiple merge
+// operations to be used for different keys of a DB.
+package mergeops // import "github.com/cockroachdb/pebble/mergeops"
+
+import (
+	"io"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// Compose returns a Merger which merges the operands of each key with the
+// Merger returned by route for the key. The returned Merger is named name,
+// which must be changed whenever the routing of keys changes.
+//
+// If route returns nil for a key, merging the key fails. CollapseChains is not
+// set on the returned Merger, and may be set if every Merger returned by route
+// sets it.
+func Compose(name string, route func(key []byte) *base.Merger) *base.Merger {
+	return &base.Merger{
+		Name: name,
+		Merge: func(key, value []byte) (base.ValueMerger, error) {
+			m := route(key)
+			if m == nil {
+				return nil, errors.Errorf("mergeops: no merger for key %q", key)
+			}
+			return m.Merge(key, value)
+		},
+	}
+}
+
+// finish returns the result of a ValueMerger, which doesn't depend on whether
+// the merge included the oldest operand since the operations are associative.
+func finish(value []byte) ([]byte, io.Closer, error) {
+	return value, nil, nil
+}
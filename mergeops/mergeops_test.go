@@ -0,0 +1,211 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package mergeops
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+// merge merges the operands, ordered from the oldest to the newest, through a
+// value merger created with the operand at index start, merging the older and
+// newer operands with MergeOlder or MergeNewer.
+func merge(t *testing.T, m *base.Merger, operands [][]byte, start int, older bool) []byte {
+	vm, err := m.Merge(nil, operands[start])
+	require.NoError(t, err)
+	if older {
+		for i := start - 1; i >= 0; i-- {
+			require.NoError(t, vm.MergeOlder(operands[i]))
+		}
+	} else {
+		for i := start + 1; i < len(operands); i++ {
+			require.NoError(t, vm.MergeNewer(operands[i]))
+		}
+	}
+	v, _, err := vm.Finish(true /* includesBase */)
+	require.NoError(t, err)
+	return append([]byte{}, v...)
+}
+
+// checkAssociative checks that merging the operands in either direction, and
+// merging the partial merges of any split of the operands yields the same
+// value.
+func checkAssociative(t *testing.T, m *base.Merger, operands [][]byte) []byte {
+	expected := merge(t, m, operands, 0, false)
+	require.Equal(t, expected, merge(t, m, operands, len(operands)-1, true))
+	for split := 1; split < len(operands); split++ {
+		partial := [][]byte{
+			merge(t, m, operands[:split], split-1, true),
+			merge(t, m, operands[split:], 0, false),
+		}
+		require.Equal(t, expected, merge(t, m, partial, 1, true))
+	}
+	return expected
+}
+
+func TestCounter(t *testing.T) {
+	var operands [][]byte
+	for _, v := range []int64{5, -3, 100, 0, -1 << 40} {
+		operands = append(operands, EncodeCounter(v))
+	}
+	v, err := DecodeCounter(checkAssociative(t, Counter, operands))
+	require.NoError(t, err)
+	require.Equal(t, int64(102-1<<40), v)
+
+	_, err = Counter.Merge(nil, []byte{0xff})
+	require.Error(t, err)
+	vm, err := Counter.Merge(nil, EncodeCounter(1))
+	require.NoError(t, err)
+	require.Error(t, vm.MergeOlder(append(EncodeCounter(1), 0)))
+}
+
+func TestList(t *testing.T) {
+	operands := [][]byte{
+		EncodeList([]byte("a")),
+		EncodeList([]byte("b"), []byte("")),
+		EncodeList(),
+		EncodeList([]byte("c"), []byte("d")),
+	}
+	elems, err := DecodeList(checkAssociative(t, List, operands))
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b", "", "c", "d"}, toStrings(elems))
+
+	_, err = List.Merge(nil, []byte{5, 'a'})
+	require.Error(t, err)
+}
+
+func toStrings(elems [][]byte) []string {
+	s := make([]string, len(elems))
+	for i := range elems {
+		s[i] = string(elems[i])
+	}
+	return s
+}
+
+func TestMinMax(t *testing.T) {
+	operands := [][]byte{[]byte("m"), []byte("z"), []byte(""), []byte("za"), []byte("b")}
+	require.Equal(t, []byte("za"), checkAssociative(t, Max, operands))
+	require.Equal(t, []byte(""), checkAssociative(t, Min, operands))
+}
+
+func TestBitmap(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	// Half of the values are concentrated in the first container, so that it
+	// uses a bitset, while the others use arrays.
+	randValue := func() uint32 {
+		if rng.Intn(2) == 0 {
+			return uint32(rng.Intn(8192))
+		}
+		return uint32(1+rng.Intn(3))<<16 | uint32(rng.Intn(1<<16))
+	}
+	var operands [][]byte
+	expected := make(map[uint32]struct{})
+	for i := 0; i < 5; i++ {
+		b := &Bitmap{}
+		for j := 1000 + rng.Intn(3000); j > 0; j-- {
+			v := randValue()
+			b.Add(v)
+			expected[v] = struct{}{}
+		}
+		decoded, err := DecodeBitmap(b.Encode())
+		require.NoError(t, err)
+		require.Equal(t, b.Values(), decoded.Values())
+		operands = append(operands, b.Encode())
+	}
+
+	b, err := DecodeBitmap(checkAssociative(t, BitmapUnion, operands))
+	require.NoError(t, err)
+	require.Equal(t, len(expected), b.Cardinality())
+	require.True(t, slices.ContainsFunc(b.containers, func(c bitmapContainer) bool {
+		return c.bitset != nil
+	}))
+	values := b.Values()
+	require.True(t, slices.IsSorted(values))
+	for _, v := range values {
+		_, ok := expected[v]
+		require.True(t, ok)
+		require.True(t, b.Contains(v))
+	}
+	require.False(t, b.Contains(1<<31))
+
+	require.Equal(t, []uint32{1, 7, 1 << 20}, BitmapOf(1<<20, 7, 1, 7).Values())
+	for _, value := range [][]byte{
+		{},
+		{1},
+		{1, 0, 0, 0},
+		{1, 0, 0, 2, 5, 0, 5, 0},
+		append(BitmapOf(1).Encode(), 0),
+	} {
+		_, err := DecodeBitmap(value)
+		require.Error(t, err, "%x", value)
+	}
+}
+
+func TestCompose(t *testing.T) {
+	m := Compose("test", func(key []byte) *base.Merger {
+		switch {
+		case bytes.HasPrefix(key, []byte("count/")):
+			return Counter
+		case bytes.HasPrefix(key, []byte("max/")):
+			return Max
+		}
+		return nil
+	})
+	vm, err := m.Merge([]byte("count/a"), EncodeCounter(1))
+	require.NoError(t, err)
+	require.NoError(t, vm.MergeNewer(EncodeCounter(2)))
+	v, _, err := vm.Finish(true)
+	require.NoError(t, err)
+	require.Equal(t, EncodeCounter(3), v)
+
+	vm, err = m.Merge([]byte("max/a"), []byte("a"))
+	require.NoError(t, err)
+	require.NoError(t, vm.MergeNewer([]byte("b")))
+	v, _, err = vm.Finish(true)
+	require.NoError(t, err)
+	require.Equal(t, []byte("b"), v)
+
+	_, err = m.Merge([]byte("other"), nil)
+	require.Error(t, err)
+}
+
+// TestDB merges counters in a DB across flushes and compactions, which
+// collapse the merges.
+func TestDB(t *testing.T) {
+	d, err := pebble.Open("", &pebble.Options{FS: vfs.NewMem(), Merger: Counter})
+	require.NoError(t, err)
+	defer d.Close()
+
+	get := func(key string) int64 {
+		v, closer, err := d.Get([]byte(key))
+		require.NoError(t, err)
+		defer closer.Close()
+		n, err := DecodeCounter(v)
+		require.NoError(t, err)
+		return n
+	}
+	for i := 0; i < 10; i++ {
+		for j := 0; j < 10; j++ {
+			require.NoError(t, d.Merge([]byte(fmt.Sprint(j)), EncodeCounter(int64(j)), nil))
+		}
+		require.NoError(t, d.Flush())
+	}
+	require.NoError(t, d.Set([]byte("5"), EncodeCounter(-1), nil))
+	require.NoError(t, d.Merge([]byte("5"), EncodeCounter(2), nil))
+	require.Equal(t, int64(30), get("3"))
+	require.Equal(t, int64(1), get("5"))
+	require.NoError(t, d.Compact([]byte("0"), []byte("9\x00"), false))
+	require.Equal(t, int64(30), get("3"))
+	require.Equal(t, int64(1), get("5"))
+	require.Equal(t, int64(90), get("9"))
+}
@@ -0,0 +1,60 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package mergeops
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// Max is a Merger retaining the largest operand, comparing operands
+// bytewise. Numbers may be encoded as big-endian integers of a fixed width to
+// retain the largest number.
+var Max = &base.Merger{
+	Name: "pebble.mergeops.max",
+	Merge: func(key, value []byte) (base.ValueMerger, error) {
+		return &extremumMerger{value: append([]byte(nil), value...), sign: +1}, nil
+	},
+	CollapseChains: true,
+}
+
+// Min is a Merger retaining the smallest operand, comparing operands
+// bytewise. See Max.
+var Min = &base.Merger{
+	Name: "pebble.mergeops.min",
+	Merge: func(key, value []byte) (base.ValueMerger, error) {
+		return &extremumMerger{value: append([]byte(nil), value...), sign: -1}, nil
+	},
+	CollapseChains: true,
+}
+
+// extremumMerger retains the largest operand if sign is +1, and the smallest
+// if it's -1.
+type extremumMerger struct {
+	value []byte
+	sign  int
+}
+
+var _ base.ValueMerger = (*extremumMerger)(nil)
+
+// MergeNewer implements base.ValueMerger.
+func (m *extremumMerger) MergeNewer(value []byte) error {
+	if bytes.Compare(value, m.value)*m.sign > 0 {
+		m.value = append(m.value[:0], value...)
+	}
+	return nil
+}
+
+// MergeOlder implements base.ValueMerger.
+func (m *extremumMerger) MergeOlder(value []byte) error {
+	return m.MergeNewer(value)
+}
+
+// Finish implements base.ValueMerger.
+func (m *extremumMerger) Finish(includesBase bool) ([]byte, io.Closer, error) {
+	return finish(m.value)
+}
@@ -47,6 +47,16 @@ type mergingIterLevel struct {
 	tombstone *keyspan.Span
 }
 
+// levelStats returns the stats to which the iteration of the level with the
+// given index is attributed: the stats of its levelIter, if any, and the stats
+// of the mergingIter otherwise.
+func (m *mergingIter) levelStats(index int) *InternalIteratorStats {
+	if li := m.levels[index].levelIter; li != nil && li.internalOpts.stats != nil {
+		return li.internalOpts.stats
+	}
+	return m.stats
+}
+
 type levelIterBoundaryContext struct {
 	// isSyntheticIterBoundsKey is set to true iff the key returned by the level
 	// iterator is a synthetic key derived from the iterator bounds. This is used
@@ -822,7 +832,7 @@ func (m *mergingIter) findNextEntry() (*InternalKey, base.LazyValue) {
 			m.err = err
 			return nil, base.LazyValue{}
 		} else if isDeleted {
-			m.stats.PointsCoveredByRangeTombstones++
+			m.levelStats(item.index).PointsCoveredByRangeTombstones++
 			continue
 		}
 
@@ -957,7 +967,7 @@ func (m *mergingIter) findPrevEntry() (*InternalKey, base.LazyValue) {
 			m.err = err
 			return nil, base.LazyValue{}
 		} else if isDeleted {
-			m.stats.PointsCoveredByRangeTombstones++
+			m.levelStats(item.index).PointsCoveredByRangeTombstones++
 			continue
 		}
 		if item.iterKey.Visible(m.snapshot, m.batchSnapshot) &&
@@ -640,9 +640,44 @@ func RandomOptions(
 	opts.MaxManifestFileSize = 1 << uint(rng.Intn(30)) // 1B  - 1GB
 	opts.MemTableSize = 2 << (10 + uint(rng.Intn(16))) // 2KB - 256MB
 	opts.MemTableStopWritesThreshold = 2 + rng.Intn(5) // 2 - 5
+	if rng.Intn(4) == 0 {
+		opts.AdaptiveMemTable = pebble.AdaptiveMemTableOptions{
+			MinSize:        opts.MemTableSize,
+			MaxSize:        min(opts.MemTableSize<<uint(1+rng.Intn(3)), 1<<30), // 2x - 8x, up to 1GB
+			TargetWriteAmp: float64(rng.Intn(3) * 10),                          // 0, 10, 20
+		}
+	}
+	if rng.Intn(4) == 0 {
+		opts.Experimental.PinnedBlocksMinLevel = 5 + rng.Intn(2) // 5 - 6
+	}
+	if rng.Intn(4) == 0 {
+		opts.Experimental.TombstoneDenseCompactionThreshold = float64(1+rng.Intn(4)) / 4 // 0.25 - 1
+	}
 	if rng.Intn(2) == 0 {
 		opts.WALDir = "data/wal"
 	}
+	// Compress the WAL a third of the time. Compression only takes effect at
+	// format major versions >= FormatWALCompression.
+	switch rng.Intn(6) {
+	case 0:
+		opts.WALCompression = pebble.SnappyCompression
+	case 1:
+		opts.WALCompression = pebble.ZstdCompression
+	}
+	opts.WALReplayConcurrency = rng.Intn(4) // 0 - 3
+	// Retain history a tenth of the time.
+	if rng.Intn(10) == 0 {
+		opts.RetainHistory = time.Duration(1+rng.Intn(60)) * time.Second // 1s - 60s
+	}
+	if rng.Intn(4) == 0 {
+		opts.WALSyncInterval = time.Duration(1+rng.Intn(1000)) * time.Microsecond // 1us - 1ms
+		opts.WALMaxSyncLatency = time.Duration(rng.Intn(2000)) * time.Microsecond // 0 - 2ms
+	}
+	// Align the writes of the WAL a tenth of the time.
+	if rng.Intn(10) == 0 {
+		opts.WALWriteAlignment = 512 << rng.Intn(7) // 512B - 32KiB
+		opts.WALPadding = pebble.WALPaddingPolicy(rng.Intn(2))
+	}
 
 	// Half the time enable WAL failover.
 	if rng.Intn(2) == 0 {
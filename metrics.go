@@ -106,6 +106,17 @@ type LevelMetrics struct {
 		// LevelMetrics.format, but are available to sophisticated clients.
 		BytesWrittenDataBlocks  uint64
 		BytesWrittenValueBlocks uint64
+		// Cumulative bytes written to blob files via compactions or flushes
+		// that separated values into blob files (see
+		// Options.Experimental.BlobValueThreshold). Not printed by
+		// LevelMetrics.format.
+		BytesWrittenBlobFiles uint64
+		// Histograms of the sizes of the point keys and values, and of the
+		// uncompressed and compressed sizes of the data blocks, of the sstables
+		// in this level whose table stats have been loaded. See
+		// sstable.Properties.KeySizes. Not printed by LevelMetrics.format.
+		KeySizes, ValueSizes                     sstable.SizeHistogram
+		DataBlockSizes, CompressedDataBlockSizes sstable.SizeHistogram
 	}
 }
 
@@ -130,7 +141,12 @@ func (m *LevelMetrics) Add(u *LevelMetrics) {
 	m.MultiLevel.BytesIn += u.MultiLevel.BytesIn
 	m.Additional.BytesWrittenDataBlocks += u.Additional.BytesWrittenDataBlocks
 	m.Additional.BytesWrittenValueBlocks += u.Additional.BytesWrittenValueBlocks
+	m.Additional.BytesWrittenBlobFiles += u.Additional.BytesWrittenBlobFiles
 	m.Additional.ValueBlocksSize += u.Additional.ValueBlocksSize
+	m.Additional.KeySizes.Merge(u.Additional.KeySizes)
+	m.Additional.ValueSizes.Merge(u.Additional.ValueSizes)
+	m.Additional.DataBlockSizes.Merge(u.Additional.DataBlockSizes)
+	m.Additional.CompressedDataBlockSizes.Merge(u.Additional.CompressedDataBlockSizes)
 }
 
 // WriteAmp computes the write amplification for compactions at this
@@ -153,15 +169,17 @@ type Metrics struct {
 
 	Compact struct {
 		// The total number of compactions, and per-compaction type counts.
-		Count             int64
-		DefaultCount      int64
-		DeleteOnlyCount   int64
-		ElisionOnlyCount  int64
-		MoveCount         int64
-		ReadCount         int64
-		RewriteCount      int64
-		MultiLevelCount   int64
-		CounterLevelCount int64
+		Count                 int64
+		DefaultCount          int64
+		DeleteOnlyCount       int64
+		ElisionOnlyCount      int64
+		MoveCount             int64
+		ReadCount             int64
+		RewriteCount          int64
+		ExpiryCount           int64
+		TombstoneDensityCount int64
+		MultiLevelCount       int64
+		CounterLevelCount     int64
 		// An estimate of the number of bytes that need to be compacted for the LSM
 		// to reach a stable state.
 		EstimatedDebt uint64
@@ -213,6 +231,11 @@ type Metrics struct {
 		Size uint64
 		// The count of memtables.
 		Count int64
+		// The steady state size of memtables. This is Options.MemTableSize,
+		// unless adaptive memtable sizing is enabled (see
+		// Options.AdaptiveMemTable), in which case it's the current size
+		// MemTables are adjusted to.
+		TargetSize uint64
 		// The number of bytes present in zombie memtables which are no longer
 		// referenced by the current DB state. An unbounded number of memtables
 		// may be zombie if they're still in use by an iterator. One additional
@@ -234,6 +257,20 @@ type Metrics struct {
 		MissizedTombstonesCount uint64
 	}
 
+	// RateLimit holds the metrics of the I/O submitted to Options.RateLimiter,
+	// indexed by RateLimitClass.
+	RateLimit [NumRateLimitClasses]RateLimitMetrics
+
+	Corruption struct {
+		// The number of live tables with blocks that failed their checksum, and
+		// the number of such blocks. See DB.Quarantine.
+		QuarantinedTables int
+		QuarantinedBlocks int
+		// A cumulative total of the reads of corrupt blocks served by
+		// Options.CorruptionRecoveryHook since the database was opened.
+		RecoveredCount int64
+	}
+
 	Snapshots struct {
 		// The number of currently open snapshots.
 		Count int
@@ -249,6 +286,21 @@ type Metrics struct {
 		PinnedSize uint64
 	}
 
+	// History describes the history retained by the DB. See
+	// Options.RetainHistory.
+	History struct {
+		// Horizon is the oldest sequence number at which the DB may be read with
+		// DB.NewIterAtSeqNum, or zero if the DB doesn't retain history.
+		Horizon uint64
+		// A running tally of the obsolete keys newer than the horizon written to
+		// sstables during flushes or compactions, which are retained for reads
+		// of past states of the DB. They're included in Snapshots.PinnedKeys.
+		PinnedKeys uint64
+		// A running cumulative sum of the size of the keys and values counted
+		// by PinnedKeys.
+		PinnedSize uint64
+	}
+
 	Table struct {
 		// The number of bytes present in obsolete tables which are no longer
 		// referenced by the current DB state or any open iterators.
@@ -264,6 +316,11 @@ type Metrics struct {
 		BackingTableCount uint64
 		// The sum of the sizes of the BackingTableCount sstables that are backing virtual tables.
 		BackingTableSize uint64
+		// The count of tables whose blocks are pinned in the block cache. See
+		// DB.PinTables and Options.Experimental.PinnedBlocksMinLevel.
+		PinnedBlocksCount int64
+		// The total size of the blocks pinned in the block cache.
+		PinnedBlocksSize uint64
 
 		// Local file sizes.
 		Local struct {
@@ -299,7 +356,7 @@ type Metrics struct {
 		// TODO(sumeer): it seems this does not include ObsoletePhysicalSize.
 		// Should the comment be updated?
 		PhysicalSize uint64
-		// Number of logical bytes written to the WAL.
+		// Number of logical bytes written to the WAL, before any compression.
 		BytesIn uint64
 		// Number of bytes written to the WAL.
 		BytesWritten uint64
@@ -0,0 +1,586 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+// Package metrics exports the metrics of a Pebble DB to Prometheus.
+//
+// A Collector maps each field of pebble.Metrics to a Prometheus metric, so
+// that embedders don't need to maintain the mapping themselves:
+//
+//	registry := prometheus.NewRegistry()
+//	registry.MustRegister(metrics.NewCollector(db, metrics.Options{}))
+//	http.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+package metrics
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/sstable"
+	"github.com/cockroachdb/redact"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Source is the source of the metrics exported by a Collector. It's
+// implemented by *pebble.DB.
+type Source interface {
+	Metrics() *pebble.Metrics
+}
+
+// Options configures a Collector.
+type Options struct {
+	// Namespace prefixes the names of the metrics exported. If empty, "pebble"
+	// is used.
+	Namespace string
+	// ConstLabels are attached to all the metrics exported, e.g. to distinguish
+	// the metrics of several DBs registered with the same registry.
+	ConstLabels prometheus.Labels
+}
+
+// Collector is a prometheus.Collector exporting the metrics of a DB. Each
+// collection retrieves the metrics of the DB once.
+//
+// Durations are exported in seconds, and sizes in bytes. The per-level
+// metrics have a "level" label. The size histograms of the sstables
+// (LevelMetrics.Additional) are exported as histograms whose bucket upper
+// bounds are 2^i-1 bytes; the sum of the sizes isn't tracked, so the sum of
+// these histograms is NaN.
+type Collector struct {
+	source  Source
+	metrics []metric
+	descs   []*prometheus.Desc
+}
+
+var _ prometheus.Collector = (*Collector)(nil)
+
+// NewCollector returns a Collector exporting the metrics of source.
+func NewCollector(source Source, opts Options) *Collector {
+	namespace := opts.Namespace
+	if namespace == "" {
+		namespace = "pebble"
+	}
+	c := &Collector{source: source, metrics: definitions()}
+	c.descs = make([]*prometheus.Desc, len(c.metrics))
+	for i, m := range c.metrics {
+		c.descs[i] = prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", m.name), m.help, m.labels, opts.ConstLabels)
+	}
+	return c
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range c.descs {
+		ch <- desc
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	m := c.source.Metrics()
+	for i := range c.metrics {
+		c.metrics[i].collect(m, c.descs[i], ch)
+	}
+}
+
+// metric describes a metric exported by a Collector.
+type metric struct {
+	name   string
+	help   string
+	labels []string
+	// fields are the paths of the fields of pebble.Metrics the metric exports,
+	// e.g. "Compact.Count" or "Levels.NumFiles". They're used by the tests to
+	// check that every field is exported.
+	fields  []string
+	collect func(m *pebble.Metrics, desc *prometheus.Desc, ch chan<- prometheus.Metric)
+}
+
+func scalar(
+	typ prometheus.ValueType, name, help, field string, value func(m *pebble.Metrics) float64,
+) metric {
+	return metric{
+		name:   name,
+		help:   help,
+		fields: []string{field},
+		collect: func(m *pebble.Metrics, desc *prometheus.Desc, ch chan<- prometheus.Metric) {
+			ch <- prometheus.MustNewConstMetric(desc, typ, value(m))
+		},
+	}
+}
+
+func gauge(name, help, field string, value func(m *pebble.Metrics) float64) metric {
+	return scalar(prometheus.GaugeValue, name, help, field, value)
+}
+
+func counter(name, help, field string, value func(m *pebble.Metrics) float64) metric {
+	return scalar(prometheus.CounterValue, name, help, field, value)
+}
+
+func levelScalar(
+	typ prometheus.ValueType, name, help, field string, value func(l *pebble.LevelMetrics) float64,
+) metric {
+	return metric{
+		name:   name,
+		help:   help,
+		labels: []string{"level"},
+		fields: []string{"Levels." + field},
+		collect: func(m *pebble.Metrics, desc *prometheus.Desc, ch chan<- prometheus.Metric) {
+			for level := range m.Levels {
+				ch <- prometheus.MustNewConstMetric(desc, typ, value(&m.Levels[level]), strconv.Itoa(level))
+			}
+		},
+	}
+}
+
+func levelGauge(name, help, field string, value func(l *pebble.LevelMetrics) float64) metric {
+	return levelScalar(prometheus.GaugeValue, name, help, field, value)
+}
+
+func levelCounter(name, help, field string, value func(l *pebble.LevelMetrics) float64) metric {
+	return levelScalar(prometheus.CounterValue, name, help, field, value)
+}
+
+func levelHistogram(
+	name, help, field string, value func(l *pebble.LevelMetrics) sstable.SizeHistogram,
+) metric {
+	return metric{
+		name:   name,
+		help:   help,
+		labels: []string{"level"},
+		fields: []string{"Levels." + field},
+		collect: func(m *pebble.Metrics, desc *prometheus.Desc, ch chan<- prometheus.Metric) {
+			for level := range m.Levels {
+				ch <- sizeHistogram(desc, value(&m.Levels[level]), strconv.Itoa(level))
+			}
+		},
+	}
+}
+
+// latency exports a histogram of latencies in nanoseconds as a histogram of
+// latencies in seconds. Nothing is exported if the histogram is nil.
+func latency(name, help, field string, value func(m *pebble.Metrics) prometheus.Histogram) metric {
+	return metric{
+		name:   name,
+		help:   help,
+		fields: []string{field},
+		collect: func(m *pebble.Metrics, desc *prometheus.Desc, ch chan<- prometheus.Metric) {
+			if h := value(m); h != nil {
+				ch <- latencyHistogram(desc, h)
+			}
+		},
+	}
+}
+
+// cacheMetrics returns the metrics of the block cache and the table cache,
+// which have a "cache" label.
+func cacheMetrics(
+	typ prometheus.ValueType, name, help, field string, value func(c *pebble.CacheMetrics) int64,
+) metric {
+	return metric{
+		name:   name,
+		help:   help,
+		labels: []string{"cache"},
+		fields: []string{"BlockCache." + field, "TableCache." + field},
+		collect: func(m *pebble.Metrics, desc *prometheus.Desc, ch chan<- prometheus.Metric) {
+			ch <- prometheus.MustNewConstMetric(desc, typ, float64(value(&m.BlockCache)), "block")
+			ch <- prometheus.MustNewConstMetric(desc, typ, float64(value(&m.TableCache)), "table")
+		},
+	}
+}
+
+func rateLimitMetrics(
+	name, help, field string, value func(r *pebble.RateLimitMetrics) float64,
+) metric {
+	return metric{
+		name:   name,
+		help:   help,
+		labels: []string{"class"},
+		fields: []string{"RateLimit." + field},
+		collect: func(m *pebble.Metrics, desc *prometheus.Desc, ch chan<- prometheus.Metric) {
+			for class := range m.RateLimit {
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue,
+					value(&m.RateLimit[class]), pebble.RateLimitClass(class).String())
+			}
+		},
+	}
+}
+
+func categoryMetrics(name, help string, value func(s *sstable.CategoryStats) float64) metric {
+	return metric{
+		name:   name,
+		help:   help,
+		labels: []string{"category", "qos"},
+		fields: []string{"CategoryStats"},
+		collect: func(m *pebble.Metrics, desc *prometheus.Desc, ch chan<- prometheus.Metric) {
+			for i := range m.CategoryStats {
+				s := &m.CategoryStats[i]
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, value(&s.CategoryStats),
+					string(s.Category), redact.StringWithoutMarkers(s.QoSLevel))
+			}
+		},
+	}
+}
+
+// compactionKinds are the kinds of compactions counted by Metrics.Compact.
+var compactionKinds = []struct {
+	kind  string
+	field string
+	count func(m *pebble.Metrics) int64
+}{
+	{"default", "DefaultCount", func(m *pebble.Metrics) int64 { return m.Compact.DefaultCount }},
+	{"delete-only", "DeleteOnlyCount", func(m *pebble.Metrics) int64 { return m.Compact.DeleteOnlyCount }},
+	{"elision-only", "ElisionOnlyCount", func(m *pebble.Metrics) int64 { return m.Compact.ElisionOnlyCount }},
+	{"move", "MoveCount", func(m *pebble.Metrics) int64 { return m.Compact.MoveCount }},
+	{"read", "ReadCount", func(m *pebble.Metrics) int64 { return m.Compact.ReadCount }},
+	{"rewrite", "RewriteCount", func(m *pebble.Metrics) int64 { return m.Compact.RewriteCount }},
+	{"expiry", "ExpiryCount", func(m *pebble.Metrics) int64 { return m.Compact.ExpiryCount }},
+	{"tombstone-density", "TombstoneDensityCount", func(m *pebble.Metrics) int64 { return m.Compact.TombstoneDensityCount }},
+	{"multi-level", "MultiLevelCount", func(m *pebble.Metrics) int64 { return m.Compact.MultiLevelCount }},
+	{"counter-level", "CounterLevelCount", func(m *pebble.Metrics) int64 { return m.Compact.CounterLevelCount }},
+}
+
+func compactionKindMetric() metric {
+	mt := metric{
+		name:   "compactions_by_kind_total",
+		help:   "Number of compactions, by kind. Multi-level compactions are also counted as default compactions.",
+		labels: []string{"kind"},
+		collect: func(m *pebble.Metrics, desc *prometheus.Desc, ch chan<- prometheus.Metric) {
+			for _, k := range compactionKinds {
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, float64(k.count(m)), k.kind)
+			}
+		},
+	}
+	for _, k := range compactionKinds {
+		mt.fields = append(mt.fields, "Compact."+k.field)
+	}
+	return mt
+}
+
+// unexportedFields are the paths of the fields of pebble.Metrics that aren't
+// exported by a Collector.
+var unexportedFields = []string{
+	// The samples are averaged since the DB was opened, which isn't meaningful
+	// as a gauge.
+	"LogWriter.LogWriterMetrics.PendingBufferLen",
+	"LogWriter.LogWriterMetrics.SyncQueueLen",
+	"LogWriter.LogWriterMetrics.SyncGroupSize",
+}
+
+func seconds(d time.Duration) float64 {
+	return d.Seconds()
+}
+
+// definitions returns the metrics exported by a Collector.
+func definitions() []metric {
+	return []metric{
+		// Compactions.
+		counter("compactions_total", "Number of compactions.", "Compact.Count",
+			func(m *pebble.Metrics) float64 { return float64(m.Compact.Count) }),
+		compactionKindMetric(),
+		gauge("compaction_estimated_debt_bytes", "Estimated number of bytes that need to be compacted for the LSM to reach a stable state.", "Compact.EstimatedDebt",
+			func(m *pebble.Metrics) float64 { return float64(m.Compact.EstimatedDebt) }),
+		gauge("compaction_in_progress_bytes", "Number of bytes present in sstables being written by in-progress compactions.", "Compact.InProgressBytes",
+			func(m *pebble.Metrics) float64 { return float64(m.Compact.InProgressBytes) }),
+		gauge("compactions_in_progress", "Number of compactions in progress.", "Compact.NumInProgress",
+			func(m *pebble.Metrics) float64 { return float64(m.Compact.NumInProgress) }),
+		gauge("compaction_marked_files", "Number of files marked for compaction.", "Compact.MarkedFiles",
+			func(m *pebble.Metrics) float64 { return float64(m.Compact.MarkedFiles) }),
+		counter("compaction_duration_seconds_total", "Cumulative duration of the compactions.", "Compact.Duration",
+			func(m *pebble.Metrics) float64 { return seconds(m.Compact.Duration) }),
+
+		// Ingestions and flushes.
+		counter("ingestions_total", "Number of successful ingestions.", "Ingest.Count",
+			func(m *pebble.Metrics) float64 { return float64(m.Ingest.Count) }),
+		counter("flushes_total", "Number of flushes.", "Flush.Count",
+			func(m *pebble.Metrics) float64 { return float64(m.Flush.Count) }),
+		counter("flush_write_bytes_total", "Number of bytes written by flushes.", "Flush.WriteThroughput.Bytes",
+			func(m *pebble.Metrics) float64 { return float64(m.Flush.WriteThroughput.Bytes) }),
+		counter("flush_work_seconds_total", "Cumulative duration of the work of flushes.", "Flush.WriteThroughput.WorkDuration",
+			func(m *pebble.Metrics) float64 { return seconds(m.Flush.WriteThroughput.WorkDuration) }),
+		counter("flush_idle_seconds_total", "Cumulative duration flushes were idle.", "Flush.WriteThroughput.IdleDuration",
+			func(m *pebble.Metrics) float64 { return seconds(m.Flush.WriteThroughput.IdleDuration) }),
+		gauge("flushes_in_progress", "Number of flushes in progress.", "Flush.NumInProgress",
+			func(m *pebble.Metrics) float64 { return float64(m.Flush.NumInProgress) }),
+		counter("flushes_as_ingest_total", "Number of flushes of flushableIngests.", "Flush.AsIngestCount",
+			func(m *pebble.Metrics) float64 { return float64(m.Flush.AsIngestCount) }),
+		counter("flush_as_ingest_tables_total", "Number of sstables flushed by flushes of flushableIngests.", "Flush.AsIngestTableCount",
+			func(m *pebble.Metrics) float64 { return float64(m.Flush.AsIngestTableCount) }),
+		counter("flush_as_ingest_bytes_total", "Number of bytes flushed by flushes of flushableIngests.", "Flush.AsIngestBytes",
+			func(m *pebble.Metrics) float64 { return float64(m.Flush.AsIngestBytes) }),
+
+		// Filters.
+		counter("filter_hits_total", "Number of times the filter policy avoided the access of a data block.", "Filter.Hits",
+			func(m *pebble.Metrics) float64 { return float64(m.Filter.Hits) }),
+		counter("filter_misses_total", "Number of times the filter policy didn't avoid the access of a data block.", "Filter.Misses",
+			func(m *pebble.Metrics) float64 { return float64(m.Filter.Misses) }),
+
+		// Levels.
+		levelGauge("level_sublevels", "Number of sublevels within the level.", "Sublevels",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.Sublevels) }),
+		levelGauge("level_files", "Number of files in the level.", "NumFiles",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.NumFiles) }),
+		levelGauge("level_virtual_files", "Number of virtual sstables in the level.", "NumVirtualFiles",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.NumVirtualFiles) }),
+		levelGauge("level_size_bytes", "Total size of the files in the level.", "Size",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.Size) }),
+		levelGauge("level_virtual_size_bytes", "Total size of the virtual sstables in the level.", "VirtualSize",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.VirtualSize) }),
+		levelGauge("level_score", "Compaction score of the level.", "Score",
+			func(l *pebble.LevelMetrics) float64 { return l.Score }),
+		levelCounter("level_bytes_in_total", "Number of incoming bytes from other levels.", "BytesIn",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.BytesIn) }),
+		levelCounter("level_bytes_ingested_total", "Number of bytes ingested.", "BytesIngested",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.BytesIngested) }),
+		levelCounter("level_bytes_moved_total", "Number of bytes moved into the level by a move compaction.", "BytesMoved",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.BytesMoved) }),
+		levelCounter("level_bytes_read_total", "Number of bytes read for compactions at the level.", "BytesRead",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.BytesRead) }),
+		levelCounter("level_bytes_compacted_total", "Number of bytes written during compactions.", "BytesCompacted",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.BytesCompacted) }),
+		levelCounter("level_bytes_flushed_total", "Number of bytes written during flushes.", "BytesFlushed",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.BytesFlushed) }),
+		levelCounter("level_tables_compacted_total", "Number of sstables compacted to the level.", "TablesCompacted",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.TablesCompacted) }),
+		levelCounter("level_tables_flushed_total", "Number of sstables flushed to the level.", "TablesFlushed",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.TablesFlushed) }),
+		levelCounter("level_tables_ingested_total", "Number of sstables ingested into the level.", "TablesIngested",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.TablesIngested) }),
+		levelCounter("level_tables_moved_total", "Number of sstables moved to the level by a move compaction.", "TablesMoved",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.TablesMoved) }),
+		levelCounter("level_multilevel_bytes_in_top_total", "Number of bytes at the level read by multi-level compactions starting at the level.", "MultiLevel.BytesInTop",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.MultiLevel.BytesInTop) }),
+		levelCounter("level_multilevel_bytes_in_total", "Number of bytes read by multi-level compactions from the level above.", "MultiLevel.BytesIn",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.MultiLevel.BytesIn) }),
+		levelCounter("level_multilevel_bytes_read_total", "Number of bytes read by multi-level compactions involving the level.", "MultiLevel.BytesRead",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.MultiLevel.BytesRead) }),
+		levelGauge("level_value_blocks_size_bytes", "Total size of the value blocks and value index blocks in the level.", "Additional.ValueBlocksSize",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.Additional.ValueBlocksSize) }),
+		levelCounter("level_data_blocks_written_bytes_total", "Number of bytes written to the data blocks of sstables.", "Additional.BytesWrittenDataBlocks",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.Additional.BytesWrittenDataBlocks) }),
+		levelCounter("level_value_blocks_written_bytes_total", "Number of bytes written to the value blocks of sstables.", "Additional.BytesWrittenValueBlocks",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.Additional.BytesWrittenValueBlocks) }),
+		levelCounter("level_blob_files_written_bytes_total", "Number of bytes written to blob files.", "Additional.BytesWrittenBlobFiles",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.Additional.BytesWrittenBlobFiles) }),
+		levelHistogram("level_key_size_bytes", "Sizes of the keys of the sstables in the level.", "Additional.KeySizes",
+			func(l *pebble.LevelMetrics) sstable.SizeHistogram { return l.Additional.KeySizes }),
+		levelHistogram("level_value_size_bytes", "Sizes of the values of the sstables in the level.", "Additional.ValueSizes",
+			func(l *pebble.LevelMetrics) sstable.SizeHistogram { return l.Additional.ValueSizes }),
+		levelHistogram("level_data_block_size_bytes", "Uncompressed sizes of the data blocks of the sstables in the level.", "Additional.DataBlockSizes",
+			func(l *pebble.LevelMetrics) sstable.SizeHistogram { return l.Additional.DataBlockSizes }),
+		levelHistogram("level_compressed_data_block_size_bytes", "Compressed sizes of the data blocks of the sstables in the level.", "Additional.CompressedDataBlockSizes",
+			func(l *pebble.LevelMetrics) sstable.SizeHistogram { return l.Additional.CompressedDataBlockSizes }),
+		{
+			name: "read_amp",
+			help: "Current read amplification of the DB.",
+			collect: func(m *pebble.Metrics, desc *prometheus.Desc, ch chan<- prometheus.Metric) {
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(m.ReadAmp()))
+			},
+		},
+		{
+			name: "disk_space_usage_bytes",
+			help: "Total disk space used by the DB, including live and obsolete files.",
+			collect: func(m *pebble.Metrics, desc *prometheus.Desc, ch chan<- prometheus.Metric) {
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(m.DiskSpaceUsage()))
+			},
+		},
+
+		// Memtables.
+		gauge("memtable_size_bytes", "Number of bytes allocated by memtables and large batches.", "MemTable.Size",
+			func(m *pebble.Metrics) float64 { return float64(m.MemTable.Size) }),
+		gauge("memtables", "Number of memtables.", "MemTable.Count",
+			func(m *pebble.Metrics) float64 { return float64(m.MemTable.Count) }),
+		gauge("memtable_target_size_bytes", "Target size of the next memtable.", "MemTable.TargetSize",
+			func(m *pebble.Metrics) float64 { return float64(m.MemTable.TargetSize) }),
+		gauge("memtable_zombie_size_bytes", "Number of bytes allocated by zombie memtables.", "MemTable.ZombieSize",
+			func(m *pebble.Metrics) float64 { return float64(m.MemTable.ZombieSize) }),
+		gauge("memtable_zombies", "Number of zombie memtables.", "MemTable.ZombieCount",
+			func(m *pebble.Metrics) float64 { return float64(m.MemTable.ZombieCount) }),
+
+		// Keys.
+		gauge("keys_range_key_sets", "Approximate number of internal range key set keys.", "Keys.RangeKeySetsCount",
+			func(m *pebble.Metrics) float64 { return float64(m.Keys.RangeKeySetsCount) }),
+		gauge("keys_tombstones", "Approximate number of internal tombstones.", "Keys.TombstoneCount",
+			func(m *pebble.Metrics) float64 { return float64(m.Keys.TombstoneCount) }),
+		counter("keys_missized_tombstones_total", "Number of DELSIZED tombstones whose size didn't match the deleted value.", "Keys.MissizedTombstonesCount",
+			func(m *pebble.Metrics) float64 { return float64(m.Keys.MissizedTombstonesCount) }),
+
+		// Corruption.
+		gauge("corruption_quarantined_tables", "Number of live tables with blocks that failed their checksum.", "Corruption.QuarantinedTables",
+			func(m *pebble.Metrics) float64 { return float64(m.Corruption.QuarantinedTables) }),
+		gauge("corruption_quarantined_blocks", "Number of blocks of live tables that failed their checksum.", "Corruption.QuarantinedBlocks",
+			func(m *pebble.Metrics) float64 { return float64(m.Corruption.QuarantinedBlocks) }),
+		counter("corruption_recovered_total", "Number of reads of corrupt blocks served by the corruption recovery hook.", "Corruption.RecoveredCount",
+			func(m *pebble.Metrics) float64 { return float64(m.Corruption.RecoveredCount) }),
+
+		// Rate limiting.
+		rateLimitMetrics("rate_limit_bytes_total", "Number of bytes of I/O submitted to the rate limiter, by class.", "Bytes",
+			func(r *pebble.RateLimitMetrics) float64 { return float64(r.Bytes) }),
+		rateLimitMetrics("rate_limit_wait_seconds_total", "Cumulative duration spent waiting on the rate limiter, by class.", "WaitDuration",
+			func(r *pebble.RateLimitMetrics) float64 { return seconds(r.WaitDuration) }),
+
+		// Snapshots and history.
+		gauge("snapshots", "Number of open snapshots.", "Snapshots.Count",
+			func(m *pebble.Metrics) float64 { return float64(m.Snapshots.Count) }),
+		gauge("snapshot_earliest_seqnum", "Sequence number of the earliest open snapshot.", "Snapshots.EarliestSeqNum",
+			func(m *pebble.Metrics) float64 { return float64(m.Snapshots.EarliestSeqNum) }),
+		counter("snapshot_pinned_keys_total", "Number of keys written to sstables that would have been elided without open snapshots.", "Snapshots.PinnedKeys",
+			func(m *pebble.Metrics) float64 { return float64(m.Snapshots.PinnedKeys) }),
+		counter("snapshot_pinned_bytes_total", "Size of the keys and values written to sstables that would have been elided without open snapshots.", "Snapshots.PinnedSize",
+			func(m *pebble.Metrics) float64 { return float64(m.Snapshots.PinnedSize) }),
+		gauge("history_horizon_seqnum", "Sequence number above which the history of the DB is retained.", "History.Horizon",
+			func(m *pebble.Metrics) float64 { return float64(m.History.Horizon) }),
+		counter("history_pinned_keys_total", "Number of keys written to sstables that were retained for the history of the DB.", "History.PinnedKeys",
+			func(m *pebble.Metrics) float64 { return float64(m.History.PinnedKeys) }),
+		counter("history_pinned_bytes_total", "Size of the keys and values written to sstables that were retained for the history of the DB.", "History.PinnedSize",
+			func(m *pebble.Metrics) float64 { return float64(m.History.PinnedSize) }),
+
+		// Tables.
+		gauge("table_obsolete_size_bytes", "Number of bytes present in obsolete tables.", "Table.ObsoleteSize",
+			func(m *pebble.Metrics) float64 { return float64(m.Table.ObsoleteSize) }),
+		gauge("table_obsolete", "Number of obsolete tables.", "Table.ObsoleteCount",
+			func(m *pebble.Metrics) float64 { return float64(m.Table.ObsoleteCount) }),
+		gauge("table_zombie_size_bytes", "Number of bytes present in zombie tables.", "Table.ZombieSize",
+			func(m *pebble.Metrics) float64 { return float64(m.Table.ZombieSize) }),
+		gauge("table_zombies", "Number of zombie tables.", "Table.ZombieCount",
+			func(m *pebble.Metrics) float64 { return float64(m.Table.ZombieCount) }),
+		gauge("table_backing", "Number of sstables backing virtual sstables.", "Table.BackingTableCount",
+			func(m *pebble.Metrics) float64 { return float64(m.Table.BackingTableCount) }),
+		gauge("table_backing_size_bytes", "Size of the sstables backing virtual sstables.", "Table.BackingTableSize",
+			func(m *pebble.Metrics) float64 { return float64(m.Table.BackingTableSize) }),
+		gauge("table_pinned_blocks", "Number of blocks pinned by open sstable iterators.", "Table.PinnedBlocksCount",
+			func(m *pebble.Metrics) float64 { return float64(m.Table.PinnedBlocksCount) }),
+		gauge("table_pinned_blocks_size_bytes", "Size of the blocks pinned by open sstable iterators.", "Table.PinnedBlocksSize",
+			func(m *pebble.Metrics) float64 { return float64(m.Table.PinnedBlocksSize) }),
+		gauge("table_local_live_size_bytes", "Number of bytes in live tables stored locally.", "Table.Local.LiveSize",
+			func(m *pebble.Metrics) float64 { return float64(m.Table.Local.LiveSize) }),
+		gauge("table_local_obsolete_size_bytes", "Number of bytes in obsolete tables stored locally.", "Table.Local.ObsoleteSize",
+			func(m *pebble.Metrics) float64 { return float64(m.Table.Local.ObsoleteSize) }),
+		gauge("table_local_zombie_size_bytes", "Number of bytes in zombie tables stored locally.", "Table.Local.ZombieSize",
+			func(m *pebble.Metrics) float64 { return float64(m.Table.Local.ZombieSize) }),
+		gauge("table_iterators", "Number of open sstable iterators.", "TableIters",
+			func(m *pebble.Metrics) float64 { return float64(m.TableIters) }),
+
+		// Caches.
+		cacheMetrics(prometheus.GaugeValue, "cache_size_bytes", "Number of bytes in the cache.", "Size",
+			func(c *pebble.CacheMetrics) int64 { return c.Size }),
+		cacheMetrics(prometheus.GaugeValue, "cache_entries", "Number of objects in the cache.", "Count",
+			func(c *pebble.CacheMetrics) int64 { return c.Count }),
+		cacheMetrics(prometheus.GaugeValue, "cache_pinned_size_bytes", "Number of bytes pinned by the cache.", "PinnedSize",
+			func(c *pebble.CacheMetrics) int64 { return c.PinnedSize }),
+		cacheMetrics(prometheus.GaugeValue, "cache_pinned_entries", "Number of objects pinned by the cache.", "PinnedCount",
+			func(c *pebble.CacheMetrics) int64 { return c.PinnedCount }),
+		cacheMetrics(prometheus.CounterValue, "cache_hits_total", "Number of cache hits.", "Hits",
+			func(c *pebble.CacheMetrics) int64 { return c.Hits }),
+		cacheMetrics(prometheus.CounterValue, "cache_misses_total", "Number of cache misses.", "Misses",
+			func(c *pebble.CacheMetrics) int64 { return c.Misses }),
+
+		// Secondary cache.
+		gauge("secondary_cache_size_bytes", "Number of sstable bytes stored in the secondary cache.", "SecondaryCacheMetrics.Size",
+			func(m *pebble.Metrics) float64 { return float64(m.SecondaryCacheMetrics.Size) }),
+		gauge("secondary_cache_blocks", "Number of cache blocks in the secondary cache.", "SecondaryCacheMetrics.Count",
+			func(m *pebble.Metrics) float64 { return float64(m.SecondaryCacheMetrics.Count) }),
+		gauge("secondary_cache_recovered_blocks", "Number of cache blocks recovered when the secondary cache was opened.", "SecondaryCacheMetrics.Recovered",
+			func(m *pebble.Metrics) float64 { return float64(m.SecondaryCacheMetrics.Recovered) }),
+		counter("secondary_cache_reads_total", "Number of reads from the secondary cache.", "SecondaryCacheMetrics.TotalReads",
+			func(m *pebble.Metrics) float64 { return float64(m.SecondaryCacheMetrics.TotalReads) }),
+		counter("secondary_cache_multi_shard_reads_total", "Number of reads from the secondary cache spanning several shards.", "SecondaryCacheMetrics.MultiShardReads",
+			func(m *pebble.Metrics) float64 { return float64(m.SecondaryCacheMetrics.MultiShardReads) }),
+		counter("secondary_cache_multi_block_reads_total", "Number of reads from the secondary cache spanning several cache blocks.", "SecondaryCacheMetrics.MultiBlockReads",
+			func(m *pebble.Metrics) float64 { return float64(m.SecondaryCacheMetrics.MultiBlockReads) }),
+		counter("secondary_cache_full_hits_total", "Number of reads whose data was entirely read from the secondary cache.", "SecondaryCacheMetrics.ReadsWithFullHit",
+			func(m *pebble.Metrics) float64 { return float64(m.SecondaryCacheMetrics.ReadsWithFullHit) }),
+		counter("secondary_cache_partial_hits_total", "Number of reads whose data was partially read from the secondary cache.", "SecondaryCacheMetrics.ReadsWithPartialHit",
+			func(m *pebble.Metrics) float64 { return float64(m.SecondaryCacheMetrics.ReadsWithPartialHit) }),
+		counter("secondary_cache_misses_total", "Number of reads whose data wasn't read from the secondary cache.", "SecondaryCacheMetrics.ReadsWithNoHit",
+			func(m *pebble.Metrics) float64 { return float64(m.SecondaryCacheMetrics.ReadsWithNoHit) }),
+		counter("secondary_cache_evictions_total", "Number of cache blocks evicted from the secondary cache.", "SecondaryCacheMetrics.Evictions",
+			func(m *pebble.Metrics) float64 { return float64(m.SecondaryCacheMetrics.Evictions) }),
+		counter("secondary_cache_write_back_failures_total", "Number of failed writes of cache blocks to the secondary cache.", "SecondaryCacheMetrics.WriteBackFailures",
+			func(m *pebble.Metrics) float64 { return float64(m.SecondaryCacheMetrics.WriteBackFailures) }),
+		latency("secondary_cache_get_latency_seconds", "Latency of reads from the secondary cache.", "SecondaryCacheMetrics.GetLatency",
+			func(m *pebble.Metrics) prometheus.Histogram { return m.SecondaryCacheMetrics.GetLatency }),
+		latency("secondary_cache_disk_read_latency_seconds", "Latency of reads of a cache block from disk.", "SecondaryCacheMetrics.DiskReadLatency",
+			func(m *pebble.Metrics) prometheus.Histogram { return m.SecondaryCacheMetrics.DiskReadLatency }),
+		latency("secondary_cache_queue_put_latency_seconds", "Latency of queueing data to write back to the secondary cache.", "SecondaryCacheMetrics.QueuePutLatency",
+			func(m *pebble.Metrics) prometheus.Histogram { return m.SecondaryCacheMetrics.QueuePutLatency }),
+		latency("secondary_cache_put_latency_seconds", "Latency of writes to the secondary cache.", "SecondaryCacheMetrics.PutLatency",
+			func(m *pebble.Metrics) prometheus.Histogram { return m.SecondaryCacheMetrics.PutLatency }),
+		latency("secondary_cache_disk_write_latency_seconds", "Latency of writes of a cache block to disk.", "SecondaryCacheMetrics.DiskWriteLatency",
+			func(m *pebble.Metrics) prometheus.Histogram { return m.SecondaryCacheMetrics.DiskWriteLatency }),
+
+		// Reads by category.
+		categoryMetrics("category_block_bytes_total", "Number of bytes of the blocks loaded by sstable iterators, by category.",
+			func(s *sstable.CategoryStats) float64 { return float64(s.BlockBytes) }),
+		categoryMetrics("category_block_bytes_in_cache_total", "Number of bytes of the blocks loaded by sstable iterators that were in the block cache, by category.",
+			func(s *sstable.CategoryStats) float64 { return float64(s.BlockBytesInCache) }),
+		categoryMetrics("category_block_read_seconds_total", "Cumulative duration of the reads of the blocks that weren't in the block cache, by category.",
+			func(s *sstable.CategoryStats) float64 { return seconds(s.BlockReadDuration) }),
+
+		// WAL.
+		gauge("wal_files", "Number of live WAL files.", "WAL.Files",
+			func(m *pebble.Metrics) float64 { return float64(m.WAL.Files) }),
+		gauge("wal_obsolete_files", "Number of obsolete WAL files.", "WAL.ObsoleteFiles",
+			func(m *pebble.Metrics) float64 { return float64(m.WAL.ObsoleteFiles) }),
+		gauge("wal_obsolete_physical_size_bytes", "Physical size of the obsolete WAL files.", "WAL.ObsoletePhysicalSize",
+			func(m *pebble.Metrics) float64 { return float64(m.WAL.ObsoletePhysicalSize) }),
+		gauge("wal_size_bytes", "Size of the live data in the WAL files.", "WAL.Size",
+			func(m *pebble.Metrics) float64 { return float64(m.WAL.Size) }),
+		gauge("wal_physical_size_bytes", "Physical size of the WAL files on disk.", "WAL.PhysicalSize",
+			func(m *pebble.Metrics) float64 { return float64(m.WAL.PhysicalSize) }),
+		counter("wal_bytes_in_total", "Number of logical bytes written to the WAL.", "WAL.BytesIn",
+			func(m *pebble.Metrics) float64 { return float64(m.WAL.BytesIn) }),
+		counter("wal_bytes_written_total", "Number of bytes written to the WAL.", "WAL.BytesWritten",
+			func(m *pebble.Metrics) float64 { return float64(m.WAL.BytesWritten) }),
+		counter("wal_failover_dir_switches_total", "Number of times WAL writing switched to a different directory.", "WAL.Failover.DirSwitchCount",
+			func(m *pebble.Metrics) float64 { return float64(m.WAL.Failover.DirSwitchCount) }),
+		counter("wal_failover_primary_write_seconds_total", "Cumulative duration WAL writes were using the primary directory.", "WAL.Failover.PrimaryWriteDuration",
+			func(m *pebble.Metrics) float64 { return seconds(m.WAL.Failover.PrimaryWriteDuration) }),
+		counter("wal_failover_secondary_write_seconds_total", "Cumulative duration WAL writes were using the secondary directory.", "WAL.Failover.SecondaryWriteDuration",
+			func(m *pebble.Metrics) float64 { return seconds(m.WAL.Failover.SecondaryWriteDuration) }),
+		latency("wal_fsync_latency_seconds", "Latency of the fsyncs of the WAL.", "LogWriter.FsyncLatency",
+			func(m *pebble.Metrics) prometheus.Histogram { return m.LogWriter.FsyncLatency }),
+		counter("wal_writer_bytes_total", "Number of bytes written by the WAL writer.", "LogWriter.LogWriterMetrics.WriteThroughput.Bytes",
+			func(m *pebble.Metrics) float64 { return float64(m.LogWriter.WriteThroughput.Bytes) }),
+		counter("wal_writer_work_seconds_total", "Cumulative duration of the work of the WAL writer.", "LogWriter.LogWriterMetrics.WriteThroughput.WorkDuration",
+			func(m *pebble.Metrics) float64 { return seconds(m.LogWriter.WriteThroughput.WorkDuration) }),
+		counter("wal_writer_idle_seconds_total", "Cumulative duration the WAL writer was idle.", "LogWriter.LogWriterMetrics.WriteThroughput.IdleDuration",
+			func(m *pebble.Metrics) float64 { return seconds(m.LogWriter.WriteThroughput.IdleDuration) }),
+
+		gauge("uptime_seconds", "Duration since the DB was opened.", "Uptime",
+			func(m *pebble.Metrics) float64 { return seconds(m.Uptime) }),
+	}
+}
+
+// sizeHistogram converts a histogram of sizes to a Prometheus histogram. The
+// bucket i of the histogram counts the sizes within [2^(i-1), 2^i), whose
+// upper bound is 2^i-1.
+func sizeHistogram(
+	desc *prometheus.Desc, h sstable.SizeHistogram, labelValues ...string,
+) prometheus.Metric {
+	buckets := make(map[float64]uint64, len(h))
+	var count uint64
+	for i, n := range h {
+		count += n
+		buckets[math.Ldexp(1, i)-1] = count
+	}
+	return prometheus.MustNewConstHistogram(desc, count, math.NaN(), buckets, labelValues...)
+}
+
+// latencyHistogram converts a histogram of latencies in nanoseconds to a
+// histogram of latencies in seconds.
+func latencyHistogram(desc *prometheus.Desc, h prometheus.Histogram) prometheus.Metric {
+	var pb dto.Metric
+	if err := h.Write(&pb); err != nil {
+		return prometheus.NewInvalidMetric(desc, err)
+	}
+	hist := pb.GetHistogram()
+	buckets := make(map[float64]uint64, len(hist.GetBucket()))
+	for _, b := range hist.GetBucket() {
+		buckets[b.GetUpperBound()/float64(time.Second)] = b.GetCumulativeCount()
+	}
+	return prometheus.MustNewConstHistogram(desc, hist.GetSampleCount(),
+		hist.GetSampleSum()/float64(time.Second), buckets)
+}
@@ -0,0 +1,149 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package metrics
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+// leafFields returns the paths of the exported leaf fields of t. Arrays share
+// the path of their elements, and structs without exported fields are leaves.
+func leafFields(t reflect.Type, prefix string) []string {
+	switch t.Kind() {
+	case reflect.Array:
+		return leafFields(t.Elem(), prefix)
+	case reflect.Struct:
+		var fields []string
+		for i := 0; i < t.NumField(); i++ {
+			if f := t.Field(i); f.IsExported() {
+				fields = append(fields, leafFields(f.Type, prefix+f.Name+".")...)
+			}
+		}
+		if len(fields) > 0 {
+			return fields
+		}
+	}
+	return []string{prefix[:len(prefix)-1]}
+}
+
+// TestAllFieldsExported checks that every field of pebble.Metrics is exported
+// by the Collector, so that the fields added to pebble.Metrics aren't missed.
+func TestAllFieldsExported(t *testing.T) {
+	exported := make(map[string]bool)
+	for _, m := range definitions() {
+		for _, f := range m.fields {
+			exported[f] = true
+		}
+	}
+	for _, f := range unexportedFields {
+		exported[f] = true
+	}
+	var missing []string
+	for _, f := range leafFields(reflect.TypeOf(pebble.Metrics{}), "") {
+		if !exported[f] {
+			missing = append(missing, f)
+		}
+		delete(exported, f)
+	}
+	require.Empty(t, missing, "fields of pebble.Metrics not exported")
+	var unknown []string
+	for f := range exported {
+		unknown = append(unknown, f)
+	}
+	sort.Strings(unknown)
+	require.Empty(t, unknown, "unknown fields of pebble.Metrics")
+}
+
+func TestCollector(t *testing.T) {
+	d, err := pebble.Open("", &pebble.Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), pebble.Sync))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("b"), []byte("2"), pebble.Sync))
+
+	registry := prometheus.NewRegistry()
+	c := NewCollector(d, Options{ConstLabels: prometheus.Labels{"store": "1"}})
+	require.NoError(t, registry.Register(c))
+	problems, err := testutil.GatherAndLint(registry)
+	require.NoError(t, err)
+	require.Empty(t, problems)
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	byName := make(map[string]*dto.MetricFamily)
+	for _, f := range families {
+		byName[f.GetName()] = f
+	}
+	labelValue := func(m *dto.Metric, name string) string {
+		for _, l := range m.GetLabel() {
+			if l.GetName() == name {
+				return l.GetValue()
+			}
+		}
+		return ""
+	}
+
+	flushes := byName["pebble_flushes_total"]
+	require.NotNil(t, flushes)
+	require.Equal(t, dto.MetricType_COUNTER, flushes.GetType())
+	require.Equal(t, float64(1), flushes.GetMetric()[0].GetCounter().GetValue())
+	require.Equal(t, "1", labelValue(flushes.GetMetric()[0], "store"))
+
+	files := byName["pebble_level_files"]
+	require.NotNil(t, files)
+	require.Len(t, files.GetMetric(), 7)
+	for _, m := range files.GetMetric() {
+		v := m.GetGauge().GetValue()
+		if labelValue(m, "level") == "0" {
+			require.Equal(t, float64(1), v)
+		} else {
+			require.Equal(t, float64(0), v)
+		}
+	}
+
+	keySizes := byName["pebble_level_key_size_bytes"]
+	require.NotNil(t, keySizes)
+	for _, m := range keySizes.GetMetric() {
+		if labelValue(m, "level") == "0" {
+			require.Equal(t, uint64(1), m.GetHistogram().GetSampleCount())
+		}
+	}
+
+	fsync := byName["pebble_wal_fsync_latency_seconds"]
+	require.NotNil(t, fsync)
+	require.Equal(t, dto.MetricType_HISTOGRAM, fsync.GetType())
+	require.Greater(t, fsync.GetMetric()[0].GetHistogram().GetSampleCount(), uint64(0))
+	require.Less(t, fsync.GetMetric()[0].GetHistogram().GetSampleSum(), float64(60))
+
+	caches := byName["pebble_cache_hits_total"]
+	require.NotNil(t, caches)
+	require.Len(t, caches.GetMetric(), 2)
+}
+
+func TestSizeHistogram(t *testing.T) {
+	desc := prometheus.NewDesc("h", "help", nil, nil)
+	var pb dto.Metric
+	require.NoError(t, sizeHistogram(desc, []uint64{1, 0, 2, 3}).Write(&pb))
+	h := pb.GetHistogram()
+	require.Equal(t, uint64(6), h.GetSampleCount())
+	var bounds []float64
+	var counts []uint64
+	for _, b := range h.GetBucket() {
+		bounds = append(bounds, b.GetUpperBound())
+		counts = append(counts, b.GetCumulativeCount())
+	}
+	require.Equal(t, []float64{0, 1, 3, 7}, bounds)
+	require.Equal(t, []uint64{1, 1, 3, 6}, counts)
+}
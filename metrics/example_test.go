@@ -0,0 +1,60 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package metrics_test
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/metrics"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func Example() {
+	db, err := pebble.Open("", &pebble.Options{FS: vfs.NewMem()})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metrics.NewCollector(db, metrics.Options{}))
+	handler := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	// A server would typically serve the metrics with:
+	//
+	//	http.Handle("/metrics", handler)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, line := range strings.Split(string(body), "\n") {
+		if strings.HasPrefix(line, "pebble_level_files{") {
+			fmt.Println(line)
+		}
+	}
+	// Output:
+	// pebble_level_files{level="0"} 0
+	// pebble_level_files{level="1"} 0
+	// pebble_level_files{level="2"} 0
+	// pebble_level_files{level="3"} 0
+	// pebble_level_files{level="4"} 0
+	// pebble_level_files{level="5"} 0
+	// pebble_level_files{level="6"} 0
+}
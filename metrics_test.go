@@ -421,3 +421,34 @@ func TestMetricsWAmpDisableWAL(t *testing.T) {
 	require.Greater(t, tot.WriteAmp(), 1.0)
 	require.NoError(t, d.Close())
 }
+
+func TestMetricsSizeHistograms(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem(), DisableAutomaticCompactions: true})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("key%03d", i))
+		require.NoError(t, d.Set(key, bytes.Repeat([]byte{'v'}, i), nil))
+	}
+	require.NoError(t, d.Delete([]byte("key100"), nil))
+	require.NoError(t, d.Merge([]byte("key101"), []byte("merge"), nil))
+	require.NoError(t, d.Flush())
+	d.mu.Lock()
+	d.waitTableStats()
+	d.mu.Unlock()
+
+	m := d.Metrics()
+	l0 := m.Levels[0].Additional
+	// The key of the delete is recorded, but it doesn't carry a value.
+	require.Equal(t, sstable.SizeHistogram{3: 102}, l0.KeySizes)
+	require.Equal(t, uint64(101), l0.ValueSizes.Count())
+	require.Equal(t, sstable.SizeHistogram{1, 1, 2, 5, 8, 16, 32, 36}, l0.ValueSizes)
+	// The values don't fit in a single 4KB data block.
+	require.Equal(t, uint64(2), l0.DataBlockSizes.Count())
+	require.Equal(t, uint64(2), l0.CompressedDataBlockSizes.Count())
+
+	tot := m.Total()
+	require.Equal(t, l0.KeySizes, tot.Additional.KeySizes)
+	require.Equal(t, l0.ValueSizes, tot.Additional.ValueSizes)
+}
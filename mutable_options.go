@@ -0,0 +1,141 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/cockroachdb/errors"
+)
+
+// MutableOptions are the options of a DB that may be changed while it's open,
+// with DB.SetOptions. A zero field leaves the option unchanged. The changes
+// aren't persisted: a DB reopened with the Options it was opened with uses the
+// original options.
+type MutableOptions struct {
+	// MaxConcurrentCompactions sets the value returned by
+	// Options.MaxConcurrentCompactions. Compactions in excess of a lowered
+	// concurrency run to completion.
+	MaxConcurrentCompactions int
+
+	// TargetByteDeletionRate sets Options.TargetByteDeletionRate. A negative
+	// value disables the pacing of deletions.
+	TargetByteDeletionRate int
+
+	// CacheSize sets the size of Options.Cache, evicting blocks if the cache
+	// shrinks. A cache shared by several DBs is resized for all of them.
+	CacheSize int64
+
+	// L0CompactionThreshold, L0CompactionFileThreshold, L0StopWritesThreshold
+	// and MemTableStopWritesThreshold set the options of the same names. Writes
+	// stalled by a stop writes threshold are released if the threshold is
+	// raised above the current L0 read amplification or memtable count.
+	L0CompactionThreshold       int
+	L0CompactionFileThreshold   int
+	L0StopWritesThreshold       int
+	MemTableStopWritesThreshold int
+}
+
+// SetOptions changes the options of the DB that may be changed while it's
+// open, as described by MutableOptions. The new options are validated as a
+// whole: if any of them is invalid, SetOptions returns an error and none of
+// the options is changed. The options effectively changed are reported by
+// EventListener.OptionsChanged.
+func (d *DB) SetOptions(o MutableOptions) error {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	var buf bytes.Buffer
+	for _, f := range []struct {
+		name  string
+		value int64
+	}{
+		{"MaxConcurrentCompactions", int64(o.MaxConcurrentCompactions)},
+		{"CacheSize", o.CacheSize},
+		{"L0CompactionThreshold", int64(o.L0CompactionThreshold)},
+		{"L0CompactionFileThreshold", int64(o.L0CompactionFileThreshold)},
+		{"L0StopWritesThreshold", int64(o.L0StopWritesThreshold)},
+		{"MemTableStopWritesThreshold", int64(o.MemTableStopWritesThreshold)},
+	} {
+		if f.value < 0 {
+			fmt.Fprintf(&buf, "%s (%d) must be >= 0\n", f.name, f.value)
+		}
+	}
+	if buf.Len() > 0 {
+		return errors.New(buf.String())
+	}
+
+	d.mu.Lock()
+	opts := d.opts
+	var info OptionsChangedInfo
+	// set returns the new value of an option, recording its change.
+	set := func(name string, prev, new int64) int64 {
+		if new == 0 || new == prev {
+			return prev
+		}
+		info.Changes = append(info.Changes, OptionChange{Name: name, Prev: prev, New: new})
+		return new
+	}
+	maxConcurrentCompactions := set("MaxConcurrentCompactions",
+		int64(opts.MaxConcurrentCompactions()), int64(o.MaxConcurrentCompactions))
+	targetByteDeletionRate := int64(opts.TargetByteDeletionRate)
+	if o.TargetByteDeletionRate < 0 && targetByteDeletionRate != 0 {
+		info.Changes = append(info.Changes, OptionChange{
+			Name: "TargetByteDeletionRate", Prev: targetByteDeletionRate, New: 0,
+		})
+		targetByteDeletionRate = 0
+	} else if o.TargetByteDeletionRate > 0 {
+		targetByteDeletionRate = set("TargetByteDeletionRate",
+			targetByteDeletionRate, int64(o.TargetByteDeletionRate))
+	}
+	cacheSize := set("CacheSize", opts.Cache.MaxSize(), o.CacheSize)
+	l0CompactionThreshold := set("L0CompactionThreshold",
+		int64(opts.L0CompactionThreshold), int64(o.L0CompactionThreshold))
+	l0CompactionFileThreshold := set("L0CompactionFileThreshold",
+		int64(opts.L0CompactionFileThreshold), int64(o.L0CompactionFileThreshold))
+	l0StopWritesThreshold := set("L0StopWritesThreshold",
+		int64(opts.L0StopWritesThreshold), int64(o.L0StopWritesThreshold))
+	memTableStopWritesThreshold := set("MemTableStopWritesThreshold",
+		int64(opts.MemTableStopWritesThreshold), int64(o.MemTableStopWritesThreshold))
+
+	// The new options are validated as by Options.Validate.
+	if l0StopWritesThreshold < l0CompactionThreshold {
+		fmt.Fprintf(&buf, "L0StopWritesThreshold (%d) must be >= L0CompactionThreshold (%d)\n",
+			l0StopWritesThreshold, l0CompactionThreshold)
+	}
+	if memTableStopWritesThreshold < 2 {
+		fmt.Fprintf(&buf, "MemTableStopWritesThreshold (%d) must be >= 2\n", memTableStopWritesThreshold)
+	}
+	if buf.Len() > 0 {
+		d.mu.Unlock()
+		return errors.New(buf.String())
+	}
+
+	// The options read by the compaction picker and by write stalls are only
+	// read with d.mu held.
+	if n := int(maxConcurrentCompactions); n != opts.MaxConcurrentCompactions() {
+		opts.MaxConcurrentCompactions = func() int { return n }
+	}
+	opts.TargetByteDeletionRate = int(targetByteDeletionRate)
+	opts.L0CompactionThreshold = int(l0CompactionThreshold)
+	opts.L0CompactionFileThreshold = int(l0CompactionFileThreshold)
+	opts.L0StopWritesThreshold = int(l0StopWritesThreshold)
+	opts.MemTableStopWritesThreshold = int(memTableStopWritesThreshold)
+	d.cleanupManager.deletePacer.SetTargetByteDeletionRate(targetByteDeletionRate)
+	if cacheSize != opts.Cache.MaxSize() {
+		opts.Cache.SetMaxSize(cacheSize)
+	}
+	// Release the writes stalled by the previous thresholds, and schedule the
+	// compactions allowed by the new ones.
+	d.mu.compact.cond.Broadcast()
+	d.maybeScheduleCompaction()
+	d.mu.Unlock()
+
+	if len(info.Changes) > 0 {
+		opts.EventListener.OptionsChanged(info)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetOptions(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	var stallOnce sync.Once
+	stalled := make(chan struct{})
+	opts := &Options{
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+		L0CompactionThreshold:       1,
+		L0StopWritesThreshold:       2,
+		EventListener: &EventListener{
+			OptionsChanged: func(info OptionsChangedInfo) {
+				mu.Lock()
+				defer mu.Unlock()
+				events = append(events, info.String())
+			},
+			WriteStallBegin: func(info WriteStallBeginInfo) {
+				stallOnce.Do(func() { close(stalled) })
+			},
+		},
+	}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer d.Close()
+	lastEvent := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(events) == 0 {
+			return ""
+		}
+		return events[len(events)-1]
+	}
+
+	require.NoError(t, d.SetOptions(MutableOptions{
+		MaxConcurrentCompactions: 3,
+		TargetByteDeletionRate:   1 << 20,
+		CacheSize:                16 << 20,
+		L0CompactionThreshold:    2,
+	}))
+	require.Equal(t, "options changed: MaxConcurrentCompactions 1 -> 3, TargetByteDeletionRate 0 -> 1048576,"+
+		" CacheSize 8388608 -> 16777216, L0CompactionThreshold 1 -> 2", lastEvent())
+	require.Equal(t, 3, d.opts.MaxConcurrentCompactions())
+	require.Equal(t, int64(1<<20), d.cleanupManager.deletePacer.targetByteDeletionRate.Load())
+	require.Equal(t, int64(16<<20), d.opts.Cache.MaxSize())
+	require.Equal(t, 2, d.opts.L0CompactionThreshold)
+
+	// Unchanged options aren't reported.
+	require.NoError(t, d.SetOptions(MutableOptions{MaxConcurrentCompactions: 3, TargetByteDeletionRate: -1}))
+	require.Equal(t, "options changed: TargetByteDeletionRate 1048576 -> 0", lastEvent())
+	require.Zero(t, d.cleanupManager.deletePacer.targetByteDeletionRate.Load())
+
+	// Invalid options are rejected as a whole.
+	err = d.SetOptions(MutableOptions{L0CompactionThreshold: 4, CacheSize: 1 << 20})
+	require.EqualError(t, err, "L0StopWritesThreshold (2) must be >= L0CompactionThreshold (4)\n")
+	require.Equal(t, 2, d.opts.L0CompactionThreshold)
+	require.Equal(t, int64(16<<20), d.opts.Cache.MaxSize())
+	err = d.SetOptions(MutableOptions{MemTableStopWritesThreshold: -1})
+	require.EqualError(t, err, "MemTableStopWritesThreshold (-1) must be >= 0\n")
+
+	// Raising the L0 stop writes threshold releases the stalled writes.
+	for i := 0; i < 2; i++ {
+		require.NoError(t, d.Set([]byte("a"), []byte(fmt.Sprint(i)), nil))
+		require.NoError(t, d.Flush())
+	}
+	flushed := make(chan error)
+	go func() {
+		_ = d.Set([]byte("a"), nil, nil)
+		flushed <- d.Flush()
+	}()
+	<-stalled
+	select {
+	case <-flushed:
+		t.Fatal("flush not stalled")
+	case <-time.After(10 * time.Millisecond):
+	}
+	require.NoError(t, d.SetOptions(MutableOptions{L0StopWritesThreshold: 10}))
+	require.NoError(t, <-flushed)
+	require.Equal(t, "options changed: L0StopWritesThreshold 2 -> 10", lastEvent())
+}
@@ -268,6 +268,12 @@ type Provider interface {
 	// List returns the objects currently known to the provider. Does not perform any I/O.
 	List() []ObjectMetadata
 
+	// AddLocalObjects makes the local objects in the given listing of the local
+	// directory known to the provider, if they aren't already known. It is used
+	// by read-only DBs to pick up the objects created by another process
+	// writing to the directory. Does not perform any I/O.
+	AddLocalObjects(listing []string)
+
 	// SetCreatorID sets the CreatorID which is needed in order to use shared
 	// objects. Remote object usage is disabled until this method is called the
 	// first time. Once set, the Creator ID is persisted and cannot change.
@@ -290,6 +296,13 @@ type Provider interface {
 	// objects that are backed by the given external object.
 	GetExternalObjects(locator remote.Locator, objName string) []base.DiskFileNum
 
+	// ReadExternalObject opens an object in remote storage that is not managed
+	// by the provider, for example an sstable that is downloaded so that it can
+	// be ingested. The object is not registered with the provider.
+	ReadExternalObject(
+		ctx context.Context, locator remote.Locator, objName string,
+	) (_ remote.ObjectReader, objSize int64, _ error)
+
 	// AttachRemoteObjects registers existing remote objects with this provider.
 	//
 	// The objects are not guaranteed to be durable (accessible in case of
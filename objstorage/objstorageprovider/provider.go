@@ -441,6 +441,13 @@ func (p *provider) List() []objstorage.ObjectMetadata {
 	return res
 }
 
+// AddLocalObjects is part of the objstorage.Provider interface.
+func (p *provider) AddLocalObjects(listing []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.vfsAddListingLocked(listing)
+}
+
 // Metrics is part of the objstorage.Provider interface.
 func (p *provider) Metrics() sharedcache.Metrics {
 	if p.remote.cache != nil {
@@ -349,7 +349,7 @@ func (p *provider) remoteOpenForReading(
 		}
 		return nil, err
 	}
-	return p.newRemoteReadable(reader, size, meta.DiskFileNum), nil
+	return p.newRemoteReadable(reader, size, meta.DiskFileNum, objName), nil
 }
 
 func (p *provider) remoteSize(meta objstorage.ObjectMetadata) (int64, error) {
@@ -417,6 +417,20 @@ func (p *provider) ensureStorage(locator remote.Locator) (remote.Storage, error)
 	return p.ensureStorageLocked(locator)
 }
 
+// ReadExternalObject is part of the Provider interface.
+func (p *provider) ReadExternalObject(
+	ctx context.Context, locator remote.Locator, objName string,
+) (_ remote.ObjectReader, objSize int64, _ error) {
+	if p.st.Remote.StorageFactory == nil {
+		return nil, 0, errors.New("remote object support not configured")
+	}
+	storage, err := p.ensureStorage(locator)
+	if err != nil {
+		return nil, 0, err
+	}
+	return storage.ReadObject(ctx, objName)
+}
+
 // GetExternalObjects is part of the Provider interface.
 func (p *provider) GetExternalObjects(locator remote.Locator, objName string) []base.DiskFileNum {
 	p.mu.Lock()
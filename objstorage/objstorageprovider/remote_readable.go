@@ -30,18 +30,20 @@ type remoteReadable struct {
 	objReader remote.ObjectReader
 	size      int64
 	fileNum   base.DiskFileNum
+	objName   string
 	cache     *sharedcache.Cache
 }
 
 var _ objstorage.Readable = (*remoteReadable)(nil)
 
 func (p *provider) newRemoteReadable(
-	objReader remote.ObjectReader, size int64, fileNum base.DiskFileNum,
+	objReader remote.ObjectReader, size int64, fileNum base.DiskFileNum, objName string,
 ) *remoteReadable {
 	return &remoteReadable{
 		objReader: objReader,
 		size:      size,
 		fileNum:   fileNum,
+		objName:   objName,
 		cache:     p.remote.cache,
 	}
 }
@@ -61,7 +63,7 @@ func (r *remoteReadable) readInternal(
 			// Don't add data to the cache if this read is for a compaction.
 			ReadOnly: forCompaction,
 		}
-		return r.cache.ReadAt(ctx, r.fileNum, p, offset, r.objReader, r.size, flags)
+		return r.cache.ReadAt(ctx, r.fileNum, r.objName, p, offset, r.objReader, r.size, flags)
 	}
 	return r.objReader.ReadAt(ctx, p, offset)
 }
@@ -0,0 +1,271 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sharedcache
+
+import (
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/errors/oserror"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/crc"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// The metadata of a shard, i.e. the logical block held by each of its cache
+// blocks, is persisted when the cache is closed, so that the cache contents
+// survive restarts. The metadata file of a shard is removed when the shard is
+// opened, before any of its cache blocks can be overwritten: if the process
+// crashes, the cache restarts empty rather than with stale metadata.
+//
+// The metadata file holds a sequence of uvarints and strings, each string
+// prefixed by its length as a uvarint, followed by the checksum of the
+// sequence, as a little-endian uint32:
+//
+//	version blockSize shardingBlockSize numShards sizeInBlocks
+//	numObjects (fileNum objSize objName)*numObjects
+//	numEntries (cacheBlockIdx fileNum logicalBlockIdx)*numEntries
+//
+// The objects identify the object held by the cache blocks of each file
+// number, so that the cache blocks aren't recovered for a different object
+// reusing the file number. The entries are ordered from the least to the most
+// recently used.
+const metadataVersion = 2
+
+func dataFilename(shardIdx int) string {
+	return fmt.Sprintf("SHARED-CACHE-%03d", shardIdx)
+}
+
+func metadataFilename(shardIdx int) string {
+	return fmt.Sprintf("SHARED-CACHE-META-%03d", shardIdx)
+}
+
+// shardMetadata is the decoded metadata of a shard.
+type shardMetadata struct {
+	blockSize         int
+	shardingBlockSize int64
+	numShards         int
+	sizeInBlocks      int64
+	objects           []metadataObject
+	// entries are ordered from the least to the most recently used.
+	entries []metadataEntry
+}
+
+type metadataObject struct {
+	fileNum base.DiskFileNum
+	id      objectID
+}
+
+type metadataEntry struct {
+	index   cacheBlockIndex
+	logical logicalBlockID
+}
+
+func (m *shardMetadata) encode() []byte {
+	var buf []byte
+	for _, v := range []uint64{
+		metadataVersion, uint64(m.blockSize), uint64(m.shardingBlockSize),
+		uint64(m.numShards), uint64(m.sizeInBlocks), uint64(len(m.objects)),
+	} {
+		buf = binary.AppendUvarint(buf, v)
+	}
+	for _, o := range m.objects {
+		buf = binary.AppendUvarint(buf, uint64(o.fileNum))
+		buf = binary.AppendUvarint(buf, uint64(o.id.size))
+		buf = binary.AppendUvarint(buf, uint64(len(o.id.name)))
+		buf = append(buf, o.id.name...)
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(m.entries)))
+	for _, e := range m.entries {
+		buf = binary.AppendUvarint(buf, uint64(e.index))
+		buf = binary.AppendUvarint(buf, uint64(e.logical.filenum))
+		buf = binary.AppendUvarint(buf, uint64(e.logical.cacheBlockIdx))
+	}
+	return binary.LittleEndian.AppendUint32(buf, crc.New(buf).Value())
+}
+
+var errCorruptMetadata = base.CorruptionErrorf("pebble: corrupt shared cache metadata")
+
+func decodeMetadata(data []byte) (*shardMetadata, error) {
+	if len(data) < 4 {
+		return nil, errCorruptMetadata
+	}
+	buf, checksum := data[:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc.New(buf).Value() != checksum {
+		return nil, errCorruptMetadata
+	}
+	next := func() uint64 {
+		v, n := binary.Uvarint(buf)
+		if n <= 0 {
+			buf = nil
+			return 0
+		}
+		buf = buf[n:]
+		return v
+	}
+	nextString := func() string {
+		n := next()
+		if n > uint64(len(buf)) {
+			buf = nil
+			return ""
+		}
+		str := string(buf[:n])
+		buf = buf[n:]
+		return str
+	}
+	if v := next(); v != metadataVersion {
+		return nil, errors.Errorf("pebble: unknown shared cache metadata version %d", v)
+	}
+	m := &shardMetadata{
+		blockSize:         int(next()),
+		shardingBlockSize: int64(next()),
+		numShards:         int(next()),
+		sizeInBlocks:      int64(next()),
+	}
+	numObjects := next()
+	if numObjects > uint64(m.sizeInBlocks) {
+		return nil, errCorruptMetadata
+	}
+	m.objects = make([]metadataObject, numObjects)
+	for i := range m.objects {
+		m.objects[i].fileNum = base.DiskFileNum(next())
+		m.objects[i].id.size = int64(next())
+		m.objects[i].id.name = nextString()
+	}
+	numEntries := next()
+	if numEntries > uint64(m.sizeInBlocks) {
+		return nil, errCorruptMetadata
+	}
+	m.entries = make([]metadataEntry, numEntries)
+	for i := range m.entries {
+		m.entries[i] = metadataEntry{
+			index: cacheBlockIndex(next()),
+			logical: logicalBlockID{
+				filenum:       base.DiskFileNum(next()),
+				cacheBlockIdx: cacheBlockIndex(next()),
+			},
+		}
+	}
+	if buf == nil || len(buf) != 0 {
+		return nil, errCorruptMetadata
+	}
+	return m, nil
+}
+
+func readMetadata(fs vfs.FS, path string) (*shardMetadata, error) {
+	f, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	m, err := decodeMetadata(data)
+	return m, errors.Wrapf(err, "reading %s", path)
+}
+
+// writeMetadata atomically writes the metadata file at path.
+func writeMetadata(fs vfs.FS, fsDir, path string, m *shardMetadata) error {
+	tmpPath := path + ".tmp"
+	f, err := fs.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(m.encode()); err != nil {
+		return errors.CombineErrors(err, f.Close())
+	}
+	if err := f.Sync(); err != nil {
+		return errors.CombineErrors(err, f.Close())
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := fs.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	return syncDir(fs, fsDir)
+}
+
+// removeMetadata removes the metadata file at path, if it exists.
+func removeMetadata(fs vfs.FS, fsDir, path string) error {
+	if err := fs.Remove(path); err != nil {
+		if oserror.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return syncDir(fs, fsDir)
+}
+
+func syncDir(fs vfs.FS, fsDir string) error {
+	dir, err := fs.OpenDir(fsDir)
+	if err != nil {
+		return err
+	}
+	return errors.CombineErrors(dir.Sync(), dir.Close())
+}
+
+// Contents describes the contents of a cache, as persisted when the cache was
+// last closed. See ReadContents.
+type Contents struct {
+	BlockSize int
+	NumShards int
+	// SizeInBlocks is the number of cache blocks of the cache, and UsedBlocks
+	// the number of cache blocks holding data.
+	SizeInBlocks int64
+	UsedBlocks   int64
+	// Objects describes the cached data of each object, ordered by FileNum.
+	Objects []ObjectContents
+}
+
+// ObjectContents describes the cached data of an object.
+type ObjectContents struct {
+	FileNum base.DiskFileNum
+	// Blocks is the number of cache blocks holding data of the object.
+	Blocks int64
+}
+
+// ReadContents reads the contents of the cache in fsDir from the metadata
+// persisted when the cache was last closed. The cache must not be open: the
+// metadata is removed when the cache is opened, and ReadContents returns an
+// error if it doesn't exist.
+func ReadContents(fs vfs.FS, fsDir string) (Contents, error) {
+	var c Contents
+	blocks := make(map[base.DiskFileNum]int64)
+	for i := 0; i == 0 || i < c.NumShards; i++ {
+		m, err := readMetadata(fs, fs.PathJoin(fsDir, metadataFilename(i)))
+		if err != nil {
+			if oserror.IsNotExist(err) {
+				return Contents{}, errors.Errorf(
+					"pebble: no shared cache metadata in %q: the cache is in use or wasn't closed cleanly", fsDir)
+			}
+			return Contents{}, err
+		}
+		if i == 0 {
+			c.BlockSize = m.blockSize
+			c.NumShards = m.numShards
+		} else if m.blockSize != c.BlockSize || m.numShards != c.NumShards {
+			return Contents{}, errors.Errorf("pebble: inconsistent shared cache metadata in %q", fsDir)
+		}
+		c.SizeInBlocks += m.sizeInBlocks
+		c.UsedBlocks += int64(len(m.entries))
+		for _, e := range m.entries {
+			blocks[e.logical.filenum]++
+		}
+	}
+	for fileNum, n := range blocks {
+		c.Objects = append(c.Objects, ObjectContents{FileNum: fileNum, Blocks: n})
+	}
+	slices.SortFunc(c.Objects, func(a, b ObjectContents) int {
+		return cmp.Compare(a.FileNum, b.FileNum)
+	})
+	return c, nil
+}
@@ -5,15 +5,18 @@
 package sharedcache
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"io"
 	"math/bits"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/errors/oserror"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/invariants"
 	"github.com/cockroachdb/pebble/objstorage/remote"
@@ -52,6 +55,9 @@ type Metrics struct {
 	Size int64
 	// The count of cache blocks in the cache (not sstable blocks).
 	Count int64
+	// The count of cache blocks recovered when the cache was opened, from the
+	// metadata persisted when it was last closed.
+	Recovered int64
 
 	// The number of calls to ReadAt.
 	TotalReads int64
@@ -86,7 +92,8 @@ type Metrics struct {
 
 // See docs at Metrics.
 type internalMetrics struct {
-	count atomic.Int64
+	count     atomic.Int64
+	recovered atomic.Int64
 
 	totalReads          atomic.Int64
 	multiShardReads     atomic.Int64
@@ -115,7 +122,8 @@ const (
 )
 
 // Open opens a cache. If there is no existing cache at fsDir, a new one
-// is created.
+// is created. If the cache was closed cleanly with the same configuration, its
+// contents are recovered; otherwise the cache starts empty.
 func Open(
 	fs vfs.FS,
 	logger base.Logger,
@@ -162,8 +170,9 @@ func Open(
 	return c, nil
 }
 
-// Close closes the cache. Methods such as ReadAt should not be called after Close is
-// called.
+// Close closes the cache, persisting its metadata so that its contents can be
+// recovered when it's reopened. Methods such as ReadAt should not be called
+// after Close is called.
 func (c *Cache) Close() error {
 	c.writeWorkers.Stop()
 
@@ -182,6 +191,7 @@ func (c *Cache) Close() error {
 func (c *Cache) Metrics() Metrics {
 	return Metrics{
 		Count:               c.metrics.count.Load(),
+		Recovered:           c.metrics.recovered.Load(),
 		Size:                c.metrics.count.Load() * int64(c.bm.BlockSize()),
 		TotalReads:          c.metrics.totalReads.Load(),
 		MultiShardReads:     c.metrics.multiShardReads.Load(),
@@ -207,10 +217,14 @@ type ReadFlags struct {
 }
 
 // ReadAt performs a read form an object, attempting to use cached data when
-// possible.
+// possible. The object is cached under its file number, and identified by its
+// name in remote storage and its size: the cached data of a different object
+// with the same file number, e.g. recovered from a previous run of the cache,
+// is discarded.
 func (c *Cache) ReadAt(
 	ctx context.Context,
 	fileNum base.DiskFileNum,
+	objName string,
 	p []byte,
 	ofs int64,
 	objReader remote.ObjectReader,
@@ -218,6 +232,7 @@ func (c *Cache) ReadAt(
 	flags ReadFlags,
 ) error {
 	c.metrics.totalReads.Add(1)
+	obj := objectID{name: objName, size: objSize}
 	if ofs >= objSize {
 		if invariants.Enabled {
 			panic(fmt.Sprintf("invalid ReadAt offset %v %v", ofs, objSize))
@@ -228,7 +243,7 @@ func (c *Cache) ReadAt(
 	// all.
 	{
 		start := time.Now()
-		n, err := c.get(fileNum, p, ofs)
+		n, err := c.get(fileNum, obj, p, ofs)
 		c.metrics.getLatency.Observe(float64(time.Since(start)))
 		if err != nil {
 			return err
@@ -283,7 +298,7 @@ func (c *Cache) ReadAt(
 	copy(p, adjustedP[sizeOfOffAdjustment:])
 
 	start := time.Now()
-	c.writeWorkers.QueueWrite(fileNum, adjustedP, adjustedOfs)
+	c.writeWorkers.QueueWrite(fileNum, obj, adjustedP, adjustedOfs)
 	c.metrics.queuePutLatency.Observe(float64(time.Since(start)))
 
 	return nil
@@ -296,7 +311,7 @@ func (c *Cache) ReadAt(
 //
 // If data is partially available, a prefix of the data is read; returns n < len(p)
 // and no error. If no prefix is available, returns n = 0 and no error.
-func (c *Cache) get(fileNum base.DiskFileNum, p []byte, ofs int64) (n int, _ error) {
+func (c *Cache) get(fileNum base.DiskFileNum, obj objectID, p []byte, ofs int64) (n int, _ error) {
 	// The data extent might cross shard boundaries, hence the loop. In the hot
 	// path, max two iterations of this loop will be executed, since reads are sized
 	// in units of sstable block size.
@@ -307,7 +322,7 @@ func (c *Cache) get(fileNum base.DiskFileNum, p []byte, ofs int64) (n int, _ err
 		if toBoundary := int(c.shardingBlockSize - ((ofs + int64(n)) % c.shardingBlockSize)); cappedLen > toBoundary {
 			cappedLen = toBoundary
 		}
-		numRead, err := shard.get(fileNum, p[n:n+cappedLen], ofs+int64(n))
+		numRead, err := shard.get(fileNum, obj, p[n:n+cappedLen], ofs+int64(n))
 		if err != nil {
 			return n, err
 		}
@@ -332,7 +347,7 @@ func (c *Cache) get(fileNum base.DiskFileNum, p []byte, ofs int64) (n int, _ err
 // be multiples of the block size.
 //
 // If all of p is not written to the shard, set returns a non-nil error.
-func (c *Cache) set(fileNum base.DiskFileNum, p []byte, ofs int64) error {
+func (c *Cache) set(fileNum base.DiskFileNum, obj objectID, p []byte, ofs int64) error {
 	if invariants.Enabled {
 		if c.bm.Remainder(ofs) != 0 || c.bm.Remainder(int64(len(p))) != 0 {
 			panic(fmt.Sprintf("set with ofs & len not multiples of block size: %v %v", ofs, len(p)))
@@ -349,7 +364,7 @@ func (c *Cache) set(fileNum base.DiskFileNum, p []byte, ofs int64) error {
 		if toBoundary := int(c.shardingBlockSize - ((ofs + int64(n)) % c.shardingBlockSize)); cappedLen > toBoundary {
 			cappedLen = toBoundary
 		}
-		err := shard.set(fileNum, p[n:n+cappedLen], ofs+int64(n))
+		err := shard.set(fileNum, obj, p[n:n+cappedLen], ofs+int64(n))
 		if err != nil {
 			return err
 		}
@@ -374,7 +389,12 @@ func (c *Cache) getShard(fileNum base.DiskFileNum, ofs int64) *shard {
 }
 
 type shard struct {
-	cache             *Cache
+	cache *Cache
+	fs    vfs.FS
+	fsDir string
+	// metaPath is the path of the file the shard's metadata is persisted to
+	// when the shard is closed.
+	metaPath          string
 	file              vfs.File
 	sizeInBlocks      int64
 	bm                blockMath
@@ -385,6 +405,9 @@ type shard struct {
 		// Focusing on correctness to start.
 		where  whereMap
 		blocks []cacheBlockState
+		// objects identifies the object whose data is held by the cache
+		// blocks of each file number in the where map.
+		objects map[base.DiskFileNum]*cachedObject
 		// Head of LRU list (doubly-linked circular).
 		lruHead cacheBlockIndex
 		// Head of free list (singly-linked chain).
@@ -414,6 +437,20 @@ type logicalBlockID struct {
 	cacheBlockIdx cacheBlockIndex
 }
 
+// objectID identifies an object cached under a file number.
+type objectID struct {
+	name string
+	size int64
+}
+
+// cachedObject describes the object whose data is held by the cache blocks of
+// a shard for a file number.
+type cachedObject struct {
+	id objectID
+	// blocks is the number of cache blocks holding data of the object.
+	blocks int64
+}
+
 type lockState int64
 
 const (
@@ -439,6 +476,9 @@ func (s *shard) init(
 ) error {
 	*s = shard{
 		cache:        cache,
+		fs:           fs,
+		fsDir:        fsDir,
+		metaPath:     fs.PathJoin(fsDir, metadataFilename(shardIdx)),
 		sizeInBlocks: sizeInBlocks,
 	}
 	if blockSize < 1024 || shardingBlockSize%int64(blockSize) != 0 {
@@ -446,7 +486,7 @@ func (s *shard) init(
 	}
 	s.bm = makeBlockMath(blockSize)
 	s.shardingBlockSize = shardingBlockSize
-	file, err := fs.OpenReadWrite(fs.PathJoin(fsDir, fmt.Sprintf("SHARED-CACHE-%03d", shardIdx)))
+	file, err := fs.OpenReadWrite(fs.PathJoin(fsDir, dataFilename(shardIdx)))
 	if err != nil {
 		return err
 	}
@@ -457,24 +497,110 @@ func (s *shard) init(
 	}
 	s.file = file
 
-	// TODO(josh): Right now, the secondary cache is not persistent. All existing
-	// cache contents will be over-written, since all metadata is only stored in
-	// memory.
 	s.mu.where = make(whereMap)
+	s.mu.objects = make(map[base.DiskFileNum]*cachedObject)
 	s.mu.blocks = make([]cacheBlockState, sizeInBlocks)
 	s.mu.lruHead = invalidBlockIndex
 	s.mu.freeHead = invalidBlockIndex
+	used := s.recover()
 	for i := range s.mu.blocks {
-		s.freePush(cacheBlockIndex(i))
+		if !used[i] {
+			s.freePush(cacheBlockIndex(i))
+		}
 	}
+	// The metadata must be removed before any cache block is overwritten, as it
+	// would no longer describe the shard's contents.
+	return removeMetadata(fs, fsDir, s.metaPath)
+}
 
-	return nil
+// recover populates the LRU list with the cache blocks described by the
+// shard's persisted metadata, if it exists and matches the configuration of
+// the shard, returning the cache blocks in use.
+func (s *shard) recover() (used []bool) {
+	used = make([]bool, s.sizeInBlocks)
+	m, err := readMetadata(s.fs, s.metaPath)
+	if err != nil {
+		if !oserror.IsNotExist(err) {
+			s.cache.logger.Infof("discarding shared cache contents: %v", err)
+		}
+		return used
+	}
+	if m.blockSize != s.bm.BlockSize() || m.shardingBlockSize != s.shardingBlockSize ||
+		m.numShards != len(s.cache.shards) || m.sizeInBlocks != s.sizeInBlocks {
+		s.cache.logger.Infof("discarding shared cache contents: configuration changed")
+		return used
+	}
+	where := make(whereMap, len(m.entries))
+	objects := make(map[base.DiskFileNum]*cachedObject, len(m.objects))
+	for _, o := range m.objects {
+		objects[o.fileNum] = &cachedObject{id: o.id}
+	}
+	for _, e := range m.entries {
+		_, dup := where[e.logical]
+		o := objects[e.logical.filenum]
+		if e.index < 0 || int64(e.index) >= s.sizeInBlocks || used[e.index] || dup || o == nil {
+			s.cache.logger.Infof("discarding shared cache contents: %v", errCorruptMetadata)
+			return make([]bool, s.sizeInBlocks)
+		}
+		used[e.index] = true
+		where[e.logical] = e.index
+		o.blocks++
+	}
+	for fileNum, o := range objects {
+		if o.blocks == 0 {
+			delete(objects, fileNum)
+		}
+	}
+	s.mu.where = where
+	s.mu.objects = objects
+	for _, e := range m.entries {
+		s.mu.blocks[e.index].logical = e.logical
+		s.lruInsertFront(e.index)
+	}
+	n := int64(len(s.mu.where))
+	s.cache.metrics.count.Add(n)
+	s.cache.metrics.recovered.Add(n)
+	return used
 }
 
+// close persists the shard's metadata and closes its file.
 func (s *shard) close() error {
 	defer func() {
 		s.file = nil
 	}()
+	// The cache blocks must be durable before the metadata referencing them.
+	if err := s.file.Sync(); err != nil {
+		return errors.CombineErrors(err, s.file.Close())
+	}
+	m := &shardMetadata{
+		blockSize:         s.bm.BlockSize(),
+		shardingBlockSize: s.shardingBlockSize,
+		numShards:         len(s.cache.shards),
+		sizeInBlocks:      s.sizeInBlocks,
+	}
+	s.mu.Lock()
+	for fileNum, o := range s.mu.objects {
+		m.objects = append(m.objects, metadataObject{fileNum: fileNum, id: o.id})
+	}
+	slices.SortFunc(m.objects, func(a, b metadataObject) int {
+		return cmp.Compare(a.fileNum, b.fileNum)
+	})
+	if s.mu.lruHead != invalidBlockIndex {
+		// Walk the LRU list from its tail, skipping blocks that are being
+		// written.
+		for b := s.lruPrev(s.mu.lruHead); ; b = s.lruPrev(b) {
+			if s.mu.blocks[b].lock != writeLockTaken {
+				m.entries = append(m.entries, metadataEntry{index: b, logical: s.mu.blocks[b].logical})
+			}
+			if b == s.mu.lruHead {
+				break
+			}
+		}
+	}
+	s.mu.Unlock()
+	if err := writeMetadata(s.fs, s.fsDir, s.metaPath, m); err != nil {
+		return errors.CombineErrors(err, s.file.Close())
+	}
 	return s.file.Close()
 }
 
@@ -545,7 +671,7 @@ func (s *shard) lruUnlink(index cacheBlockIndex) {
 // a reverse scan, since those iterate over sstable blocks in reverse order and due to
 // cache block aligned reads will have read the suffix of the sstable block that will
 // be needed next.
-func (s *shard) get(fileNum base.DiskFileNum, p []byte, ofs int64) (n int, _ error) {
+func (s *shard) get(fileNum base.DiskFileNum, obj objectID, p []byte, ofs int64) (n int, _ error) {
 	if invariants.Enabled {
 		if ofs/s.shardingBlockSize != (ofs+int64(len(p))-1)/s.shardingBlockSize {
 			panic(fmt.Sprintf("get crosses shard boundary: %v %v", ofs, len(p)))
@@ -563,6 +689,10 @@ func (s *shard) get(fileNum base.DiskFileNum, p []byte, ofs int64) (n int, _ err
 			cacheBlockIdx: s.bm.Block(ofs + int64(n)),
 		}
 		s.mu.Lock()
+		if !s.checkObjectLocked(fileNum, obj) {
+			s.mu.Unlock()
+			return n, nil
+		}
 		cacheBlockIdx, ok := s.mu.where[k]
 		// TODO(josh): Multiple reads within the same few milliseconds (anything that is smaller
 		// than blob storage read latency) that miss on the same logical block ID will not necessarily
@@ -624,7 +754,7 @@ func (s *shard) get(fileNum base.DiskFileNum, p []byte, ofs int64) (n int, _ err
 // block size.
 //
 // If all of p is not written to the shard, set returns a non-nil error.
-func (s *shard) set(fileNum base.DiskFileNum, p []byte, ofs int64) error {
+func (s *shard) set(fileNum base.DiskFileNum, obj objectID, p []byte, ofs int64) error {
 	if invariants.Enabled {
 		if ofs/s.shardingBlockSize != (ofs+int64(len(p))-1)/s.shardingBlockSize {
 			panic(fmt.Sprintf("set crosses shard boundary: %v %v", ofs, len(p)))
@@ -655,6 +785,10 @@ func (s *shard) set(fileNum base.DiskFileNum, p []byte, ofs int64) error {
 			cacheBlockIdx: s.bm.Block(ofs + int64(n)),
 		}
 		s.mu.Lock()
+		if !s.checkObjectLocked(fileNum, obj) {
+			s.mu.Unlock()
+			return errors.Newf("cached data of a different object with file number %s is in use, so skipping write to cache", fileNum)
+		}
 		if _, ok := s.mu.where[k]; ok {
 			s.mu.Unlock()
 			n += s.bm.BlockSize()
@@ -685,14 +819,14 @@ func (s *shard) set(fileNum base.DiskFileNum, p []byte, ofs int64) error {
 			}
 			s.cache.metrics.evictions.Add(1)
 			s.lruUnlink(cacheBlockIdx)
-			delete(s.mu.where, s.mu.blocks[cacheBlockIdx].logical)
+			s.whereDeleteLocked(s.mu.blocks[cacheBlockIdx].logical)
 		} else {
 			s.cache.metrics.count.Add(1)
 			cacheBlockIdx = s.freePop()
 		}
 
 		s.lruInsertFront(cacheBlockIdx)
-		s.mu.where[k] = cacheBlockIdx
+		s.whereInsertLocked(k, obj, cacheBlockIdx)
 		s.mu.blocks[cacheBlockIdx].logical = k
 		s.mu.blocks[cacheBlockIdx].lock = writeLockTaken
 		s.mu.Unlock()
@@ -712,7 +846,7 @@ func (s *shard) set(fileNum base.DiskFileNum, p []byte, ofs int64) error {
 			s.mu.Lock()
 			defer s.mu.Unlock()
 
-			delete(s.mu.where, k)
+			s.whereDeleteLocked(k)
 			s.lruUnlink(cacheBlockIdx)
 			s.freePush(cacheBlockIdx)
 			return err
@@ -722,6 +856,56 @@ func (s *shard) set(fileNum base.DiskFileNum, p []byte, ofs int64) error {
 	}
 }
 
+// checkObjectLocked returns true if the cache blocks of the shard for the file
+// number hold data of the given object, or of no object. The cache blocks
+// holding data of a different object are freed, unless some of them are
+// locked, in which case checkObjectLocked returns false.
+func (s *shard) checkObjectLocked(fileNum base.DiskFileNum, obj objectID) bool {
+	o, ok := s.mu.objects[fileNum]
+	if !ok || o.id == obj {
+		return true
+	}
+	var blocks []cacheBlockIndex
+	for k, idx := range s.mu.where {
+		if k.filenum != fileNum {
+			continue
+		}
+		if s.mu.blocks[idx].lock != unlocked {
+			return false
+		}
+		blocks = append(blocks, idx)
+	}
+	for _, idx := range blocks {
+		s.whereDeleteLocked(s.mu.blocks[idx].logical)
+		s.lruUnlink(idx)
+		s.freePush(idx)
+	}
+	s.cache.metrics.count.Add(-int64(len(blocks)))
+	return true
+}
+
+// whereInsertLocked records that the cache block holds the logical block of
+// the given object.
+func (s *shard) whereInsertLocked(k logicalBlockID, obj objectID, index cacheBlockIndex) {
+	s.mu.where[k] = index
+	o, ok := s.mu.objects[k.filenum]
+	if !ok {
+		o = &cachedObject{id: obj}
+		s.mu.objects[k.filenum] = o
+	}
+	o.blocks++
+}
+
+// whereDeleteLocked removes the logical block from the where map.
+func (s *shard) whereDeleteLocked(k logicalBlockID) {
+	delete(s.mu.where, k)
+	o := s.mu.objects[k.filenum]
+	o.blocks--
+	if o.blocks == 0 {
+		delete(s.mu.objects, k.filenum)
+	}
+}
+
 // Doesn't inline currently. This might be okay, but something to keep in mind.
 func (s *shard) dropReadLock(cacheBlockInd cacheBlockIndex) {
 	s.mu.Lock()
@@ -762,6 +946,13 @@ func (s *shard) assertShardStateIsConsistent() {
 	if lruLen != len(s.mu.where) {
 		panic(fmt.Sprintf("lru list len is %d but where map has %d entries", lruLen, len(s.mu.where)))
 	}
+	var objectBlocks int64
+	for _, o := range s.mu.objects {
+		objectBlocks += o.blocks
+	}
+	if objectBlocks != int64(len(s.mu.where)) {
+		panic(fmt.Sprintf("objects have %d blocks but where map has %d entries", objectBlocks, len(s.mu.where)))
+	}
 	freeLen := 0
 	for n := s.mu.freeHead; n != invalidBlockIndex; n = s.mu.blocks[n].next {
 		freeLen++
@@ -838,6 +1029,7 @@ type writeWorkers struct {
 
 type writeTask struct {
 	fileNum base.DiskFileNum
+	obj     objectID
 	p       []byte
 	offset  int64
 }
@@ -867,7 +1059,7 @@ func (w *writeWorkers) Start(c *Cache, numWorkers int) {
 					// TODO(radu): set() can perform multiple writes; perhaps each one
 					// should be its own task.
 					start := time.Now()
-					err := c.set(task.fileNum, task.p, task.offset)
+					err := c.set(task.fileNum, task.obj, task.p, task.offset)
 					c.metrics.putLatency.Observe(float64(time.Since(start)))
 					if err != nil {
 						c.metrics.writeBackFailures.Add(1)
@@ -891,9 +1083,10 @@ func (w *writeWorkers) Stop() {
 }
 
 // QueueWrite adds a write task to the queue. Can block if the queue is full.
-func (w *writeWorkers) QueueWrite(fileNum base.DiskFileNum, p []byte, offset int64) {
+func (w *writeWorkers) QueueWrite(fileNum base.DiskFileNum, obj objectID, p []byte, offset int64) {
 	w.tasksCh <- writeTask{
 		fileNum: fileNum,
+		obj:     obj,
 		p:       p,
 		offset:  offset,
 	}
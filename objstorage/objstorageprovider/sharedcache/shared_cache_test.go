@@ -92,7 +92,7 @@ func TestSharedCache(t *testing.T) {
 				flags := sharedcache.ReadFlags{
 					ReadOnly: d.Cmd == "read-for-compaction",
 				}
-				err = cache.ReadAt(ctx, base.DiskFileNum(1), got, int64(offset), readable, readable.Size(), flags)
+				err = cache.ReadAt(ctx, base.DiskFileNum(1), "", got, int64(offset), readable, readable.Size(), flags)
 				// We always expect cache.ReadAt to succeed.
 				require.NoError(t, err)
 				// It is easier to assert this condition programmatically, rather than returning
@@ -176,12 +176,12 @@ func TestSharedCacheRandomized(t *testing.T) {
 							offset := rand.Int63n(size)
 
 							got := make([]byte, size-offset)
-							err := cache.ReadAt(ctx, base.DiskFileNum(1), got, offset, readable, readable.Size(), sharedcache.ReadFlags{})
+							err := cache.ReadAt(ctx, base.DiskFileNum(1), "", got, offset, readable, readable.Size(), sharedcache.ReadFlags{})
 							require.NoError(t, err)
 							require.Equal(t, objData[int(offset):], got)
 
 							got = make([]byte, size-offset)
-							err = cache.ReadAt(ctx, base.DiskFileNum(1), got, offset, readable, readable.Size(), sharedcache.ReadFlags{})
+							err = cache.ReadAt(ctx, base.DiskFileNum(1), "", got, offset, readable, readable.Size(), sharedcache.ReadFlags{})
 							require.NoError(t, err)
 							require.Equal(t, objData[int(offset):], got)
 						}()
@@ -214,6 +214,123 @@ func TestSharedCacheRandomized(t *testing.T) {
 	}
 }
 
+func TestSharedCachePersistence(t *testing.T) {
+	ctx := context.Background()
+	fs := vfs.NewStrictMem()
+	provider, err := objstorageprovider.Open(objstorageprovider.DefaultSettings(fs, ""))
+	require.NoError(t, err)
+	defer provider.Close()
+
+	const blockSize = 32 << 10
+	const shardingBlockSize = 1 << 20
+	const numShards = 4
+	const size = 3*blockSize + 100
+	create := func(fileNum base.DiskFileNum, size int, seed byte) ([]byte, objstorage.Readable) {
+		data := make([]byte, size)
+		for i := range data {
+			data[i] = byte(i) + seed
+		}
+		writable, _, err := provider.Create(ctx, base.FileTypeTable, fileNum, objstorage.CreateOptions{})
+		require.NoError(t, err)
+		// With invariants on, Write will modify its input buffer.
+		require.NoError(t, writable.Write(append([]byte(nil), data...)))
+		require.NoError(t, writable.Finish())
+		readable, err := provider.OpenForReading(ctx, base.FileTypeTable, fileNum, objstorage.OpenOptions{})
+		require.NoError(t, err)
+		return data, readable
+	}
+	objData, readable := create(1, size, 0)
+	defer readable.Close()
+
+	open := func(blockSize int) *sharedcache.Cache {
+		cache, err := sharedcache.Open(
+			fs, base.DefaultLogger, "", blockSize, shardingBlockSize, numShards*shardingBlockSize, numShards)
+		require.NoError(t, err)
+		return cache
+	}
+	// readObject reads the whole of an object cached under file number 1,
+	// returning whether it was read from the cache.
+	readObject := func(
+		cache *sharedcache.Cache, objName string, readable objstorage.Readable, data []byte,
+	) (hit bool) {
+		before := cache.Metrics().ReadsWithFullHit
+		got := make([]byte, len(data))
+		require.NoError(t, cache.ReadAt(ctx, base.DiskFileNum(1), objName, got, 0, readable, int64(len(data)), sharedcache.ReadFlags{}))
+		require.Equal(t, data, got)
+		cache.WaitForWritesToComplete()
+		return cache.Metrics().ReadsWithFullHit > before
+	}
+	read := func(cache *sharedcache.Cache) (hit bool) {
+		return readObject(cache, "", readable, objData)
+	}
+
+	cache := open(blockSize)
+	require.False(t, read(cache))
+	require.True(t, read(cache))
+	require.Zero(t, cache.Metrics().Recovered)
+	// The metadata is only persisted when the cache is closed.
+	_, err = sharedcache.ReadContents(fs, "")
+	require.Error(t, err)
+	require.NoError(t, cache.Close())
+
+	contents, err := sharedcache.ReadContents(fs, "")
+	require.NoError(t, err)
+	require.Equal(t, sharedcache.Contents{
+		BlockSize:    blockSize,
+		NumShards:    numShards,
+		SizeInBlocks: numShards * shardingBlockSize / blockSize,
+		UsedBlocks:   4,
+		Objects:      []sharedcache.ObjectContents{{FileNum: 1, Blocks: 4}},
+	}, contents)
+
+	// The contents are recovered when the cache is reopened.
+	cache = open(blockSize)
+	require.Equal(t, int64(4), cache.Metrics().Recovered)
+	require.Equal(t, int64(4), cache.Metrics().Count)
+	require.True(t, read(cache))
+	require.NoError(t, cache.Close())
+
+	// The recovered contents aren't returned for a different object reusing
+	// the file number, whether it has a different name or a different size.
+	otherData, otherReadable := create(2, size, 1)
+	defer otherReadable.Close()
+	cache = open(blockSize)
+	require.Equal(t, int64(4), cache.Metrics().Recovered)
+	require.False(t, readObject(cache, "other", otherReadable, otherData))
+	require.Equal(t, int64(4), cache.Metrics().Count)
+	require.True(t, readObject(cache, "other", otherReadable, otherData))
+	require.NoError(t, cache.Close())
+	cache = open(blockSize)
+	require.False(t, read(cache))
+	require.True(t, read(cache))
+	require.NoError(t, cache.Close())
+	largerData, largerReadable := create(3, size+blockSize, 2)
+	defer largerReadable.Close()
+	cache = open(blockSize)
+	require.False(t, readObject(cache, "", largerReadable, largerData))
+	require.True(t, readObject(cache, "", largerReadable, largerData))
+	require.NoError(t, cache.Close())
+	cache = open(blockSize)
+	require.False(t, read(cache))
+
+	// If the process crashes before the cache is closed, the cache restarts
+	// empty.
+	fs.SetIgnoreSyncs(true)
+	require.NoError(t, cache.Close())
+	fs.ResetToSyncedState()
+	fs.SetIgnoreSyncs(false)
+	cache = open(blockSize)
+	require.Zero(t, cache.Metrics().Recovered)
+	require.False(t, read(cache))
+	require.NoError(t, cache.Close())
+
+	// The contents are discarded if the configuration changes.
+	cache = open(2 * blockSize)
+	require.Zero(t, cache.Metrics().Recovered)
+	require.False(t, read(cache))
+	require.NoError(t, cache.Close())
+}
+
 // parseBytesArg parses an optional argument that specifies a byte size; if the
 // argument is not specified the default value is used. K/M/G suffixes are
 // supported.
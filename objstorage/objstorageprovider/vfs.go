@@ -67,10 +67,19 @@ func (p *provider) vfsInit() error {
 			return errors.Wrapf(err, "pebble: could not list store directory")
 		}
 	}
+	p.vfsAddListingLocked(listing)
+	return nil
+}
 
+// vfsAddListingLocked adds the local FS objects in the listing that aren't
+// already known. p.mu must be held, unless the provider is being initialized.
+func (p *provider) vfsAddListingLocked(listing []string) {
 	for _, filename := range listing {
 		fileType, fileNum, ok := base.ParseFilename(p.st.FS, filename)
-		if ok && fileType == base.FileTypeTable {
+		if ok && (fileType == base.FileTypeTable || fileType == base.FileTypeBlob) {
+			if _, ok := p.mu.knownObjects[fileNum]; ok {
+				continue
+			}
 			o := objstorage.ObjectMetadata{
 				FileType:    fileType,
 				DiskFileNum: fileNum,
@@ -78,7 +87,6 @@ func (p *provider) vfsInit() error {
 			p.mu.knownObjects[o.DiskFileNum] = o
 		}
 	}
-	return nil
 }
 
 func (p *provider) vfsSync() error {
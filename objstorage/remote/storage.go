@@ -6,8 +6,10 @@ package remote
 
 import (
 	"context"
+	"fmt"
 	"io"
 
+	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/redact"
 )
 
@@ -65,6 +67,71 @@ func ShouldCreateShared(strategy CreateOnSharedStrategy, level int) bool {
 	}
 }
 
+// Placement overrides, for one level of the LSM, the CreateOnSharedStrategy
+// deciding whether the new table files of the level are created on shared
+// storage. For use with LevelOptions.Placement.
+type Placement int8
+
+const (
+	// PlacementDefault places the new table files of the level according to
+	// the CreateOnSharedStrategy.
+	PlacementDefault Placement = iota
+	// PlacementLocal creates the new table files of the level on local
+	// storage.
+	PlacementLocal
+	// PlacementShared creates the new table files of the level on shared
+	// storage. It requires a CreateOnSharedStrategy other than
+	// CreateOnSharedNone, which configures shared storage.
+	PlacementShared
+)
+
+// String implements fmt.Stringer.
+func (p Placement) String() string {
+	switch p {
+	case PlacementDefault:
+		return "default"
+	case PlacementLocal:
+		return "local"
+	case PlacementShared:
+		return "shared"
+	default:
+		return fmt.Sprintf("Placement(%d)", int8(p))
+	}
+}
+
+// ParsePlacement parses the string representation of a Placement.
+func ParsePlacement(s string) (Placement, error) {
+	switch s {
+	case "default":
+		return PlacementDefault, nil
+	case "local":
+		return PlacementLocal, nil
+	case "shared":
+		return PlacementShared, nil
+	default:
+		return 0, errors.Errorf("pebble: unknown placement %q", s)
+	}
+}
+
+// ShouldCreateSharedWithPlacement is like ShouldCreateShared, with the
+// placement of the level overriding the strategy. Table files are never
+// created on shared storage with CreateOnSharedNone.
+func ShouldCreateSharedWithPlacement(
+	strategy CreateOnSharedStrategy, placement Placement, level int,
+) bool {
+	if strategy == CreateOnSharedNone {
+		return false
+	}
+	switch placement {
+	case PlacementLocal:
+		return false
+	case PlacementShared:
+		return true
+	default:
+		return ShouldCreateShared(strategy, level)
+	}
+}
+
 // Storage is an interface for a blob storage driver. This is lower-level
 // than an FS-like interface, however FS/File-like abstractions can be built on
 // top of these methods.
@@ -100,9 +100,12 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 		}
 	}()
 
-	// Lock the database directory.
+	// Lock the database directory. A DB opened with OpenReadOnly doesn't lock
+	// the directory, which is locked by the process writing to it.
 	var fileLock *Lock
-	if opts.Lock != nil {
+	if opts.private.follower != nil {
+		// Don't lock.
+	} else if opts.Lock != nil {
 		// The caller already acquired the database lock. Ensure that the
 		// directory matches.
 		if err := opts.Lock.pathMatches(dirname); err != nil {
@@ -119,7 +122,7 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 		}
 	}
 	defer func() {
-		if db == nil {
+		if db == nil && fileLock != nil {
 			fileLock.Close()
 		}
 	}()
@@ -198,6 +201,20 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 		}
 	}
 
+	var eventLog *eventLog
+	if opts.EventLog.Enabled && !opts.ReadOnly {
+		eventLog, err = openEventLog(opts.FS, dirname, ls, opts.EventLog, opts.Logger)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if db == nil {
+				eventLog.close()
+			}
+		}()
+		opts.AddEventListener(eventLog.eventListener())
+	}
+
 	if opts.Cache == nil {
 		opts.Cache = cache.New(cacheDefaultSize)
 	} else {
@@ -213,8 +230,9 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 		merge:               opts.Merger.Merge,
 		split:               opts.Comparer.Split,
 		abbreviatedKey:      opts.Comparer.AbbreviatedKey,
-		largeBatchThreshold: (opts.MemTableSize - uint64(memTableEmptySize)) / 2,
+		largeBatchThreshold: largeBatchThreshold(opts),
 		fileLock:            fileLock,
+		eventLog:            eventLog,
 		dataDir:             dataDir,
 		closed:              new(atomic.Value),
 		closedCh:            make(chan struct{}),
@@ -237,6 +255,9 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 			if d.tableCache != nil {
 				_ = d.tableCache.close()
 			}
+			if d.blobFiles != nil {
+				_ = d.blobFiles.close()
+			}
 
 			for _, mem := range d.mu.mem.queue {
 				switch t := mem.flushable.(type) {
@@ -258,13 +279,19 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 	}()
 
 	d.commit = newCommitPipeline(commitEnv{
-		logSeqNum:     &d.mu.versions.logSeqNum,
-		visibleSeqNum: &d.mu.versions.visibleSeqNum,
-		apply:         d.commitApply,
-		write:         d.commitWrite,
+		logSeqNum:       &d.mu.versions.logSeqNum,
+		visibleSeqNum:   &d.mu.versions.visibleSeqNum,
+		apply:           d.commitApply,
+		write:           d.commitWrite,
+		checkConditions: d.checkBatchConditions,
 	})
 	d.mu.nextJobID = 1
-	d.mu.mem.nextSize = opts.MemTableSize
+	if a := opts.AdaptiveMemTable; a.MaxSize > 0 {
+		d.memTableTargetSize.Store(min(max(opts.MemTableSize, a.MinSize), a.MaxSize))
+	} else {
+		d.memTableTargetSize.Store(opts.MemTableSize)
+	}
+	d.mu.mem.nextSize = d.memTableTargetSize.Load()
 	if d.mu.mem.nextSize > initialMemTableSize {
 		d.mu.mem.nextSize = initialMemTableSize
 	}
@@ -272,6 +299,7 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 	d.mu.compact.inProgress = make(map[*compaction]struct{})
 	d.mu.compact.noOngoingFlushStartTime = time.Now()
 	d.mu.snapshots.init()
+	d.mu.prepared.init()
 	// logSeqNum is the next sequence number that will be assigned.
 	// Start assigning sequence numbers from base.SeqNumStart to leave
 	// room for reserved sequence numbers (see comments around
@@ -282,6 +310,11 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 
 	d.timeNow = time.Now
 	d.openedAt = d.timeNow()
+	d.iterTracker = newIterTracker(d.opts, func() time.Time { return d.timeNow() })
+	d.hotKeys = newHotKeySampler(d.opts)
+	if opts.RateLimiter != nil {
+		d.rateLimiter = &dbRateLimiter{limiter: opts.RateLimiter}
+	}
 
 	d.mu.Lock()
 	defer d.mu.Unlock()
@@ -357,11 +390,21 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 		BytesPerSync:         opts.WALBytesPerSync,
 		PreallocateSize:      d.walPreallocateSize,
 		MinSyncInterval:      opts.WALMinSyncInterval,
+		SyncInterval:         opts.WALSyncInterval,
+		MaxSyncLatency:       opts.WALMaxSyncLatency,
+		WriteAlignment:       opts.WALWriteAlignment,
+		Padding:              opts.WALPadding,
+		DirectIO:             opts.WALDirectIO,
 		FsyncLatency:         d.mu.log.metrics.fsyncLatency,
 		QueueSemChan:         d.commit.logSyncQSem,
 		Logger:               opts.Logger,
 		EventListener:        walEventListenerAdaptor{l: opts.EventListener},
 	}
+	if d.rateLimiter != nil && opts.RateLimitWAL {
+		walOpts.WriteRateLimit = func(n int) {
+			d.rateLimiter.wait(RateLimitWALWrite, n)
+		}
+	}
 	if opts.WALFailover != nil {
 		walOpts.Secondary = opts.WALFailover.Secondary
 		walOpts.FailoverOptions = opts.WALFailover.FailoverOptions
@@ -396,6 +439,10 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 	d.tableCache = newTableCacheContainer(
 		opts.TableCache, d.cacheID, d.objProvider, d.opts, tableCacheSize,
 		&sstable.CategoryStatsCollector{})
+	d.blobFiles = newBlobFileCache(d.objProvider)
+	d.tableCache.dbOpts.opts.BlobValueFetcher = d.blobFiles
+	d.quarantine.d = d
+	d.tableCache.dbOpts.opts.CorruptBlockHandler = &d.quarantine
 	d.newIters = d.tableCache.newIters
 	d.tableNewRangeKeyIter = tableNewRangeKeyIter(context.TODO(), d.newIters)
 
@@ -457,7 +504,8 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 		}
 	}
 
-	// Replay any newer log files than the ones named in the manifest.
+	// Replay any newer log files than the ones named in the manifest. A DB
+	// opened with OpenReadOnly only replays them if it tails the WALs.
 	var replayWALs wal.Logs
 	for i, w := range wals {
 		if base.DiskFileNum(w.Num) >= d.mu.versions.minUnflushedLogNum {
@@ -465,6 +513,19 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 			break
 		}
 	}
+	if opts.private.follower != nil && !opts.private.follower.TailWAL {
+		replayWALs = nil
+	}
+	var truncated *WALReplayTruncatedInfo
+	if opts.RecoverUpToSeqNum != 0 {
+		if err := d.checkRecoverUpToSeqNumLocked(opts.RecoverUpToSeqNum); err != nil {
+			return nil, err
+		}
+		truncated = &WALReplayTruncatedInfo{
+			JobID:             int(jobID),
+			RecoverUpToSeqNum: opts.RecoverUpToSeqNum,
+		}
+	}
 	var ve versionEdit
 	var toFlush flushableList
 	for i, lf := range replayWALs {
@@ -474,8 +535,10 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 		// versions: RocksDB 6.2.1 and the version of Pebble included in CockroachDB
 		// 20.1 do not guarantee that closed WALs end cleanly. But the earliest
 		// compatible Pebble format is newer and guarantees a clean EOF.
-		strictWALTail := i < len(replayWALs)-1
-		flush, maxSeqNum, err := d.replayWAL(jobID, &ve, lf, strictWALTail)
+		//
+		// The WALs of a DB opened with OpenReadOnly may be written concurrently.
+		strictWALTail := i < len(replayWALs)-1 && opts.private.follower == nil
+		flush, maxSeqNum, err := d.replayWAL(jobID, &ve, lf, strictWALTail, truncated)
 		if err != nil {
 			return nil, err
 		}
@@ -485,6 +548,9 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 		}
 	}
 	d.mu.versions.visibleSeqNum.Store(d.mu.versions.logSeqNum.Load())
+	if truncated != nil {
+		d.opts.EventListener.WALReplayTruncated(*truncated)
+	}
 
 	if !d.opts.ReadOnly {
 		// Create an empty .log file.
@@ -514,6 +580,11 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 		if err != nil {
 			return nil, err
 		}
+		// The WALs holding the recovered prepared batches are now obsolete, so
+		// rewrite the prepared batches to the new WAL.
+		if err := d.relogPreparedLocked(d.mu.versions.logSeqNum.Load()); err != nil {
+			return nil, err
+		}
 
 		// This isn't strictly necessary as we don't use the log number for
 		// memtables being flushed, only for the next unflushed memtable.
@@ -575,6 +646,10 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 		}
 	}
 
+	if err := d.initHistoryLocked(ls); err != nil {
+		return nil, err
+	}
+
 	if !d.opts.ReadOnly {
 		d.scanObsoleteFiles(ls)
 		d.deleteObsoleteFiles(jobID)
@@ -583,10 +658,15 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 
 	d.mu.tableStats.cond.L = &d.mu.Mutex
 	d.mu.tableValidation.cond.L = &d.mu.Mutex
+	d.mu.blockPinning.cond.L = &d.mu.Mutex
+	d.requestPinnedBlocksUpdateLocked()
 	if !d.opts.ReadOnly {
 		d.maybeCollectTableStatsLocked()
 	}
 	d.calculateDiskAvailableBytes()
+	if opts.private.follower != nil {
+		d.initFollowerLocked(walDirs)
+	}
 
 	d.maybeScheduleFlush()
 	d.maybeScheduleCompaction()
@@ -750,16 +830,26 @@ func GetVersion(dir string, fs vfs.FS) (string, error) {
 // to the manifest, it is up to the caller of replayWAL to unreference the
 // toFlush flushables returned by replayWAL.
 //
+// If truncated is non-nil, the batch holding a key with a sequence number
+// greater than truncated.RecoverUpToSeqNum and all subsequent batches are
+// dropped rather than replayed, and recorded in truncated. Once a batch has been
+// dropped, every batch of subsequent WALs replayed with the same truncated is
+// dropped too.
+//
 // d.mu must be held when calling this, but the mutex may be dropped and
 // re-acquired during the course of this method.
 func (d *DB) replayWAL(
-	jobID JobID, ve *versionEdit, ll wal.LogicalLog, strictWALTail bool,
+	jobID JobID,
+	ve *versionEdit,
+	ll wal.LogicalLog,
+	strictWALTail bool,
+	truncated *WALReplayTruncatedInfo,
 ) (toFlush flushableList, maxSeqNum uint64, err error) {
-	rr := ll.OpenForRead()
+	rr := ll.OpenForReadWithLogData()
 	defer rr.Close()
+	rd := d.newWALReplayReader(rr)
+	defer rd.close()
 	var (
-		b               Batch
-		buf             bytes.Buffer
 		mem             *memTable
 		entry           *flushableEntry
 		offset          int64 // byte offset in rr
@@ -837,10 +927,8 @@ func (d *DB) replayWAL(
 	}()
 
 	for {
-		r, offset, err := rr.NextRecord()
-		if err == nil {
-			_, err = io.Copy(&buf, r)
-		}
+		rec := rd.next()
+		offset, err := rec.offset, rec.err
 		if err != nil {
 			// It is common to encounter a zeroed or invalid chunk due to WAL
 			// preallocation and WAL recycling. We need to distinguish these
@@ -855,7 +943,7 @@ func (d *DB) replayWAL(
 			return nil, 0, errors.Wrap(err, "pebble: error when replaying WAL")
 		}
 
-		if buf.Len() < batchrepr.HeaderLen {
+		if rec.buf.Len() < batchrepr.HeaderLen {
 			return nil, 0, base.CorruptionErrorf("pebble: corrupt wal %s (offset %s)",
 				errors.Safe(base.DiskFileNum(ll.Num)), offset)
 		}
@@ -864,18 +952,29 @@ func (d *DB) replayWAL(
 			return nil, 0, errors.WithDetailf(ErrDBNotPristine, "location: %q", d.dirname)
 		}
 
-		// Specify Batch.db so that Batch.SetRepr will compute Batch.memTableSize
-		// which is used below.
-		b = Batch{}
-		b.db = d
-		b.SetRepr(buf.Bytes())
+		if rec.decodeErr != nil {
+			return nil, 0, errors.Wrap(rec.decodeErr, "pebble: error when replaying WAL")
+		}
+
+		b := &rec.b
+		if truncated != nil && truncated.dropBatch(base.DiskFileNum(ll.Num), b) {
+			continue
+		}
+		if b.Count() == 0 {
+			// The batch only contains LogData, which is never applied, but may
+			// hold prepared batch markers.
+			if err := d.replayPreparedMarkersLocked(b); err != nil {
+				return nil, 0, err
+			}
+			continue
+		}
 		seqNum := b.SeqNum()
 		maxSeqNum = seqNum + uint64(b.Count())
 		keysReplayed += int64(b.Count())
 		batchesReplayed++
 		{
 			br := b.Reader()
-			if kind, encodedFileNum, _, ok, err := br.Next(); err != nil {
+			if kind, key, _, ok, err := br.Next(); err != nil {
 				return nil, 0, err
 			} else if ok && kind == InternalKeyKindIngestSST {
 				fileNums := make([]base.DiskFileNum, 0, b.Count())
@@ -886,7 +985,7 @@ func (d *DB) replayWAL(
 					}
 					fileNums = append(fileNums, base.DiskFileNum(fileNum))
 				}
-				addFileNum(encodedFileNum)
+				addFileNum(key)
 
 				for i := 1; i < int(b.Count()); i++ {
 					kind, encodedFileNum, _, ok, err := br.Next()
@@ -990,15 +1089,20 @@ func (d *DB) replayWAL(
 					}
 				}
 				return toFlush, maxSeqNum, nil
+			} else if ok && kind == InternalKeyKindLogData && bytes.HasPrefix(key, []byte(preparedMarkerPrefix)) {
+				// The batch holds prepared batch markers.
+				if err := d.replayPreparedMarkersLocked(b); err != nil {
+					return nil, 0, err
+				}
 			}
 		}
 
 		if b.memTableSize >= uint64(d.largeBatchThreshold) {
 			flushMem()
-			// Make a copy of the data slice since it is currently owned by buf and will
-			// be reused in the next iteration.
+			// Make a copy of the data slice since it is currently owned by the
+			// record, which may be reused by the next iteration.
 			b.data = slices.Clone(b.data)
-			b.flushable, err = newFlushableBatch(&b, d.opts.Comparer)
+			b.flushable, err = newFlushableBatch(b, d.opts.Comparer)
 			if err != nil {
 				return nil, 0, err
 			}
@@ -1022,7 +1126,7 @@ func (d *DB) replayWAL(
 			}
 		} else {
 			ensureMem(seqNum)
-			if err = mem.prepare(&b); err != nil && err != arenaskl.ErrArenaFull {
+			if err = mem.prepare(b); err != nil && err != arenaskl.ErrArenaFull {
 				return nil, 0, err
 			}
 			// We loop since DB.newMemTable() slowly grows the size of allocated memtables, so the
@@ -1031,17 +1135,16 @@ func (d *DB) replayWAL(
 			for err == arenaskl.ErrArenaFull {
 				flushMem()
 				ensureMem(seqNum)
-				err = mem.prepare(&b)
+				err = mem.prepare(b)
 				if err != nil && err != arenaskl.ErrArenaFull {
 					return nil, 0, err
 				}
 			}
-			if err = mem.apply(&b, seqNum); err != nil {
+			if err = mem.apply(b, seqNum); err != nil {
 				return nil, 0, err
 			}
 			mem.writerUnref()
 		}
-		buf.Reset()
 	}
 
 	d.opts.Logger.Infof("[JOB %d] WAL %s stopped reading at offset: %d; replayed %d keys in %d batches",
@@ -1058,6 +1161,50 @@ func (d *DB) replayWAL(
 	return toFlush, maxSeqNum, err
 }
 
+// checkRecoverUpToSeqNumLocked returns an error if an sstable holds keys with
+// sequence numbers greater than seqNum, which a point-in-time recovery to
+// seqNum can't drop. d.mu must be held when calling this.
+func (d *DB) checkRecoverUpToSeqNumLocked(seqNum uint64) error {
+	v := d.mu.versions.currentVersion()
+	for level := range v.Levels {
+		iter := v.Levels[level].Iter()
+		for f := iter.First(); f != nil; f = iter.Next() {
+			if f.LargestSeqNum > seqNum {
+				return errors.Newf("pebble: cannot recover up to seqnum %d: L%d table %s holds keys up to seqnum %d",
+					seqNum, level, f.FileNum, f.LargestSeqNum)
+			}
+		}
+	}
+	return nil
+}
+
+// dropBatch returns true if the batch read from the WAL must be dropped rather
+// than replayed, recording it if so.
+func (i *WALReplayTruncatedInfo) dropBatch(fileNum base.DiskFileNum, b *Batch) bool {
+	seqNum, count := b.SeqNum(), uint64(b.Count())
+	// A batch only containing LogData holds no keys, and is dropped once its
+	// sequence number, that of the next key, is beyond the recovery point.
+	largest := seqNum
+	if count > 0 {
+		largest = seqNum + count - 1
+	}
+	if i.Batches == 0 && largest <= i.RecoverUpToSeqNum {
+		return false
+	}
+	if n := len(i.FileNums); n == 0 || i.FileNums[n-1] != fileNum {
+		i.FileNums = append(i.FileNums, fileNum)
+	}
+	if count > 0 {
+		if i.Keys == 0 {
+			i.SmallestSeqNum = seqNum
+		}
+		i.LargestSeqNum = max(i.LargestSeqNum, largest)
+	}
+	i.Batches++
+	i.Keys += count
+	return true
+}
+
 func readOptionsFile(opts *Options, path string) (string, error) {
 	f, err := opts.FS.Open(path)
 	if err != nil {
@@ -9,6 +9,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -325,7 +326,7 @@ func TestNewDBFilenames(t *testing.T) {
 			"LOCK",
 			"MANIFEST-000001",
 			"OPTIONS-000003",
-			"marker.format-version.000004.017",
+			"marker.format-version.000006.019",
 			"marker.manifest.000001.MANIFEST-000001",
 		},
 	}
@@ -1474,3 +1475,207 @@ func TestOpenRatchetsNextFileNum(t *testing.T) {
 	require.NoError(t, d.Compact([]byte("a"), []byte("z"), false))
 
 }
+
+func TestWALCompression(t *testing.T) {
+	value := bytes.Repeat([]byte("abcdefgh"), 512)
+	testCases := []struct {
+		formatVersion FormatMajorVersion
+		compression   Compression
+		compressed    bool
+	}{
+		{FormatSyntheticPrefixSuffix, SnappyCompression, false},
+		{FormatWALCompression, DefaultCompression, false},
+		{FormatWALCompression, NoCompression, false},
+		{FormatWALCompression, SnappyCompression, true},
+		{FormatWALCompression, ZstdCompression, true},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s/%s", tc.formatVersion, tc.compression), func(t *testing.T) {
+			mem := vfs.NewMem()
+			d, err := Open("", &Options{
+				FS:                 mem,
+				FormatMajorVersion: tc.formatVersion,
+				WALCompression:     tc.compression,
+			})
+			require.NoError(t, err)
+			for i := 0; i < 100; i++ {
+				require.NoError(t, d.Set([]byte(fmt.Sprintf("key%03d", i)), value, NoSync))
+			}
+			m := d.Metrics()
+			if tc.compressed {
+				require.Less(t, m.WAL.BytesWritten, m.WAL.BytesIn/10)
+			} else {
+				require.Greater(t, m.WAL.BytesWritten, m.WAL.BytesIn)
+			}
+			// Batches that don't compress are written uncompressed, within the
+			// same WAL as the compressed batches.
+			incompressible := make([]byte, 100)
+			rand.New(rand.NewSource(1)).Read(incompressible)
+			require.NoError(t, d.Set([]byte("key100"), incompressible, NoSync))
+			require.NoError(t, d.Close())
+
+			// Reopen the DB without WAL compression, forcing the compressed
+			// WAL to be replayed.
+			d, err = Open("", &Options{FS: mem})
+			require.NoError(t, err)
+			defer func() { require.NoError(t, d.Close()) }()
+			for i := 0; i < 100; i++ {
+				v, closer, err := d.Get([]byte(fmt.Sprintf("key%03d", i)))
+				require.NoError(t, err)
+				require.Equal(t, value, v)
+				require.NoError(t, closer.Close())
+			}
+			v, closer, err := d.Get([]byte("key100"))
+			require.NoError(t, err)
+			require.Equal(t, incompressible, v)
+			require.NoError(t, closer.Close())
+		})
+	}
+}
+
+func TestOpenRecoverUpToSeqNum(t *testing.T) {
+	mem := vfs.NewMem()
+	d, err := Open("", &Options{FS: mem})
+	require.NoError(t, err)
+	for _, k := range []string{"a", "b", "c"} {
+		require.NoError(t, d.Set([]byte(k), []byte(k), nil))
+	}
+	recoverUpTo := d.mu.versions.visibleSeqNum.Load() - 1
+	for _, k := range []string{"d", "e"} {
+		require.NoError(t, d.Set([]byte(k), []byte(k), nil))
+	}
+	// An accidental bulk delete.
+	require.NoError(t, d.DeleteRange([]byte("a"), []byte("z"), nil))
+	require.NoError(t, d.Close())
+
+	keys := func(d *DB) string {
+		iter, _ := d.NewIter(nil)
+		var keys []string
+		for valid := iter.First(); valid; valid = iter.Next() {
+			keys = append(keys, string(iter.Key()))
+		}
+		require.NoError(t, iter.Close())
+		return strings.Join(keys, ",")
+	}
+
+	var info WALReplayTruncatedInfo
+	opts := &Options{
+		FS: mem,
+		EventListener: &EventListener{
+			WALReplayTruncated: func(i WALReplayTruncatedInfo) { info = i },
+		},
+		RecoverUpToSeqNum: recoverUpTo,
+	}
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	require.Equal(t, "a,b,c", keys(d))
+	require.Equal(t, uint64(3), info.Batches)
+	require.Equal(t, uint64(3), info.Keys)
+	require.Equal(t, recoverUpTo+1, info.SmallestSeqNum)
+	require.Equal(t, recoverUpTo+3, info.LargestSeqNum)
+	require.Len(t, info.FileNums, 1)
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Close())
+
+	// The dropped records were discarded. The flushed sstable now holds keys
+	// with sequence numbers up to recoverUpTo, so recovering to an earlier
+	// sequence number fails.
+	d, err = Open("", &Options{FS: mem})
+	require.NoError(t, err)
+	require.Equal(t, "a,b,c", keys(d))
+	require.NoError(t, d.Close())
+	opts.RecoverUpToSeqNum = recoverUpTo - 1
+	_, err = Open("", opts)
+	require.ErrorContains(t, err, "cannot recover up to seqnum")
+}
+
+func TestOpenWALReplayConcurrency(t *testing.T) {
+	mem := vfs.NewMem()
+	d, err := Open("", &Options{FS: mem, WALCompression: SnappyCompression})
+	require.NoError(t, err)
+	rng := rand.New(rand.NewSource(1))
+	value := make([]byte, 100)
+	const n = 2000
+	for i := 0; i < n; i++ {
+		b := d.NewBatch()
+		rng.Read(value)
+		require.NoError(t, b.Set([]byte(fmt.Sprintf("%05d", i)), value, nil))
+		require.NoError(t, b.Set([]byte("last"), []byte(fmt.Sprint(i)), nil))
+		require.NoError(t, b.Commit(nil))
+	}
+	require.NoError(t, d.Close())
+
+	for _, concurrency := range []int{1, 4} {
+		t.Run(fmt.Sprint(concurrency), func(t *testing.T) {
+			// The memtables are small so that the replay flushes them.
+			opts := &Options{FS: mem, MemTableSize: 64 << 10, ReadOnly: true, WALReplayConcurrency: concurrency}
+			d, err := Open("", opts)
+			require.NoError(t, err)
+			defer d.Close()
+			v, closer, err := d.Get([]byte("last"))
+			require.NoError(t, err)
+			require.Equal(t, fmt.Sprint(n-1), string(v))
+			require.NoError(t, closer.Close())
+			iter, _ := d.NewIter(nil)
+			var count int
+			for valid := iter.First(); valid; valid = iter.Next() {
+				count++
+			}
+			require.NoError(t, iter.Close())
+			require.Equal(t, n+1, count)
+		})
+	}
+}
+
+func TestOpenWALWriteAlignment(t *testing.T) {
+	count := func(t *testing.T, d *DB) int {
+		iter, _ := d.NewIter(nil)
+		var n int
+		for valid := iter.First(); valid; valid = iter.Next() {
+			n++
+		}
+		require.NoError(t, iter.Close())
+		return n
+	}
+	for _, padding := range []WALPaddingPolicy{WALPadSyncedRecords, WALPadAllRecords} {
+		t.Run(padding.String(), func(t *testing.T) {
+			mem := vfs.NewStrictMem()
+			opts := &Options{FS: mem, WALWriteAlignment: 4096, WALPadding: padding}
+			d, err := Open("", opts)
+			require.NoError(t, err)
+			const n = 200
+			for i := 0; i < n; i++ {
+				wo := NoSync
+				if i%3 == 0 || i == n-1 {
+					wo = Sync
+				}
+				require.NoError(t, d.Set([]byte(fmt.Sprintf("%05d", i)), bytes.Repeat([]byte("v"), i), wo))
+			}
+			// The synced writes survive a crash.
+			mem.SetIgnoreSyncs(true)
+			require.NoError(t, d.Close())
+			mem.ResetToSyncedState()
+			mem.SetIgnoreSyncs(false)
+			d, err = Open("", opts)
+			require.NoError(t, err)
+			require.Equal(t, n, count(t, d))
+			require.NoError(t, d.Close())
+		})
+	}
+
+	t.Run("direct-io", func(t *testing.T) {
+		dir := t.TempDir()
+		opts := &Options{FS: vfs.Default, WALWriteAlignment: 4096, WALDirectIO: true}
+		d, err := Open(dir, opts)
+		require.NoError(t, err)
+		const n = 1000
+		for i := 0; i < n; i++ {
+			require.NoError(t, d.Set([]byte(fmt.Sprintf("%05d", i)), []byte("value"), Sync))
+		}
+		require.NoError(t, d.Close())
+		d, err = Open(dir, opts)
+		require.NoError(t, err)
+		require.Equal(t, n, count(t, d))
+		require.NoError(t, d.Close())
+	})
+}
@@ -9,12 +9,14 @@ import (
 	"fmt"
 	"io"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 	"unicode"
 
 	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/batchrepr"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/cache"
 	"github.com/cockroachdb/pebble/internal/humanize"
@@ -22,6 +24,7 @@ import (
 	"github.com/cockroachdb/pebble/internal/manifest"
 	"github.com/cockroachdb/pebble/objstorage/remote"
 	"github.com/cockroachdb/pebble/rangekey"
+	"github.com/cockroachdb/pebble/record"
 	"github.com/cockroachdb/pebble/sstable"
 	"github.com/cockroachdb/pebble/vfs"
 	"github.com/cockroachdb/pebble/wal"
@@ -43,6 +46,15 @@ const (
 	ZstdCompression    = sstable.ZstdCompression
 )
 
+// WALPaddingPolicy exports the record.PaddingPolicy type.
+type WALPaddingPolicy = record.PaddingPolicy
+
+// Exported WALPaddingPolicy constants.
+const (
+	WALPadSyncedRecords = record.PadSyncedRecords
+	WALPadAllRecords    = record.PadAllRecords
+)
+
 // FilterType exports the base.FilterType type.
 type FilterType = base.FilterType
 
@@ -57,6 +69,9 @@ type FilterWriter = base.FilterWriter
 // FilterPolicy exports the base.FilterPolicy type.
 type FilterPolicy = base.FilterPolicy
 
+// PrefixExtractor exports the base.PrefixExtractor type.
+type PrefixExtractor = base.PrefixExtractor
+
 // BlockPropertyCollector exports the sstable.BlockPropertyCollector type.
 type BlockPropertyCollector = sstable.BlockPropertyCollector
 
@@ -401,6 +416,10 @@ type LevelOptions struct {
 
 	// Compression defines the per-block compression to use.
 	//
+	// Compactions that would otherwise move a table into a level configured
+	// with a different compression or BlockSize rewrite the table instead, so
+	// that its blocks are written with the level's settings.
+	//
 	// The default value (DefaultCompression) uses snappy compression.
 	Compression func() Compression
 
@@ -433,6 +452,22 @@ type LevelOptions struct {
 
 	// The target file size for the level.
 	TargetFileSize int64
+
+	// Placement overrides Options.Experimental.CreateOnShared for the level,
+	// placing the new tables of the level on local or shared storage. For
+	// example, with CreateOnSharedLower, the tables of L5 may be kept on local
+	// storage by an override of PlacementLocal for L5. Placing a level's tables
+	// on shared storage requires CreateOnShared to be set. A level with tables
+	// on local storage at or below L5 prevents skip-shared iteration (see
+	// DB.ScanInternal).
+	//
+	// Changing the placement of a level doesn't move existing tables: the
+	// tables are moved by compactions writing the level, or by
+	// DB.MigrateTablePlacement.
+	//
+	// The default value, PlacementDefault, places the tables according to
+	// CreateOnShared.
+	Placement remote.Placement
 }
 
 // EnsureDefaults ensures that the default values for all of the options have
@@ -469,6 +504,21 @@ func (o *LevelOptions) EnsureDefaults() *LevelOptions {
 // apply to the DB at large; per-query options are defined by the IterOptions
 // and WriteOptions types.
 type Options struct {
+	// BatchCommitHook, if set, is invoked whenever a non-empty batch is
+	// applied to the DB (including through DB.Set, DB.Delete, etc), before the
+	// batch is assigned a sequence number or written to the WAL. The hook may
+	// inspect the batch's contents through Batch.Reader and may add mutations
+	// to the batch, for example to maintain a secondary index. Mutations added
+	// by the hook are committed atomically with the rest of the batch. A
+	// Batch.Reader obtained before the hook adds mutations observes only the
+	// batch's original contents.
+	//
+	// If the hook returns an error, the batch is not committed and the error is
+	// returned to the caller. The hook is invoked on the committing goroutine,
+	// and may be invoked concurrently for different batches. The hook must not
+	// commit, close or reset the batch.
+	BatchCommitHook func(b *Batch) error
+
 	// Sync sstables periodically in order to smooth out writes to disk. This
 	// option does not provide any persistency guarantee, but is used to avoid
 	// latency spikes if the OS automatically decides to write out a large chunk
@@ -495,11 +545,33 @@ type Options struct {
 	// The default value uses the same ordering as bytes.Compare.
 	Comparer *Comparer
 
+	// CorruptionRecoveryHook, if set, is invoked when a block of a table of the
+	// DB fails its checksum when read, to recover the block instead of failing
+	// the read or compaction, e.g. by fetching it from a replica. The tables
+	// with recovered blocks are rewritten by compactions. The corrupt blocks
+	// are recorded by DB.Quarantine and reported by EventListener.TableCorrupted
+	// whether or not they are recovered.
+	CorruptionRecoveryHook CorruptionRecoveryHook
+
 	// DebugCheck is invoked, if non-nil, whenever a new version is being
 	// installed. Typically, this is set to pebble.DebugCheckLevels in tests
 	// or tools only, to check invariants over all the data in the database.
 	DebugCheck func(*DB) error
 
+	// DebugIterators, if non-nil, enables tracking of the DB's open iterators,
+	// including the stack trace of each iterator's creation. Open iterators may
+	// be retrieved through DB.OpenIterators, and long-lived iterators may be
+	// logged (see DebugIteratorsOptions). Tracking iterators adds overhead to
+	// the creation of every iterator, and is intended for diagnosing leaked
+	// iterators.
+	DebugIterators *DebugIteratorsOptions
+
+	// HotKeys, if non-nil, enables the sampling of the keys read and written,
+	// to estimate the hottest keys and key ranges. Hot keys may be retrieved
+	// through DB.HotKeys. Sampling adds overhead to reads and commits, and is
+	// intended for diagnosing hotspots.
+	HotKeys *HotKeysOptions
+
 	// Disable the write-ahead log (WAL). Disabling the write-ahead log prohibits
 	// crash recovery, but can improve performance if crash recovery is not
 	// needed (e.g. when only temporary state is being stored in the database).
@@ -533,6 +605,16 @@ type Options struct {
 	// flushes, compactions, and table deletion.
 	EventListener *EventListener
 
+	// EventLog configures the event log, which persists the flushes,
+	// compactions, ingestions, write stalls, background errors and disk
+	// slowness events of the DB (see EventLogRecord) in its data directory,
+	// for debugging after the fact. The event log is read through
+	// ReadEventLog, or with the `pebble db events` command.
+	//
+	// The event log is disabled by default, and is never written by a DB
+	// opened in read-only mode.
+	EventLog EventLogOptions
+
 	// Experimental contains experimental options which are off by default.
 	// These options are temporary and will eventually either be deleted, moved
 	// out of the experimental group, or made the non-adjustable default. These
@@ -552,6 +634,14 @@ type Options struct {
 		// concurrency slots as determined by the two options is chosen.
 		CompactionDebtConcurrency uint64
 
+		// CompactionPickerFactory, if set, constructs a CompactionPicker that
+		// is consulted before the built-in heuristics whenever an automatic
+		// compaction may be scheduled. It allows for custom compaction
+		// policies (e.g. favoring a hot key range, or tables dense with
+		// tombstones) while reusing Pebble's execution of compactions. See
+		// CompactionPicker.
+		CompactionPickerFactory CompactionPickerFactory
+
 		// IngestSplit, if it returns true, allows for ingest-time splitting of
 		// existing sstables into two virtual sstables to allow ingestion sstables to
 		// slot into a lower level than they otherwise would have.
@@ -625,6 +715,24 @@ type Options struct {
 		// compaction will never get triggered.
 		MultiLevelCompactionHeuristic MultiLevelHeuristic
 
+		// PinnedBlocksMinLevel, if non-zero, pins the index, filter, range
+		// deletion and range key blocks of the tables of the levels at or below
+		// it (e.g. 6 for just the bottommost level) in the block cache, so that
+		// they're never evicted to make room for other blocks. The bottommost
+		// levels hold most of the data, so reading their tables after their
+		// index blocks were evicted under scan pressure incurs additional I/O.
+		// L0 tables are short-lived, and are never pinned by this policy. See
+		// also DB.PinTables.
+		PinnedBlocksMinLevel int
+
+		// PinnedBlocksMaxBytes limits the total size of the blocks pinned in
+		// the block cache through PinnedBlocksMinLevel and DB.PinTables. Once
+		// it's reached, no more tables are pinned. The spans passed to
+		// DB.PinTables take precedence over the levels, and the bottommost
+		// levels over the levels above. If zero, it defaults to a quarter of
+		// the capacity of the block cache.
+		PinnedBlocksMaxBytes int64
+
 		// MaxWriterConcurrency is used to indicate the maximum number of
 		// compression workers the compression queue is allowed to use. If
 		// MaxWriterConcurrency > 0, then the Writer will use parallelism, to
@@ -783,6 +891,63 @@ type Options struct {
 		//   which will later be consumed by SingleDelete#3. The violation will
 		//   not be detected and the DB will be correct.
 		SingleDeleteInvariantViolationCallback func(userKey []byte)
+
+		// ExpirationFunc, if set, returns the time at which the given point key
+		// and value expire, or the zero time if they never expire. It is
+		// consulted for SET keys only, must be deterministic and must not retain
+		// the key or value.
+		//
+		// Flushes and compactions drop expired keys that are newer than every
+		// open snapshot and are not retained by Options.RetainHistory: the keys
+		// visible to a snapshot remain readable by it. Reads do not filter
+		// expired keys: a key remains readable until a compaction drops it, so
+		// callers that need strict expiration semantics must also check expiry
+		// when reading.
+		//
+		// When set, sstables written by flushes and compactions record the
+		// range of expiry times of their keys in the "pebble.expiry" block
+		// property, and, while no snapshots are open, the compaction picker
+		// schedules compactions of tables all of whose keys have expired.
+		ExpirationFunc func(key, value []byte) time.Time
+
+		// TombstoneDenseCompactionThreshold, if positive, configures the
+		// compaction picker to compact the tables dominated by deletions, whose
+		// tombstone density is at least the threshold, before they'd be compacted
+		// by the level scores. The tombstone density of a table is the larger of
+		// the fraction of its entries that are point tombstones, and of the
+		// estimated size of the data dropped by its range tombstones relative to
+		// its size. A dense table is compacted into the next level, where its
+		// tombstones drop the keys they delete, or rewritten in place if it's in
+		// the bottommost level, dropping its tombstones. Tables in L0 are
+		// compacted by the L0 score. A threshold in (0, 1] is expected: a lower
+		// threshold compacts more tables early, at the cost of write
+		// amplification.
+		TombstoneDenseCompactionThreshold float64
+
+		// BlobValueThreshold, if positive, configures flushes and compactions to
+		// separate the values of SET keys that are at least BlobValueThreshold
+		// bytes long into blob files, storing only a small handle to the value
+		// in the sstable. Compactions then rewrite the handle rather than the
+		// value, reducing the write amplification of workloads with large
+		// values at the cost of an additional read when the value is fetched.
+		//
+		// Values are only separated once the format major version is at least
+		// FormatBlobValues, and are never separated into sstables created on
+		// shared storage (see CreateOnShared). The ShortAttributeExtractor, if
+		// set, is used to extract the short attributes of separated values.
+		//
+		// The default value is 0, i.e. values are not separated.
+		BlobValueThreshold int
+
+		// BlobGCAgeCutoff configures the garbage collection of blob files. A
+		// blob file is deleted once no sstable references any of its values.
+		// Additionally, compactions rewrite the values they encounter in the
+		// oldest BlobGCAgeCutoff fraction of the blob files into new blob files,
+		// so that the older blob files, which are likely to be mostly garbage,
+		// are eventually unreferenced. A negative value disables this rewriting.
+		//
+		// The default value is 0.25. Values greater than 1 are invalid.
+		BlobGCAgeCutoff float64
 	}
 
 	// Filters is a map from filter policy name to filter policy. It is used for
@@ -878,11 +1043,48 @@ type Options struct {
 	// LoggerAndTracer is used for writing log messages and traces.
 	LoggerAndTracer LoggerAndTracer
 
+	// LowDiskSpaceThreshold, if non-zero, is the number of bytes of available
+	// disk space below which the DB is considered to be low on disk space.
+	// Available disk space is refreshed whenever a flush or compaction
+	// completes and whenever a file is deleted. When it first falls below the
+	// threshold, EventListener.LowDiskSpace is invoked.
+	LowDiskSpaceThreshold uint64
+
+	// ReadOnlyOnLowDiskSpace, if true, causes writes and ingestions to fail with
+	// ErrLowDiskSpace while available disk space is below
+	// LowDiskSpaceThreshold. Flushes and compactions continue to run, so that
+	// they may reclaim disk space.
+	ReadOnlyOnLowDiskSpace bool
+
+	// MaxManifestAge is the maximum age of the MANIFEST file. The first version
+	// edit applied once the MANIFEST is older than MaxManifestAge rolls it over,
+	// regardless of its size. The default value is 0, which doesn't limit the
+	// age of the MANIFEST.
+	MaxManifestAge time.Duration
+
+	// MaxManifestEdits is the maximum number of version edits the MANIFEST file
+	// holds following its initial snapshot. Once the MANIFEST holds
+	// MaxManifestEdits edits, the next version edit rolls it over regardless of
+	// its size, which bounds the number of edits replayed when the DB is
+	// opened. The default value is 0, which doesn't limit the number of edits.
+	// See NumPrevManifest for the retention of the rolled over MANIFESTs.
+	MaxManifestEdits int
+
 	// MaxManifestFileSize is the maximum size the MANIFEST file is allowed to
 	// become. When the MANIFEST exceeds this size it is rolled over and a new
 	// MANIFEST is created.
 	MaxManifestFileSize int64
 
+	// RetainHistory, if non-zero, is the duration for which the history of the
+	// DB is retained: flushes and compactions don't drop the versions of keys
+	// that were overwritten or deleted within the last RetainHistory, so that
+	// the states of the DB within that window may be read with
+	// DB.NewIterAtSeqNum. The history is retained for at least RetainHistory,
+	// and at most RetainHistory/16 longer, and is retained across restarts of
+	// the DB. Retaining history increases space amplification: see
+	// Metrics.History. The default value is 0, which doesn't retain history.
+	RetainHistory time.Duration
+
 	// MaxOpenFiles is a soft limit on the number of open files that can be
 	// used by the DB.
 	//
@@ -911,6 +1113,17 @@ type Options struct {
 	// The default value is 2.
 	MemTableStopWritesThreshold int
 
+	// AdaptiveMemTable configures the adaptive sizing of MemTables, which is
+	// enabled by setting AdaptiveMemTable.MaxSize. With adaptive sizing,
+	// MemTableSize is the initial steady state size of MemTables, which then
+	// grows and shrinks within the configured bounds based on the flush
+	// backlog and write amplification measured whenever a MemTable fills.
+	// The current size is reported by Metrics.MemTable.TargetSize, and resizes
+	// are notified through EventListener.MemTableResized.
+	//
+	// Adaptive sizing is disabled by default.
+	AdaptiveMemTable AdaptiveMemTableOptions
+
 	// Merger defines the associative merge operation to use for merging values
 	// written with {Batch,DB}.Merge.
 	//
@@ -968,12 +1181,51 @@ type Options struct {
 	// to keep one older manifest.
 	NumPrevManifest int
 
+	// PrefixExtractor, if set, extracts the prefixes added to filters from the
+	// prefixes returned by Comparer.Split, allowing the filters of the levels
+	// configured with a FilterPolicy to hold coarser prefixes than those sought
+	// by SeekPrefixGE. When set, the memtables also maintain a filter of these
+	// prefixes, which SeekPrefixGE uses to skip memtables that don't contain the
+	// prefix sought.
+	//
+	// The filters of sstables written with a different prefix extractor (or
+	// without one, if one is set) are ignored. Changing the prefix extractor of
+	// an existing DB is safe, but the filters of its existing sstables are
+	// unusable until they're rewritten by compactions.
+	PrefixExtractor *PrefixExtractor
+
+	// RateLimiter, if non-nil, limits the bandwidth of the reads and writes of
+	// compactions and the writes of flushes, and of the WAL if RateLimitWAL is
+	// set. A single RateLimiter may be shared by multiple DBs. See
+	// NewRateLimiter for a RateLimiter whose rate may be adjusted while in use.
+	// The I/O submitted to the RateLimiter is reported by Metrics.RateLimit.
+	RateLimiter RateLimiter
+
+	// RateLimitWAL, if true, submits the writes of the WAL to RateLimiter. Note
+	// that limiting the rate of WAL writes limits the rate of commits. It's
+	// ignored if RateLimiter is nil.
+	RateLimitWAL bool
+
 	// ReadOnly indicates that the DB should be opened in read-only mode. Writes
 	// to the DB will return an error, background compactions are disabled, and
 	// the flush that normally occurs after replaying the WAL at startup is
 	// disabled.
 	ReadOnly bool
 
+	// RecoverUpToSeqNum, if non-zero, performs a point-in-time recovery when
+	// the DB is opened: WAL replay stops at the first batch holding a key with
+	// a sequence number greater than RecoverUpToSeqNum, and that batch and all
+	// subsequent WAL records are dropped. The dropped records are reported by
+	// EventListener.WALReplayTruncated. Unless the DB is opened in read-only
+	// mode, the dropped records are permanently discarded once Open returns.
+	// Open fails if an sstable holds keys with greater sequence numbers, since
+	// these can't be dropped.
+	//
+	// RecoverUpToSeqNum is intended to be set for a single Open: the sequence
+	// numbers of writes made after the recovery may exceed it, in which case
+	// opening the DB with it set again drops those writes too.
+	RecoverUpToSeqNum uint64
+
 	// TableCache is an initialized TableCache which should be set as an
 	// option if the DB needs to be initialized with a pre-existing table cache.
 	// If TableCache is nil, then a table cache which is unique to the DB instance
@@ -982,6 +1234,11 @@ type Options struct {
 	// and pebble will panic otherwise.
 	TableCache *TableCache
 
+	// Tracer, if non-nil, is used to trace individual Gets, commits, iterators,
+	// flushes and compactions, reporting the blocks and bytes read and written
+	// by each. See Tracer.
+	Tracer Tracer
+
 	// BlockPropertyCollectors is a list of BlockPropertyCollector creation
 	// functions. A new BlockPropertyCollector is created for each sstable
 	// built and lives for the lifetime of writing that table.
@@ -998,6 +1255,19 @@ type Options struct {
 	// default behaviour in RocksDB.
 	WALBytesPerSync int
 
+	// WALCompression specifies the compression to apply to the batches written
+	// to the WAL. Compression reduces WAL write bandwidth for workloads with
+	// large, compressible values at the cost of CPU on the commit path. A batch
+	// is written uncompressed if compression doesn't reduce its size.
+	//
+	// WALs containing compressed batches cannot be replayed by versions of
+	// Pebble that predate FormatWALCompression, so WALCompression is ignored
+	// unless the format major version is at least FormatWALCompression.
+	//
+	// The default value, DefaultCompression, disables WAL compression, as
+	// does NoCompression.
+	WALCompression Compression
+
 	// WALDir specifies the directory to store write-ahead logs (WALs) in. If
 	// empty (the default), WALs will be stored in the same directory as sstables
 	// (i.e. the directory passed to pebble.Open).
@@ -1021,6 +1291,15 @@ type Options struct {
 	// is not a corresponding entry in WALRecoveryDirs, Open will error.
 	WALRecoveryDirs []wal.Dir
 
+	// WALReplayConcurrency is the number of goroutines that decompress and
+	// decode the batches held by the WALs replayed when the DB is opened. The
+	// WALs are read ahead of the application of their batches to memtables,
+	// which is sequential, preserving the order of their sequence numbers. If
+	// WALReplayConcurrency is 1, the WALs are replayed by a single goroutine.
+	//
+	// The default value, 0, uses runtime.GOMAXPROCS(0) goroutines.
+	WALReplayConcurrency int
+
 	// WALMinSyncInterval is the minimum duration between syncs of the WAL. If
 	// WAL syncs are requested faster than this interval, they will be
 	// artificially delayed. Introducing a small artificial delay (500us) between
@@ -1033,6 +1312,50 @@ type Options struct {
 	// changing options dynamically?
 	WALMinSyncInterval func() time.Duration
 
+	// WALSyncInterval, if non-zero, groups the syncs of the WAL across commits:
+	// a sync requested less than WALSyncInterval after the previous sync is
+	// delayed until the interval elapses, and is then performed together with
+	// the syncs requested in the meantime. This trades a bounded amount of
+	// commit latency for fewer syncs, which is beneficial on disks with a high
+	// sync latency or a limited number of IOPS (such as network-attached cloud
+	// disks). WALMinSyncInterval is ignored when WALSyncInterval is set. The
+	// default value is 0.
+	WALSyncInterval time.Duration
+
+	// WALMaxSyncLatency bounds the latency added to the commits by
+	// WALSyncInterval. A sync is delayed by at most WALMaxSyncLatency minus the
+	// recent latency of the syncs of the WAL, so that commits waiting for a
+	// sync are acknowledged within WALMaxSyncLatency, as long as the syncs
+	// don't get slower. The default value, 0, doesn't bound the delay, which is
+	// then at most WALSyncInterval. WALMaxSyncLatency has no effect unless
+	// WALSyncInterval is set.
+	WALMaxSyncLatency time.Duration
+
+	// WALWriteAlignment, if non-zero, aligns the writes of the WAL: their
+	// offsets and lengths are multiples of WALWriteAlignment, so that a write
+	// never partially overwrites a page written previously, which requires
+	// the OS to read the page back if it was evicted from the page cache. The
+	// records are padded up to the next multiple of WALWriteAlignment as
+	// configured by WALPadding. It must be a power of two between 512 and
+	// 32KiB, typically the page size of the OS (4KiB). WALs written with
+	// padding may be replayed by any version of Pebble.
+	WALWriteAlignment int
+
+	// WALPadding is the padding policy of the WAL records when
+	// WALWriteAlignment is set. The default, WALPadSyncedRecords, pads the
+	// records requesting a sync: the records that don't request a sync are
+	// only written to the WAL once a subsequent record requests a sync, their
+	// 32KiB block of the WAL is full or the WAL is rotated, so they may be lost
+	// if the process crashes. WALPadAllRecords pads every record, using more
+	// space in the WAL.
+	WALPadding WALPaddingPolicy
+
+	// WALDirectIO, if true, writes the WAL with direct I/O (O_DIRECT on
+	// Linux), bypassing the page cache. It requires WALWriteAlignment to be a
+	// multiple of vfs.DirectIOAlignment. If the platform or the filesystem
+	// doesn't support direct I/O, the WAL is written with buffered I/O.
+	WALDirectIO bool
+
 	// TargetByteDeletionRate is the rate (in bytes per second) at which sstable file
 	// deletions are limited to (under normal circumstances).
 	//
@@ -1047,6 +1370,13 @@ type Options struct {
 	// Setting this to 0 disables deletion pacing, which is also the default.
 	TargetByteDeletionRate int
 
+	// WriteAdmission, if set, is consulted before every non-empty batch is
+	// committed, after Options.BatchCommitHook is invoked, and may delay or
+	// reject writes to overloaded key ranges so that they don't starve the
+	// writes to other key ranges. See NewPrefixWriteAdmission for a
+	// WriteAdmissionController limiting the rate of the writes to key prefixes.
+	WriteAdmission WriteAdmissionController
+
 	// private options are only used by internal tests or are used internally
 	// for facilitating upgrade paths of unconfigurable functionality.
 	private struct {
@@ -1067,6 +1397,10 @@ type Options struct {
 		// do not want to allow users to actually configure.
 		disableLazyCombinedIteration bool
 
+		// follower is set by OpenReadOnly, which opens the DB read-only without
+		// acquiring the directory's LOCK.
+		follower *FollowerOptions
+
 		// testingAlwaysWaitForCleanup is set by some tests to force waiting for
 		// obsolete file deletion (to make events deterministic).
 		testingAlwaysWaitForCleanup bool
@@ -1095,6 +1429,35 @@ type WALFailoverOptions struct {
 	wal.FailoverOptions
 }
 
+// AdaptiveMemTableOptions configures the adaptive sizing of MemTables. See
+// Options.AdaptiveMemTable.
+type AdaptiveMemTableOptions struct {
+	// MinSize is the size MemTables shrink to when the flush pressure is low.
+	// The default value is min(Options.MemTableSize, MaxSize).
+	MinSize uint64
+	// MaxSize is the size MemTables grow to when flushes fall behind. A zero
+	// value disables adaptive sizing.
+	MaxSize uint64
+	// TargetWriteAmp is the write amplification above which MemTables grow,
+	// as larger MemTables allow more writes to be coalesced before they are
+	// flushed and more overwritten or deleted keys to be dropped by flushes.
+	// A zero value disables growing on write amplification, leaving only the
+	// flush backlog to drive growth.
+	TargetWriteAmp float64
+}
+
+// EventLogOptions configures the event log. See Options.EventLog.
+type EventLogOptions struct {
+	// Enabled enables the event log.
+	Enabled bool
+	// MaxFileSize is the size at which a file of the event log is rotated.
+	// The default value is 4 MB.
+	MaxFileSize int64
+	// MaxFiles is the number of files of the event log retained, including
+	// the current one. The default value is 4.
+	MaxFiles int
+}
+
 // DebugCheckLevels calls CheckLevels on the provided database.
 // It may be set in the DebugCheck field of Options to check
 // level invariants whenever a new version is installed.
@@ -1199,6 +1562,15 @@ func (o *Options) EnsureDefaults() *Options {
 	if o.MemTableStopWritesThreshold <= 0 {
 		o.MemTableStopWritesThreshold = 2
 	}
+	if o.AdaptiveMemTable.MaxSize > 0 && o.AdaptiveMemTable.MinSize == 0 {
+		o.AdaptiveMemTable.MinSize = min(o.MemTableSize, o.AdaptiveMemTable.MaxSize)
+	}
+	if o.EventLog.MaxFileSize <= 0 {
+		o.EventLog.MaxFileSize = 4 << 20 // 4 MB
+	}
+	if o.EventLog.MaxFiles <= 0 {
+		o.EventLog.MaxFiles = 4
+	}
 	if o.Merger == nil {
 		o.Merger = DefaultMerger
 	}
@@ -1234,6 +1606,9 @@ func (o *Options) EnsureDefaults() *Options {
 	if o.Experimental.ReadCompactionRate == 0 {
 		o.Experimental.ReadCompactionRate = 16000
 	}
+	if o.Experimental.BlobGCAgeCutoff == 0 {
+		o.Experimental.BlobGCAgeCutoff = 0.25
+	}
 	if o.Experimental.ReadSamplingMultiplier == 0 {
 		o.Experimental.ReadSamplingMultiplier = 1 << 4
 	}
@@ -1302,6 +1677,13 @@ func (o *Options) Level(level int) LevelOptions {
 	return l
 }
 
+// createOnShared returns whether the new tables of the specified level are
+// created on shared storage, according to Experimental.CreateOnShared and the
+// placement of the level.
+func (o *Options) createOnShared(level int) bool {
+	return remote.ShouldCreateSharedWithPlacement(o.Experimental.CreateOnShared, o.Level(level).Placement, level)
+}
+
 // Clone creates a shallow-copy of the supplied options.
 func (o *Options) Clone() *Options {
 	n := &Options{}
@@ -1330,6 +1712,10 @@ func (o *Options) String() string {
 	fmt.Fprintf(&buf, "  pebble_version=0.1\n")
 	fmt.Fprintf(&buf, "\n")
 	fmt.Fprintf(&buf, "[Options]\n")
+	if o.Experimental.BlobValueThreshold > 0 {
+		fmt.Fprintf(&buf, "  blob_gc_age_cutoff=%g\n", o.Experimental.BlobGCAgeCutoff)
+		fmt.Fprintf(&buf, "  blob_value_threshold=%d\n", o.Experimental.BlobValueThreshold)
+	}
 	fmt.Fprintf(&buf, "  bytes_per_sync=%d\n", o.BytesPerSync)
 	fmt.Fprintf(&buf, "  cache_size=%d\n", cacheSize)
 	fmt.Fprintf(&buf, "  cleaner=%s\n", o.Cleaner)
@@ -1339,6 +1725,11 @@ func (o *Options) String() string {
 	if o.Experimental.DisableIngestAsFlushable != nil && o.Experimental.DisableIngestAsFlushable() {
 		fmt.Fprintf(&buf, "  disable_ingest_as_flushable=%t\n", true)
 	}
+	if o.EventLog.Enabled {
+		fmt.Fprintf(&buf, "  event_log_enabled=%t\n", o.EventLog.Enabled)
+		fmt.Fprintf(&buf, "  event_log_max_file_size=%d\n", o.EventLog.MaxFileSize)
+		fmt.Fprintf(&buf, "  event_log_max_files=%d\n", o.EventLog.MaxFiles)
+	}
 	fmt.Fprintf(&buf, "  flush_delay_delete_range=%s\n", o.FlushDelayDeleteRange)
 	fmt.Fprintf(&buf, "  flush_delay_range_key=%s\n", o.FlushDelayRangeKey)
 	fmt.Fprintf(&buf, "  flush_split_bytes=%d\n", o.FlushSplitBytes)
@@ -1351,10 +1742,24 @@ func (o *Options) String() string {
 	if o.Experimental.LevelMultiplier != defaultLevelMultiplier {
 		fmt.Fprintf(&buf, "  level_multiplier=%d\n", o.Experimental.LevelMultiplier)
 	}
+	if o.LowDiskSpaceThreshold != 0 {
+		fmt.Fprintf(&buf, "  low_disk_space_threshold=%d\n", o.LowDiskSpaceThreshold)
+	}
 	fmt.Fprintf(&buf, "  max_concurrent_compactions=%d\n", o.MaxConcurrentCompactions())
 	fmt.Fprintf(&buf, "  max_concurrent_downloads=%d\n", o.MaxConcurrentDownloads())
+	if o.MaxManifestAge != 0 {
+		fmt.Fprintf(&buf, "  max_manifest_age=%s\n", o.MaxManifestAge)
+	}
+	if o.MaxManifestEdits != 0 {
+		fmt.Fprintf(&buf, "  max_manifest_edits=%d\n", o.MaxManifestEdits)
+	}
 	fmt.Fprintf(&buf, "  max_manifest_file_size=%d\n", o.MaxManifestFileSize)
 	fmt.Fprintf(&buf, "  max_open_files=%d\n", o.MaxOpenFiles)
+	if o.AdaptiveMemTable.MaxSize > 0 {
+		fmt.Fprintf(&buf, "  mem_table_adaptive_max_size=%d\n", o.AdaptiveMemTable.MaxSize)
+		fmt.Fprintf(&buf, "  mem_table_adaptive_min_size=%d\n", o.AdaptiveMemTable.MinSize)
+		fmt.Fprintf(&buf, "  mem_table_adaptive_target_write_amp=%g\n", o.AdaptiveMemTable.TargetWriteAmp)
+	}
 	fmt.Fprintf(&buf, "  mem_table_size=%d\n", o.MemTableSize)
 	fmt.Fprintf(&buf, "  mem_table_stop_writes_threshold=%d\n", o.MemTableStopWritesThreshold)
 	fmt.Fprintf(&buf, "  min_deletion_rate=%d\n", o.TargetByteDeletionRate)
@@ -1362,15 +1767,50 @@ func (o *Options) String() string {
 	if o.Experimental.MultiLevelCompactionHeuristic != nil {
 		fmt.Fprintf(&buf, "  multilevel_compaction_heuristic=%s\n", o.Experimental.MultiLevelCompactionHeuristic.String())
 	}
+	if o.Experimental.PinnedBlocksMaxBytes != 0 {
+		fmt.Fprintf(&buf, "  pinned_blocks_max_bytes=%d\n", o.Experimental.PinnedBlocksMaxBytes)
+	}
+	if o.Experimental.PinnedBlocksMinLevel != 0 {
+		fmt.Fprintf(&buf, "  pinned_blocks_min_level=%d\n", o.Experimental.PinnedBlocksMinLevel)
+	}
+	if o.PrefixExtractor != nil {
+		fmt.Fprintf(&buf, "  prefix_extractor=%s\n", o.PrefixExtractor.Name)
+	}
 	fmt.Fprintf(&buf, "  read_compaction_rate=%d\n", o.Experimental.ReadCompactionRate)
+	if o.ReadOnlyOnLowDiskSpace {
+		fmt.Fprintf(&buf, "  read_only_on_low_disk_space=%t\n", o.ReadOnlyOnLowDiskSpace)
+	}
 	fmt.Fprintf(&buf, "  read_sampling_multiplier=%d\n", o.Experimental.ReadSamplingMultiplier)
+	if o.RetainHistory != 0 {
+		fmt.Fprintf(&buf, "  retain_history=%s\n", o.RetainHistory)
+	}
 	// We no longer care about strict_wal_tail, but set it to true in case an
 	// older version reads the options.
 	fmt.Fprintf(&buf, "  strict_wal_tail=%t\n", true)
 	fmt.Fprintf(&buf, "  table_cache_shards=%d\n", o.Experimental.TableCacheShards)
+	if o.Experimental.TombstoneDenseCompactionThreshold != 0 {
+		fmt.Fprintf(&buf, "  tombstone_dense_compaction_threshold=%g\n", o.Experimental.TombstoneDenseCompactionThreshold)
+	}
 	fmt.Fprintf(&buf, "  validate_on_ingest=%t\n", o.Experimental.ValidateOnIngest)
 	fmt.Fprintf(&buf, "  wal_dir=%s\n", o.WALDir)
 	fmt.Fprintf(&buf, "  wal_bytes_per_sync=%d\n", o.WALBytesPerSync)
+	if o.WALCompression != DefaultCompression {
+		fmt.Fprintf(&buf, "  wal_compression=%s\n", o.WALCompression)
+	}
+	if o.WALReplayConcurrency != 0 {
+		fmt.Fprintf(&buf, "  wal_replay_concurrency=%d\n", o.WALReplayConcurrency)
+	}
+	if o.WALSyncInterval != 0 {
+		fmt.Fprintf(&buf, "  wal_sync_interval=%s\n", o.WALSyncInterval)
+	}
+	if o.WALMaxSyncLatency != 0 {
+		fmt.Fprintf(&buf, "  wal_max_sync_latency=%s\n", o.WALMaxSyncLatency)
+	}
+	if o.WALWriteAlignment != 0 {
+		fmt.Fprintf(&buf, "  wal_write_alignment=%d\n", o.WALWriteAlignment)
+		fmt.Fprintf(&buf, "  wal_padding=%s\n", o.WALPadding)
+		fmt.Fprintf(&buf, "  wal_direct_io=%t\n", o.WALDirectIO)
+	}
 	fmt.Fprintf(&buf, "  max_writer_concurrency=%d\n", o.Experimental.MaxWriterConcurrency)
 	fmt.Fprintf(&buf, "  force_writer_parallelism=%t\n", o.Experimental.ForceWriterParallelism)
 	fmt.Fprintf(&buf, "  secondary_cache_size_bytes=%d\n", o.Experimental.SecondaryCacheSizeBytes)
@@ -1417,6 +1857,9 @@ func (o *Options) String() string {
 		fmt.Fprintf(&buf, "  filter_type=%s\n", l.FilterType)
 		fmt.Fprintf(&buf, "  index_block_size=%d\n", l.IndexBlockSize)
 		fmt.Fprintf(&buf, "  target_file_size=%d\n", l.TargetFileSize)
+		if l.Placement != remote.PlacementDefault {
+			fmt.Fprintf(&buf, "  placement=%s\n", l.Placement)
+		}
 	}
 
 	return buf.String()
@@ -1479,12 +1922,13 @@ func parseOptions(s string, fn func(section, key, value string) error) error {
 // ParseHooks contains callbacks to create options fields which can have
 // user-defined implementations.
 type ParseHooks struct {
-	NewCache        func(size int64) *Cache
-	NewCleaner      func(name string) (Cleaner, error)
-	NewComparer     func(name string) (*Comparer, error)
-	NewFilterPolicy func(name string) (FilterPolicy, error)
-	NewMerger       func(name string) (*Merger, error)
-	SkipUnknown     func(name, value string) bool
+	NewCache           func(size int64) *Cache
+	NewCleaner         func(name string) (Cleaner, error)
+	NewComparer        func(name string) (*Comparer, error)
+	NewFilterPolicy    func(name string) (FilterPolicy, error)
+	NewMerger          func(name string) (*Merger, error)
+	NewPrefixExtractor func(name string) (*PrefixExtractor, error)
+	SkipUnknown        func(name, value string) bool
 }
 
 // Parse parses the options from the specified string. Note that certain
@@ -1513,6 +1957,10 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 		case section == "Options":
 			var err error
 			switch key {
+			case "blob_gc_age_cutoff":
+				o.Experimental.BlobGCAgeCutoff, err = strconv.ParseFloat(value, 64)
+			case "blob_value_threshold":
+				o.Experimental.BlobValueThreshold, err = strconv.Atoi(value)
 			case "bytes_per_sync":
 				o.BytesPerSync, err = strconv.Atoi(value)
 			case "cache_size":
@@ -1566,6 +2014,12 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				o.private.disableLazyCombinedIteration, err = strconv.ParseBool(value)
 			case "disable_wal":
 				o.DisableWAL, err = strconv.ParseBool(value)
+			case "event_log_enabled":
+				o.EventLog.Enabled, err = strconv.ParseBool(value)
+			case "event_log_max_file_size":
+				o.EventLog.MaxFileSize, err = strconv.ParseInt(value, 10, 64)
+			case "event_log_max_files":
+				o.EventLog.MaxFiles, err = strconv.Atoi(value)
 			case "flush_delay_delete_range":
 				o.FlushDelayDeleteRange, err = time.ParseDuration(value)
 			case "flush_delay_range_key":
@@ -1599,6 +2053,8 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				o.LBaseMaxBytes, err = strconv.ParseInt(value, 10, 64)
 			case "level_multiplier":
 				o.Experimental.LevelMultiplier, err = strconv.Atoi(value)
+			case "low_disk_space_threshold":
+				o.LowDiskSpaceThreshold, err = strconv.ParseUint(value, 10, 64)
 			case "max_concurrent_compactions":
 				var concurrentCompactions int
 				concurrentCompactions, err = strconv.Atoi(value)
@@ -1615,10 +2071,20 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				} else {
 					o.MaxConcurrentDownloads = func() int { return concurrentDownloads }
 				}
+			case "max_manifest_age":
+				o.MaxManifestAge, err = time.ParseDuration(value)
+			case "max_manifest_edits":
+				o.MaxManifestEdits, err = strconv.Atoi(value)
 			case "max_manifest_file_size":
 				o.MaxManifestFileSize, err = strconv.ParseInt(value, 10, 64)
 			case "max_open_files":
 				o.MaxOpenFiles, err = strconv.Atoi(value)
+			case "mem_table_adaptive_max_size":
+				o.AdaptiveMemTable.MaxSize, err = strconv.ParseUint(value, 10, 64)
+			case "mem_table_adaptive_min_size":
+				o.AdaptiveMemTable.MinSize, err = strconv.ParseUint(value, 10, 64)
+			case "mem_table_adaptive_target_write_amp":
+				o.AdaptiveMemTable.TargetWriteAmp, err = strconv.ParseFloat(value, 64)
 			case "mem_table_size":
 				o.MemTableSize, err = strconv.ParseUint(value, 10, 64)
 			case "mem_table_stop_writes_threshold":
@@ -1657,6 +2123,10 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				default:
 					err = errors.Newf("unrecognized multilevel compaction heuristic: %s", value)
 				}
+			case "pinned_blocks_max_bytes":
+				o.Experimental.PinnedBlocksMaxBytes, err = strconv.ParseInt(value, 10, 64)
+			case "pinned_blocks_min_level":
+				o.Experimental.PinnedBlocksMinLevel, err = strconv.Atoi(value)
 			case "point_tombstone_weight":
 				// Do nothing; deprecated.
 			case "strict_wal_tail":
@@ -1676,12 +2146,22 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 						o.Merger, err = hooks.NewMerger(value)
 					}
 				}
+			case "prefix_extractor":
+				if hooks != nil && hooks.NewPrefixExtractor != nil {
+					o.PrefixExtractor, err = hooks.NewPrefixExtractor(value)
+				}
 			case "read_compaction_rate":
 				o.Experimental.ReadCompactionRate, err = strconv.ParseInt(value, 10, 64)
+			case "read_only_on_low_disk_space":
+				o.ReadOnlyOnLowDiskSpace, err = strconv.ParseBool(value)
 			case "read_sampling_multiplier":
 				o.Experimental.ReadSamplingMultiplier, err = strconv.ParseInt(value, 10, 64)
+			case "retain_history":
+				o.RetainHistory, err = time.ParseDuration(value)
 			case "table_cache_shards":
 				o.Experimental.TableCacheShards, err = strconv.Atoi(value)
+			case "tombstone_dense_compaction_threshold":
+				o.Experimental.TombstoneDenseCompactionThreshold, err = strconv.ParseFloat(value, 64)
 			case "table_format":
 				switch value {
 				case "leveldb":
@@ -1697,6 +2177,31 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				o.WALDir = value
 			case "wal_bytes_per_sync":
 				o.WALBytesPerSync, err = strconv.Atoi(value)
+			case "wal_replay_concurrency":
+				o.WALReplayConcurrency, err = strconv.Atoi(value)
+			case "wal_sync_interval":
+				o.WALSyncInterval, err = time.ParseDuration(value)
+			case "wal_max_sync_latency":
+				o.WALMaxSyncLatency, err = time.ParseDuration(value)
+			case "wal_write_alignment":
+				o.WALWriteAlignment, err = strconv.Atoi(value)
+			case "wal_padding":
+				o.WALPadding, err = record.ParsePaddingPolicy(value)
+			case "wal_direct_io":
+				o.WALDirectIO, err = strconv.ParseBool(value)
+			case "wal_compression":
+				switch value {
+				case "Default":
+					o.WALCompression = DefaultCompression
+				case "NoCompression":
+					o.WALCompression = NoCompression
+				case "Snappy":
+					o.WALCompression = SnappyCompression
+				case "ZSTD":
+					o.WALCompression = ZstdCompression
+				default:
+					return errors.Errorf("pebble: unknown compression: %q", errors.Safe(value))
+				}
 			case "max_writer_concurrency":
 				o.Experimental.MaxWriterConcurrency, err = strconv.Atoi(value)
 			case "force_writer_parallelism":
@@ -1803,6 +2308,8 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				l.IndexBlockSize, err = strconv.Atoi(value)
 			case "target_file_size":
 				l.TargetFileSize, err = strconv.ParseInt(value, 10, 64)
+			case "placement":
+				l.Placement, err = remote.ParsePlacement(value)
 			default:
 				if hooks != nil && hooks.SkipUnknown != nil && hooks.SkipUnknown(section+"."+key, value) {
 					return nil
@@ -1890,10 +2397,36 @@ func (o *Options) Validate() error {
 		fmt.Fprintf(&buf, "MemTableSize (%s) must be < %s\n",
 			humanize.Bytes.Uint64(uint64(o.MemTableSize)), humanize.Bytes.Uint64(maxMemTableSize))
 	}
+	if o.RetainHistory < 0 {
+		fmt.Fprintf(&buf, "RetainHistory (%s) must be >= 0\n", o.RetainHistory)
+	}
 	if o.MemTableStopWritesThreshold < 2 {
 		fmt.Fprintf(&buf, "MemTableStopWritesThreshold (%d) must be >= 2\n",
 			o.MemTableStopWritesThreshold)
 	}
+	if l := o.Experimental.PinnedBlocksMinLevel; l < 0 || l >= numLevels {
+		fmt.Fprintf(&buf, "PinnedBlocksMinLevel (%d) must be in [0, %d]\n", l, numLevels-1)
+	}
+	if o.Experimental.PinnedBlocksMaxBytes < 0 {
+		fmt.Fprintf(&buf, "PinnedBlocksMaxBytes (%d) must be >= 0\n", o.Experimental.PinnedBlocksMaxBytes)
+	}
+	if t := o.Experimental.TombstoneDenseCompactionThreshold; t < 0 {
+		fmt.Fprintf(&buf, "TombstoneDenseCompactionThreshold (%g) must be >= 0\n", t)
+	}
+	if a := o.AdaptiveMemTable; a.MaxSize > 0 {
+		if a.MaxSize >= maxMemTableSize {
+			fmt.Fprintf(&buf, "AdaptiveMemTable.MaxSize (%s) must be < %s\n",
+				humanize.Bytes.Uint64(a.MaxSize), humanize.Bytes.Uint64(maxMemTableSize))
+		}
+		if a.MinSize > a.MaxSize {
+			fmt.Fprintf(&buf, "AdaptiveMemTable.MinSize (%s) must be <= AdaptiveMemTable.MaxSize (%s)\n",
+				humanize.Bytes.Uint64(a.MinSize), humanize.Bytes.Uint64(a.MaxSize))
+		}
+		if a.MinSize <= uint64(memTableEmptySize) {
+			fmt.Fprintf(&buf, "AdaptiveMemTable.MinSize (%s) must be > %s\n",
+				humanize.Bytes.Uint64(a.MinSize), humanize.Bytes.Uint64(uint64(memTableEmptySize)))
+		}
+	}
 	if o.FormatMajorVersion < FormatMinSupported || o.FormatMajorVersion > internalFormatNewest {
 		fmt.Fprintf(&buf, "FormatMajorVersion (%d) must be between %d and %d\n",
 			o.FormatMajorVersion, FormatMinSupported, internalFormatNewest)
@@ -1903,6 +2436,33 @@ func (o *Options) Validate() error {
 			o.FormatMajorVersion, FormatMinForSharedObjects)
 
 	}
+	for i := range o.Levels {
+		if o.Levels[i].Placement == remote.PlacementShared && o.Experimental.CreateOnShared == remote.CreateOnSharedNone {
+			fmt.Fprintf(&buf, "Levels[%d].Placement (%s) requires CreateOnShared to be set\n",
+				i, o.Levels[i].Placement)
+		}
+	}
+	if o.WALSyncInterval < 0 {
+		fmt.Fprintf(&buf, "WALSyncInterval (%s) must be >= 0\n", o.WALSyncInterval)
+	}
+	if o.WALMaxSyncLatency < 0 {
+		fmt.Fprintf(&buf, "WALMaxSyncLatency (%s) must be >= 0\n", o.WALMaxSyncLatency)
+	}
+	if a := o.WALWriteAlignment; a != 0 &&
+		(a < record.MinWriteAlignment || a > record.MaxWriteAlignment || a&(a-1) != 0) {
+		fmt.Fprintf(&buf, "WALWriteAlignment (%d) must be a power of two between %d and %d\n",
+			a, record.MinWriteAlignment, record.MaxWriteAlignment)
+	}
+	if o.WALDirectIO && (o.WALWriteAlignment == 0 || o.WALWriteAlignment%vfs.DirectIOAlignment != 0) {
+		fmt.Fprintf(&buf, "WALDirectIO requires WALWriteAlignment (%d) to be a multiple of %d\n",
+			o.WALWriteAlignment, vfs.DirectIOAlignment)
+	}
+	if o.Experimental.BlobGCAgeCutoff > 1 {
+		fmt.Fprintf(&buf, "BlobGCAgeCutoff (%g) must be <= 1\n", o.Experimental.BlobGCAgeCutoff)
+	}
+	if o.PrefixExtractor != nil && (o.PrefixExtractor.Name == "" || o.PrefixExtractor.Extract == nil) {
+		fmt.Fprintf(&buf, "PrefixExtractor must have a Name and an Extract function\n")
+	}
 	if o.TableCache != nil && o.Cache != o.TableCache.cache {
 		fmt.Fprintf(&buf, "underlying cache in the TableCache and the Cache dont match\n")
 	}
@@ -1920,6 +2480,7 @@ func (o *Options) MakeReaderOptions() sstable.ReaderOptions {
 		readerOpts.Cache = o.Cache
 		readerOpts.Comparer = o.Comparer
 		readerOpts.Filters = o.Filters
+		readerOpts.PrefixExtractor = o.PrefixExtractor
 		if o.Merger != nil {
 			readerOpts.Merge = o.Merger.Merge
 			readerOpts.MergerName = o.Merger.Name
@@ -1937,10 +2498,15 @@ func (o *Options) MakeWriterOptions(level int, format sstable.TableFormat) sstab
 	if o != nil {
 		writerOpts.Cache = o.Cache
 		writerOpts.Comparer = o.Comparer
+		writerOpts.PrefixExtractor = o.PrefixExtractor
 		if o.Merger != nil {
 			writerOpts.MergerName = o.Merger.Name
 		}
 		writerOpts.BlockPropertyCollectors = o.BlockPropertyCollectors
+		if o.Experimental.ExpirationFunc != nil {
+			writerOpts.BlockPropertyCollectors = append(slices.Clip(writerOpts.BlockPropertyCollectors),
+				newExpiryCollector(o.Experimental.ExpirationFunc))
+		}
 	}
 	if format >= sstable.TableFormatPebblev3 {
 		writerOpts.ShortAttributeExtractor = o.Experimental.ShortAttributeExtractor
@@ -1960,6 +2526,19 @@ func (o *Options) MakeWriterOptions(level int, format sstable.TableFormat) sstab
 	return writerOpts
 }
 
+// walCompression returns the compression to apply to batches written to the
+// WAL.
+func (o *Options) walCompression() batchrepr.Compression {
+	switch o.WALCompression {
+	case SnappyCompression:
+		return batchrepr.SnappyCompression
+	case ZstdCompression:
+		return batchrepr.ZstdCompression
+	default:
+		return batchrepr.NoCompression
+	}
+}
+
 func resolveDefaultCompression(c Compression) Compression {
 	if c <= DefaultCompression || c >= sstable.NCompression {
 		c = SnappyCompression
@@ -13,6 +13,7 @@ import (
 
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/objstorage/remote"
 	"github.com/cockroachdb/pebble/vfs"
 	"github.com/cockroachdb/pebble/wal"
 	"github.com/stretchr/testify/require"
@@ -229,6 +230,10 @@ func TestOptionsParse(t *testing.T) {
 	testComparer.Name = "test-comparer"
 	testMerger := *DefaultMerger
 	testMerger.Name = "test-merger"
+	testPrefixExtractor := PrefixExtractor{
+		Name:    "test-prefix-extractor",
+		Extract: func(prefix []byte) int { return 2 },
+	}
 	var newCacheSize int64
 
 	hooks := &ParseHooks{
@@ -254,6 +259,12 @@ func TestOptionsParse(t *testing.T) {
 			}
 			return nil, errors.Errorf("unknown merger: %q", name)
 		},
+		NewPrefixExtractor: func(name string) (*PrefixExtractor, error) {
+			if name == testPrefixExtractor.Name {
+				return &testPrefixExtractor, nil
+			}
+			return nil, errors.Errorf("unknown prefix extractor: %q", name)
+		},
 	}
 
 	testCases := []struct {
@@ -271,15 +282,29 @@ func TestOptionsParse(t *testing.T) {
 			opts.Comparer = c.comparer
 			opts.Merger = c.merger
 			opts.WALDir = "wal"
+			opts.WALCompression = ZstdCompression
 			opts.Levels = make([]LevelOptions, 3)
 			opts.Levels[0].BlockSize = 1024
 			opts.Levels[1].BlockSize = 2048
 			opts.Levels[2].BlockSize = 4096
+			opts.Levels[2].Placement = remote.PlacementLocal
 			opts.Experimental.CompactionDebtConcurrency = 100
+			opts.EventLog = EventLogOptions{Enabled: true, MaxFileSize: 1 << 20, MaxFiles: 2}
 			opts.FlushDelayDeleteRange = 10 * time.Second
 			opts.FlushDelayRangeKey = 11 * time.Second
 			opts.Experimental.LevelMultiplier = 5
+			opts.Experimental.PinnedBlocksMinLevel = 6
+			opts.Experimental.PinnedBlocksMaxBytes = 1 << 20
+			opts.LowDiskSpaceThreshold = 1 << 30
+			opts.MaxManifestAge = time.Hour
+			opts.MaxManifestEdits = 1000
+			opts.ReadOnlyOnLowDiskSpace = true
 			opts.TargetByteDeletionRate = 200
+			opts.WALSyncInterval = 2 * time.Millisecond
+			opts.WALMaxSyncLatency = time.Millisecond
+			opts.WALWriteAlignment = 4096
+			opts.WALPadding = WALPadAllRecords
+			opts.WALDirectIO = true
 			opts.WALFailover = &WALFailoverOptions{
 				Secondary: wal.Dir{Dirname: "wal_secondary", FS: vfs.Default},
 			}
@@ -289,6 +314,9 @@ func TestOptionsParse(t *testing.T) {
 			opts.Experimental.MaxWriterConcurrency = 1
 			opts.Experimental.ForceWriterParallelism = true
 			opts.Experimental.SecondaryCacheSizeBytes = 1024
+			opts.Experimental.BlobValueThreshold = 4096
+			opts.Experimental.BlobGCAgeCutoff = 0.5
+			opts.PrefixExtractor = &testPrefixExtractor
 			opts.EnsureDefaults()
 			str := opts.String()
 
@@ -336,6 +364,50 @@ func TestOptionsValidate(t *testing.T) {
 `,
 			`MemTableStopWritesThreshold .* must be >= 2`,
 		},
+		{`
+[Options]
+  mem_table_adaptive_max_size=1048576
+  mem_table_adaptive_min_size=2097152
+`,
+			`AdaptiveMemTable.MinSize \(2\.0MB\) must be <= AdaptiveMemTable.MaxSize \(1\.0MB\)`,
+		},
+		{`
+[Options]
+  pinned_blocks_min_level=7
+`,
+			`PinnedBlocksMinLevel \(7\) must be in \[0, 6\]`,
+		},
+		{`
+[Options]
+  wal_sync_interval=-1ms
+`,
+			`WALSyncInterval \(-1ms\) must be >= 0`,
+		},
+		{`
+[Options]
+  wal_write_alignment=1000
+`,
+			`WALWriteAlignment \(1000\) must be a power of two between 512 and 32768`,
+		},
+		{`
+[Options]
+  wal_write_alignment=1024
+  wal_direct_io=true
+`,
+			`WALDirectIO requires WALWriteAlignment \(1024\) to be a multiple of 4096`,
+		},
+		{`
+[Level "0"]
+  placement=shared
+`,
+			`Levels\[0\].Placement \(shared\) requires CreateOnShared to be set`,
+		},
+		{`
+[Options]
+  blob_gc_age_cutoff=1.5
+`,
+			`BlobGCAgeCutoff \(1\.5\) must be <= 1`,
+		},
 	}
 
 	for _, c := range testCases {
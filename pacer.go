@@ -6,6 +6,7 @@ package pebble
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -44,7 +45,7 @@ type deletionPacer struct {
 		history history
 	}
 
-	targetByteDeletionRate int64
+	targetByteDeletionRate atomic.Int64
 
 	getInfo func() deletionPacerInfo
 }
@@ -67,13 +68,21 @@ func newDeletionPacer(
 		obsoleteBytesMaxRatio:  0.20,
 		obsoleteBytesTimeframe: 5 * time.Minute,
 
-		targetByteDeletionRate: targetByteDeletionRate,
-		getInfo:                getInfo,
+		getInfo: getInfo,
 	}
+	d.targetByteDeletionRate.Store(targetByteDeletionRate)
 	d.mu.history.Init(now, deletePacerHistory)
 	return d
 }
 
+// SetTargetByteDeletionRate sets the rate (in bytes/sec) at which deletes are
+// normally limited. A value of 0 disables pacing.
+//
+// SetTargetByteDeletionRate is thread-safe.
+func (p *deletionPacer) SetTargetByteDeletionRate(targetByteDeletionRate int64) {
+	p.targetByteDeletionRate.Store(targetByteDeletionRate)
+}
+
 // ReportDeletion is used to report a deletion to the pacer. The pacer uses it
 // to keep track of the recent rate of deletions and potentially increase the
 // deletion rate accordingly.
@@ -90,12 +99,13 @@ func (p *deletionPacer) ReportDeletion(now time.Time, bytesToDelete uint64) {
 //
 // PacingDelay is thread-safe.
 func (p *deletionPacer) PacingDelay(now time.Time, bytesToDelete uint64) (waitSeconds float64) {
-	if p.targetByteDeletionRate == 0 {
+	targetByteDeletionRate := p.targetByteDeletionRate.Load()
+	if targetByteDeletionRate == 0 {
 		// Pacing disabled.
 		return 0.0
 	}
 
-	baseRate := float64(p.targetByteDeletionRate)
+	baseRate := float64(targetByteDeletionRate)
 	// If recent deletion rate is more than our target, use that so that we don't
 	// fall behind.
 	historicRate := func() float64 {
@@ -0,0 +1,331 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/wal"
+)
+
+// Prepared batches implement the first phase of a two-phase commit: a batch is
+// prepared by durably writing it to the WAL without applying it, and later
+// either committed, atomically applying its mutations, or rolled back.
+//
+// The WAL records of prepared batches are batches holding LogData entries that
+// are markers of the prepares, commits and rollbacks. A prepare marker holds
+// the representation of the prepared batch, and a commit marker is the first
+// entry of the batch that applies the prepared batch's mutations. Since the
+// markers are LogData, they're never applied to memtables. The markers are
+// replayed when the DB is opened, which reads the WALs with
+// wal.LogicalLog.OpenForReadWithLogData, recovering the batches that were
+// prepared but neither committed nor rolled back.
+//
+// The WAL a prepare marker was written to becomes obsolete once the memtable
+// associated with it is flushed, so whenever a new WAL is created the prepared
+// batches are rewritten to it as a synced record, before any other record
+// (see DB.relogPreparedLocked). A prepared batch is thus held by every WAL that
+// is replayed from the one it was prepared in onwards. If the prepared batches
+// can't be rewritten to a new WAL, the memtable associated with the previous
+// WAL and the later flushables aren't flushed, retaining the WALs that hold the
+// prepared batches, until the prepared batches are rewritten to a later WAL. The markers of the
+// batches through which prepared batches are prepared and resolved are noted
+// when they're written to the WAL, under commitPipeline.mu, so that a WAL's
+// rewritten prepared batches never include a batch resolved by an earlier
+// record, nor omit one prepared by an earlier record.
+
+// preparedMarkerPrefix prefixes the LogData entries that are markers of
+// prepared batches.
+const preparedMarkerPrefix = "pebble.prepared\x00"
+
+type preparedOpKind uint8
+
+const (
+	preparedOpPrepare preparedOpKind = iota + 1
+	preparedOpCommit
+	preparedOpRollback
+)
+
+// preparedOp describes the marker written to the WAL by a batch.
+type preparedOp struct {
+	kind preparedOpKind
+	id   string
+	// repr is the representation of the prepared batch, for prepares.
+	repr []byte
+}
+
+// encodePreparedMarker encodes the marker of a prepared batch operation:
+// preparedMarkerPrefix, the kind, the varint-prefixed id, and the prepared
+// batch's representation for prepares.
+func encodePreparedMarker(op *preparedOp) []byte {
+	buf := make([]byte, 0, len(preparedMarkerPrefix)+1+binary.MaxVarintLen64+len(op.id)+len(op.repr))
+	buf = append(buf, preparedMarkerPrefix...)
+	buf = append(buf, byte(op.kind))
+	buf = binary.AppendUvarint(buf, uint64(len(op.id)))
+	buf = append(buf, op.id...)
+	return append(buf, op.repr...)
+}
+
+// decodePreparedMarker decodes a LogData entry, returning false if it isn't the
+// marker of a prepared batch operation.
+func decodePreparedMarker(data []byte) (op preparedOp, ok bool, err error) {
+	if !bytes.HasPrefix(data, []byte(preparedMarkerPrefix)) {
+		return preparedOp{}, false, nil
+	}
+	data = data[len(preparedMarkerPrefix):]
+	if len(data) == 0 {
+		return preparedOp{}, false, errors.New("pebble: corrupt prepared batch marker")
+	}
+	op.kind = preparedOpKind(data[0])
+	n, l := binary.Uvarint(data[1:])
+	if l <= 0 || uint64(len(data[1+l:])) < n {
+		return preparedOp{}, false, errors.New("pebble: corrupt prepared batch marker")
+	}
+	op.id = string(data[1+l : 1+l+int(n)])
+	switch op.kind {
+	case preparedOpPrepare:
+		op.repr = slices.Clone(data[1+l+int(n):])
+	case preparedOpCommit, preparedOpRollback:
+	default:
+		return preparedOp{}, false, errors.Newf("pebble: unknown prepared batch marker kind %d", errors.Safe(op.kind))
+	}
+	return op, true, nil
+}
+
+// preparedBatches tracks the prepared batches of a DB. It is protected by
+// DB.mu.
+type preparedBatches struct {
+	// batches maps the id of each prepared batch that has been neither
+	// committed nor rolled back to its representation.
+	batches map[string][]byte
+	// pending holds the ids of the batches being prepared, committed or rolled
+	// back.
+	pending map[string]struct{}
+	// retainLogNum is nonzero if the prepared batches couldn't be rewritten to
+	// a WAL when it was created, in which case it's the number of the last WAL
+	// that holds all of them. The flushables with this log number or greater
+	// aren't flushed, so that the WAL doesn't become obsolete.
+	retainLogNum base.DiskFileNum
+	// relogErr is the error of the last failure to rewrite the prepared
+	// batches, while retainLogNum is nonzero.
+	relogErr error
+}
+
+func (p *preparedBatches) init() {
+	p.batches = make(map[string][]byte)
+	p.pending = make(map[string]struct{})
+}
+
+// apply applies the operation, once its marker is written to the WAL.
+func (p *preparedBatches) apply(op *preparedOp) {
+	switch op.kind {
+	case preparedOpPrepare:
+		p.batches[op.id] = op.repr
+	default:
+		delete(p.batches, op.id)
+	}
+}
+
+// Prepare durably writes the batch to the WAL as a prepared batch identified
+// by id, without applying it. The prepared batch's mutations are applied
+// atomically once it's committed by DB.CommitPrepared, or discarded by
+// DB.RollbackPrepared. Prepared batches that are neither committed nor rolled
+// back are recovered when the DB is reopened, and are listed by
+// DB.PreparedBatches.
+//
+// The batch must have been created by a DB, and id must not identify another
+// prepared batch. The batch is not modified by Prepare, and must not be
+// committed: it may be closed or reused once Prepare returns.
+func (b *Batch) Prepare(id []byte) error {
+	if b.db == nil {
+		return errors.New("pebble: cannot prepare a batch that was not created by a DB")
+	}
+	if len(id) == 0 {
+		return errors.New("pebble: prepared batch id must not be empty")
+	}
+	if b.committing {
+		panic("pebble: batch already committing")
+	}
+	if len(b.conditions) > 0 {
+		return errors.New("pebble: cannot prepare a batch with preconditions")
+	}
+	repr := slices.Clone(b.Repr())
+	return b.db.writePreparedOp(&preparedOp{kind: preparedOpPrepare, id: string(id), repr: repr})
+}
+
+// CommitPrepared commits the prepared batch identified by id, atomically and
+// durably applying its mutations. It returns an error satisfying
+// errors.Is(err, ErrNotFound) if there's no such prepared batch, which is the
+// case once it's been committed or rolled back.
+func (d *DB) CommitPrepared(id []byte) error {
+	return d.writePreparedOp(&preparedOp{kind: preparedOpCommit, id: string(id)})
+}
+
+// RollbackPrepared durably discards the prepared batch identified by id. It
+// returns an error satisfying errors.Is(err, ErrNotFound) if there's no such
+// prepared batch.
+func (d *DB) RollbackPrepared(id []byte) error {
+	return d.writePreparedOp(&preparedOp{kind: preparedOpRollback, id: string(id)})
+}
+
+// PreparedBatches returns the ids of the prepared batches that have been
+// neither committed nor rolled back, in sorted order.
+func (d *DB) PreparedBatches() [][]byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ids := make([][]byte, 0, len(d.mu.prepared.batches))
+	for id := range d.mu.prepared.batches {
+		ids = append(ids, []byte(id))
+	}
+	slices.SortFunc(ids, bytes.Compare)
+	return ids
+}
+
+// writePreparedOp durably writes the marker of the operation to the WAL through
+// the commit pipeline, with the prepared batch's mutations for commits.
+func (d *DB) writePreparedOp(op *preparedOp) error {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.opts.ReadOnly {
+		return ErrReadOnly
+	}
+	if d.opts.DisableWAL {
+		return errors.New("pebble: WAL disabled")
+	}
+
+	d.mu.Lock()
+	if _, ok := d.mu.prepared.pending[op.id]; ok {
+		d.mu.Unlock()
+		return errors.Newf("pebble: prepared batch %q is already being prepared or resolved", op.id)
+	}
+	repr, ok := d.mu.prepared.batches[op.id]
+	if op.kind == preparedOpPrepare && ok {
+		d.mu.Unlock()
+		return errors.Newf("pebble: prepared batch %q already exists", op.id)
+	} else if op.kind != preparedOpPrepare && !ok {
+		d.mu.Unlock()
+		return errors.Wrapf(ErrNotFound, "pebble: prepared batch %q", op.id)
+	}
+	d.mu.prepared.pending[op.id] = struct{}{}
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		delete(d.mu.prepared.pending, op.id)
+		d.mu.Unlock()
+	}()
+
+	b := d.NewBatch()
+	defer b.Close()
+	if err := b.LogData(encodePreparedMarker(op), nil); err != nil {
+		return err
+	}
+	if op.kind == preparedOpCommit {
+		var prepared Batch
+		if err := prepared.SetRepr(repr); err != nil {
+			return err
+		}
+		if err := b.Apply(&prepared, nil); err != nil {
+			return err
+		}
+	}
+	b.prepared = op
+	return d.Apply(b, Sync)
+}
+
+// notePreparedOp applies the batch's prepared batch operation, if any, once
+// the batch is written to the WAL. commitPipeline.mu must be held by the
+// caller.
+func (d *DB) notePreparedOp(b *Batch) {
+	if b.prepared == nil {
+		return
+	}
+	d.mu.Lock()
+	d.mu.prepared.apply(b.prepared)
+	d.mu.Unlock()
+}
+
+// replayPreparedMarkersLocked applies the markers of the prepared batch
+// operations held by a batch read from the WAL. DB.mu must be held by the
+// caller.
+func (d *DB) replayPreparedMarkersLocked(b *Batch) error {
+	for r := b.Reader(); ; {
+		kind, data, _, ok, err := r.Next()
+		if !ok {
+			return err
+		}
+		if kind != InternalKeyKindLogData {
+			continue
+		}
+		op, ok, err := decodePreparedMarker(data)
+		if err != nil {
+			return err
+		}
+		if ok {
+			d.mu.prepared.apply(&op)
+		}
+	}
+}
+
+// relogPreparedLocked rewrites the prepared batches to the current WAL, which
+// must have just been created, as a synced record with the given sequence
+// number, returning the error of the write or sync of the record. Both DB.mu
+// and commitPipeline.mu must be held by the caller. Note that DB.mu is
+// released while waiting for the record to be synced.
+func (d *DB) relogPreparedLocked(seqNum uint64) error {
+	if len(d.mu.prepared.batches) == 0 {
+		return nil
+	}
+	var b Batch
+	for id, repr := range d.mu.prepared.batches {
+		_ = b.LogData(encodePreparedMarker(&preparedOp{kind: preparedOpPrepare, id: id, repr: repr}), nil)
+	}
+	b.setSeqNum(seqNum)
+
+	// The writer is read while DB.mu is held. It's only replaced by WAL
+	// rotations, which require commitPipeline.mu, held by the caller.
+	writer := d.mu.log.writer
+	d.mu.Unlock()
+	defer d.mu.Lock()
+	var syncWG sync.WaitGroup
+	var syncErr error
+	syncWG.Add(1)
+	// Like commitPipeline.directWrite, reserve a slot in the WAL's sync queue.
+	d.commit.logSyncQSem <- struct{}{}
+	if _, err := writer.WriteRecord(b.Repr(), wal.SyncOptions{Done: &syncWG, Err: &syncErr}, nil /* ref */); err != nil {
+		return err
+	}
+	syncWG.Wait()
+	return syncErr
+}
+
+// notePreparedRelogLocked records the result of rewriting the prepared batches
+// to a new WAL by relogPreparedLocked. A failure retains the previous WAL, of
+// the given log number, unless an earlier WAL is already retained. DB.mu must
+// be held by the caller.
+func (d *DB) notePreparedRelogLocked(err error, logNum base.DiskFileNum) {
+	if err == nil {
+		d.mu.prepared.retainLogNum = 0
+		d.mu.prepared.relogErr = nil
+		return
+	}
+	if d.mu.prepared.retainLogNum == 0 {
+		d.mu.prepared.retainLogNum = logNum
+		d.opts.Logger.Errorf("pebble: failed to rewrite the prepared batches to the WAL, retaining WAL %s: %v", logNum, err)
+	}
+	d.mu.prepared.relogErr = err
+}
+
+// retainedForPreparedLocked returns true if the flushable must not be flushed,
+// as it would make obsolete a WAL retained because it holds prepared batches.
+// DB.mu must be held by the caller.
+func (d *DB) retainedForPreparedLocked(f *flushableEntry) bool {
+	return d.mu.prepared.retainLogNum != 0 && f.logNum >= d.mu.prepared.retainLogNum
+}
@@ -0,0 +1,207 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/cockroachdb/pebble/vfs/errorfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreparedMarkerEncoding(t *testing.T) {
+	for _, op := range []preparedOp{
+		{kind: preparedOpPrepare, id: "a", repr: []byte("repr")},
+		{kind: preparedOpPrepare, id: "b", repr: []byte{}},
+		{kind: preparedOpCommit, id: "c"},
+		{kind: preparedOpRollback, id: "d"},
+	} {
+		buf := encodePreparedMarker(&op)
+		decoded, ok, err := decodePreparedMarker(buf)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, op, decoded)
+
+		_, _, err = decodePreparedMarker(buf[:len(preparedMarkerPrefix)+2])
+		if len(op.id) > 0 {
+			require.Error(t, err)
+		}
+	}
+	_, ok, err := decodePreparedMarker([]byte("log data"))
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestPreparedBatches(t *testing.T) {
+	fs := vfs.NewStrictMem()
+	opts := &Options{FS: fs}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+
+	get := func(key string) string {
+		v, closer, err := d.Get([]byte(key))
+		if errors.Is(err, ErrNotFound) {
+			return ""
+		}
+		require.NoError(t, err)
+		defer closer.Close()
+		return string(v)
+	}
+	prepare := func(id string, kvs ...string) {
+		b := d.NewBatch()
+		for i := 0; i < len(kvs); i += 2 {
+			require.NoError(t, b.Set([]byte(kvs[i]), []byte(kvs[i+1]), nil))
+		}
+		require.NoError(t, b.Prepare([]byte(id)))
+		require.NoError(t, b.Close())
+	}
+	prepared := func() string {
+		return fmt.Sprintf("%q", d.PreparedBatches())
+	}
+
+	prepare("t1", "a", "1", "b", "1")
+	prepare("t2", "c", "2")
+	prepare("t3", "d", "3")
+	require.Equal(t, `["t1" "t2" "t3"]`, prepared())
+	require.Equal(t, "", get("a"))
+
+	// Ids are unique, and only prepared batches can be resolved.
+	b := d.NewBatch()
+	require.Error(t, b.Prepare([]byte("t1")))
+	require.NoError(t, b.Close())
+	require.True(t, errors.Is(d.CommitPrepared([]byte("t4")), ErrNotFound))
+	require.True(t, errors.Is(d.RollbackPrepared([]byte("t4")), ErrNotFound))
+
+	require.NoError(t, d.CommitPrepared([]byte("t1")))
+	require.Equal(t, "1", get("a"))
+	require.Equal(t, "1", get("b"))
+	require.True(t, errors.Is(d.CommitPrepared([]byte("t1")), ErrNotFound))
+	require.NoError(t, d.RollbackPrepared([]byte("t3")))
+	require.Equal(t, `["t2"]`, prepared())
+
+	// Prepared batches outlive the WALs they were written to, and survive a
+	// crash.
+	for i := 0; i < 3; i++ {
+		require.NoError(t, d.Set([]byte("e"), []byte(fmt.Sprint(i)), nil))
+		require.NoError(t, d.Flush())
+	}
+	prepare("t5", "f", "5")
+	fs.SetIgnoreSyncs(true)
+	require.NoError(t, d.Close())
+	fs.ResetToSyncedState()
+	fs.SetIgnoreSyncs(false)
+
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	require.Equal(t, `["t2" "t5"]`, prepared())
+	require.Equal(t, "1", get("a"))
+	require.Equal(t, "", get("d"))
+	require.NoError(t, d.CommitPrepared([]byte("t2")))
+	require.Equal(t, "2", get("c"))
+	require.Equal(t, `["t5"]`, prepared())
+
+	// The prepared batches recovered by a previous open are rewritten to the
+	// WAL it created.
+	require.NoError(t, d.Close())
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	require.Equal(t, `["t5"]`, prepared())
+	require.Equal(t, "2", get("c"))
+	require.NoError(t, d.RollbackPrepared([]byte("t5")))
+	require.NoError(t, d.Close())
+
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	require.Equal(t, `[]`, prepared())
+	require.Equal(t, "", get("f"))
+	require.NoError(t, d.Close())
+}
+
+func TestPreparedBatchesRelogError(t *testing.T) {
+	// The syncs of the WALs created after failNewWALSyncs is called fail, until
+	// it's called with false.
+	mem := vfs.NewStrictMem()
+	var existingWALs atomic.Pointer[[]string]
+	failNewWALSyncs := func(fail bool) {
+		if !fail {
+			existingWALs.Store(nil)
+			return
+		}
+		ls, err := mem.List("")
+		require.NoError(t, err)
+		existingWALs.Store(&ls)
+	}
+	fs := errorfs.Wrap(mem, errorfs.InjectorFunc(func(op errorfs.Op) error {
+		switch op.Kind {
+		case errorfs.OpFileSync, errorfs.OpFileSyncData, errorfs.OpFileSyncTo:
+			existing := existingWALs.Load()
+			if filepath.Ext(op.Path) == ".log" && existing != nil && !slices.Contains(*existing, op.Path) {
+				return errorfs.ErrInjected
+			}
+		}
+		return nil
+	}))
+	opts := &Options{FS: fs}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	prepared := func() string {
+		return fmt.Sprintf("%q", d.PreparedBatches())
+	}
+
+	b := d.NewBatch()
+	require.NoError(t, b.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, b.Prepare([]byte("t1")))
+	require.NoError(t, b.Close())
+
+	// The prepared batches are rewritten to the WAL created by the rotation of
+	// the memtable, and the failure to sync them is returned. The memtable of
+	// the previous WAL, which holds the prepared batch, isn't flushed, and
+	// neither are the later memtables.
+	failNewWALSyncs(true)
+	require.True(t, errors.Is(d.Flush(), errorfs.ErrInjected))
+	require.NoError(t, d.Set([]byte("b"), []byte("2"), NoSync))
+	d.mu.Lock()
+	d.maybeScheduleFlush()
+	for d.mu.compact.flushing {
+		d.mu.compact.cond.Wait()
+	}
+	require.Len(t, d.mu.mem.queue, 2)
+	d.mu.Unlock()
+
+	// The prepared batch survives a crash. Closing the WAL that failed to sync
+	// fails.
+	failNewWALSyncs(false)
+	mem.SetIgnoreSyncs(true)
+	require.True(t, errors.Is(d.Close(), errorfs.ErrInjected))
+	mem.ResetToSyncedState()
+	mem.SetIgnoreSyncs(false)
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	require.Equal(t, `["t1"]`, prepared())
+
+	// Once the prepared batches are rewritten to a new WAL, the memtables are
+	// flushed.
+	require.NoError(t, d.Flush())
+	d.mu.Lock()
+	require.Len(t, d.mu.mem.queue, 1)
+	d.mu.Unlock()
+	require.NoError(t, d.Close())
+
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	require.Equal(t, `["t1"]`, prepared())
+	require.NoError(t, d.CommitPrepared([]byte("t1")))
+	v, closer, err := d.Get([]byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, "1", string(v))
+	require.NoError(t, closer.Close())
+	require.NoError(t, d.Close())
+}
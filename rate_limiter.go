@@ -0,0 +1,190 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cockroachdb/pebble/objstorage"
+	"github.com/cockroachdb/tokenbucket"
+)
+
+// RateLimiter limits the bandwidth of a DB's I/O. A RateLimiter may be shared
+// by multiple DBs, coordinating their use of a common disk. See
+// Options.RateLimiter and NewRateLimiter.
+type RateLimiter interface {
+	// Wait is invoked before n bytes of I/O of the given class are read or
+	// written, and blocks until the I/O may proceed. It's invoked concurrently
+	// by flushes, compactions and the WAL, and must not call into the DB.
+	Wait(class RateLimitClass, n int)
+}
+
+// RateLimitClass identifies the class of I/O submitted to a RateLimiter.
+type RateLimitClass int8
+
+const (
+	// RateLimitCompactionRead is the reading of the input sstables of
+	// compactions.
+	RateLimitCompactionRead RateLimitClass = iota
+	// RateLimitCompactionWrite is the writing of the output sstables and blob
+	// files of compactions.
+	RateLimitCompactionWrite
+	// RateLimitFlushWrite is the writing of the output sstables and blob files
+	// of flushes.
+	RateLimitFlushWrite
+	// RateLimitWALWrite is the writing of the WAL. It's only submitted to the
+	// RateLimiter if Options.RateLimitWAL is set.
+	RateLimitWALWrite
+	// NumRateLimitClasses is the number of classes of I/O.
+	NumRateLimitClasses
+)
+
+// String implements fmt.Stringer.
+func (c RateLimitClass) String() string {
+	switch c {
+	case RateLimitCompactionRead:
+		return "compaction-read"
+	case RateLimitCompactionWrite:
+		return "compaction-write"
+	case RateLimitFlushWrite:
+		return "flush-write"
+	case RateLimitWALWrite:
+		return "wal-write"
+	default:
+		return "unknown"
+	}
+}
+
+// TokenBucketRateLimiter is a RateLimiter limiting the total bandwidth of all
+// classes of I/O to a rate which may be adjusted while it's in use.
+type TokenBucketRateLimiter struct {
+	mu struct {
+		sync.Mutex
+		tb             tokenbucket.TokenBucket
+		bytesPerSecond int64
+	}
+}
+
+var _ RateLimiter = (*TokenBucketRateLimiter)(nil)
+
+// NewRateLimiter returns a TokenBucketRateLimiter limiting the bandwidth of the
+// I/O of all classes to bytesPerSecond, allowing bursts of up to a second
+// worth of I/O.
+func NewRateLimiter(bytesPerSecond int64) *TokenBucketRateLimiter {
+	l := &TokenBucketRateLimiter{}
+	l.mu.tb.Init(tokenbucket.TokensPerSecond(bytesPerSecond), tokenbucket.Tokens(bytesPerSecond))
+	l.mu.bytesPerSecond = bytesPerSecond
+	return l
+}
+
+// Wait implements RateLimiter. If n is more than a second worth of I/O, the
+// token bucket goes into debt, delaying future I/O.
+func (l *TokenBucketRateLimiter) Wait(_ RateLimitClass, n int) {
+	// maxWait bounds the time between attempts, so that an increase of the
+	// rate takes effect promptly.
+	const maxWait = 100 * time.Millisecond
+	for {
+		l.mu.Lock()
+		fulfilled, tryAgainAfter := l.mu.tb.TryToFulfill(tokenbucket.Tokens(n))
+		l.mu.Unlock()
+		if fulfilled {
+			return
+		}
+		time.Sleep(min(tryAgainAfter, maxWait))
+	}
+}
+
+// BytesPerSecond returns the current rate limit.
+func (l *TokenBucketRateLimiter) BytesPerSecond() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.mu.bytesPerSecond
+}
+
+// SetBytesPerSecond updates the rate limit, including for I/O that's already
+// waiting.
+func (l *TokenBucketRateLimiter) SetBytesPerSecond(bytesPerSecond int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.mu.tb.UpdateConfig(tokenbucket.TokensPerSecond(bytesPerSecond), tokenbucket.Tokens(bytesPerSecond))
+	l.mu.bytesPerSecond = bytesPerSecond
+}
+
+// RateLimitMetrics holds the metrics of the I/O of a class submitted to
+// Options.RateLimiter.
+type RateLimitMetrics struct {
+	// Bytes is the number of bytes of I/O submitted to the rate limiter.
+	Bytes uint64
+	// WaitDuration is the cumulative time spent waiting on the rate limiter.
+	WaitDuration time.Duration
+}
+
+// compactionReadRateLimitBytes is the granularity at which the bytes read by
+// compactions are submitted to Options.RateLimiter.
+const compactionReadRateLimitBytes = 64 << 10
+
+// dbRateLimiter submits the I/O of a DB to Options.RateLimiter, recording the
+// per-class metrics.
+type dbRateLimiter struct {
+	limiter RateLimiter
+	classes [NumRateLimitClasses]struct {
+		bytes        atomic.Uint64
+		waitDuration atomic.Int64
+	}
+}
+
+// wait waits on the rate limiter for n bytes of I/O of the class. The receiver
+// may be nil, in which case wait is a noop.
+func (l *dbRateLimiter) wait(class RateLimitClass, n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+	start := time.Now()
+	l.limiter.Wait(class, n)
+	c := &l.classes[class]
+	c.bytes.Add(uint64(n))
+	c.waitDuration.Add(int64(time.Since(start)))
+}
+
+func (l *dbRateLimiter) metrics() (m [NumRateLimitClasses]RateLimitMetrics) {
+	if l == nil {
+		return m
+	}
+	for i := range l.classes {
+		m[i].Bytes = l.classes[i].bytes.Load()
+		m[i].WaitDuration = time.Duration(l.classes[i].waitDuration.Load())
+	}
+	return m
+}
+
+// rateLimitedWritable is an objstorage.Writable whose writes wait on the rate
+// limiter.
+type rateLimitedWritable struct {
+	objstorage.Writable
+
+	limiter *dbRateLimiter
+	class   RateLimitClass
+}
+
+// Write is part of the objstorage.Writable interface.
+func (w *rateLimitedWritable) Write(p []byte) error {
+	w.limiter.wait(w.class, len(p))
+	return w.Writable.Write(p)
+}
+
+// rateLimitWritable wraps the writable of an output of the compaction so that
+// its writes wait on Options.RateLimiter, if set.
+func (d *DB) rateLimitWritable(c *compaction, w objstorage.Writable) objstorage.Writable {
+	if d.rateLimiter == nil {
+		return w
+	}
+	class := RateLimitCompactionWrite
+	if c.kind == compactionKindFlush {
+		class = RateLimitFlushWrite
+	}
+	return &rateLimitedWritable{Writable: w, limiter: d.rateLimiter, class: class}
+}
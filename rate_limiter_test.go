@@ -0,0 +1,80 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingRateLimiter struct {
+	mu    sync.Mutex
+	bytes [NumRateLimitClasses]uint64
+}
+
+func (l *recordingRateLimiter) Wait(class RateLimitClass, n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.bytes[class] += uint64(n)
+}
+
+func TestRateLimiter(t *testing.T) {
+	for _, rateLimitWAL := range []bool{false, true} {
+		t.Run(fmt.Sprintf("wal=%t", rateLimitWAL), func(t *testing.T) {
+			l := &recordingRateLimiter{}
+			opts := &Options{
+				FS:                          vfs.NewMem(),
+				DisableAutomaticCompactions: true,
+				RateLimiter:                 l,
+				RateLimitWAL:                rateLimitWAL,
+			}
+			d, err := Open("", opts)
+			require.NoError(t, err)
+
+			rng := rand.New(rand.NewSource(1))
+			value := make([]byte, 1024)
+			for i := 0; i < 2; i++ {
+				for j := 0; j < 200; j++ {
+					rng.Read(value)
+					require.NoError(t, d.Set([]byte(fmt.Sprintf("%03d", j)), value, nil))
+				}
+				require.NoError(t, d.Flush())
+			}
+			require.NoError(t, d.Compact([]byte("000"), []byte("999"), false))
+
+			m := d.Metrics()
+			require.NoError(t, d.Close())
+			for class := RateLimitClass(0); class < NumRateLimitClasses; class++ {
+				if class == RateLimitWALWrite && !rateLimitWAL {
+					require.Zero(t, l.bytes[class], "%s", class)
+				} else {
+					require.NotZero(t, l.bytes[class], "%s", class)
+				}
+			}
+			// The WAL is written to until the DB is closed, so its metrics may
+			// lag.
+			for class := RateLimitClass(0); class < RateLimitWALWrite; class++ {
+				require.Equal(t, l.bytes[class], m.RateLimit[class].Bytes, "%s", class)
+			}
+			// The writes of the flushes and compaction are their output sstables.
+			require.Equal(t, m.Levels[0].BytesFlushed, l.bytes[RateLimitFlushWrite])
+			require.Equal(t, m.Levels[numLevels-1].BytesCompacted, l.bytes[RateLimitCompactionWrite])
+		})
+	}
+}
+
+func TestTokenBucketRateLimiter(t *testing.T) {
+	l := NewRateLimiter(1 << 30)
+	require.Equal(t, int64(1<<30), l.BytesPerSecond())
+	l.Wait(RateLimitFlushWrite, 1<<20)
+	l.SetBytesPerSecond(1 << 20)
+	require.Equal(t, int64(1<<20), l.BytesPerSecond())
+	l.Wait(RateLimitCompactionRead, 1<<10)
+}
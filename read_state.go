@@ -100,6 +100,9 @@ func (d *DB) updateReadStateLocked(checker func(*DB) error) {
 			d.opts.Logger.Fatalf("checker failed with error: %s", err)
 		}
 	}
+	if old == nil || old.current != s.current {
+		d.requestPinnedBlocksUpdateLocked()
+	}
 	if old != nil {
 		old.unrefLocked()
 	}
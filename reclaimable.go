@@ -0,0 +1,216 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"slices"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/invariants"
+)
+
+// EstimateReclaimableBytes returns an estimate of the disk space used by data
+// in the range [start, end] that is deleted by range tombstones, and is thus
+// reclaimed once compactions drop it. EstimateDiskUsage includes such data
+// until it's compacted, so after large range deletions, subtracting the
+// reclaimable bytes from the disk usage better estimates the space used by
+// live data.
+//
+// The estimate is computed as follows:
+//
+//   - The range tombstones overlapping the range are read from the sstables
+//     whose properties indicate they hold range deletions. Range tombstones in
+//     memtables are not considered.
+//   - The data of an sstable is deleted by a range tombstone if all of the
+//     sstable's keys are older than the tombstone and there is no open snapshot
+//     from which the sstable's keys are visible but the tombstone is not.
+//   - For sstables whose overlap with the range is wholly covered by such
+//     tombstones, the whole file size is included. Otherwise, the sizes of the
+//     data blocks overlapping the covered portions of the range are included,
+//     as in EstimateDiskUsage.
+//
+// Point deletions are not considered, and neither is deleted data held by the
+// same sstable as the range tombstone deleting it.
+func (d *DB) EstimateReclaimableBytes(start, end []byte) (uint64, error) {
+	bytes, _, _, err := d.EstimateReclaimableBytesByBackingType(start, end)
+	return bytes, err
+}
+
+// EstimateReclaimableBytesByBackingType is like EstimateReclaimableBytes but
+// additionally returns the subsets of that size in remote and external files.
+func (d *DB) EstimateReclaimableBytesByBackingType(
+	start, end []byte,
+) (totalSize, remoteSize, externalSize uint64, _ error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	cmp := d.opts.Comparer.Compare
+	if cmp(start, end) > 0 {
+		return 0, 0, 0, errors.New("invalid key-range specified (start > end)")
+	}
+
+	// Grab and reference the current readState. This prevents the underlying
+	// files in the associated version from being deleted if there is a concurrent
+	// compaction.
+	readState := d.loadReadState()
+	defer readState.unref()
+	d.mu.Lock()
+	snapshots := d.mu.snapshots.toSlice()
+	historyHorizon := d.mu.history.horizon
+	d.mu.Unlock()
+
+	bounds := base.UserKeyBoundsInclusive(start, end)
+	tombstones, err := d.loadReclaimingTombstones(readState.current, bounds)
+	if err != nil || len(tombstones) == 0 {
+		return 0, 0, 0, err
+	}
+
+	var u diskUsageByBackingType
+	var covered []base.UserKeyBounds
+	for level := range readState.current.Levels {
+		overlaps := readState.current.Overlaps(level, bounds)
+		iter := overlaps.Iter()
+		for file := iter.First(); file != nil; file = iter.Next() {
+			fileBounds := file.UserKeyBounds()
+			if !fileBounds.Overlaps(cmp, &bounds) {
+				// At L0, Overlaps may return files outside the range.
+				continue
+			}
+			// Collect the portions of the range and the file covered by the
+			// tombstones deleting the file's keys.
+			fi, _ := historySnapshotIndex(file.SmallestSeqNum, snapshots, historyHorizon)
+			covered = covered[:0]
+			for i := range tombstones {
+				t := &tombstones[i]
+				if t.seqNum <= file.LargestSeqNum {
+					continue
+				}
+				if ti, _ := historySnapshotIndex(t.seqNum, snapshots, historyHorizon); ti != fi {
+					continue
+				}
+				if b, ok := intersectUserKeyBounds(cmp, t.bounds, bounds); ok {
+					if b, ok = intersectUserKeyBounds(cmp, b, fileBounds); ok {
+						covered = append(covered, b)
+					}
+				}
+			}
+			for _, b := range mergeUserKeyBounds(cmp, covered) {
+				size := file.Size
+				if !b.ContainsBounds(cmp, &fileBounds) {
+					if size, err = d.tableCache.estimateSize(file, b.Start, b.End.Key); err != nil {
+						return 0, 0, 0, err
+					}
+				}
+				if err := u.add(d, file, size); err != nil {
+					return 0, 0, 0, err
+				}
+			}
+		}
+	}
+	return u.total, u.remote, u.external, nil
+}
+
+// reclaimingTombstone is a range tombstone read by
+// EstimateReclaimableBytesByBackingType.
+type reclaimingTombstone struct {
+	bounds base.UserKeyBounds
+	// seqNum is the largest sequence number of the tombstones of the span.
+	seqNum uint64
+}
+
+// loadReclaimingTombstones reads the range tombstones of the version's
+// sstables that overlap the bounds.
+func (d *DB) loadReclaimingTombstones(
+	v *version, bounds base.UserKeyBounds,
+) ([]reclaimingTombstone, error) {
+	var tombstones []reclaimingTombstone
+	for level := range v.Levels {
+		overlaps := v.Overlaps(level, bounds)
+		iter := overlaps.Iter()
+		for file := iter.First(); file != nil; file = iter.Next() {
+			if !file.HasPointKeys {
+				continue
+			}
+			props, err := d.tableCache.getTableProperties(file)
+			if err != nil {
+				return nil, err
+			}
+			if props.NumRangeDeletions == 0 {
+				continue
+			}
+			iters, err := d.newIters(
+				context.Background(), file, nil /* iterOpts */, internalIterOpts{}, iterRangeDeletions)
+			if err != nil {
+				return nil, err
+			}
+			rangeDelIter := iters.RangeDeletion()
+			if rangeDelIter == nil {
+				continue
+			}
+			s, err := rangeDelIter.SeekGE(bounds.Start)
+			for ; s != nil && bounds.End.IsUpperBoundFor(d.cmp, s.Start); s, err = rangeDelIter.Next() {
+				if s.Empty() {
+					continue
+				}
+				tombstones = append(tombstones, reclaimingTombstone{
+					bounds: base.UserKeyBoundsEndExclusive(slices.Clone(s.Start), slices.Clone(s.End)),
+					seqNum: s.LargestSeqNum(),
+				})
+			}
+			rangeDelIter.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return tombstones, nil
+}
+
+// intersectUserKeyBounds returns the intersection of the bounds, returning
+// false if they don't overlap.
+func intersectUserKeyBounds(cmp base.Compare, a, b base.UserKeyBounds) (base.UserKeyBounds, bool) {
+	if !a.Overlaps(cmp, &b) {
+		return base.UserKeyBounds{}, false
+	}
+	if cmp(a.Start, b.Start) < 0 {
+		a.Start = b.Start
+	}
+	if c := cmp(a.End.Key, b.End.Key); c > 0 || (c == 0 && b.End.Kind == base.Exclusive) {
+		a.End = b.End
+	}
+	return a, true
+}
+
+// mergeUserKeyBounds merges the overlapping and abutting bounds, returning
+// disjoint bounds. The bounds are sorted in place.
+func mergeUserKeyBounds(cmp base.Compare, bounds []base.UserKeyBounds) []base.UserKeyBounds {
+	if len(bounds) <= 1 {
+		return bounds
+	}
+	slices.SortFunc(bounds, func(a, b base.UserKeyBounds) int {
+		return cmp(a.Start, b.Start)
+	})
+	merged := bounds[:1]
+	for _, b := range bounds[1:] {
+		last := &merged[len(merged)-1]
+		if cmp(b.Start, last.End.Key) > 0 {
+			merged = append(merged, b)
+			continue
+		}
+		if c := cmp(b.End.Key, last.End.Key); c > 0 || (c == 0 && b.End.Kind == base.Inclusive) {
+			last.End = b.End
+		}
+	}
+	if invariants.Enabled {
+		for i := 1; i < len(merged); i++ {
+			if merged[i-1].Overlaps(cmp, &merged[i]) {
+				panic(errors.AssertionFailedf("merged bounds %s and %s overlap", merged[i-1], merged[i]))
+			}
+		}
+	}
+	return merged
+}
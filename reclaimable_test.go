@@ -0,0 +1,109 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateReclaimableBytes(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	key := func(i int) []byte { return []byte(fmt.Sprintf("%04d", i)) }
+	value := make([]byte, 512)
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, d.Set(key(i), value, nil))
+	}
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Compact(key(0), key(1000), false /* parallelize */))
+
+	// There are no range tombstones.
+	estimate, err := d.EstimateReclaimableBytes(key(0), key(1000))
+	require.NoError(t, err)
+	require.Zero(t, estimate)
+
+	// Take a snapshot, from which the data deleted by the range tombstone is
+	// visible.
+	snap := d.NewSnapshot()
+	require.NoError(t, d.DeleteRange(key(200), key(600), nil))
+	require.NoError(t, d.Flush())
+	estimate, err = d.EstimateReclaimableBytes(key(0), key(1000))
+	require.NoError(t, err)
+	require.Zero(t, estimate)
+	require.NoError(t, snap.Close())
+
+	total, err := d.EstimateDiskUsage(key(0), key(1000))
+	require.NoError(t, err)
+	estimate, err = d.EstimateReclaimableBytes(key(0), key(1000))
+	require.NoError(t, err)
+	// Roughly 40% of the data is deleted, which is estimated at the
+	// granularity of data blocks.
+	require.Greater(t, estimate, total*3/10)
+	require.Less(t, estimate, total/2)
+
+	// Overlapping range tombstones don't inflate the estimate.
+	require.NoError(t, d.DeleteRange(key(300), key(500), nil))
+	require.NoError(t, d.Flush())
+	overlapping, err := d.EstimateReclaimableBytes(key(0), key(1000))
+	require.NoError(t, err)
+	require.InDelta(t, estimate, overlapping, float64(estimate)/20)
+
+	// The estimate is restricted to the range.
+	within, err := d.EstimateReclaimableBytes(key(0), key(400))
+	require.NoError(t, err)
+	require.Less(t, within, estimate*3/4)
+	outside, err := d.EstimateReclaimableBytes(key(700), key(1000))
+	require.NoError(t, err)
+	require.Zero(t, outside)
+
+	// Once the deleted data is compacted, nothing remains to be reclaimed, and
+	// the disk usage is reduced by about the reclaimed bytes.
+	require.NoError(t, d.Compact(key(0), key(1000), false /* parallelize */))
+	estimate, err = d.EstimateReclaimableBytes(key(0), key(1000))
+	require.NoError(t, err)
+	require.Zero(t, estimate)
+	compacted, err := d.EstimateDiskUsage(key(0), key(1000))
+	require.NoError(t, err)
+	require.InDelta(t, total-overlapping, compacted, float64(total)/10)
+
+	_, err = d.EstimateReclaimableBytes(key(1), key(0))
+	require.Error(t, err)
+}
+
+func TestMergeUserKeyBounds(t *testing.T) {
+	cmp := base.DefaultComparer.Compare
+	b := func(start, end string, exclusive bool) base.UserKeyBounds {
+		return base.UserKeyBoundsEndExclusiveIf([]byte(start), []byte(end), exclusive)
+	}
+	merged := mergeUserKeyBounds(cmp, []base.UserKeyBounds{
+		b("m", "p", true),
+		b("a", "c", true),
+		b("c", "e", false),
+		b("b", "d", true),
+		b("g", "h", true),
+		b("n", "o", false),
+	})
+	require.Equal(t, []base.UserKeyBounds{
+		b("a", "e", false),
+		b("g", "h", true),
+		b("m", "p", true),
+	}, merged)
+
+	i, ok := intersectUserKeyBounds(cmp, b("a", "e", true), b("c", "e", false))
+	require.True(t, ok)
+	require.Equal(t, b("c", "e", true), i)
+	_, ok = intersectUserKeyBounds(cmp, b("a", "c", true), b("c", "e", false))
+	require.False(t, ok)
+}
@@ -7,6 +7,7 @@ package record
 import (
 	"context"
 	"encoding/binary"
+	"fmt"
 	"io"
 	"runtime/pprof"
 	"sync"
@@ -420,6 +421,12 @@ type LogWriter struct {
 	c io.Closer
 	// s is w as a syncer.
 	s syncer
+	// writeRateLimit is LogWriterConfig.WriteRateLimit.
+	writeRateLimit func(n int)
+	// writeAlignment and padding are LogWriterConfig.WriteAlignment and
+	// LogWriterConfig.Padding.
+	writeAlignment int32
+	padding        PaddingPolicy
 	// logNum is the low 32-bits of the log's file number.
 	logNum uint32
 	// blockNum is the zero based block number for the current block.
@@ -459,6 +466,24 @@ type LogWriter struct {
 		// be held.
 		pendingSyncs pendingSyncs
 		metrics      *LogWriterMetrics
+
+		// syncInterval and maxSyncLatency configure the grouping of syncs. See
+		// LogWriterConfig.WALSyncInterval.
+		syncInterval   time.Duration
+		maxSyncLatency time.Duration
+		// lastSync is the time the last sync completed, and syncLatency is a
+		// moving average of the latency of the syncs. They're used to compute
+		// the delay of the syncs when syncInterval is set.
+		lastSync    time.Time
+		syncLatency time.Duration
+		// syncDelayed is set while syncing is blocked to group the pending
+		// syncs with the syncs requested until the delay expires.
+		syncDelayed bool
+		// syncRequests is the number of queued records that requested a sync and
+		// haven't been synced yet. It's approximate, as it's updated after the
+		// records are queued, and is used to sample the size of the groups of
+		// syncs. Updating syncRequests does not require flusher mutex to be held.
+		syncRequests atomic.Int64
 	}
 
 	// afterFunc is a hook to allow tests to mock out the timer functionality
@@ -477,6 +502,18 @@ type LogWriter struct {
 type LogWriterConfig struct {
 	WALMinSyncInterval durationFunc
 	WALFsyncLatency    prometheus.Histogram
+
+	// WALSyncInterval, if positive, is the target interval between syncs. A
+	// sync requested less than WALSyncInterval after the previous sync is
+	// delayed until the interval elapses, so that it's grouped with the syncs
+	// requested in the meantime. WALMinSyncInterval is ignored when
+	// WALSyncInterval is set.
+	WALSyncInterval time.Duration
+	// WALMaxSyncLatency, if positive, bounds the delay of the syncs when
+	// WALSyncInterval is set: a sync is delayed by at most WALMaxSyncLatency
+	// minus the recent latency of the syncs, so that the commits waiting for
+	// the sync are acknowledged within WALMaxSyncLatency.
+	WALMaxSyncLatency time.Duration
 	// QueueSemChan is an optional channel to pop from when popping from
 	// LogWriter.flusher.syncQueue. It functions as a semaphore that prevents
 	// the syncQueue from overflowing (which will cause a panic). All production
@@ -495,6 +532,71 @@ type LogWriterConfig struct {
 	// package) precede the lower layer locks (in the record package). These
 	// callbacks are serialized since they are invoked from the flushLoop.
 	ExternalSyncQueueCallback ExternalSyncQueueCallback
+
+	// WriteRateLimit, if non-nil, is invoked by the flushLoop before writing n
+	// bytes to w, and may block in order to limit the rate of writes.
+	WriteRateLimit func(n int)
+
+	// WriteAlignment, if non-zero, aligns the writes to w: every write starts
+	// at an offset that is a multiple of WriteAlignment and its length is a
+	// multiple of WriteAlignment, so that writes never partially overwrite a
+	// page written previously, which would require the page to be read back
+	// by the OS, and so that w may use direct I/O. To that end, the records are
+	// padded up to the next multiple of WriteAlignment as configured by
+	// Padding, and the data that isn't padded yet is only written once it's
+	// padded or its block is full. WriteAlignment must be a power of two
+	// between MinWriteAlignment and MaxWriteAlignment.
+	WriteAlignment int
+	// Padding is the padding policy when WriteAlignment is set.
+	Padding PaddingPolicy
+}
+
+// MinWriteAlignment and MaxWriteAlignment bound
+// LogWriterConfig.WriteAlignment. MaxWriteAlignment is the block size.
+const (
+	MinWriteAlignment = 512
+	MaxWriteAlignment = blockSize
+)
+
+// PaddingPolicy configures the padding of the records written by a LogWriter
+// with a LogWriterConfig.WriteAlignment. The padding is a chunk that readers
+// skip, so the logs written with padding can be read by any version of the
+// Reader.
+type PaddingPolicy uint8
+
+const (
+	// PadSyncedRecords pads the records requesting a sync, and the end of the
+	// log. Records that don't request a sync are only written once a
+	// subsequent record requests a sync or their block is full, which bounds
+	// the space used by padding to one alignment per sync.
+	PadSyncedRecords PaddingPolicy = iota
+	// PadAllRecords pads every record, so that every record is written
+	// promptly, at the cost of up to one alignment of padding per record.
+	PadAllRecords
+)
+
+// String implements fmt.Stringer.
+func (p PaddingPolicy) String() string {
+	switch p {
+	case PadSyncedRecords:
+		return "synced-records"
+	case PadAllRecords:
+		return "all-records"
+	default:
+		return fmt.Sprintf("PaddingPolicy(%d)", uint8(p))
+	}
+}
+
+// ParsePaddingPolicy parses the string representation of a PaddingPolicy.
+func ParsePaddingPolicy(s string) (PaddingPolicy, error) {
+	switch s {
+	case "synced-records":
+		return PadSyncedRecords, nil
+	case "all-records":
+		return PadAllRecords, nil
+	default:
+		return 0, errors.Errorf("pebble/record: unknown padding policy %q", s)
+	}
 }
 
 // ExternalSyncQueueCallback is to be run when a PendingSync has been
@@ -526,6 +628,10 @@ func NewLogWriter(
 		w: w,
 		c: c,
 		s: s,
+
+		writeRateLimit: logWriterConfig.WriteRateLimit,
+		writeAlignment: int32(logWriterConfig.WriteAlignment),
+		padding:        logWriterConfig.Padding,
 		// NB: we truncate the 64-bit log number to 32-bits. This is ok because a)
 		// we are very unlikely to reach a file number of 4 billion and b) the log
 		// number is used as a validation check and using only the low 32-bits is
@@ -557,6 +663,11 @@ func NewLogWriter(
 	f := &r.flusher
 	f.minSyncInterval = logWriterConfig.WALMinSyncInterval
 	f.fsyncLatency = logWriterConfig.WALFsyncLatency
+	if logWriterConfig.WALSyncInterval > 0 {
+		f.minSyncInterval = nil
+		f.syncInterval = logWriterConfig.WALSyncInterval
+		f.maxSyncLatency = logWriterConfig.WALMaxSyncLatency
+	}
 
 	go func() {
 		pprof.Do(context.Background(), walSyncLabels, r.flushLoop)
@@ -627,7 +738,7 @@ func (w *LogWriter) flushLoop(context.Context) {
 			// Grab the portion of the current block that requires flushing. Note that
 			// the current block can be added to the pending blocks list after we release
 			// the flusher lock, but it won't be part of pending.
-			written := w.block.written.Load()
+			written := w.flushable(w.block.written.Load())
 			if len(f.pending) > 0 || written > w.block.flushed || !f.pendingSyncs.empty() {
 				break
 			}
@@ -662,10 +773,32 @@ func (w *LogWriter) flushLoop(context.Context) {
 		f.pending = f.pending[:0]
 		f.metrics.PendingBufferLen.AddSample(int64(len(pending)))
 
+		// If syncs are grouped, delay the pending syncs until the sync interval
+		// elapses, within the bounds of the max sync latency. Syncing is blocked
+		// until the timer fires, like for min-sync-interval.
+		if f.syncInterval > 0 && !f.syncDelayed && !f.pendingSyncs.empty() {
+			if delay := w.syncDelay(workStartTime); delay > 0 {
+				f.syncDelayed = true
+				f.pendingSyncs.setBlocked()
+				if syncTimer == nil {
+					syncTimer = w.afterFunc(delay, func() {
+						f.pendingSyncs.clearBlocked()
+						f.ready.Signal()
+					})
+				} else {
+					syncTimer.Reset(delay)
+				}
+			}
+		}
+
 		// Grab the list of sync waiters. Note that syncQueue.load() will return
 		// 0,0 while we're waiting for the min-sync-interval to expire. This
 		// allows flushing to proceed even if we're not ready to sync.
 		snap := f.pendingSyncs.snapshotForPop()
+		var syncRequests int64
+		if !snap.empty() {
+			syncRequests = f.syncRequests.Load()
+		}
 
 		// Grab the portion of the current block that requires flushing. Note that
 		// the current block can be added to the pending blocks list after we
@@ -673,7 +806,7 @@ func (w *LogWriter) flushLoop(context.Context) {
 		// be ordered after we get the list of sync waiters from syncQ in order to
 		// prevent a race where a waiter adds itself to syncQ, but this thread
 		// picks up the entry in syncQ and not the buffered data.
-		written := w.block.written.Load()
+		written := w.flushable(w.block.written.Load())
 		data := w.block.buf[w.block.flushed:written]
 		w.block.flushed = written
 
@@ -685,6 +818,7 @@ func (w *LogWriter) flushLoop(context.Context) {
 			// NB: pop may invoke ExternalSyncQueueCallback, which is why we have
 			// called f.Unlock() above. We will acquire the lock again below.
 			f.pendingSyncs.pop(snap, fErr)
+			f.syncRequests.Add(-syncRequests)
 			// Update the idleStartTime if work could not be done, so that we don't
 			// include the duration we tried to do work as idle. We don't bother
 			// with the rest of the accounting, which means we will undercount.
@@ -697,8 +831,20 @@ func (w *LogWriter) flushLoop(context.Context) {
 		if synced && f.fsyncLatency != nil {
 			f.fsyncLatency.Observe(float64(syncLatency))
 		}
+		if !snap.empty() {
+			f.syncRequests.Add(-syncRequests)
+			f.metrics.SyncGroupSize.AddSample(syncRequests)
+			f.syncDelayed = false
+		}
+		if synced {
+			f.lastSync = time.Now()
+			// An exponentially weighted moving average, with a weight of 1/8 for
+			// the latest sync.
+			f.syncLatency += (syncLatency - f.syncLatency) / 8
+		}
 		f.err = err
 		if f.err != nil {
+			f.syncDelayed = false
 			f.pendingSyncs.clearBlocked()
 			// Update the idleStartTime if work could not be done, so that we don't
 			// include the duration we tried to do work as idle. We don't bother
@@ -731,6 +877,28 @@ func (w *LogWriter) flushLoop(context.Context) {
 	}
 }
 
+// flushable returns the offset up to which the current block may be written
+// to w, given the offset written up to which it's filled: with a write
+// alignment, the data past the last multiple of the alignment is only written
+// once it's padded or the block is full.
+func (w *LogWriter) flushable(written int32) int32 {
+	if w.writeAlignment == 0 {
+		return written
+	}
+	return written &^ (w.writeAlignment - 1)
+}
+
+// syncDelay returns the duration by which to delay the pending syncs, when
+// syncs are grouped. It requires flusher mutex to be held.
+func (w *LogWriter) syncDelay(now time.Time) time.Duration {
+	f := &w.flusher
+	delay := f.lastSync.Add(f.syncInterval).Sub(now)
+	if f.maxSyncLatency > 0 {
+		delay = min(delay, f.maxSyncLatency-f.syncLatency)
+	}
+	return delay
+}
+
 func (w *LogWriter) flushPending(
 	data []byte, pending []*block, snap pendingSyncsSnapshot,
 ) (synced bool, syncLatency time.Duration, bytesWritten int64, err error) {
@@ -744,6 +912,15 @@ func (w *LogWriter) flushPending(
 		}
 	}()
 
+	if w.writeRateLimit != nil {
+		n := len(data)
+		for _, b := range pending {
+			n += blockSize - int(b.flushed)
+		}
+		if n > 0 {
+			w.writeRateLimit(n)
+		}
+	}
 	for _, b := range pending {
 		bytesWritten += blockSize - int64(b.flushed)
 		if err = w.flushBlock(b); err != nil {
@@ -833,6 +1010,9 @@ func (w *LogWriter) closeInternal(lastQueuedRecord PendingSyncIndex) error {
 	// differentiate between a corrupted entry in the middle of a log from
 	// garbage at the tail from a recycled log file.
 	w.emitEOFTrailer()
+	if w.writeAlignment > 0 {
+		w.emitPadding()
+	}
 
 	// Signal the flush loop to close.
 	f.Lock()
@@ -926,6 +1106,9 @@ func (w *LogWriter) SyncRecordGeneralized(p []byte, ps PendingSync) (logSize int
 	for i := 0; i == 0 || len(p) > 0; i++ {
 		p = w.emitFragment(i, p)
 	}
+	if w.writeAlignment > 0 && (w.padding == PadAllRecords || ps.syncRequested()) {
+		w.emitPadding()
+	}
 
 	if ps.syncRequested() {
 		// If we've been asked to persist the record, add the WaitGroup to the sync
@@ -935,6 +1118,7 @@ func (w *LogWriter) SyncRecordGeneralized(p []byte, ps PendingSync) (logSize int
 		// OS and synced to disk.
 		f := &w.flusher
 		f.pendingSyncs.push(ps)
+		f.syncRequests.Add(1)
 		f.ready.Signal()
 	}
 
@@ -1001,6 +1185,42 @@ func (w *LogWriter) emitFragment(n int, p []byte) (remainingP []byte) {
 	return p[r:]
 }
 
+// emitPadding pads the current block up to the next multiple of the write
+// alignment, so that the flushLoop may write the records emitted so far. The
+// padding is a recyclable middle chunk with a zeroed payload: readers skip
+// the chunks that aren't the first chunk of a record when looking for the
+// next record.
+func (w *LogWriter) emitPadding() {
+	b := w.block
+	i := b.written.Load()
+	a := w.writeAlignment
+	j := (i + a - 1) &^ (a - 1)
+	if j == i {
+		return
+	}
+	if j-i < recyclableHeaderSize {
+		// There is no room for the header of the padding chunk, so pad up to
+		// the following multiple of the alignment.
+		j += a
+	}
+	j = min(j, blockSize)
+	if j-i < recyclableHeaderSize {
+		// The EOF trailer left no room for a chunk in the block. Readers skip
+		// the zeroed tail of a block.
+		clear(b.buf[i:j])
+	} else {
+		clear(b.buf[i+recyclableHeaderSize : j])
+		b.buf[i+6] = recyclableMiddleChunkType
+		binary.LittleEndian.PutUint32(b.buf[i+7:i+11], w.logNum)
+		binary.LittleEndian.PutUint32(b.buf[i+0:i+4], crc.New(b.buf[i+6:j]).Value())
+		binary.LittleEndian.PutUint16(b.buf[i+4:i+6], uint16(j-i-recyclableHeaderSize))
+	}
+	b.written.Store(j)
+	if j == blockSize {
+		w.queueBlock()
+	}
+}
+
 // Metrics must typically be called after Close, since the callee will no
 // longer modify the returned LogWriterMetrics. It is also current if there is
 // nothing left to flush in the flush loop, but that is an implementation
@@ -1017,6 +1237,9 @@ type LogWriterMetrics struct {
 	WriteThroughput  base.ThroughputMetric
 	PendingBufferLen base.GaugeSampleMetric
 	SyncQueueLen     base.GaugeSampleMetric
+	// SyncGroupSize samples the number of records whose sync requests were
+	// satisfied by each sync, i.e. the number of commits grouped by a sync.
+	SyncGroupSize base.GaugeSampleMetric
 }
 
 // Merge merges metrics from x. Requires that x is non-nil.
@@ -1024,5 +1247,6 @@ func (m *LogWriterMetrics) Merge(x *LogWriterMetrics) error {
 	m.WriteThroughput.Merge(x.WriteThroughput)
 	m.PendingBufferLen.Merge(x.PendingBufferLen)
 	m.SyncQueueLen.Merge(x.SyncQueueLen)
+	m.SyncGroupSize.Merge(x.SyncGroupSize)
 	return nil
 }
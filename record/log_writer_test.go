@@ -7,6 +7,7 @@ package record
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"math"
 	"math/rand"
 	"sort"
@@ -366,6 +367,66 @@ func TestMinSyncIntervalClose(t *testing.T) {
 	wg.Wait()
 }
 
+func TestSyncInterval(t *testing.T) {
+	testCases := []struct {
+		maxSyncLatency time.Duration
+		maxDelay       time.Duration
+	}{
+		{maxSyncLatency: 0, maxDelay: time.Hour},
+		{maxSyncLatency: 10 * time.Millisecond, maxDelay: 10 * time.Millisecond},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.maxSyncLatency.String(), func(t *testing.T) {
+			f := &syncFile{}
+			w := NewLogWriter(f, 0, LogWriterConfig{
+				WALSyncInterval:   time.Hour,
+				WALMaxSyncLatency: tc.maxSyncLatency,
+				WALFsyncLatency:   prometheus.NewHistogram(prometheus.HistogramOpts{}),
+			})
+
+			var timer fakeTimer
+			delays := make(chan time.Duration, 1)
+			w.afterFunc = func(d time.Duration, f func()) syncTimer {
+				timer.f = f
+				delays <- d
+				return &timer
+			}
+
+			syncRecord := func(n int) *sync.WaitGroup {
+				wg := &sync.WaitGroup{}
+				wg.Add(1)
+				_, err := w.SyncRecord(bytes.Repeat([]byte{'a'}, n), wg, new(error))
+				require.NoError(t, err)
+				return wg
+			}
+
+			// The first sync isn't delayed.
+			syncRecord(1).Wait()
+			startSyncPos := f.syncPos.Load()
+
+			// The next syncs are delayed until the timer fires, and are then
+			// performed by a single sync.
+			var wg *sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg = syncRecord(100)
+			}
+			delay := <-delays
+			require.LessOrEqual(t, delay, tc.maxDelay)
+			require.Greater(t, delay, time.Duration(0))
+			require.Equal(t, startSyncPos, f.syncPos.Load())
+
+			timer.f()
+			wg.Wait()
+			require.Equal(t, f.writePos.Load(), f.syncPos.Load())
+			require.NoError(t, w.Close())
+
+			// Two syncs were performed, for a total of 11 records.
+			m := w.Metrics()
+			require.Equal(t, 5.5, m.SyncGroupSize.Mean())
+		})
+	}
+}
+
 type syncFileWithWait struct {
 	f       syncFile
 	writeWG sync.WaitGroup
@@ -803,3 +864,75 @@ func BenchmarkWriteWALBlocksAllocs(b *testing.B) {
 		b.SetBytes(dataVolume)
 	}
 }
+
+type alignedWritesFile struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	writes [][2]int
+}
+
+func (f *alignedWritesFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.writes = append(f.writes, [2]int{f.buf.Len(), len(p)})
+	return f.buf.Write(p)
+}
+
+func (f *alignedWritesFile) Sync() error {
+	return nil
+}
+
+func TestWriteAlignment(t *testing.T) {
+	for _, alignment := range []int{MinWriteAlignment, 4096, blockSize} {
+		for _, padding := range []PaddingPolicy{PadSyncedRecords, PadAllRecords} {
+			t.Run(fmt.Sprintf("%d/%s", alignment, padding), func(t *testing.T) {
+				f := &alignedWritesFile{}
+				w := NewLogWriter(f, 1, LogWriterConfig{
+					WALFsyncLatency: prometheus.NewHistogram(prometheus.HistogramOpts{}),
+					WriteAlignment:  alignment,
+					Padding:         padding,
+				})
+				rng := rand.New(rand.NewSource(1))
+				var records [][]byte
+				for i := 0; i < 500; i++ {
+					record := make([]byte, rng.Intn(3*alignment))
+					rng.Read(record)
+					records = append(records, record)
+					if rng.Intn(4) > 0 {
+						_, err := w.WriteRecord(record)
+						require.NoError(t, err)
+						continue
+					}
+					var syncWG sync.WaitGroup
+					var syncErr error
+					syncWG.Add(1)
+					offset, err := w.SyncRecord(record, &syncWG, &syncErr)
+					require.NoError(t, err)
+					syncWG.Wait()
+					require.NoError(t, syncErr)
+					// The synced record is padded, and written.
+					require.Zero(t, offset%int64(alignment))
+					f.mu.Lock()
+					require.LessOrEqual(t, offset, int64(f.buf.Len()))
+					f.mu.Unlock()
+				}
+				require.NoError(t, w.Close())
+
+				for _, write := range f.writes {
+					require.Zero(t, write[0]%alignment, "write at offset %d", write[0])
+					require.Zero(t, write[1]%alignment, "write of %d bytes", write[1])
+				}
+				r := NewReader(bytes.NewReader(f.buf.Bytes()), 1)
+				for i := range records {
+					rr, err := r.Next()
+					require.NoError(t, err)
+					record, err := io.ReadAll(rr)
+					require.NoError(t, err)
+					require.Equal(t, records[i], record, "record %d", i)
+				}
+				_, err := r.Next()
+				require.Equal(t, io.EOF, err)
+			})
+		}
+	}
+}
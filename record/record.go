@@ -178,6 +178,9 @@ type Reader struct {
 	recovering bool
 	// last is whether the current chunk is the last chunk of the record.
 	last bool
+	// recordOffset is the offset within the file of the first chunk of the
+	// current record.
+	recordOffset int64
 	// err is any accumulated error.
 	err error
 	// buf is the buffer.
@@ -266,6 +269,7 @@ func (r *Reader) nextChunk(wantFirst bool) error {
 				if chunkType != fullChunkType && chunkType != firstChunkType {
 					continue
 				}
+				r.recordOffset = r.blockNum*blockSize + int64(r.begin-headerSize)
 			}
 			r.last = chunkType == fullChunkType || chunkType == lastChunkType
 			r.recovering = false
@@ -0,0 +1,126 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package record
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// DamagedRange is a byte range of a log that a SalvageReader skipped over
+// because it couldn't be read.
+type DamagedRange struct {
+	// Start and End are the offsets delimiting the range, [Start, End).
+	Start, End int64
+	// Err is the error encountered reading the record at Start.
+	Err error
+}
+
+// String implements fmt.Stringer.
+func (d DamagedRange) String() string {
+	return fmt.Sprintf("[%d, %d) %s", d.Start, d.End, d.Err)
+}
+
+// SalvageReader reads the intact records of a log. Unlike a Reader, which
+// stops at the first invalid chunk, a SalvageReader scans forward past damage
+// for the next valid record, noting the byte ranges of the log it skipped
+// over. Damage is skipped at the granularity of the log's 32KiB blocks, so a
+// damaged range extends from the first record that couldn't be read to the
+// first record beginning in a subsequent block that could.
+//
+// Note that WAL preallocation and recycling commonly leave a tail of zeroed or
+// stale chunks following the last record of a WAL, which is reported as a
+// damaged range extending to the end of the log.
+type SalvageReader struct {
+	r   *Reader
+	buf bytes.Buffer
+	// pending is the damaged range being skipped over, if any. Its end isn't
+	// known until the next intact record is read.
+	pending *DamagedRange
+	damage  []DamagedRange
+}
+
+// NewSalvageReader returns a new SalvageReader. As with NewReader, if the log
+// contains records encoded using the recyclable record format, then the log
+// number in those records must match the specified logNum.
+func NewSalvageReader(r io.Reader, logNum base.DiskFileNum) *SalvageReader {
+	return &SalvageReader{r: NewReader(r, logNum)}
+}
+
+// Next returns the next intact record and its offset within the log, skipping
+// over any damage preceding it. It returns io.EOF once there are no more
+// records. The returned record is only valid until the next call to Next.
+//
+// Errors other than those satisfying IsInvalidRecord, such as errors reading
+// the underlying io.Reader, are returned as is.
+func (s *SalvageReader) Next() (offset int64, record []byte, err error) {
+	for {
+		start := s.r.Offset()
+		rr, err := s.r.Next()
+		if err == nil {
+			// The damage may lie in a later chunk of the record, so the record
+			// is read in its entirety before it's returned.
+			start = s.r.recordOffset
+			s.buf.Reset()
+			_, err = io.Copy(&s.buf, rr)
+		}
+		switch {
+		case err == nil:
+			s.endDamage(start)
+			return start, s.buf.Bytes(), nil
+		case err == io.EOF:
+			s.endDamage(s.r.Offset())
+			return 0, nil, io.EOF
+		case !IsInvalidRecord(err):
+			return 0, nil, err
+		}
+		if s.pending == nil {
+			s.pending = &DamagedRange{Start: start, Err: err}
+		}
+		// Skip the rest of the block, resuming at the first record beginning in
+		// a subsequent block.
+		s.r.recover()
+	}
+}
+
+// endDamage notes the end of the damaged range being skipped over, if any.
+func (s *SalvageReader) endDamage(end int64) {
+	if s.pending != nil {
+		s.pending.End = end
+		s.damage = append(s.damage, *s.pending)
+		s.pending = nil
+	}
+}
+
+// Damage returns the damaged ranges skipped over so far, in increasing order
+// of offset.
+func (s *SalvageReader) Damage() []DamagedRange {
+	return s.damage
+}
+
+// Salvage copies the intact records of the log read from src to a new log
+// written to dst, excising any damage, and returns the damaged ranges of src
+// that were skipped over. The records are written to dst using the legacy
+// record format, which is readable regardless of the log number of the file
+// holding it.
+func Salvage(src io.Reader, logNum base.DiskFileNum, dst io.Writer) ([]DamagedRange, error) {
+	s := NewSalvageReader(src, logNum)
+	w := NewWriter(dst)
+	for {
+		_, rec, err := s.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return s.Damage(), err
+		}
+		if _, err := w.WriteRecord(rec); err != nil {
+			return s.Damage(), err
+		}
+	}
+	return s.Damage(), w.Close()
+}
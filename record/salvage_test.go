@@ -0,0 +1,89 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package record
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSalvageReader(t *testing.T) {
+	recs, err := makeTestRecords(
+		// The first record spans the first two blocks.
+		blockSize+100,
+		// The second and third records follow in the second block, and the
+		// fourth record spans the rest of the second block and the third block.
+		1000,
+		1000,
+		blockSize,
+		// The fifth and sixth records follow in the third block, and the
+		// seventh record spans the rest of the third block and the fourth block.
+		100,
+		100,
+		blockSize,
+	)
+	require.NoError(t, err)
+
+	readAll := func(buf []byte) (offsets []int64, records [][]byte, damage []DamagedRange) {
+		s := NewSalvageReader(bytes.NewReader(buf), 0 /* logNum */)
+		for {
+			offset, rec, err := s.Next()
+			if err == io.EOF {
+				return offsets, records, s.Damage()
+			}
+			require.NoError(t, err)
+			offsets = append(offsets, offset)
+			records = append(records, append([]byte(nil), rec...))
+		}
+	}
+
+	t.Run("intact", func(t *testing.T) {
+		offsets, records, damage := readAll(recs.buf)
+		require.Equal(t, recs.offsets, offsets)
+		require.Equal(t, recs.records, records)
+		require.Empty(t, damage)
+	})
+
+	t.Run("damaged", func(t *testing.T) {
+		buf := append([]byte(nil), recs.buf...)
+		// Corrupt the second record and the sixth record.
+		buf[recs.offsets[1]+legacyHeaderSize] ^= 0xff
+		buf[recs.offsets[5]+legacyHeaderSize] ^= 0xff
+		// Truncate the seventh record.
+		buf = buf[:recs.offsets[6]+legacyHeaderSize+10]
+
+		offsets, records, damage := readAll(buf)
+		// The third and fourth records are lost along with the second, and the
+		// seventh record with the sixth, since the damage is skipped at the
+		// granularity of blocks.
+		require.Equal(t, []int64{recs.offsets[0], recs.offsets[4]}, offsets)
+		require.Equal(t, [][]byte{recs.records[0], recs.records[4]}, records)
+		require.Equal(t, []DamagedRange{
+			{Start: recs.offsets[1], End: recs.offsets[4], Err: ErrInvalidChunk},
+			{Start: recs.offsets[5], End: int64(len(buf)), Err: ErrInvalidChunk},
+		}, damage)
+
+		// Salvaging the log yields a log holding the intact records.
+		var salvaged bytes.Buffer
+		salvageDamage, err := Salvage(bytes.NewReader(buf), 0 /* logNum */, &salvaged)
+		require.NoError(t, err)
+		require.Equal(t, damage, salvageDamage)
+		_, salvagedRecords, salvagedDamage := readAll(salvaged.Bytes())
+		require.Equal(t, records, salvagedRecords)
+		require.Empty(t, salvagedDamage)
+	})
+
+	t.Run("zeroed-tail", func(t *testing.T) {
+		buf := append(append([]byte(nil), recs.buf...), make([]byte, blockSize)...)
+		offsets, _, damage := readAll(buf)
+		require.Equal(t, recs.offsets, offsets)
+		require.Equal(t, []DamagedRange{
+			{Start: int64(len(recs.buf)), End: int64(len(buf)), Err: ErrZeroedChunk},
+		}, damage)
+	})
+}
@@ -597,7 +597,6 @@ const (
 // eventListener returns a Pebble EventListener that is installed on the replay
 // database so that the replay runner has access to internal Pebble events.
 func (r *Runner) eventListener() pebble.EventListener {
-	var writeStallBegin time.Time
 	var writeStallReason string
 	l := pebble.EventListener{
 		BackgroundError: func(err error) {
@@ -618,12 +617,11 @@ func (r *Runner) eventListener() pebble.EventListener {
 			default:
 				panic(fmt.Sprintf("unrecognized write stall reason %q", info.Reason))
 			}
-			writeStallBegin = time.Now()
 		},
-		WriteStallEnd: func() {
+		WriteStallEndWithInfo: func(info pebble.WriteStallEndInfo) {
 			r.writeStallMetrics.Lock()
 			defer r.writeStallMetrics.Unlock()
-			r.writeStallMetrics.durationByReason[writeStallReason] += time.Since(writeStallBegin)
+			r.writeStallMetrics.durationByReason[writeStallReason] += info.Duration
 		},
 		CompactionBegin: func(_ pebble.CompactionInfo) {
 			r.compactionMu.Lock()
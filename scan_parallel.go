@@ -0,0 +1,81 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"runtime"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// ScanParallelOptions configures DB.ScanParallel.
+type ScanParallelOptions struct {
+	// IterOptions, if non-nil, configure the iterators over the key ranges.
+	// Their bounds are ignored: each iterator is bounded to its key range.
+	IterOptions *IterOptions
+	// Concurrency is the maximum number of key ranges scanned concurrently. If
+	// zero, it defaults to runtime.GOMAXPROCS(0).
+	Concurrency int
+}
+
+// ScanParallel scans the disjoint key ranges concurrently on a pool of
+// workers. For each range, fn is invoked with the index of the range and an
+// unpositioned iterator bounded to it, which is closed once fn returns. The
+// iterators are clones of a single iterator (see Iterator.CloneRanges), so they
+// all read the same consistent view of the DB and share the readers of its
+// sstables.
+//
+// fn is invoked concurrently, and must not retain the iterator. If fn returns
+// an error or the context is canceled, the ranges that aren't yet being scanned
+// are skipped, and ScanParallel returns the first error.
+func (d *DB) ScanParallel(
+	ctx context.Context,
+	ranges []KeyRange,
+	opts ScanParallelOptions,
+	fn func(rangeIdx int, iter *Iterator) error,
+) error {
+	if err := checkDisjointRanges(d.cmp, ranges); err != nil {
+		return err
+	}
+	iter, err := d.NewIterWithContext(ctx, opts.IterOptions)
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrency)
+	for i := range ranges {
+		if gctx.Err() != nil {
+			break
+		}
+		i := i
+		g.Go(func() error {
+			if err := gctx.Err(); err != nil {
+				return err
+			}
+			// The workers clone the iterator lazily so that at most
+			// concurrency clones are open at any time.
+			clone, err := iter.cloneBounded(gctx, ranges[i])
+			if err != nil {
+				return err
+			}
+			err = fn(i, clone)
+			if closeErr := clone.Close(); err == nil {
+				err = closeErr
+			}
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
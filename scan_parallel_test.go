@@ -0,0 +1,105 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanParallel(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer d.Close()
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("%03d", i)), nil, nil))
+		if i%250 == 0 {
+			require.NoError(t, d.Flush())
+		}
+	}
+	ranges := []KeyRange{
+		{Start: []byte("500"), End: []byte("750")},
+		{Start: nil, End: []byte("100")},
+		{Start: []byte("750"), End: nil},
+		{Start: []byte("100"), End: []byte("500")},
+	}
+	counts := make([]int, len(ranges))
+	var mu sync.Mutex
+	seen := make(map[string]int)
+	err = d.ScanParallel(context.Background(), ranges, ScanParallelOptions{Concurrency: 2},
+		func(rangeIdx int, iter *Iterator) error {
+			for valid := iter.First(); valid; valid = iter.Next() {
+				counts[rangeIdx]++
+				mu.Lock()
+				seen[string(iter.Key())]++
+				mu.Unlock()
+			}
+			return iter.Error()
+		})
+	require.NoError(t, err)
+	require.Equal(t, []int{250, 100, 250, 400}, counts)
+	require.Len(t, seen, 1000)
+	for k, n := range seen {
+		require.Equal(t, 1, n, "%s", k)
+	}
+
+	// Errors returned by fn are propagated.
+	errBoom := errors.New("boom")
+	err = d.ScanParallel(context.Background(), ranges, ScanParallelOptions{},
+		func(rangeIdx int, iter *Iterator) error {
+			if rangeIdx == 2 {
+				return errBoom
+			}
+			return nil
+		})
+	require.ErrorIs(t, err, errBoom)
+
+	// The ranges must be disjoint and non-empty.
+	for _, ranges := range [][]KeyRange{
+		{{Start: []byte("a"), End: []byte("c")}, {Start: []byte("b"), End: []byte("d")}},
+		{{Start: nil, End: []byte("c")}, {Start: nil, End: []byte("d")}},
+		{{Start: []byte("b"), End: []byte("a")}},
+	} {
+		err := d.ScanParallel(context.Background(), ranges, ScanParallelOptions{},
+			func(int, *Iterator) error { return nil })
+		require.Error(t, err)
+	}
+}
+
+func TestIteratorCloneRanges(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer d.Close()
+	for _, k := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, d.Set([]byte(k), nil, nil))
+	}
+	iter, err := d.NewIter(nil)
+	require.NoError(t, err)
+	// The clones share the iterator's view of the DB.
+	require.NoError(t, d.Set([]byte("e"), nil, nil))
+	clones, err := iter.CloneRanges(context.Background(), []KeyRange{
+		{Start: []byte("c"), End: nil},
+		{Start: []byte("a"), End: []byte("c")},
+	})
+	require.NoError(t, err)
+	require.NoError(t, iter.Close())
+
+	var keys []string
+	for _, clone := range clones {
+		var cloneKeys []byte
+		for valid := clone.First(); valid; valid = clone.Next() {
+			cloneKeys = append(cloneKeys, clone.Key()...)
+		}
+		keys = append(keys, string(cloneKeys))
+		require.NoError(t, clone.Close())
+	}
+	require.Equal(t, []string{"cd", "ab"}, keys)
+}
@@ -45,7 +45,16 @@ func (s *Snapshot) Get(key []byte) ([]byte, io.Closer, error) {
 	if s.db == nil {
 		panic(ErrClosed)
 	}
-	return s.db.getInternal(key, nil /* batch */, s)
+	return s.db.getInternal(context.Background(), key, nil /* batch */, s)
+}
+
+// MultiGet gets the values for the given keys from the snapshot. See
+// DB.MultiGet.
+func (s *Snapshot) MultiGet(keys [][]byte) ([][]byte, error) {
+	if s.db == nil {
+		panic(ErrClosed)
+	}
+	return s.db.multiGetInternal(keys, s)
 }
 
 // NewIter returns an iterator that is unpositioned (Iterator.Valid() will
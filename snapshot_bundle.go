@@ -0,0 +1,401 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/keyspan"
+	"github.com/cockroachdb/pebble/internal/rangekey"
+	"github.com/cockroachdb/pebble/objstorage"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/sstable"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// SnapshotBundle is a portable description of the contents of an
+// EventuallyFileOnlySnapshot, produced by EventuallyFileOnlySnapshot.Export
+// and imported into another DB with DB.ImportSnapshot. A bundle references the
+// snapshot's sstables in shared storage, if any, rather than copying them, so
+// exporting a snapshot of a DB that stores its lower levels in shared storage
+// is cheap regardless of the amount of data it contains. Keys that aren't
+// within shared sstables (e.g. keys in memtables or in the higher levels of the
+// LSM) are written to a local sstable for each span of the bundle, which must
+// be made available to the importing DB.
+//
+// A bundle may be serialized with Encode and deserialized with
+// DecodeSnapshotBundle.
+type SnapshotBundle struct {
+	// SeqNum is the sequence number of the exported snapshot.
+	SeqNum uint64
+	// Spans holds the contents of each of the snapshot's key ranges.
+	Spans []SnapshotBundleSpan
+}
+
+// SnapshotBundleSpan holds the contents of one of the key ranges of an
+// exported snapshot.
+type SnapshotBundleSpan struct {
+	KeyRange
+	// LocalTable is the name of the sstable, relative to the directory provided
+	// to Export, that holds the span's keys that aren't within SharedFiles. It's
+	// empty if there are no such keys.
+	LocalTable string
+	// SharedFiles holds the span's sstables in shared storage, truncated to the
+	// span's bounds.
+	SharedFiles []SharedSSTMeta
+}
+
+// Export exports the contents of the snapshot's key ranges, writing a local
+// sstable for each key range to the provided directory. If the DB is
+// configured with shared storage (see Options.Experimental.RemoteStorage),
+// sstables in shared storage are referenced by the returned bundle rather than
+// copied. If the lower levels of the LSM contain sstables that aren't in
+// shared storage, all of the keys are copied.
+//
+// The bounds of the snapshot's key ranges must be prefix keys (see
+// DB.IngestAndExcise). Merge and SingleDelete keys are not supported within the
+// key ranges.
+//
+// The sstables in shared storage referenced by the bundle are guaranteed to
+// remain available until the bundle is closed; Close must be called once the
+// bundle is no longer needed, e.g. after it has been imported.
+func (es *EventuallyFileOnlySnapshot) Export(
+	ctx context.Context, fs vfs.FS, dir string,
+) (*SnapshotBundle, error) {
+	if es.db == nil {
+		panic(ErrClosed)
+	}
+	b := &SnapshotBundle{SeqNum: es.seqNum}
+	skipShared := es.db.opts.Experimental.RemoteStorage != nil
+	for i, kr := range es.protectedRanges {
+		name := fmt.Sprintf("snapshot-%d.sst", i)
+		path := fs.PathJoin(dir, name)
+		span, err := es.exportSpan(ctx, fs, path, kr, skipShared)
+		if errors.Is(err, ErrInvalidSkipSharedIteration) {
+			// Some sstables in the lower levels aren't in shared storage. Copy
+			// all of the keys instead.
+			span, err = es.exportSpan(ctx, fs, path, kr, false /* skipShared */)
+		}
+		if err != nil {
+			b.Close()
+			return nil, err
+		}
+		if span.LocalTable != "" {
+			span.LocalTable = name
+		}
+		b.Spans = append(b.Spans, span)
+	}
+	return b, nil
+}
+
+// exportSpan writes the keys within the provided key range to a local sstable
+// at path. If skipShared is true, sstables in shared storage are returned
+// within the span rather than written to the local sstable. The local sstable
+// is removed if it's empty.
+func (es *EventuallyFileOnlySnapshot) exportSpan(
+	ctx context.Context, fs vfs.FS, path string, kr KeyRange, skipShared bool,
+) (span SnapshotBundleSpan, err error) {
+	span.KeyRange = KeyRange{Start: kr.Start, End: kr.End}
+	f, err := fs.Create(path)
+	if err != nil {
+		return span, err
+	}
+	// The importing DB is required to support shared objects, so a table
+	// format supported by FormatMinForSharedObjects is always readable by it.
+	writerOpts := es.db.opts.MakeWriterOptions(0, FormatMinForSharedObjects.MaxTableFormat())
+	w := sstable.NewWriter(objstorageprovider.NewFileWritable(f), writerOpts)
+	var written bool
+	var visitSharedFile func(sst *SharedSSTMeta) error
+	if skipShared {
+		visitSharedFile = func(sst *SharedSSTMeta) error {
+			span.SharedFiles = append(span.SharedFiles, *sst)
+			return nil
+		}
+	}
+	err = es.ScanInternal(ctx, sstable.CategoryAndQoS{}, kr.Start, kr.End,
+		func(key *InternalKey, value LazyValue, _ IteratorLevel) error {
+			val, _, err := value.Value(nil)
+			if err != nil {
+				return err
+			}
+			written = true
+			return w.Add(base.MakeInternalKey(key.UserKey, 0, key.Kind()), val)
+		},
+		func(start, end []byte, seqNum uint64) error {
+			written = true
+			return w.DeleteRange(start, end)
+		},
+		func(start, end []byte, keys []keyspan.Key) error {
+			written = true
+			s := keyspan.Span{Start: start, End: end, Keys: keys}
+			return rangekey.Encode(&s, func(k base.InternalKey, v []byte) error {
+				return w.AddRangeKey(base.MakeInternalKey(k.UserKey, 0, k.Kind()), v)
+			})
+		},
+		visitSharedFile,
+		nil, /* visitExternalFile */
+	)
+	if err = firstError(err, w.Close()); err == nil {
+		if written {
+			span.LocalTable = path
+			return span, nil
+		}
+		// All of the span's keys, if any, are within shared sstables.
+		if err = fs.Remove(path); err == nil {
+			return span, nil
+		}
+	} else {
+		err = firstError(err, fs.Remove(path))
+	}
+	for i := range span.SharedFiles {
+		span.SharedFiles[i].Backing.Close()
+	}
+	return SnapshotBundleSpan{}, err
+}
+
+// Close releases the bundle's references to sstables in shared storage. It's
+// a no-op for bundles returned by DecodeSnapshotBundle.
+func (b *SnapshotBundle) Close() {
+	for i := range b.Spans {
+		for j := range b.Spans[i].SharedFiles {
+			b.Spans[i].SharedFiles[j].Backing.Close()
+		}
+	}
+}
+
+// snapshotBundleVersion is the version of the encoding produced by
+// SnapshotBundle.Encode.
+const snapshotBundleVersion = 1
+
+// Encode serializes the bundle.
+func (b *SnapshotBundle) Encode() ([]byte, error) {
+	buf := []byte{snapshotBundleVersion}
+	buf = binary.AppendUvarint(buf, b.SeqNum)
+	buf = binary.AppendUvarint(buf, uint64(len(b.Spans)))
+	for i := range b.Spans {
+		s := &b.Spans[i]
+		buf = appendBundleBytes(buf, s.Start)
+		buf = appendBundleBytes(buf, s.End)
+		buf = appendBundleBytes(buf, []byte(s.LocalTable))
+		buf = binary.AppendUvarint(buf, uint64(len(s.SharedFiles)))
+		for j := range s.SharedFiles {
+			sst := &s.SharedFiles[j]
+			backing, err := sst.Backing.Get()
+			if err != nil {
+				return nil, err
+			}
+			buf = appendBundleBytes(buf, backing)
+			for _, k := range []*InternalKey{
+				&sst.Smallest, &sst.Largest,
+				&sst.SmallestRangeKey, &sst.LargestRangeKey,
+				&sst.SmallestPointKey, &sst.LargestPointKey,
+			} {
+				buf = appendBundleInternalKey(buf, *k)
+			}
+			buf = append(buf, sst.Level)
+			buf = binary.AppendUvarint(buf, sst.Size)
+			buf = binary.AppendUvarint(buf, uint64(sst.fileNum))
+		}
+	}
+	return buf, nil
+}
+
+// DecodeSnapshotBundle deserializes a bundle serialized by
+// SnapshotBundle.Encode.
+func DecodeSnapshotBundle(data []byte) (*SnapshotBundle, error) {
+	if len(data) == 0 || data[0] != snapshotBundleVersion {
+		return nil, base.CorruptionErrorf("pebble: unknown snapshot bundle version")
+	}
+	d := bundleDecoder{data: data[1:]}
+	b := &SnapshotBundle{SeqNum: d.uvarint()}
+	b.Spans = make([]SnapshotBundleSpan, d.count())
+	for i := range b.Spans {
+		s := &b.Spans[i]
+		s.Start = d.bytes()
+		s.End = d.bytes()
+		s.LocalTable = string(d.bytes())
+		s.SharedFiles = make([]SharedSSTMeta, d.count())
+		for j := range s.SharedFiles {
+			sst := &s.SharedFiles[j]
+			sst.Backing = decodedBackingHandle(d.bytes())
+			for _, k := range []*InternalKey{
+				&sst.Smallest, &sst.Largest,
+				&sst.SmallestRangeKey, &sst.LargestRangeKey,
+				&sst.SmallestPointKey, &sst.LargestPointKey,
+			} {
+				*k = d.internalKey()
+			}
+			sst.Level = d.readByte()
+			sst.Size = d.uvarint()
+			sst.fileNum = base.FileNum(d.uvarint())
+		}
+	}
+	if d.err == nil && len(d.data) != 0 {
+		d.err = base.CorruptionErrorf("pebble: snapshot bundle has %d trailing bytes", errors.Safe(len(d.data)))
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return b, nil
+}
+
+// ImportSnapshot imports the contents of a bundle exported from another DB
+// with EventuallyFileOnlySnapshot.Export. The import is destructive: any keys
+// of the DB within the bundle's spans are deleted, and replaced by the spans'
+// contents, as if by IngestAndExcise. The keys outside of the spans are left
+// unmodified. All of the spans are imported by a single ingestion, so the
+// import is atomic: the DB's keys within the spans are either all replaced or,
+// if an error is returned, all left unmodified.
+//
+// The local sstables of the bundle are read from the provided directory within
+// Options.FS, and are ingested. Importing a bundle that references sstables in
+// shared storage requires the DB to be configured with the same shared storage
+// as the exporting DB.
+//
+// ImportSnapshot is intended for maintaining read replicas of a DB: the
+// imported spans should not otherwise be written to.
+func (d *DB) ImportSnapshot(b *SnapshotBundle, dir string) error {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.opts.ReadOnly {
+		return ErrReadOnly
+	}
+	if v := d.FormatMajorVersion(); v < FormatMinForSharedObjects {
+		return errors.Errorf(
+			"store has format major version %d; ImportSnapshot requires at least %d",
+			v, FormatMinForSharedObjects,
+		)
+	}
+	var paths []string
+	var shared []SharedSSTMeta
+	spans := make([]KeyRange, len(b.Spans))
+	for i := range b.Spans {
+		s := &b.Spans[i]
+		if !s.Valid() || d.cmp(s.Start, s.End) >= 0 {
+			return errors.Errorf("pebble: invalid snapshot bundle span [%q, %q)", s.Start, s.End)
+		}
+		if i > 0 && d.cmp(b.Spans[i-1].End, s.Start) > 0 {
+			return errors.Errorf("pebble: snapshot bundle spans [%q, %q) and [%q, %q) are out of order",
+				b.Spans[i-1].Start, b.Spans[i-1].End, s.Start, s.End)
+		}
+		if s.LocalTable != "" {
+			paths = append(paths, d.opts.FS.PathJoin(dir, s.LocalTable))
+		}
+		shared = append(shared, s.SharedFiles...)
+		spans[i] = s.KeyRange
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+	_, err := d.ingest(paths, ingestTargetLevel, shared, spans, false /* sstsContainExciseTombstone */, nil /* external */, false /* allowOverlap */)
+	return errors.Wrap(err, "pebble: importing snapshot")
+}
+
+func appendBundleBytes(buf, b []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+// appendBundleInternalKey encodes k, distinguishing a nil user key (i.e. a
+// zero InternalKey) from an empty one.
+func appendBundleInternalKey(buf []byte, k InternalKey) []byte {
+	if k.UserKey == nil {
+		buf = binary.AppendUvarint(buf, 0)
+	} else {
+		buf = binary.AppendUvarint(buf, uint64(len(k.UserKey))+1)
+		buf = append(buf, k.UserKey...)
+	}
+	return binary.AppendUvarint(buf, k.Trailer)
+}
+
+// bundleDecoder decodes a serialized SnapshotBundle. Once an error is
+// encountered, all subsequent reads return zero values.
+type bundleDecoder struct {
+	data []byte
+	err  error
+}
+
+func (d *bundleDecoder) fail() {
+	if d.err == nil {
+		d.err = base.CorruptionErrorf("pebble: snapshot bundle is truncated")
+	}
+	d.data = nil
+}
+
+func (d *bundleDecoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+// count decodes a number of elements, each of which requires at least one
+// byte, so that a corrupt count can't cause an excessive allocation.
+func (d *bundleDecoder) count() int {
+	n := d.uvarint()
+	if n > uint64(len(d.data)) {
+		d.fail()
+		return 0
+	}
+	return int(n)
+}
+
+func (d *bundleDecoder) readByte() byte {
+	if len(d.data) == 0 {
+		d.fail()
+		return 0
+	}
+	b := d.data[0]
+	d.data = d.data[1:]
+	return b
+}
+
+func (d *bundleDecoder) bytes() []byte {
+	n := d.uvarint()
+	if n > uint64(len(d.data)) {
+		d.fail()
+		return nil
+	}
+	b := d.data[:n:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *bundleDecoder) internalKey() InternalKey {
+	var k InternalKey
+	if n := d.uvarint(); n > 0 {
+		if n-1 > uint64(len(d.data)) {
+			d.fail()
+			return InternalKey{}
+		}
+		k.UserKey = d.data[: n-1 : n-1]
+		d.data = d.data[n-1:]
+	}
+	k.Trailer = d.uvarint()
+	return k
+}
+
+// decodedBackingHandle implements objstorage.RemoteObjectBackingHandle for the
+// backings of a decoded bundle. The exporting bundle is responsible for
+// keeping the backings valid.
+type decodedBackingHandle objstorage.RemoteObjectBacking
+
+var _ objstorage.RemoteObjectBackingHandle = decodedBackingHandle(nil)
+
+// Get implements objstorage.RemoteObjectBackingHandle.
+func (h decodedBackingHandle) Get() (objstorage.RemoteObjectBacking, error) {
+	return objstorage.RemoteObjectBacking(h), nil
+}
+
+// Close implements objstorage.RemoteObjectBackingHandle.
+func (h decodedBackingHandle) Close() {}
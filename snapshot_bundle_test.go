@@ -0,0 +1,105 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/pebble/objstorage/remote"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotBundle(t *testing.T) {
+	for _, shared := range []bool{false, true} {
+		t.Run(fmt.Sprintf("shared=%t", shared), func(t *testing.T) {
+			storage := remote.NewInMem()
+			open := func(creatorID uint64) *DB {
+				opts := &Options{
+					FS:                 vfs.NewMem(),
+					FormatMajorVersion: FormatVirtualSSTables,
+					Logger:             testLogger{t},
+				}
+				if shared {
+					opts.Experimental.RemoteStorage = remote.MakeSimpleFactory(map[remote.Locator]remote.Storage{
+						"": storage,
+					})
+					opts.Experimental.CreateOnShared = remote.CreateOnSharedAll
+				}
+				d, err := Open("", opts)
+				require.NoError(t, err)
+				if shared {
+					require.NoError(t, d.SetCreatorID(creatorID))
+				}
+				return d
+			}
+			src := open(1)
+			defer func() { require.NoError(t, src.Close()) }()
+			dst := open(2)
+			defer func() { require.NoError(t, dst.Close()) }()
+
+			// Write keys to the bottommost level, followed by keys that remain in
+			// the memtable.
+			for _, k := range []string{"a", "b", "c", "d", "x"} {
+				require.NoError(t, src.Set([]byte(k), []byte(k+"1"), nil))
+			}
+			require.NoError(t, src.Compact([]byte("a"), []byte("z"), true))
+			require.NoError(t, src.Set([]byte("b"), []byte("b2"), nil))
+			require.NoError(t, src.Delete([]byte("c"), nil))
+
+			// The destination's keys within the spans are replaced by the import,
+			// and the keys between them are retained, including those in an
+			// sstable straddling both spans.
+			require.NoError(t, dst.Set([]byte("a"), []byte("stale"), nil))
+			require.NoError(t, dst.Set([]byte("c"), []byte("c3"), nil))
+			require.NoError(t, dst.Set([]byte("e"), []byte("stale"), nil))
+			require.NoError(t, dst.Flush())
+
+			efos := src.NewEventuallyFileOnlySnapshot([]KeyRange{
+				{Start: []byte("a"), End: []byte("c")},
+				{Start: []byte("d"), End: []byte("f")},
+			})
+			defer func() { require.NoError(t, efos.Close()) }()
+			// Writes after the snapshot are not exported.
+			require.NoError(t, src.Set([]byte("d"), []byte("d2"), nil))
+
+			require.NoError(t, dst.opts.FS.MkdirAll("bundle", 0755))
+			b, err := efos.Export(context.Background(), dst.opts.FS, "bundle")
+			require.NoError(t, err)
+			defer b.Close()
+			require.Len(t, b.Spans, 2)
+			require.Equal(t, "snapshot-0.sst", b.Spans[0].LocalTable)
+			for i := range b.Spans {
+				if shared {
+					require.Len(t, b.Spans[i].SharedFiles, 1)
+				} else {
+					require.Empty(t, b.Spans[i].SharedFiles)
+				}
+			}
+
+			data, err := b.Encode()
+			require.NoError(t, err)
+			decoded, err := DecodeSnapshotBundle(data)
+			require.NoError(t, err)
+			require.Equal(t, b.SeqNum, decoded.SeqNum)
+			_, err = DecodeSnapshotBundle(data[:len(data)-1])
+			require.Error(t, err)
+
+			// All of the spans are imported by a single ingestion.
+			ingests := dst.Metrics().Ingest.Count
+			require.NoError(t, dst.ImportSnapshot(decoded, "bundle"))
+			require.Equal(t, ingests+1, dst.Metrics().Ingest.Count)
+			iter, _ := dst.NewIter(nil)
+			var got []string
+			for valid := iter.First(); valid; valid = iter.Next() {
+				got = append(got, fmt.Sprintf("%s:%s", iter.Key(), iter.Value()))
+			}
+			require.NoError(t, iter.Close())
+			require.Equal(t, []string{"a:a1", "b:b2", "c:c3", "d:d1"}, got)
+		})
+	}
+}
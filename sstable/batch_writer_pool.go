@@ -0,0 +1,254 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"runtime"
+	"slices"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/objstorage"
+)
+
+// BatchWriterPoolOptions configures a BatchWriterPool.
+type BatchWriterPoolOptions struct {
+	// WriterOptions configures the sstables. To build sstables for ingestion
+	// into a DB, use the DB's options:
+	//
+	//	opts.MakeWriterOptions(0, db.FormatMajorVersion().MaxTableFormat())
+	WriterOptions WriterOptions
+
+	// TargetFileSize is the target size of each sstable. It bounds the size of
+	// the keys and values of each sstable, before compression, so sstables are
+	// typically smaller than TargetFileSize. The default value is 64 MB.
+	TargetFileSize int64
+
+	// Concurrency is the number of sstables built in parallel. The default
+	// value is runtime.GOMAXPROCS(0).
+	Concurrency int
+
+	// Create creates the i-th sstable, returning its path and the Writable to
+	// write it to. It's called concurrently by the workers of the pool.
+	Create func(i int) (path string, w objstorage.Writable, err error)
+}
+
+// BatchWriterPoolTable is an sstable built by a BatchWriterPool.
+type BatchWriterPoolTable struct {
+	// Path is the path returned by BatchWriterPoolOptions.Create.
+	Path string
+	// Meta is the metadata of the sstable.
+	Meta *WriterMetadata
+}
+
+// BatchWriterPool builds sstables in parallel from a sorted stream of keys. The
+// stream is sharded into batches, each holding up to
+// BatchWriterPoolOptions.TargetFileSize of keys and values, and each batch is
+// written as an sstable by one of the workers of the pool. The sstables don't
+// overlap, and are suitable for ingestion into a DB.
+//
+// The methods of BatchWriterPool must not be called concurrently.
+type BatchWriterPool struct {
+	opts     BatchWriterPoolOptions
+	comparer *Comparer
+
+	// batch is the batch being filled, and lastKey the last key added to it or
+	// to the previous batch.
+	batch      *writerPoolBatch
+	lastKey    []byte
+	numBatches int
+
+	batches chan *writerPoolBatch
+	wg      sync.WaitGroup
+	mu      struct {
+		sync.Mutex
+		err    error
+		tables []writerPoolTable
+	}
+	finished bool
+}
+
+// writerPoolBatch holds the keys and values of an sstable to be built by a
+// BatchWriterPool.
+type writerPoolBatch struct {
+	index   int
+	buf     []byte
+	entries []writerPoolEntry
+}
+
+// writerPoolEntry is a key and value of a writerPoolBatch, stored in
+// buf[keyStart:valueStart] and buf[valueStart:valueEnd].
+type writerPoolEntry struct {
+	kind                           base.InternalKeyKind
+	keyStart, valueStart, valueEnd int
+}
+
+type writerPoolTable struct {
+	index int
+	BatchWriterPoolTable
+}
+
+// NewBatchWriterPool returns a BatchWriterPool, whose workers are started
+// immediately. BatchWriterPool.Finish must be called to stop them.
+func NewBatchWriterPool(opts BatchWriterPoolOptions) *BatchWriterPool {
+	if opts.TargetFileSize <= 0 {
+		opts.TargetFileSize = 64 << 20
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = runtime.GOMAXPROCS(0)
+	}
+	p := &BatchWriterPool{
+		opts:     opts,
+		comparer: base.DefaultComparer,
+		batches:  make(chan *writerPoolBatch),
+	}
+	if opts.WriterOptions.Comparer != nil {
+		p.comparer = opts.WriterOptions.Comparer
+	}
+	p.wg.Add(opts.Concurrency)
+	for i := 0; i < opts.Concurrency; i++ {
+		go p.worker()
+	}
+	return p
+}
+
+// Set adds a SET of key to value. Keys must be added in strictly increasing
+// order. The key and value may be reused by the caller once Set returns.
+func (p *BatchWriterPool) Set(key, value []byte) error {
+	return p.add(base.InternalKeyKindSet, key, value)
+}
+
+// Delete adds a DEL of key. Keys must be added in strictly increasing order.
+// The key may be reused by the caller once Delete returns.
+func (p *BatchWriterPool) Delete(key []byte) error {
+	return p.add(base.InternalKeyKindDelete, key, nil)
+}
+
+func (p *BatchWriterPool) add(kind base.InternalKeyKind, key, value []byte) error {
+	if p.finished {
+		return errors.New("pebble: BatchWriterPool is finished")
+	}
+	if err := p.err(); err != nil {
+		return err
+	}
+	if p.lastKey != nil && p.comparer.Compare(p.lastKey, key) >= 0 {
+		return errors.Errorf("pebble: keys must be added in strictly increasing order: %s, %s",
+			p.comparer.FormatKey(p.lastKey), p.comparer.FormatKey(key))
+	}
+	b := p.batch
+	if b == nil {
+		b = &writerPoolBatch{index: p.numBatches}
+		p.numBatches++
+		p.batch = b
+	}
+	e := writerPoolEntry{kind: kind, keyStart: len(b.buf)}
+	b.buf = append(b.buf, key...)
+	e.valueStart = len(b.buf)
+	b.buf = append(b.buf, value...)
+	e.valueEnd = len(b.buf)
+	b.entries = append(b.entries, e)
+	p.lastKey = b.buf[e.keyStart:e.valueStart]
+	if int64(len(b.buf)) >= p.opts.TargetFileSize {
+		p.flush()
+	}
+	return nil
+}
+
+// flush hands the current batch to the workers, blocking until one of them is
+// available.
+func (p *BatchWriterPool) flush() {
+	if p.batch == nil {
+		return
+	}
+	// The last key must outlive the batch, which is released by the worker.
+	p.lastKey = slices.Clone(p.lastKey)
+	p.batches <- p.batch
+	p.batch = nil
+}
+
+// Finish writes the keys added since the last sstable was started, waits for
+// all the sstables to be built, and returns them in key order. If building any
+// of the sstables failed, Finish returns the first error encountered, and the
+// sstables that were created are left behind for the caller to remove.
+func (p *BatchWriterPool) Finish() ([]BatchWriterPoolTable, error) {
+	if p.finished {
+		return nil, errors.New("pebble: BatchWriterPool is finished")
+	}
+	p.finished = true
+	if p.err() == nil {
+		p.flush()
+	}
+	close(p.batches)
+	p.wg.Wait()
+	if err := p.err(); err != nil {
+		return nil, err
+	}
+	slices.SortFunc(p.mu.tables, func(a, b writerPoolTable) int {
+		return a.index - b.index
+	})
+	tables := make([]BatchWriterPoolTable, len(p.mu.tables))
+	for i := range p.mu.tables {
+		tables[i] = p.mu.tables[i].BatchWriterPoolTable
+	}
+	return tables, nil
+}
+
+func (p *BatchWriterPool) err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.mu.err
+}
+
+func (p *BatchWriterPool) worker() {
+	defer p.wg.Done()
+	for b := range p.batches {
+		if p.err() != nil {
+			// Drain the remaining batches.
+			continue
+		}
+		t, err := p.write(b)
+		p.mu.Lock()
+		if err != nil {
+			if p.mu.err == nil {
+				p.mu.err = errors.Wrapf(err, "pebble: building sstable %d", b.index)
+			}
+		} else {
+			p.mu.tables = append(p.mu.tables, t)
+		}
+		p.mu.Unlock()
+	}
+}
+
+// write builds the sstable of the batch.
+func (p *BatchWriterPool) write(b *writerPoolBatch) (writerPoolTable, error) {
+	path, writable, err := p.opts.Create(b.index)
+	if err != nil {
+		return writerPoolTable{}, err
+	}
+	w := NewWriter(writable, p.opts.WriterOptions)
+	for _, e := range b.entries {
+		key := b.buf[e.keyStart:e.valueStart]
+		if e.kind == base.InternalKeyKindDelete {
+			err = w.Delete(key)
+		} else {
+			err = w.Set(key, b.buf[e.valueStart:e.valueEnd])
+		}
+		if err != nil {
+			return writerPoolTable{}, errors.CombineErrors(err, w.Close())
+		}
+	}
+	if err := w.Close(); err != nil {
+		return writerPoolTable{}, err
+	}
+	meta, err := w.Metadata()
+	if err != nil {
+		return writerPoolTable{}, err
+	}
+	return writerPoolTable{
+		index:                b.index,
+		BatchWriterPoolTable: BatchWriterPoolTable{Path: path, Meta: meta},
+	}, nil
+}
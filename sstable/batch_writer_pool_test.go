@@ -0,0 +1,92 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/objstorage"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchWriterPool(t *testing.T) {
+	mem := vfs.NewMem()
+	create := func(i int) (string, objstorage.Writable, error) {
+		path := fmt.Sprintf("%06d.sst", i)
+		f, err := mem.Create(path)
+		if err != nil {
+			return "", nil, err
+		}
+		return path, objstorageprovider.NewFileWritable(f), nil
+	}
+	p := NewBatchWriterPool(BatchWriterPoolOptions{
+		WriterOptions:  WriterOptions{TableFormat: TableFormatPebblev4},
+		TargetFileSize: 10 << 10,
+		Concurrency:    4,
+		Create:         create,
+	})
+	const numKeys = 10000
+	for i := 0; i < numKeys; i++ {
+		key := []byte(fmt.Sprintf("key%05d", i))
+		if i%10 == 0 {
+			require.NoError(t, p.Delete(key))
+		} else {
+			require.NoError(t, p.Set(key, []byte(fmt.Sprint(i))))
+		}
+	}
+	err := p.Set([]byte("key00000"), nil)
+	require.EqualError(t, err, `pebble: keys must be added in strictly increasing order: key09999, key00000`)
+	tables, err := p.Finish()
+	require.NoError(t, err)
+	require.Greater(t, len(tables), 4)
+
+	// The tables are in key order, and hold all of the keys.
+	var i int
+	for j, table := range tables {
+		require.Equal(t, fmt.Sprintf("%06d.sst", j), table.Path)
+		f, err := mem.Open(table.Path)
+		require.NoError(t, err)
+		readable, err := NewSimpleReadable(f)
+		require.NoError(t, err)
+		r, err := NewReader(readable, ReaderOptions{})
+		require.NoError(t, err)
+		require.Equal(t, TableFormatPebblev4, r.tableFormat)
+		require.Equal(t, r.Properties.NumEntries, table.Meta.Properties.NumEntries)
+		require.Equal(t, fmt.Sprintf("key%05d", i), string(table.Meta.SmallestPoint.UserKey))
+		iter, err := r.NewIter(NoTransforms, nil, nil)
+		require.NoError(t, err)
+		for k, v := iter.First(); k != nil; k, v = iter.Next() {
+			require.Equal(t, fmt.Sprintf("key%05d", i), string(k.UserKey))
+			if i%10 == 0 {
+				require.Equal(t, InternalKeyKindDelete, k.Kind())
+			} else {
+				require.Equal(t, fmt.Sprint(i), string(v.InPlaceValue()))
+			}
+			i++
+		}
+		require.NoError(t, iter.Close())
+		require.NoError(t, r.Close())
+	}
+	require.Equal(t, numKeys, i)
+
+	_, err = p.Finish()
+	require.EqualError(t, err, "pebble: BatchWriterPool is finished")
+}
+
+func TestBatchWriterPoolError(t *testing.T) {
+	p := NewBatchWriterPool(BatchWriterPoolOptions{
+		TargetFileSize: 1,
+		Create: func(i int) (string, objstorage.Writable, error) {
+			return "", nil, errors.New("boom")
+		},
+	})
+	require.NoError(t, p.Set([]byte("a"), nil))
+	_, err := p.Finish()
+	require.EqualError(t, err, "pebble: building sstable 0: boom")
+}
@@ -0,0 +1,315 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+// Package blob implements blob files, which hold values that are separated
+// from the sstables referencing them.
+//
+// A blob file is a sequence of value records followed by a fixed-size footer:
+//
+//	+------------------------------+
+//	| length 1 | value 1 | crc 1   |
+//	+------------------------------+
+//	| ...                          |
+//	+------------------------------+
+//	| length n | value n | crc n   |
+//	+------------------------------+
+//	| footer                       |
+//	+------------------------------+
+//
+// Each length is a uvarint, and each crc is the 4-byte little-endian crc.CRC
+// of the value it follows. The footer holds the number of values, their total
+// length, the format version and a magic number identifying the file as a
+// blob file. Values are addressed by a Handle, which is stored by the sstable
+// in place of the value.
+package blob
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/crc"
+	"github.com/cockroachdb/pebble/objstorage"
+)
+
+const (
+	// checksumLen is the length of the checksum following each value.
+	checksumLen = 4
+	// FooterLen is the length of the footer of a blob file.
+	FooterLen = 32
+	// magic identifies a blob file.
+	magic = "\xf0\x9f\xab\x9b\x62\x6c\x6f\x62"
+	// formatVersion is the version of the blob file format.
+	formatVersion = 1
+)
+
+// Handle identifies a value within a blob file. Handles are stored in
+// sstables in place of the values they identify.
+type Handle struct {
+	FileNum  base.DiskFileNum
+	Offset   uint64
+	ValueLen uint32
+}
+
+// MaxHandleLen is the maximum length of an encoded Handle.
+const MaxHandleLen = binary.MaxVarintLen32 + 2*binary.MaxVarintLen64
+
+// Encode appends the encoding of the handle to dst, returning the extended
+// slice. The value length is encoded first, so that it may be decoded
+// without decoding the remainder of the handle (see DecodeValueLen).
+func (h Handle) Encode(dst []byte) []byte {
+	dst = binary.AppendUvarint(dst, uint64(h.ValueLen))
+	dst = binary.AppendUvarint(dst, uint64(h.FileNum))
+	return binary.AppendUvarint(dst, h.Offset)
+}
+
+// DecodeValueLen decodes the value length of a handle encoded by
+// Handle.Encode. It returns false if the encoding is invalid.
+func DecodeValueLen(b []byte) (uint32, bool) {
+	valueLen, n := binary.Uvarint(b)
+	if n <= 0 || valueLen > uint64(^uint32(0)) {
+		return 0, false
+	}
+	return uint32(valueLen), true
+}
+
+// DecodeHandle decodes a handle encoded by Handle.Encode.
+func DecodeHandle(b []byte) (Handle, error) {
+	valueLen, n := binary.Uvarint(b)
+	if n <= 0 || valueLen > uint64(^uint32(0)) {
+		return Handle{}, base.CorruptionErrorf("pebble: invalid blob handle")
+	}
+	b = b[n:]
+	fileNum, n := binary.Uvarint(b)
+	if n <= 0 {
+		return Handle{}, base.CorruptionErrorf("pebble: invalid blob handle")
+	}
+	b = b[n:]
+	offset, n := binary.Uvarint(b)
+	if n <= 0 || n != len(b) {
+		return Handle{}, base.CorruptionErrorf("pebble: invalid blob handle")
+	}
+	return Handle{
+		FileNum:  base.DiskFileNum(fileNum),
+		Offset:   offset,
+		ValueLen: uint32(valueLen),
+	}, nil
+}
+
+// String implements fmt.Stringer.
+func (h Handle) String() string {
+	return fmt.Sprintf("(%s,%d,%d)", h.FileNum, h.Offset, h.ValueLen)
+}
+
+// FileStats describes the values held by a blob file.
+type FileStats struct {
+	// ValueCount is the number of values in the file.
+	ValueCount uint64
+	// ValueBytes is the total length of the values in the file.
+	ValueBytes uint64
+	// FileSize is the size of the file, including checksums and the footer.
+	FileSize uint64
+}
+
+// FileWriter writes a blob file.
+type FileWriter struct {
+	fileNum base.DiskFileNum
+	w       objstorage.Writable
+	stats   FileStats
+	buf     []byte
+	err     error
+}
+
+// NewFileWriter returns a FileWriter that writes the blob file with the given
+// file number to w. The writer takes ownership of w, which is finished by
+// Close.
+func NewFileWriter(fileNum base.DiskFileNum, w objstorage.Writable) *FileWriter {
+	return &FileWriter{fileNum: fileNum, w: w}
+}
+
+// FileNum returns the file number of the blob file being written.
+func (w *FileWriter) FileNum() base.DiskFileNum {
+	return w.fileNum
+}
+
+// Size returns the number of bytes written so far.
+func (w *FileWriter) Size() uint64 {
+	return w.stats.FileSize
+}
+
+// AddValue appends the value to the blob file, returning its handle.
+func (w *FileWriter) AddValue(value []byte) (Handle, error) {
+	if w.err != nil {
+		return Handle{}, w.err
+	}
+	if uint64(len(value)) > uint64(^uint32(0)) {
+		return Handle{}, errors.Errorf("pebble: value of length %d is too large for a blob file", len(value))
+	}
+	w.buf = binary.AppendUvarint(w.buf[:0], uint64(len(value)))
+	h := Handle{
+		FileNum:  w.fileNum,
+		Offset:   w.stats.FileSize + uint64(len(w.buf)),
+		ValueLen: uint32(len(value)),
+	}
+	if w.err = w.w.Write(w.buf); w.err != nil {
+		return Handle{}, w.err
+	}
+	if w.err = w.w.Write(value); w.err != nil {
+		return Handle{}, w.err
+	}
+	w.buf = binary.LittleEndian.AppendUint32(w.buf[:0], crc.New(value).Value())
+	if w.err = w.w.Write(w.buf); w.err != nil {
+		return Handle{}, w.err
+	}
+	w.stats.ValueCount++
+	w.stats.ValueBytes += uint64(len(value))
+	w.stats.FileSize = h.Offset + uint64(len(value)) + checksumLen
+	return h, nil
+}
+
+// Close writes the footer and finishes the file, returning its stats. The
+// file is aborted if an error was encountered.
+func (w *FileWriter) Close() (FileStats, error) {
+	if w.err != nil {
+		w.w.Abort()
+		return FileStats{}, w.err
+	}
+	w.err = errors.New("pebble: blob file writer is closed")
+	footer := encodeFooter(w.stats)
+	if err := w.w.Write(footer[:]); err != nil {
+		w.w.Abort()
+		return FileStats{}, err
+	}
+	w.stats.FileSize += FooterLen
+	if err := w.w.Finish(); err != nil {
+		return FileStats{}, err
+	}
+	return w.stats, nil
+}
+
+// Abort aborts writing the file.
+func (w *FileWriter) Abort() {
+	if w.err == nil {
+		w.err = errors.New("pebble: blob file writer is closed")
+	}
+	w.w.Abort()
+}
+
+func encodeFooter(stats FileStats) (footer [FooterLen]byte) {
+	binary.LittleEndian.PutUint64(footer[0:], stats.ValueCount)
+	binary.LittleEndian.PutUint64(footer[8:], stats.ValueBytes)
+	binary.LittleEndian.PutUint32(footer[16:], formatVersion)
+	// footer[20:24] is reserved.
+	copy(footer[24:], magic)
+	return footer
+}
+
+// FileReader reads values from a blob file.
+type FileReader struct {
+	fileNum base.DiskFileNum
+	r       objstorage.Readable
+	stats   FileStats
+}
+
+// NewFileReader returns a FileReader for the blob file with the given file
+// number. The reader takes ownership of r, which is closed by Close.
+func NewFileReader(
+	ctx context.Context, fileNum base.DiskFileNum, r objstorage.Readable,
+) (*FileReader, error) {
+	size := r.Size()
+	if size < FooterLen {
+		return nil, base.CorruptionErrorf("pebble: blob file %s is too small (%d bytes)", fileNum, size)
+	}
+	var footer [FooterLen]byte
+	if err := r.ReadAt(ctx, footer[:], size-FooterLen); err != nil {
+		return nil, err
+	}
+	if string(footer[24:]) != magic {
+		return nil, base.CorruptionErrorf("pebble: blob file %s has an invalid magic number", fileNum)
+	}
+	if v := binary.LittleEndian.Uint32(footer[16:]); v != formatVersion {
+		return nil, base.CorruptionErrorf("pebble: blob file %s has unsupported version %d", fileNum, v)
+	}
+	stats := FileStats{
+		ValueCount: binary.LittleEndian.Uint64(footer[0:]),
+		ValueBytes: binary.LittleEndian.Uint64(footer[8:]),
+		FileSize:   uint64(size),
+	}
+	if stats.ValueBytes+stats.ValueCount*checksumLen+FooterLen > stats.FileSize {
+		return nil, base.CorruptionErrorf("pebble: blob file %s has an inconsistent footer", fileNum)
+	}
+	return &FileReader{fileNum: fileNum, r: r, stats: stats}, nil
+}
+
+// Stats returns the stats recorded in the file's footer.
+func (r *FileReader) Stats() FileStats {
+	return r.stats
+}
+
+// ReadValue reads the value identified by the handle, verifying its checksum.
+// The value is read into buf if it has sufficient capacity, and into a newly
+// allocated slice otherwise.
+func (r *FileReader) ReadValue(ctx context.Context, h Handle, buf []byte) ([]byte, error) {
+	if h.FileNum != r.fileNum {
+		return nil, errors.AssertionFailedf("pebble: blob handle for %s read from %s", h.FileNum, r.fileNum)
+	}
+	n := uint64(h.ValueLen) + checksumLen
+	if h.Offset+n > r.stats.FileSize-FooterLen {
+		return nil, base.CorruptionErrorf("pebble: blob handle %s is out of bounds of file %s", h, r.fileNum)
+	}
+	if uint64(cap(buf)) < n {
+		buf = make([]byte, n)
+	}
+	buf = buf[:n]
+	if err := r.r.ReadAt(ctx, buf, int64(h.Offset)); err != nil {
+		return nil, err
+	}
+	value := buf[:h.ValueLen]
+	if checksum := binary.LittleEndian.Uint32(buf[h.ValueLen:]); checksum != crc.New(value).Value() {
+		return nil, base.CorruptionErrorf("pebble: blob file %s has a checksum mismatch at offset %d", r.fileNum, h.Offset)
+	}
+	return value, nil
+}
+
+// Iterate invokes fn for each value in the file, in order. Iteration stops
+// at the first error returned by fn.
+func (r *FileReader) Iterate(ctx context.Context, fn func(h Handle, value []byte) error) error {
+	var lenBuf [binary.MaxVarintLen32]byte
+	var buf []byte
+	end := r.stats.FileSize - FooterLen
+	offset := uint64(0)
+	for i := uint64(0); i < r.stats.ValueCount; i++ {
+		n := min(uint64(len(lenBuf)), end-offset)
+		if n == 0 {
+			return base.CorruptionErrorf("pebble: blob file %s ends after %d of %d values",
+				r.fileNum, i, r.stats.ValueCount)
+		}
+		if err := r.r.ReadAt(ctx, lenBuf[:n], int64(offset)); err != nil {
+			return err
+		}
+		valueLen, m := binary.Uvarint(lenBuf[:n])
+		if m <= 0 || valueLen > uint64(^uint32(0)) {
+			return base.CorruptionErrorf("pebble: blob file %s has an invalid value length at offset %d",
+				r.fileNum, offset)
+		}
+		h := Handle{FileNum: r.fileNum, Offset: offset + uint64(m), ValueLen: uint32(valueLen)}
+		v, err := r.ReadValue(ctx, h, buf)
+		if err != nil {
+			return err
+		}
+		if err := fn(h, v); err != nil {
+			return err
+		}
+		buf = v
+		offset = h.Offset + valueLen + checksumLen
+	}
+	return nil
+}
+
+// Close closes the reader.
+func (r *FileReader) Close() error {
+	return r.r.Close()
+}
@@ -0,0 +1,107 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package blob
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/objstorage"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleEncoding(t *testing.T) {
+	for _, h := range []Handle{
+		{},
+		{FileNum: 1, Offset: 1, ValueLen: 1},
+		{FileNum: 1 << 40, Offset: 1 << 50, ValueLen: 1<<32 - 1},
+	} {
+		b := h.Encode(nil)
+		require.LessOrEqual(t, len(b), MaxHandleLen)
+		valueLen, ok := DecodeValueLen(b)
+		require.True(t, ok)
+		require.Equal(t, h.ValueLen, valueLen)
+		decoded, err := DecodeHandle(b)
+		require.NoError(t, err)
+		require.Equal(t, h, decoded)
+
+		// Truncated or extended encodings are invalid.
+		_, err = DecodeHandle(b[:len(b)-1])
+		require.Error(t, err)
+		_, err = DecodeHandle(append(b, 0))
+		require.Error(t, err)
+	}
+}
+
+func TestFileRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	fs := vfs.NewMem()
+	const fileNum = base.DiskFileNum(7)
+
+	provider, err := objstorageprovider.Open(objstorageprovider.DefaultSettings(fs, ""))
+	require.NoError(t, err)
+	defer provider.Close()
+	writable, _, err := provider.Create(ctx, base.FileTypeBlob, fileNum, objstorage.CreateOptions{})
+	require.NoError(t, err)
+	w := NewFileWriter(fileNum, writable)
+	var handles []Handle
+	var values [][]byte
+	for i := 0; i < 100; i++ {
+		v := []byte(fmt.Sprintf("value-%d-%0*d", i, i, 0))
+		h, err := w.AddValue(v)
+		require.NoError(t, err)
+		handles = append(handles, h)
+		values = append(values, v)
+	}
+	stats, err := w.Close()
+	require.NoError(t, err)
+	require.Equal(t, uint64(len(values)), stats.ValueCount)
+
+	open := func() *FileReader {
+		readable, err := provider.OpenForReading(ctx, base.FileTypeBlob, fileNum, objstorage.OpenOptions{})
+		require.NoError(t, err)
+		r, err := NewFileReader(ctx, fileNum, readable)
+		require.NoError(t, err)
+		return r
+	}
+	r := open()
+	require.Equal(t, stats, r.Stats())
+	for i, h := range handles {
+		v, err := r.ReadValue(ctx, h, nil)
+		require.NoError(t, err)
+		require.Equal(t, values[i], v)
+	}
+	var i int
+	require.NoError(t, r.Iterate(ctx, func(h Handle, v []byte) error {
+		require.Equal(t, handles[i], h)
+		require.Equal(t, values[i], v)
+		i++
+		return nil
+	}))
+	require.Equal(t, len(values), i)
+
+	// Handles into other files or beyond the end of the values are rejected.
+	_, err = r.ReadValue(ctx, Handle{FileNum: fileNum + 1, ValueLen: 1}, nil)
+	require.Error(t, err)
+	_, err = r.ReadValue(ctx, Handle{FileNum: fileNum, Offset: stats.FileSize, ValueLen: 1}, nil)
+	require.Error(t, err)
+	require.NoError(t, r.Close())
+
+	// Corrupting a value is detected by its checksum.
+	f, err := fs.OpenReadWrite("000007.blob")
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte{'X'}, int64(handles[3].Offset))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	r = open()
+	_, err = r.ReadValue(ctx, handles[3], nil)
+	require.True(t, errors.Is(err, base.ErrCorruption))
+	require.NoError(t, r.Close())
+}
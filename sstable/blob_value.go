@@ -0,0 +1,87 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/sstable/blob"
+)
+
+// Values of SET keys may be separated from the sstable into blob files, in
+// which case the data block holds a blob handle (see blob.Handle) in place of
+// the value, prefixed by a valuePrefix with valueKindIsBlobHandle. Unlike
+// values in value blocks, the sstable cannot fetch these values itself: they
+// are fetched through ReaderOptions.BlobValueFetcher, which is provided by
+// the DB that manages the blob files.
+//
+// Blob handles are added to a sstable using Writer.AddWithBlobHandle, and
+// require TableFormatPebblev3, since earlier formats don't prefix the values
+// of SETs.
+
+// errNoBlobValueFetcher is returned when fetching a value from a blob file
+// through a Reader without a ReaderOptions.BlobValueFetcher.
+var errNoBlobValueFetcher = errors.New("pebble: sstable has blob values but no blob value fetcher is configured")
+
+// blobValueReader creates the LazyValues for blob handles read by a sstable
+// iterator. Like valueBlockReader, it may outlive the iterator since it's
+// referenced by the LazyValues it creates.
+type blobValueReader struct {
+	fetcher base.ValueFetcher
+	stats   *base.InternalIteratorStats
+	// lazyFetcher is the LazyFetcher value embedded in any LazyValue that we
+	// return.
+	lazyFetcher base.LazyFetcher
+}
+
+var _ base.ValueFetcher = (*blobValueReader)(nil)
+
+func (r *blobValueReader) getLazyValueForPrefixAndBlobHandle(handle []byte) base.LazyValue {
+	// An invalid handle is reported when the value is fetched.
+	valLen, _ := blob.DecodeValueLen(handle[1:])
+	r.lazyFetcher = base.LazyFetcher{
+		Fetcher: r,
+		Attribute: base.AttributeAndLen{
+			ValueLen:       int32(valLen),
+			ShortAttribute: getShortAttribute(valuePrefix(handle[0])),
+		},
+	}
+	if r.stats != nil {
+		r.stats.SeparatedPointValue.Count++
+		r.stats.SeparatedPointValue.ValueBytes += uint64(valLen)
+	}
+	return base.LazyValue{
+		ValueOrHandle: handle[1:],
+		Fetcher:       &r.lazyFetcher,
+	}
+}
+
+// Fetch implements base.ValueFetcher.
+func (r *blobValueReader) Fetch(
+	handle []byte, valLen int32, buf []byte,
+) (val []byte, callerOwned bool, err error) {
+	if r.fetcher == nil {
+		return nil, false, errNoBlobValueFetcher
+	}
+	return r.fetcher.Fetch(handle, valLen, buf)
+}
+
+// BlobHandle returns the blob handle and short attribute of a value returned
+// by a sstable iterator, if the value is stored in a blob file. The value is
+// not fetched, allowing compactions to write the handle to their outputs
+// with Writer.AddWithBlobHandle rather than rewriting the value.
+func BlobHandle(lv base.LazyValue) (blob.Handle, base.ShortAttribute, bool, error) {
+	if lv.Fetcher == nil {
+		return blob.Handle{}, 0, false, nil
+	}
+	if _, ok := lv.Fetcher.Fetcher.(*blobValueReader); !ok {
+		return blob.Handle{}, 0, false, nil
+	}
+	h, err := blob.DecodeHandle(lv.ValueOrHandle)
+	if err != nil {
+		return blob.Handle{}, 0, false, err
+	}
+	return h, lv.Fetcher.Attribute.ShortAttribute, true, nil
+}
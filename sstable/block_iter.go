@@ -181,6 +181,7 @@ type blockIter struct {
 	firstUserKey      []byte
 	lazyValueHandling struct {
 		vbr            *valueBlockReader
+		bvr            *blobValueReader
 		hasValuePrefix bool
 	}
 	synthSuffixBuf            []byte
@@ -651,10 +652,10 @@ func (i *blockIter) SeekGE(key []byte, flags base.SeekGEFlags) (*InternalKey, ba
 		if !i.lazyValueHandling.hasValuePrefix ||
 			base.TrailerKind(i.ikey.Trailer) != InternalKeyKindSet {
 			i.lazyValue = base.MakeInPlaceValue(i.val)
-		} else if i.lazyValueHandling.vbr == nil || !isValueHandle(valuePrefix(i.val[0])) {
+		} else if isInPlaceValue(valuePrefix(i.val[0])) {
 			i.lazyValue = base.MakeInPlaceValue(i.val[1:])
 		} else {
-			i.lazyValue = i.lazyValueHandling.vbr.getLazyValueForPrefixAndValueHandle(i.val)
+			i.lazyValue = i.getLazyValueForPrefixAndHandle()
 		}
 		return &i.ikey, i.lazyValue
 	}
@@ -936,10 +937,10 @@ func (i *blockIter) SeekLT(key []byte, flags base.SeekLTFlags) (*InternalKey, ba
 	if !i.lazyValueHandling.hasValuePrefix ||
 		base.TrailerKind(i.ikey.Trailer) != InternalKeyKindSet {
 		i.lazyValue = base.MakeInPlaceValue(i.val)
-	} else if i.lazyValueHandling.vbr == nil || !isValueHandle(valuePrefix(i.val[0])) {
+	} else if isInPlaceValue(valuePrefix(i.val[0])) {
 		i.lazyValue = base.MakeInPlaceValue(i.val[1:])
 	} else {
-		i.lazyValue = i.lazyValueHandling.vbr.getLazyValueForPrefixAndValueHandle(i.val)
+		i.lazyValue = i.getLazyValueForPrefixAndHandle()
 	}
 	return &i.ikey, i.lazyValue
 }
@@ -965,10 +966,10 @@ func (i *blockIter) First() (*InternalKey, base.LazyValue) {
 	if !i.lazyValueHandling.hasValuePrefix ||
 		base.TrailerKind(i.ikey.Trailer) != InternalKeyKindSet {
 		i.lazyValue = base.MakeInPlaceValue(i.val)
-	} else if i.lazyValueHandling.vbr == nil || !isValueHandle(valuePrefix(i.val[0])) {
+	} else if isInPlaceValue(valuePrefix(i.val[0])) {
 		i.lazyValue = base.MakeInPlaceValue(i.val[1:])
 	} else {
-		i.lazyValue = i.lazyValueHandling.vbr.getLazyValueForPrefixAndValueHandle(i.val)
+		i.lazyValue = i.getLazyValueForPrefixAndHandle()
 	}
 	return &i.ikey, i.lazyValue
 }
@@ -1008,10 +1009,10 @@ func (i *blockIter) Last() (*InternalKey, base.LazyValue) {
 	if !i.lazyValueHandling.hasValuePrefix ||
 		base.TrailerKind(i.ikey.Trailer) != InternalKeyKindSet {
 		i.lazyValue = base.MakeInPlaceValue(i.val)
-	} else if i.lazyValueHandling.vbr == nil || !isValueHandle(valuePrefix(i.val[0])) {
+	} else if isInPlaceValue(valuePrefix(i.val[0])) {
 		i.lazyValue = base.MakeInPlaceValue(i.val[1:])
 	} else {
-		i.lazyValue = i.lazyValueHandling.vbr.getLazyValueForPrefixAndValueHandle(i.val)
+		i.lazyValue = i.getLazyValueForPrefixAndHandle()
 	}
 	return &i.ikey, i.lazyValue
 }
@@ -1067,14 +1068,28 @@ start:
 	if !i.lazyValueHandling.hasValuePrefix ||
 		base.TrailerKind(i.ikey.Trailer) != InternalKeyKindSet {
 		i.lazyValue = base.MakeInPlaceValue(i.val)
-	} else if i.lazyValueHandling.vbr == nil || !isValueHandle(valuePrefix(i.val[0])) {
+	} else if isInPlaceValue(valuePrefix(i.val[0])) {
 		i.lazyValue = base.MakeInPlaceValue(i.val[1:])
 	} else {
-		i.lazyValue = i.lazyValueHandling.vbr.getLazyValueForPrefixAndValueHandle(i.val)
+		i.lazyValue = i.getLazyValueForPrefixAndHandle()
 	}
 	return &i.ikey, i.lazyValue
 }
 
+// getLazyValueForPrefixAndHandle returns the LazyValue for the current SET,
+// whose value is prefixed by a valuePrefix with a value-kind other than
+// valueKindIsInPlaceValue.
+func (i *blockIter) getLazyValueForPrefixAndHandle() base.LazyValue {
+	prefix := valuePrefix(i.val[0])
+	if isValueHandle(prefix) && i.lazyValueHandling.vbr != nil {
+		return i.lazyValueHandling.vbr.getLazyValueForPrefixAndValueHandle(i.val)
+	}
+	if isBlobHandle(prefix) && i.lazyValueHandling.bvr != nil {
+		return i.lazyValueHandling.bvr.getLazyValueForPrefixAndBlobHandle(i.val)
+	}
+	return base.MakeInPlaceValue(i.val[1:])
+}
+
 // NextPrefix implements (base.InternalIterator).NextPrefix.
 func (i *blockIter) NextPrefix(succKey []byte) (*InternalKey, base.LazyValue) {
 	if i.lazyValueHandling.hasValuePrefix {
@@ -1356,10 +1371,10 @@ func (i *blockIter) nextPrefixV3(succKey []byte) (*InternalKey, base.LazyValue)
 			}
 			if base.TrailerKind(i.ikey.Trailer) != InternalKeyKindSet {
 				i.lazyValue = base.MakeInPlaceValue(i.val)
-			} else if i.lazyValueHandling.vbr == nil || !isValueHandle(valuePrefix(i.val[0])) {
+			} else if isInPlaceValue(valuePrefix(i.val[0])) {
 				i.lazyValue = base.MakeInPlaceValue(i.val[1:])
 			} else {
-				i.lazyValue = i.lazyValueHandling.vbr.getLazyValueForPrefixAndValueHandle(i.val)
+				i.lazyValue = i.getLazyValueForPrefixAndHandle()
 			}
 			return &i.ikey, i.lazyValue
 		}
@@ -1412,10 +1427,10 @@ start:
 		if !i.lazyValueHandling.hasValuePrefix ||
 			base.TrailerKind(i.ikey.Trailer) != InternalKeyKindSet {
 			i.lazyValue = base.MakeInPlaceValue(i.val)
-		} else if i.lazyValueHandling.vbr == nil || !isValueHandle(valuePrefix(i.val[0])) {
+		} else if isInPlaceValue(valuePrefix(i.val[0])) {
 			i.lazyValue = base.MakeInPlaceValue(i.val[1:])
 		} else {
-			i.lazyValue = i.lazyValueHandling.vbr.getLazyValueForPrefixAndValueHandle(i.val)
+			i.lazyValue = i.getLazyValueForPrefixAndHandle()
 		}
 		return &i.ikey, i.lazyValue
 	}
@@ -1493,10 +1508,10 @@ start:
 	if !i.lazyValueHandling.hasValuePrefix ||
 		base.TrailerKind(i.ikey.Trailer) != InternalKeyKindSet {
 		i.lazyValue = base.MakeInPlaceValue(i.val)
-	} else if i.lazyValueHandling.vbr == nil || !isValueHandle(valuePrefix(i.val[0])) {
+	} else if isInPlaceValue(valuePrefix(i.val[0])) {
 		i.lazyValue = base.MakeInPlaceValue(i.val[1:])
 	} else {
-		i.lazyValue = i.lazyValueHandling.vbr.getLazyValueForPrefixAndValueHandle(i.val)
+		i.lazyValue = i.getLazyValueForPrefixAndHandle()
 	}
 	return &i.ikey, i.lazyValue
 }
@@ -1524,6 +1539,7 @@ func (i *blockIter) Close() error {
 	i.val = nil
 	i.lazyValue = base.LazyValue{}
 	i.lazyValueHandling.vbr = nil
+	i.lazyValueHandling.bvr = nil
 	return nil
 }
 
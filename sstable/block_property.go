@@ -335,6 +335,21 @@ func (b *BlockIntervalCollector) FinishTable(buf []byte) ([]byte, error) {
 	return b.tableInterval.encode(buf), nil
 }
 
+// DecodeTableInterval decodes the [lower, upper) interval that a
+// BlockIntervalCollector recorded for an entire sstable, given the value of the
+// collector's entry in the sstable's user properties.
+func DecodeTableInterval(prop string) (lower, upper uint64, err error) {
+	// The first byte of the property is the collector's shortID.
+	if len(prop) == 0 {
+		return 0, 0, base.CorruptionErrorf("cannot decode interval from empty property")
+	}
+	var i interval
+	if err := i.decode([]byte(prop[1:])); err != nil {
+		return 0, 0, err
+	}
+	return i.lower, i.upper, nil
+}
+
 type interval struct {
 	lower uint64
 	upper uint64
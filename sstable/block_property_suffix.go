@@ -0,0 +1,135 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// MaxFixedWidthSuffixWidth is the maximum width of the suffixes decoded by
+// DecodeFixedWidthSuffix.
+const MaxFixedWidthSuffixWidth = 8
+
+// DecodeFixedWidthSuffix decodes the last width bytes of a key suffix, as
+// returned by Split, as a big-endian unsigned integer. It returns false if
+// the suffix is shorter than width bytes, which includes the empty suffix, in
+// which case the suffix cannot be decoded. The width must be in [1,
+// MaxFixedWidthSuffixWidth].
+func DecodeFixedWidthSuffix(suffix []byte, width int) (uint64, bool) {
+	if len(suffix) < width {
+		return 0, false
+	}
+	var buf [MaxFixedWidthSuffixWidth]byte
+	copy(buf[MaxFixedWidthSuffixWidth-width:], suffix[len(suffix)-width:])
+	return binary.BigEndian.Uint64(buf[:]), true
+}
+
+func validateFixedWidthSuffixWidth(width int) error {
+	if width < 1 || width > MaxFixedWidthSuffixWidth {
+		return errors.Errorf("pebble: fixed-width suffix width %d must be in [1, %d]",
+			errors.Safe(width), errors.Safe(MaxFixedWidthSuffixWidth))
+	}
+	return nil
+}
+
+// NewFixedWidthSuffixCollector constructs a BlockPropertyCollector, with the
+// given name, that collects the interval of the suffixes of the point keys of
+// each block, decoded by DecodeFixedWidthSuffix, such as the timestamps of
+// MVCC keys. A block containing a key whose suffix cannot be decoded is
+// collected as the interval [0, math.MaxUint64), so that it's never excluded
+// by a filter. The blocks can be filtered by NewFixedWidthSuffixFilter.
+//
+// NewFixedWidthSuffixCollector panics if width isn't in [1,
+// MaxFixedWidthSuffixWidth].
+func NewFixedWidthSuffixCollector(name string, split Split, width int) BlockPropertyCollector {
+	if err := validateFixedWidthSuffixWidth(width); err != nil {
+		panic(err)
+	}
+	return NewBlockIntervalCollector(name, &fixedWidthSuffixIntervalCollector{
+		split: split,
+		width: width,
+	}, nil)
+}
+
+// NewFixedWidthSuffixFilter constructs a BlockPropertyFilter that excludes
+// the blocks, collected by the NewFixedWidthSuffixCollector with the given
+// name, that only contain keys with suffixes outside of [lower, upper). The
+// filter supports synthetic suffixes of the same width.
+//
+// NewFixedWidthSuffixFilter panics if width isn't in [1,
+// MaxFixedWidthSuffixWidth].
+func NewFixedWidthSuffixFilter(name string, width int, lower, upper uint64) *BlockIntervalFilter {
+	if err := validateFixedWidthSuffixWidth(width); err != nil {
+		panic(err)
+	}
+	return NewBlockIntervalFilter(name, lower, upper, fixedWidthSuffixSyntheticReplacer{width: width})
+}
+
+var _ DataBlockIntervalCollector = (*fixedWidthSuffixIntervalCollector)(nil)
+
+// fixedWidthSuffixIntervalCollector maintains an interval over the fixed-width
+// suffixes of the keys of a block.
+type fixedWidthSuffixIntervalCollector struct {
+	split        Split
+	width        int
+	initialized  bool
+	lower, upper uint64
+}
+
+// Add implements DataBlockIntervalCollector.
+func (c *fixedWidthSuffixIntervalCollector) Add(key base.InternalKey, value []byte) error {
+	v, ok := DecodeFixedWidthSuffix(key.UserKey[c.split(key.UserKey):], c.width)
+	if !ok {
+		c.initialized = true
+		c.lower, c.upper = 0, math.MaxUint64
+		return nil
+	}
+	// The interval is exclusive of its upper bound: the suffix math.MaxUint64
+	// is collected as the interval [math.MaxUint64-1, math.MaxUint64).
+	upper := v + 1
+	if v == math.MaxUint64 {
+		v, upper = math.MaxUint64-1, math.MaxUint64
+	}
+	if !c.initialized {
+		c.lower, c.upper = v, upper
+		c.initialized = true
+		return nil
+	}
+	c.lower = min(c.lower, v)
+	c.upper = max(c.upper, upper)
+	return nil
+}
+
+// FinishDataBlock implements DataBlockIntervalCollector.
+func (c *fixedWidthSuffixIntervalCollector) FinishDataBlock() (lower, upper uint64, err error) {
+	l, u := c.lower, c.upper
+	c.lower, c.upper = 0, 0
+	c.initialized = false
+	return l, u, nil
+}
+
+var _ BlockIntervalSyntheticReplacer = fixedWidthSuffixSyntheticReplacer{}
+
+type fixedWidthSuffixSyntheticReplacer struct {
+	width int
+}
+
+// AdjustIntervalWithSyntheticSuffix implements BlockIntervalSyntheticReplacer.
+func (r fixedWidthSuffixSyntheticReplacer) AdjustIntervalWithSyntheticSuffix(
+	lower uint64, upper uint64, suffix []byte,
+) (adjustedLower uint64, adjustedUpper uint64, err error) {
+	v, ok := DecodeFixedWidthSuffix(suffix, r.width)
+	if !ok {
+		return 0, 0, base.AssertionFailedf("synthetic suffix %x cannot be decoded", suffix)
+	}
+	if v == math.MaxUint64 {
+		return math.MaxUint64 - 1, math.MaxUint64, nil
+	}
+	return v, v + 1, nil
+}
@@ -282,6 +282,56 @@ func TestBlockIntervalFilter(t *testing.T) {
 	}
 }
 
+func TestFixedWidthSuffixCollector(t *testing.T) {
+	// Keys are a one-byte prefix followed by a two-byte suffix.
+	split := func(key []byte) int { return min(len(key), 1) }
+	key := func(prefix byte, suffix uint16) InternalKey {
+		k := []byte{prefix, 0, 0}
+		binary.BigEndian.PutUint16(k[1:], suffix)
+		return base.MakeInternalKey(k, 1, InternalKeyKindSet)
+	}
+	c := NewFixedWidthSuffixCollector("suffixes", split, 2)
+	require.Equal(t, "suffixes", c.Name())
+	finish := func(keys ...InternalKey) []byte {
+		for _, k := range keys {
+			require.NoError(t, c.Add(k, nil))
+		}
+		prop, err := c.FinishDataBlock(nil)
+		require.NoError(t, err)
+		c.AddPrevDataBlockToIndexBlock()
+		return prop
+	}
+	intersects := func(prop []byte, lower, upper uint64) bool {
+		ok, err := NewFixedWidthSuffixFilter("suffixes", 2, lower, upper).Intersects(prop)
+		require.NoError(t, err)
+		return ok
+	}
+
+	prop := finish(key('a', 10), key('b', 3), key('c', 7))
+	require.True(t, intersects(prop, 3, 4))
+	require.True(t, intersects(prop, 10, 20))
+	require.False(t, intersects(prop, 0, 3))
+	require.False(t, intersects(prop, 11, 20))
+
+	// A key whose suffix cannot be decoded makes the block match every filter.
+	prop = finish(key('a', 10), InternalKey{UserKey: []byte("b"), Trailer: key('b', 0).Trailer})
+	require.True(t, intersects(prop, 0, 1))
+	require.True(t, intersects(prop, 100, 200))
+
+	// Synthetic suffixes replace the interval of the block.
+	ok, err := NewFixedWidthSuffixFilter("suffixes", 2, 20, 30).SyntheticSuffixIntersects(
+		finish(key('a', 10)), []byte{0, 25})
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	v, ok := DecodeFixedWidthSuffix([]byte{'@', 1, 2}, 2)
+	require.True(t, ok)
+	require.Equal(t, uint64(0x0102), v)
+	_, ok = DecodeFixedWidthSuffix([]byte{1}, 2)
+	require.False(t, ok)
+	require.Panics(t, func() { NewFixedWidthSuffixCollector("suffixes", split, 9) })
+}
+
 func TestBlockPropertiesEncoderDecoder(t *testing.T) {
 	var encoder blockPropertiesEncoder
 	scratch := encoder.getScratchForProp()
@@ -59,6 +59,7 @@ func CopySpan(
 	if r.tableFilter == nil {
 		o.FilterPolicy = nil
 	}
+	o.PrefixExtractor = r.prefixExtractor
 	o.TableFormat = r.tableFormat
 	w := NewWriter(output, o)
 
@@ -16,6 +16,7 @@ import (
 	"unsafe"
 
 	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/sstable/blob"
 )
 
 // Layout describes the block organization of an sstable.
@@ -220,11 +221,18 @@ func (l *Layout) Describe(
 						v := value.InPlaceValue()
 						if base.TrailerKind(key.Trailer) != InternalKeyKindSet {
 							fmtRecord(key, v)
-						} else if !isValueHandle(valuePrefix(v[0])) {
-							fmtRecord(key, v[1:])
-						} else {
+						} else if isValueHandle(valuePrefix(v[0])) {
 							vh := decodeValueHandle(v[1:])
 							fmtRecord(key, []byte(fmt.Sprintf("value handle %+v", vh)))
+						} else if isBlobHandle(valuePrefix(v[0])) {
+							h, err := blob.DecodeHandle(v[1:])
+							if err != nil {
+								fmtRecord(key, []byte(fmt.Sprintf("blob handle [err: %s]", err)))
+							} else {
+								fmtRecord(key, []byte(fmt.Sprintf("blob handle %s", h)))
+							}
+						} else {
+							fmtRecord(key, v[1:])
 						}
 					}
 				}
@@ -5,6 +5,8 @@
 package sstable
 
 import (
+	"context"
+
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/cache"
 )
@@ -61,6 +63,9 @@ type FilterWriter = base.FilterWriter
 // FilterPolicy exports the base.FilterPolicy type.
 type FilterPolicy = base.FilterPolicy
 
+// PrefixExtractor exports the base.PrefixExtractor type.
+type PrefixExtractor = base.PrefixExtractor
+
 // ReaderOptions holds the parameters needed for reading an sstable.
 type ReaderOptions struct {
 	// Cache is used to cache uncompressed blocks from sstables.
@@ -87,6 +92,11 @@ type ReaderOptions struct {
 	// map during normal usage of a DB.
 	Filters map[string]FilterPolicy
 
+	// PrefixExtractor is the prefix extractor with which the filters of tables
+	// that record a prefix extractor were written. The filters of tables that
+	// record a different prefix extractor are ignored.
+	PrefixExtractor *PrefixExtractor
+
 	// Merger defines the associative merge operation to use for merging values
 	// written with {Batch,DB}.Merge. The MergerName is checked for consistency
 	// with the value stored in the sstable when it was written.
@@ -94,6 +104,41 @@ type ReaderOptions struct {
 
 	// Logger is an optional logger and tracer.
 	LoggerAndTracer base.LoggerAndTracer
+
+	// BlobValueFetcher fetches values that are stored in blob files, given
+	// their encoded blob.Handle. It's required to read the values of tables
+	// containing blob handles (see Writer.AddWithBlobHandle), and is provided
+	// by the DB that manages the blob files.
+	BlobValueFetcher base.ValueFetcher
+
+	// CorruptBlockHandler, if set, is consulted when a block read from the
+	// table fails its checksum, to recover the block instead of failing the
+	// read.
+	CorruptBlockHandler CorruptBlockHandler
+}
+
+// CorruptBlock describes a block of a table that failed its checksum.
+type CorruptBlock struct {
+	// FileNum is the file number of the table.
+	FileNum base.DiskFileNum
+	// Handle is the handle of the block, whose contents are followed in the
+	// table by a 5-byte trailer holding the block type and checksum.
+	Handle BlockHandle
+	// Err is the checksum mismatch error.
+	Err error
+}
+
+// CorruptBlockHandler recovers the blocks of tables that failed their
+// checksum. Its methods may be called concurrently.
+type CorruptBlockHandler interface {
+	// RecoverBlock returns the contents of the corrupt block followed by its
+	// trailer, Handle.Length+5 bytes, to use in place of the ones read from the
+	// table, or an error if they cannot be recovered. The recovered contents
+	// are validated against the checksum of their trailer.
+	RecoverBlock(ctx context.Context, b CorruptBlock) ([]byte, error)
+	// ReportCorruptBlock is called once the recovery of the block completed,
+	// with the error that prevented it, or nil if the block was recovered.
+	ReportCorruptBlock(b CorruptBlock, err error)
 }
 
 func (o ReaderOptions) ensureDefaults() ReaderOptions {
@@ -170,6 +215,14 @@ type WriterOptions struct {
 	// filters should be preferred except under constrained memory situations.
 	FilterType FilterType
 
+	// PrefixExtractor, if set, extracts the prefixes added to the filter from
+	// the prefixes returned by Comparer.Split. Its name is recorded in the
+	// table's properties.
+	//
+	// The default value means the filter holds the prefixes returned by
+	// Comparer.Split.
+	PrefixExtractor *PrefixExtractor
+
 	// IndexBlockSize is the target uncompressed size in bytes of each index
 	// block. When the index block size is larger than this target, two-level
 	// indexes are automatically enabled. Setting this option to a large value
@@ -230,6 +283,16 @@ type WriterOptions struct {
 	// 750MB sstables -- see
 	// https://github.com/cockroachdb/cockroach/issues/117113).
 	DisableValueBlocks bool
+
+	// Unsafe holds options that allow the construction of invalid sstables.
+	// They're intended for generating test fixtures (see
+	// tool/make_test_sstables.go and the sstable create tool command), and must
+	// not be used to write sstables that are read by a DB.
+	Unsafe struct {
+		// DisableKeyOrderChecks disables the checks that keys are added to the
+		// sstable in order.
+		DisableKeyOrderChecks bool
+	}
 }
 
 func (o WriterOptions) ensureDefaults() WriterOptions {
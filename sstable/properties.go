@@ -44,6 +44,10 @@ func generateTagMaps(t reflect.Type, indexPrefix []int) {
 			case reflect.Uint32:
 			case reflect.Uint64:
 			case reflect.String:
+			case reflect.Slice:
+				if f.Type != reflect.TypeOf(SizeHistogram(nil)) {
+					panic(fmt.Sprintf("unsupported property field type: %s %s", f.Name, f.Type))
+				}
 			default:
 				panic(fmt.Sprintf("unsupported property field type: %s %s", f.Name, f.Type))
 			}
@@ -125,12 +129,21 @@ type Properties struct {
 	// fields of CommonProperties in Properties.
 	CommonProperties `prop:"pebble.embbeded_common_properties"`
 
+	// The total length of the values stored in blob files. Only serialized if
+	// > 0.
+	BlobValuesSize uint64 `prop:"pebble.blob-values.size"`
 	// The name of the comparer used in this table.
 	ComparerName string `prop:"rocksdb.comparator"`
+	// The histogram of the sizes of the data blocks, once compressed, excluding
+	// the block trailers. Only serialized if non-empty.
+	CompressedDataBlockSizes SizeHistogram `prop:"pebble.compressed-data-block.sizes"`
 	// The compression algorithm used to compress blocks.
 	CompressionName string `prop:"rocksdb.compression"`
 	// The compression options used to compress blocks.
 	CompressionOptions string `prop:"rocksdb.compression_options"`
+	// The histogram of the uncompressed sizes of the data blocks. Only
+	// serialized if non-empty.
+	DataBlockSizes SizeHistogram `prop:"pebble.data-block.sizes"`
 	// The total size of all data blocks.
 	DataSize uint64 `prop:"rocksdb.data.size"`
 	// The external sstable version format. Version 2 is the one RocksDB has been
@@ -151,6 +164,9 @@ type Properties struct {
 	// For formats >= TableFormatPebblev4, this is set to true if the obsolete
 	// bit is strict for all the point keys.
 	IsStrictObsolete bool `prop:"pebble.obsolete.is_strict"`
+	// The histogram of the user key sizes of the point keys. Only serialized if
+	// non-empty.
+	KeySizes SizeHistogram `prop:"pebble.key.sizes"`
 	// The name of the merger used in this table. Empty if no merger is used.
 	MergerName string `prop:"rocksdb.merge.operator"`
 	// The number of blocks in this table.
@@ -159,10 +175,16 @@ type Properties struct {
 	NumMergeOperands uint64 `prop:"rocksdb.merge.operands"`
 	// The number of RANGEKEYUNSETs in this table.
 	NumRangeKeyUnsets uint64 `prop:"pebble.num.range-key-unsets"`
+	// The number of values stored in blob files. Only serialized if > 0.
+	NumBlobValues uint64 `prop:"pebble.num.blob-values"`
 	// The number of value blocks in this table. Only serialized if > 0.
 	NumValueBlocks uint64 `prop:"pebble.num.value-blocks"`
 	// The number of values stored in value blocks. Only serialized if > 0.
 	NumValuesInValueBlocks uint64 `prop:"pebble.num.values.in.value-blocks"`
+	// The name of the prefix extractor whose prefixes are held by the table's
+	// filter. Empty (or "nullptr", in tables written by RocksDB) if the filter
+	// holds the prefixes returned by Comparer.Split, or if there is no filter.
+	PrefixExtractorName string `prop:"rocksdb.prefix.extractor.name"`
 	// A comma separated list of names of the property collectors used in this
 	// table.
 	PropertyCollectorNames string `prop:"rocksdb.property.collectors"`
@@ -180,6 +202,9 @@ type Properties struct {
 	SnapshotPinnedValueSize uint64 `prop:"pebble.raw.snapshot-pinned-values.size"`
 	// Size of the top-level index if kTwoLevelIndexSearch is used.
 	TopLevelIndexSize uint64 `prop:"rocksdb.top-level.index.size"`
+	// The histogram of the value sizes of the point keys carrying values (SET,
+	// SETWITHDEL and MERGE). Only serialized if non-empty.
+	ValueSizes SizeHistogram `prop:"pebble.value.sizes"`
 	// User collected properties. Currently, we only use them to store block
 	// properties aggregated at the table level.
 	UserProperties map[string]string
@@ -216,8 +241,7 @@ func writeProperties(loaded map[uintptr]struct{}, v reflect.Value, buf *bytes.Bu
 		}
 
 		f := v.Field(i)
-		// TODO(peter): Use f.IsZero() when we can rely on go1.13.
-		if zero := reflect.Zero(f.Type()); zero.Interface() == f.Interface() {
+		if f.IsZero() {
 			// Skip printing of zero values which were not loaded from disk.
 			if _, ok := loaded[ft.Offset]; !ok {
 				continue
@@ -234,6 +258,8 @@ func writeProperties(loaded map[uintptr]struct{}, v reflect.Value, buf *bytes.Bu
 			fmt.Fprintf(buf, "%d\n", f.Uint())
 		case reflect.String:
 			fmt.Fprintf(buf, "%s\n", f.String())
+		case reflect.Slice:
+			fmt.Fprintf(buf, "%s\n", f.Interface().(SizeHistogram))
 		default:
 			panic("not reached")
 		}
@@ -281,6 +307,12 @@ func (p *Properties) load(
 				field.SetUint(n)
 			case reflect.String:
 				field.SetString(intern.Bytes(i.Value()))
+			case reflect.Slice:
+				h, err := decodeSizeHistogram(i.Value())
+				if err != nil {
+					return err
+				}
+				field.Set(reflect.ValueOf(h))
 			default:
 				panic("not reached")
 			}
@@ -326,6 +358,10 @@ func (p *Properties) saveUvarint(m map[string][]byte, offset uintptr, value uint
 	m[propOffsetTagMap[offset]] = buf[:n]
 }
 
+func (p *Properties) saveSizeHistogram(m map[string][]byte, offset uintptr, value SizeHistogram) {
+	m[propOffsetTagMap[offset]] = value.encode(nil)
+}
+
 func (p *Properties) saveString(m map[string][]byte, offset uintptr, value string) {
 	m[propOffsetTagMap[offset]] = []byte(value)
 }
@@ -390,12 +426,19 @@ func (p *Properties) save(tblFormat TableFormat, w *rawBlockWriter) {
 		p.saveUvarint(m, unsafe.Offsetof(p.RawRangeKeyKeySize), p.RawRangeKeyKeySize)
 		p.saveUvarint(m, unsafe.Offsetof(p.RawRangeKeyValueSize), p.RawRangeKeyValueSize)
 	}
+	if p.NumBlobValues > 0 {
+		p.saveUvarint(m, unsafe.Offsetof(p.NumBlobValues), p.NumBlobValues)
+		p.saveUvarint(m, unsafe.Offsetof(p.BlobValuesSize), p.BlobValuesSize)
+	}
 	if p.NumValueBlocks > 0 {
 		p.saveUvarint(m, unsafe.Offsetof(p.NumValueBlocks), p.NumValueBlocks)
 	}
 	if p.NumValuesInValueBlocks > 0 {
 		p.saveUvarint(m, unsafe.Offsetof(p.NumValuesInValueBlocks), p.NumValuesInValueBlocks)
 	}
+	if p.PrefixExtractorName != "" {
+		p.saveString(m, unsafe.Offsetof(p.PrefixExtractorName), p.PrefixExtractorName)
+	}
 	if p.PropertyCollectorNames != "" {
 		p.saveString(m, unsafe.Offsetof(p.PropertyCollectorNames), p.PropertyCollectorNames)
 	}
@@ -409,6 +452,20 @@ func (p *Properties) save(tblFormat TableFormat, w *rawBlockWriter) {
 	if p.ValueBlocksSize > 0 {
 		p.saveUvarint(m, unsafe.Offsetof(p.ValueBlocksSize), p.ValueBlocksSize)
 	}
+	if tblFormat >= TableFormatPebblev1 {
+		if len(p.KeySizes) > 0 {
+			p.saveSizeHistogram(m, unsafe.Offsetof(p.KeySizes), p.KeySizes)
+		}
+		if len(p.ValueSizes) > 0 {
+			p.saveSizeHistogram(m, unsafe.Offsetof(p.ValueSizes), p.ValueSizes)
+		}
+		if len(p.DataBlockSizes) > 0 {
+			p.saveSizeHistogram(m, unsafe.Offsetof(p.DataBlockSizes), p.DataBlockSizes)
+		}
+		if len(p.CompressedDataBlockSizes) > 0 {
+			p.saveSizeHistogram(m, unsafe.Offsetof(p.CompressedDataBlockSizes), p.CompressedDataBlockSizes)
+		}
+	}
 
 	if tblFormat < TableFormatPebblev1 {
 		m["rocksdb.column.family.id"] = binary.AppendUvarint([]byte(nil), math.MaxInt32)
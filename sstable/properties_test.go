@@ -27,15 +27,19 @@ func TestPropertiesLoad(t *testing.T) {
 			RawKeySize:        23938,
 			RawValueSize:      1912,
 		},
-		ComparerName:           "leveldb.BytewiseComparator",
-		CompressionName:        "Snappy",
-		CompressionOptions:     "window_bits=-14; level=32767; strategy=0; max_dict_bytes=0; zstd_max_train_bytes=0; enabled=0; ",
-		DataSize:               13913,
-		ExternalFormatVersion:  2,
-		IndexSize:              325,
-		MergerName:             "nullptr",
-		NumDataBlocks:          14,
-		PropertyCollectorNames: "[]",
+		ComparerName:             "leveldb.BytewiseComparator",
+		CompressedDataBlockSizes: SizeHistogram{8: 1, 10: 2, 11: 11},
+		CompressionName:          "Snappy",
+		CompressionOptions:       "window_bits=-14; level=32767; strategy=0; max_dict_bytes=0; zstd_max_train_bytes=0; enabled=0; ",
+		DataBlockSizes:           SizeHistogram{8: 1, 11: 13},
+		DataSize:                 13913,
+		ExternalFormatVersion:    2,
+		IndexSize:                325,
+		KeySizes:                 SizeHistogram{1: 9, 2: 156, 3: 1197, 4: 348},
+		MergerName:               "nullptr",
+		NumDataBlocks:            14,
+		PropertyCollectorNames:   "[]",
+		ValueSizes:               SizeHistogram{1: 1595, 2: 115},
 	}
 
 	{
@@ -66,6 +70,7 @@ var testProps = Properties{
 		RawKeySize:        25,
 		RawValueSize:      26,
 	},
+	BlobValuesSize:         28,
 	ComparerName:           "comparator name",
 	CompressionName:        "compression name",
 	CompressionOptions:     "compression option",
@@ -80,11 +85,16 @@ var testProps = Properties{
 	MergerName:             "merge operator name",
 	NumDataBlocks:          14,
 	NumMergeOperands:       17,
+	NumBlobValues:          29,
 	NumRangeKeyUnsets:      21,
 	NumValueBlocks:         22,
 	NumValuesInValueBlocks: 23,
+	PrefixExtractorName:    "prefix extractor name",
 	PropertyCollectorNames: "prefix collector names",
 	TopLevelIndexSize:      27,
+	KeySizes:               SizeHistogram{0, 30, 31},
+	ValueSizes:             SizeHistogram{32, 0, 33},
+	DataBlockSizes:         SizeHistogram{12: 34},
 	UserProperties: map[string]string{
 		"user-prop-a": "1",
 		"user-prop-b": "2",
@@ -118,6 +128,18 @@ func TestPropertiesSave(t *testing.T) {
 		if props.IndexPartitions == 0 {
 			props.TopLevelIndexSize = 0
 		}
+		// Empty histograms aren't saved, and the trailing empty buckets of
+		// histograms are trimmed.
+		for _, h := range []*SizeHistogram{
+			&props.KeySizes, &props.ValueSizes, &props.DataBlockSizes, &props.CompressedDataBlockSizes,
+		} {
+			for len(*h) > 0 && (*h)[len(*h)-1] == 0 {
+				*h = (*h)[:len(*h)-1]
+			}
+			if len(*h) == 0 {
+				*h = nil
+			}
+		}
 		check1(&props)
 	}
 }
@@ -135,3 +157,24 @@ func BenchmarkPropertiesLoad(b *testing.B) {
 		require.NoError(b, p.load(block, 0, nil))
 	}
 }
+
+func TestSizeHistogram(t *testing.T) {
+	var h SizeHistogram
+	for _, size := range []uint64{0, 1, 2, 3, 4, 7, 1 << 10, 1<<11 - 1} {
+		h.Record(size)
+	}
+	require.Equal(t, SizeHistogram{1, 1, 2, 2, 0, 0, 0, 0, 0, 0, 0, 2}, h)
+	require.Equal(t, uint64(8), h.Count())
+	require.Equal(t, "[0B,1B):1 [1B,2B):1 [2B,4B):2 [4B,8B):2 [1.0KB,2.0KB):2", h.String())
+
+	var m SizeHistogram
+	m.Merge(SizeHistogram{0, 3})
+	m.Merge(h)
+	require.Equal(t, SizeHistogram{1, 4, 2, 2, 0, 0, 0, 0, 0, 0, 0, 2}, m)
+
+	decoded, err := decodeSizeHistogram(append(h, 0, 0).encode(nil))
+	require.NoError(t, err)
+	require.Equal(t, h, decoded)
+	_, err = decodeSizeHistogram([]byte{0x80})
+	require.Error(t, err)
+}
@@ -246,6 +246,9 @@ type Reader struct {
 	FormatKey         base.FormatKey
 	Split             Split
 	tableFilter       *tableFilterReader
+	// prefixExtractor is the prefix extractor with which the table's filter was
+	// written, if any.
+	prefixExtractor *PrefixExtractor
 	// Keep types that are not multiples of 8 bytes at the end and with
 	// decreasing size.
 	Properties    Properties
@@ -620,6 +623,8 @@ func (r *Reader) readBlock(
 		if stats != nil {
 			stats.BlockBytes += bh.Length
 			stats.BlockBytesInCache += bh.Length
+			stats.BlockReads++
+			stats.BlockReadsInCache++
 		}
 		if iterStats != nil {
 			iterStats.reportStats(bh.Length, bh.Length, 0)
@@ -669,8 +674,10 @@ func (r *Reader) readBlock(
 		return bufferHandle{}, err
 	}
 	if err := checkChecksum(r.checksumType, compressed.get(), bh, r.fileNum); err != nil {
-		compressed.release()
-		return bufferHandle{}, err
+		if err := r.recoverCorruptBlock(ctx, bh, compressed.get(), err); err != nil {
+			compressed.release()
+			return bufferHandle{}, err
+		}
 	}
 
 	typ := blockType(compressed.get()[bh.Length])
@@ -697,6 +704,9 @@ func (r *Reader) readBlock(
 			return bufferHandle{}, err
 		}
 		compressed.release()
+		if stats != nil {
+			stats.BlockBytesDecompressed += uint64(decodedLen)
+		}
 	}
 
 	if transform != nil {
@@ -721,6 +731,7 @@ func (r *Reader) readBlock(
 
 	if stats != nil {
 		stats.BlockBytes += bh.Length
+		stats.BlockReads++
 	}
 	if iterStats != nil {
 		iterStats.reportStats(bh.Length, 0, readDuration)
@@ -732,6 +743,34 @@ func (r *Reader) readBlock(
 	return bufferHandle{h: h}, nil
 }
 
+// recoverCorruptBlock overwrites b, the contents of a block followed by its
+// trailer which failed their checksum with corruptionErr, with the contents
+// recovered by ReaderOptions.CorruptBlockHandler. It returns corruptionErr if
+// the block cannot be recovered.
+func (r *Reader) recoverCorruptBlock(
+	ctx context.Context, bh BlockHandle, b []byte, corruptionErr error,
+) error {
+	h := r.opts.CorruptBlockHandler
+	if h == nil {
+		return corruptionErr
+	}
+	cb := CorruptBlock{FileNum: r.fileNum, Handle: bh, Err: corruptionErr}
+	recovered, err := h.RecoverBlock(ctx, cb)
+	if err == nil && len(recovered) != len(b) {
+		err = errors.Errorf("pebble/table: recovered block has length %d, expected %d",
+			errors.Safe(len(recovered)), errors.Safe(len(b)))
+	}
+	if err == nil {
+		copy(b, recovered)
+		err = checkChecksum(r.checksumType, b, bh, r.fileNum)
+	}
+	h.ReportCorruptBlock(cb, err)
+	if err != nil {
+		return errors.WithSecondaryError(corruptionErr, err)
+	}
+	return nil
+}
+
 func (r *Reader) transformRangeDelV1(b []byte) ([]byte, error) {
 	// Convert v1 (RocksDB format) range-del blocks to v2 blocks on the fly. The
 	// v1 format range-del blocks have unfragmented and unsorted range
@@ -887,9 +926,27 @@ func (r *Reader) readMetaindex(metaindexBH BlockHandle) error {
 			break
 		}
 	}
+	if name := r.Properties.PrefixExtractorName; name != "" && name != "nullptr" && r.tableFilter != nil {
+		// The filter holds the prefixes returned by a prefix extractor, which is
+		// only usable if it's the one we're configured with.
+		if r.opts.PrefixExtractor != nil && r.opts.PrefixExtractor.Name == name {
+			r.prefixExtractor = r.opts.PrefixExtractor
+		} else {
+			r.tableFilter = nil
+		}
+	}
 	return nil
 }
 
+// filterKey returns the key with which the table's filter is checked for the
+// given prefix.
+func (r *Reader) filterKey(prefix []byte) []byte {
+	if r.prefixExtractor != nil {
+		return r.prefixExtractor.FilterKey(prefix)
+	}
+	return prefix
+}
+
 // Layout returns the layout (block organization) for an sstable.
 func (r *Reader) Layout() (*Layout, error) {
 	if r.err != nil {
@@ -1182,6 +1239,197 @@ func (r *Reader) EstimateDiskUsage(start, end []byte) (uint64, error) {
 		endBH.Offset + endBH.Length + blockTrailerLen - startBH.Offset), nil
 }
 
+// ForEachDataBlock calls fn for each of the data blocks of the table, in key
+// order, with the user key of the separator of the block in the index and the
+// handle of the block. The separator is >= the keys of the block and < the keys
+// of the following block; it's only valid for the duration of the call. Only
+// the index blocks are loaded.
+func (r *Reader) ForEachDataBlock(fn func(separator []byte, bh BlockHandle) error) error {
+	if r.err != nil {
+		return r.err
+	}
+
+	indexH, err := r.readIndex(context.Background(), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer indexH.Release()
+
+	forEach := func(index block) error {
+		iter, err := newBlockIter(r.Compare, r.Split, index, NoTransforms)
+		if err != nil {
+			return err
+		}
+		for key, value := iter.First(); key != nil; key, value = iter.Next() {
+			dataBH, err := decodeBlockHandleWithProperties(value.InPlaceValue())
+			if err != nil {
+				return errCorruptIndexEntry(err)
+			}
+			if err := fn(key.UserKey, dataBH.BlockHandle); err != nil {
+				return err
+			}
+		}
+		return iter.Close()
+	}
+	if r.Properties.IndexPartitions == 0 {
+		return forEach(indexH.Get())
+	}
+	topIter, err := newBlockIter(r.Compare, r.Split, indexH.Get(), NoTransforms)
+	if err != nil {
+		return err
+	}
+	for key, value := topIter.First(); key != nil; key, value = topIter.Next() {
+		indexBH, err := decodeBlockHandleWithProperties(value.InPlaceValue())
+		if err != nil {
+			return errCorruptIndexEntry(err)
+		}
+		subIndex, err := r.readBlock(context.Background(), indexBH.BlockHandle,
+			nil /* transform */, nil /* readHandle */, nil /* stats */, nil /* iterStats */, nil /* buffer pool */)
+		if err != nil {
+			return err
+		}
+		err = forEach(subIndex.Get())
+		subIndex.Release()
+		if err != nil {
+			return err
+		}
+	}
+	return topIter.Close()
+}
+
+// PinBlocks pins blocks of the table in the block cache, so that they're never
+// evicted to make room for other blocks, returning the total size of the
+// pinned blocks. The index, filter, range deletion and range key blocks are
+// always pinned, along with the data blocks that may hold keys within any of
+// dataBounds. Value blocks aren't pinned. The blocks remain pinned until
+// Cache.UnpinFile or Cache.EvictFile is called for the table.
+func (r *Reader) PinBlocks(ctx context.Context, dataBounds []base.UserKeyBounds) (uint64, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	var size uint64
+	pinned := make(map[uint64]struct{})
+	pin := func(bh BlockHandle, read func() (bufferHandle, error)) error {
+		if _, ok := pinned[bh.Offset]; ok || bh.Length == 0 {
+			return nil
+		}
+		pinned[bh.Offset] = struct{}{}
+		h := r.opts.Cache.Pin(r.cacheID, r.fileNum, bh.Offset)
+		if h.Get() == nil {
+			// Read the block into the cache before pinning it.
+			b, err := read()
+			if err != nil {
+				return err
+			}
+			b.Release()
+			h = r.opts.Cache.Pin(r.cacheID, r.fileNum, bh.Offset)
+		}
+		// The block may have been evicted before it could be pinned, in which
+		// case it's left unpinned.
+		if b := h.Get(); b != nil {
+			size += uint64(len(b))
+			h.Release()
+		}
+		return nil
+	}
+	readBlock := func(bh BlockHandle) func() (bufferHandle, error) {
+		return func() (bufferHandle, error) {
+			return r.readBlock(ctx, bh, nil /* transform */, nil /* readHandle */, nil /* stats */, nil /* iterStats */, nil /* buffer pool */)
+		}
+	}
+
+	if err := pin(r.indexBH, func() (bufferHandle, error) { return r.readIndex(ctx, nil, nil) }); err != nil {
+		return 0, err
+	}
+	if err := pin(r.filterBH, func() (bufferHandle, error) { return r.readFilter(ctx, nil, nil) }); err != nil {
+		return 0, err
+	}
+	if err := pin(r.rangeDelBH, func() (bufferHandle, error) { return r.readRangeDel(nil, nil) }); err != nil {
+		return 0, err
+	}
+	if err := pin(r.rangeKeyBH, func() (bufferHandle, error) { return r.readRangeKey(nil, nil) }); err != nil {
+		return 0, err
+	}
+
+	// forEachEntry calls fn with the block handle of each entry of the index
+	// block, starting at the first entry at or after start (or the first
+	// entry if start is nil), until fn returns false.
+	forEachEntry := func(
+		indexBlock []byte, start []byte, fn func(sep []byte, bh BlockHandle) (bool, error),
+	) (err error) {
+		iter, err := newBlockIter(r.Compare, r.Split, indexBlock, NoTransforms)
+		if err != nil {
+			return err
+		}
+		defer func() { err = firstError(err, iter.Close()) }()
+		key, val := iter.First()
+		if start != nil {
+			key, val = iter.SeekGE(start, base.SeekGEFlagsNone)
+		}
+		for ; key != nil; key, val = iter.Next() {
+			bh, err := decodeBlockHandleWithProperties(val.InPlaceValue())
+			if err != nil {
+				return errCorruptIndexEntry(err)
+			}
+			if more, err := fn(key.UserKey, bh.BlockHandle); err != nil || !more {
+				return err
+			}
+		}
+		return nil
+	}
+	// pinData pins the data blocks of the index block that may hold keys
+	// within bounds, returning true once the end of bounds is reached.
+	pinData := func(indexBlock []byte, bounds base.UserKeyBounds) (done bool, _ error) {
+		err := forEachEntry(indexBlock, bounds.Start, func(sep []byte, bh BlockHandle) (bool, error) {
+			if err := pin(bh, readBlock(bh)); err != nil {
+				return false, err
+			}
+			// The data block holds keys up to the index separator, so the
+			// following blocks hold keys beyond the end of bounds.
+			done = !bounds.End.IsUpperBoundFor(r.Compare, sep)
+			return !done, nil
+		})
+		return done, err
+	}
+
+	indexH, err := r.readIndex(ctx, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer indexH.Release()
+	if r.Properties.IndexPartitions == 0 {
+		for _, bounds := range dataBounds {
+			if _, err := pinData(indexH.Get(), bounds); err != nil {
+				return 0, err
+			}
+		}
+		return size, nil
+	}
+	// Pin the partitions of the two-level index, and the data blocks they
+	// index.
+	err = forEachEntry(indexH.Get(), nil, func(_ []byte, bh BlockHandle) (bool, error) {
+		return true, pin(bh, readBlock(bh))
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, bounds := range dataBounds {
+		err := forEachEntry(indexH.Get(), bounds.Start, func(_ []byte, bh BlockHandle) (bool, error) {
+			partition, err := readBlock(bh)()
+			if err != nil {
+				return false, err
+			}
+			defer partition.Release()
+			done, err := pinData(partition.Get(), bounds)
+			return !done, err
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return size, nil
+}
+
 // TableFormat returns the format version for the table.
 func (r *Reader) TableFormat() (TableFormat, error) {
 	if r.err != nil {
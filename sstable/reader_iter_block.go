@@ -0,0 +1,199 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"context"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/objstorage"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider/objiotracing"
+)
+
+// BlockIterOptions configures a BlockIter. See Reader.NewBlockIter.
+type BlockIterOptions struct {
+	// Transforms are the transforms applied to the keys and values read.
+	Transforms IterTransforms
+	// FillCache determines whether the data blocks that aren't in the block
+	// cache are added to the cache when read. If false, they're read into
+	// buffers private to the iterator, so that a scan of the sstable doesn't
+	// evict other blocks from the cache. Blocks that are already in the cache
+	// are always borrowed from the cache, without copying.
+	FillCache bool
+}
+
+// BlockIter iterates over the point keys of an sstable one data block at a
+// time, for high-throughput consumers such as exports that read entire
+// sstables outside of a DB.
+//
+// Unlike Iterator, BlockIter exposes the block structure of the sstable: the
+// keys and in-place values it returns are slices of the current data block,
+// which are valid until the next call to NextBlock or Close. Values stored in
+// value blocks are fetched lazily, through LazyValue.Value, so that consumers
+// that don't need them don't read the value blocks.
+//
+// Range deletions and range keys aren't returned. See
+// Reader.NewRawRangeDelIter and Reader.NewRawRangeKeyIter. BlockIter must not
+// be used concurrently.
+type BlockIter struct {
+	ctx    context.Context
+	reader *Reader
+	opts   BlockIterOptions
+	// blocks are the handles of the data blocks, in key order, and index the
+	// position of the current block.
+	blocks []BlockHandleWithProperties
+	index  int
+
+	data       blockIter
+	bufferPool *BufferPool
+	vbReader   *valueBlockReader
+	dataRH     objstorage.ReadHandle
+	vbRH       objstorage.ReadHandle
+	err        error
+}
+
+var _ blockProviderWhenOpen = (*BlockIter)(nil)
+
+// NewBlockIter returns a BlockIter over the data blocks of the sstable. The
+// iterator is positioned before the first data block: NextBlock must be called
+// to load it. The sstable is read sequentially, with readahead.
+func (r *Reader) NewBlockIter(ctx context.Context, opts BlockIterOptions) (*BlockIter, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	l, err := r.Layout()
+	if err != nil {
+		return nil, err
+	}
+	i := &BlockIter{
+		ctx:    ctx,
+		reader: r,
+		opts:   opts,
+		blocks: l.Data,
+		index:  -1,
+		dataRH: r.readable.NewReadHandle(ctx),
+	}
+	i.dataRH.SetupForCompaction()
+	if !opts.FillCache {
+		i.bufferPool = &BufferPool{}
+		i.bufferPool.Init(2)
+	}
+	if r.tableFormat >= TableFormatPebblev3 {
+		if r.Properties.NumValueBlocks > 0 {
+			i.vbReader = &valueBlockReader{
+				bpOpen: i,
+				vbih:   r.valueBIH,
+			}
+			i.data.lazyValueHandling.vbr = i.vbReader
+			i.vbRH = r.readable.NewReadHandle(ctx)
+			i.vbRH.SetupForCompaction()
+		}
+		if r.Properties.NumBlobValues > 0 {
+			i.data.lazyValueHandling.bvr = &blobValueReader{fetcher: r.opts.BlobValueFetcher}
+		}
+		i.data.lazyValueHandling.hasValuePrefix = true
+	}
+	return i, nil
+}
+
+// NumBlocks returns the number of data blocks of the sstable.
+func (i *BlockIter) NumBlocks() int {
+	return len(i.blocks)
+}
+
+// NextBlock loads the next data block, invalidating the keys and values
+// returned from the previous block. It returns false once all the data blocks
+// have been loaded, or if the block can't be read, in which case Error returns
+// the error.
+func (i *BlockIter) NextBlock() bool {
+	if i.err != nil || i.index >= len(i.blocks) {
+		return false
+	}
+	i.data.invalidate()
+	i.data.handle.Release()
+	i.data.handle = bufferHandle{}
+	i.index++
+	if i.index >= len(i.blocks) {
+		return false
+	}
+	ctx := objiotracing.WithBlockType(i.ctx, objiotracing.DataBlock)
+	h, err := i.reader.readBlock(ctx, i.blocks[i.index].BlockHandle, nil /* transform */, i.dataRH,
+		nil /* stats */, nil /* iterStats */, i.bufferPool)
+	if err != nil {
+		i.err = err
+		return false
+	}
+	if err := i.data.initHandle(i.reader.Compare, i.reader.Split, h, i.opts.Transforms); err != nil {
+		i.data.invalidate()
+		i.err = err
+		return false
+	}
+	return true
+}
+
+// BlockHandle returns the handle of the current data block.
+func (i *BlockIter) BlockHandle() BlockHandleWithProperties {
+	if i.index < 0 || i.index >= len(i.blocks) {
+		return BlockHandleWithProperties{}
+	}
+	return i.blocks[i.index]
+}
+
+// First returns the first key of the current data block, or nil if NextBlock
+// hasn't loaded a block.
+func (i *BlockIter) First() (*InternalKey, base.LazyValue) {
+	if i.data.isDataInvalidated() {
+		return nil, base.LazyValue{}
+	}
+	return i.data.First()
+}
+
+// Next returns the next key of the current data block, or nil once the end of
+// the block is reached.
+func (i *BlockIter) Next() (*InternalKey, base.LazyValue) {
+	if i.data.isDataInvalidated() {
+		return nil, base.LazyValue{}
+	}
+	return i.data.Next()
+}
+
+// Error returns the error, if any, encountered while loading a block.
+func (i *BlockIter) Error() error {
+	return i.err
+}
+
+// Close releases the blocks held by the iterator, invalidating the keys and
+// values returned.
+func (i *BlockIter) Close() error {
+	err := i.err
+	i.data.invalidate()
+	err = firstError(err, i.data.Close())
+	if i.vbReader != nil {
+		i.vbReader.close()
+		i.vbReader = nil
+	}
+	if i.bufferPool != nil {
+		i.bufferPool.Release()
+		i.bufferPool = nil
+	}
+	if i.dataRH != nil {
+		err = firstError(err, i.dataRH.Close())
+		i.dataRH = nil
+	}
+	if i.vbRH != nil {
+		err = firstError(err, i.vbRH.Close())
+		i.vbRH = nil
+	}
+	return err
+}
+
+// readBlockForVBR implements the blockProviderWhenOpen interface for use by
+// the valueBlockReader.
+func (i *BlockIter) readBlockForVBR(
+	h BlockHandle, stats *base.InternalIteratorStats,
+) (bufferHandle, error) {
+	ctx := objiotracing.WithBlockType(i.ctx, objiotracing.ValueBlock)
+	return i.reader.readBlock(ctx, h, nil /* transform */, i.vbRH, stats, nil /* iterStats */, i.bufferPool)
+}
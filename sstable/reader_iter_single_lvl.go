@@ -246,6 +246,12 @@ func (i *singleLevelIterator) init(
 			i.data.lazyValueHandling.vbr = i.vbReader
 			i.vbRH = objstorageprovider.UsePreallocatedReadHandle(ctx, r.readable, &i.vbRHPrealloc)
 		}
+		if r.Properties.NumBlobValues > 0 {
+			i.data.lazyValueHandling.bvr = &blobValueReader{
+				fetcher: r.opts.BlobValueFetcher,
+				stats:   stats,
+			}
+		}
 		i.data.lazyValueHandling.hasValuePrefix = true
 	}
 	return nil
@@ -830,9 +836,12 @@ func (i *singleLevelIterator) seekPrefixGE(
 			i.data.invalidate()
 			return nil, base.LazyValue{}
 		}
-		mayContain := i.reader.tableFilter.mayContain(dataH.Get(), prefix)
+		mayContain := i.reader.tableFilter.mayContain(dataH.Get(), i.reader.filterKey(prefix))
 		dataH.Release()
 		if !mayContain {
+			if i.stats != nil {
+				i.stats.FilterNegatives++
+			}
 			// This invalidation may not be necessary for correctness, and may
 			// be a place to optimize later by reusing the already loaded
 			// block. It was necessary in earlier versions of the code since
@@ -196,6 +196,12 @@ func (i *twoLevelIterator) init(
 			i.data.lazyValueHandling.vbr = i.vbReader
 			i.vbRH = r.readable.NewReadHandle(ctx)
 		}
+		if r.Properties.NumBlobValues > 0 {
+			i.data.lazyValueHandling.bvr = &blobValueReader{
+				fetcher: r.opts.BlobValueFetcher,
+				stats:   stats,
+			}
+		}
 		i.data.lazyValueHandling.hasValuePrefix = true
 	}
 	return nil
@@ -432,9 +438,12 @@ func (i *twoLevelIterator) SeekPrefixGE(
 			i.data.invalidate()
 			return nil, base.LazyValue{}
 		}
-		mayContain := i.reader.tableFilter.mayContain(dataH.Get(), prefix)
+		mayContain := i.reader.tableFilter.mayContain(dataH.Get(), i.reader.filterKey(prefix))
 		dataH.Release()
 		if !mayContain {
+			if i.stats != nil {
+				i.stats.FilterNegatives++
+			}
 			// This invalidation may not be necessary for correctness, and may
 			// be a place to optimize later by reusing the already loaded
 			// block. It was necessary in earlier versions of the code since
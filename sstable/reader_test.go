@@ -932,6 +932,63 @@ func TestReaderCheckComparerMerger(t *testing.T) {
 		})
 	}
 }
+func TestReaderPrefixExtractor(t *testing.T) {
+	extractor := func(name string) *PrefixExtractor {
+		return &PrefixExtractor{
+			Name:    name,
+			Extract: func(prefix []byte) int { return 2 },
+		}
+	}
+	for _, indexBlockSize := range []int{0, 1} {
+		t.Run(fmt.Sprintf("index-block-size=%d", indexBlockSize), func(t *testing.T) {
+			mem := vfs.NewMem()
+			f, err := mem.Create("test")
+			require.NoError(t, err)
+			w := NewWriter(objstorageprovider.NewFileWritable(f), WriterOptions{
+				FilterPolicy:    bloom.FilterPolicy(10),
+				IndexBlockSize:  indexBlockSize,
+				PrefixExtractor: extractor("first-two"),
+			})
+			for _, k := range []string{"apple", "apricot", "banana"} {
+				require.NoError(t, w.Set([]byte(k), nil))
+			}
+			require.NoError(t, w.Close())
+
+			// seekPrefix returns the key returned by SeekPrefixGE, or "" if the
+			// iterator is exhausted.
+			seekPrefix := func(opts ReaderOptions, key string) string {
+				f, err := mem.Open("test")
+				require.NoError(t, err)
+				opts.Filters = map[string]FilterPolicy{bloom.FilterPolicy(10).Name(): bloom.FilterPolicy(10)}
+				r, err := newReader(f, opts)
+				require.NoError(t, err)
+				defer r.Close()
+				require.Equal(t, "first-two", r.Properties.PrefixExtractorName)
+				iter, err := r.NewIter(NoTransforms, nil, nil)
+				require.NoError(t, err)
+				defer iter.Close()
+				k, _ := iter.SeekPrefixGE([]byte(key), []byte(key), base.SeekGEFlagsNone)
+				if k == nil {
+					return ""
+				}
+				return string(k.UserKey)
+			}
+
+			// The filter holds the extracted prefixes, so a key whose extracted
+			// prefix is absent is excluded by the filter, while one whose extracted
+			// prefix is present isn't.
+			opts := ReaderOptions{PrefixExtractor: extractor("first-two")}
+			require.Equal(t, "", seekPrefix(opts, "aardvark"))
+			require.Equal(t, "apricot", seekPrefix(opts, "apq"))
+
+			// The filter is ignored with a different prefix extractor, or without
+			// one.
+			require.Equal(t, "apple", seekPrefix(ReaderOptions{PrefixExtractor: extractor("other")}, "aardvark"))
+			require.Equal(t, "apple", seekPrefix(ReaderOptions{}, "aardvark"))
+		})
+	}
+}
+
 func checkValidPrefix(prefix, key []byte) bool {
 	return prefix == nil || bytes.HasPrefix(key, prefix)
 }
@@ -1537,6 +1594,87 @@ func TestReaderChecksumErrors(t *testing.T) {
 	}
 }
 
+// testCorruptBlockHandler recovers the corrupt blocks from an uncorrupted
+// copy of the table.
+type testCorruptBlockHandler struct {
+	orig    []byte
+	err     error
+	reports []string
+}
+
+func (h *testCorruptBlockHandler) RecoverBlock(_ context.Context, b CorruptBlock) ([]byte, error) {
+	if h.err != nil {
+		return nil, h.err
+	}
+	return h.orig[b.Handle.Offset : b.Handle.Offset+b.Handle.Length+blockTrailerLen], nil
+}
+
+func (h *testCorruptBlockHandler) ReportCorruptBlock(b CorruptBlock, err error) {
+	h.reports = append(h.reports, fmt.Sprintf("%s %d/%d: %v", b.FileNum, b.Handle.Offset, b.Handle.Length, err))
+}
+
+func TestReaderCorruptBlockHandler(t *testing.T) {
+	mem := vfs.NewMem()
+	f, err := mem.Create("test")
+	require.NoError(t, err)
+	w := NewWriter(objstorageprovider.NewFileWritable(f), WriterOptions{BlockSize: 32})
+	for _, k := range []string{"a", "b", "c"} {
+		require.NoError(t, w.Set(bytes.Repeat([]byte(k), 32), []byte(k)))
+	}
+	require.NoError(t, w.Close())
+
+	f, err = mem.Open("test")
+	require.NoError(t, err)
+	orig, err := io.ReadAll(f)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	r, err := newReader(vfs.NewMemFile(orig), ReaderOptions{})
+	require.NoError(t, err)
+	layout, err := r.Layout()
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.Len(t, layout.Data, 3)
+
+	// Corrupt the second data block.
+	bh := layout.Data[1].BlockHandle
+	corrupted := slices.Clone(orig)
+	corrupted[bh.Offset] ^= 0xff
+
+	scan := func(h *testCorruptBlockHandler) (string, error) {
+		r, err := newReader(vfs.NewMemFile(corrupted), ReaderOptions{CorruptBlockHandler: h})
+		require.NoError(t, err)
+		defer r.Close()
+		iter, err := r.NewIter(NoTransforms, nil, nil)
+		require.NoError(t, err)
+		var values []string
+		for k, v := iter.First(); k != nil; k, v = iter.Next() {
+			value, _, err := v.Value(nil)
+			require.NoError(t, err)
+			values = append(values, string(value))
+		}
+		return strings.Join(values, ","), iter.Close()
+	}
+
+	h := &testCorruptBlockHandler{orig: orig}
+	values, err := scan(h)
+	require.NoError(t, err)
+	require.Equal(t, "a,b,c", values)
+	require.Equal(t, []string{fmt.Sprintf("000000 %d/%d: <nil>", bh.Offset, bh.Length)}, h.reports)
+
+	h = &testCorruptBlockHandler{err: errors.New("replica unavailable")}
+	_, err = scan(h)
+	require.True(t, errors.Is(err, base.ErrCorruption))
+	require.Regexp(t, `checksum mismatch`, err)
+	require.Equal(t, []string{fmt.Sprintf("000000 %d/%d: replica unavailable", bh.Offset, bh.Length)}, h.reports)
+
+	// The recovered contents are validated.
+	h = &testCorruptBlockHandler{orig: corrupted}
+	_, err = scan(h)
+	require.True(t, errors.Is(err, base.ErrCorruption))
+	require.Len(t, h.reports, 1)
+	require.Regexp(t, `checksum mismatch`, h.reports[0])
+}
+
 func TestValidateBlockChecksums(t *testing.T) {
 	seed := uint64(time.Now().UnixNano())
 	rng := rand.New(rand.NewSource(seed))
@@ -1758,6 +1896,198 @@ func TestReader_TableFormat(t *testing.T) {
 	}
 }
 
+func TestReaderPinBlocks(t *testing.T) {
+	key := func(i uint64) []byte {
+		return binary.BigEndian.AppendUint64(nil, i)
+	}
+	for _, indexBlockSize := range []int{0, 256} {
+		t.Run(fmt.Sprintf("indexBlockSize=%d", indexBlockSize), func(t *testing.T) {
+			r := buildTestTable(t, 1000, 128, indexBlockSize, NoCompression, nil)
+			defer r.Close()
+			if indexBlockSize > 0 {
+				require.Greater(t, r.Properties.IndexPartitions, uint64(0))
+			}
+			l, err := r.Layout()
+			require.NoError(t, err)
+			numIndexBlocks := int64(len(l.Index))
+			if l.TopIndex.Length > 0 {
+				numIndexBlocks++
+			}
+
+			// Only the index blocks are pinned, and pinning is idempotent.
+			for i := 0; i < 2; i++ {
+				size, err := r.PinBlocks(context.Background(), nil /* dataBounds */)
+				require.NoError(t, err)
+				require.Greater(t, size, uint64(0))
+				require.Equal(t, numIndexBlocks, r.opts.Cache.Metrics().PinnedCount)
+			}
+
+			// The data blocks holding keys in [100, 200) are pinned too.
+			bounds := []base.UserKeyBounds{
+				base.UserKeyBoundsEndExclusive(key(100), key(200)),
+				base.UserKeyBoundsEndExclusive(key(150), key(160)),
+			}
+			_, err = r.PinBlocks(context.Background(), bounds)
+			require.NoError(t, err)
+			numDataBlocks := r.opts.Cache.Metrics().PinnedCount - numIndexBlocks
+			require.Greater(t, numDataBlocks, int64(1))
+			require.Less(t, numDataBlocks, int64(len(l.Data)))
+
+			// Scanning the range is served entirely by the cache.
+			var stats base.InternalIteratorStats
+			iter, err := r.NewIterWithBlockPropertyFilters(
+				NoTransforms, key(100), key(200), nil /* filterer */, false, /* useFilterBlock */
+				&stats, CategoryAndQoS{}, nil /* statsCollector */, TrivialReaderProvider{Reader: r})
+			require.NoError(t, err)
+			n := 0
+			for k, _ := iter.First(); k != nil; k, _ = iter.Next() {
+				n++
+			}
+			require.NoError(t, iter.Close())
+			require.Equal(t, 100, n)
+			require.Greater(t, stats.BlockReads, uint64(0))
+			require.Equal(t, stats.BlockReads, stats.BlockReadsInCache)
+
+			r.opts.Cache.UnpinFile(r.cacheID, r.fileNum)
+			require.Zero(t, r.opts.Cache.Metrics().PinnedCount)
+		})
+	}
+}
+
+func TestReaderForEachDataBlock(t *testing.T) {
+	for _, indexBlockSize := range []int{0, 256} {
+		t.Run(fmt.Sprintf("indexBlockSize=%d", indexBlockSize), func(t *testing.T) {
+			r := buildTestTable(t, 1000, 128, indexBlockSize, NoCompression, nil)
+			defer r.Close()
+			l, err := r.Layout()
+			require.NoError(t, err)
+
+			var handles []BlockHandle
+			var prev []byte
+			require.NoError(t, r.ForEachDataBlock(func(separator []byte, bh BlockHandle) error {
+				if prev != nil {
+					require.Less(t, bytes.Compare(prev, separator), 0)
+				}
+				prev = append(prev[:0], separator...)
+				handles = append(handles, bh)
+				return nil
+			}))
+			require.Equal(t, len(l.Data), len(handles))
+			for i := range handles {
+				require.Equal(t, l.Data[i].BlockHandle, handles[i])
+			}
+			// The last separator is >= the last key.
+			iter, err := r.NewIter(NoTransforms, nil, nil)
+			require.NoError(t, err)
+			k, _ := iter.Last()
+			require.NotNil(t, k)
+			require.GreaterOrEqual(t, bytes.Compare(prev, k.UserKey), 0)
+			require.NoError(t, iter.Close())
+
+			errStop := errors.New("stop")
+			var n int
+			require.Equal(t, errStop, r.ForEachDataBlock(func([]byte, BlockHandle) error {
+				n++
+				return errStop
+			}))
+			require.Equal(t, 1, n)
+		})
+	}
+}
+
+func TestReaderBlockIter(t *testing.T) {
+	for _, indexBlockSize := range []int{0, 256} {
+		t.Run(fmt.Sprintf("indexBlockSize=%d", indexBlockSize), func(t *testing.T) {
+			r := buildTestTable(t, 1000, 128, indexBlockSize, SnappyCompression, nil)
+			defer r.Close()
+
+			var results [2][]string
+			for i, fillCache := range []bool{false, true} {
+				bi, err := r.NewBlockIter(context.Background(), BlockIterOptions{FillCache: fillCache})
+				require.NoError(t, err)
+				countBefore := r.opts.Cache.Metrics().Count
+				require.Greater(t, bi.NumBlocks(), 1)
+				var actual []string
+				var blocks int
+				for bi.NextBlock() {
+					blocks++
+					require.NotZero(t, bi.BlockHandle().Length)
+					for k, v := bi.First(); k != nil; k, v = bi.Next() {
+						actual = append(actual, fmt.Sprintf("%s:%x", k, v.InPlaceValue()))
+					}
+				}
+				require.NoError(t, bi.Error())
+				require.NoError(t, bi.Close())
+				require.Equal(t, bi.NumBlocks(), blocks)
+				results[i] = actual
+
+				// Without FillCache, the scan doesn't add data blocks to the
+				// cache.
+				if fillCache {
+					require.Equal(t, countBefore+int64(blocks), r.opts.Cache.Metrics().Count)
+				} else {
+					require.Equal(t, countBefore, r.opts.Cache.Metrics().Count)
+				}
+			}
+
+			var expected []string
+			iter, err := r.NewIter(NoTransforms, nil /* lower */, nil /* upper */)
+			require.NoError(t, err)
+			for k, v := iter.First(); k != nil; k, v = iter.Next() {
+				expected = append(expected, fmt.Sprintf("%s:%x", k, v.InPlaceValue()))
+			}
+			require.NoError(t, iter.Close())
+			require.Equal(t, expected, results[0])
+			require.Equal(t, expected, results[1])
+		})
+	}
+
+	t.Run("value-blocks", func(t *testing.T) {
+		mem := vfs.NewMem()
+		f, err := mem.Create("test")
+		require.NoError(t, err)
+		w := NewWriter(objstorageprovider.NewFileWritable(f), WriterOptions{
+			BlockSize:   32,
+			TableFormat: TableFormatPebblev3,
+			Comparer:    testkeys.Comparer,
+		})
+		var expected []string
+		for _, k := range []string{"a@3", "a@2", "a@1", "b@2", "b@1"} {
+			require.NoError(t, w.Set([]byte(k), []byte("value-"+k)))
+			expected = append(expected, k+":value-"+k)
+		}
+		require.NoError(t, w.Close())
+		f, err = mem.Open("test")
+		require.NoError(t, err)
+		readable, err := NewSimpleReadable(f)
+		require.NoError(t, err)
+		r, err := NewReader(readable, ReaderOptions{Comparer: testkeys.Comparer})
+		require.NoError(t, err)
+		defer r.Close()
+		require.Greater(t, r.Properties.NumValueBlocks, uint64(0))
+
+		bi, err := r.NewBlockIter(context.Background(), BlockIterOptions{})
+		require.NoError(t, err)
+		var actual []string
+		var fetched int
+		for bi.NextBlock() {
+			for k, lv := bi.First(); k != nil; k, lv = bi.Next() {
+				if _, ok := lv.TryGetShortAttribute(); ok {
+					fetched++
+				}
+				v, _, err := lv.Value(nil)
+				require.NoError(t, err)
+				actual = append(actual, fmt.Sprintf("%s:%s", k.UserKey, v))
+			}
+		}
+		require.NoError(t, bi.Error())
+		require.NoError(t, bi.Close())
+		require.Equal(t, expected, actual)
+		// The older versions of the keys are stored in value blocks.
+		require.Equal(t, 3, fetched)
+	})
+}
+
 func buildTestTable(
 	t *testing.T,
 	numEntries uint64,
@@ -245,6 +245,11 @@ func (v *VirtualReader) EstimateDiskUsage(start, end []byte) (uint64, error) {
 	return v.reader.EstimateDiskUsage(f, l)
 }
 
+// UserProperties returns the user properties of the backing sstable.
+func (v *VirtualReader) UserProperties() map[string]string {
+	return v.reader.Properties.UserProperties
+}
+
 // CommonProperties implements the CommonReader interface.
 func (v *VirtualReader) CommonProperties() *CommonProperties {
 	return &v.Properties
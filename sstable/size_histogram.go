@@ -0,0 +1,106 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"strings"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/humanize"
+)
+
+// SizeHistogram is a histogram of sizes in bytes, with power-of-two buckets:
+// bucket 0 counts the sizes of zero bytes, and bucket i > 0 counts the sizes
+// within [2^(i-1), 2^i). Trailing empty buckets may be omitted.
+type SizeHistogram []uint64
+
+// sizeHistogramBucket returns the index of the bucket counting size.
+func sizeHistogramBucket(size uint64) int {
+	return bits.Len64(size)
+}
+
+// Record adds a size to the histogram.
+func (h *SizeHistogram) Record(size uint64) {
+	i := sizeHistogramBucket(size)
+	for len(*h) <= i {
+		*h = append(*h, 0)
+	}
+	(*h)[i]++
+}
+
+// Merge adds the counts of o to the histogram.
+func (h *SizeHistogram) Merge(o SizeHistogram) {
+	for len(*h) < len(o) {
+		*h = append(*h, 0)
+	}
+	for i, n := range o {
+		(*h)[i] += n
+	}
+}
+
+// Count returns the number of sizes recorded in the histogram.
+func (h SizeHistogram) Count() uint64 {
+	var n uint64
+	for _, c := range h {
+		n += c
+	}
+	return n
+}
+
+// BucketBounds returns the inclusive lower bound and exclusive upper bound of
+// the sizes counted by bucket i.
+func (h SizeHistogram) BucketBounds(i int) (lower, upper uint64) {
+	if i == 0 {
+		return 0, 1
+	}
+	return 1 << (i - 1), 1 << i
+}
+
+// String returns the non-empty buckets of the histogram, formatted as
+// "[lower,upper):count".
+func (h SizeHistogram) String() string {
+	var buf strings.Builder
+	for i, n := range h {
+		if n == 0 {
+			continue
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte(' ')
+		}
+		lower, upper := h.BucketBounds(i)
+		fmt.Fprintf(&buf, "[%s,%s):%d", humanize.Bytes.Uint64(lower), humanize.Bytes.Uint64(upper), n)
+	}
+	return buf.String()
+}
+
+// encode appends the counts of the buckets of the histogram to b, as uvarints.
+// Trailing empty buckets are omitted.
+func (h SizeHistogram) encode(b []byte) []byte {
+	n := len(h)
+	for n > 0 && h[n-1] == 0 {
+		n--
+	}
+	for _, c := range h[:n] {
+		b = binary.AppendUvarint(b, c)
+	}
+	return b
+}
+
+// decodeSizeHistogram decodes a histogram encoded by SizeHistogram.encode.
+func decodeSizeHistogram(b []byte) (SizeHistogram, error) {
+	var h SizeHistogram
+	for len(b) > 0 {
+		c, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, base.CorruptionErrorf("pebble/table: invalid size histogram")
+		}
+		h = append(h, c)
+		b = b[n:]
+	}
+	return h, nil
+}
@@ -393,6 +393,10 @@ func rewriteDataBlocksToWriter(
 	w.props.NumEntries = r.Properties.NumEntries
 	w.props.RawKeySize = r.Properties.RawKeySize
 	w.props.RawValueSize = r.Properties.RawValueSize
+	w.props.KeySizes = r.Properties.KeySizes
+	w.props.ValueSizes = r.Properties.ValueSizes
+	w.props.DataBlockSizes = r.Properties.DataBlockSizes
+	w.props.CompressedDataBlockSizes = r.Properties.CompressedDataBlockSizes
 	w.meta.SetSmallestPointKey(blocks[0].start)
 	w.meta.SetLargestPointKey(blocks[len(blocks)-1].end)
 	return nil
@@ -496,7 +500,7 @@ func RewriteKeySuffixesViaWriter(
 		if err != nil {
 			return nil, err
 		}
-		if w.addPoint(scratch, val, false); err != nil {
+		if w.addPoint(scratch, val, nil, false); err != nil {
 			return nil, err
 		}
 		k, v = i.Next()
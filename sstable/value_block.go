@@ -102,18 +102,19 @@ import (
 // to be stored in a value block. The policy decision in made in the
 // sstable.Writer. See Writer.makeAddPointDecisionV3.
 //
-// Data blocks contain two kinds of SET keys: those with in-place values and
-// those with a value handle. To distinguish these two cases we use a single
-// byte prefix (valuePrefix). This single byte prefix is split into multiple
-// parts, where nb represents information that is encoded in n bits.
+// Data blocks contain three kinds of SET keys: those with in-place values,
+// those with a value handle and those with a blob handle. To distinguish these
+// cases we use a single byte prefix (valuePrefix). This single byte prefix is
+// split into multiple parts, where nb represents information that is encoded
+// in n bits.
 //
 // +---------------+--------------------+-----------+--------------------+
 // | value-kind 2b | SET-same-prefix 1b | unused 2b | short-attribute 3b |
 // +---------------+--------------------+-----------+--------------------+
 //
-// The 2 bit value-kind specifies whether this is an in-place value or a value
-// handle pointing to a value block. We use 2 bits here for future
-// representation of values that are in separate files. The 1 bit
+// The 2 bit value-kind specifies whether this is an in-place value, a value
+// handle pointing to a value block, or a blob handle pointing to a value in a
+// separate blob file (see the blob package and blob_value.go). The 1 bit
 // SET-same-prefix is true if this key is a SET and is immediately preceded by
 // a SET that shares the same prefix. The 3 bit short-attribute is described
 // in base.ShortAttribute -- it stores user-defined attributes about the
@@ -196,6 +197,7 @@ const (
 	// 2 most-significant bits of valuePrefix encodes the value-kind.
 	valueKindMask           valuePrefix = '\xC0'
 	valueKindIsValueHandle  valuePrefix = '\x80'
+	valueKindIsBlobHandle   valuePrefix = '\x40'
 	valueKindIsInPlaceValue valuePrefix = '\x00'
 
 	// 1 bit indicates SET has same key prefix as immediately preceding key that
@@ -246,11 +248,27 @@ func makePrefixForInPlaceValue(setHasSameKeyPrefix bool) valuePrefix {
 	return prefix
 }
 
+func makePrefixForBlobHandle(setHasSameKeyPrefix bool, attribute base.ShortAttribute) valuePrefix {
+	prefix := valueKindIsBlobHandle | valuePrefix(attribute)
+	if setHasSameKeyPrefix {
+		prefix = prefix | setHasSameKeyPrefixMask
+	}
+	return prefix
+}
+
 func isValueHandle(b valuePrefix) bool {
 	return b&valueKindMask == valueKindIsValueHandle
 }
 
-// REQUIRES: isValueHandle(b)
+func isBlobHandle(b valuePrefix) bool {
+	return b&valueKindMask == valueKindIsBlobHandle
+}
+
+func isInPlaceValue(b valuePrefix) bool {
+	return b&valueKindMask == valueKindIsInPlaceValue
+}
+
+// REQUIRES: isValueHandle(b) || isBlobHandle(b)
 func getShortAttribute(b valuePrefix) base.ShortAttribute {
 	return base.ShortAttribute(b & userDefinedShortAttributeMask)
 }
@@ -0,0 +1,216 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// BlockIssue describes a problem found by Reader.Verify.
+type BlockIssue struct {
+	// Name identifies the kind of block (e.g. "data", "index", "range-del", ...),
+	// using the same names as Layout.Describe. It is "table" for problems that
+	// are not attributable to a single block, such as properties that are
+	// inconsistent with the table's contents.
+	Name string
+	// BlockHandle locates the block within the sstable. It is zero for
+	// problems with Name "table".
+	BlockHandle
+	// Err describes the problem.
+	Err error
+}
+
+// String implements fmt.Stringer.
+func (i BlockIssue) String() string {
+	if i.Name == "table" {
+		return fmt.Sprintf("table: %s", i.Err)
+	}
+	return fmt.Sprintf("%s block %d/%d: %s", i.Name, i.Offset, i.Length, i.Err)
+}
+
+// VerifyReport is the result of Reader.Verify.
+type VerifyReport struct {
+	// BlocksVerified is the number of blocks that were read.
+	BlocksVerified int
+	// Issues is the list of problems found, ordered by block offset. Problems
+	// with the table as a whole are listed last.
+	Issues []BlockIssue
+}
+
+// OK returns true if no problems were found.
+func (r *VerifyReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// Verify reads every block in the sstable and reports any problems found:
+// blocks whose checksums don't match or that can't be decoded, point keys and
+// range deletions that are out of order (within or across blocks), and table
+// properties that are inconsistent with the entries stored in the table.
+//
+// Unlike ValidateBlockChecksums, Verify does not stop at the first problem. An
+// error is returned only if the layout of the table itself can't be
+// determined.
+func (r *Reader) Verify() (VerifyReport, error) {
+	l, err := r.Layout()
+	if err != nil {
+		return VerifyReport{}, err
+	}
+
+	type block struct {
+		BlockHandle
+		name string
+	}
+	var blocks []block
+	for i := range l.Data {
+		blocks = append(blocks, block{l.Data[i].BlockHandle, "data"})
+	}
+	for i := range l.Index {
+		blocks = append(blocks, block{l.Index[i], "index"})
+	}
+	for i := range l.ValueBlock {
+		blocks = append(blocks, block{l.ValueBlock[i], "value-block"})
+	}
+	for _, b := range []block{
+		{l.TopIndex, "top-index"},
+		{l.Filter, "filter"},
+		{l.RangeDel, "range-del"},
+		{l.RangeKey, "range-key"},
+		{l.ValueIndex, "value-index"},
+		{l.Properties, "properties"},
+		{l.MetaIndex, "meta-index"},
+	} {
+		if b.Length != 0 {
+			blocks = append(blocks, b)
+		}
+	}
+	// Sorting by offset ensures we are performing a sequential scan of the
+	// file, and that data blocks are visited in key order.
+	slices.SortFunc(blocks, func(a, b block) int {
+		return cmp.Compare(a.Offset, b.Offset)
+	})
+
+	var report VerifyReport
+	addIssue := func(b block, err error) {
+		report.Issues = append(report.Issues, BlockIssue{Name: b.name, BlockHandle: b.BlockHandle, Err: err})
+	}
+
+	// Counts of the entries found, to validate the properties against.
+	var counts struct {
+		entries, deletions, rangeDels, merges, rawKeySize uint64
+	}
+	// Whether all of the data and range deletion blocks could be read. If not,
+	// the counts are incomplete and aren't compared against the properties.
+	complete := true
+
+	rh := r.readable.NewReadHandle(context.TODO())
+	defer rh.Close()
+
+	var lastPointKey InternalKey
+	var havePointKey bool
+	for _, b := range blocks {
+		// Read the block, which validates the checksum.
+		h, err := r.readBlock(context.Background(), b.BlockHandle, nil /* transform */, rh, nil /* stats */, nil /* iterStats */, nil /* buffer pool */)
+		report.BlocksVerified++
+		if err != nil {
+			addIssue(b, err)
+			if b.name == "data" || b.name == "range-del" {
+				complete = false
+			}
+			continue
+		}
+
+		switch b.name {
+		case "data", "range-del":
+			iter, err := newBlockIter(r.Compare, r.Split, h.Get(), NoTransforms)
+			if err != nil {
+				addIssue(b, err)
+				complete = false
+				break
+			}
+			// Range deletions are only ordered within the range-del block.
+			var lastKey InternalKey
+			var haveLastKey bool
+			if b.name == "data" {
+				lastKey, haveLastKey = lastPointKey, havePointKey
+			}
+			for key, _ := iter.First(); key != nil; key, _ = iter.Next() {
+				if haveLastKey && base.InternalCompare(r.Compare, lastKey, *key) >= 0 {
+					addIssue(b, errors.Errorf("out of order keys %s >= %s at offset %d",
+						lastKey.Pretty(r.opts.Comparer.FormatKey), key.Pretty(r.opts.Comparer.FormatKey),
+						b.Offset+uint64(iter.offset)))
+				}
+				lastKey.Trailer = key.Trailer
+				lastKey.UserKey = append(lastKey.UserKey[:0], key.UserKey...)
+				haveLastKey = true
+
+				counts.entries++
+				counts.rawKeySize += uint64(key.Size())
+				switch key.Kind() {
+				case InternalKeyKindDelete, InternalKeyKindSingleDelete, InternalKeyKindDeleteSized:
+					counts.deletions++
+				case InternalKeyKindRangeDelete:
+					counts.deletions++
+					counts.rangeDels++
+				case InternalKeyKindMerge:
+					counts.merges++
+				}
+			}
+			if err := iter.Close(); err != nil {
+				addIssue(b, err)
+				complete = false
+			}
+			if b.name == "data" {
+				lastPointKey, havePointKey = lastKey, haveLastKey
+			}
+		case "index", "top-index":
+			iter, err := newBlockIter(r.Compare, r.Split, h.Get(), NoTransforms)
+			if err != nil {
+				addIssue(b, err)
+				break
+			}
+			for key, value := iter.First(); key != nil; key, value = iter.Next() {
+				bh, err := decodeBlockHandleWithProperties(value.InPlaceValue())
+				if err != nil {
+					addIssue(b, errors.Wrapf(err, "at offset %d", b.Offset+uint64(iter.offset)))
+					continue
+				}
+				if bh.Offset+bh.Length > uint64(r.readable.Size()) {
+					addIssue(b, errors.Errorf("block handle %d/%d at offset %d is past the end of the file",
+						bh.Offset, bh.Length, b.Offset+uint64(iter.offset)))
+				}
+			}
+			if err := iter.Close(); err != nil {
+				addIssue(b, err)
+			}
+		}
+		h.Release()
+	}
+
+	// Validate the properties against the counts.
+	if complete && l.Properties.Length != 0 {
+		p := &r.Properties
+		check := func(name string, prop, count uint64) {
+			if prop != count {
+				report.Issues = append(report.Issues, BlockIssue{
+					Name: "table",
+					Err:  errors.Errorf("property %s is %d, but the table contains %d", name, prop, count),
+				})
+			}
+		}
+		check("num-data-blocks", p.NumDataBlocks, uint64(len(l.Data)))
+		check("num-entries", p.NumEntries, counts.entries)
+		check("num-deletions", p.NumDeletions, counts.deletions)
+		check("num-range-deletions", p.NumRangeDeletions, counts.rangeDels)
+		check("num-merge-operands", p.NumMergeOperands, counts.merges)
+		check("raw-key-size", p.RawKeySize, counts.rawKeySize)
+	}
+	return report, nil
+}
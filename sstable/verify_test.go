@@ -0,0 +1,107 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/pebble/bloom"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReaderVerify(t *testing.T) {
+	filter := bloom.FilterPolicy(10)
+	readerOpts := ReaderOptions{
+		Filters: map[string]FilterPolicy{filter.Name(): filter},
+	}
+
+	for _, fixture := range TestFixtures {
+		t.Run(fixture.Filename, func(t *testing.T) {
+			// Create a copy of the SSTable that we can freely corrupt.
+			src, err := os.Open(filepath.Join("testdata", fixture.Filename))
+			require.NoError(t, err)
+			defer src.Close()
+			path := filepath.Join(t.TempDir(), fixture.Filename)
+			f, err := os.Create(path)
+			require.NoError(t, err)
+			_, err = io.Copy(f, src)
+			require.NoError(t, err)
+
+			r, err := newReader(f, readerOpts)
+			require.NoError(t, err)
+			report, err := r.Verify()
+			require.NoError(t, err)
+			require.True(t, report.OK(), "%v", report.Issues)
+			require.NotZero(t, report.BlocksVerified)
+			layout, err := r.Layout()
+			require.NoError(t, err)
+			require.NoError(t, r.Close())
+
+			// Corrupt the last byte of the first data block. Closing the reader
+			// closed the file.
+			f, err = os.OpenFile(path, os.O_RDWR, 0600)
+			require.NoError(t, err)
+			bh := layout.Data[0].BlockHandle
+			b := make([]byte, 1)
+			_, err = f.ReadAt(b, int64(bh.Offset+bh.Length-1))
+			require.NoError(t, err)
+			b[0] ^= 0xff
+			_, err = f.WriteAt(b, int64(bh.Offset+bh.Length-1))
+			require.NoError(t, err)
+
+			r, err = newReader(f, readerOpts)
+			require.NoError(t, err)
+			defer r.Close()
+			report, err = r.Verify()
+			require.NoError(t, err)
+			require.Len(t, report.Issues, 1)
+			require.Equal(t, "data", report.Issues[0].Name)
+			require.Equal(t, bh, report.Issues[0].BlockHandle)
+			require.Regexp(t, `checksum mismatch`, report.Issues[0].Err.Error())
+		})
+	}
+}
+
+func TestReaderVerifyProperties(t *testing.T) {
+	mem := vfs.NewMem()
+	f, err := mem.Create("test")
+	require.NoError(t, err)
+	w := NewWriter(objstorageprovider.NewFileWritable(f), WriterOptions{BlockSize: 1})
+	require.NoError(t, w.Set([]byte("a"), []byte("1")))
+	require.NoError(t, w.Delete([]byte("b")))
+	require.NoError(t, w.Merge([]byte("c"), []byte("3")))
+	require.NoError(t, w.DeleteRange([]byte("d"), []byte("e")))
+	require.NoError(t, w.Close())
+
+	f, err = mem.Open("test")
+	require.NoError(t, err)
+	r, err := newReader(f, ReaderOptions{})
+	require.NoError(t, err)
+	defer r.Close()
+	report, err := r.Verify()
+	require.NoError(t, err)
+	require.True(t, report.OK(), "%v", report.Issues)
+
+	// Tamper with the loaded properties to simulate inconsistent properties.
+	r.Properties.NumEntries++
+	r.Properties.NumMergeOperands = 0
+	report, err = r.Verify()
+	require.NoError(t, err)
+	var issues []string
+	for _, issue := range report.Issues {
+		require.Equal(t, "table", issue.Name)
+		require.Equal(t, BlockHandle{}, issue.BlockHandle)
+		issues = append(issues, issue.String())
+	}
+	require.Equal(t, []string{
+		"table: property num-entries is 5, but the table contains 4",
+		"table: property num-merge-operands is 0, but the table contains 1",
+	}, issues)
+}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"math"
 	"runtime"
+	"slices"
 	"sort"
 	"sync"
 
@@ -24,6 +25,7 @@ import (
 	"github.com/cockroachdb/pebble/internal/private"
 	"github.com/cockroachdb/pebble/internal/rangekey"
 	"github.com/cockroachdb/pebble/objstorage"
+	"github.com/cockroachdb/pebble/sstable/blob"
 )
 
 // encodedBHPEstimatedSize estimates the size of the encoded BlockHandleWithProperties.
@@ -51,6 +53,9 @@ type WriterMetadata struct {
 	SmallestSeqNum   uint64
 	LargestSeqNum    uint64
 	Properties       Properties
+	// BlobFiles holds the blob files referenced by the table's blob handles, in
+	// increasing order. See Writer.AddWithBlobHandle.
+	BlobFiles []base.DiskFileNum
 }
 
 // SetSmallestPointKey sets the smallest point key to the given key.
@@ -127,6 +132,7 @@ type Writer struct {
 	indexBlockSizeThreshold int
 	compare                 Compare
 	split                   Split
+	prefixExtractor         *PrefixExtractor
 	formatKey               base.FormatKey
 	compression             Compression
 	separator               Separator
@@ -138,8 +144,7 @@ type Writer struct {
 	restartInterval         int
 	checksumType            ChecksumType
 	// disableKeyOrderChecks disables the checks that keys are added to an
-	// sstable in order. It is intended for internal use only in the construction
-	// of invalid sstables for testing. See tool/make_test_sstables.go.
+	// sstable in order. See WriterOptions.Unsafe.DisableKeyOrderChecks.
 	disableKeyOrderChecks bool
 	// With two level indexes, the index/filter of a SST file is partitioned into
 	// smaller blocks with an additional top-level index on them. When reading an
@@ -684,7 +689,7 @@ func (w *Writer) Set(key, value []byte) error {
 	}
 	// forceObsolete is false based on the assumption that no RANGEDELs in the
 	// sstable delete the added points.
-	return w.addPoint(base.MakeInternalKey(key, 0, InternalKeyKindSet), value, false)
+	return w.addPoint(base.MakeInternalKey(key, 0, InternalKeyKindSet), value, nil, false)
 }
 
 // Delete deletes the value for the given key. The sequence number is set to
@@ -701,7 +706,7 @@ func (w *Writer) Delete(key []byte) error {
 	}
 	// forceObsolete is false based on the assumption that no RANGEDELs in the
 	// sstable delete the added points.
-	return w.addPoint(base.MakeInternalKey(key, 0, InternalKeyKindDelete), nil, false)
+	return w.addPoint(base.MakeInternalKey(key, 0, InternalKeyKindDelete), nil, nil, false)
 }
 
 // DeleteRange deletes all of the keys (and values) in the range [start,end)
@@ -733,7 +738,7 @@ func (w *Writer) Merge(key, value []byte) error {
 	// forceObsolete is false based on the assumption that no RANGEDELs in the
 	// sstable that delete the added points. If the user configured this writer
 	// to be strict-obsolete, addPoint will reject the addition of this MERGE.
-	return w.addPoint(base.MakeInternalKey(key, 0, InternalKeyKindMerge), value, false)
+	return w.addPoint(base.MakeInternalKey(key, 0, InternalKeyKindMerge), value, nil, false)
 }
 
 // Add adds a key/value pair to the table being written. For a given Writer,
@@ -775,7 +780,38 @@ func (w *Writer) AddWithForceObsolete(key InternalKey, value []byte, forceObsole
 			"pebble: range keys must be added via one of the RangeKey* functions")
 		return w.err
 	}
-	return w.addPoint(key, value, forceObsolete)
+	return w.addPoint(key, value, nil, forceObsolete)
+}
+
+// blobHandleValue is the blob handle, and the value's short attribute, of a
+// SET added with AddWithBlobHandle.
+type blobHandleValue struct {
+	handle    blob.Handle
+	attribute base.ShortAttribute
+}
+
+// AddWithBlobHandle adds a SET whose value is stored in a blob file, writing
+// the handle in place of the value. The short attribute is the value's
+// attribute, as computed by the ShortAttributeExtractor (if any).
+// forceObsolete has the same meaning as for AddWithForceObsolete.
+//
+// Blob handles require TableFormatPebblev3 or later. The blob files that
+// are referenced are recorded in the WriterMetadata.
+func (w *Writer) AddWithBlobHandle(
+	key InternalKey, h blob.Handle, attribute base.ShortAttribute, forceObsolete bool,
+) error {
+	if w.err != nil {
+		return w.err
+	}
+	if key.Kind() != InternalKeyKindSet {
+		w.err = errors.Errorf("pebble: blob handles are only supported for SETs, not %s", key.Kind())
+		return w.err
+	}
+	if w.tableFormat < TableFormatPebblev3 {
+		w.err = errors.Errorf("pebble: table format %s does not support blob handles", w.tableFormat)
+		return w.err
+	}
+	return w.addPoint(key, nil, &blobHandleValue{handle: h, attribute: attribute}, forceObsolete)
 }
 
 func (w *Writer) makeAddPointDecisionV2(key InternalKey) error {
@@ -922,10 +958,18 @@ func (w *Writer) makeAddPointDecisionV3(
 	return setHasSamePrefix, considerWriteToValueBlock, isObsolete, nil
 }
 
-func (w *Writer) addPoint(key InternalKey, value []byte, forceObsolete bool) error {
+// addPoint adds a point key. If bh is non-nil, the key is a SET whose value
+// is stored in a blob file, and value is ignored.
+func (w *Writer) addPoint(
+	key InternalKey, value []byte, bh *blobHandleValue, forceObsolete bool,
+) error {
 	if w.isStrictObsolete && key.Kind() == InternalKeyKindMerge {
 		return errors.Errorf("MERGE not supported in a strict-obsolete sstable")
 	}
+	valueLen := len(value)
+	if bh != nil {
+		valueLen = int(bh.handle.ValueLen)
+	}
 	var err error
 	var setHasSameKeyPrefix, writeToValueBlock, addPrefixToValueStoredWithKey bool
 	var isObsolete bool
@@ -936,8 +980,11 @@ func (w *Writer) addPoint(key InternalKey, value []byte, forceObsolete bool) err
 		// ignore this maxSharedKeyLen.
 		maxSharedKeyLen = w.lastPointKeyInfo.prefixLen
 		setHasSameKeyPrefix, writeToValueBlock, isObsolete, err =
-			w.makeAddPointDecisionV3(key, len(value))
+			w.makeAddPointDecisionV3(key, valueLen)
 		addPrefixToValueStoredWithKey = base.TrailerKind(key.Trailer) == InternalKeyKindSet
+		// A value that is already in a blob file is never moved to a value
+		// block.
+		writeToValueBlock = writeToValueBlock && bh == nil
 	} else {
 		err = w.makeAddPointDecisionV2(key)
 	}
@@ -949,7 +996,14 @@ func (w *Writer) addPoint(key InternalKey, value []byte, forceObsolete bool) err
 	var valueStoredWithKey []byte
 	var prefix valuePrefix
 	var valueStoredWithKeyLen int
-	if writeToValueBlock {
+	if bh != nil {
+		valueStoredWithKey = bh.handle.Encode(w.blockBuf.tmp[:0])
+		valueStoredWithKeyLen = len(valueStoredWithKey) + 1
+		prefix = makePrefixForBlobHandle(setHasSameKeyPrefix, bh.attribute)
+		w.addBlobFile(bh.handle.FileNum)
+		w.props.NumBlobValues++
+		w.props.BlobValuesSize += uint64(valueLen)
+	} else if writeToValueBlock {
 		vh, err := w.valueBlockWriter.addValue(value)
 		if err != nil {
 			return err
@@ -1041,12 +1095,29 @@ func (w *Writer) addPoint(key InternalKey, value []byte, forceObsolete bool) err
 		w.props.RawPointTombstoneValueSize += size
 	case InternalKeyKindMerge:
 		w.props.NumMergeOperands++
+		w.props.ValueSizes.Record(uint64(valueLen))
+	case InternalKeyKindSet, InternalKeyKindSetWithDelete:
+		w.props.ValueSizes.Record(uint64(valueLen))
 	}
+	w.props.KeySizes.Record(uint64(len(key.UserKey)))
 	w.props.RawKeySize += uint64(key.Size())
-	w.props.RawValueSize += uint64(len(value))
+	w.props.RawValueSize += uint64(valueLen)
 	return nil
 }
 
+// addBlobFile records that the table references the blob file.
+func (w *Writer) addBlobFile(fileNum base.DiskFileNum) {
+	// Tables typically reference few blob files, and consecutive handles
+	// usually reference the same file.
+	if n := len(w.meta.BlobFiles); n > 0 && w.meta.BlobFiles[n-1] == fileNum {
+		return
+	}
+	i, found := slices.BinarySearch(w.meta.BlobFiles, fileNum)
+	if !found {
+		w.meta.BlobFiles = slices.Insert(w.meta.BlobFiles, i, fileNum)
+	}
+}
+
 func (w *Writer) prettyTombstone(k InternalKey, value []byte) fmt.Formatter {
 	return keyspan.Span{
 		Start: k.UserKey,
@@ -1368,6 +1439,9 @@ func (w *Writer) tempRangeKeyCopy(k []byte) []byte {
 func (w *Writer) maybeAddToFilter(key []byte) {
 	if w.filter != nil {
 		prefix := key[:w.split(key)]
+		if w.prefixExtractor != nil {
+			prefix = w.prefixExtractor.FilterKey(prefix)
+		}
 		w.filter.addKey(prefix)
 	}
 }
@@ -1380,6 +1454,8 @@ func (w *Writer) flush(key InternalKey) error {
 	}
 	w.dataBlockBuf.finish()
 	w.dataBlockBuf.compressAndChecksum(w.compression)
+	w.props.DataBlockSizes.Record(uint64(len(w.dataBlockBuf.uncompressed)))
+	w.props.CompressedDataBlockSizes.Record(uint64(len(w.dataBlockBuf.compressed)))
 	// Since dataBlockEstimates.addInflightDataBlock was never called, the
 	// inflightSize is set to 0.
 	w.coordination.sizeEstimate.dataBlockCompressed(len(w.dataBlockBuf.compressed), 0)
@@ -1898,10 +1974,13 @@ func (w *Writer) Close() (err error) {
 	// Finish the last data block, or force an empty data block if there
 	// aren't any data blocks at all.
 	if w.dataBlockBuf.dataBlock.nEntries > 0 || w.indexBlock.block.nEntries == 0 {
-		bh, err := w.writeBlock(w.dataBlockBuf.dataBlock.finish(), w.compression, &w.dataBlockBuf.blockBuf)
+		b := w.dataBlockBuf.dataBlock.finish()
+		bh, err := w.writeBlock(b, w.compression, &w.dataBlockBuf.blockBuf)
 		if err != nil {
 			return err
 		}
+		w.props.DataBlockSizes.Record(uint64(len(b)))
+		w.props.CompressedDataBlockSizes.Record(bh.Length)
 		bhp, err := w.maybeAddBlockPropertiesToBlockHandle(bh)
 		if err != nil {
 			return err
@@ -1929,6 +2008,9 @@ func (w *Writer) Close() (err error) {
 		metaindex.add(InternalKey{UserKey: []byte(w.filter.metaName())}, w.blockBuf.tmp[:n])
 		w.props.FilterPolicyName = w.filter.policyName()
 		w.props.FilterSize = bh.Length
+		if w.prefixExtractor != nil {
+			w.props.PrefixExtractorName = w.prefixExtractor.Name
+		}
 	}
 
 	var indexBH BlockHandle
@@ -2198,6 +2280,7 @@ func NewWriter(writable objstorage.Writable, o WriterOptions, extraOpts ...Write
 		indexBlockSizeThreshold: (o.IndexBlockSize*o.BlockSizeThreshold + 99) / 100,
 		compare:                 o.Comparer.Compare,
 		split:                   o.Comparer.Split,
+		prefixExtractor:         o.PrefixExtractor,
 		formatKey:               o.Comparer.FormatKey,
 		compression:             o.Compression,
 		separator:               o.Comparer.Separator,
@@ -2208,6 +2291,7 @@ func NewWriter(writable objstorage.Writable, o WriterOptions, extraOpts ...Write
 		cache:                   o.Cache,
 		restartInterval:         o.BlockRestartInterval,
 		checksumType:            o.Checksum,
+		disableKeyOrderChecks:   o.Unsafe.DisableKeyOrderChecks,
 		indexBlock:              newIndexBlockBuf(o.Parallelism),
 		rangeDelBlock: blockWriter{
 			restartInterval: 1,
@@ -2333,9 +2417,5 @@ func internalGetProperties(w *Writer) *Properties {
 }
 
 func init() {
-	private.SSTableWriterDisableKeyOrderChecks = func(i interface{}) {
-		w := i.(*Writer)
-		w.disableKeyOrderChecks = true
-	}
 	private.SSTableInternalProperties = internalGetProperties
 }
@@ -24,6 +24,7 @@ import (
 	"github.com/cockroachdb/pebble/internal/testkeys"
 	"github.com/cockroachdb/pebble/objstorage"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/sstable/blob"
 	"github.com/cockroachdb/pebble/vfs"
 	"github.com/stretchr/testify/require"
 )
@@ -921,6 +922,82 @@ func TestWriterRace(t *testing.T) {
 	wg.Wait()
 }
 
+// testBlobValueFetcher fetches blob values from an in-memory map.
+type testBlobValueFetcher map[blob.Handle][]byte
+
+func (f testBlobValueFetcher) Fetch(
+	handle []byte, valLen int32, buf []byte,
+) (val []byte, callerOwned bool, err error) {
+	h, err := blob.DecodeHandle(handle)
+	if err != nil {
+		return nil, false, err
+	}
+	v, ok := f[h]
+	if !ok {
+		return nil, false, errors.Newf("unknown blob handle %s", h)
+	}
+	return v, false, nil
+}
+
+func TestWriterWithBlobHandles(t *testing.T) {
+	fetcher := testBlobValueFetcher{}
+	f := &memFile{}
+	w := NewWriter(f, WriterOptions{TableFormat: TableFormatPebblev4})
+	for i := 0; i < 10; i++ {
+		key := base.MakeInternalKey([]byte(fmt.Sprintf("k%02d", i)), uint64(i), InternalKeyKindSet)
+		value := []byte(fmt.Sprintf("value-%d", i))
+		if i%2 == 0 {
+			require.NoError(t, w.Add(key, value))
+			continue
+		}
+		h := blob.Handle{FileNum: base.DiskFileNum(10 + i%3), Offset: uint64(i * 100), ValueLen: uint32(len(value))}
+		fetcher[h] = value
+		require.NoError(t, w.AddWithBlobHandle(key, h, base.ShortAttribute(i%8), false /* forceObsolete */))
+	}
+	require.NoError(t, w.Close())
+	meta, err := w.Metadata()
+	require.NoError(t, err)
+	require.Equal(t, []base.DiskFileNum{10, 11, 12}, meta.BlobFiles)
+	require.Equal(t, uint64(5), meta.Properties.NumBlobValues)
+
+	read := func(o ReaderOptions, fn func(i int, k *InternalKey, v base.LazyValue)) {
+		r, err := NewMemReader(f.Data(), o)
+		require.NoError(t, err)
+		defer r.Close()
+		it, err := r.NewIter(NoTransforms, nil, nil)
+		require.NoError(t, err)
+		defer it.Close()
+		i := 0
+		for k, v := it.First(); k != nil; k, v = it.Next() {
+			fn(i, k, v)
+			i++
+		}
+		require.Equal(t, 10, i)
+	}
+	read(ReaderOptions{BlobValueFetcher: fetcher}, func(i int, k *InternalKey, v base.LazyValue) {
+		value, _, err := v.Value(nil)
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("value-%d", i), string(value))
+		h, attr, ok, err := BlobHandle(v)
+		require.NoError(t, err)
+		require.Equal(t, i%2 == 1, ok)
+		if ok {
+			require.Equal(t, base.ShortAttribute(i%8), attr)
+			require.Equal(t, base.DiskFileNum(10+i%3), h.FileNum)
+			require.Equal(t, len(value), v.Len())
+		}
+	})
+	// Without a fetcher, blob values cannot be read.
+	read(ReaderOptions{}, func(i int, k *InternalKey, v base.LazyValue) {
+		_, _, err := v.Value(nil)
+		if i%2 == 1 {
+			require.Error(t, err)
+		} else {
+			require.NoError(t, err)
+		}
+	})
+}
+
 func TestObsoleteBlockPropertyCollectorFilter(t *testing.T) {
 	var c obsoleteKeyBlockPropertyCollector
 	var f obsoleteKeyBlockPropertyFilter
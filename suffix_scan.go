@@ -0,0 +1,83 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/sstable"
+)
+
+// FixedWidthSuffixes describes keys whose suffixes, as determined by
+// Comparer.Split, end with an unsigned integer encoded big-endian in a fixed
+// number of bytes, such as the timestamps of MVCC keys. It's used to read the
+// keys with suffixes within a range with DB.ScanAtSuffix.
+type FixedWidthSuffixes struct {
+	// Name is the name of the block property collecting the intervals of the
+	// suffixes of the keys of each block.
+	Name string
+	// Width is the number of bytes of the integers, in [1, 8]. The integer of
+	// a suffix is its last Width bytes. A suffix shorter than Width, such as
+	// the empty suffix, has no integer.
+	Width int
+}
+
+// BlockPropertyCollector returns the constructor of the block property
+// collector of the suffixes, to add to Options.BlockPropertyCollectors, for
+// the keys split by split. The sstables written without it, such as the ones
+// written before it was added, cannot be pruned by DB.ScanAtSuffix.
+func (s FixedWidthSuffixes) BlockPropertyCollector(split Split) func() BlockPropertyCollector {
+	return func() BlockPropertyCollector {
+		return sstable.NewFixedWidthSuffixCollector(s.Name, split, s.Width)
+	}
+}
+
+// Decode returns the integer of a suffix, or false if the suffix has none.
+func (s FixedWidthSuffixes) Decode(suffix []byte) (uint64, bool) {
+	return sstable.DecodeFixedWidthSuffix(suffix, s.Width)
+}
+
+// ScanAtSuffix returns an iterator over the point keys of the DB whose
+// suffixes, as described by s, have integers within [lower, upper), such as
+// the versions of MVCC keys written within a time window. The keys whose
+// suffixes have no integer are skipped. The iterator is configured by o like
+// an iterator constructed by NewIter; range keys, if o.KeyTypes includes
+// them, aren't filtered.
+//
+// The suffixes of the point keys are filtered across the memtables and the
+// sstables, and the blocks of the sstables that don't contain any key with a
+// suffix within the range are skipped without being read, using the block
+// property collected by s.BlockPropertyCollector, which must be configured in
+// Options.BlockPropertyCollectors for the pruning to take effect.
+func (d *DB) ScanAtSuffix(
+	s FixedWidthSuffixes, lower, upper uint64, o *IterOptions,
+) (*Iterator, error) {
+	if s.Width < 1 || s.Width > sstable.MaxFixedWidthSuffixWidth {
+		return nil, errors.Errorf("pebble: fixed-width suffix width %d must be in [1, %d]",
+			errors.Safe(s.Width), errors.Safe(sstable.MaxFixedWidthSuffixWidth))
+	}
+	var opts IterOptions
+	if o != nil {
+		opts = *o
+	}
+	// The filters are copied, so that the caller's are not mutated, with spare
+	// capacity as recommended by IterOptions.PointKeyFilters.
+	filters := make([]BlockPropertyFilter, 0, len(opts.PointKeyFilters)+2)
+	filters = append(filters, opts.PointKeyFilters...)
+	opts.PointKeyFilters = append(filters, sstable.NewFixedWidthSuffixFilter(s.Name, s.Width, lower, upper))
+
+	// The blocks are filtered at a coarse granularity, and the memtables not at
+	// all, so the keys outside of the range are skipped by the iterator. All
+	// the versions of a user key have the same suffix, so skipping a block
+	// never exposes a key shadowed by a key of the block.
+	split := d.opts.Comparer.Split
+	skipPoint := opts.SkipPoint
+	opts.SkipPoint = func(userKey []byte) bool {
+		if v, ok := s.Decode(userKey[split(userKey):]); !ok || v < lower || v >= upper {
+			return true
+		}
+		return skipPoint != nil && skipPoint(userKey)
+	}
+	return d.NewIter(&opts)
+}
@@ -0,0 +1,81 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanAtSuffix(t *testing.T) {
+	// Keys are a one-byte prefix followed by an eight-byte timestamp, except
+	// for the unsuffixed keys.
+	comparer := *DefaultComparer
+	comparer.Split = func(key []byte) int { return min(len(key), 1) }
+	comparer.Name = "test-fixed-width-suffixes"
+	suffixes := FixedWidthSuffixes{Name: "test.timestamps", Width: 8}
+	opts := (&Options{
+		FS:                          vfs.NewMem(),
+		Comparer:                    &comparer,
+		BlockPropertyCollectors:     []func() BlockPropertyCollector{suffixes.BlockPropertyCollector(comparer.Split)},
+		DisableAutomaticCompactions: true,
+	}).WithFSDefaults()
+	for i := range opts.Levels {
+		opts.Levels[i].BlockSize = 1
+	}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer d.Close()
+
+	key := func(prefix byte, ts uint64) []byte {
+		k := []byte{prefix, 0, 0, 0, 0, 0, 0, 0, 0}
+		binary.BigEndian.PutUint64(k[1:], ts)
+		return k
+	}
+	// Each timestamp is flushed to its own sstable, except the last ones, which
+	// remain in the memtable.
+	for ts := uint64(1); ts <= 10; ts++ {
+		for p := byte('a'); p <= 'e'; p++ {
+			require.NoError(t, d.Set(key(p, ts), []byte(fmt.Sprint(ts)), nil))
+		}
+		if ts <= 8 {
+			require.NoError(t, d.Flush())
+		}
+	}
+	require.NoError(t, d.Delete(key('c', 4), nil))
+	require.NoError(t, d.Set([]byte("b"), []byte("unsuffixed"), nil))
+
+	scan := func(lower, upper uint64) (string, uint64) {
+		iter, err := d.ScanAtSuffix(suffixes, lower, upper, nil)
+		require.NoError(t, err)
+		var keys []string
+		for valid := iter.First(); valid; valid = iter.Next() {
+			ts, _ := suffixes.Decode(iter.Key()[1:])
+			keys = append(keys, fmt.Sprintf("%c@%d=%s", iter.Key()[0], ts, iter.Value()))
+		}
+		stats := iter.Stats()
+		require.NoError(t, iter.Close())
+		return strings.Join(keys, " "), stats.InternalStats.BlockBytes
+	}
+
+	keys, prunedBytes := scan(4, 6)
+	require.Equal(t, "a@4=4 a@5=5 b@4=4 b@5=5 c@5=5 d@4=4 d@5=5 e@4=4 e@5=5", keys)
+	keys, _ = scan(9, 11)
+	require.Equal(t, "a@9=9 a@10=10 b@9=9 b@10=10 c@9=9 c@10=10 d@9=9 d@10=10 e@9=9 e@10=10", keys)
+	keys, _ = scan(20, 30)
+	require.Equal(t, "", keys)
+
+	// The blocks of the sstables without keys within the range aren't read.
+	_, allBytes := scan(0, 100)
+	require.Less(t, prunedBytes, allBytes/2)
+
+	_, err = d.ScanAtSuffix(FixedWidthSuffixes{Name: "test.timestamps", Width: 9}, 0, 1, nil)
+	require.Error(t, err)
+}
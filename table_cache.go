@@ -305,6 +305,20 @@ func (c *tableCacheContainer) withReader(meta physicalMeta, fn func(*sstable.Rea
 	return fn(v.reader)
 }
 
+// withBackingReader fetches the Reader of the sstable backing the table, which
+// may be virtual.
+func (c *tableCacheContainer) withBackingReader(
+	meta *fileMetadata, fn func(*sstable.Reader) error,
+) error {
+	s := c.tableCache.getShard(meta.FileBacking.DiskFileNum)
+	v := s.findNode(meta.FileBacking, &c.dbOpts)
+	defer s.unrefValue(v)
+	if v.err != nil {
+		return v.err
+	}
+	return fn(v.reader)
+}
+
 // withVirtualReader fetches a VirtualReader associated with a virtual sstable.
 func (c *tableCacheContainer) withVirtualReader(
 	meta virtualMeta, fn func(sstable.VirtualReader) error,
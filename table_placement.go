@@ -0,0 +1,62 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// MigrateTablePlacement moves the sstables stored on local storage in levels
+// placing their tables on shared storage to shared storage, and the sstables
+// stored on shared storage in levels placing their tables on local storage to
+// local storage (see LevelOptions.Placement and
+// Options.Experimental.CreateOnShared), and returns the number of sstables
+// moved. It's typically used after changing the placement of the levels,
+// which otherwise only affects the tables written by subsequent flushes and
+// compactions. External sstables (see IngestExternalFiles) are left in place.
+//
+// The sstables are durably marked for compaction, and rewritten in their
+// level by rewrite compactions, which are subject to Options.RateLimiter.
+// MigrateTablePlacement returns once all of the marked sstables have been
+// rewritten. It requires automatic compactions, which run the rewrite
+// compactions.
+func (d *DB) MigrateTablePlacement() (int, error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.opts.ReadOnly {
+		return 0, ErrReadOnly
+	}
+	if d.opts.DisableAutomaticCompactions {
+		return 0, errors.New("pebble: migrating sstables requires automatic compactions")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var n int
+	err := d.markFilesLocked(func(v *version) (found bool, files [numLevels][]*fileMetadata, _ error) {
+		for l := range v.Levels {
+			shared := d.opts.createOnShared(l)
+			iter := v.Levels[l].Iter()
+			for f := iter.First(); f != nil; f = iter.Next() {
+				objMeta, err := d.objProvider.Lookup(base.FileTypeTable, f.FileBacking.DiskFileNum)
+				if err != nil {
+					return false, files, err
+				}
+				if objMeta.IsExternal() || objMeta.IsShared() == shared {
+					continue
+				}
+				files[l] = append(files[l], f)
+				n++
+			}
+		}
+		return n > 0, files, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, d.compactMarkedFilesLocked()
+}
@@ -0,0 +1,110 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/objstorage/remote"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateTablePlacement(t *testing.T) {
+	mem := vfs.NewMem()
+	storage := remote.NewInMem()
+	makeOpts := func(l6 remote.Placement) *Options {
+		opts := &Options{
+			FS:                 mem,
+			FormatMajorVersion: FormatNewest,
+			Levels:             make([]LevelOptions, numLevels),
+		}
+		opts.Levels[numLevels-1].Placement = l6
+		opts.Experimental.RemoteStorage = remote.MakeSimpleFactory(map[remote.Locator]remote.Storage{
+			"": storage,
+		})
+		opts.Experimental.CreateOnShared = remote.CreateOnSharedLower
+		return opts
+	}
+	// placements returns the number of tables on local and shared storage.
+	placements := func(d *DB) (local, shared int) {
+		d.mu.Lock()
+		v := d.mu.versions.currentVersion()
+		d.mu.Unlock()
+		for l := range v.Levels {
+			iter := v.Levels[l].Iter()
+			for f := iter.First(); f != nil; f = iter.Next() {
+				objMeta, err := d.objProvider.Lookup(base.FileTypeTable, f.FileBacking.DiskFileNum)
+				require.NoError(t, err)
+				if objMeta.IsShared() {
+					shared++
+				} else {
+					local++
+				}
+			}
+		}
+		return local, shared
+	}
+	checkKeys := func(d *DB) {
+		for i := 0; i < 4; i++ {
+			v, closer, err := d.Get([]byte(fmt.Sprintf("k%d", i)))
+			require.NoError(t, err)
+			require.Equal(t, "v", string(v))
+			require.NoError(t, closer.Close())
+		}
+	}
+
+	d, err := Open("", makeOpts(remote.PlacementDefault))
+	require.NoError(t, err)
+	require.NoError(t, d.SetCreatorID(1))
+	for i := 0; i < 4; i++ {
+		key := []byte(fmt.Sprintf("k%d", i))
+		require.NoError(t, d.Set(key, []byte("v"), nil))
+		require.NoError(t, d.Compact(key, append(key, 0), false))
+	}
+	// The tables compacted into L6 are on shared storage.
+	local, shared := placements(d)
+	require.Equal(t, 0, local)
+	require.Equal(t, 4, shared)
+	n, err := d.MigrateTablePlacement()
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+	require.NoError(t, d.Close())
+
+	// Overriding the placement of L6 only affects the new tables, until the
+	// tables are migrated.
+	d, err = Open("", makeOpts(remote.PlacementLocal))
+	require.NoError(t, err)
+	local, shared = placements(d)
+	require.Equal(t, 0, local)
+	require.Equal(t, 4, shared)
+	n, err = d.MigrateTablePlacement()
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+	local, shared = placements(d)
+	require.Equal(t, 4, local)
+	require.Equal(t, 0, shared)
+	checkKeys(d)
+	require.NoError(t, d.Close())
+
+	// The tables move back to shared storage once the override is removed.
+	d, err = Open("", makeOpts(remote.PlacementDefault))
+	require.NoError(t, err)
+	n, err = d.MigrateTablePlacement()
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+	local, shared = placements(d)
+	require.Equal(t, 0, local)
+	require.Equal(t, 4, shared)
+	checkKeys(d)
+
+	d.opts.DisableAutomaticCompactions = true
+	_, err = d.MigrateTablePlacement()
+	require.Error(t, err)
+	d.opts.DisableAutomaticCompactions = false
+	require.NoError(t, d.Close())
+}
@@ -7,6 +7,7 @@ package pebble
 import (
 	"fmt"
 	"math"
+	"slices"
 
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
@@ -306,6 +307,7 @@ func (d *DB) loadTableStats(
 			props := r.CommonProperties()
 			stats.NumEntries = props.NumEntries
 			stats.NumDeletions = props.NumDeletions
+			stats.NumRangeDeletions = props.NumRangeDeletions
 			if props.NumPointDeletions() > 0 {
 				if err = d.loadTablePointKeyStats(props, v, level, meta, &stats); err != nil {
 					return
@@ -323,6 +325,20 @@ func (d *DB) loadTableStats(
 			// picking.
 			stats.NumRangeKeySets = props.NumRangeKeySets
 			stats.ValueBlocksSize = props.ValueBlocksSize
+			// The expiry property of a virtual table is that of its backing
+			// table, which bounds the expiry of the virtual table's keys.
+			var userProps map[string]string
+			switch r := r.(type) {
+			case *sstable.Reader:
+				userProps = r.Properties.UserProperties
+				stats.KeySizes = r.Properties.KeySizes
+				stats.ValueSizes = r.Properties.ValueSizes
+				stats.DataBlockSizes = r.Properties.DataBlockSizes
+				stats.CompressedDataBlockSizes = r.Properties.CompressedDataBlockSizes
+			case *sstable.VirtualReader:
+				userProps = r.UserProperties()
+			}
+			stats.MaxExpiry, err = tableMaxExpiry(userProps)
 			return
 		})
 	if err != nil {
@@ -660,6 +676,12 @@ func maybeSetStatsFromProperties(meta physicalMeta, props *sstable.Properties) b
 		return false
 	}
 
+	maxExpiry, err := tableMaxExpiry(props.UserProperties)
+	if err != nil {
+		// Defer to the table stats collector, which will surface the error.
+		return false
+	}
+
 	var pointEstimate uint64
 	if props.NumEntries > 0 {
 		// Use the file's own average key and value sizes as an estimate. This
@@ -673,10 +695,16 @@ func maybeSetStatsFromProperties(meta physicalMeta, props *sstable.Properties) b
 
 	meta.Stats.NumEntries = props.NumEntries
 	meta.Stats.NumDeletions = props.NumDeletions
+	meta.Stats.NumRangeDeletions = props.NumRangeDeletions
 	meta.Stats.NumRangeKeySets = props.NumRangeKeySets
 	meta.Stats.PointDeletionsBytesEstimate = pointEstimate
 	meta.Stats.RangeDeletionsBytesEstimate = 0
 	meta.Stats.ValueBlocksSize = props.ValueBlocksSize
+	meta.Stats.MaxExpiry = maxExpiry
+	meta.Stats.KeySizes = props.KeySizes
+	meta.Stats.ValueSizes = props.ValueSizes
+	meta.Stats.DataBlockSizes = props.DataBlockSizes
+	meta.Stats.CompressedDataBlockSizes = props.CompressedDataBlockSizes
 	meta.StatsMarkValid()
 	return true
 }
@@ -1127,3 +1155,70 @@ func valueBlocksSizeForLevel(v *version, level int) (count uint64) {
 	}
 	return *v.Levels[level].Annotation(valueBlocksSizeAnnotator{}).(*uint64)
 }
+
+// sizeHistograms holds the histograms of the sizes of keys, values and data
+// blocks of a set of tables. See manifest.TableStats.KeySizes.
+type sizeHistograms struct {
+	keys, values, dataBlocks, compressedDataBlocks sstable.SizeHistogram
+}
+
+// sizeHistogramsAnnotator implements manifest.Annotator, annotating B-Tree
+// nodes with the merged size histograms of the files' stats. Its annotation
+// type is a *sizeHistograms. The histograms are only known once a table's
+// stats are loaded asynchronously, so its values are marked as cacheable only
+// if a file's stats have been loaded.
+type sizeHistogramsAnnotator struct{}
+
+var _ manifest.Annotator = sizeHistogramsAnnotator{}
+
+func (a sizeHistogramsAnnotator) Zero(dst interface{}) interface{} {
+	if dst == nil {
+		return &sizeHistograms{}
+	}
+	v := dst.(*sizeHistograms)
+	v.keys = v.keys[:0]
+	v.values = v.values[:0]
+	v.dataBlocks = v.dataBlocks[:0]
+	v.compressedDataBlocks = v.compressedDataBlocks[:0]
+	return v
+}
+
+func (a sizeHistogramsAnnotator) Accumulate(
+	f *fileMetadata, dst interface{},
+) (v interface{}, cacheOK bool) {
+	vptr := dst.(*sizeHistograms)
+	vptr.keys.Merge(f.Stats.KeySizes)
+	vptr.values.Merge(f.Stats.ValueSizes)
+	vptr.dataBlocks.Merge(f.Stats.DataBlockSizes)
+	vptr.compressedDataBlocks.Merge(f.Stats.CompressedDataBlockSizes)
+	return vptr, f.StatsValid()
+}
+
+func (a sizeHistogramsAnnotator) Merge(src interface{}, dst interface{}) interface{} {
+	srcV := src.(*sizeHistograms)
+	dstV := dst.(*sizeHistograms)
+	dstV.keys.Merge(srcV.keys)
+	dstV.values.Merge(srcV.values)
+	dstV.dataBlocks.Merge(srcV.dataBlocks)
+	dstV.compressedDataBlocks.Merge(srcV.compressedDataBlocks)
+	return dstV
+}
+
+// sizeHistogramsForLevel sets the size histograms of the level's metrics to
+// the merged histograms of the files of a level of the LSM. It only includes
+// the files for which table stats have been loaded. It uses a b-tree annotator
+// to cache intermediate values between calculations when possible. It must
+// not be called concurrently.
+//
+// REQUIRES: 0 <= level <= numLevels.
+func sizeHistogramsForLevel(v *version, level int, m *LevelMetrics) {
+	if v.Levels[level].Empty() {
+		return
+	}
+	h := v.Levels[level].Annotation(sizeHistogramsAnnotator{}).(*sizeHistograms)
+	// Copy the histograms, which are owned by the annotation cache.
+	m.Additional.KeySizes = slices.Clone(h.keys)
+	m.Additional.ValueSizes = slices.Clone(h.values)
+	m.Additional.DataBlockSizes = slices.Clone(h.dataBlocks)
+	m.Additional.CompressedDataBlockSizes = slices.Clone(h.compressedDataBlocks)
+}
@@ -0,0 +1,436 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package tool
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble"
+	"github.com/spf13/cobra"
+)
+
+// benchT implements the benchmarks run against a database.
+type benchT struct {
+	Root       *cobra.Command
+	FillRandom *cobra.Command
+	ReadRandom *cobra.Command
+	Scan       *cobra.Command
+	YCSB       *cobra.Command
+
+	// db opens the database, using the same options as the db commands.
+	db *dbT
+
+	// Flags.
+	numKeys      int64
+	valueSize    int
+	concurrency  int
+	duration     time.Duration
+	maxOps       int64
+	batchSize    int
+	scanLength   int
+	distribution string
+	workload     string
+	seed         int64
+	sync         bool
+}
+
+func newBench(db *dbT) *benchT {
+	b := &benchT{db: db}
+	b.Root = &cobra.Command{
+		Use:   "bench",
+		Short: "benchmark a database",
+		Long: `
+Benchmarks run against the database in the specified directory, which is
+created if it doesn't exist. The database is opened with the options of its
+OPTIONS file, like the db commands. The keys are "key" followed by a 12-digit
+decimal index, selected in [0, --num) according to --distribution.
+
+Each benchmark runs for --duration or until --ops operations are performed,
+printing the throughput and the latency histogram of each kind of operation.
+`,
+	}
+	b.FillRandom = &cobra.Command{
+		Use:   "fillrandom <dir>",
+		Short: "write random keys",
+		Long: `
+Write random keys in batches of --batch keys.
+`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			b.run(cmd, args[0], benchMix{benchWrite: 100})
+		},
+	}
+	b.ReadRandom = &cobra.Command{
+		Use:   "readrandom <dir>",
+		Short: "read random keys",
+		Long: `
+Read random keys with Get. The database should be filled first, e.g. with
+fillrandom.
+`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			b.run(cmd, args[0], benchMix{benchRead: 100})
+		},
+	}
+	b.Scan = &cobra.Command{
+		Use:   "scan <dir>",
+		Short: "scan from random keys",
+		Long: `
+Seek an iterator to a random key and step it forward over up to --scan-length
+keys.
+`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			b.run(cmd, args[0], benchMix{benchScan: 100})
+		},
+	}
+	b.YCSB = &cobra.Command{
+		Use:   "ycsb <dir>",
+		Short: "run a YCSB-style mixed workload",
+		Long: `
+Run a mix of operations modeled on the core YCSB workloads. The --workload flag
+is either one of the workloads:
+
+  A: 50% reads, 50% writes
+  B: 95% reads, 5% writes
+  C: 100% reads
+  D: 95% reads, 5% inserts
+  E: 95% scans, 5% inserts
+  F: 50% reads, 50% read-modify-writes
+
+or a custom mix of the form read=<pct>,write=<pct>,insert=<pct>,scan=<pct>,rmw=<pct>.
+Inserts write new keys beyond --num, which become candidates for the other
+operations. Selecting keys by --distribution=zipf skews the operations
+towards the smallest keys, and --distribution=latest towards the most recently
+inserted keys.
+`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			mix, err := parseBenchMix(b.workload)
+			if err != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "%s\n", err)
+				return
+			}
+			b.run(cmd, args[0], mix)
+		},
+	}
+	b.Root.AddCommand(b.FillRandom, b.ReadRandom, b.Scan, b.YCSB)
+
+	flags := b.Root.PersistentFlags()
+	flags.Int64Var(&b.numKeys, "num", 1000000, "number of keys in the keyspace")
+	flags.IntVar(&b.valueSize, "value-size", 100, "size of the values written, in bytes")
+	flags.IntVar(&b.concurrency, "concurrency", 1, "number of goroutines performing operations")
+	flags.DurationVar(&b.duration, "duration", 10*time.Second, "duration of the benchmark")
+	flags.Int64Var(&b.maxOps, "ops", 0, "number of operations after which to stop (0 is unlimited)")
+	flags.IntVar(&b.batchSize, "batch", 1, "number of keys written by each write or insert")
+	flags.IntVar(&b.scanLength, "scan-length", 100, "maximum number of keys stepped over by each scan")
+	flags.StringVar(&b.distribution, "distribution", "uniform", "key distribution (uniform, zipf or latest)")
+	flags.Int64Var(&b.seed, "seed", time.Now().UnixNano(), "random seed")
+	flags.BoolVar(&b.sync, "sync", false, "sync the WAL on every write")
+	flags.StringVar(&db.comparerName, "comparer", "", "comparer name (use default if empty)")
+	flags.StringVar(&db.mergerName, "merger", "", "merger name (use default if empty)")
+	b.YCSB.Flags().StringVar(&b.workload, "workload", "A", "workload (A-F) or custom mix")
+	return b
+}
+
+// benchOp is a kind of operation performed by a benchmark.
+type benchOp int8
+
+const (
+	benchRead benchOp = iota
+	benchWrite
+	benchInsert
+	benchScan
+	benchReadModifyWrite
+	numBenchOps
+)
+
+var benchOpNames = [numBenchOps]string{
+	benchRead:            "read",
+	benchWrite:           "write",
+	benchInsert:          "insert",
+	benchScan:            "scan",
+	benchReadModifyWrite: "rmw",
+}
+
+// benchMix holds the percentage of the operations of each kind.
+type benchMix [numBenchOps]int
+
+var ycsbWorkloads = map[string]benchMix{
+	"A": {benchRead: 50, benchWrite: 50},
+	"B": {benchRead: 95, benchWrite: 5},
+	"C": {benchRead: 100},
+	"D": {benchRead: 95, benchInsert: 5},
+	"E": {benchScan: 95, benchInsert: 5},
+	"F": {benchRead: 50, benchReadModifyWrite: 50},
+}
+
+func parseBenchMix(s string) (benchMix, error) {
+	if mix, ok := ycsbWorkloads[strings.ToUpper(s)]; ok {
+		return mix, nil
+	}
+	var mix benchMix
+	var total int
+	for _, field := range strings.Split(s, ",") {
+		name, pct, ok := strings.Cut(field, "=")
+		if !ok {
+			return mix, errors.Errorf("invalid workload %q", s)
+		}
+		op := benchOp(-1)
+		for i, n := range benchOpNames {
+			if n == name {
+				op = benchOp(i)
+			}
+		}
+		if op < 0 {
+			return mix, errors.Errorf("unknown operation %q in workload %q", name, s)
+		}
+		v, err := strconv.Atoi(pct)
+		if err != nil || v < 0 {
+			return mix, errors.Errorf("invalid percentage %q in workload %q", pct, s)
+		}
+		mix[op] += v
+		total += v
+	}
+	if total != 100 {
+		return mix, errors.Errorf("percentages of workload %q sum to %d, not 100", s, total)
+	}
+	return mix, nil
+}
+
+// benchOpen is an OpenOption opening the database for benchmarking.
+type benchOpen struct{}
+
+func (benchOpen) Apply(dirname string, opts *pebble.Options) {
+	opts.ReadOnly = false
+}
+
+// benchWorker holds the state of a goroutine performing operations.
+type benchWorker struct {
+	rng   *rand.Rand
+	zipf  *rand.Zipf
+	value []byte
+	hists [numBenchOps]*hdrhistogram.Histogram
+	// keys is the number of keys read by reads and scans, and written by
+	// writes and inserts.
+	keys  [numBenchOps]int64
+	found int64
+}
+
+// Latencies are recorded in microseconds, up to a minute.
+const benchMaxLatencyMicros = int64(time.Minute / time.Microsecond)
+
+func (b *benchT) run(cmd *cobra.Command, dir string, mix benchMix) {
+	stdout, stderr := cmd.OutOrStdout(), cmd.ErrOrStderr()
+	switch {
+	case b.numKeys <= 0:
+		fmt.Fprintf(stderr, "--num must be positive\n")
+		return
+	case b.concurrency <= 0:
+		fmt.Fprintf(stderr, "--concurrency must be positive\n")
+		return
+	case b.batchSize <= 0:
+		fmt.Fprintf(stderr, "--batch must be positive\n")
+		return
+	}
+	switch b.distribution {
+	case "uniform", "zipf", "latest":
+	default:
+		fmt.Fprintf(stderr, "unknown distribution %q\n", b.distribution)
+		return
+	}
+
+	db, err := b.db.openDB(dir, benchOpen{})
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	defer b.db.closeDB(stderr, db)
+
+	writeOpts := pebble.NoSync
+	if b.sync {
+		writeOpts = pebble.Sync
+	}
+	// numKeys is the number of keys in the keyspace, which is extended by
+	// inserts.
+	var numKeys atomic.Int64
+	numKeys.Store(b.numKeys)
+	var ops atomic.Int64
+	var firstErr error
+	var errOnce sync.Once
+	deadline := time.Now().Add(b.duration)
+
+	workers := make([]*benchWorker, b.concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := range workers {
+		w := &benchWorker{
+			rng:   rand.New(rand.NewSource(b.seed + int64(i))),
+			value: make([]byte, b.valueSize),
+		}
+		w.zipf = rand.NewZipf(w.rng, 1.1, 1, uint64(b.numKeys-1))
+		for op := range w.hists {
+			w.hists[op] = hdrhistogram.New(1, benchMaxLatencyMicros, 2)
+		}
+		workers[i] = w
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(deadline) && (b.maxOps == 0 || ops.Add(1) <= b.maxOps) {
+				op := w.pickOp(&mix)
+				opStart := time.Now()
+				if err := b.perform(db, w, op, &numKeys, writeOpts); err != nil {
+					errOnce.Do(func() { firstErr = err })
+					return
+				}
+				_ = w.hists[op].RecordValue(int64(time.Since(opStart) / time.Microsecond))
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	if firstErr != nil {
+		fmt.Fprintf(stderr, "%s\n", firstErr)
+	}
+
+	var total benchWorker
+	for op := range total.hists {
+		total.hists[op] = hdrhistogram.New(1, benchMaxLatencyMicros, 2)
+	}
+	for _, w := range workers {
+		for op := range w.hists {
+			total.hists[op].Merge(w.hists[op])
+			total.keys[op] += w.keys[op]
+		}
+		total.found += w.found
+	}
+	b.printResults(stdout, &total, elapsed)
+}
+
+// pickOp picks the kind of the next operation according to the mix.
+func (w *benchWorker) pickOp(mix *benchMix) benchOp {
+	n := w.rng.Intn(100)
+	for op, pct := range mix {
+		if n < pct {
+			return benchOp(op)
+		}
+		n -= pct
+	}
+	panic("unreachable")
+}
+
+// pickKey picks the index of an existing key according to the distribution.
+func (b *benchT) pickKey(w *benchWorker, numKeys int64) int64 {
+	switch b.distribution {
+	case "zipf":
+		return int64(w.zipf.Uint64())
+	case "latest":
+		return max(numKeys-1-int64(w.zipf.Uint64()), 0)
+	default:
+		return w.rng.Int63n(numKeys)
+	}
+}
+
+func benchKey(buf []byte, i int64) []byte {
+	buf = append(buf[:0], "key"...)
+	s := strconv.AppendInt(nil, i, 10)
+	for n := len(s); n < 12; n++ {
+		buf = append(buf, '0')
+	}
+	return append(buf, s...)
+}
+
+func (b *benchT) perform(
+	db *pebble.DB, w *benchWorker, op benchOp, numKeys *atomic.Int64, writeOpts *pebble.WriteOptions,
+) error {
+	var key [32]byte
+	switch op {
+	case benchRead, benchReadModifyWrite:
+		k := benchKey(key[:0], b.pickKey(w, numKeys.Load()))
+		v, closer, err := db.Get(k)
+		if err != nil && !errors.Is(err, pebble.ErrNotFound) {
+			return err
+		}
+		w.keys[op]++
+		if err == nil {
+			w.found++
+			copy(w.value, v)
+			if err := closer.Close(); err != nil {
+				return err
+			}
+		}
+		if op == benchReadModifyWrite {
+			w.rng.Read(w.value[:min(len(w.value), 8)])
+			return db.Set(k, w.value, writeOpts)
+		}
+		return nil
+
+	case benchWrite, benchInsert:
+		batch := db.NewBatch()
+		defer batch.Close()
+		for i := 0; i < b.batchSize; i++ {
+			var k int64
+			if op == benchInsert {
+				k = numKeys.Add(1) - 1
+			} else {
+				k = w.rng.Int63n(b.numKeys)
+			}
+			w.rng.Read(w.value)
+			if err := batch.Set(benchKey(key[:0], k), w.value, nil); err != nil {
+				return err
+			}
+		}
+		w.keys[op] += int64(b.batchSize)
+		return batch.Commit(writeOpts)
+
+	case benchScan:
+		iter, err := db.NewIter(nil)
+		if err != nil {
+			return err
+		}
+		n := 0
+		for valid := iter.SeekGE(benchKey(key[:0], b.pickKey(w, numKeys.Load()))); valid && n < b.scanLength; valid = iter.Next() {
+			n++
+		}
+		w.keys[op] += int64(n)
+		return iter.Close()
+
+	default:
+		panic("unreachable")
+	}
+}
+
+func (b *benchT) printResults(stdout io.Writer, total *benchWorker, elapsed time.Duration) {
+	var ops int64
+	for _, h := range total.hists {
+		ops += h.TotalCount()
+	}
+	secs := elapsed.Seconds()
+	fmt.Fprintf(stdout, "%d ops in %.1fs (%.1f ops/sec)\n", ops, secs, float64(ops)/secs)
+	tw := tabwriter.NewWriter(stdout, 2, 1, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "op\tops\tops/sec\tkeys\tp50(µs)\tp95(µs)\tp99(µs)\tmax(µs)\t\n")
+	for op, h := range total.hists {
+		if h.TotalCount() == 0 {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%.1f\t%d\t%d\t%d\t%d\t%d\t\n",
+			benchOpNames[op], h.TotalCount(), float64(h.TotalCount())/secs, total.keys[op],
+			h.ValueAtQuantile(50), h.ValueAtQuantile(95), h.ValueAtQuantile(99), h.Max())
+	}
+	_ = tw.Flush()
+	if reads := total.keys[benchRead] + total.keys[benchReadModifyWrite]; reads > 0 {
+		fmt.Fprintf(stdout, "%d of %d keys read found\n", total.found, reads)
+	}
+}
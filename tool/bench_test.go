@@ -0,0 +1,64 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package tool
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBench(t *testing.T) {
+	tool := New(FS(vfs.NewMem()))
+	run := func(args ...string) string {
+		var buf bytes.Buffer
+		c := &cobra.Command{}
+		c.AddCommand(tool.Commands...)
+		c.SetArgs(append([]string{"bench"}, args...))
+		c.SetOut(&buf)
+		c.SetErr(&buf)
+		require.NoError(t, c.Execute())
+		return buf.String()
+	}
+
+	out := run("fillrandom", "db", "--num=100", "--ops=200", "--batch=5", "--seed=1")
+	require.Regexp(t, `^200 ops in `, out)
+	require.Regexp(t, regexp.MustCompile(`(?m)^ *write +200 +\S+ +1000 +\d+`), out)
+
+	out = run("readrandom", "db", "--num=100", "--ops=100", "--concurrency=4", "--distribution=zipf")
+	require.Regexp(t, `^100 ops in `, out)
+	require.Regexp(t, regexp.MustCompile(`(?m)^ *read +100 `), out)
+	require.Regexp(t, regexp.MustCompile(`(?m)^\d+ of 100 keys read found$`), out)
+
+	out = run("scan", "db", "--num=100", "--ops=10", "--scan-length=1000", "--seed=1")
+	require.Regexp(t, regexp.MustCompile(`(?m)^ *scan +10 `), out)
+
+	out = run("ycsb", "db", "--num=100", "--ops=100", "--workload=insert=50,rmw=50", "--distribution=latest")
+	require.Regexp(t, regexp.MustCompile(`(?m)^ *insert +\d+ `), out)
+	require.Regexp(t, regexp.MustCompile(`(?m)^ *rmw +\d+ `), out)
+	require.NotRegexp(t, regexp.MustCompile(`(?m)^ *read `), out)
+
+	require.Equal(t, "percentages of workload \"read=50\" sum to 50, not 100\n",
+		run("ycsb", "db", "--workload=read=50"))
+	require.Equal(t, "unknown distribution \"normal\"\n",
+		run("readrandom", "db", "--distribution=normal"))
+}
+
+func TestParseBenchMix(t *testing.T) {
+	mix, err := parseBenchMix("e")
+	require.NoError(t, err)
+	require.Equal(t, benchMix{benchScan: 95, benchInsert: 5}, mix)
+	mix, err = parseBenchMix("read=10,write=20,insert=30,scan=35,rmw=5")
+	require.NoError(t, err)
+	require.Equal(t, benchMix{10, 20, 30, 35, 5}, mix)
+	for _, s := range []string{"G", "read=100,foo=0", "read=x", "read=-1,write=101"} {
+		_, err := parseBenchMix(s)
+		require.Error(t, err, s)
+	}
+}
@@ -0,0 +1,11 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package tool
+
+import "testing"
+
+func TestBlob(t *testing.T) {
+	runTests(t, "testdata/blob_*")
+}
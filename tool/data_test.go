@@ -17,6 +17,7 @@ import (
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/testkeys"
+	"github.com/cockroachdb/pebble/objstorage/remote"
 	"github.com/cockroachdb/pebble/vfs"
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/require"
@@ -55,6 +56,36 @@ func runTests(t *testing.T, path string) {
 				}
 				args = append(args, strings.Fields(d.Input)...)
 
+				// Files specified as mem://<path> are copied into an in-memory
+				// remote storage with the "mem" locator, as objects named after
+				// their base names.
+				var remoteStorage remote.Storage
+				for i := range args {
+					src, ok := strings.CutPrefix(args[i], "mem://")
+					if !ok {
+						continue
+					}
+					if remoteStorage == nil {
+						remoteStorage = remote.NewInMem()
+					}
+					data, err := os.ReadFile(normalize(src))
+					if err != nil {
+						return err.Error()
+					}
+					name := filepath.Base(src)
+					w, err := remoteStorage.CreateObject(name)
+					if err != nil {
+						return err.Error()
+					}
+					if _, err := w.Write(data); err != nil {
+						return err.Error()
+					}
+					if err := w.Close(); err != nil {
+						return err.Error()
+					}
+					args[i] = "mem://" + name
+				}
+
 				// The testdata files contain paths with "/" path separators, but we
 				// might be running on a system with a different path separator
 				// (e.g. Windows). Copy the input data into a mem filesystem which
@@ -120,6 +151,11 @@ func runTests(t *testing.T, path string) {
 					FS(fs),
 					OpenErrEnhancer(openErrEnhancer),
 				)
+				if remoteStorage != nil {
+					tool.ConfigureSharedStorage(remote.MakeSimpleFactory(map[remote.Locator]remote.Storage{
+						"mem": remoteStorage,
+					}), remote.CreateOnSharedNone, "")
+				}
 
 				c := &cobra.Command{}
 				c.AddCommand(tool.Commands...)
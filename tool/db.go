@@ -6,9 +6,14 @@ package tool
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
+	"slices"
+	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/errors/oserror"
@@ -30,13 +35,23 @@ type dbT struct {
 	Root       *cobra.Command
 	Check      *cobra.Command
 	Checkpoint *cobra.Command
+	Diff       *cobra.Command
+	Events     *cobra.Command
+	Excise     *cobra.Command
+	Export     *cobra.Command
 	Get        *cobra.Command
+	HotKeys    *cobra.Command
+	Ingest     *cobra.Command
+	Iterators  *cobra.Command
 	Logs       *cobra.Command
 	LSM        *cobra.Command
 	Properties *cobra.Command
+	Recover    *cobra.Command
 	Scan       *cobra.Command
 	Set        *cobra.Command
 	Space      *cobra.Command
+	Upgrade    *cobra.Command
+	Verify     *cobra.Command
 	IOBench    *cobra.Command
 
 	// Configuration.
@@ -47,18 +62,39 @@ type dbT struct {
 	openOptions     []OpenOption
 
 	// Flags.
-	comparerName  string
-	mergerName    string
-	fmtKey        keyFormatter
-	fmtValue      valueFormatter
-	start         key
-	end           key
-	count         int64
-	allLevels     bool
-	ioCount       int
-	ioParallelism int
-	ioSizes       string
-	verbose       bool
+	comparerName   string
+	mergerName     string
+	fmtKey         keyFormatter
+	fmtValue       valueFormatter
+	start          key
+	end            key
+	count          int64
+	diffLimit      int64
+	allLevels      bool
+	ioCount        int
+	ioParallelism  int
+	ioSizes        string
+	verbose        bool
+	minCompactions int64
+	httpTimeout    time.Duration
+	propsRanges    keyRanges
+	spaceDelim     key
+	spacePrefixes  keys
+	propsFormat    string
+	lsmFormat      string
+	recoverSeqNum  uint64
+	eventTypes     string
+	eventsSince    string
+	eventsUntil    string
+	eventsJob      int
+	exportFormat   exportFormat
+	exportOutput   string
+	exportFmtKey   keyFormatter
+	exportFmtValue valueFormatter
+	upgradeFormat  uint64
+	upgradeDryRun  bool
+	upgradeRewrite bool
+	upgradeRate    int64
 }
 
 func newDB(
@@ -77,6 +113,9 @@ func newDB(
 	}
 	d.fmtKey.mustSet("quoted")
 	d.fmtValue.mustSet("[%x]")
+	d.exportFormat = "csv"
+	d.exportFmtKey.mustSet("pretty")
+	d.exportFmtValue.mustSet("pretty")
 
 	d.Root = &cobra.Command{
 		Use:   "db",
@@ -103,6 +142,60 @@ database not be in use by another process.
 		Args: cobra.ExactArgs(2),
 		Run:  d.runCheckpoint,
 	}
+	d.Diff = &cobra.Command{
+		Use:   "diff <dir1> <dir2>",
+		Short: "print the differences between two DBs",
+		Long: `
+Print the differences between the records of two DBs, e.g. a DB and one of its
+checkpoints, as of a snapshot of each: the keys present in only one of the DBs,
+coalesced into key ranges when consecutive, the keys whose values differ, and
+the key ranges over which the range keys differ. The DBs are read in key order,
+so the differences are printed deterministically. Requires that both DBs use
+the same comparer, and that they not be in use by another process.
+`,
+		Args: cobra.ExactArgs(2),
+		Run:  d.runDiff,
+	}
+	d.Events = &cobra.Command{
+		Use:   "events <dir>",
+		Short: "print the event log",
+		Long: `
+Print the records of the event log persisted in the data directory when the
+EventLog option is enabled, oldest first: the flushes, compactions, ingestions,
+write stalls, background errors and disk slowness events of the database. The
+records may be filtered by type, time and job. With --verbose, the records are
+printed as JSON.
+`,
+		Args: cobra.ExactArgs(1),
+		Run:  d.runEvents,
+	}
+	d.Excise = &cobra.Command{
+		Use:   "excise <dir> <start> <end>",
+		Short: "delete all data in a key range",
+		Long: `
+Deletes all the data in the key range [start, end) through an edit of the
+MANIFEST, without reading or rewriting sstables: sstables contained within the
+range are removed, and sstables straddling its bounds are replaced by virtual
+sstables excluding it. Prints the sstables removed and created. Requires a
+format major version supporting virtual sstables, and that the specified
+database not be in use by another process.
+`,
+		Args: cobra.ExactArgs(3),
+		Run:  d.runExcise,
+	}
+	d.Export = &cobra.Command{
+		Use:   "export <dir>",
+		Short: "export the records of the DB as CSV or Parquet",
+		Long: `
+Export the records of the DB, as of a snapshot, as the rows of a CSV or Parquet
+file with the columns key and value. Keys and values are decoded by the --key
+and --value formatters, which default to the formatters of the DB's comparer,
+if any. Range keys aren't exported. Requires that the specified database not be
+in use by another process.
+`,
+		Args: cobra.ExactArgs(1),
+		Run:  d.runExport,
+	}
 	d.Get = &cobra.Command{
 		Use:   "get <dir> <key>",
 		Short: "get value for a key",
@@ -114,22 +207,43 @@ process.
 		Args: cobra.ExactArgs(2),
 		Run:  d.runGet,
 	}
+	d.Ingest = &cobra.Command{
+		Use:   "ingest <dir> <sstable>...",
+		Short: "ingest sstables",
+		Long: `
+Ingests the specified sstables into the DB. Sstables residing in remote storage
+configured through ConfigureSharedStorage may be specified as
+<locator>://<object-name>; these are downloaded before being ingested. Local
+sstables are removed once ingested. Requires that the specified database not be
+in use by another process.
+`,
+		Args: cobra.MinimumNArgs(2),
+		Run:  d.runIngest,
+	}
 	d.Logs = logs.NewCmd()
 	d.LSM = &cobra.Command{
 		Use:   "lsm <dir>",
 		Short: "print LSM structure",
 		Long: `
-Print the structure of the LSM tree. Requires that the specified database not
-be in use by another process.
+Print the structure of the LSM tree. With --format=json, print the JSON
+encoding of pebble.LSMInfo instead: the number of files, size and compaction
+score of each level, and the in-progress compactions. This is the same
+encoding served for a running database by DB.LSMHandler. Requires that the
+specified database not be in use by another process.
 `,
 		Args: cobra.ExactArgs(1),
 		Run:  d.runLSM,
 	}
 	d.Properties = &cobra.Command{
-		Use:   "properties <dir>",
-		Short: "print aggregated sstable properties",
+		Use:     "properties <dir>",
+		Aliases: []string{"props"},
+		Short:   "print aggregated sstable properties",
 		Long: `
-Print SSTable properties, aggregated per level of the LSM.
+Print SSTable properties, aggregated per level of the LSM. Each --range flag,
+in the form "<start>,<end>", additionally aggregates the properties of the
+sstables overlapping the key range [start, end), attributing each sstable's
+properties in full to every range it overlaps. Properties are printed as a
+table, or as JSON with --format=json.
 `,
 		Args: cobra.ExactArgs(1),
 		Run:  d.runProperties,
@@ -144,6 +258,19 @@ by another process.
 		Args: cobra.ExactArgs(1),
 		Run:  d.runScan,
 	}
+	d.Recover = &cobra.Command{
+		Use:   "recover <dir>",
+		Short: "recover the DB to a sequence number",
+		Long: `
+Performs a point-in-time recovery of the DB to the sequence number specified
+with --seqnum, permanently dropping the WAL records holding keys with greater
+sequence numbers, and prints a report of the dropped records. Fails if sstables
+hold keys with greater sequence numbers. Requires that the specified database
+not be in use by another process.
+`,
+		Args: cobra.ExactArgs(1),
+		Run:  d.runRecover,
+	}
 	d.Set = &cobra.Command{
 		Use:   "set <dir> <key> <value>",
 		Short: "set a value for a key",
@@ -161,10 +288,75 @@ not be in use by another process.
 Print the estimated filesystem space usage for the inclusive-inclusive range
 specified by --start and --end. Requires that the specified database not be in
 use by another process.
+
+With --delimiter or --prefix, print instead the estimated space used by each
+key prefix: the prefix of a key is the key up to and including the first
+occurrence of the delimiter (or the whole key if it has none), or the longest
+of the prefixes specified by --prefix. The space is attributed offline from the
+bounds of the sstables and the index entries of their data blocks, without
+reading the data blocks, so a data block holding the keys of several prefixes
+is attributed in equal parts to the prefixes of its first and last keys. The
+space includes the share of the metadata of the sstables, and is also printed
+as estimated uncompressed bytes and as the estimated bytes of point tombstones.
 `,
 		Args: cobra.ExactArgs(1),
 		Run:  d.runSpace,
 	}
+	d.Verify = &cobra.Command{
+		Use:   "verify <dir>",
+		Short: "verify every sstable referenced by the MANIFEST",
+		Long: `
+Verify that every sstable referenced by the current version in the MANIFEST
+exists with the recorded size, and read every block of each one as
+"sstable verify" does. Sstables residing in remote storage are skipped.
+Requires that the specified database not be in use by another process.
+`,
+		Args: cobra.ExactArgs(1),
+		Run:  d.runVerify,
+	}
+	d.Iterators = &cobra.Command{
+		Use:   "iterators <url>",
+		Short: "print the open iterators of a running database",
+		Long: `
+Print the open iterators of a running database, as served at the specified URL
+by the application's debug endpoint. The endpoint must serve the JSON encoding
+of the result of DB.OpenIterators, which requires that the database was opened
+with Options.DebugIterators set. Iterators are printed oldest first.
+`,
+		Args: cobra.ExactArgs(1),
+		Run:  d.runIterators,
+	}
+	d.HotKeys = &cobra.Command{
+		Use:   "hot-keys <url>",
+		Short: "print the hot keys of a running database",
+		Long: `
+Print the hottest keys and key ranges of a running database, as served at the
+specified URL by the application's debug endpoint. The endpoint must serve the
+JSON encoding of the result of DB.HotKeys, which requires that the database was
+opened with Options.HotKeys set.
+`,
+		Args: cobra.ExactArgs(1),
+		Run:  d.runHotKeys,
+	}
+	d.Upgrade = &cobra.Command{
+		Use:   "upgrade <dir> --format=<version>",
+		Short: "upgrade the format major version of the DB",
+		Long: `
+Ratchet the format major version of the DB to the version specified by
+--format, running the migrations of the intermediate versions. Prints the
+sstables written in table formats older than the table format written at the
+new version, which Pebble continues to read, but which may be rewritten in the
+newer format with --rewrite-tables. The rewrite is performed by compactions,
+whose I/O is limited to --rate bytes per second if non-zero. WALs are never
+rewritten: the WAL formats written at each version are readable at all the
+later versions.
+
+With --dry-run, the DB is opened read-only and only the report is printed.
+Requires that the specified database not be in use by another process.
+`,
+		Args: cobra.ExactArgs(1),
+		Run:  d.runUpgrade,
+	}
 	d.IOBench = &cobra.Command{
 		Use:   "io-bench <dir>",
 		Short: "perform sstable IO benchmark",
@@ -176,32 +368,87 @@ specified database.
 		Run:  d.runIOBench,
 	}
 
-	d.Root.AddCommand(d.Check, d.Checkpoint, d.Get, d.Logs, d.LSM, d.Properties, d.Scan, d.Set, d.Space, d.IOBench)
+	d.Root.AddCommand(d.Check, d.Checkpoint, d.Diff, d.Events, d.Excise, d.Export, d.Get, d.HotKeys, d.Ingest, d.Iterators, d.Logs, d.LSM, d.Properties, d.Recover, d.Scan, d.Set, d.Space, d.Upgrade, d.Verify, d.IOBench)
 	d.Root.PersistentFlags().BoolVarP(&d.verbose, "verbose", "v", false, "verbose output")
 
-	for _, cmd := range []*cobra.Command{d.Check, d.Checkpoint, d.Get, d.LSM, d.Properties, d.Scan, d.Set, d.Space} {
+	for _, cmd := range []*cobra.Command{d.Check, d.Checkpoint, d.Diff, d.Excise, d.Export, d.Get, d.Ingest, d.LSM, d.Properties, d.Recover, d.Scan, d.Set, d.Space, d.Upgrade, d.Verify} {
 		cmd.Flags().StringVar(
 			&d.comparerName, "comparer", "", "comparer name (use default if empty)")
 		cmd.Flags().StringVar(
 			&d.mergerName, "merger", "", "merger name (use default if empty)")
 	}
 
-	for _, cmd := range []*cobra.Command{d.Scan, d.Space} {
+	for _, cmd := range []*cobra.Command{d.Export, d.Scan, d.Space} {
 		cmd.Flags().Var(
 			&d.start, "start", "start key for the range")
 		cmd.Flags().Var(
 			&d.end, "end", "end key for the range")
 	}
 
-	d.Scan.Flags().Var(
-		&d.fmtKey, "key", "key formatter")
-	for _, cmd := range []*cobra.Command{d.Scan, d.Get} {
+	d.Space.Flags().Var(
+		&d.spaceDelim, "delimiter", "delimiter ending the prefixes of the keys to attribute the space to")
+	d.Space.Flags().Var(
+		&d.spacePrefixes, "prefix", "prefix of the keys to attribute the space to (may be repeated)")
+	d.Properties.Flags().Var(
+		&d.propsRanges, "range", "key range <start>,<end> to aggregate properties for (may be repeated)")
+	d.Properties.Flags().StringVar(
+		&d.propsFormat, "format", "table", "output format (table or json)")
+	d.LSM.Flags().StringVar(
+		&d.lsmFormat, "format", "table", "output format (table or json)")
+
+	for _, cmd := range []*cobra.Command{d.Diff, d.Scan, d.Properties, d.HotKeys, d.Space} {
+		cmd.Flags().Var(
+			&d.fmtKey, "key", "key formatter")
+	}
+	for _, cmd := range []*cobra.Command{d.Diff, d.Scan, d.Get} {
 		cmd.Flags().Var(
 			&d.fmtValue, "value", "value formatter")
 	}
 
 	d.Scan.Flags().Int64Var(
 		&d.count, "count", 0, "key count for scan (0 is unlimited)")
+	d.Diff.Flags().Int64Var(
+		&d.diffLimit, "limit", 0, "maximum number of differences to print (0 is unlimited)")
+
+	d.Export.Flags().Var(
+		&d.exportFmtKey, "key", "key formatter")
+	d.Export.Flags().Var(
+		&d.exportFmtValue, "value", "value formatter")
+	d.Export.Flags().Var(
+		&d.exportFormat, "format", "output format (csv or parquet)")
+	d.Export.Flags().StringVarP(
+		&d.exportOutput, "output", "o", "", "output file (stdout if empty)")
+
+	d.Events.Flags().StringVar(
+		&d.eventTypes, "type", "", "comma separated list of event types to print (all if empty)")
+	d.Events.Flags().StringVar(
+		&d.eventsSince, "since", "", "only print events at or after this RFC 3339 time")
+	d.Events.Flags().StringVar(
+		&d.eventsUntil, "until", "", "only print events before this RFC 3339 time")
+	d.Events.Flags().IntVar(
+		&d.eventsJob, "job", 0, "only print events of this job")
+
+	d.Recover.Flags().Uint64Var(
+		&d.recoverSeqNum, "seqnum", 0, "sequence number to recover up to (required)")
+	_ = d.Recover.MarkFlagRequired("seqnum")
+
+	d.Upgrade.Flags().Uint64Var(
+		&d.upgradeFormat, "format", 0, "format major version to upgrade to (required)")
+	_ = d.Upgrade.MarkFlagRequired("format")
+	d.Upgrade.Flags().BoolVar(
+		&d.upgradeDryRun, "dry-run", false, "only print what the upgrade would do")
+	d.Upgrade.Flags().BoolVar(
+		&d.upgradeRewrite, "rewrite-tables", false, "rewrite the sstables written in older table formats")
+	d.Upgrade.Flags().Int64Var(
+		&d.upgradeRate, "rate", 0, "maximum bytes per second of I/O of the rewrite (0 is unlimited)")
+
+	d.Iterators.Flags().Int64Var(
+		&d.minCompactions, "min-compactions", 0,
+		"only print iterators that have been open across at least this many compactions")
+	for _, cmd := range []*cobra.Command{d.Iterators, d.HotKeys} {
+		cmd.Flags().DurationVar(
+			&d.httpTimeout, "timeout", 30*time.Second, "timeout of the request to the running database")
+	}
 
 	d.IOBench.Flags().BoolVar(
 		&d.allLevels, "all-levels", false, "if set, benchmark all levels (default is only L5/L6)")
@@ -354,6 +601,176 @@ func (d *dbT) runCheck(cmd *cobra.Command, args []string) {
 		stats.NumPoints, makePlural("point", stats.NumPoints), stats.NumTombstones, makePlural("tombstone", int64(stats.NumTombstones)))
 }
 
+// httpGet issues a GET request to the running database at the specified URL,
+// which fails if it doesn't complete within the --timeout.
+func (d *dbT) httpGet(url string) (*http.Response, error) {
+	client := &http.Client{Timeout: d.httpTimeout}
+	return client.Get(url)
+}
+
+func (d *dbT) runIterators(cmd *cobra.Command, args []string) {
+	stdout, stderr := cmd.OutOrStdout(), cmd.ErrOrStderr()
+	resp, err := d.httpGet(args[0])
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(stderr, "%s: %s\n", args[0], resp.Status)
+		return
+	}
+	var iters []pebble.IteratorInfo
+	if err := json.NewDecoder(resp.Body).Decode(&iters); err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", args[0], err)
+		return
+	}
+
+	var n int
+	for _, it := range iters {
+		if it.Compactions < d.minCompactions {
+			continue
+		}
+		n++
+		fmt.Fprintf(stdout, "iterator created %s, open across %d compactions\n",
+			it.Created.UTC().Format(time.RFC3339), it.Compactions)
+		for _, line := range strings.Split(strings.TrimSpace(it.Stack), "\n") {
+			fmt.Fprintf(stdout, "  %s\n", line)
+		}
+	}
+	fmt.Fprintf(stdout, "%d open %s\n", n, makePlural("iterator", int64(n)))
+}
+
+func (d *dbT) runHotKeys(cmd *cobra.Command, args []string) {
+	stdout, stderr := cmd.OutOrStdout(), cmd.ErrOrStderr()
+	resp, err := d.httpGet(args[0])
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(stderr, "%s: %s\n", args[0], resp.Status)
+		return
+	}
+	var hk pebble.HotKeys
+	if err := json.NewDecoder(resp.Body).Decode(&hk); err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", args[0], err)
+		return
+	}
+
+	fmt.Fprintf(stdout, "%d sampled keys\n", hk.Sampled)
+	tw := tabwriter.NewWriter(stdout, 2, 1, 2, ' ', 0)
+	fmt.Fprintf(tw, "key\tcount\n")
+	for _, k := range hk.Keys {
+		fmt.Fprintf(tw, "%s\t%d\n", d.fmtKey.fn(k.Key), k.Count)
+	}
+	_ = tw.Flush()
+	fmt.Fprintf(stdout, "\n")
+	tw = tabwriter.NewWriter(stdout, 2, 1, 2, ' ', 0)
+	fmt.Fprintf(tw, "key range\tcount\n")
+	for _, r := range hk.Ranges {
+		end := "max"
+		if r.End != nil {
+			end = fmt.Sprint(d.fmtKey.fn(r.End))
+		}
+		fmt.Fprintf(tw, "[%s, %s)\t%d\n", d.fmtKey.fn(r.Start), end, r.Count)
+	}
+	_ = tw.Flush()
+}
+
+func (d *dbT) runVerify(cmd *cobra.Command, args []string) {
+	stdout, stderr := cmd.OutOrStdout(), cmd.ErrOrStderr()
+	dir := args[0]
+	db, err := d.openDB(dir)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	defer d.closeDB(stderr, db)
+
+	tables, err := db.SSTables()
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+
+	var verified, failed, skipped int
+	// Virtual sstables may share a backing sstable, which is only verified once.
+	seen := make(map[base.DiskFileNum]bool)
+	for level := range tables {
+		for _, info := range tables[level] {
+			if seen[info.BackingSSTNum] {
+				continue
+			}
+			seen[info.BackingSSTNum] = true
+			path := base.MakeFilepath(d.opts.FS, dir, base.FileTypeTable, info.BackingSSTNum)
+			fmt.Fprintf(stdout, "L%d %s\n", level, d.opts.FS.PathBase(path))
+			if info.BackingType != pebble.BackingTypeLocal {
+				fmt.Fprintf(stdout, "  skipped: sstable is not stored locally\n")
+				skipped++
+				continue
+			}
+			if d.verifySSTable(stdout, path, info) {
+				verified++
+			} else {
+				failed++
+			}
+		}
+	}
+	fmt.Fprintf(stdout, "verified %d %s", verified+failed, makePlural("sstable", int64(verified+failed)))
+	if skipped > 0 {
+		fmt.Fprintf(stdout, " (%d skipped)", skipped)
+	}
+	if failed == 0 {
+		fmt.Fprintf(stdout, ": OK\n")
+	} else {
+		fmt.Fprintf(stdout, ": %d with issues\n", failed)
+	}
+}
+
+// verifySSTable verifies the local sstable at path against its MANIFEST
+// metadata, printing any problems found. It returns true if the sstable is
+// free of problems.
+func (d *dbT) verifySSTable(stdout io.Writer, path string, info pebble.SSTableInfo) bool {
+	f, err := d.opts.FS.Open(path)
+	if err != nil {
+		fmt.Fprintf(stdout, "  %s\n", err)
+		return false
+	}
+	readable, err := sstable.NewSimpleReadable(f)
+	if err != nil {
+		fmt.Fprintf(stdout, "  %s\n", err)
+		return false
+	}
+	ok := true
+	// The size of a virtual sstable is an estimate of the portion of its
+	// backing sstable that it references.
+	if !info.Virtual && uint64(readable.Size()) != info.Size {
+		fmt.Fprintf(stdout, "  table: size is %d, but the MANIFEST records %d\n", readable.Size(), info.Size)
+		ok = false
+	}
+
+	o := sstable.ReaderOptions{
+		Comparer: d.opts.Comparer,
+		Filters:  d.opts.Filters,
+	}
+	r, err := sstable.NewReader(readable, o, d.comparers, d.mergers)
+	if err != nil {
+		fmt.Fprintf(stdout, "  %s\n", err)
+		return false
+	}
+	defer r.Close()
+
+	report, err := r.Verify()
+	if err != nil {
+		fmt.Fprintf(stdout, "  %s\n", err)
+		return false
+	}
+	printVerifyReport(stdout, report)
+	return ok && report.OK()
+}
+
 type nonReadOnly struct{}
 
 func (n nonReadOnly) Apply(dirname string, opts *pebble.Options) {
@@ -363,6 +780,141 @@ func (n nonReadOnly) Apply(dirname string, opts *pebble.Options) {
 	opts.L0CompactionThreshold = 10
 }
 
+// recoverUpTo is an OpenOption performing a point-in-time recovery, recording
+// the report of the dropped WAL records.
+type recoverUpTo struct {
+	seqNum uint64
+	info   *pebble.WALReplayTruncatedInfo
+}
+
+func (r recoverUpTo) Apply(dirname string, opts *pebble.Options) {
+	opts.RecoverUpToSeqNum = r.seqNum
+	l := pebble.EventListener{
+		WALReplayTruncated: func(info pebble.WALReplayTruncatedInfo) {
+			*r.info = info
+		},
+	}
+	if opts.EventListener != nil {
+		l = pebble.TeeEventListener(*opts.EventListener, l)
+	}
+	opts.EventListener = &l
+}
+
+func (d *dbT) runRecover(cmd *cobra.Command, args []string) {
+	stdout, stderr := cmd.OutOrStdout(), cmd.ErrOrStderr()
+	var info pebble.WALReplayTruncatedInfo
+	db, err := d.openDB(args[0], nonReadOnly{}, recoverUpTo{seqNum: d.recoverSeqNum, info: &info})
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	defer d.closeDB(stderr, db)
+	fmt.Fprintf(stdout, "%s\n", info)
+}
+
+// rateLimit is an OpenOption limiting the I/O of compactions to bytesPerSecond,
+// if non-zero.
+type rateLimit struct {
+	bytesPerSecond int64
+}
+
+func (r rateLimit) Apply(dirname string, opts *pebble.Options) {
+	if r.bytesPerSecond > 0 {
+		opts.RateLimiter = pebble.NewRateLimiter(r.bytesPerSecond)
+	}
+}
+
+func (d *dbT) runUpgrade(cmd *cobra.Command, args []string) {
+	stdout, stderr := cmd.OutOrStdout(), cmd.ErrOrStderr()
+	target := pebble.FormatMajorVersion(d.upgradeFormat)
+	if target < pebble.FormatMinSupported || target > pebble.FormatNewest {
+		fmt.Fprintf(stderr, "unsupported format major version %d (supported: %d to %d)\n",
+			d.upgradeFormat, pebble.FormatMinSupported, pebble.FormatNewest)
+		return
+	}
+	var db *pebble.DB
+	var err error
+	if d.upgradeDryRun {
+		db, err = d.openDB(args[0])
+	} else {
+		db, err = d.openDB(args[0], nonReadOnly{}, rateLimit{bytesPerSecond: d.upgradeRate})
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	defer d.closeDB(stderr, db)
+
+	current := db.FormatMajorVersion()
+	if current > target {
+		fmt.Fprintf(stderr, "database already at format major version %s; cannot reduce to %s\n", current, target)
+		return
+	}
+	fmt.Fprintf(stdout, "format major version: %s -> %s\n", current, target)
+
+	// Report the sstables written in older table formats than the table format
+	// written at the target version.
+	tables, err := db.SSTables(pebble.WithProperties())
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	type formatStats struct {
+		count int64
+		size  uint64
+	}
+	outdated := make(map[sstable.TableFormat]*formatStats)
+	for _, level := range tables {
+		for _, t := range level {
+			if t.TableFormat >= target.MaxTableFormat() {
+				continue
+			}
+			stats := outdated[t.TableFormat]
+			if stats == nil {
+				stats = &formatStats{}
+				outdated[t.TableFormat] = stats
+			}
+			stats.count++
+			stats.size += t.Size
+		}
+	}
+	fmt.Fprintf(stdout, "sstables in table formats older than %s:", target.MaxTableFormat())
+	if len(outdated) == 0 {
+		fmt.Fprintf(stdout, " none\n")
+	} else {
+		fmt.Fprintf(stdout, "\n")
+		formats := make([]sstable.TableFormat, 0, len(outdated))
+		for f := range outdated {
+			formats = append(formats, f)
+		}
+		slices.Sort(formats)
+		for _, f := range formats {
+			stats := outdated[f]
+			fmt.Fprintf(stdout, "  %s: %d %s, %s\n", f, stats.count, makePlural("sstable", stats.count),
+				humanize.Bytes.Uint64(stats.size))
+		}
+	}
+	fmt.Fprintf(stdout, "WAL files to rewrite: none (%d live)\n", db.Metrics().WAL.Files)
+
+	if d.upgradeDryRun {
+		fmt.Fprintf(stdout, "dry run: no changes made\n")
+		return
+	}
+	if err := db.RatchetFormatMajorVersion(target); err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	fmt.Fprintf(stdout, "upgraded to format major version %s\n", db.FormatMajorVersion())
+	if d.upgradeRewrite {
+		n, err := db.RewriteOutdatedTables()
+		if err != nil {
+			fmt.Fprintf(stderr, "%s\n", err)
+			return
+		}
+		fmt.Fprintf(stdout, "rewrote %d %s\n", n, makePlural("sstable", int64(n)))
+	}
+}
+
 func (d *dbT) runCheckpoint(cmd *cobra.Command, args []string) {
 	stderr := cmd.ErrOrStderr()
 	db, err := d.openDB(args[0], nonReadOnly{})
@@ -378,6 +930,241 @@ func (d *dbT) runCheckpoint(cmd *cobra.Command, args []string) {
 	}
 }
 
+func (d *dbT) runDiff(cmd *cobra.Command, args []string) {
+	stdout, stderr := cmd.OutOrStdout(), cmd.ErrOrStderr()
+	var dbs [2]*pebble.DB
+	var comparers [2]*pebble.Comparer
+	for i := range dbs {
+		db, err := d.openDB(args[i])
+		if err != nil {
+			fmt.Fprintf(stderr, "%s\n", err)
+			return
+		}
+		defer d.closeDB(stderr, db)
+		dbs[i] = db
+		comparers[i] = d.opts.Comparer
+		if comparers[i] == nil {
+			comparers[i] = base.DefaultComparer
+		}
+	}
+	if comparers[0].Name != comparers[1].Name {
+		fmt.Fprintf(stderr, "DBs use different comparers: %s and %s\n",
+			comparers[0].Name, comparers[1].Name)
+		return
+	}
+
+	// Update the internal formatter if this comparator has one specified.
+	if d.opts.Comparer != nil {
+		d.fmtKey.setForComparer(d.opts.Comparer.Name, d.comparers)
+		d.fmtValue.setForComparer(d.opts.Comparer.Name, d.comparers)
+	}
+
+	dd := &dbDiffer{
+		stdout:   stdout,
+		cmp:      comparers[0].Compare,
+		fmtKey:   d.fmtKey,
+		fmtValue: d.fmtValue,
+		names:    [2]string{args[0], args[1]},
+		limit:    d.diffLimit,
+	}
+	// Both the point keys and the range keys of each DB are read as of the
+	// same snapshot.
+	var snaps [2]*pebble.Snapshot
+	for i, db := range dbs {
+		snaps[i] = db.NewSnapshot()
+		defer snaps[i].Close()
+	}
+	diff := func(keyTypes pebble.IterKeyType, fn func([2]*pebble.Iterator) error) error {
+		var iters [2]*pebble.Iterator
+		for i, snap := range snaps {
+			iter, err := snap.NewIter(&pebble.IterOptions{KeyTypes: keyTypes})
+			if err != nil {
+				return err
+			}
+			defer iter.Close()
+			iters[i] = iter
+		}
+		return fn(iters)
+	}
+	if err := diff(pebble.IterKeyTypePointsOnly, dd.diffPoints); err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	if err := diff(pebble.IterKeyTypeRangesOnly, dd.diffRangeKeys); err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	if dd.truncated || (dd.limit > 0 && dd.diffs >= dd.limit) {
+		fmt.Fprintf(stdout, "stopped after %d %s (--limit)\n", dd.diffs, makePlural("difference", dd.diffs))
+		return
+	}
+	fmt.Fprintf(stdout, "%d %s\n", dd.diffs, makePlural("difference", dd.diffs))
+}
+
+func (d *dbT) runEvents(cmd *cobra.Command, args []string) {
+	stdout, stderr := cmd.OutOrStdout(), cmd.ErrOrStderr()
+	types := make(map[string]bool)
+	if d.eventTypes != "" {
+		for _, t := range strings.Split(d.eventTypes, ",") {
+			types[strings.TrimSpace(t)] = true
+		}
+	}
+	parseTime := func(s string) (time.Time, error) {
+		if s == "" {
+			return time.Time{}, nil
+		}
+		return time.Parse(time.RFC3339, s)
+	}
+	since, err := parseTime(d.eventsSince)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	until, err := parseTime(d.eventsUntil)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+
+	err = pebble.ReadEventLog(d.opts.FS, args[0], func(r pebble.EventLogRecord) error {
+		switch {
+		case len(types) > 0 && !types[r.Type]:
+			return nil
+		case !since.IsZero() && r.Time.Before(since):
+			return nil
+		case !until.IsZero() && !r.Time.Before(until):
+			return nil
+		case d.eventsJob != 0 && r.JobID != d.eventsJob:
+			return nil
+		}
+		if d.verbose {
+			b, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "%s\n", b)
+			return nil
+		}
+		fmt.Fprintf(stdout, "%s %s %s\n", r.Time.UTC().Format(time.RFC3339Nano), r.Type, r.Message)
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+	}
+}
+
+func (d *dbT) runExcise(cmd *cobra.Command, args []string) {
+	stdout, stderr := cmd.OutOrStdout(), cmd.ErrOrStderr()
+	var start, end key
+	if err := start.Set(args[1]); err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	if err := end.Set(args[2]); err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	db, err := d.openDB(args[0], nonReadOnly{})
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	defer d.closeDB(stderr, db)
+
+	// Flush first, so that the sstables removed and created by the excise
+	// aren't muddled by the flush of overlapping unflushed data.
+	if err := db.Flush(); err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	before, err := db.SSTables()
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	if err := db.Excise(pebble.KeyRange{Start: start, End: end}); err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	after, err := db.SSTables()
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+
+	// Print the difference between the sets of sstables of each level.
+	tables := func(level []pebble.SSTableInfo) map[base.FileNum]pebble.SSTableInfo {
+		m := make(map[base.FileNum]pebble.SSTableInfo, len(level))
+		for _, t := range level {
+			m[t.FileNum] = t
+		}
+		return m
+	}
+	for level := range after {
+		beforeTables, afterTables := tables(before[level]), tables(after[level])
+		for _, t := range before[level] {
+			if _, ok := afterTables[t.FileNum]; !ok {
+				fmt.Fprintf(stdout, "L%d: removed %s\n", level, t.FileNum)
+			}
+		}
+		for _, t := range after[level] {
+			if _, ok := beforeTables[t.FileNum]; ok {
+				continue
+			}
+			fmt.Fprintf(stdout, "L%d: created %s", level, t.FileNum)
+			if t.Virtual {
+				fmt.Fprintf(stdout, " (virtual, backed by %s)", t.BackingSSTNum)
+			}
+			fmt.Fprintf(stdout, " ")
+			formatKeyRange(stdout, d.fmtKey, &t.Smallest, &t.Largest)
+			fmt.Fprintf(stdout, "\n")
+		}
+	}
+}
+
+func (d *dbT) runExport(cmd *cobra.Command, args []string) {
+	stdout, stderr := cmd.OutOrStdout(), cmd.ErrOrStderr()
+	db, err := d.openDB(args[0])
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	defer d.closeDB(stderr, db)
+
+	// Update the internal formatter if this comparator has one specified.
+	if d.opts.Comparer != nil {
+		d.exportFmtKey.setForComparer(d.opts.Comparer.Name, d.comparers)
+		d.exportFmtValue.setForComparer(d.opts.Comparer.Name, d.comparers)
+	}
+
+	columns := []exportColumn{
+		{name: "key", kind: exportString},
+		{name: "value", kind: exportString},
+	}
+	err = export(d.opts.FS, d.exportOutput, stdout, d.exportFormat, columns, func(w exportWriter) error {
+		// The iterator reads a consistent snapshot of the DB.
+		iter, err := db.NewIter(&pebble.IterOptions{
+			LowerBound: d.start,
+			UpperBound: d.end,
+		})
+		if err != nil {
+			return err
+		}
+		values := make([]exportValue, 2)
+		for valid := iter.First(); valid; valid = iter.Next() {
+			values[0].s = formatExported(d.exportFmtKey.fn(iter.Key()))
+			values[1].s = formatExported(d.exportFmtValue.fn(iter.Key(), iter.Value()))
+			if err := w.WriteRow(values); err != nil {
+				return errors.CombineErrors(err, iter.Close())
+			}
+		}
+		return iter.Close()
+	})
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+	}
+}
+
 func (d *dbT) runGet(cmd *cobra.Command, args []string) {
 	stdout, stderr := cmd.OutOrStdout(), cmd.ErrOrStderr()
 	db, err := d.openDB(args[0])
@@ -407,6 +1194,20 @@ func (d *dbT) runGet(cmd *cobra.Command, args []string) {
 	}
 }
 
+func (d *dbT) runIngest(cmd *cobra.Command, args []string) {
+	stderr := cmd.ErrOrStderr()
+	db, err := d.openDB(args[0], nonReadOnly{})
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	defer d.closeDB(stderr, db)
+
+	if err := db.Ingest(args[1:]); err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+	}
+}
+
 func (d *dbT) runLSM(cmd *cobra.Command, args []string) {
 	stdout, stderr := cmd.OutOrStdout(), cmd.ErrOrStderr()
 	db, err := d.openDB(args[0])
@@ -416,7 +1217,22 @@ func (d *dbT) runLSM(cmd *cobra.Command, args []string) {
 	}
 	defer d.closeDB(stderr, db)
 
-	fmt.Fprintf(stdout, "%s", db.Metrics())
+	switch d.lsmFormat {
+	case "table":
+		fmt.Fprintf(stdout, "%s", db.Metrics())
+	case "json":
+		info := db.LSMInfo()
+		// Use the tool's clock, which is deterministic in tests.
+		info.Time = timeNow().UTC()
+		data, err := json.MarshalIndent(info, "", "  ")
+		if err != nil {
+			fmt.Fprintf(stderr, "%s\n", err)
+			return
+		}
+		fmt.Fprintf(stdout, "%s\n", data)
+	default:
+		fmt.Fprintf(stderr, "unknown format %q: expected table or json\n", d.lsmFormat)
+	}
 }
 
 func (d *dbT) runScan(cmd *cobra.Command, args []string) {
@@ -476,6 +1292,14 @@ func (d *dbT) runScan(cmd *cobra.Command, args []string) {
 
 func (d *dbT) runSpace(cmd *cobra.Command, args []string) {
 	stdout, stderr := cmd.OutOrStdout(), cmd.ErrOrStderr()
+	if len(d.spaceDelim) > 0 || len(d.spacePrefixes) > 0 {
+		if len(d.spaceDelim) > 0 && len(d.spacePrefixes) > 0 {
+			fmt.Fprintf(stderr, "--delimiter and --prefix are mutually exclusive\n")
+		} else if err := d.runSpaceByPrefix(stdout, args[0]); err != nil {
+			fmt.Fprintf(stderr, "%s\n", err)
+		}
+		return
+	}
 	db, err := d.openDB(args[0])
 	if err != nil {
 		fmt.Fprintf(stderr, "%s\n", err)
@@ -495,51 +1319,13 @@ func (d *dbT) runProperties(cmd *cobra.Command, args []string) {
 	stdout, stderr := cmd.OutOrStdout(), cmd.ErrOrStderr()
 	dirname := args[0]
 	err := func() error {
-		desc, err := pebble.Peek(dirname, d.opts.FS)
-		if err != nil {
-			return err
-		} else if !desc.Exists {
-			return oserror.ErrNotExist
+		switch d.propsFormat {
+		case "table", "json":
+		default:
+			return errors.Errorf("unknown format %q: expected table or json", d.propsFormat)
 		}
-		manifestFilename := d.opts.FS.PathBase(desc.ManifestFilename)
 
-		// Replay the manifest to get the current version.
-		f, err := d.opts.FS.Open(desc.ManifestFilename)
-		if err != nil {
-			return errors.Wrapf(err, "pebble: could not open MANIFEST file %q", manifestFilename)
-		}
-		defer f.Close()
-
-		cmp := base.DefaultComparer
-		var bve manifest.BulkVersionEdit
-		bve.AddedByFileNum = make(map[base.FileNum]*manifest.FileMetadata)
-		rr := record.NewReader(f, 0 /* logNum */)
-		for {
-			r, err := rr.Next()
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				return errors.Wrapf(err, "pebble: reading manifest %q", manifestFilename)
-			}
-			var ve manifest.VersionEdit
-			err = ve.Decode(r)
-			if err != nil {
-				return err
-			}
-			if err := bve.Accumulate(&ve); err != nil {
-				return err
-			}
-			if ve.ComparerName != "" {
-				cmp = d.comparers[ve.ComparerName]
-				d.fmtKey.setForComparer(ve.ComparerName, d.comparers)
-				d.fmtValue.setForComparer(ve.ComparerName, d.comparers)
-			}
-		}
-		v, err := bve.Apply(
-			nil /* version */, cmp, d.opts.FlushSplitBytes,
-			d.opts.Experimental.ReadCompactionRate,
-		)
+		v, cmp, err := d.loadVersion(dirname)
 		if err != nil {
 			return err
 		}
@@ -550,13 +1336,18 @@ func (d *dbT) runProperties(cmd *cobra.Command, args []string) {
 		}
 		defer objProvider.Close()
 
-		// Load and aggregate sstable properties.
-		tw := tabwriter.NewWriter(stdout, 2, 1, 4, ' ', 0)
-		var total props
-		var all []props
-		for _, l := range v.Levels {
-			iter := l.Iter()
-			var level props
+		// Load and aggregate sstable properties, per level and per requested key
+		// range. A table's properties are attributed in full to each of the
+		// ranges it overlaps.
+		all := make([]props, len(v.Levels)+1)
+		ranges := make([][]props, len(d.propsRanges))
+		bounds := make([]base.UserKeyBounds, len(d.propsRanges))
+		for i, r := range d.propsRanges {
+			ranges[i] = make([]props, len(v.Levels)+1)
+			bounds[i] = base.UserKeyBoundsEndExclusive(r.start, r.end)
+		}
+		for l := range v.Levels {
+			iter := v.Levels[l].Iter()
 			for t := iter.First(); t != nil; t = iter.Next() {
 				if t.Virtual {
 					// TODO(bananabrick): Handle virtual sstables here. We don't
@@ -566,78 +1357,46 @@ func (d *dbT) runProperties(cmd *cobra.Command, args []string) {
 					// physical sstable, and then extrapolating.
 					continue
 				}
-				err := d.addProps(objProvider, t.PhysicalMeta(), &level)
+				p, err := d.loadProps(objProvider, t.PhysicalMeta())
 				if err != nil {
 					return err
 				}
+				all[l].update(p)
+				for i := range bounds {
+					if t.Overlaps(cmp.Compare, &bounds[i]) {
+						ranges[i][l].update(p)
+					}
+				}
+			}
+			all[len(v.Levels)].update(all[l])
+			for i := range ranges {
+				ranges[i][len(v.Levels)].update(ranges[i][l])
+			}
+		}
+
+		if d.propsFormat == "json" {
+			out := propsOutputJSON{Levels: makePropsJSON(all)}
+			for i, r := range d.propsRanges {
+				out.Ranges = append(out.Ranges, rangePropsJSON{
+					Start:  fmt.Sprint(d.fmtKey.fn(r.start)),
+					End:    fmt.Sprint(d.fmtKey.fn(r.end)),
+					Levels: makePropsJSON(ranges[i]),
+				})
 			}
-			all = append(all, level)
-			total.update(level)
-		}
-		all = append(all, total)
-
-		fmt.Fprintln(tw, "\tL0\tL1\tL2\tL3\tL4\tL5\tL6\tTOTAL")
-
-		fmt.Fprintf(tw, "count\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n",
-			propArgs(all, func(p *props) interface{} { return p.Count })...)
-
-		fmt.Fprintln(tw, "seq num\t\t\t\t\t\t\t\t")
-		fmt.Fprintf(tw, "  smallest\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n",
-			propArgs(all, func(p *props) interface{} { return p.SmallestSeqNum })...)
-		fmt.Fprintf(tw, "  largest\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n",
-			propArgs(all, func(p *props) interface{} { return p.LargestSeqNum })...)
-
-		fmt.Fprintln(tw, "size\t\t\t\t\t\t\t\t")
-		fmt.Fprintf(tw, "  data\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
-			propArgs(all, func(p *props) interface{} { return humanize.Bytes.Uint64(p.DataSize) })...)
-		fmt.Fprintf(tw, "    blocks\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n",
-			propArgs(all, func(p *props) interface{} { return p.NumDataBlocks })...)
-		fmt.Fprintf(tw, "  index\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
-			propArgs(all, func(p *props) interface{} { return humanize.Bytes.Uint64(p.IndexSize) })...)
-		fmt.Fprintf(tw, "    blocks\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n",
-			propArgs(all, func(p *props) interface{} { return p.NumIndexBlocks })...)
-		fmt.Fprintf(tw, "    top-level\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
-			propArgs(all, func(p *props) interface{} { return humanize.Bytes.Uint64(p.TopLevelIndexSize) })...)
-		fmt.Fprintf(tw, "  filter\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
-			propArgs(all, func(p *props) interface{} { return humanize.Bytes.Uint64(p.FilterSize) })...)
-		fmt.Fprintf(tw, "  raw-key\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
-			propArgs(all, func(p *props) interface{} { return humanize.Bytes.Uint64(p.RawKeySize) })...)
-		fmt.Fprintf(tw, "  raw-value\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
-			propArgs(all, func(p *props) interface{} { return humanize.Bytes.Uint64(p.RawValueSize) })...)
-		fmt.Fprintf(tw, "  pinned-key\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
-			propArgs(all, func(p *props) interface{} { return humanize.Bytes.Uint64(p.SnapshotPinnedKeySize) })...)
-		fmt.Fprintf(tw, "  pinned-value\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
-			propArgs(all, func(p *props) interface{} { return humanize.Bytes.Uint64(p.SnapshotPinnedValueSize) })...)
-		fmt.Fprintf(tw, "  point-del-key-size\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
-			propArgs(all, func(p *props) interface{} { return humanize.Bytes.Uint64(p.RawPointTombstoneKeySize) })...)
-		fmt.Fprintf(tw, "  point-del-value-size\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
-			propArgs(all, func(p *props) interface{} { return humanize.Bytes.Uint64(p.RawPointTombstoneValueSize) })...)
-
-		fmt.Fprintln(tw, "records\t\t\t\t\t\t\t\t")
-		fmt.Fprintf(tw, "  set\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
-			propArgs(all, func(p *props) interface{} {
-				return humanize.Count.Uint64(p.NumEntries - p.NumDeletions - p.NumMergeOperands)
-			})...)
-		fmt.Fprintf(tw, "  delete\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
-			propArgs(all, func(p *props) interface{} { return humanize.Count.Uint64(p.NumDeletions - p.NumRangeDeletions) })...)
-		fmt.Fprintf(tw, "  delete-sized\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
-			propArgs(all, func(p *props) interface{} { return humanize.Count.Uint64(p.NumSizedDeletions) })...)
-		fmt.Fprintf(tw, "  range-delete\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
-			propArgs(all, func(p *props) interface{} { return humanize.Count.Uint64(p.NumRangeDeletions) })...)
-		fmt.Fprintf(tw, "  range-key-sets\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
-			propArgs(all, func(p *props) interface{} { return humanize.Count.Uint64(p.NumRangeKeySets) })...)
-		fmt.Fprintf(tw, "  range-key-unsets\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
-			propArgs(all, func(p *props) interface{} { return humanize.Count.Uint64(p.NumRangeKeyUnSets) })...)
-		fmt.Fprintf(tw, "  range-key-deletes\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
-			propArgs(all, func(p *props) interface{} { return humanize.Count.Uint64(p.NumRangeKeyDeletes) })...)
-		fmt.Fprintf(tw, "  merge\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
-			propArgs(all, func(p *props) interface{} { return humanize.Count.Uint64(p.NumMergeOperands) })...)
-		fmt.Fprintf(tw, "  pinned\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
-			propArgs(all, func(p *props) interface{} { return humanize.Count.Uint64(p.SnapshotPinnedKeys) })...)
-
-		if err := tw.Flush(); err != nil {
+			enc := json.NewEncoder(stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(out)
+		}
+
+		if err := writeProps(stdout, all); err != nil {
 			return err
 		}
+		for i, r := range d.propsRanges {
+			fmt.Fprintf(stdout, "\n[%s, %s)\n", d.fmtKey.fn(r.start), d.fmtKey.fn(r.end))
+			if err := writeProps(stdout, ranges[i]); err != nil {
+				return err
+			}
+		}
 		return nil
 	}()
 	if err != nil {
@@ -645,6 +1404,105 @@ func (d *dbT) runProperties(cmd *cobra.Command, args []string) {
 	}
 }
 
+// writeProps writes the properties of each level, followed by their total, as
+// a table.
+func writeProps(w io.Writer, all []props) error {
+	tw := tabwriter.NewWriter(w, 2, 1, 4, ' ', 0)
+	fmt.Fprintln(tw, "\tL0\tL1\tL2\tL3\tL4\tL5\tL6\tTOTAL")
+
+	fmt.Fprintf(tw, "count\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n",
+		propArgs(all, func(p *props) interface{} { return p.Count })...)
+
+	fmt.Fprintln(tw, "seq num\t\t\t\t\t\t\t\t")
+	fmt.Fprintf(tw, "  smallest\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n",
+		propArgs(all, func(p *props) interface{} { return p.SmallestSeqNum })...)
+	fmt.Fprintf(tw, "  largest\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n",
+		propArgs(all, func(p *props) interface{} { return p.LargestSeqNum })...)
+
+	fmt.Fprintln(tw, "size\t\t\t\t\t\t\t\t")
+	fmt.Fprintf(tw, "  data\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		propArgs(all, func(p *props) interface{} { return humanize.Bytes.Uint64(p.DataSize) })...)
+	fmt.Fprintf(tw, "    blocks\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n",
+		propArgs(all, func(p *props) interface{} { return p.NumDataBlocks })...)
+	fmt.Fprintf(tw, "    compression-ratio\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\n",
+		propArgs(all, func(p *props) interface{} { return p.compressionRatio() })...)
+	fmt.Fprintf(tw, "  value-blocks\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		propArgs(all, func(p *props) interface{} { return humanize.Bytes.Uint64(p.ValueBlocksSize) })...)
+	fmt.Fprintf(tw, "  index\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		propArgs(all, func(p *props) interface{} { return humanize.Bytes.Uint64(p.IndexSize) })...)
+	fmt.Fprintf(tw, "    blocks\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n",
+		propArgs(all, func(p *props) interface{} { return p.NumIndexBlocks })...)
+	fmt.Fprintf(tw, "    top-level\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		propArgs(all, func(p *props) interface{} { return humanize.Bytes.Uint64(p.TopLevelIndexSize) })...)
+	fmt.Fprintf(tw, "  filter\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		propArgs(all, func(p *props) interface{} { return humanize.Bytes.Uint64(p.FilterSize) })...)
+	fmt.Fprintf(tw, "  raw-key\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		propArgs(all, func(p *props) interface{} { return humanize.Bytes.Uint64(p.RawKeySize) })...)
+	fmt.Fprintf(tw, "  raw-value\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		propArgs(all, func(p *props) interface{} { return humanize.Bytes.Uint64(p.RawValueSize) })...)
+	fmt.Fprintf(tw, "  pinned-key\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		propArgs(all, func(p *props) interface{} { return humanize.Bytes.Uint64(p.SnapshotPinnedKeySize) })...)
+	fmt.Fprintf(tw, "  pinned-value\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		propArgs(all, func(p *props) interface{} { return humanize.Bytes.Uint64(p.SnapshotPinnedValueSize) })...)
+	fmt.Fprintf(tw, "  point-del-key-size\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		propArgs(all, func(p *props) interface{} { return humanize.Bytes.Uint64(p.RawPointTombstoneKeySize) })...)
+	fmt.Fprintf(tw, "  point-del-value-size\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		propArgs(all, func(p *props) interface{} { return humanize.Bytes.Uint64(p.RawPointTombstoneValueSize) })...)
+
+	fmt.Fprintln(tw, "records\t\t\t\t\t\t\t\t")
+	fmt.Fprintf(tw, "  set\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		propArgs(all, func(p *props) interface{} {
+			return humanize.Count.Uint64(p.NumEntries - p.NumDeletions - p.NumMergeOperands)
+		})...)
+	fmt.Fprintf(tw, "  delete\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		propArgs(all, func(p *props) interface{} { return humanize.Count.Uint64(p.NumDeletions - p.NumRangeDeletions) })...)
+	fmt.Fprintf(tw, "  delete-sized\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		propArgs(all, func(p *props) interface{} { return humanize.Count.Uint64(p.NumSizedDeletions) })...)
+	fmt.Fprintf(tw, "  range-delete\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		propArgs(all, func(p *props) interface{} { return humanize.Count.Uint64(p.NumRangeDeletions) })...)
+	fmt.Fprintf(tw, "  range-key-sets\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		propArgs(all, func(p *props) interface{} { return humanize.Count.Uint64(p.NumRangeKeySets) })...)
+	fmt.Fprintf(tw, "  range-key-unsets\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		propArgs(all, func(p *props) interface{} { return humanize.Count.Uint64(p.NumRangeKeyUnSets) })...)
+	fmt.Fprintf(tw, "  range-key-deletes\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		propArgs(all, func(p *props) interface{} { return humanize.Count.Uint64(p.NumRangeKeyDeletes) })...)
+	fmt.Fprintf(tw, "  merge\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		propArgs(all, func(p *props) interface{} { return humanize.Count.Uint64(p.NumMergeOperands) })...)
+	fmt.Fprintf(tw, "  pinned\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		propArgs(all, func(p *props) interface{} { return humanize.Count.Uint64(p.SnapshotPinnedKeys) })...)
+
+	return tw.Flush()
+}
+
+// propsJSON is the JSON encoding of the properties of a level.
+type propsJSON struct {
+	props
+	CompressionRatio float64
+}
+
+// rangePropsJSON is the JSON encoding of the properties of the tables
+// overlapping a key range.
+type rangePropsJSON struct {
+	Start  string
+	End    string
+	Levels []propsJSON
+}
+
+// propsOutputJSON is the JSON output of the properties command. The last
+// element of each Levels slice holds the total across levels.
+type propsOutputJSON struct {
+	Levels []propsJSON
+	Ranges []rangePropsJSON `json:",omitempty"`
+}
+
+func makePropsJSON(all []props) []propsJSON {
+	out := make([]propsJSON, len(all))
+	for i := range all {
+		out[i] = propsJSON{props: all[i], CompressionRatio: all[i].compressionRatio()}
+	}
+	return out
+}
+
 func (d *dbT) runSet(cmd *cobra.Command, args []string) {
 	stderr := cmd.ErrOrStderr()
 	db, err := d.openDB(args[0], nonReadOnly{})
@@ -701,6 +1559,7 @@ type props struct {
 	SnapshotPinnedKeySize      uint64
 	SnapshotPinnedValueSize    uint64
 	TopLevelIndexSize          uint64
+	ValueBlocksSize            uint64
 }
 
 func (p *props) update(o props) {
@@ -732,22 +1591,32 @@ func (p *props) update(o props) {
 	p.SnapshotPinnedValueSize += o.SnapshotPinnedValueSize
 	p.SnapshotPinnedKeys += o.SnapshotPinnedKeys
 	p.TopLevelIndexSize += o.TopLevelIndexSize
+	p.ValueBlocksSize += o.ValueBlocksSize
 }
 
-func (d *dbT) addProps(
-	objProvider objstorage.Provider, m manifest.PhysicalFileMeta, p *props,
-) error {
+// compressionRatio returns the ratio of the raw size of the keys and values to
+// the size of the data blocks holding them.
+func (p *props) compressionRatio() float64 {
+	if p.DataSize == 0 {
+		return 0
+	}
+	return float64(p.RawKeySize+p.RawValueSize) / float64(p.DataSize)
+}
+
+func (d *dbT) loadProps(
+	objProvider objstorage.Provider, m manifest.PhysicalFileMeta,
+) (props, error) {
 	ctx := context.Background()
 	f, err := objProvider.OpenForReading(ctx, base.FileTypeTable, m.FileBacking.DiskFileNum, objstorage.OpenOptions{})
 	if err != nil {
-		return err
+		return props{}, err
 	}
 	r, err := sstable.NewReader(f, sstable.ReaderOptions{}, d.mergers, d.comparers)
 	if err != nil {
 		_ = f.Close()
-		return err
+		return props{}, err
 	}
-	p.update(props{
+	p := props{
 		Count:                      1,
 		SmallestSeqNum:             m.SmallestSeqNum,
 		LargestSeqNum:              m.LargestSeqNum,
@@ -772,8 +1641,63 @@ func (d *dbT) addProps(
 		SnapshotPinnedValueSize:    r.Properties.SnapshotPinnedValueSize,
 		SnapshotPinnedKeys:         r.Properties.SnapshotPinnedKeys,
 		TopLevelIndexSize:          r.Properties.TopLevelIndexSize,
-	})
-	return r.Close()
+		ValueBlocksSize:            r.Properties.ValueBlocksSize,
+	}
+	return p, r.Close()
+}
+
+// loadVersion replays the MANIFEST of the DB in dirname, returning the current
+// version and the comparer of the DB.
+func (d *dbT) loadVersion(dirname string) (*manifest.Version, *base.Comparer, error) {
+	desc, err := pebble.Peek(dirname, d.opts.FS)
+	if err != nil {
+		return nil, nil, err
+	} else if !desc.Exists {
+		return nil, nil, oserror.ErrNotExist
+	}
+	manifestFilename := d.opts.FS.PathBase(desc.ManifestFilename)
+
+	// Replay the manifest to get the current version.
+	f, err := d.opts.FS.Open(desc.ManifestFilename)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "pebble: could not open MANIFEST file %q", manifestFilename)
+	}
+	defer f.Close()
+
+	cmp := base.DefaultComparer
+	var bve manifest.BulkVersionEdit
+	bve.AddedByFileNum = make(map[base.FileNum]*manifest.FileMetadata)
+	rr := record.NewReader(f, 0 /* logNum */)
+	for {
+		r, err := rr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "pebble: reading manifest %q", manifestFilename)
+		}
+		var ve manifest.VersionEdit
+		err = ve.Decode(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := bve.Accumulate(&ve); err != nil {
+			return nil, nil, err
+		}
+		if ve.ComparerName != "" {
+			cmp = d.comparers[ve.ComparerName]
+			d.fmtKey.setForComparer(ve.ComparerName, d.comparers)
+			d.fmtValue.setForComparer(ve.ComparerName, d.comparers)
+		}
+	}
+	v, err := bve.Apply(
+		nil /* version */, cmp, d.opts.FlushSplitBytes,
+		d.opts.Experimental.ReadCompactionRate,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	return v, cmp, nil
 }
 
 func makePlural(singular string, count int64) string {
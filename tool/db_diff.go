@@ -0,0 +1,225 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package tool
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// dbDiffer reports the differences between the contents of two DBs, read
+// through iterators over a snapshot of each DB.
+type dbDiffer struct {
+	stdout   io.Writer
+	cmp      base.Compare
+	fmtKey   keyFormatter
+	fmtValue valueFormatter
+	names    [2]string
+	// limit is the maximum number of differences reported, or 0 if unlimited.
+	limit int64
+
+	diffs     int64
+	truncated bool
+	// only is the run of consecutive keys, not yet reported, present only in
+	// the DB of index side.
+	only struct {
+		side        int
+		first, last []byte
+		count       int64
+	}
+}
+
+func (dd *dbDiffer) done() bool {
+	return dd.limit > 0 && dd.diffs >= dd.limit
+}
+
+func (dd *dbDiffer) report(format string, args ...interface{}) {
+	if dd.done() {
+		dd.truncated = true
+		return
+	}
+	dd.diffs++
+	fmt.Fprintf(dd.stdout, format+"\n", args...)
+}
+
+// addOnly adds key, present only in the DB of index side, to the current run
+// of such keys.
+func (dd *dbDiffer) addOnly(side int, key []byte) {
+	if dd.only.count > 0 && dd.only.side != side {
+		dd.flushOnly()
+	}
+	if dd.only.count == 0 {
+		dd.only.side = side
+		dd.only.first = append(dd.only.first[:0], key...)
+	}
+	dd.only.last = append(dd.only.last[:0], key...)
+	dd.only.count++
+}
+
+// flushOnly reports the current run of keys present only in one of the DBs as
+// a single difference.
+func (dd *dbDiffer) flushOnly() {
+	switch n := dd.only.count; {
+	case n == 1:
+		dd.report("only in %s: %s", dd.names[dd.only.side], dd.fmtKey.fn(dd.only.first))
+	case n > 1:
+		dd.report("only in %s: [%s, %s] (%d keys)", dd.names[dd.only.side],
+			dd.fmtKey.fn(dd.only.first), dd.fmtKey.fn(dd.only.last), n)
+	}
+	dd.only.count = 0
+}
+
+// diffPoints reports the point keys present in only one of the DBs, coalescing
+// consecutive keys into key ranges, and the keys whose values differ.
+func (dd *dbDiffer) diffPoints(iters [2]*pebble.Iterator) error {
+	valid := [2]bool{iters[0].First(), iters[1].First()}
+	for (valid[0] || valid[1]) && !dd.done() {
+		var c int
+		switch {
+		case !valid[1]:
+			c = -1
+		case !valid[0]:
+			c = +1
+		default:
+			c = dd.cmp(iters[0].Key(), iters[1].Key())
+		}
+		if c != 0 {
+			side := 0
+			if c > 0 {
+				side = 1
+			}
+			dd.addOnly(side, iters[side].Key())
+			valid[side] = iters[side].Next()
+			continue
+		}
+		var values [2][]byte
+		for i, iter := range iters {
+			var err error
+			if values[i], err = iter.ValueAndErr(); err != nil {
+				return err
+			}
+		}
+		if !bytes.Equal(values[0], values[1]) {
+			dd.flushOnly()
+			key := iters[0].Key()
+			dd.report("value of %s differs: %s in %s, %s in %s", dd.fmtKey.fn(key),
+				dd.fmtValue.fn(key, values[0]), dd.names[0], dd.fmtValue.fn(key, values[1]), dd.names[1])
+		}
+		valid[0], valid[1] = iters[0].Next(), iters[1].Next()
+	}
+	dd.flushOnly()
+	return errors.CombineErrors(iters[0].Error(), iters[1].Error())
+}
+
+// diffSpan is a copy of the range key span at which an iterator is
+// positioned.
+type diffSpan struct {
+	valid      bool
+	start, end []byte
+	keys       []pebble.RangeKeyData
+}
+
+func (s *diffSpan) load(iter *pebble.Iterator, valid bool) {
+	s.valid = valid
+	if !valid {
+		return
+	}
+	start, end := iter.RangeBounds()
+	s.start = append(s.start[:0], start...)
+	s.end = append(s.end[:0], end...)
+	s.keys = s.keys[:0]
+	for _, k := range iter.RangeKeys() {
+		s.keys = append(s.keys, pebble.RangeKeyData{
+			Suffix: slices.Clone(k.Suffix),
+			Value:  slices.Clone(k.Value),
+		})
+	}
+}
+
+// diffRangeKeys reports the key ranges over which the range keys of the DBs
+// differ. The range key spans of both DBs are fragmented at the bounds of the
+// spans of either DB, and each fragment over which the DBs hold different
+// range keys is reported.
+func (dd *dbDiffer) diffRangeKeys(iters [2]*pebble.Iterator) error {
+	var spans [2]diffSpan
+	for i, iter := range iters {
+		spans[i].load(iter, iter.First())
+	}
+	var pos []byte
+	for (spans[0].valid || spans[1].valid) && !dd.done() {
+		var covering [2]bool
+		for i := range spans {
+			covering[i] = spans[i].valid && pos != nil && dd.cmp(spans[i].start, pos) <= 0
+		}
+		if !covering[0] && !covering[1] {
+			// Skip to the start of the next span.
+			pos = nil
+			for i := range spans {
+				if spans[i].valid && (pos == nil || dd.cmp(spans[i].start, pos) < 0) {
+					pos = spans[i].start
+				}
+			}
+			pos = slices.Clone(pos)
+			continue
+		}
+		// The fragment ends at the first bound of either DB's spans past pos.
+		var end []byte
+		var keys [2][]pebble.RangeKeyData
+		for i := range spans {
+			if !spans[i].valid {
+				continue
+			}
+			bound := spans[i].start
+			if covering[i] {
+				bound = spans[i].end
+				keys[i] = spans[i].keys
+			}
+			if end == nil || dd.cmp(bound, end) < 0 {
+				end = bound
+			}
+		}
+		if !rangeKeysEqual(keys[0], keys[1]) {
+			dd.report("range keys of [%s, %s) differ: %s in %s, %s in %s",
+				dd.fmtKey.fn(pos), dd.fmtKey.fn(end), dd.formatRangeKeys(pos, keys[0]), dd.names[0],
+				dd.formatRangeKeys(pos, keys[1]), dd.names[1])
+		}
+		pos = slices.Clone(end)
+		for i, iter := range iters {
+			if spans[i].valid && dd.cmp(spans[i].end, pos) <= 0 {
+				spans[i].load(iter, iter.Next())
+			}
+		}
+	}
+	return errors.CombineErrors(iters[0].Error(), iters[1].Error())
+}
+
+func rangeKeysEqual(a, b []pebble.RangeKeyData) bool {
+	return slices.EqualFunc(a, b, func(a, b pebble.RangeKeyData) bool {
+		return bytes.Equal(a.Suffix, b.Suffix) && bytes.Equal(a.Value, b.Value)
+	})
+}
+
+func (dd *dbDiffer) formatRangeKeys(start []byte, keys []pebble.RangeKeyData) string {
+	var buf strings.Builder
+	buf.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		if len(k.Suffix) > 0 {
+			fmt.Fprintf(&buf, "%s ", k.Suffix)
+		}
+		fmt.Fprintf(&buf, "%s", dd.fmtValue.fn(start, k.Value))
+	}
+	buf.WriteByte('}')
+	return buf.String()
+}
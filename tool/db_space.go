@@ -0,0 +1,276 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package tool
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/humanize"
+	"github.com/cockroachdb/pebble/internal/manifest"
+	"github.com/cockroachdb/pebble/objstorage"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/sstable"
+)
+
+// prefixSpace is the space attributed to a key prefix by "db space".
+type prefixSpace struct {
+	// tables is the number of tables holding keys of the prefix.
+	tables int
+	// size is the estimated size on disk of the keys of the prefix, including
+	// their share of the metadata of the tables.
+	size float64
+	// uncompressed is the estimated size of the keys and values of the prefix
+	// before compression.
+	uncompressed float64
+	// tombstones is the estimated size on disk of the point tombstones of the
+	// prefix, which are garbage to be reclaimed by compactions.
+	tombstones float64
+}
+
+func (s *prefixSpace) add(o prefixSpace) {
+	s.tables += o.tables
+	s.size += o.size
+	s.uncompressed += o.uncompressed
+	s.tombstones += o.tombstones
+}
+
+// spacePrefixer determines the prefixes of keys for "db space".
+type spacePrefixer struct {
+	delimiter []byte
+	prefixes  [][]byte
+}
+
+// prefix returns the prefix of a key: the key up to and including the first
+// occurrence of the delimiter, or the longest of the prefixes the key has. It
+// returns false if the key has no prefix.
+func (p *spacePrefixer) prefix(key []byte) (string, bool) {
+	if len(p.delimiter) > 0 {
+		if i := bytes.Index(key, p.delimiter); i >= 0 {
+			return string(key[:i+len(p.delimiter)]), true
+		}
+		return "", false
+	}
+	var longest []byte
+	for _, prefix := range p.prefixes {
+		if len(prefix) >= len(longest) && bytes.HasPrefix(key, prefix) {
+			longest = prefix
+		}
+	}
+	return string(longest), longest != nil
+}
+
+// keyPrefix returns the prefix of a key of a table. A key without a prefix is
+// its own prefix if the prefixes are determined by a delimiter, and has the
+// empty prefix otherwise.
+func (p *spacePrefixer) keyPrefix(key []byte) string {
+	if prefix, ok := p.prefix(key); ok {
+		return prefix
+	}
+	if len(p.delimiter) > 0 {
+		return string(key)
+	}
+	return ""
+}
+
+// blockPrefixes returns the prefixes of the bounds of a data block, whose keys
+// are within [lower, upper]. A bound that's a separator of the index, rather
+// than a key, may not be a key of the prefix of the keys next to it (e.g. the
+// separator of "a/x" and "c/y" may be "b"): if it has no prefix, the prefix of
+// the other bound is used.
+func (p *spacePrefixer) blockPrefixes(
+	lower []byte, lowerIsKey bool, upper []byte, upperIsKey bool,
+) (string, string) {
+	lowerPrefix, lowerOK := p.prefix(lower)
+	upperPrefix, upperOK := p.prefix(upper)
+	if lowerIsKey && !lowerOK {
+		lowerPrefix, lowerOK = p.keyPrefix(lower), true
+	}
+	if upperIsKey && !upperOK {
+		upperPrefix, upperOK = p.keyPrefix(upper), true
+	}
+	switch {
+	case !lowerOK && !upperOK:
+		return "", ""
+	case !lowerOK:
+		return upperPrefix, upperPrefix
+	case !upperOK:
+		return lowerPrefix, lowerPrefix
+	}
+	return lowerPrefix, upperPrefix
+}
+
+// runSpaceByPrefix prints the estimated space used by each key prefix, by
+// walking the bounds of the tables and the index entries of their data blocks.
+// The data blocks aren't read: a data block holding keys of several prefixes
+// is attributed in equal parts to the prefixes of its first and last keys.
+func (d *dbT) runSpaceByPrefix(stdout io.Writer, dirname string) error {
+	p := &spacePrefixer{delimiter: d.spaceDelim}
+	for _, prefix := range d.spacePrefixes {
+		p.prefixes = append(p.prefixes, prefix)
+	}
+
+	v, cmp, err := d.loadVersion(dirname)
+	if err != nil {
+		return err
+	}
+	objProvider, err := objstorageprovider.Open(objstorageprovider.DefaultSettings(d.opts.FS, dirname))
+	if err != nil {
+		return err
+	}
+	defer objProvider.Close()
+
+	spaces := make(map[string]*prefixSpace)
+	var tables int
+	for l := range v.Levels {
+		iter := v.Levels[l].Iter()
+		for t := iter.First(); t != nil; t = iter.Next() {
+			tables++
+			tableSpaces, err := d.tableSpaceByPrefix(objProvider, cmp, p, t)
+			if err != nil {
+				return err
+			}
+			for prefix, s := range tableSpaces {
+				if spaces[prefix] == nil {
+					spaces[prefix] = &prefixSpace{}
+				}
+				spaces[prefix].add(*s)
+			}
+		}
+	}
+
+	prefixes := make([]string, 0, len(spaces))
+	var total prefixSpace
+	for prefix, s := range spaces {
+		prefixes = append(prefixes, prefix)
+		total.add(*s)
+	}
+	total.tables = tables
+	sort.Slice(prefixes, func(i, j int) bool {
+		if a, b := spaces[prefixes[i]].size, spaces[prefixes[j]].size; a != b {
+			return a > b
+		}
+		return prefixes[i] < prefixes[j]
+	})
+
+	tw := tabwriter.NewWriter(stdout, 2, 1, 2, ' ', 0)
+	fmt.Fprintln(tw, "prefix\ttables\tsize\t%\tuncompressed\ttombstones")
+	row := func(name string, s prefixSpace) {
+		var pct float64
+		if total.size > 0 {
+			pct = 100 * s.size / total.size
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%.1f\t%s\t%s\n", name, s.tables,
+			humanize.Bytes.Uint64(uint64(s.size)), pct,
+			humanize.Bytes.Uint64(uint64(s.uncompressed)),
+			humanize.Bytes.Uint64(uint64(s.tombstones)))
+	}
+	for _, prefix := range prefixes {
+		name := fmt.Sprint(d.fmtKey.fn([]byte(prefix)))
+		if prefix == "" {
+			name = "<other>"
+		}
+		row(name, *spaces[prefix])
+	}
+	row("total", total)
+	return tw.Flush()
+}
+
+// tableSpaceByPrefix returns the space used by each key prefix in a table.
+func (d *dbT) tableSpaceByPrefix(
+	objProvider objstorage.Provider, cmp *base.Comparer, p *spacePrefixer, t *manifest.FileMetadata,
+) (map[string]*prefixSpace, error) {
+	ctx := context.Background()
+	f, err := objProvider.OpenForReading(ctx, base.FileTypeTable, t.FileBacking.DiskFileNum, objstorage.OpenOptions{})
+	if err != nil {
+		return nil, err
+	}
+	r, err := sstable.NewReader(f, sstable.ReaderOptions{}, d.mergers, d.comparers)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	defer r.Close()
+
+	// The blocks are attributed the shares of the size of the table and of the
+	// raw size of its keys and values proportional to their size, and the share
+	// of their size holding point tombstones is estimated from the raw size of
+	// the point tombstones of the table.
+	props := &r.Properties
+	raw := float64(props.RawKeySize + props.RawValueSize)
+	var tombstoneRatio float64
+	if raw > 0 {
+		tombstoneRatio = float64(props.RawPointTombstoneKeySize+props.RawPointTombstoneValueSize) / raw
+	}
+	spaces := make(map[string]*prefixSpace)
+	attribute := func(prefix string, size, uncompressed float64) {
+		s := spaces[prefix]
+		if s == nil {
+			s = &prefixSpace{tables: 1}
+			spaces[prefix] = s
+		}
+		s.size += size
+		s.uncompressed += uncompressed
+		s.tombstones += size * tombstoneRatio
+	}
+	attributeBlock := func(lowerPrefix, upperPrefix string, size, uncompressed float64) {
+		if lowerPrefix == upperPrefix {
+			attribute(lowerPrefix, size, uncompressed)
+			return
+		}
+		attribute(lowerPrefix, size/2, uncompressed/2)
+		attribute(upperPrefix, size/2, uncompressed/2)
+	}
+
+	smallest, largest := t.Smallest.UserKey, t.Largest.UserKey
+	type blockSpan struct {
+		lowerPrefix, upperPrefix string
+		length                   uint64
+	}
+	var blocks []blockSpan
+	var dataLength uint64
+	lower, lowerIsKey := smallest, true
+	// Only the blocks overlapping the bounds of the table are considered, which
+	// excludes the blocks outside the bounds of a virtual table.
+	var done bool
+	err = r.ForEachDataBlock(func(separator []byte, bh sstable.BlockHandle) error {
+		if done || cmp.Compare(separator, smallest) < 0 {
+			return nil
+		}
+		upper, upperIsKey := separator, false
+		if cmp.Compare(separator, largest) >= 0 {
+			upper, upperIsKey, done = largest, true, true
+		}
+		lowerPrefix, upperPrefix := p.blockPrefixes(lower, lowerIsKey, upper, upperIsKey)
+		blocks = append(blocks, blockSpan{lowerPrefix: lowerPrefix, upperPrefix: upperPrefix, length: bh.Length})
+		dataLength += bh.Length
+		lower, lowerIsKey = append(lower[:0:0], separator...), false
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// A virtual table is attributed its share of the raw size of the keys and
+	// values of its backing table.
+	size := float64(t.Size)
+	raw *= size / float64(max(t.FileBacking.Size, 1))
+	if dataLength == 0 {
+		// The table holds no point keys within its bounds.
+		lowerPrefix, upperPrefix := p.blockPrefixes(smallest, true, largest, true)
+		attributeBlock(lowerPrefix, upperPrefix, size, raw)
+		return spaces, nil
+	}
+	for _, b := range blocks {
+		share := float64(b.length) / float64(dataLength)
+		attributeBlock(b.lowerPrefix, b.upperPrefix, share*size, share*raw)
+	}
+	return spaces, nil
+}
@@ -4,8 +4,305 @@
 
 package tool
 
-import "testing"
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
 
 func TestDB(t *testing.T) {
 	runTests(t, "testdata/db_*")
 }
+
+func TestDBIterators(t *testing.T) {
+	iters := []pebble.IteratorInfo{
+		{Created: time.Unix(10, 0), Compactions: 5, Stack: "goroutine 1 [running]:\nfoo()\n"},
+		{Created: time.Unix(20, 0), Compactions: 0, Stack: "goroutine 2 [running]:\nbar()\n"},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewEncoder(w).Encode(iters))
+	}))
+	defer server.Close()
+
+	run := func(args ...string) string {
+		var buf bytes.Buffer
+		c := &cobra.Command{}
+		c.AddCommand(New().Commands...)
+		c.SetArgs(append([]string{"db", "iterators", server.URL}, args...))
+		c.SetOut(&buf)
+		c.SetErr(&buf)
+		require.NoError(t, c.Execute())
+		return buf.String()
+	}
+	require.Equal(t, `iterator created 1970-01-01T00:00:10Z, open across 5 compactions
+  goroutine 1 [running]:
+  foo()
+iterator created 1970-01-01T00:00:20Z, open across 0 compactions
+  goroutine 2 [running]:
+  bar()
+2 open iterators
+`, run())
+	require.Equal(t, `iterator created 1970-01-01T00:00:10Z, open across 5 compactions
+  goroutine 1 [running]:
+  foo()
+1 open iterator
+`, run("--min-compactions=1"))
+
+	// The request fails if the database doesn't respond within the timeout.
+	unblock := make(chan struct{})
+	slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}))
+	defer slowServer.Close()
+	defer close(unblock)
+	var buf bytes.Buffer
+	c := &cobra.Command{}
+	c.AddCommand(New().Commands...)
+	c.SetArgs([]string{"db", "iterators", slowServer.URL, "--timeout=10ms"})
+	c.SetOut(&buf)
+	c.SetErr(&buf)
+	require.NoError(t, c.Execute())
+	require.Contains(t, buf.String(), "Client.Timeout exceeded")
+}
+
+func TestDBHotKeys(t *testing.T) {
+	hk := pebble.HotKeys{
+		Sampled: 100,
+		Keys: []pebble.HotKey{
+			{Key: []byte("apple"), Count: 640},
+			{Key: []byte("banana"), Count: 64},
+		},
+		Ranges: []pebble.HotKeyRange{
+			{Start: []byte("app"), End: []byte("apq"), Count: 1280},
+			{Start: []byte("\xff"), Count: 64},
+		},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewEncoder(w).Encode(hk))
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	c := &cobra.Command{}
+	c.AddCommand(New().Commands...)
+	c.SetArgs([]string{"db", "hot-keys", server.URL})
+	c.SetOut(&buf)
+	c.SetErr(&buf)
+	require.NoError(t, c.Execute())
+	require.Equal(t, `100 sampled keys
+key     count
+apple   640
+banana  64
+
+key range    count
+[app, apq)   1280
+[\xff, max)  64
+`, buf.String())
+}
+
+func TestDBExcise(t *testing.T) {
+	mem := vfs.NewMem()
+	opts := &pebble.Options{FS: mem, FormatMajorVersion: pebble.FormatNewest}
+	d, err := pebble.Open("db", opts)
+	require.NoError(t, err)
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		require.NoError(t, d.Set([]byte(k), []byte(k), nil))
+	}
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("c2"), []byte("c2"), nil))
+	require.NoError(t, d.Close())
+
+	run := func(args ...string) string {
+		var buf bytes.Buffer
+		c := &cobra.Command{}
+		c.AddCommand(New(FS(mem)).Commands...)
+		c.SetArgs(append([]string{"db"}, args...))
+		c.SetOut(&buf)
+		c.SetErr(&buf)
+		require.NoError(t, c.Execute())
+		return buf.String()
+	}
+	// The flushed table straddling the range is replaced by two virtual tables,
+	// and the table holding c2 is removed.
+	require.Equal(t, `L0: removed 000005
+L0: removed 000006
+L0: created 000011 (virtual, backed by 000005) [a#10,SET-a#10,SET]
+L0: created 000012 (virtual, backed by 000005) [d#13,SET-e#14,SET]
+`, run("excise", "db", "b", "d"))
+	require.Contains(t, run("scan", "db"), "a [61]\nd [64]\ne [65]\nscanned 3 records")
+	require.Equal(t, "pebble: invalid excise span [\"d\", \"b\")\n", run("excise", "db", "d", "b"))
+}
+
+func TestDBDiff(t *testing.T) {
+	mem := vfs.NewMem()
+	opts := &pebble.Options{FS: mem, FormatMajorVersion: pebble.FormatNewest}
+	d, err := pebble.Open("db", opts)
+	require.NoError(t, err)
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		require.NoError(t, d.Set([]byte(k), []byte(k), nil))
+	}
+	require.NoError(t, d.RangeKeySet([]byte("a"), []byte("e"), []byte("@1"), []byte("v1"), nil))
+	require.NoError(t, d.Checkpoint("checkpoint"))
+	// Delete a run of keys, overwrite a value and change the range keys over
+	// [c, d).
+	require.NoError(t, d.Delete([]byte("b"), nil))
+	require.NoError(t, d.Delete([]byte("c"), nil))
+	require.NoError(t, d.Set([]byte("d"), []byte("d2"), nil))
+	require.NoError(t, d.RangeKeySet([]byte("c"), []byte("d"), []byte("@2"), []byte("v2"), nil))
+	require.NoError(t, d.Set([]byte("f"), []byte("f"), nil))
+	require.NoError(t, d.Close())
+
+	run := func(args ...string) string {
+		var buf bytes.Buffer
+		c := &cobra.Command{}
+		c.AddCommand(New(FS(mem)).Commands...)
+		c.SetArgs(append([]string{"db", "diff"}, args...))
+		c.SetOut(&buf)
+		c.SetErr(&buf)
+		require.NoError(t, c.Execute())
+		return buf.String()
+	}
+	require.Equal(t, `only in checkpoint: [b, c] (2 keys)
+value of d differs: d in checkpoint, d2 in db
+only in db: f
+range keys of [c, d) differ: {@1 v1} in checkpoint, {@1 v1, @2 v2} in db
+4 differences
+`, run("checkpoint", "db", "--value=%s"))
+}
+
+func TestDBEvents(t *testing.T) {
+	mem := vfs.NewMem()
+	opts := &pebble.Options{FS: mem}
+	opts.EventLog.Enabled = true
+	d, err := pebble.Open("db", opts)
+	require.NoError(t, err)
+	for _, k := range []string{"a", "b"} {
+		require.NoError(t, d.Set([]byte(k), []byte(k), nil))
+		require.NoError(t, d.Flush())
+	}
+	require.NoError(t, d.Compact([]byte("a"), []byte("c"), false /* parallelize */))
+	require.NoError(t, d.Close())
+
+	run := func(args ...string) []string {
+		var buf bytes.Buffer
+		c := &cobra.Command{}
+		c.AddCommand(New(FS(mem)).Commands...)
+		c.SetArgs(append([]string{"db", "events", "db"}, args...))
+		c.SetOut(&buf)
+		c.SetErr(&buf)
+		require.NoError(t, c.Execute())
+		return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	}
+	lines := run()
+	require.Len(t, lines, 3)
+	require.Contains(t, lines[0], " flush [JOB ")
+	require.Contains(t, lines[1], " flush [JOB ")
+	require.Contains(t, lines[2], " compaction [JOB ")
+
+	lines = run("--type", "compaction")
+	require.Len(t, lines, 1)
+	require.Contains(t, lines[0], "compacted(default) L0 [000005 000007]")
+
+	lines = run("--type", "flush", "-v")
+	require.Len(t, lines, 2)
+	require.Contains(t, lines[0], `"type":"flush"`)
+
+	lines = run("--until", "2000-01-01T00:00:00Z")
+	require.Equal(t, []string{""}, lines)
+	lines = run("--since", "yesterday")
+	require.Equal(t, []string{`parsing time "yesterday" as "2006-01-02T15:04:05Z07:00": cannot parse "yesterday" as "2006"`}, lines)
+}
+
+func TestDBExport(t *testing.T) {
+	mem := vfs.NewMem()
+	d, err := pebble.Open("db", &pebble.Options{FS: mem})
+	require.NoError(t, err)
+	for _, k := range []string{"a", "b", "c"} {
+		require.NoError(t, d.Set([]byte(k), []byte("v"+k), nil))
+	}
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Delete([]byte("b"), nil))
+	require.NoError(t, d.Close())
+
+	run := func(args ...string) string {
+		var buf bytes.Buffer
+		c := &cobra.Command{}
+		c.AddCommand(New(FS(mem)).Commands...)
+		c.SetArgs(append([]string{"db", "export", "db"}, args...))
+		c.SetOut(&buf)
+		c.SetErr(&buf)
+		require.NoError(t, c.Execute())
+		return buf.String()
+	}
+	require.Equal(t, "key,value\na,va\nc,vc\n", run())
+	require.Equal(t, "key,value\nc,76 63\n", run("--start", "b", "--value", "% x"))
+
+	require.Empty(t, run("--format", "parquet", "-o", "export.parquet"))
+	f, err := mem.Open("export.parquet")
+	require.NoError(t, err)
+	data, err := io.ReadAll(f)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	columns, rows := readParquet(t, data)
+	require.Equal(t, []string{"key", "value"}, columns)
+	require.Equal(t, [][]any{{"a", "va"}, {"c", "vc"}}, rows)
+}
+
+func TestDBSpace(t *testing.T) {
+	mem := vfs.NewMem()
+	opts := &pebble.Options{FS: mem, FormatMajorVersion: pebble.FormatNewest}
+	opts.Levels = []pebble.LevelOptions{{BlockSize: 512}}
+	d, err := pebble.Open("db", opts)
+	require.NoError(t, err)
+	value := bytes.Repeat([]byte("v"), 100)
+	for i := 0; i < 200; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("t1/%04d", i)), value, nil))
+	}
+	for i := 0; i < 20; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("t2/%04d", i)), value, nil))
+	}
+	for i := 0; i < 50; i++ {
+		require.NoError(t, d.Delete([]byte(fmt.Sprintf("t3/%04d", i)), nil))
+	}
+	require.NoError(t, d.Set([]byte("u"), value, nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Close())
+
+	run := func(args ...string) string {
+		var buf bytes.Buffer
+		c := &cobra.Command{}
+		c.AddCommand(New(FS(mem)).Commands...)
+		c.SetArgs(append([]string{"db", "space", "db"}, args...))
+		c.SetOut(&buf)
+		c.SetErr(&buf)
+		require.NoError(t, c.Execute())
+		return buf.String()
+	}
+	// The point tombstones are estimated from their proportion in the table.
+	require.Equal(t, `prefix  tables  size   %      uncompressed  tombstones
+t1/     1       5.1KB  82.1   21KB          70B
+t3/     1       578B   9.0    2.3KB         7B
+t2/     1       492B   7.7    2.0KB         6B
+u       1       74B    1.2    305B          1B
+total   1       6.3KB  100.0  26KB          85B
+`, run("--delimiter=/"))
+	require.Equal(t, `prefix   tables  size   %      uncompressed  tombstones
+t1/      1       5.1KB  82.1   21KB          70B
+<other>  1       583B   9.1    2.3KB         7B
+t2/      1       562B   8.8    2.2KB         7B
+total    1       6.3KB  100.0  26KB          85B
+`, run("--prefix=t1/", "--prefix=t2/"))
+	require.Equal(t, "--delimiter and --prefix are mutually exclusive\n",
+		run("--delimiter=/", "--prefix=t1/"))
+}
@@ -0,0 +1,54 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package tool
+
+import (
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/cockroachdb/pebble/vfs/encryptedfs"
+	"github.com/spf13/cobra"
+)
+
+// encryption decrypts the files read by the commands of stores encrypted with
+// encryptedfs, given a key file holding the store keys through the
+// --encryption-key-file flag. See encryptedfs.ReadKeyFile for the format of
+// key files.
+type encryption struct {
+	opts *pebble.Options
+	// fs is the filesystem the tool was configured with, which the encrypted
+	// filesystem wraps.
+	fs vfs.FS
+	// keyFile is the path of the key file specified by the
+	// --encryption-key-file flag.
+	keyFile string
+}
+
+// registerFlags registers the --encryption-key-file flag on the command and
+// its subcommands, which run with the filesystem decrypting files if the flag
+// is specified.
+func (e *encryption) registerFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(
+		&e.keyFile, "encryption-key-file", "", "key file holding the store keys of an encrypted store")
+	cmd.PersistentPreRunE = func(*cobra.Command, []string) error {
+		return e.configure()
+	}
+}
+
+func (e *encryption) configure() error {
+	e.opts.FS = e.fs
+	if e.keyFile == "" {
+		return nil
+	}
+	keys, err := encryptedfs.ReadKeyFile(e.fs, e.keyFile)
+	if err != nil {
+		return err
+	}
+	fs, err := encryptedfs.New(e.fs, keys...)
+	if err != nil {
+		return err
+	}
+	e.opts.FS = fs
+	return nil
+}
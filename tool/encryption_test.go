@@ -0,0 +1,52 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package tool
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/cockroachdb/pebble/vfs/encryptedfs"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptionKeyFile(t *testing.T) {
+	mem := vfs.NewMem()
+	key := bytes.Repeat([]byte{7}, 32)
+	f, err := mem.Create("keys")
+	require.NoError(t, err)
+	_, err = fmt.Fprintf(f, "%x\n", key)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	fs, err := encryptedfs.New(mem, key)
+	require.NoError(t, err)
+	d, err := pebble.Open("db", &pebble.Options{FS: fs})
+	require.NoError(t, err)
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("b"), []byte("2"), nil))
+	require.NoError(t, d.Close())
+
+	tool := New(FS(mem))
+	run := func(args ...string) string {
+		var buf bytes.Buffer
+		c := &cobra.Command{}
+		c.AddCommand(tool.Commands...)
+		c.SetArgs(args)
+		c.SetOut(&buf)
+		c.SetErr(&buf)
+		_ = c.Execute()
+		return buf.String()
+	}
+	out := run("db", "scan", "--encryption-key-file=keys", "db")
+	require.Contains(t, out, "a [31]\nb [32]\nscanned 2 records")
+	// Without the key file, the store can't be read.
+	require.Contains(t, run("db", "scan", "--encryption-key-file=", "db"), "error loading options")
+}
@@ -0,0 +1,142 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package tool
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// exportFormat is the format of the file written by the export commands. It
+// implements pflag.Value.
+type exportFormat string
+
+func (f *exportFormat) String() string {
+	return string(*f)
+}
+
+func (f *exportFormat) Type() string {
+	return "exportFormat"
+}
+
+func (f *exportFormat) Set(spec string) error {
+	switch spec {
+	case "csv", "parquet":
+		*f = exportFormat(spec)
+		return nil
+	default:
+		return errors.Errorf("unknown export format %q (expected csv or parquet)", errors.Safe(spec))
+	}
+}
+
+type exportColumnKind int8
+
+const (
+	exportString exportColumnKind = iota
+	exportInt64
+)
+
+// exportColumn describes a column of the exported rows.
+type exportColumn struct {
+	name string
+	kind exportColumnKind
+}
+
+// exportValue is the value of a column of an exported row.
+type exportValue struct {
+	s string
+	i int64
+}
+
+// exportWriter writes the exported rows.
+type exportWriter interface {
+	WriteRow(values []exportValue) error
+	Close() error
+}
+
+// export writes the rows produced by fn to path (or to stdout if path is
+// empty), in the given format.
+func export(
+	fs vfs.FS,
+	path string,
+	stdout io.Writer,
+	format exportFormat,
+	columns []exportColumn,
+	fn func(w exportWriter) error,
+) (err error) {
+	out := stdout
+	if path != "" {
+		f, err := fs.Create(path)
+		if err != nil {
+			return err
+		}
+		defer func() { err = errors.CombineErrors(err, f.Close()) }()
+		out = f
+	}
+	bw := bufio.NewWriter(out)
+	var w exportWriter
+	if format == "parquet" {
+		w = newParquetWriter(bw, columns)
+	} else {
+		w = newCSVWriter(bw, columns)
+	}
+	if err := fn(w); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// csvWriter writes rows as CSV, with a header row holding the names of the
+// columns.
+type csvWriter struct {
+	w       *csv.Writer
+	columns []exportColumn
+	record  []string
+}
+
+func newCSVWriter(w io.Writer, columns []exportColumn) *csvWriter {
+	c := &csvWriter{
+		w:       csv.NewWriter(w),
+		columns: columns,
+		record:  make([]string, len(columns)),
+	}
+	for i := range columns {
+		c.record[i] = columns[i].name
+	}
+	_ = c.w.Write(c.record)
+	return c
+}
+
+// WriteRow implements exportWriter.
+func (c *csvWriter) WriteRow(values []exportValue) error {
+	for i, v := range values {
+		if c.columns[i].kind == exportInt64 {
+			c.record[i] = strconv.FormatInt(v.i, 10)
+		} else {
+			c.record[i] = v.s
+		}
+	}
+	return c.w.Write(c.record)
+}
+
+// Close implements exportWriter.
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// formatExported formats a key or value for export.
+func formatExported(f fmt.Formatter) string {
+	return fmt.Sprintf("%s", f)
+}
@@ -14,6 +14,7 @@ import (
 	"sort"
 
 	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/batchrepr"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/keyspan"
 	"github.com/cockroachdb/pebble/internal/manifest"
@@ -345,6 +346,7 @@ func (f *findT) searchLogs(stdout io.Writer, searchKey []byte, refs []findRef) [
 
 			var b pebble.Batch
 			var buf bytes.Buffer
+			var decompressed []byte
 			for {
 				r, off, err := rr.NextRecord()
 				if err == nil {
@@ -355,8 +357,18 @@ func (f *findT) searchLogs(stdout io.Writer, searchKey []byte, refs []findRef) [
 					return err
 				}
 
+				repr := buf.Bytes()
+				if batchrepr.IsCompressed(repr) {
+					decompressed, err = batchrepr.Decompress(decompressed[:0], repr)
+					if err != nil {
+						fmt.Fprintf(stdout, "%s: corrupt log file: %v", ll, err)
+						continue
+					}
+					repr = decompressed
+				}
+
 				b = pebble.Batch{}
-				if err := b.SetRepr(buf.Bytes()); err != nil {
+				if err := b.SetRepr(repr); err != nil {
 					fmt.Fprintf(stdout, "%s: corrupt log file: %v", ll, err)
 					continue
 				}
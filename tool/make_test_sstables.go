@@ -11,7 +11,6 @@ package main
 import (
 	"log"
 
-	"github.com/cockroachdb/pebble/internal/private"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
 	"github.com/cockroachdb/pebble/sstable"
 	"github.com/cockroachdb/pebble/vfs"
@@ -26,8 +25,8 @@ func makeOutOfOrder() {
 	opts := sstable.WriterOptions{
 		TableFormat: sstable.TableFormatPebblev1,
 	}
+	opts.Unsafe.DisableKeyOrderChecks = true
 	w := sstable.NewWriter(objstorageprovider.NewFileWritable(f), opts)
-	private.SSTableWriterDisableKeyOrderChecks(w)
 
 	set := func(key string) {
 		if err := w.Set([]byte(key), nil); err != nil {
@@ -9,8 +9,10 @@ import (
 	"fmt"
 	"io"
 	"slices"
+	"strings"
 	"time"
 
+	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/humanize"
@@ -27,6 +29,8 @@ type manifestT struct {
 	Dump      *cobra.Command
 	Summarize *cobra.Command
 	Check     *cobra.Command
+	Diff      *cobra.Command
+	Compact   *cobra.Command
 
 	opts      *pebble.Options
 	comparers sstable.Comparers
@@ -37,6 +41,9 @@ type manifestT struct {
 	filterEnd   key
 
 	summarizeDur time.Duration
+
+	diffFromEdit int
+	diffToEdit   int
 }
 
 func newManifest(opts *pebble.Options, comparers sstable.Comparers) *manifestT {
@@ -96,6 +103,49 @@ Check the contents of the MANIFEST files.
 	m.Check.Flags().Var(
 		&m.fmtKey, "key", "key formatter")
 
+	// Add diff command
+	m.Diff = &cobra.Command{
+		Use:   "diff <manifest-file> [<manifest-file>]",
+		Short: "diff the versions described by manifests",
+		Long: `
+Print the differences between two versions of the LSM: the tables added to and
+deleted from each level, the resulting change in each level's size, and the
+version edits responsible for the differences.
+
+The versions are described by the first N edits of a MANIFEST file, as numbered
+by "manifest dump". If two MANIFEST files are provided, the first version is
+read from the first file and the second version from the second file. If a
+single MANIFEST file is provided, both versions are read from it. By default
+all of a file's edits are read; use --from-edit and --to-edit to specify the
+index of the last edit to read for the first and second versions respectively.
+`,
+		Args: cobra.RangeArgs(1, 2),
+		Run:  m.runDiff,
+	}
+	m.Root.AddCommand(m.Diff)
+	m.Diff.Flags().Var(
+		&m.fmtKey, "key", "key formatter")
+	m.Diff.Flags().IntVar(
+		&m.diffFromEdit, "from-edit", -1, "index of the last edit of the first version (-1 for all edits)")
+	m.Diff.Flags().IntVar(
+		&m.diffToEdit, "to-edit", -1, "index of the last edit of the second version (-1 for all edits)")
+
+	// Add compact command
+	m.Compact = &cobra.Command{
+		Use:   "compact <dir>",
+		Short: "rewrite the current manifest into a single snapshot",
+		Long: `
+Rewrite the current MANIFEST of the database in <dir> into a new MANIFEST
+holding a single version edit, a snapshot of the current version, so that the
+edits accumulated by a bloated MANIFEST no longer have to be replayed when the
+database is opened. The database must not be in use. The previous MANIFEST is
+removed the next time the database is opened.
+`,
+		Args: cobra.ExactArgs(1),
+		Run:  m.runCompact,
+	}
+	m.Root.AddCommand(m.Compact)
+
 	return m
 }
 
@@ -579,3 +629,309 @@ func (m *manifestT) runCheck(cmd *cobra.Command, args []string) {
 		fmt.Fprintf(stdout, "OK\n")
 	}
 }
+
+// manifestLevelFile identifies a table within a level.
+type manifestLevelFile struct {
+	level   int
+	fileNum base.FileNum
+}
+
+// manifestHistory is the state of the LSM described by a prefix of the edits
+// of a MANIFEST, along with the edits that added and deleted each table.
+type manifestHistory struct {
+	name  string
+	edits []*manifest.VersionEdit
+	// files contains the tables in the version, keyed by level and file number.
+	files map[manifestLevelFile]*manifest.FileMetadata
+	// addedBy and deletedBy map tables to the index of the edit that added them
+	// to, or deleted them from, a level.
+	addedBy   map[manifestLevelFile]int
+	deletedBy map[manifestLevelFile]int
+}
+
+// readManifestHistory reads the edits [0, lastEdit] from the named MANIFEST,
+// or all of its edits if lastEdit is negative.
+func (m *manifestT) readManifestHistory(name string, lastEdit int) (*manifestHistory, error) {
+	f, err := m.opts.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := &manifestHistory{
+		name:      name,
+		files:     make(map[manifestLevelFile]*manifest.FileMetadata),
+		addedBy:   make(map[manifestLevelFile]int),
+		deletedBy: make(map[manifestLevelFile]int),
+	}
+	rr := record.NewReader(f, 0 /* logNum */)
+	for editIdx := 0; lastEdit < 0 || editIdx <= lastEdit; editIdx++ {
+		r, err := rr.Next()
+		if err == io.EOF {
+			if lastEdit >= 0 {
+				return nil, errors.Errorf("%s: edit %d not found; manifest contains %d edits",
+					name, lastEdit, editIdx)
+			}
+			break
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "%s: edit %d", name, editIdx)
+		}
+		ve := &manifest.VersionEdit{}
+		if err := ve.Decode(r); err != nil {
+			return nil, errors.Wrapf(err, "%s: edit %d", name, editIdx)
+		}
+		if ve.ComparerName != "" {
+			m.fmtKey.setForComparer(ve.ComparerName, m.comparers)
+		}
+		h.edits = append(h.edits, ve)
+		for df := range ve.DeletedFiles {
+			lf := manifestLevelFile{level: df.Level, fileNum: df.FileNum}
+			delete(h.files, lf)
+			h.deletedBy[lf] = editIdx
+		}
+		for _, nf := range ve.NewFiles {
+			lf := manifestLevelFile{level: nf.Level, fileNum: nf.Meta.FileNum}
+			h.files[lf] = nf.Meta
+			h.addedBy[lf] = editIdx
+		}
+	}
+	return h, nil
+}
+
+func (m *manifestT) runDiff(cmd *cobra.Command, args []string) {
+	stdout, stderr := cmd.OutOrStdout(), cmd.OutOrStderr()
+	fromName, toName := args[0], args[0]
+	if len(args) == 2 {
+		toName = args[1]
+	}
+	from, err := m.readManifestHistory(fromName, m.diffFromEdit)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	to, err := m.readManifestHistory(toName, m.diffToEdit)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	fmt.Fprintf(stdout, "%s (%d edits) -> %s (%d edits)\n",
+		from.name, len(from.edits), to.name, len(to.edits))
+
+	// responsible holds the edits responsible for the differences, keyed by
+	// the history containing the edit and the edit's index.
+	type editRef struct {
+		h       *manifestHistory
+		editIdx int
+	}
+	responsible := make(map[editRef]struct{})
+	var added, deleted [manifest.NumLevels][]*manifest.FileMetadata
+	for lf, meta := range to.files {
+		if _, ok := from.files[lf]; ok {
+			continue
+		}
+		added[lf.level] = append(added[lf.level], meta)
+		responsible[editRef{to, to.addedBy[lf]}] = struct{}{}
+	}
+	for lf, meta := range from.files {
+		if _, ok := to.files[lf]; ok {
+			continue
+		}
+		deleted[lf.level] = append(deleted[lf.level], meta)
+		// If the second version's history deleted the table, that edit is
+		// responsible. Otherwise the table was never part of the second
+		// version's history, and the edit that added it to the first version
+		// is responsible.
+		if editIdx, ok := to.deletedBy[lf]; ok {
+			responsible[editRef{to, editIdx}] = struct{}{}
+		} else {
+			responsible[editRef{from, from.addedBy[lf]}] = struct{}{}
+		}
+	}
+	if len(responsible) == 0 {
+		fmt.Fprintf(stdout, "no differences\n")
+		return
+	}
+
+	levelSize := func(h *manifestHistory, level int) (size uint64) {
+		for lf, meta := range h.files {
+			if lf.level == level {
+				size += meta.Size
+			}
+		}
+		return size
+	}
+	formatFile := func(label string, meta *manifest.FileMetadata) {
+		fmt.Fprintf(stdout, "  %-8s %s:%d", label, meta.FileNum, meta.Size)
+		formatSeqNumRange(stdout, meta.SmallestSeqNum, meta.LargestSeqNum)
+		formatKeyRange(stdout, m.fmtKey, &meta.Smallest, &meta.Largest)
+		fmt.Fprintf(stdout, "\n")
+	}
+	byFileNum := func(a, b *manifest.FileMetadata) int {
+		return cmp.Compare(a.FileNum, b.FileNum)
+	}
+	for level := 0; level < manifest.NumLevels; level++ {
+		if len(added[level]) == 0 && len(deleted[level]) == 0 {
+			continue
+		}
+		fmt.Fprintf(stdout, "--- L%d ---\n", level)
+		var addedBytes, deletedBytes uint64
+		slices.SortFunc(deleted[level], byFileNum)
+		for _, meta := range deleted[level] {
+			formatFile("deleted:", meta)
+			deletedBytes += meta.Size
+		}
+		slices.SortFunc(added[level], byFileNum)
+		for _, meta := range added[level] {
+			formatFile("added:", meta)
+			addedBytes += meta.Size
+		}
+		fmt.Fprintf(stdout, "  %-8s +%s -%s (%s -> %s)\n", "bytes:",
+			humanize.Bytes.Uint64(addedBytes), humanize.Bytes.Uint64(deletedBytes),
+			humanize.Bytes.Uint64(levelSize(from, level)), humanize.Bytes.Uint64(levelSize(to, level)))
+	}
+
+	refs := make([]editRef, 0, len(responsible))
+	for ref := range responsible {
+		refs = append(refs, ref)
+	}
+	slices.SortFunc(refs, func(a, b editRef) int {
+		if a.h != b.h {
+			// List the edits of the first version's history first.
+			if a.h == from {
+				return -1
+			}
+			return +1
+		}
+		return cmp.Compare(a.editIdx, b.editIdx)
+	})
+	fmt.Fprintf(stdout, "--- edits ---\n")
+	for _, ref := range refs {
+		fmt.Fprintf(stdout, "  %s %d: %s\n", ref.h.name, ref.editIdx, describeVersionEdit(ref.h.edits[ref.editIdx]))
+	}
+}
+
+// describeVersionEdit returns a one-line summary of the tables added and
+// deleted by a version edit, and the kind of operation responsible (flush or
+// ingest, compaction, etc).
+func describeVersionEdit(ve *manifest.VersionEdit) string {
+	deleted := make([]manifest.DeletedFileEntry, 0, len(ve.DeletedFiles))
+	for df := range ve.DeletedFiles {
+		deleted = append(deleted, df)
+	}
+	slices.SortFunc(deleted, func(a, b manifest.DeletedFileEntry) int {
+		if v := cmp.Compare(a.Level, b.Level); v != 0 {
+			return v
+		}
+		return cmp.Compare(a.FileNum, b.FileNum)
+	})
+
+	var buf strings.Builder
+	writeFiles := func(files []manifestLevelFile) {
+		for i, f := range files {
+			if i == 0 || files[i-1].level != f.level {
+				if i > 0 {
+					buf.WriteString(" ")
+				}
+				fmt.Fprintf(&buf, "L%d", f.level)
+			}
+			fmt.Fprintf(&buf, " %s", f.fileNum)
+		}
+	}
+	inputs := make([]manifestLevelFile, len(deleted))
+	for i, df := range deleted {
+		inputs[i] = manifestLevelFile{level: df.Level, fileNum: df.FileNum}
+	}
+	outputs := make([]manifestLevelFile, len(ve.NewFiles))
+	for i, nf := range ve.NewFiles {
+		outputs[i] = manifestLevelFile{level: nf.Level, fileNum: nf.Meta.FileNum}
+	}
+	slices.SortFunc(outputs, func(a, b manifestLevelFile) int {
+		if v := cmp.Compare(a.level, b.level); v != 0 {
+			return v
+		}
+		return cmp.Compare(a.fileNum, b.fileNum)
+	})
+
+	switch {
+	case len(inputs) == 0 && len(outputs) == 0:
+		return "no tables added or deleted"
+	case len(inputs) == 0:
+		buf.WriteString("flush or ingest: ")
+		writeFiles(outputs)
+	case len(outputs) == 0:
+		buf.WriteString("deletion: ")
+		writeFiles(inputs)
+	default:
+		moved := len(inputs) == len(outputs)
+		for i := 0; moved && i < len(inputs); i++ {
+			moved = inputs[i].fileNum == outputs[i].fileNum
+		}
+		if moved {
+			buf.WriteString("move: ")
+		} else {
+			buf.WriteString("compaction: ")
+		}
+		writeFiles(inputs)
+		buf.WriteString(" -> ")
+		writeFiles(outputs)
+	}
+	return buf.String()
+}
+
+func (m *manifestT) runCompact(cmd *cobra.Command, args []string) {
+	stdout, stderr := cmd.OutOrStdout(), cmd.OutOrStderr()
+	dir := args[0]
+	before, err := m.readCurrentManifest(dir)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	opts := *m.opts
+	for _, ve := range before.edits {
+		if ve.ComparerName != "" {
+			if opts.Comparer = m.comparers[ve.ComparerName]; opts.Comparer == nil {
+				fmt.Fprintf(stderr, "unknown comparer %q\n", ve.ComparerName)
+				return
+			}
+			break
+		}
+	}
+	if err := pebble.CompactManifest(dir, &opts); err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	after, err := m.readCurrentManifest(dir)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	fmt.Fprintf(stdout, "compacted %s (%d %s, %s) into %s (%d %s, %s)\n",
+		m.opts.FS.PathBase(before.name), len(before.edits), makePlural("edit", int64(len(before.edits))),
+		humanize.Bytes.Uint64(before.size), m.opts.FS.PathBase(after.name), len(after.edits),
+		makePlural("edit", int64(len(after.edits))), humanize.Bytes.Uint64(after.size))
+}
+
+// currentManifest describes the current MANIFEST of a database.
+type currentManifest struct {
+	*manifestHistory
+	size uint64
+}
+
+func (m *manifestT) readCurrentManifest(dir string) (currentManifest, error) {
+	desc, err := pebble.Peek(dir, m.opts.FS)
+	if err != nil {
+		return currentManifest{}, err
+	}
+	if !desc.Exists {
+		return currentManifest{}, errors.Errorf("pebble: database %q does not exist", dir)
+	}
+	info, err := m.opts.FS.Stat(desc.ManifestFilename)
+	if err != nil {
+		return currentManifest{}, err
+	}
+	h, err := m.readManifestHistory(desc.ManifestFilename, -1 /* lastEdit */)
+	if err != nil {
+		return currentManifest{}, err
+	}
+	return currentManifest{manifestHistory: h, size: uint64(info.Size())}, nil
+}
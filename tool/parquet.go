@@ -0,0 +1,302 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package tool
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/cockroachdb/errors"
+)
+
+// parquetWriter writes rows to a Parquet file. It implements the subset of the
+// format needed to export records: the columns are required (non-nullable)
+// UTF-8 strings or 64-bit integers, written as a single uncompressed,
+// PLAIN-encoded data page per column and row group.
+//
+// See https://github.com/apache/parquet-format for the specification of the
+// format, and of the Thrift structures of the page headers and the footer.
+type parquetWriter struct {
+	w       io.Writer
+	offset  int64
+	columns []exportColumn
+
+	// The rows buffered for the current row group, and their PLAIN-encoded
+	// values, per column.
+	numRows int64
+	pages   [][]byte
+
+	rowGroups []parquetRowGroup
+	err       error
+}
+
+// parquetRowGroupSize is the size of the buffered values at which a row group
+// is written.
+const parquetRowGroupSize = 64 << 20
+
+type parquetRowGroup struct {
+	numRows int64
+	size    int64
+	chunks  []parquetColumnChunk
+}
+
+type parquetColumnChunk struct {
+	offset int64
+	size   int64
+}
+
+// Parquet enum values.
+const (
+	parquetTypeInt64     = 2
+	parquetTypeByteArray = 6
+
+	parquetRepetitionRequired = 0
+	parquetConvertedTypeUTF8  = 0
+	parquetEncodingPlain      = 0
+	parquetEncodingRLE        = 3
+	parquetCodecUncompressed  = 0
+	parquetPageTypeData       = 0
+)
+
+const parquetMagic = "PAR1"
+
+func newParquetWriter(w io.Writer, columns []exportColumn) *parquetWriter {
+	p := &parquetWriter{
+		w:       w,
+		columns: columns,
+		pages:   make([][]byte, len(columns)),
+	}
+	p.write([]byte(parquetMagic))
+	return p
+}
+
+func (p *parquetWriter) write(b []byte) {
+	if p.err != nil {
+		return
+	}
+	n, err := p.w.Write(b)
+	p.offset += int64(n)
+	p.err = err
+}
+
+// WriteRow implements exportWriter.
+func (p *parquetWriter) WriteRow(values []exportValue) error {
+	var size int
+	for i, v := range values {
+		page := p.pages[i]
+		if p.columns[i].kind == exportInt64 {
+			page = binary.LittleEndian.AppendUint64(page, uint64(v.i))
+		} else {
+			page = binary.LittleEndian.AppendUint32(page, uint32(len(v.s)))
+			page = append(page, v.s...)
+		}
+		p.pages[i] = page
+		size += len(page)
+	}
+	p.numRows++
+	if size >= parquetRowGroupSize {
+		p.flushRowGroup()
+	}
+	return p.err
+}
+
+// flushRowGroup writes the buffered rows as a row group.
+func (p *parquetWriter) flushRowGroup() {
+	if p.numRows == 0 {
+		return
+	}
+	rg := parquetRowGroup{numRows: p.numRows}
+	for i, page := range p.pages {
+		var t thriftWriter
+		t.beginStruct()
+		t.i32Field(1, parquetPageTypeData)
+		t.i32Field(2, int32(len(page)))
+		t.i32Field(3, int32(len(page)))
+		t.structField(5, func() {
+			t.i32Field(1, int32(p.numRows))
+			t.i32Field(2, parquetEncodingPlain)
+			t.i32Field(3, parquetEncodingRLE)
+			t.i32Field(4, parquetEncodingRLE)
+		})
+		t.endStruct()
+
+		chunk := parquetColumnChunk{offset: p.offset, size: int64(len(t.buf) + len(page))}
+		p.write(t.buf)
+		p.write(page)
+		rg.chunks = append(rg.chunks, chunk)
+		rg.size += chunk.size
+		p.pages[i] = page[:0]
+	}
+	p.rowGroups = append(p.rowGroups, rg)
+	p.numRows = 0
+}
+
+// Close implements exportWriter. It writes the buffered rows and the footer.
+func (p *parquetWriter) Close() error {
+	p.flushRowGroup()
+
+	var totalRows int64
+	for _, rg := range p.rowGroups {
+		totalRows += rg.numRows
+	}
+	var t thriftWriter
+	// FileMetaData.
+	t.beginStruct()
+	t.i32Field(1, 1 /* version */)
+	t.structListField(2, len(p.columns)+1, func(i int) {
+		// SchemaElement. The first element is the root of the schema.
+		if i == 0 {
+			t.binaryField(4, []byte("schema"))
+			t.i32Field(5, int32(len(p.columns)))
+			return
+		}
+		c := p.columns[i-1]
+		t.i32Field(1, c.parquetType())
+		t.i32Field(3, parquetRepetitionRequired)
+		t.binaryField(4, []byte(c.name))
+		if c.kind == exportString {
+			t.i32Field(6, parquetConvertedTypeUTF8)
+		}
+	})
+	t.i64Field(3, totalRows)
+	t.structListField(4, len(p.rowGroups), func(i int) {
+		// RowGroup.
+		rg := p.rowGroups[i]
+		t.structListField(1, len(rg.chunks), func(j int) {
+			// ColumnChunk.
+			chunk := rg.chunks[j]
+			t.i64Field(2, chunk.offset)
+			t.structField(3, func() {
+				// ColumnMetaData.
+				c := p.columns[j]
+				t.i32Field(1, c.parquetType())
+				t.i32ListField(2, []int32{parquetEncodingPlain})
+				t.binaryListField(3, [][]byte{[]byte(c.name)})
+				t.i32Field(4, parquetCodecUncompressed)
+				t.i64Field(5, rg.numRows)
+				t.i64Field(6, chunk.size)
+				t.i64Field(7, chunk.size)
+				t.i64Field(9, chunk.offset)
+			})
+		})
+		t.i64Field(2, rg.size)
+		t.i64Field(3, rg.numRows)
+	})
+	t.binaryField(6, []byte("pebble"))
+	t.endStruct()
+
+	p.write(t.buf)
+	p.write(binary.LittleEndian.AppendUint32(nil, uint32(len(t.buf))))
+	p.write([]byte(parquetMagic))
+	return errors.Wrap(p.err, "writing parquet")
+}
+
+func (c exportColumn) parquetType() int32 {
+	if c.kind == exportInt64 {
+		return parquetTypeInt64
+	}
+	return parquetTypeByteArray
+}
+
+// thriftWriter encodes Thrift structures with the compact protocol.
+type thriftWriter struct {
+	buf []byte
+	// lastFieldIDs holds the ID of the last field written of each struct being
+	// written, as field IDs are encoded as deltas.
+	lastFieldIDs []int16
+}
+
+// Compact protocol types.
+const (
+	thriftTypeI32    = 5
+	thriftTypeI64    = 6
+	thriftTypeBinary = 8
+	thriftTypeList   = 9
+	thriftTypeStruct = 12
+)
+
+func (t *thriftWriter) beginStruct() {
+	t.lastFieldIDs = append(t.lastFieldIDs, 0)
+}
+
+func (t *thriftWriter) endStruct() {
+	t.buf = append(t.buf, 0 /* stop */)
+	t.lastFieldIDs = t.lastFieldIDs[:len(t.lastFieldIDs)-1]
+}
+
+func (t *thriftWriter) fieldHeader(id int16, typ byte) {
+	last := &t.lastFieldIDs[len(t.lastFieldIDs)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.buf = append(t.buf, byte(delta)<<4|typ)
+	} else {
+		t.buf = append(t.buf, typ)
+		t.buf = binary.AppendVarint(t.buf, int64(id))
+	}
+	*last = id
+}
+
+func (t *thriftWriter) listHeader(n int, elemType byte) {
+	if n < 15 {
+		t.buf = append(t.buf, byte(n)<<4|elemType)
+	} else {
+		t.buf = append(t.buf, 0xf0|elemType)
+		t.buf = binary.AppendUvarint(t.buf, uint64(n))
+	}
+}
+
+func (t *thriftWriter) binary(b []byte) {
+	t.buf = binary.AppendUvarint(t.buf, uint64(len(b)))
+	t.buf = append(t.buf, b...)
+}
+
+func (t *thriftWriter) i32Field(id int16, v int32) {
+	t.fieldHeader(id, thriftTypeI32)
+	// Integers are zigzag varints, as encoded by binary.AppendVarint.
+	t.buf = binary.AppendVarint(t.buf, int64(v))
+}
+
+func (t *thriftWriter) i64Field(id int16, v int64) {
+	t.fieldHeader(id, thriftTypeI64)
+	t.buf = binary.AppendVarint(t.buf, v)
+}
+
+func (t *thriftWriter) binaryField(id int16, b []byte) {
+	t.fieldHeader(id, thriftTypeBinary)
+	t.binary(b)
+}
+
+func (t *thriftWriter) structField(id int16, fn func()) {
+	t.fieldHeader(id, thriftTypeStruct)
+	t.beginStruct()
+	fn()
+	t.endStruct()
+}
+
+func (t *thriftWriter) i32ListField(id int16, vs []int32) {
+	t.fieldHeader(id, thriftTypeList)
+	t.listHeader(len(vs), thriftTypeI32)
+	for _, v := range vs {
+		t.buf = binary.AppendVarint(t.buf, int64(v))
+	}
+}
+
+func (t *thriftWriter) binaryListField(id int16, bs [][]byte) {
+	t.fieldHeader(id, thriftTypeList)
+	t.listHeader(len(bs), thriftTypeBinary)
+	for _, b := range bs {
+		t.binary(b)
+	}
+}
+
+// structListField writes a list of n structs, whose fields are written by fn.
+func (t *thriftWriter) structListField(id int16, n int, fn func(i int)) {
+	t.fieldHeader(id, thriftTypeList)
+	t.listHeader(n, thriftTypeStruct)
+	for i := 0; i < n; i++ {
+		t.beginStruct()
+		fn(i)
+		t.endStruct()
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package tool
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// thriftReader decodes Thrift structures encoded with the compact protocol
+// into generic values: structs are decoded as maps from field IDs to values,
+// lists as slices, integers as int64s and binaries as byte slices.
+type thriftReader struct {
+	b []byte
+}
+
+func (r *thriftReader) byte() byte {
+	b := r.b[0]
+	r.b = r.b[1:]
+	return b
+}
+
+func (r *thriftReader) varint() int64 {
+	v, n := binary.Varint(r.b)
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b)
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *thriftReader) readStruct() map[int16]any {
+	fields := make(map[int16]any)
+	var id int16
+	for {
+		h := r.byte()
+		if h == 0 {
+			return fields
+		}
+		if delta := h >> 4; delta != 0 {
+			id += int16(delta)
+		} else {
+			id = int16(r.varint())
+		}
+		fields[id] = r.readValue(h & 0x0f)
+	}
+}
+
+func (r *thriftReader) readValue(typ byte) any {
+	switch typ {
+	case thriftTypeI32, thriftTypeI64:
+		return r.varint()
+	case thriftTypeBinary:
+		n := r.uvarint()
+		b := r.b[:n]
+		r.b = r.b[n:]
+		return b
+	case thriftTypeList:
+		h := r.byte()
+		n := int(h >> 4)
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		list := make([]any, n)
+		for i := range list {
+			list[i] = r.readValue(h & 0x0f)
+		}
+		return list
+	case thriftTypeStruct:
+		return r.readStruct()
+	default:
+		panic(fmt.Sprintf("unexpected thrift type %d", typ))
+	}
+}
+
+// readParquet decodes a file written by parquetWriter, returning the names of
+// its columns and its rows.
+func readParquet(t *testing.T, data []byte) (columns []string, rows [][]any) {
+	require.True(t, bytes.HasPrefix(data, []byte(parquetMagic)))
+	require.True(t, bytes.HasSuffix(data, []byte(parquetMagic)))
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	r := thriftReader{b: data[len(data)-8-footerLen : len(data)-8]}
+	meta := r.readStruct()
+	require.Empty(t, r.b)
+	require.Equal(t, int64(1), meta[1])
+
+	schema := meta[2].([]any)
+	root := schema[0].(map[int16]any)
+	require.Equal(t, int64(len(schema)-1), root[5])
+	var types []int64
+	for _, e := range schema[1:] {
+		e := e.(map[int16]any)
+		columns = append(columns, string(e[4].([]byte)))
+		types = append(types, e[1].(int64))
+		require.Equal(t, int64(parquetRepetitionRequired), e[3])
+	}
+
+	for _, rg := range meta[4].([]any) {
+		rg := rg.(map[int16]any)
+		numRows := int(rg[3].(int64))
+		groupRows := make([][]any, numRows)
+		for i := range groupRows {
+			groupRows[i] = make([]any, len(columns))
+		}
+		for i, chunk := range rg[1].([]any) {
+			chunkMeta := chunk.(map[int16]any)[3].(map[int16]any)
+			require.Equal(t, types[i], chunkMeta[1])
+			require.Equal(t, []any{[]byte(columns[i])}, chunkMeta[3])
+			require.Equal(t, int64(numRows), chunkMeta[5])
+
+			offset := chunkMeta[9].(int64)
+			r := thriftReader{b: data[offset:]}
+			header := r.readStruct()
+			require.Equal(t, int64(parquetPageTypeData), header[1])
+			require.Equal(t, int64(numRows), header[5].(map[int16]any)[1])
+			page := r.b[:header[3].(int64)]
+			require.Equal(t, chunkMeta[6], int64(len(data[offset:])-len(r.b)+len(page)))
+			for j := 0; j < numRows; j++ {
+				if types[i] == parquetTypeInt64 {
+					groupRows[j][i] = int64(binary.LittleEndian.Uint64(page))
+					page = page[8:]
+				} else {
+					n := binary.LittleEndian.Uint32(page)
+					groupRows[j][i] = string(page[4 : 4+n])
+					page = page[4+n:]
+				}
+			}
+			require.Empty(t, page)
+		}
+		rows = append(rows, groupRows...)
+	}
+	require.Equal(t, int64(len(rows)), meta[3])
+	return columns, rows
+}
+
+func TestParquetWriter(t *testing.T) {
+	columns := []exportColumn{
+		{name: "key", kind: exportString},
+		{name: "seqnum", kind: exportInt64},
+	}
+	for _, numRows := range []int{0, 1, 20} {
+		t.Run(fmt.Sprint(numRows), func(t *testing.T) {
+			var buf bytes.Buffer
+			w := newParquetWriter(&buf, columns)
+			var expected [][]any
+			for i := 0; i < numRows; i++ {
+				key := fmt.Sprintf("key%d", i)
+				require.NoError(t, w.WriteRow([]exportValue{{s: key}, {i: int64(-i)}}))
+				expected = append(expected, []any{key, int64(-i)})
+			}
+			require.NoError(t, w.Close())
+
+			names, rows := readParquet(t, buf.Bytes())
+			require.Equal(t, []string{"key", "seqnum"}, names)
+			require.Equal(t, expected, rows)
+		})
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package tool
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/objstorage"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/objstorage/remote"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/spf13/cobra"
+)
+
+// remotePathSeparator separates the locator from the object name in paths that
+// refer to files residing in remote storage.
+const remotePathSeparator = "://"
+
+// parseRemotePath parses a path of the form <locator>://<object-name>. It
+// returns ok=false if the path is not of that form.
+func parseRemotePath(p string) (_ remote.Locator, objName string, ok bool) {
+	locator, objName, ok := strings.Cut(p, remotePathSeparator)
+	if !ok || locator == "" || objName == "" {
+		return "", "", false
+	}
+	return remote.Locator(locator), objName, true
+}
+
+// remoteFiles opens files residing in remote storage, such as shared sstables
+// and archived WALs, which are referred to by paths of the form
+// <locator>://<object-name>. The files are read through an objstorage.Provider
+// resolving locators through the storage factory configured by
+// T.ConfigureSharedStorage, or, if the --remote flag is specified, through the
+// storage described by a settings file.
+//
+// Each non-empty line of a settings file that isn't a comment (starting with
+// #) is of the form:
+//
+//	<locator> <directory>
+//
+// mapping the locator to the directory of the local filesystem holding its
+// objects, for example a directory onto which a bucket is mounted.
+type remoteFiles struct {
+	opts *pebble.Options
+	// settings is the path of the settings file specified by the --remote flag.
+	settings string
+
+	provider objstorage.Provider
+}
+
+// registerFlags registers the --remote flag on the command and its
+// subcommands.
+func (r *remoteFiles) registerFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(
+		&r.settings, "remote", "", "remote storage settings file describing the storage of <locator>://<object-name> paths")
+}
+
+// open opens the file at the given path if the path refers to a file residing
+// in remote storage, returning ok=false otherwise.
+func (r *remoteFiles) open(p string) (_ objstorage.Readable, ok bool, _ error) {
+	locator, objName, ok := parseRemotePath(p)
+	if !ok {
+		return nil, false, nil
+	}
+	if r.provider == nil {
+		if err := r.openProvider(); err != nil {
+			return nil, true, err
+		}
+	}
+	objReader, size, err := r.provider.ReadExternalObject(context.Background(), locator, objName)
+	if err != nil {
+		return nil, true, errors.Wrapf(err, "%s", p)
+	}
+	return objstorageprovider.NewRemoteReadable(objReader, size), true, nil
+}
+
+func (r *remoteFiles) openProvider() error {
+	factory := r.opts.Experimental.RemoteStorage
+	if r.settings != "" {
+		var err error
+		if factory, err = r.loadSettings(); err != nil {
+			return err
+		}
+	}
+	if factory == nil {
+		return errors.New("remote storage is not configured; specify a settings file with --remote")
+	}
+	// The provider is only used to read external objects, which doesn't
+	// involve its local directory, so give it an empty in-memory one.
+	settings := objstorageprovider.DefaultSettings(vfs.NewMem(), "")
+	settings.Logger = base.NoopLoggerAndTracer{}
+	settings.Remote.StorageFactory = factory
+	provider, err := objstorageprovider.Open(settings)
+	if err != nil {
+		return err
+	}
+	r.provider = provider
+	return nil
+}
+
+func (r *remoteFiles) loadSettings() (remote.StorageFactory, error) {
+	f, err := r.opts.FS.Open(r.settings)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	storage := make(map[remote.Locator]remote.Storage)
+	s := bufio.NewScanner(f)
+	for lineNum := 1; s.Scan(); lineNum++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, errors.Errorf("%s:%d: expected <locator> <directory>", r.settings, lineNum)
+		}
+		storage[remote.Locator(fields[0])] = remote.NewLocalFS(fields[1], r.opts.FS)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return remote.MakeSimpleFactory(storage), nil
+}
+
+// close closes the provider, if it was opened.
+func (r *remoteFiles) close() {
+	if r.provider != nil {
+		_ = r.provider.Close()
+		r.provider = nil
+	}
+}
+
+// remoteBaseName returns the base name of the object referred to by the path,
+// if it refers to a file residing in remote storage, and otherwise the path.
+func remoteBaseName(p string) string {
+	if _, objName, ok := parseRemotePath(p); ok {
+		return path.Base(objName)
+	}
+	return p
+}
+
+// readableReader implements io.Reader, reading an objstorage.Readable
+// sequentially.
+type readableReader struct {
+	r   objstorage.Readable
+	off int64
+}
+
+// Read implements io.Reader.
+func (r *readableReader) Read(p []byte) (int, error) {
+	n := min(int64(len(p)), r.r.Size()-r.off)
+	if n <= 0 {
+		return 0, io.EOF
+	}
+	if err := r.r.ReadAt(context.Background(), p[:n], r.off); err != nil {
+		return 0, err
+	}
+	r.off += n
+	return int(n), nil
+}
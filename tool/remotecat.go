@@ -11,16 +11,20 @@ import (
 
 	"github.com/cockroachdb/pebble"
 	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/humanize"
 	"github.com/cockroachdb/pebble/objstorage"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider/remoteobjcat"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider/sharedcache"
 	"github.com/cockroachdb/pebble/record"
 	"github.com/spf13/cobra"
 )
 
-// remoteCatalogT implements tools for the remote object catalog.
+// remoteCatalogT implements tools for the remote object catalog and the
+// shared cache of remote objects.
 type remoteCatalogT struct {
-	Root *cobra.Command
-	Dump *cobra.Command
+	Root  *cobra.Command
+	Dump  *cobra.Command
+	Cache *cobra.Command
 
 	verbose bool
 	opts    *pebble.Options
@@ -47,7 +51,19 @@ Print the contents of the REMOTE-OBJ-CATALOG files.
 		Run:  m.runDump,
 	}
 	m.Dump.Flags().BoolVarP(&m.verbose, "verbose", "v", false, "show each record in the catalog")
-	m.Root.AddCommand(m.Dump)
+	m.Cache = &cobra.Command{
+		Use:   "cache <dir>",
+		Short: "print shared cache contents",
+		Long: `
+Print the contents of the shared cache of remote objects in the specified
+directory: the configuration of the cache, and the number of cache blocks
+holding data of each remote object. The contents are read from the metadata
+persisted when the cache was last closed, so the cache must not be in use.
+`,
+		Args: cobra.ExactArgs(1),
+		Run:  m.runCache,
+	}
+	m.Root.AddCommand(m.Dump, m.Cache)
 
 	return m
 }
@@ -130,3 +146,20 @@ func (m *remoteCatalogT) runDumpOne(stdout io.Writer, filename string) error {
 	}
 	return nil
 }
+
+func (m *remoteCatalogT) runCache(cmd *cobra.Command, args []string) {
+	stdout := cmd.OutOrStdout()
+	c, err := sharedcache.ReadContents(m.opts.FS, args[0])
+	if err != nil {
+		fmt.Fprintf(cmd.OutOrStderr(), "%s\n", err)
+		return
+	}
+	blockSize := int64(c.BlockSize)
+	fmt.Fprintf(stdout, "block size: %s  shards: %d\n", humanize.Bytes.Int64(blockSize), c.NumShards)
+	fmt.Fprintf(stdout, "used: %d/%d blocks (%s/%s)\n", c.UsedBlocks, c.SizeInBlocks,
+		humanize.Bytes.Int64(c.UsedBlocks*blockSize), humanize.Bytes.Int64(c.SizeInBlocks*blockSize))
+	fmt.Fprintf(stdout, "Objects:\n")
+	for _, o := range c.Objects {
+		fmt.Fprintf(stdout, "    %s  blocks: %d (%s)\n", o.FileNum, o.Blocks, humanize.Bytes.Int64(o.Blocks*blockSize))
+	}
+}
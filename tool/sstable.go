@@ -13,14 +13,15 @@ import (
 	"slices"
 	"text/tabwriter"
 
+	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/humanize"
 	"github.com/cockroachdb/pebble/internal/keyspan"
 	"github.com/cockroachdb/pebble/internal/private"
 	"github.com/cockroachdb/pebble/internal/rangedel"
+	"github.com/cockroachdb/pebble/objstorage"
 	"github.com/cockroachdb/pebble/sstable"
-	"github.com/cockroachdb/pebble/vfs"
 	"github.com/spf13/cobra"
 )
 
@@ -29,15 +30,19 @@ import (
 type sstableT struct {
 	Root       *cobra.Command
 	Check      *cobra.Command
+	Create     *cobra.Command
+	Export     *cobra.Command
 	Layout     *cobra.Command
 	Properties *cobra.Command
 	Scan       *cobra.Command
 	Space      *cobra.Command
+	Verify     *cobra.Command
 
 	// Configuration and state.
 	opts      *pebble.Options
 	comparers sstable.Comparers
 	mergers   sstable.Mergers
+	remote    remoteFiles
 
 	// Flags.
 	fmtKey   keyFormatter
@@ -47,6 +52,13 @@ type sstableT struct {
 	filter   key
 	count    int64
 	verbose  bool
+
+	exportFormat   exportFormat
+	exportOutput   string
+	exportFmtKey   keyFormatter
+	exportFmtValue valueFormatter
+
+	createSpec string
 }
 
 func newSSTable(
@@ -56,13 +68,24 @@ func newSSTable(
 		opts:      opts,
 		comparers: comparers,
 		mergers:   mergers,
+		remote:    remoteFiles{opts: opts},
 	}
 	s.fmtKey.mustSet("quoted")
 	s.fmtValue.mustSet("[%x]")
+	s.exportFormat = "csv"
+	s.exportFmtKey.mustSet("pretty")
+	s.exportFmtValue.mustSet("pretty")
 
 	s.Root = &cobra.Command{
 		Use:   "sstable",
 		Short: "sstable introspection tools",
+		Long: `
+sstable introspection tools. Sstables residing in remote storage may be
+specified as <locator>://<object-name>, resolved through the storage configured
+through ConfigureSharedStorage or described by the settings file specified with
+--remote.
+`,
+		PersistentPostRun: func(*cobra.Command, []string) { s.remote.close() },
 	}
 	s.Check = &cobra.Command{
 		Use:   "check <sstables>",
@@ -71,6 +94,41 @@ func newSSTable(
 		Args:  cobra.MinimumNArgs(1),
 		Run:   s.runCheck,
 	}
+	s.Create = &cobra.Command{
+		Use:   "create --from-json <spec> <sstable>",
+		Short: "create an sstable from a JSON spec",
+		Long: `
+Create an sstable holding the point records and range deletions described by
+the JSON spec file, in the order they're listed. The spec may disable the
+checks that the records are in order, in order to generate invalid sstables for
+tests. For example:
+
+  {
+    "table_format": "Pebblev1",
+    "disable_key_order_checks": true,
+    "records": [
+      {"key": "a", "seq": 1, "kind": "SET", "value": "foo"},
+      {"key": "c", "seq": 2, "kind": "RANGEDEL", "end": "d"},
+      {"key": "b", "seq": 3, "kind": "DEL"}
+    ]
+  }
+`,
+		Args: cobra.ExactArgs(1),
+		Run:  s.runCreate,
+	}
+	s.Export = &cobra.Command{
+		Use:   "export <sstables>",
+		Short: "export sstable records as CSV or Parquet",
+		Long: `
+Export the point records of the sstables, in command line order, as the rows of
+a CSV or Parquet file with the columns key, seqnum, kind and value. Keys and
+values are decoded by the --key and --value formatters, which default to the
+formatters of the sstables' comparer, if any. Range deletions and range keys
+aren't exported.
+`,
+		Args: cobra.MinimumNArgs(1),
+		Run:  s.runExport,
+	}
 	s.Layout = &cobra.Command{
 		Use:   "layout <sstables>",
 		Short: "print sstable block and record layout",
@@ -113,8 +171,22 @@ inclusive-inclusive range specified by --start and --end.
 		Run:  s.runSpace,
 	}
 
-	s.Root.AddCommand(s.Check, s.Layout, s.Properties, s.Scan, s.Space)
+	s.Verify = &cobra.Command{
+		Use:   "verify <sstables>",
+		Short: "verify every block of the sstables",
+		Long: `
+Read every block of the sstables, verifying block checksums, the ordering of
+point keys and range deletions, and the consistency of the table properties
+with the table's contents. Unlike check, verify does not stop at the first
+corrupted block, and reports the location of every problem found.
+`,
+		Args: cobra.MinimumNArgs(1),
+		Run:  s.runVerify,
+	}
+
+	s.Root.AddCommand(s.Check, s.Create, s.Export, s.Layout, s.Properties, s.Scan, s.Space, s.Verify)
 	s.Root.PersistentFlags().BoolVarP(&s.verbose, "verbose", "v", false, "verbose output")
+	s.remote.registerFlags(s.Root)
 
 	s.Check.Flags().Var(
 		&s.fmtKey, "key", "key formatter")
@@ -126,7 +198,18 @@ inclusive-inclusive range specified by --start and --end.
 		&s.fmtKey, "key", "key formatter")
 	s.Scan.Flags().Var(
 		&s.fmtValue, "value", "value formatter")
-	for _, cmd := range []*cobra.Command{s.Scan, s.Space} {
+	s.Create.Flags().StringVar(
+		&s.createSpec, "from-json", "", "JSON spec of the sstable")
+	_ = s.Create.MarkFlagRequired("from-json")
+	s.Export.Flags().Var(
+		&s.exportFmtKey, "key", "key formatter")
+	s.Export.Flags().Var(
+		&s.exportFmtValue, "value", "value formatter")
+	s.Export.Flags().Var(
+		&s.exportFormat, "format", "output format (csv or parquet)")
+	s.Export.Flags().StringVarP(
+		&s.exportOutput, "output", "o", "", "output file (stdout if empty)")
+	for _, cmd := range []*cobra.Command{s.Export, s.Scan, s.Space} {
 		cmd.Flags().Var(
 			&s.start, "start", "start key for the range")
 		cmd.Flags().Var(
@@ -140,11 +223,25 @@ inclusive-inclusive range specified by --start and --end.
 	return s
 }
 
-func (s *sstableT) newReader(f vfs.File) (*sstable.Reader, error) {
+// openReadable opens the sstable at the given path, which may refer to an
+// sstable residing in remote storage (see remoteFiles).
+func (s *sstableT) openReadable(path string) (objstorage.Readable, error) {
+	if readable, ok, err := s.remote.open(path); ok {
+		return readable, err
+	}
+	f, err := s.opts.FS.Open(path)
+	if err != nil {
+		return nil, err
+	}
 	readable, err := sstable.NewSimpleReadable(f)
 	if err != nil {
+		_ = f.Close()
 		return nil, err
 	}
+	return readable, nil
+}
+
+func (s *sstableT) newReader(readable objstorage.Readable) (*sstable.Reader, error) {
 	o := sstable.ReaderOptions{
 		Cache:    pebble.NewCache(128 << 20 /* 128 MB */),
 		Comparer: s.opts.Comparer,
@@ -158,7 +255,7 @@ func (s *sstableT) newReader(f vfs.File) (*sstable.Reader, error) {
 func (s *sstableT) runCheck(cmd *cobra.Command, args []string) {
 	stdout, stderr := cmd.OutOrStdout(), cmd.OutOrStderr()
 	s.foreachSstable(stderr, args, func(arg string) {
-		f, err := s.opts.FS.Open(arg)
+		f, err := s.openReadable(arg)
 		if err != nil {
 			fmt.Fprintf(stderr, "%s\n", err)
 			return
@@ -223,10 +320,51 @@ func (s *sstableT) runCheck(cmd *cobra.Command, args []string) {
 	})
 }
 
+func (s *sstableT) runVerify(cmd *cobra.Command, args []string) {
+	stdout, stderr := cmd.OutOrStdout(), cmd.OutOrStderr()
+	s.foreachSstable(stderr, args, func(arg string) {
+		f, err := s.openReadable(arg)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s\n", err)
+			return
+		}
+
+		fmt.Fprintf(stdout, "%s\n", arg)
+
+		r, err := s.newReader(f)
+		if err != nil {
+			fmt.Fprintf(stdout, "%s\n", err)
+			return
+		}
+		defer r.Close()
+
+		report, err := r.Verify()
+		if err != nil {
+			fmt.Fprintf(stdout, "%s\n", err)
+			return
+		}
+		printVerifyReport(stdout, report)
+	})
+}
+
+// printVerifyReport prints the problems found by sstable.Reader.Verify,
+// followed by a summary line.
+func printVerifyReport(w io.Writer, report sstable.VerifyReport) {
+	for _, issue := range report.Issues {
+		fmt.Fprintf(w, "  %s\n", issue)
+	}
+	fmt.Fprintf(w, "  verified %d %s: ", report.BlocksVerified, makePlural("block", int64(report.BlocksVerified)))
+	if report.OK() {
+		fmt.Fprintf(w, "OK\n")
+	} else {
+		fmt.Fprintf(w, "%d %s\n", len(report.Issues), makePlural("issue", int64(len(report.Issues))))
+	}
+}
+
 func (s *sstableT) runLayout(cmd *cobra.Command, args []string) {
 	stdout, stderr := cmd.OutOrStdout(), cmd.OutOrStderr()
 	s.foreachSstable(stderr, args, func(arg string) {
-		f, err := s.opts.FS.Open(arg)
+		f, err := s.openReadable(arg)
 		if err != nil {
 			fmt.Fprintf(stderr, "%s\n", err)
 			return
@@ -263,7 +401,7 @@ func (s *sstableT) runLayout(cmd *cobra.Command, args []string) {
 func (s *sstableT) runProperties(cmd *cobra.Command, args []string) {
 	stdout, stderr := cmd.OutOrStdout(), cmd.OutOrStderr()
 	s.foreachSstable(stderr, args, func(arg string) {
-		f, err := s.opts.FS.Open(arg)
+		f, err := s.openReadable(arg)
 		if err != nil {
 			fmt.Fprintf(stderr, "%s\n", err)
 			return
@@ -283,12 +421,6 @@ func (s *sstableT) runProperties(cmd *cobra.Command, args []string) {
 			return
 		}
 
-		stat, err := f.Stat()
-		if err != nil {
-			fmt.Fprintf(stderr, "%s\n", err)
-			return
-		}
-
 		formatNull := func(s string) string {
 			switch s {
 			case "", "nullptr":
@@ -299,7 +431,7 @@ func (s *sstableT) runProperties(cmd *cobra.Command, args []string) {
 
 		tw := tabwriter.NewWriter(stdout, 2, 1, 2, ' ', 0)
 		fmt.Fprintf(tw, "size\t\n")
-		fmt.Fprintf(tw, "  file\t%s\n", humanize.Bytes.Int64(stat.Size()))
+		fmt.Fprintf(tw, "  file\t%s\n", humanize.Bytes.Int64(f.Size()))
 		fmt.Fprintf(tw, "  data\t%s\n", humanize.Bytes.Uint64(r.Properties.DataSize))
 		fmt.Fprintf(tw, "    blocks\t%d\n", r.Properties.NumDataBlocks)
 		fmt.Fprintf(tw, "  index\t%s\n", humanize.Bytes.Uint64(r.Properties.IndexSize))
@@ -323,12 +455,18 @@ func (s *sstableT) runProperties(cmd *cobra.Command, args []string) {
 		fmt.Fprintf(tw, "  range-key-delete\t%d\n", r.Properties.NumRangeKeyDels)
 		fmt.Fprintf(tw, "  merge\t%d\n", r.Properties.NumMergeOperands)
 		fmt.Fprintf(tw, "  pinned\t%d\n", r.Properties.SnapshotPinnedKeys)
+		fmt.Fprintf(tw, "size-histograms\t\n")
+		fmt.Fprintf(tw, "  key\t%s\n", r.Properties.KeySizes)
+		fmt.Fprintf(tw, "  value\t%s\n", r.Properties.ValueSizes)
+		fmt.Fprintf(tw, "  data-block\t%s\n", r.Properties.DataBlockSizes)
+		fmt.Fprintf(tw, "  compressed-block\t%s\n", r.Properties.CompressedDataBlockSizes)
 		fmt.Fprintf(tw, "index\t\n")
 		fmt.Fprintf(tw, "  key\t")
 		fmt.Fprintf(tw, "  value\t")
 		fmt.Fprintf(tw, "comparer\t%s\n", r.Properties.ComparerName)
 		fmt.Fprintf(tw, "merger\t%s\n", formatNull(r.Properties.MergerName))
 		fmt.Fprintf(tw, "filter\t%s\n", formatNull(r.Properties.FilterPolicyName))
+		fmt.Fprintf(tw, "  prefix-extractor\t%s\n", formatNull(r.Properties.PrefixExtractorName))
 		fmt.Fprintf(tw, "compression\t%s\n", r.Properties.CompressionName)
 		fmt.Fprintf(tw, "  options\t%s\n", r.Properties.CompressionOptions)
 		fmt.Fprintf(tw, "user properties\t\n")
@@ -348,7 +486,7 @@ func (s *sstableT) runProperties(cmd *cobra.Command, args []string) {
 func (s *sstableT) runScan(cmd *cobra.Command, args []string) {
 	stdout, stderr := cmd.OutOrStdout(), cmd.OutOrStderr()
 	s.foreachSstable(stderr, args, func(arg string) {
-		f, err := s.opts.FS.Open(arg)
+		f, err := s.openReadable(arg)
 		if err != nil {
 			fmt.Fprintf(stderr, "%s\n", err)
 			return
@@ -527,10 +665,92 @@ func (s *sstableT) runScan(cmd *cobra.Command, args []string) {
 	})
 }
 
+func (s *sstableT) runCreate(cmd *cobra.Command, args []string) {
+	stderr := cmd.OutOrStderr()
+	f, err := s.opts.FS.Open(s.createSpec)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	spec, err := readSSTableSpec(f)
+	_ = f.Close()
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", s.createSpec, err)
+		return
+	}
+	opts := sstable.WriterOptions{Comparer: s.opts.Comparer}
+	if s.opts.Merger != nil {
+		opts.MergerName = s.opts.Merger.Name
+	}
+	if err := writeSSTableSpec(s.opts.FS, args[0], spec, opts); err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", args[0], err)
+	}
+}
+
+func (s *sstableT) runExport(cmd *cobra.Command, args []string) {
+	stdout, stderr := cmd.OutOrStdout(), cmd.OutOrStderr()
+	columns := []exportColumn{
+		{name: "key", kind: exportString},
+		{name: "seqnum", kind: exportInt64},
+		{name: "kind", kind: exportString},
+		{name: "value", kind: exportString},
+	}
+	err := export(s.opts.FS, s.exportOutput, stdout, s.exportFormat, columns, func(w exportWriter) error {
+		var err error
+		s.foreachSstable(stderr, args, func(arg string) {
+			if err == nil {
+				err = errors.Wrap(s.exportSSTable(w, arg), arg)
+			}
+		})
+		return err
+	})
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+	}
+}
+
+// exportSSTable writes the point records of the sstable within the --start and
+// --end bounds to w.
+func (s *sstableT) exportSSTable(w exportWriter, path string) error {
+	f, err := s.openReadable(path)
+	if err != nil {
+		return err
+	}
+	r, err := s.newReader(f)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	// Update the internal formatter if this comparator has one specified.
+	s.exportFmtKey.setForComparer(r.Properties.ComparerName, s.comparers)
+	s.exportFmtValue.setForComparer(r.Properties.ComparerName, s.comparers)
+
+	iter, err := r.NewIter(sstable.NoTransforms, nil, s.end)
+	if err != nil {
+		return err
+	}
+	values := make([]exportValue, 4)
+	for key, value := iter.SeekGE(s.start, base.SeekGEFlagsNone); key != nil; key, value = iter.Next() {
+		v, _, err := value.Value(nil)
+		if err != nil {
+			return errors.CombineErrors(err, iter.Close())
+		}
+		values[0].s = formatExported(s.exportFmtKey.fn(key.UserKey))
+		values[1].i = int64(key.SeqNum())
+		values[2].s = key.Kind().String()
+		values[3].s = formatExported(s.exportFmtValue.fn(key.UserKey, v))
+		if err := w.WriteRow(values); err != nil {
+			return errors.CombineErrors(err, iter.Close())
+		}
+	}
+	return iter.Close()
+}
+
 func (s *sstableT) runSpace(cmd *cobra.Command, args []string) {
 	stdout, stderr := cmd.OutOrStdout(), cmd.OutOrStderr()
 	s.foreachSstable(stderr, args, func(arg string) {
-		f, err := s.opts.FS.Open(arg)
+		f, err := s.openReadable(arg)
 		if err != nil {
 			fmt.Fprintf(stderr, "%s\n", err)
 			return
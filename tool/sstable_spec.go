@@ -0,0 +1,128 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package tool
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/sstable"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// sstableSpec is the JSON specification of an sstable written by the sstable
+// create command. For example:
+//
+//	{
+//	  "table_format": "Pebblev1",
+//	  "disable_key_order_checks": true,
+//	  "records": [
+//	    {"key": "a", "seq": 1, "kind": "SET", "value": "foo"},
+//	    {"key": "c", "seq": 2, "kind": "RANGEDEL", "end": "d"},
+//	    {"key": "b", "seq": 3, "kind": "DEL"}
+//	  ]
+//	}
+type sstableSpec struct {
+	// TableFormat is the format of the sstable: one of LevelDB, RocksDBv2 and
+	// Pebblev1 to Pebblev4. It defaults to the oldest format supported by the
+	// sstable package.
+	TableFormat string `json:"table_format"`
+	// BlockSize and IndexBlockSize are the target sizes of the data and index
+	// blocks. They default to the sstable.WriterOptions defaults.
+	BlockSize      int `json:"block_size"`
+	IndexBlockSize int `json:"index_block_size"`
+	// DisableKeyOrderChecks allows records to be out of order. See
+	// sstable.WriterOptions.Unsafe.
+	DisableKeyOrderChecks bool `json:"disable_key_order_checks"`
+	// Records are the records of the sstable, in the order they're added.
+	Records []sstableSpecRecord `json:"records"`
+}
+
+// sstableSpecRecord is a point record or range deletion of an sstableSpec.
+type sstableSpecRecord struct {
+	Key  string `json:"key"`
+	Seq  uint64 `json:"seq"`
+	Kind string `json:"kind"`
+	// Value is the value of a point record.
+	Value string `json:"value"`
+	// End is the exclusive end key of a range deletion.
+	End string `json:"end"`
+}
+
+var sstableSpecTableFormats = map[string]sstable.TableFormat{
+	"LevelDB":   sstable.TableFormatLevelDB,
+	"RocksDBv2": sstable.TableFormatRocksDBv2,
+	"Pebblev1":  sstable.TableFormatPebblev1,
+	"Pebblev2":  sstable.TableFormatPebblev2,
+	"Pebblev3":  sstable.TableFormatPebblev3,
+	"Pebblev4":  sstable.TableFormatPebblev4,
+}
+
+// sstableSpecKinds are the kinds of the records of an sstableSpec. Range keys
+// aren't supported.
+var sstableSpecKinds = map[string]base.InternalKeyKind{
+	"SET":        base.InternalKeyKindSet,
+	"SETWITHDEL": base.InternalKeyKindSetWithDelete,
+	"MERGE":      base.InternalKeyKindMerge,
+	"DEL":        base.InternalKeyKindDelete,
+	"DELSIZED":   base.InternalKeyKindDeleteSized,
+	"SINGLEDEL":  base.InternalKeyKindSingleDelete,
+	"RANGEDEL":   base.InternalKeyKindRangeDelete,
+}
+
+// readSSTableSpec decodes the sstableSpec read from r.
+func readSSTableSpec(r io.Reader) (*sstableSpec, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	spec := &sstableSpec{}
+	if err := dec.Decode(spec); err != nil {
+		return nil, errors.Wrap(err, "decoding sstable spec")
+	}
+	return spec, nil
+}
+
+// writeSSTableSpec writes the sstable described by spec to path.
+func writeSSTableSpec(
+	fs vfs.FS, path string, spec *sstableSpec, opts sstable.WriterOptions,
+) (err error) {
+	if spec.TableFormat != "" {
+		var ok bool
+		if opts.TableFormat, ok = sstableSpecTableFormats[spec.TableFormat]; !ok {
+			return errors.Errorf("unknown table format %q", errors.Safe(spec.TableFormat))
+		}
+	}
+	opts.BlockSize = spec.BlockSize
+	opts.IndexBlockSize = spec.IndexBlockSize
+	opts.Unsafe.DisableKeyOrderChecks = spec.DisableKeyOrderChecks
+
+	f, err := fs.Create(path)
+	if err != nil {
+		return err
+	}
+	w := sstable.NewWriter(objstorageprovider.NewFileWritable(f), opts)
+	defer func() {
+		if w != nil {
+			err = errors.CombineErrors(err, w.Close())
+		}
+	}()
+	for i, r := range spec.Records {
+		kind, ok := sstableSpecKinds[r.Kind]
+		if !ok {
+			return errors.Errorf("record %d: unknown kind %q", i, errors.Safe(r.Kind))
+		}
+		value := []byte(r.Value)
+		if kind == base.InternalKeyKindRangeDelete {
+			value = []byte(r.End)
+		}
+		if err := w.Add(base.MakeInternalKey([]byte(r.Key), r.Seq, kind), value); err != nil {
+			return errors.Wrapf(err, "record %d", i)
+		}
+	}
+	err, w = w.Close(), nil
+	return err
+}
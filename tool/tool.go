@@ -26,6 +26,8 @@ type Merger = base.Merger
 // T is the container for all of the introspection tools.
 type T struct {
 	Commands        []*cobra.Command
+	bench           *benchT
+	blob            *blobT
 	db              *dbT
 	find            *findT
 	lsm             *lsmT
@@ -33,6 +35,7 @@ type T struct {
 	remotecat       *remoteCatalogT
 	sstable         *sstableT
 	wal             *walT
+	encryption      encryption
 	opts            pebble.Options
 	comparers       sstable.Comparers
 	mergers         sstable.Mergers
@@ -130,7 +133,9 @@ func New(opts ...Option) *T {
 		opt(t)
 	}
 
+	t.blob = newBlob(&t.opts, t.comparers, t.defaultComparer)
 	t.db = newDB(&t.opts, t.comparers, t.mergers, t.openErrEnhancer, t.openOptions)
+	t.bench = newBench(t.db)
 	t.find = newFind(&t.opts, t.comparers, t.defaultComparer, t.mergers)
 	t.lsm = newLSM(&t.opts, t.comparers)
 	t.manifest = newManifest(&t.opts, t.comparers)
@@ -138,6 +143,8 @@ func New(opts ...Option) *T {
 	t.sstable = newSSTable(&t.opts, t.comparers, t.mergers)
 	t.wal = newWAL(&t.opts, t.comparers, t.defaultComparer)
 	t.Commands = []*cobra.Command{
+		t.bench.Root,
+		t.blob.Root,
 		t.db.Root,
 		t.find.Root,
 		t.lsm.Root,
@@ -146,6 +153,10 @@ func New(opts ...Option) *T {
 		t.sstable.Root,
 		t.wal.Root,
 	}
+	t.encryption = encryption{opts: &t.opts, fs: t.opts.FS}
+	for _, cmd := range t.Commands {
+		t.encryption.registerFlags(cmd)
+	}
 	return t
 }
 
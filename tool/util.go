@@ -50,6 +50,75 @@ func (k *key) Set(v string) error {
 	return nil
 }
 
+// keyRange is a user key range [start, end).
+type keyRange struct {
+	start, end key
+}
+
+// keyRanges is a flag that may be repeated to specify multiple key ranges,
+// each in the form "<start>,<end>" where the keys use the syntax accepted by
+// key.Set.
+type keyRanges []keyRange
+
+func (r *keyRanges) String() string {
+	var buf strings.Builder
+	for i := range *r {
+		if i > 0 {
+			buf.WriteString(" ")
+		}
+		fmt.Fprintf(&buf, "%s,%s", (*r)[i].start, (*r)[i].end)
+	}
+	return buf.String()
+}
+
+func (r *keyRanges) Type() string {
+	return "range"
+}
+
+func (r *keyRanges) Set(v string) error {
+	start, end, ok := strings.Cut(v, ",")
+	if !ok {
+		return errors.Errorf("invalid range %q: expected <start>,<end>", v)
+	}
+	var kr keyRange
+	if err := kr.start.Set(start); err != nil {
+		return err
+	}
+	if err := kr.end.Set(end); err != nil {
+		return err
+	}
+	*r = append(*r, kr)
+	return nil
+}
+
+// keys is a flag that may be repeated to specify multiple keys, using the
+// syntax accepted by key.Set.
+type keys []key
+
+func (k *keys) String() string {
+	var buf strings.Builder
+	for i := range *k {
+		if i > 0 {
+			buf.WriteString(" ")
+		}
+		buf.WriteString((*k)[i].String())
+	}
+	return buf.String()
+}
+
+func (k *keys) Type() string {
+	return "key"
+}
+
+func (k *keys) Set(v string) error {
+	var kk key
+	if err := kk.Set(v); err != nil {
+		return err
+	}
+	*k = append(*k, kk)
+	return nil
+}
+
 type keyFormatter struct {
 	spec      string
 	fn        base.FormatKey
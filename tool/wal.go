@@ -11,6 +11,7 @@ import (
 	"io"
 
 	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/batchrepr"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/rangekey"
 	"github.com/cockroachdb/pebble/record"
@@ -31,12 +32,16 @@ type walT struct {
 
 	defaultComparer string
 	comparers       sstable.Comparers
+	remote          remoteFiles
 	verbose         bool
+	salvage         bool
+	salvageDir      string
 }
 
 func newWAL(opts *pebble.Options, comparers sstable.Comparers, defaultComparer string) *walT {
 	w := &walT{
-		opts: opts,
+		opts:   opts,
+		remote: remoteFiles{opts: opts},
 	}
 	w.fmtKey.mustSet("quoted")
 	w.fmtValue.mustSet("size")
@@ -44,14 +49,25 @@ func newWAL(opts *pebble.Options, comparers sstable.Comparers, defaultComparer s
 	w.defaultComparer = defaultComparer
 
 	w.Root = &cobra.Command{
-		Use:   "wal",
-		Short: "WAL introspection tools",
+		Use:               "wal",
+		Short:             "WAL introspection tools",
+		PersistentPostRun: func(*cobra.Command, []string) { w.remote.close() },
 	}
 	w.Dump = &cobra.Command{
 		Use:   "dump <wal-files>",
 		Short: "print WAL contents",
 		Long: `
-Print the contents of the WAL files.
+Print the contents of the WAL files. WAL files residing in remote storage may be
+specified as <locator>://<object-name>, resolved through the storage configured
+through ConfigureSharedStorage or described by the settings file specified with
+--remote.
+
+Reading a WAL file normally stops at the first chunk that fails its checksum,
+which is commonly a stale or zeroed chunk following the last record due to WAL
+recycling and preallocation. With --salvage, damaged regions are skipped over,
+printing their byte ranges, and the intact records following them are printed.
+With --salvage-dir, the intact records of each WAL file are also written to a
+WAL file of the same name within the directory, excising the damage.
 `,
 		Args: cobra.MinimumNArgs(1),
 		Run:  w.runDump,
@@ -59,11 +75,16 @@ Print the contents of the WAL files.
 
 	w.Root.AddCommand(w.Dump)
 	w.Root.PersistentFlags().BoolVarP(&w.verbose, "verbose", "v", false, "verbose output")
+	w.remote.registerFlags(w.Root)
 
 	w.Dump.Flags().Var(
 		&w.fmtKey, "key", "key formatter")
 	w.Dump.Flags().Var(
 		&w.fmtValue, "value", "value formatter")
+	w.Dump.Flags().BoolVar(
+		&w.salvage, "salvage", false, "skip over damaged regions, printing their byte ranges")
+	w.Dump.Flags().StringVar(
+		&w.salvageDir, "salvage-dir", "", "write the intact records of each WAL to a WAL of the same name within the `directory` (implies --salvage)")
 	return w
 }
 
@@ -78,22 +99,38 @@ func (w *walT) runDump(cmd *cobra.Command, args []string) {
 			// necessary in case WAL recycling was used (which it is usually is). If
 			// we can't parse the filename or it isn't a log file, we'll plow ahead
 			// anyways (which will likely fail when we try to read the file).
-			fileNum, _, ok := wal.ParseLogFilename(arg)
+			fileNum, _, ok := wal.ParseLogFilename(remoteBaseName(arg))
 			if !ok {
 				fileNum = 0
 			}
 
-			f, err := w.opts.FS.Open(arg)
-			if err != nil {
-				fmt.Fprintf(stderr, "%s\n", err)
-				return
+			var f io.Reader
+			if readable, ok, err := w.remote.open(arg); ok {
+				if err != nil {
+					fmt.Fprintf(stderr, "%s\n", err)
+					return
+				}
+				defer readable.Close()
+				f = &readableReader{r: readable}
+			} else {
+				file, err := w.opts.FS.Open(arg)
+				if err != nil {
+					fmt.Fprintf(stderr, "%s\n", err)
+					return
+				}
+				defer file.Close()
+				f = file
 			}
-			defer f.Close()
 
 			fmt.Fprintf(stdout, "%s\n", arg)
 
-			var b pebble.Batch
+			if w.salvage || w.salvageDir != "" {
+				w.dumpSalvaged(stdout, stderr, arg, f, base.DiskFileNum(fileNum))
+				return
+			}
+
 			var buf bytes.Buffer
+			var decompressed []byte
 			rr := record.NewReader(f, base.DiskFileNum(fileNum))
 			for {
 				offset := rr.Offset()
@@ -117,56 +154,144 @@ func (w *walT) runDump(cmd *cobra.Command, args []string) {
 					}
 					return
 				}
-
-				b = pebble.Batch{}
-				if err := b.SetRepr(buf.Bytes()); err != nil {
-					fmt.Fprintf(stdout, "corrupt batch within log file %q: %v", arg, err)
+				if !w.dumpBatch(stdout, arg, offset, buf.Bytes(), &decompressed) {
 					return
 				}
-				fmt.Fprintf(stdout, "%d(%d) seq=%d count=%d\n",
-					offset, len(b.Repr()), b.SeqNum(), b.Count())
-				for r, idx := b.Reader(), 0; ; idx++ {
-					kind, ukey, value, ok, err := r.Next()
-					if !ok {
-						if err != nil {
-							fmt.Fprintf(stdout, "corrupt batch within log file %q: %v", arg, err)
-						}
-						break
-					}
-					fmt.Fprintf(stdout, "    %s(", kind)
-					switch kind {
-					case base.InternalKeyKindDelete:
-						fmt.Fprintf(stdout, "%s", w.fmtKey.fn(ukey))
-					case base.InternalKeyKindSet:
-						fmt.Fprintf(stdout, "%s,%s", w.fmtKey.fn(ukey), w.fmtValue.fn(ukey, value))
-					case base.InternalKeyKindMerge:
-						fmt.Fprintf(stdout, "%s,%s", w.fmtKey.fn(ukey), w.fmtValue.fn(ukey, value))
-					case base.InternalKeyKindLogData:
-						fmt.Fprintf(stdout, "<%d>", len(value))
-					case base.InternalKeyKindIngestSST:
-						fileNum, _ := binary.Uvarint(ukey)
-						fmt.Fprintf(stdout, "%s", base.FileNum(fileNum))
-					case base.InternalKeyKindSingleDelete:
-						fmt.Fprintf(stdout, "%s", w.fmtKey.fn(ukey))
-					case base.InternalKeyKindSetWithDelete:
-						fmt.Fprintf(stdout, "%s", w.fmtKey.fn(ukey))
-					case base.InternalKeyKindRangeDelete:
-						fmt.Fprintf(stdout, "%s,%s", w.fmtKey.fn(ukey), w.fmtKey.fn(value))
-					case base.InternalKeyKindRangeKeySet, base.InternalKeyKindRangeKeyUnset, base.InternalKeyKindRangeKeyDelete:
-						ik := base.MakeInternalKey(ukey, b.SeqNum()+uint64(idx), kind)
-						s, err := rangekey.Decode(ik, value, nil)
-						if err != nil {
-							fmt.Fprintf(stdout, "%s: error decoding %s", w.fmtKey.fn(ukey), err)
-						} else {
-							fmt.Fprintf(stdout, "%s", s.Pretty(w.fmtKey.fn))
-						}
-					case base.InternalKeyKindDeleteSized:
-						v, _ := binary.Uvarint(value)
-						fmt.Fprintf(stdout, "%s,%d", w.fmtKey.fn(ukey), v)
-					}
-					fmt.Fprintf(stdout, ")\n")
-				}
 			}
 		}()
 	}
 }
+
+// dumpBatch prints the batch held by the WAL record at the given offset,
+// returning false if the batch is corrupt.
+func (w *walT) dumpBatch(
+	stdout io.Writer, arg string, offset int64, repr []byte, decompressed *[]byte,
+) bool {
+	// Compressed batches are decompressed transparently. The size of the
+	// compressed record is printed alongside the batch.
+	var compressedSize string
+	if batchrepr.IsCompressed(repr) {
+		var err error
+		*decompressed, err = batchrepr.Decompress((*decompressed)[:0], repr)
+		if err != nil {
+			fmt.Fprintf(stdout, "corrupt batch within log file %q: %v", arg, err)
+			return false
+		}
+		compressedSize = fmt.Sprintf(" compressed=%d", len(repr))
+		repr = *decompressed
+	}
+
+	var b pebble.Batch
+	if err := b.SetRepr(repr); err != nil {
+		fmt.Fprintf(stdout, "corrupt batch within log file %q: %v", arg, err)
+		return false
+	}
+	fmt.Fprintf(stdout, "%d(%d) seq=%d count=%d%s\n",
+		offset, len(b.Repr()), b.SeqNum(), b.Count(), compressedSize)
+	for r, idx := b.Reader(), 0; ; idx++ {
+		kind, ukey, value, ok, err := r.Next()
+		if !ok {
+			if err != nil {
+				fmt.Fprintf(stdout, "corrupt batch within log file %q: %v", arg, err)
+			}
+			return true
+		}
+		fmt.Fprintf(stdout, "    %s(", kind)
+		switch kind {
+		case base.InternalKeyKindDelete:
+			fmt.Fprintf(stdout, "%s", w.fmtKey.fn(ukey))
+		case base.InternalKeyKindSet:
+			fmt.Fprintf(stdout, "%s,%s", w.fmtKey.fn(ukey), w.fmtValue.fn(ukey, value))
+		case base.InternalKeyKindMerge:
+			fmt.Fprintf(stdout, "%s,%s", w.fmtKey.fn(ukey), w.fmtValue.fn(ukey, value))
+		case base.InternalKeyKindLogData:
+			fmt.Fprintf(stdout, "<%d>", len(value))
+		case base.InternalKeyKindIngestSST:
+			fileNum, _ := binary.Uvarint(ukey)
+			fmt.Fprintf(stdout, "%s", base.FileNum(fileNum))
+		case base.InternalKeyKindSingleDelete:
+			fmt.Fprintf(stdout, "%s", w.fmtKey.fn(ukey))
+		case base.InternalKeyKindSetWithDelete:
+			fmt.Fprintf(stdout, "%s", w.fmtKey.fn(ukey))
+		case base.InternalKeyKindRangeDelete:
+			fmt.Fprintf(stdout, "%s,%s", w.fmtKey.fn(ukey), w.fmtKey.fn(value))
+		case base.InternalKeyKindRangeKeySet, base.InternalKeyKindRangeKeyUnset, base.InternalKeyKindRangeKeyDelete:
+			ik := base.MakeInternalKey(ukey, b.SeqNum()+uint64(idx), kind)
+			s, err := rangekey.Decode(ik, value, nil)
+			if err != nil {
+				fmt.Fprintf(stdout, "%s: error decoding %s", w.fmtKey.fn(ukey), err)
+			} else {
+				fmt.Fprintf(stdout, "%s", s.Pretty(w.fmtKey.fn))
+			}
+		case base.InternalKeyKindDeleteSized:
+			v, _ := binary.Uvarint(value)
+			fmt.Fprintf(stdout, "%s,%d", w.fmtKey.fn(ukey), v)
+		}
+		fmt.Fprintf(stdout, ")\n")
+	}
+}
+
+// dumpSalvaged prints the batches held by the intact records of the WAL read
+// from f, scanning past any damage and printing the damaged byte ranges. If
+// --salvage-dir is specified, the intact records are also written to a WAL of
+// the same name within it.
+func (w *walT) dumpSalvaged(
+	stdout, stderr io.Writer, arg string, f io.Reader, logNum base.DiskFileNum,
+) {
+	var rw *record.Writer
+	if w.salvageDir != "" {
+		if err := w.opts.FS.MkdirAll(w.salvageDir, 0755); err != nil {
+			fmt.Fprintf(stderr, "%s\n", err)
+			return
+		}
+		path := w.opts.FS.PathJoin(w.salvageDir, w.opts.FS.PathBase(remoteBaseName(arg)))
+		out, err := w.opts.FS.Create(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s\n", err)
+			return
+		}
+		defer func() {
+			if err := rw.Close(); err != nil {
+				fmt.Fprintf(stderr, "%s\n", err)
+			}
+			if err := out.Sync(); err != nil {
+				fmt.Fprintf(stderr, "%s\n", err)
+			}
+			if err := out.Close(); err != nil {
+				fmt.Fprintf(stderr, "%s\n", err)
+			}
+			fmt.Fprintf(stdout, "salvaged WAL written to %s\n", path)
+		}()
+		rw = record.NewWriter(out)
+	}
+
+	var records int
+	var damagedBytes int64
+	var decompressed []byte
+	sr := record.NewSalvageReader(f, logNum)
+	for {
+		numDamaged := len(sr.Damage())
+		offset, rec, err := sr.Next()
+		// Print the damage skipped over before the record, if any.
+		for _, d := range sr.Damage()[numDamaged:] {
+			fmt.Fprintf(stdout, "DAMAGE %s\n", d)
+			damagedBytes += d.End - d.Start
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			fmt.Fprintf(stdout, "%s\n", err)
+			return
+		}
+		records++
+		if rw != nil {
+			if _, err := rw.WriteRecord(rec); err != nil {
+				fmt.Fprintf(stderr, "%s\n", err)
+				return
+			}
+		}
+		w.dumpBatch(stdout, arg, offset, rec, &decompressed)
+	}
+	fmt.Fprintf(stdout, "salvaged %d records, skipping %d damaged ranges (%d bytes)\n",
+		records, len(sr.Damage()), damagedBytes)
+}
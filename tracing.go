@@ -0,0 +1,114 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import "context"
+
+// Tracer traces individual operations, allowing their latency to be
+// attributed, e.g. by emitting spans to a distributed tracing system such as
+// OpenTelemetry. See Options.Tracer.
+type Tracer interface {
+	// StartSpan is invoked when an operation begins, with the context provided
+	// to the operation (context.Background() for operations that don't accept
+	// a context, and for flushes and compactions). The returned context is used
+	// for the remainder of the operation, and is provided to
+	// Options.LoggerAndTracer for any events traced during the operation. The
+	// returned span is finished when the operation completes.
+	StartSpan(ctx context.Context, op TraceOp) (context.Context, TraceSpan)
+}
+
+// TraceSpan is a span started by Tracer.StartSpan.
+type TraceSpan interface {
+	// Finish is invoked exactly once when the span's operation completes. It
+	// may be invoked while the DB's mutex is held, and must not call into the
+	// DB.
+	Finish(info TraceInfo)
+}
+
+// TraceOp identifies the kind of operation traced by a TraceSpan.
+type TraceOp int8
+
+const (
+	// TraceOpGet is a Get of a single key through a DB, Snapshot or indexed
+	// Batch.
+	TraceOpGet TraceOp = iota
+	// TraceOpCommit is the commit of a batch, including through DB.Set and
+	// similar single key writes.
+	TraceOpCommit
+	// TraceOpIterator is the lifetime of an Iterator, from its construction
+	// until it's closed. Iterators that only read a batch are not traced.
+	TraceOpIterator
+	// TraceOpFlush is a flush of memtables.
+	TraceOpFlush
+	// TraceOpCompaction is a compaction.
+	TraceOpCompaction
+)
+
+// String implements fmt.Stringer.
+func (op TraceOp) String() string {
+	switch op {
+	case TraceOpGet:
+		return "get"
+	case TraceOpCommit:
+		return "commit"
+	case TraceOpIterator:
+		return "iterator"
+	case TraceOpFlush:
+		return "flush"
+	case TraceOpCompaction:
+		return "compaction"
+	default:
+		return "unknown"
+	}
+}
+
+// TraceInfo describes the work performed by a traced operation.
+type TraceInfo struct {
+	// BlockReads is the number of sstable blocks loaded by a Get or Iterator,
+	// including blocks found in the block cache.
+	BlockReads uint64
+	// BlockCacheHits is the subset of BlockReads that were found in the block
+	// cache.
+	BlockCacheHits uint64
+	// BytesRead is the number of bytes read. For a Get or Iterator, this is the
+	// size of the sstable blocks loaded. For a flush or compaction, it's the
+	// size of the inputs.
+	BytesRead uint64
+	// BytesWritten is the number of bytes written. For a commit, this is the
+	// size of the batch. For a flush or compaction, it's the size of the
+	// output sstables.
+	BytesWritten uint64
+	// Err is the error encountered by the operation, if any.
+	Err error
+}
+
+// makeReadTraceInfo returns the TraceInfo for a read that accumulated the
+// provided stats.
+func makeReadTraceInfo(stats *InternalIteratorStats, err error) TraceInfo {
+	return TraceInfo{
+		BlockReads:     stats.BlockReads,
+		BlockCacheHits: stats.BlockReadsInCache,
+		BytesRead:      stats.BlockBytes,
+		Err:            err,
+	}
+}
+
+// startTraceSpan starts the span tracing the iterator's lifetime, returning the
+// context to be used by the iterator. The span is finished when the iterator
+// is closed.
+func (i *Iterator) startTraceSpan(t Tracer) context.Context {
+	i.tracer = t
+	i.ctx, i.traceSpan = t.StartSpan(i.ctx, TraceOpIterator)
+	return i.ctx
+}
+
+// makeTraceInfo returns the TraceInfo for the flush or compaction.
+func (c *compaction) makeTraceInfo(err error) TraceInfo {
+	info := TraceInfo{BytesRead: c.bytesIterated, Err: err}
+	for _, m := range c.metrics {
+		info.BytesWritten += m.BytesFlushed + m.BytesCompacted
+	}
+	return info
+}
@@ -0,0 +1,139 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingTraceSpan struct {
+	tracer *recordingTracer
+	op     TraceOp
+	ctx    context.Context
+}
+
+func (s *recordingTraceSpan) Finish(info TraceInfo) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.tracer.mu.finished = append(s.tracer.mu.finished, finishedTraceSpan{op: s.op, ctx: s.ctx, info: info})
+}
+
+type finishedTraceSpan struct {
+	op   TraceOp
+	ctx  context.Context
+	info TraceInfo
+}
+
+type recordingTracer struct {
+	mu struct {
+		sync.Mutex
+		finished []finishedTraceSpan
+	}
+}
+
+func (t *recordingTracer) StartSpan(ctx context.Context, op TraceOp) (context.Context, TraceSpan) {
+	return ctx, &recordingTraceSpan{tracer: t, op: op, ctx: ctx}
+}
+
+// take returns and clears the finished spans with the given op.
+func (t *recordingTracer) take(op TraceOp) []finishedTraceSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var spans, rest []finishedTraceSpan
+	for _, s := range t.mu.finished {
+		if s.op == op {
+			spans = append(spans, s)
+		} else {
+			rest = append(rest, s)
+		}
+	}
+	t.mu.finished = rest
+	return spans
+}
+
+func TestTracer(t *testing.T) {
+	tracer := &recordingTracer{}
+	d, err := Open("", &Options{
+		FS:                          vfs.NewMem(),
+		Tracer:                      tracer,
+		DisableAutomaticCompactions: true,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "op")
+
+	b := d.NewBatch()
+	require.NoError(t, b.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, b.CommitWithContext(ctx, nil))
+	require.NoError(t, d.Set([]byte("b"), []byte("2"), nil))
+	commits := tracer.take(TraceOpCommit)
+	require.Len(t, commits, 2)
+	require.Equal(t, "op", commits[0].ctx.Value(ctxKey{}))
+	require.Equal(t, uint64(len(b.Repr())), commits[0].info.BytesWritten)
+	require.NoError(t, commits[0].info.Err)
+
+	require.NoError(t, d.Flush())
+	flushes := tracer.take(TraceOpFlush)
+	require.Len(t, flushes, 1)
+	require.NotZero(t, flushes[0].info.BytesRead)
+	require.NotZero(t, flushes[0].info.BytesWritten)
+
+	// The first Get loads the blocks into the cache, and the second finds them
+	// there.
+	for i := 0; i < 2; i++ {
+		v, closer, err := d.GetWithContext(ctx, []byte("a"))
+		require.NoError(t, err)
+		require.Equal(t, []byte("1"), v)
+		require.NoError(t, closer.Close())
+	}
+	gets := tracer.take(TraceOpGet)
+	require.Len(t, gets, 2)
+	require.Equal(t, "op", gets[0].ctx.Value(ctxKey{}))
+	require.NotZero(t, gets[0].info.BlockReads)
+	require.NotZero(t, gets[0].info.BytesRead)
+	require.Less(t, gets[0].info.BlockCacheHits, gets[0].info.BlockReads)
+	require.Equal(t, gets[1].info.BlockReads, gets[1].info.BlockCacheHits)
+
+	iter, err := d.NewIterWithContext(ctx, nil)
+	require.NoError(t, err)
+	var n int
+	for valid := iter.First(); valid; valid = iter.Next() {
+		n++
+	}
+	require.Equal(t, 2, n)
+	clone, err := iter.Clone(CloneOptions{})
+	require.NoError(t, err)
+	require.Empty(t, tracer.take(TraceOpIterator))
+	require.NoError(t, clone.Close())
+	require.NoError(t, iter.Close())
+	iters := tracer.take(TraceOpIterator)
+	require.Len(t, iters, 2)
+	require.Equal(t, "op", iters[1].ctx.Value(ctxKey{}))
+	require.NotZero(t, iters[1].info.BlockReads)
+
+	// Iterators that only read a batch are not traced.
+	b = d.NewIndexedBatch()
+	batchIter, err := b.NewBatchOnlyIter(ctx, nil)
+	require.NoError(t, err)
+	require.NoError(t, batchIter.Close())
+	require.NoError(t, b.Close())
+	require.Empty(t, tracer.take(TraceOpIterator))
+
+	// Write an overlapping sstable, so that the compaction isn't a move.
+	require.NoError(t, d.Set([]byte("a"), []byte("3"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Compact([]byte("a"), []byte("c"), false))
+	compactions := tracer.take(TraceOpCompaction)
+	require.Len(t, compactions, 1)
+	require.NotZero(t, compactions[0].info.BytesRead)
+	require.NotZero(t, compactions[0].info.BytesWritten)
+}
@@ -9,6 +9,7 @@ import (
 	"io"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
@@ -86,6 +87,11 @@ type versionSet struct {
 	// still referenced by an inuse iterator.
 	zombieTables map[base.DiskFileNum]tableInfo
 
+	// blobFiles tracks the blob files referenced by live backings. Blob files
+	// that are no longer referenced are added to obsoleteBlobFiles.
+	blobFiles         blobFileRefs
+	obsoleteBlobFiles []fileInfo
+
 	// virtualBackings contains information about the FileBackings which support
 	// virtual sstables in the latest version. It is mainly used to determine when
 	// a backing is no longer in use by the tables in the latest version; this is
@@ -127,6 +133,15 @@ type versionSet struct {
 	writerCond sync.Cond
 	// State for deciding when to write a snapshot. Protected by mu.
 	rotationHelper record.RotationHelper
+	// manifestEdits is the number of version edits written to the current
+	// manifest following its snapshot, and manifestCreatedAt is the time at
+	// which the current manifest was created. They're used to enforce
+	// Options.MaxManifestEdits and Options.MaxManifestAge, and are protected by
+	// the manifest lock (see logLock).
+	manifestEdits     int
+	manifestCreatedAt time.Time
+	// Normally equal to time.Now() but may be overridden in tests.
+	timeNow func() time.Time
 }
 
 type tableInfo struct {
@@ -153,10 +168,12 @@ func (vs *versionSet) init(
 	vs.versions.Init(mu)
 	vs.obsoleteFn = vs.addObsoleteLocked
 	vs.zombieTables = make(map[base.DiskFileNum]tableInfo)
+	vs.blobFiles.init()
 	vs.virtualBackings = manifest.MakeVirtualBackings()
 	vs.nextFileNum = 1
 	vs.manifestMarker = marker
 	vs.getFormatMajorVersion = getFMV
+	vs.timeNow = time.Now
 }
 
 // create creates a version set for a fresh DB.
@@ -178,7 +195,7 @@ func (vs *versionSet) create(
 	// Note that a "snapshot" version edit is written to the manifest when it is
 	// created.
 	vs.manifestFileNum = vs.getNextDiskFileNum()
-	err = vs.createManifest(vs.dirname, vs.manifestFileNum, vs.minUnflushedLogNum, vs.nextFileNum, nil /* virtualBackings */)
+	err = vs.createManifest(vs.dirname, vs.manifestFileNum, vs.minUnflushedLogNum, vs.nextFileNum, 0 /* lastSeqNum */, nil /* virtualBackings */)
 	if err == nil {
 		if err = vs.manifest.Flush(); err != nil {
 			vs.opts.Logger.Fatalf("MANIFEST flush failed: %v", err)
@@ -315,6 +332,7 @@ func (vs *versionSet) load(
 			if m.Virtual {
 				vs.virtualBackings.AddTable(m)
 			}
+			vs.blobFiles.addTable(m)
 		}
 	}
 
@@ -515,6 +533,13 @@ func (vs *versionSet) logAndApply(
 	vs.rotationHelper.AddRecord(int64(len(ve.DeletedFiles) + len(ve.NewFiles)))
 	sizeExceeded := vs.manifest.Size() >= vs.opts.MaxManifestFileSize
 	requireRotation := forceRotation || vs.manifest == nil
+	// The edit count and age limits are enforced regardless of the size of the
+	// manifest, so that the number of edits replayed when reopening the DB is
+	// bounded even if the edits are small.
+	if !requireRotation {
+		requireRotation = (vs.opts.MaxManifestEdits > 0 && vs.manifestEdits >= vs.opts.MaxManifestEdits) ||
+			(vs.opts.MaxManifestAge > 0 && vs.timeNow().Sub(vs.manifestCreatedAt) >= vs.opts.MaxManifestAge)
+	}
 
 	var nextSnapshotFilecount int64
 	for i := range vs.metrics.Levels {
@@ -544,6 +569,9 @@ func (vs *versionSet) logAndApply(
 	// Note: this call populates ve.RemovedBackingTables.
 	zombieBackings, removedVirtualBackings, localLiveSizeDelta :=
 		getZombiesAndUpdateVirtualBackings(ve, &vs.virtualBackings, vs.provider)
+	for _, nf := range ve.NewFiles {
+		vs.blobFiles.addTable(nf.Meta)
+	}
 
 	if err := func() error {
 		vs.mu.Unlock()
@@ -565,7 +593,7 @@ func (vs *versionSet) logAndApply(
 		}
 
 		if newManifestFileNum != 0 {
-			if err := vs.createManifest(vs.dirname, newManifestFileNum, minUnflushedLogNum, nextFileNum, newManifestVirtualBackings); err != nil {
+			if err := vs.createManifest(vs.dirname, newManifestFileNum, minUnflushedLogNum, nextFileNum, 0 /* lastSeqNum */, newManifestVirtualBackings); err != nil {
 				vs.opts.EventListener.ManifestCreated(ManifestCreateInfo{
 					JobID:   int(jobID),
 					Path:    base.MakeFilepath(vs.fs, vs.dirname, fileTypeManifest, newManifestFileNum),
@@ -595,6 +623,7 @@ func (vs *versionSet) logAndApply(
 		if err := vs.manifestFile.Sync(); err != nil {
 			return errors.Wrap(err, "MANIFEST sync failed")
 		}
+		vs.manifestEdits++
 		if newManifestFileNum != 0 {
 			// NB: Move() is responsible for syncing the data directory.
 			if err := vs.manifestMarker.Move(base.MakeFilename(fileTypeManifest, newManifestFileNum)); err != nil {
@@ -845,6 +874,14 @@ func (vs *versionSet) incrementCompactions(
 	case compactionKindRewrite:
 		vs.metrics.Compact.Count++
 		vs.metrics.Compact.RewriteCount++
+
+	case compactionKindExpiry:
+		vs.metrics.Compact.Count++
+		vs.metrics.Compact.ExpiryCount++
+
+	case compactionKindTombstoneDensity:
+		vs.metrics.Compact.Count++
+		vs.metrics.Compact.TombstoneDensityCount++
 	}
 	if len(extraLevels) > 0 {
 		vs.metrics.Compact.MultiLevelCount++
@@ -855,11 +892,13 @@ func (vs *versionSet) incrementCompactionBytes(numBytes int64) {
 	vs.atomicInProgressBytes.Add(numBytes)
 }
 
-// createManifest creates a manifest file that contains a snapshot of vs.
+// createManifest creates a manifest file that contains a snapshot of vs. The
+// snapshot includes lastSeqNum if non-zero.
 func (vs *versionSet) createManifest(
 	dirname string,
 	fileNum, minUnflushedLogNum base.DiskFileNum,
 	nextFileNum uint64,
+	lastSeqNum uint64,
 	virtualBackings []*fileBacking,
 ) (err error) {
 	var (
@@ -902,12 +941,14 @@ func (vs *versionSet) createManifest(
 
 	// When creating a version snapshot for an existing DB, this snapshot VersionEdit will be
 	// immediately followed by another VersionEdit (being written in logAndApply()). That
-	// VersionEdit always contains a LastSeqNum, so we don't need to include that in the snapshot.
+	// VersionEdit always contains a LastSeqNum, so we don't need to include that in the snapshot
+	// (CompactManifest, which writes no such VersionEdit, provides lastSeqNum).
 	// But it does not necessarily include MinUnflushedLogNum, NextFileNum, so we initialize those
 	// using the corresponding fields in the versionSet (which came from the latest preceding
 	// VersionEdit that had those fields).
 	snapshot.MinUnflushedLogNum = minUnflushedLogNum
 	snapshot.NextFileNum = nextFileNum
+	snapshot.LastSeqNum = lastSeqNum
 
 	w, err1 := manifest.Next()
 	if err1 != nil {
@@ -930,6 +971,8 @@ func (vs *versionSet) createManifest(
 
 	vs.manifest, manifest = manifest, nil
 	vs.manifestFile, manifestFile = manifestFile, nil
+	vs.manifestEdits = 0
+	vs.manifestCreatedAt = vs.timeNow()
 	return nil
 }
 
@@ -1048,6 +1091,14 @@ func (vs *versionSet) addObsoleteLocked(obsolete []*fileBacking) {
 
 	vs.obsoleteTables = append(vs.obsoleteTables, obsoleteFileInfo...)
 	vs.updateObsoleteTableMetricsLocked()
+
+	var obsoleteBlobFiles []base.DiskFileNum
+	for _, bs := range obsolete {
+		obsoleteBlobFiles = vs.blobFiles.removeBacking(bs.DiskFileNum, obsoleteBlobFiles)
+	}
+	for _, fileNum := range obsoleteBlobFiles {
+		vs.obsoleteBlobFiles = append(vs.obsoleteBlobFiles, fileInfo{FileNum: fileNum})
+	}
 }
 
 // addObsolete will acquire DB.mu, so DB.mu must not be held when this is
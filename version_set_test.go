@@ -14,6 +14,7 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/cockroachdb/datadriven"
 	"github.com/cockroachdb/pebble/internal/base"
@@ -317,3 +318,80 @@ func TestVersionSetSeqNums(t *testing.T) {
 	// logSeqNum is always one greater than the last assigned sequence number.
 	require.Equal(t, d.mu.versions.logSeqNum.Load(), lastSeqNum+1)
 }
+
+// countManifestEdits returns the current manifest of the DB and the number of
+// version edits it holds.
+func countManifestEdits(t *testing.T, fs vfs.FS, dirname string) (string, int) {
+	desc, err := Peek(dirname, fs)
+	require.NoError(t, err)
+	f, err := fs.Open(desc.ManifestFilename)
+	require.NoError(t, err)
+	defer f.Close()
+	rr := record.NewReader(f, 0 /* logNum */)
+	for n := 0; ; n++ {
+		_, err := rr.Next()
+		if err == io.EOF {
+			return desc.ManifestFilename, n
+		}
+		require.NoError(t, err)
+	}
+}
+
+func TestVersionSetRotationPolicies(t *testing.T) {
+	t.Run("edits", func(t *testing.T) {
+		mem := vfs.NewMem()
+		d, err := Open("", &Options{
+			FS:                          mem,
+			MaxManifestEdits:            3,
+			DisableAutomaticCompactions: true,
+			Logger:                      testLogger{t: t},
+		})
+		require.NoError(t, err)
+		defer d.Close()
+
+		manifests := make(map[string]bool)
+		for i := 0; i < 10; i++ {
+			require.NoError(t, d.Set([]byte(fmt.Sprint(i)), nil, nil))
+			require.NoError(t, d.Flush())
+			manifest, edits := countManifestEdits(t, mem, "")
+			// The snapshot, followed by up to MaxManifestEdits edits.
+			require.LessOrEqual(t, edits, 1+3)
+			manifests[manifest] = true
+		}
+		require.Greater(t, len(manifests), 2)
+	})
+
+	t.Run("age", func(t *testing.T) {
+		mem := vfs.NewMem()
+		d, err := Open("", &Options{
+			FS:                          mem,
+			MaxManifestAge:              time.Hour,
+			DisableAutomaticCompactions: true,
+			Logger:                      testLogger{t: t},
+		})
+		require.NoError(t, err)
+		defer d.Close()
+
+		now := time.Now()
+		d.mu.Lock()
+		d.mu.versions.timeNow = func() time.Time { return now }
+		d.mu.versions.manifestCreatedAt = now
+		d.mu.Unlock()
+		flush := func(key string) string {
+			require.NoError(t, d.Set([]byte(key), nil, nil))
+			require.NoError(t, d.Flush())
+			manifest, _ := countManifestEdits(t, mem, "")
+			return manifest
+		}
+
+		first := flush("a")
+		now = now.Add(30 * time.Minute)
+		require.Equal(t, first, flush("b"))
+		now = now.Add(30 * time.Minute)
+		second := flush("c")
+		require.NotEqual(t, first, second)
+		_, edits := countManifestEdits(t, mem, "")
+		require.Equal(t, 2, edits)
+		require.Equal(t, second, flush("d"))
+	})
+}
@@ -0,0 +1,589 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+// Package crashfs implements a vfs.FS for crash-consistency testing. An FS
+// stores files in memory and records the writes, syncs and directory
+// operations applied to it, so that it can produce the states the filesystem
+// may be left in by a crash, or power loss, at any point.
+//
+// A post-crash state holds everything made durable by a sync: the data of a
+// file written before a sync of the file, and the entries of a directory
+// created, removed or renamed before a sync of the directory. Unsynced
+// operations may or may not survive the crash: for each file, a prefix of the
+// unsynced writes survives, the last of which may be torn, and for each
+// directory, a prefix of the unsynced operations on its entries survives. A
+// rename within a directory is atomic, while a rename across directories may
+// survive in the source directory, the destination directory, both or neither.
+//
+// Runner runs a workload on an FS, and checks the invariants of post-crash
+// states at the crash points of the workload, e.g. by opening a DB on each of
+// the states.
+package crashfs
+
+import (
+	"io"
+	"math/rand"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// FS is a memory-backed vfs.FS recording the operations applied to it. Reads
+// observe all the operations applied, whether synced or not. An FS is safe for
+// concurrent use.
+//
+// Paths are interpreted relative to the root of the FS, as by vfs.MemFS: "db"
+// and "/db" name the same directory.
+type FS struct {
+	mu struct {
+		sync.Mutex
+		// mem holds the current state of the filesystem.
+		mem *vfs.MemFS
+		// root is the root directory, which can't be removed.
+		root *inode
+		// inodes are all the files and directories ever created.
+		inodes []*inode
+	}
+}
+
+var _ vfs.FS = (*FS)(nil)
+
+// inode is a file or directory, and its history since its creation.
+type inode struct {
+	isDir bool
+	// writes are the writes to the file, in order.
+	writes []fileWrite
+	// ops are the operations on the entries of the directory, in order.
+	ops []dirOp
+	// synced is the number of writes or ops that are durable.
+	synced int
+	// children are the current entries of the directory.
+	children map[string]*inode
+}
+
+type fileWrite struct {
+	offset int64
+	data   []byte
+}
+
+// dirOp is an atomic operation on the entries of a directory.
+type dirOp []dirEntry
+
+// dirEntry sets the entry name of a directory to ino, or removes it if ino is
+// nil.
+type dirEntry struct {
+	name string
+	ino  *inode
+}
+
+// New returns a new, empty FS.
+func New() *FS {
+	fs := &FS{}
+	fs.mu.mem = vfs.NewMem()
+	fs.mu.root = fs.newInodeLocked(true /* isDir */)
+	return fs
+}
+
+func (fs *FS) newInodeLocked(isDir bool) *inode {
+	n := &inode{isDir: isDir}
+	if isDir {
+		n.children = make(map[string]*inode)
+	}
+	fs.mu.inodes = append(fs.mu.inodes, n)
+	return n
+}
+
+// splitPath returns the cleaned path of the parent directory of name, relative
+// to the root, and the base name of name. The base name is empty if name is the
+// root.
+func splitPath(name string) (dir, base string) {
+	clean := strings.TrimPrefix(path.Clean("/"+name), "/")
+	if clean == "" {
+		return "", ""
+	}
+	dir, base = path.Split(clean)
+	return strings.TrimSuffix(dir, "/"), base
+}
+
+// lookupLocked returns the inode named name, or nil if it doesn't exist.
+func (fs *FS) lookupLocked(name string) *inode {
+	n := fs.mu.root
+	clean := strings.TrimPrefix(path.Clean("/"+name), "/")
+	if clean == "" {
+		return n
+	}
+	for _, frag := range strings.Split(clean, "/") {
+		if n == nil || !n.isDir {
+			return nil
+		}
+		n = n.children[frag]
+	}
+	return n
+}
+
+// applyLocked applies an operation on the entries of the directory.
+func (n *inode) applyLocked(op dirOp) {
+	for _, e := range op {
+		if e.ino == nil {
+			delete(n.children, e.name)
+		} else {
+			n.children[e.name] = e.ino
+		}
+	}
+	n.ops = append(n.ops, op)
+}
+
+// setLocked sets the entry named name to ino, or removes it if ino is nil.
+func (fs *FS) setLocked(name string, ino *inode) {
+	dirname, base := splitPath(name)
+	if dir := fs.lookupLocked(dirname); dir != nil && dir.isDir && base != "" {
+		dir.applyLocked(dirOp{{name: base, ino: ino}})
+	}
+}
+
+// Create implements vfs.FS.
+func (fs *FS) Create(name string) (vfs.File, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	f, err := fs.mu.mem.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	ino := fs.newInodeLocked(false /* isDir */)
+	fs.setLocked(name, ino)
+	return &file{fs: fs, File: f, ino: ino}, nil
+}
+
+// Link implements vfs.FS.
+func (fs *FS) Link(oldname, newname string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.mu.mem.Link(oldname, newname); err != nil {
+		return err
+	}
+	fs.setLocked(newname, fs.lookupLocked(oldname))
+	return nil
+}
+
+// Open implements vfs.FS.
+func (fs *FS) Open(name string, opts ...vfs.OpenOption) (vfs.File, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	f, err := fs.mu.mem.Open(name, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &file{fs: fs, File: f, ino: fs.lookupLocked(name)}, nil
+}
+
+// OpenReadWrite implements vfs.FS.
+func (fs *FS) OpenReadWrite(name string, opts ...vfs.OpenOption) (vfs.File, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	exists := fs.lookupLocked(name) != nil
+	f, err := fs.mu.mem.OpenReadWrite(name, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		fs.setLocked(name, fs.newInodeLocked(false /* isDir */))
+	}
+	return &file{fs: fs, File: f, ino: fs.lookupLocked(name)}, nil
+}
+
+// OpenDir implements vfs.FS.
+func (fs *FS) OpenDir(name string) (vfs.File, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	f, err := fs.mu.mem.OpenDir(name)
+	if err != nil {
+		return nil, err
+	}
+	return &file{fs: fs, File: f, ino: fs.lookupLocked(name)}, nil
+}
+
+// Remove implements vfs.FS.
+func (fs *FS) Remove(name string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.mu.mem.Remove(name); err != nil {
+		return err
+	}
+	fs.setLocked(name, nil)
+	return nil
+}
+
+// RemoveAll implements vfs.FS.
+func (fs *FS) RemoveAll(name string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.mu.mem.RemoveAll(name); err != nil {
+		return err
+	}
+	if ino := fs.lookupLocked(name); ino != nil {
+		// Remove the entries of the directories bottom up, as a recursive
+		// removal would.
+		var removeChildren func(dir *inode)
+		removeChildren = func(dir *inode) {
+			for _, name := range sortedNames(dir.children) {
+				if child := dir.children[name]; child.isDir {
+					removeChildren(child)
+				}
+				dir.applyLocked(dirOp{{name: name}})
+			}
+		}
+		if ino.isDir {
+			removeChildren(ino)
+		}
+		fs.setLocked(name, nil)
+	}
+	return nil
+}
+
+// Rename implements vfs.FS.
+func (fs *FS) Rename(oldname, newname string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.mu.mem.Rename(oldname, newname); err != nil {
+		return err
+	}
+	fs.renameLocked(oldname, newname)
+	return nil
+}
+
+func (fs *FS) renameLocked(oldname, newname string) {
+	ino := fs.lookupLocked(oldname)
+	oldDir, oldBase := splitPath(oldname)
+	newDir, newBase := splitPath(newname)
+	if oldDir == newDir && oldBase == newBase {
+		return
+	}
+	if oldDir == newDir {
+		if dir := fs.lookupLocked(oldDir); dir != nil {
+			dir.applyLocked(dirOp{{name: newBase, ino: ino}, {name: oldBase}})
+		}
+		return
+	}
+	fs.setLocked(newname, ino)
+	fs.setLocked(oldname, nil)
+}
+
+// ReuseForWrite implements vfs.FS.
+func (fs *FS) ReuseForWrite(oldname, newname string) (vfs.File, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	f, err := fs.mu.mem.ReuseForWrite(oldname, newname)
+	if err != nil {
+		return nil, err
+	}
+	fs.renameLocked(oldname, newname)
+	return &file{fs: fs, File: f, ino: fs.lookupLocked(newname)}, nil
+}
+
+// MkdirAll implements vfs.FS.
+func (fs *FS) MkdirAll(dir string, perm os.FileMode) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.mu.mem.MkdirAll(dir, perm); err != nil {
+		return err
+	}
+	clean := strings.TrimPrefix(path.Clean("/"+dir), "/")
+	if clean == "" {
+		return nil
+	}
+	n := fs.mu.root
+	for _, frag := range strings.Split(clean, "/") {
+		child := n.children[frag]
+		if child == nil {
+			child = fs.newInodeLocked(true /* isDir */)
+			n.applyLocked(dirOp{{name: frag, ino: child}})
+		}
+		n = child
+	}
+	return nil
+}
+
+// Lock implements vfs.FS. Locks don't survive crashes.
+func (fs *FS) Lock(name string) (io.Closer, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	c, err := fs.mu.mem.Lock(name)
+	if err != nil {
+		return nil, err
+	}
+	// vfs.MemFS creates the lock file, truncating it if it exists.
+	fs.setLocked(name, fs.newInodeLocked(false /* isDir */))
+	return c, nil
+}
+
+// List implements vfs.FS.
+func (fs *FS) List(dir string) ([]string, error) {
+	return fs.mem().List(dir)
+}
+
+// Stat implements vfs.FS.
+func (fs *FS) Stat(name string) (os.FileInfo, error) {
+	return fs.mem().Stat(name)
+}
+
+// PathBase implements vfs.FS.
+func (fs *FS) PathBase(p string) string {
+	return fs.mem().PathBase(p)
+}
+
+// PathJoin implements vfs.FS.
+func (fs *FS) PathJoin(elem ...string) string {
+	return fs.mem().PathJoin(elem...)
+}
+
+// PathDir implements vfs.FS.
+func (fs *FS) PathDir(p string) string {
+	return fs.mem().PathDir(p)
+}
+
+// GetDiskUsage implements vfs.FS.
+func (fs *FS) GetDiskUsage(p string) (vfs.DiskUsage, error) {
+	return fs.mem().GetDiskUsage(p)
+}
+
+func (fs *FS) mem() *vfs.MemFS {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.mu.mem
+}
+
+// SyncedState returns a new FS holding the state of the filesystem after a
+// crash at this point that loses all the unsynced operations. It only holds
+// the files and directories reachable through durable directory entries.
+func (fs *FS) SyncedState() (*FS, error) {
+	return fs.crashState(nil)
+}
+
+// CrashState returns a new FS holding a state the filesystem may be left in by
+// a crash at this point, chosen randomly by rng. See the package documentation
+// for the states that may be produced. All the operations applied to the
+// returned FS are unsynced, while its initial state is durable, so that
+// crashes during recovery may be tested too.
+func (fs *FS) CrashState(rng *rand.Rand) (*FS, error) {
+	return fs.crashState(rng)
+}
+
+// crashState returns a post-crash state of the filesystem, with the surviving
+// unsynced operations chosen by rng. All the unsynced operations are lost if
+// rng is nil.
+func (fs *FS) crashState(rng *rand.Rand) (*FS, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	// cut returns the number of writes or ops of an inode that survive the
+	// crash.
+	cut := func(synced, n int) int {
+		if rng == nil || n == synced {
+			return synced
+		}
+		return synced + rng.Intn(n-synced+1)
+	}
+
+	c := New()
+	// paths are the paths of the files already written to c, so that the
+	// other entries naming a file that survives the crash are hard links.
+	paths := make(map[*inode]string)
+	var walk func(dir *inode, dirname string) error
+	walk = func(dir *inode, dirname string) error {
+		children := make(map[string]*inode)
+		for _, op := range dir.ops[:cut(dir.synced, len(dir.ops))] {
+			for _, e := range op {
+				if e.ino == nil {
+					delete(children, e.name)
+				} else {
+					children[e.name] = e.ino
+				}
+			}
+		}
+		for _, name := range sortedNames(children) {
+			child := children[name]
+			childname := path.Join(dirname, name)
+			if p, ok := paths[child]; ok {
+				if child.isDir {
+					// A directory may only appear under a single name, so a
+					// rename across directories that survives in both
+					// directories moves it.
+					continue
+				}
+				if err := c.Link(p, childname); err != nil {
+					return err
+				}
+				continue
+			}
+			paths[child] = childname
+			if child.isDir {
+				if err := c.MkdirAll(childname, 0755); err != nil {
+					return err
+				}
+				if err := walk(child, childname); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := c.writeFile(childname, child.contents(rng, cut)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	paths[fs.mu.root] = ""
+	if err := walk(fs.mu.root, ""); err != nil {
+		return nil, errors.Wrap(err, "crashfs: producing crash state")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, n := range c.mu.inodes {
+		n.synced = max(len(n.writes), len(n.ops))
+	}
+	return c, nil
+}
+
+// contents returns the contents of the file after a crash, including the
+// writes kept by cut. The first of the writes lost may be torn.
+func (n *inode) contents(rng *rand.Rand, cut func(synced, n int) int) []byte {
+	k := cut(n.synced, len(n.writes))
+	var data []byte
+	apply := func(w fileWrite) {
+		if end := w.offset + int64(len(w.data)); end > int64(len(data)) {
+			data = append(data, make([]byte, end-int64(len(data)))...)
+		}
+		copy(data[w.offset:], w.data)
+	}
+	for _, w := range n.writes[:k] {
+		apply(w)
+	}
+	if rng != nil && k < len(n.writes) && rng.Intn(2) == 0 {
+		w := n.writes[k]
+		apply(fileWrite{offset: w.offset, data: w.data[:rng.Intn(len(w.data)+1)]})
+	}
+	return data
+}
+
+func (fs *FS) writeFile(name string, data []byte) error {
+	f, err := fs.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		return errors.CombineErrors(err, f.Close())
+	}
+	return f.Close()
+}
+
+func sortedNames(m map[string]*inode) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// file is a vfs.File recording the writes and syncs applied to it.
+type file struct {
+	vfs.File
+	fs  *FS
+	ino *inode
+	// offset is the offset of the next Write.
+	offset int64
+}
+
+var _ vfs.File = (*file)(nil)
+
+// Read implements vfs.File.
+func (f *file) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	f.offset += int64(n)
+	return n, err
+}
+
+// Write implements vfs.File.
+func (f *file) Write(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	// The wrapped file may modify p, so it's copied before it's written.
+	data := append([]byte(nil), p...)
+	n, err := f.File.Write(p)
+	f.recordLocked(data[:n], f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+// WriteAt implements vfs.File.
+func (f *file) WriteAt(p []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	data := append([]byte(nil), p...)
+	n, err := f.File.WriteAt(p, off)
+	f.recordLocked(data[:n], off)
+	return n, err
+}
+
+func (f *file) recordLocked(p []byte, off int64) {
+	if len(p) > 0 && f.ino != nil {
+		f.ino.writes = append(f.ino.writes, fileWrite{offset: off, data: p})
+	}
+}
+
+// Sync implements vfs.File.
+func (f *file) Sync() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.File.Sync(); err != nil {
+		return err
+	}
+	f.syncLocked()
+	return nil
+}
+
+// SyncData implements vfs.File.
+func (f *file) SyncData() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.File.SyncData(); err != nil {
+		return err
+	}
+	f.syncLocked()
+	return nil
+}
+
+// SyncTo implements vfs.File. Unless the file is fully synced, the writes in
+// the synced prefix of the file are durable.
+func (f *file) SyncTo(length int64) (fullSync bool, err error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	fullSync, err = f.File.SyncTo(length)
+	if err != nil {
+		return false, err
+	}
+	if fullSync {
+		f.syncLocked()
+	} else if f.ino != nil && !f.ino.isDir {
+		for f.ino.synced < len(f.ino.writes) {
+			w := f.ino.writes[f.ino.synced]
+			if w.offset+int64(len(w.data)) > length {
+				break
+			}
+			f.ino.synced++
+		}
+	}
+	return fullSync, nil
+}
+
+func (f *file) syncLocked() {
+	if f.ino != nil {
+		f.ino.synced = max(len(f.ino.writes), len(f.ino.ops))
+	}
+}
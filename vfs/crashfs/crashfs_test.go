@@ -0,0 +1,274 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package crashfs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/errors/oserror"
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func readFile(t *testing.T, fs vfs.FS, name string) (string, bool) {
+	f, err := fs.Open(name)
+	if oserror.IsNotExist(err) {
+		return "", false
+	}
+	require.NoError(t, err)
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	require.NoError(t, err)
+	return string(data), true
+}
+
+func writeFile(t *testing.T, fs vfs.FS, name string, data ...string) vfs.File {
+	f, err := fs.Create(name)
+	require.NoError(t, err)
+	for _, d := range data {
+		_, err := f.Write([]byte(d))
+		require.NoError(t, err)
+	}
+	return f
+}
+
+func syncDir(t *testing.T, fs vfs.FS, name string) {
+	d, err := fs.OpenDir(name)
+	require.NoError(t, err)
+	require.NoError(t, d.Sync())
+	require.NoError(t, d.Close())
+}
+
+func TestSyncedState(t *testing.T) {
+	fs := New()
+	require.NoError(t, fs.MkdirAll("db", 0755))
+	syncDir(t, fs, "")
+
+	f := writeFile(t, fs, "db/a", "foo")
+	require.NoError(t, f.Sync())
+	_, err := f.Write([]byte("bar"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	// The file's entry isn't durable until the directory is synced.
+	state, err := fs.SyncedState()
+	require.NoError(t, err)
+	_, ok := readFile(t, state, "db/a")
+	require.False(t, ok)
+
+	syncDir(t, fs, "db")
+	state, err = fs.SyncedState()
+	require.NoError(t, err)
+	data, ok := readFile(t, state, "db/a")
+	require.True(t, ok)
+	require.Equal(t, "foo", data)
+	// The live FS observes the unsynced write.
+	data, _ = readFile(t, fs, "db/a")
+	require.Equal(t, "foobar", data)
+
+	// An unsynced removal and rename are lost.
+	require.NoError(t, fs.Rename("db/a", "db/b"))
+	state, err = fs.SyncedState()
+	require.NoError(t, err)
+	names, err := state.List("db")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, names)
+
+	// The initial state of a crash state is durable.
+	state, err = state.SyncedState()
+	require.NoError(t, err)
+	data, ok = readFile(t, state, "db/a")
+	require.True(t, ok)
+	require.Equal(t, "foo", data)
+}
+
+func TestCrashState(t *testing.T) {
+	fs := New()
+	f := writeFile(t, fs, "a", "foo")
+	require.NoError(t, f.Sync())
+	for _, d := range []string{"bar", "baz"} {
+		_, err := f.Write([]byte(d))
+		require.NoError(t, err)
+	}
+	require.NoError(t, f.Close())
+	syncDir(t, fs, "")
+	f = writeFile(t, fs, "tmp", "new")
+	require.NoError(t, f.Sync())
+	require.NoError(t, f.Close())
+	syncDir(t, fs, "")
+	require.NoError(t, fs.Rename("tmp", "b"))
+	require.NoError(t, fs.Link("a", "c"))
+
+	rng := rand.New(rand.NewSource(1))
+	seen := make(map[string]bool)
+	for i := 0; i < 200; i++ {
+		state, err := fs.CrashState(rng)
+		require.NoError(t, err)
+		a, ok := readFile(t, state, "a")
+		require.True(t, ok)
+		// A prefix of the unsynced writes survives, the last of which may be
+		// torn.
+		require.True(t, len(a) >= 3 && "foobarbaz"[:len(a)] == a, "a: %q", a)
+		seen[a] = true
+
+		// The rename is atomic, and the operations on the entries of the
+		// directory survive in order.
+		_, tmpOK := readFile(t, state, "tmp")
+		b, bOK := readFile(t, state, "b")
+		c, cOK := readFile(t, state, "c")
+		require.NotEqual(t, tmpOK, bOK)
+		if bOK {
+			require.Equal(t, "new", b)
+		}
+		if cOK {
+			require.True(t, bOK)
+			require.Equal(t, a, c)
+		}
+	}
+	for _, a := range []string{"foo", "foobar", "foobarbaz"} {
+		require.True(t, seen[a], "state %q not produced", a)
+	}
+	require.Greater(t, len(seen), 3)
+}
+
+func TestCrashStateRenameAcrossDirs(t *testing.T) {
+	fs := New()
+	require.NoError(t, fs.MkdirAll("x", 0755))
+	require.NoError(t, fs.MkdirAll("y", 0755))
+	f := writeFile(t, fs, "x/a", "foo")
+	require.NoError(t, f.Sync())
+	require.NoError(t, f.Close())
+	syncDir(t, fs, "x")
+	syncDir(t, fs, "")
+	require.NoError(t, fs.Rename("x/a", "y/a"))
+
+	rng := rand.New(rand.NewSource(1))
+	seen := make(map[[2]bool]bool)
+	for i := 0; i < 100; i++ {
+		state, err := fs.CrashState(rng)
+		require.NoError(t, err)
+		_, xOK := readFile(t, state, "x/a")
+		_, yOK := readFile(t, state, "y/a")
+		seen[[2]bool{xOK, yOK}] = true
+	}
+	require.Len(t, seen, 4)
+
+	// Once both directories are synced, the rename is durable.
+	syncDir(t, fs, "x")
+	syncDir(t, fs, "y")
+	state, err := fs.CrashState(rng)
+	require.NoError(t, err)
+	_, ok := readFile(t, state, "x/a")
+	require.False(t, ok)
+	data, ok := readFile(t, state, "y/a")
+	require.True(t, ok)
+	require.Equal(t, "foo", data)
+}
+
+func TestSyncTo(t *testing.T) {
+	fs := New()
+	f, err := fs.Create("a")
+	require.NoError(t, err)
+	syncDir(t, fs, "")
+	for _, d := range []string{"foo", "bar", "baz"} {
+		_, err := f.Write([]byte(d))
+		require.NoError(t, err)
+	}
+	fullSync, err := f.SyncTo(7)
+	require.NoError(t, err)
+	state, err := fs.SyncedState()
+	require.NoError(t, err)
+	data, _ := readFile(t, state, "a")
+	if fullSync {
+		require.Equal(t, "foobarbaz", data)
+	} else {
+		require.Equal(t, "foobar", data)
+	}
+	require.NoError(t, f.Close())
+}
+
+func TestRunnerDB(t *testing.T) {
+	const numKeys = 50
+	var acknowledged int
+	r := Runner{
+		Seed:           1,
+		StatesPerCrash: 5,
+		Workload: func(fs vfs.FS, crash func()) error {
+			d, err := pebble.Open("db", &pebble.Options{FS: fs})
+			if err != nil {
+				return err
+			}
+			for i := 0; i < numKeys; i++ {
+				if i%10 == 5 {
+					if err := d.Flush(); err != nil {
+						return err
+					}
+				}
+				if err := d.Set([]byte(fmt.Sprintf("key%03d", i)), []byte("value"), pebble.Sync); err != nil {
+					return err
+				}
+				acknowledged = i + 1
+				crash()
+			}
+			return d.Close()
+		},
+		Check: func(state *FS) error {
+			d, err := pebble.Open("db", &pebble.Options{FS: state})
+			if err != nil {
+				return err
+			}
+			iter, err := d.NewIter(nil)
+			if err != nil {
+				return errors.CombineErrors(err, d.Close())
+			}
+			// The keys were written in order, so the DB must hold a prefix of
+			// them, including all the acknowledged keys.
+			var n int
+			for valid := iter.First(); valid; valid = iter.Next() {
+				if key := fmt.Sprintf("key%03d", n); !bytes.Equal(iter.Key(), []byte(key)) {
+					err = errors.Errorf("found key %q, expected %q", iter.Key(), key)
+					break
+				}
+				n++
+			}
+			err = errors.CombineErrors(err, iter.Close())
+			if err == nil && n < acknowledged {
+				err = errors.Errorf("found %d keys, %d acknowledged", n, acknowledged)
+			}
+			return errors.CombineErrors(err, d.Close())
+		},
+	}
+	require.NoError(t, r.Run())
+}
+
+func TestRunnerCheckError(t *testing.T) {
+	r := Runner{
+		Workload: func(fs vfs.FS, crash func()) error {
+			f, err := fs.Create("a")
+			if err != nil {
+				return err
+			}
+			crash()
+			crash()
+			return f.Close()
+		},
+		Check: func(state *FS) error {
+			if _, err := state.Stat("a"); err != nil {
+				return err
+			}
+			return nil
+		},
+	}
+	err := r.Run()
+	require.Error(t, err)
+	require.True(t, oserror.IsNotExist(err))
+	require.Contains(t, err.Error(), "crash point 1, state 0")
+}
@@ -0,0 +1,74 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package crashfs
+
+import (
+	"math/rand"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// Runner runs a crash-consistency test: it runs a workload on an FS, and at
+// each of the crash points of the workload, checks the invariants of
+// post-crash states of the FS.
+type Runner struct {
+	// Workload runs the workload on fs, typically opening a DB on fs and
+	// writing to it. It invokes crash at each of the points at which a crash is
+	// simulated: crash checks post-crash states of fs synchronously, so Check
+	// may rely on the state of the workload at the time crash is invoked, such
+	// as the writes acknowledged so far. The workload isn't interrupted by the
+	// crashes.
+	Workload func(fs vfs.FS, crash func()) error
+	// Check checks the invariants of a post-crash state, typically opening the
+	// DB on state and reading it. It may produce crash states of state itself,
+	// to test crashes during recovery.
+	Check func(state *FS) error
+	// StatesPerCrash is the number of post-crash states checked at each crash
+	// point, in addition to the state holding only the synced operations. If
+	// zero, 10 states are checked.
+	StatesPerCrash int
+	// Seed seeds the random choice of the post-crash states.
+	Seed int64
+}
+
+// Run runs the workload, checking post-crash states at each crash point. It
+// returns the error returned by the workload, or the first error returned by
+// Check, annotated with the crash point and state.
+func (r *Runner) Run() error {
+	statesPerCrash := r.StatesPerCrash
+	if statesPerCrash == 0 {
+		statesPerCrash = 10
+	}
+	rng := rand.New(rand.NewSource(r.Seed))
+	fs := New()
+	var checkErr error
+	var crashPoint int
+	crash := func() {
+		crashPoint++
+		if checkErr != nil {
+			return
+		}
+		for i := 0; i <= statesPerCrash && checkErr == nil; i++ {
+			var state *FS
+			var err error
+			if i == 0 {
+				state, err = fs.SyncedState()
+			} else {
+				state, err = fs.CrashState(rng)
+			}
+			if err == nil {
+				err = r.Check(state)
+			}
+			if err != nil {
+				checkErr = errors.Wrapf(err, "crashfs: crash point %d, state %d", crashPoint, i)
+			}
+		}
+	}
+	if err := r.Workload(fs, crash); err != nil {
+		return err
+	}
+	return checkErr
+}
@@ -0,0 +1,109 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package vfs
+
+import (
+	"unsafe"
+
+	"github.com/cockroachdb/errors"
+)
+
+// DirectIOAlignment is the alignment required of the offsets, lengths and
+// memory buffers of the I/O performed on files with direct I/O enabled.
+const DirectIOAlignment = 4096
+
+// directIOBufferSize is the size of the aligned buffer through which the
+// writes of unaligned memory buffers are copied.
+const directIOBufferSize = 32 << 10
+
+// EnableDirectIO enables direct I/O on f, so that writes to f bypass the page
+// cache (O_DIRECT on Linux). f must be backed by an OS file, i.e. f.Fd() must
+// return a file descriptor. It returns the File to be used in place of f: the
+// offsets and lengths of the writes to the returned File must be multiples of
+// DirectIOAlignment, and writes of memory buffers that aren't aligned are
+// copied through an aligned buffer. The returned File isn't suitable for
+// reads.
+//
+// EnableDirectIO returns an error satisfying errors.Is(err, ErrUnsupported)
+// if the platform, the filesystem or f don't support direct I/O, in which case
+// f may still be used with buffered I/O.
+func EnableDirectIO(f File) (File, error) {
+	fd := f.Fd()
+	if fd == InvalidFd {
+		return nil, errors.Wrap(ErrUnsupported, "pebble: direct I/O requires an OS file")
+	}
+	if err := setDirectIO(fd); err != nil {
+		return nil, err
+	}
+	return &directIOFile{File: f}, nil
+}
+
+// directIOFile is a File with direct I/O enabled. It copies the writes of
+// unaligned memory buffers through an aligned buffer.
+type directIOFile struct {
+	File
+	// buf is an aligned buffer of directIOBufferSize bytes, allocated on the
+	// first write of an unaligned memory buffer.
+	buf []byte
+}
+
+var _ File = (*directIOFile)(nil)
+
+// Write implements File.
+func (f *directIOFile) Write(p []byte) (int, error) {
+	if len(p) == 0 || isAligned(p) {
+		return f.File.Write(p)
+	}
+	if f.buf == nil {
+		f.buf = alignedBuffer(directIOBufferSize)
+	}
+	var n int
+	for n < len(p) {
+		m := copy(f.buf, p[n:])
+		written, err := f.File.Write(f.buf[:m])
+		n += written
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// WriteAt implements File.
+func (f *directIOFile) WriteAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 || isAligned(p) {
+		return f.File.WriteAt(p, off)
+	}
+	if f.buf == nil {
+		f.buf = alignedBuffer(directIOBufferSize)
+	}
+	var n int
+	for n < len(p) {
+		m := copy(f.buf, p[n:])
+		written, err := f.File.WriteAt(f.buf[:m], off+int64(n))
+		n += written
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// isAligned returns true if p starts at a multiple of DirectIOAlignment in
+// memory.
+func isAligned(p []byte) bool {
+	return uintptr(unsafe.Pointer(&p[0]))%DirectIOAlignment == 0
+}
+
+// alignedBuffer returns a buffer of n bytes starting at a multiple of
+// DirectIOAlignment in memory.
+func alignedBuffer(n int) []byte {
+	buf := make([]byte, n+DirectIOAlignment)
+	off := int(uintptr(unsafe.Pointer(&buf[0])) % DirectIOAlignment)
+	if off != 0 {
+		off = DirectIOAlignment - off
+	}
+	return buf[off : off+n : off+n]
+}
@@ -0,0 +1,14 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package vfs
+
+import "github.com/cockroachdb/errors"
+
+func setDirectIO(fd uintptr) error {
+	return errors.Wrap(ErrUnsupported, "pebble: direct I/O unsupported on this platform")
+}
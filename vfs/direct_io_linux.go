@@ -0,0 +1,29 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package vfs
+
+import (
+	"github.com/cockroachdb/errors"
+	"golang.org/x/sys/unix"
+)
+
+// setDirectIO sets O_DIRECT on a file descriptor.
+func setDirectIO(fd uintptr) error {
+	flags, err := unix.FcntlInt(fd, unix.F_GETFL, 0)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := unix.FcntlInt(fd, unix.F_SETFL, flags|unix.O_DIRECT); err != nil {
+		if err == unix.EINVAL {
+			// The filesystem doesn't support O_DIRECT.
+			return errors.Wrap(ErrUnsupported, "pebble: direct I/O unsupported by the filesystem")
+		}
+		return errors.WithStack(err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package vfs
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnableDirectIO(t *testing.T) {
+	mem := NewMem()
+	f, err := mem.Create("a")
+	require.NoError(t, err)
+	_, err = EnableDirectIO(f)
+	require.True(t, errors.Is(err, ErrUnsupported), "%v", err)
+	require.NoError(t, f.Close())
+
+	path := filepath.Join(t.TempDir(), "a")
+	f, err = Default.Create(path)
+	require.NoError(t, err)
+	df, err := EnableDirectIO(f)
+	if errors.Is(err, ErrUnsupported) {
+		require.NoError(t, f.Close())
+		t.Skipf("direct I/O unsupported: %v", err)
+	}
+	require.NoError(t, err)
+
+	// Write an aligned buffer, and unaligned buffers spanning multiple copies
+	// through the aligned buffer.
+	expected := make([]byte, 0, 3*directIOBufferSize)
+	aligned := alignedBuffer(DirectIOAlignment)
+	for i := range aligned {
+		aligned[i] = byte(i)
+	}
+	expected = append(expected, aligned...)
+	_, err = df.Write(aligned)
+	require.NoError(t, err)
+	unaligned := make([]byte, 2*directIOBufferSize+DirectIOAlignment+1)[1:]
+	for i := range unaligned {
+		unaligned[i] = byte(i * 7)
+	}
+	expected = append(expected, unaligned...)
+	n, err := df.Write(unaligned)
+	require.NoError(t, err)
+	require.Equal(t, len(unaligned), n)
+	require.NoError(t, df.Sync())
+	require.NoError(t, df.Close())
+
+	f, err = Default.Open(path)
+	require.NoError(t, err)
+	data, err := io.ReadAll(f)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.True(t, bytes.Equal(expected, data))
+}
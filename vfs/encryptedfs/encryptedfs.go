@@ -0,0 +1,446 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+// Package encryptedfs implements a vfs.FS that transparently encrypts the
+// files it stores, including sstables, WALs and MANIFESTs.
+//
+// Each file is encrypted with AES-256 in CTR mode using a random data key of
+// its own, which is stored in the header of the file wrapped by a store key.
+// Store keys are provided by the user and are never written to the
+// filesystem. The store key used to wrap the data keys of new files may be
+// rotated while the FS is in use, and the data keys of existing files may be
+// rewrapped by the new store key so that the old store key can be retired.
+//
+// The contents of files are not authenticated: Pebble's checksums of sstable
+// blocks and WAL and MANIFEST records detect corruption of the encrypted
+// contents. Directories, file names and lock files are not encrypted.
+//
+// Files are append-only. The contents at an offset of a file are always
+// encrypted with the same keystream, so overwriting them would reveal the XOR
+// of the old and new contents: writes below the end of the contents of a file
+// fail with ErrOverwrite. As a consequence, the shared cache, which overwrites
+// its blocks in place, cannot store its data in an FS.
+package encryptedfs
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// FS is a vfs.FS encrypting the files of the wrapped FS. All of the regular
+// files of the wrapped FS accessed through the FS, apart from lock files, must
+// have been written through an FS.
+//
+// FS intentionally doesn't implement an Unwrap method: vfs.Root would return
+// the wrapped FS, whose files hold encrypted contents.
+type FS struct {
+	vfs.FS
+
+	mu struct {
+		sync.RWMutex
+		// active is the store key wrapping the data keys of new files.
+		active *storeKey
+		// keys holds the store keys by ID, including the active key.
+		keys map[keyID]*storeKey
+	}
+}
+
+var _ vfs.FS = (*FS)(nil)
+
+// ErrOverwrite is returned by the writes to an encrypted file that would
+// overwrite its existing contents.
+var ErrOverwrite = errors.New("encryptedfs: cannot overwrite the contents of an encrypted file")
+
+// New returns an FS encrypting the files of fs. The first of the store keys is
+// the active key, which wraps the data keys of new files, and any additional
+// keys are used to unwrap the data keys of existing files. Store keys are
+// AES-128, AES-192 or AES-256 keys, of 16, 24 or 32 bytes respectively.
+func New(fs vfs.FS, keys ...[]byte) (*FS, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("encryptedfs: no store keys")
+	}
+	efs := &FS{FS: fs}
+	efs.mu.keys = make(map[keyID]*storeKey)
+	for i := len(keys) - 1; i >= 0; i-- {
+		if err := efs.RotateStoreKey(keys[i]); err != nil {
+			return nil, err
+		}
+	}
+	return efs, nil
+}
+
+// RotateStoreKey makes the store key the active key, which wraps the data keys
+// of files created from now on. The previously active key continues to be used
+// to unwrap the data keys of existing files, which may be rewrapped by the new
+// active key with Rewrap or RewrapDir.
+func (fs *FS) RotateStoreKey(key []byte) error {
+	sk, err := newStoreKey(key)
+	if err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if existing, ok := fs.mu.keys[sk.id]; ok {
+		sk = existing
+	} else {
+		fs.mu.keys[sk.id] = sk
+	}
+	fs.mu.active = sk
+	return nil
+}
+
+func (fs *FS) activeKey() *storeKey {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	return fs.mu.active
+}
+
+// unwrap decodes the header of the named file, unwrapping its data key.
+func (fs *FS) unwrap(name string, hdr []byte) (*dataKey, error) {
+	id, err := decodeHeaderKeyID(hdr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s", name)
+	}
+	fs.mu.RLock()
+	sk := fs.mu.keys[id]
+	fs.mu.RUnlock()
+	if sk == nil {
+		return nil, errors.Newf("encryptedfs: %s: unknown store key %s", name, id)
+	}
+	dk, err := decodeHeader(sk, hdr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s", name)
+	}
+	return dk, nil
+}
+
+// create writes the header of a new file holding a new data key to the file,
+// which must be positioned at its start.
+func (fs *FS) create(f vfs.File) (vfs.File, error) {
+	dk, err := newDataKey()
+	if err != nil {
+		return nil, err
+	}
+	hdr, err := encodeHeader(fs.activeKey(), dk)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(hdr); err != nil {
+		return nil, err
+	}
+	return &file{File: f, key: dk}, nil
+}
+
+// Create implements vfs.FS.
+func (fs *FS) Create(name string) (vfs.File, error) {
+	f, err := fs.FS.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	ef, err := fs.create(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return ef, nil
+}
+
+// ReuseForWrite implements vfs.FS. The reused file is given a new data key,
+// so that its previous contents are unreadable.
+func (fs *FS) ReuseForWrite(oldname, newname string) (vfs.File, error) {
+	f, err := fs.FS.ReuseForWrite(oldname, newname)
+	if err != nil {
+		return nil, err
+	}
+	ef, err := fs.create(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return ef, nil
+}
+
+// Open implements vfs.FS. An empty file is opened as is.
+func (fs *FS) Open(name string, opts ...vfs.OpenOption) (vfs.File, error) {
+	f, err := fs.FS.Open(name, opts...)
+	if err != nil {
+		return nil, err
+	}
+	hdr := make([]byte, headerSize)
+	n, err := io.ReadFull(f, hdr)
+	if err == io.EOF {
+		return &file{File: f}, nil
+	}
+	var dk *dataKey
+	if err == nil || err == io.ErrUnexpectedEOF {
+		dk, err = fs.unwrap(name, hdr[:n])
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &file{File: f, key: dk}, nil
+}
+
+// OpenReadWrite implements vfs.FS. A header is written to the file if it's
+// empty. The existing contents of the file cannot be overwritten: only writes
+// at or past the end of the file are permitted.
+func (fs *FS) OpenReadWrite(name string, opts ...vfs.OpenOption) (vfs.File, error) {
+	f, err := fs.FS.OpenReadWrite(name, opts...)
+	if err != nil {
+		return nil, err
+	}
+	ef, err := func() (vfs.File, error) {
+		hdr := make([]byte, headerSize)
+		n, err := f.ReadAt(hdr, 0)
+		if n == 0 && err == io.EOF {
+			dk, err := newDataKey()
+			if err != nil {
+				return nil, err
+			}
+			if hdr, err = encodeHeader(fs.activeKey(), dk); err != nil {
+				return nil, err
+			}
+			if _, err := f.WriteAt(hdr, 0); err != nil {
+				return nil, err
+			}
+			return &file{File: f, key: dk, positional: true}, nil
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		dk, err := fs.unwrap(name, hdr[:n])
+		if err != nil {
+			return nil, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		ef := &file{File: f, key: dk, positional: true}
+		ef.mu.size = fileInfo{info}.Size()
+		return ef, nil
+	}()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return ef, nil
+}
+
+// Stat implements vfs.FS, reporting the size of the decrypted contents of
+// files.
+func (fs *FS) Stat(name string) (os.FileInfo, error) {
+	info, err := fs.FS.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{info}, nil
+}
+
+// Rewrap rewraps the data key of the named file by the active store key, if
+// it's wrapped by another store key, returning whether it was rewrapped. Only
+// the header of the file is rewritten, so the file may be rewrapped while it's
+// in use. Empty files are left as is.
+func (fs *FS) Rewrap(name string) (bool, error) {
+	f, err := fs.FS.OpenReadWrite(name)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	hdr := make([]byte, headerSize)
+	n, err := f.ReadAt(hdr, 0)
+	if n == 0 && err == io.EOF {
+		return false, nil
+	} else if err != nil && err != io.EOF {
+		return false, err
+	}
+	active := fs.activeKey()
+	if id, err := decodeHeaderKeyID(hdr[:n]); err != nil {
+		return false, errors.Wrapf(err, "%s", name)
+	} else if id == active.id {
+		return false, nil
+	}
+	dk, err := fs.unwrap(name, hdr[:n])
+	if err != nil {
+		return false, err
+	}
+	if hdr, err = encodeHeader(active, dk); err != nil {
+		return false, err
+	}
+	// The header is smaller than a disk sector, so it's expected to be
+	// written atomically.
+	if _, err := f.WriteAt(hdr, 0); err != nil {
+		return false, err
+	}
+	return true, f.Sync()
+}
+
+// RewrapDir rewraps the data keys of the files of the directory by the active
+// store key, returning the number of files that were rewrapped. Once the data
+// keys of all of the files of a store are rewrapped, the store keys that were
+// previously active may be retired.
+func (fs *FS) RewrapDir(dir string) (int, error) {
+	names, err := fs.FS.List(dir)
+	if err != nil {
+		return 0, err
+	}
+	var rewrapped int
+	for _, name := range names {
+		path := fs.FS.PathJoin(dir, name)
+		info, err := fs.FS.Stat(path)
+		if err != nil {
+			return rewrapped, err
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		ok, err := fs.Rewrap(path)
+		if err != nil {
+			return rewrapped, err
+		}
+		if ok {
+			rewrapped++
+		}
+	}
+	return rewrapped, nil
+}
+
+// file is an encrypted vfs.File. The offsets of its methods are offsets of the
+// decrypted contents, which follow the header.
+type file struct {
+	vfs.File
+	// key is the data key of the file, or nil if the file is empty.
+	key *dataKey
+	// readOffset and writeOffset are the offsets of the next sequential Read and
+	// Write respectively.
+	readOffset, writeOffset int64
+	// positional is set if the position of the wrapped file isn't past the
+	// header, in which case sequential reads and writes are performed with
+	// ReadAt and WriteAt.
+	positional bool
+
+	mu struct {
+		// Mutex serializes the writes, which may be concurrent.
+		sync.Mutex
+		// size is the size of the contents of the file. The writes below size
+		// fail with ErrOverwrite.
+		size int64
+	}
+}
+
+var _ vfs.File = (*file)(nil)
+
+// Read implements io.Reader.
+func (f *file) Read(p []byte) (int, error) {
+	if f.positional {
+		n, err := f.ReadAt(p, f.readOffset)
+		f.readOffset += int64(n)
+		if err == io.EOF && n > 0 {
+			err = nil
+		}
+		return n, err
+	}
+	n, err := f.File.Read(p)
+	if n > 0 {
+		if f.key == nil {
+			return 0, errors.New("encryptedfs: file is not encrypted")
+		}
+		f.key.xorKeyStream(p[:n], p[:n], f.readOffset)
+		f.readOffset += int64(n)
+	}
+	return n, err
+}
+
+// ReadAt implements io.ReaderAt.
+func (f *file) ReadAt(p []byte, off int64) (int, error) {
+	if f.key == nil {
+		return 0, io.EOF
+	}
+	n, err := f.File.ReadAt(p, off+headerSize)
+	f.key.xorKeyStream(p[:n], p[:n], off)
+	return n, err
+}
+
+// Write implements io.Writer. As permitted by vfs.File, p is encrypted in
+// place.
+func (f *file) Write(p []byte) (int, error) {
+	if f.key == nil {
+		return 0, errors.New("encryptedfs: file opened for reading")
+	}
+	if f.positional {
+		n, err := f.WriteAt(p, f.writeOffset)
+		f.writeOffset += int64(n)
+		return n, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.writeOffset < f.mu.size {
+		return 0, ErrOverwrite
+	}
+	f.key.xorKeyStream(p, p, f.writeOffset)
+	n, err := f.File.Write(p)
+	f.writeOffset += int64(n)
+	f.mu.size = max(f.mu.size, f.writeOffset)
+	return n, err
+}
+
+// WriteAt implements io.WriterAt.
+func (f *file) WriteAt(p []byte, off int64) (int, error) {
+	if f.key == nil {
+		return 0, errors.New("encryptedfs: file opened for reading")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if off < f.mu.size {
+		return 0, ErrOverwrite
+	}
+	buf := make([]byte, len(p))
+	f.key.xorKeyStream(buf, p, off)
+	n, err := f.File.WriteAt(buf, off+headerSize)
+	f.mu.size = max(f.mu.size, off+int64(n))
+	return n, err
+}
+
+// Preallocate implements vfs.File.
+func (f *file) Preallocate(offset, length int64) error {
+	return f.File.Preallocate(offset+headerSize, length)
+}
+
+// Stat implements vfs.File, reporting the size of the decrypted contents.
+func (f *file) Stat() (os.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{info}, nil
+}
+
+// SyncTo implements vfs.File.
+func (f *file) SyncTo(length int64) (fullSync bool, err error) {
+	return f.File.SyncTo(length + headerSize)
+}
+
+// Prefetch implements vfs.File.
+func (f *file) Prefetch(offset, length int64) error {
+	return f.File.Prefetch(offset+headerSize, length)
+}
+
+// fileInfo is the os.FileInfo of an encrypted file, whose size excludes the
+// header.
+type fileInfo struct {
+	os.FileInfo
+}
+
+// Size implements os.FileInfo.
+func (i fileInfo) Size() int64 {
+	if !i.Mode().IsRegular() {
+		return i.FileInfo.Size()
+	}
+	return max(i.FileInfo.Size()-headerSize, 0)
+}
@@ -0,0 +1,295 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package encryptedfs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func testKey(i byte) []byte {
+	return bytes.Repeat([]byte{i}, 32)
+}
+
+func readRaw(t *testing.T, fs vfs.FS, name string) []byte {
+	f, err := fs.Open(name)
+	require.NoError(t, err)
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	require.NoError(t, err)
+	return data
+}
+
+func TestFile(t *testing.T) {
+	mem := vfs.NewMem()
+	fs, err := New(mem, testKey(1))
+	require.NoError(t, err)
+
+	rng := rand.New(rand.NewSource(1))
+	data := make([]byte, 10000)
+	rng.Read(data)
+
+	f, err := fs.Create("foo")
+	require.NoError(t, err)
+	for rest := data; len(rest) > 0; {
+		n := min(len(rest), 1+rng.Intn(500))
+		// Write may encrypt the buffer in place.
+		_, err := f.Write(append([]byte(nil), rest[:n]...))
+		require.NoError(t, err)
+		rest = rest[n:]
+	}
+	require.NoError(t, f.Sync())
+	info, err := f.Stat()
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), info.Size())
+	require.NoError(t, f.Close())
+
+	// The file is encrypted.
+	raw := readRaw(t, mem, "foo")
+	require.Len(t, raw, headerSize+len(data))
+	require.NotEqual(t, data, raw[headerSize:])
+	info, err = fs.Stat("foo")
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), info.Size())
+
+	f, err = fs.Open("foo")
+	require.NoError(t, err)
+	defer f.Close()
+	// Sequential reads.
+	got, err := io.ReadAll(f)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+	// Positional reads at unaligned offsets.
+	for i := 0; i < 100; i++ {
+		off := rng.Intn(len(data))
+		buf := make([]byte, rng.Intn(len(data)-off+1))
+		n, err := f.ReadAt(buf, int64(off))
+		require.NoError(t, err)
+		require.Equal(t, data[off:off+n], buf[:n])
+	}
+	_, err = f.ReadAt(make([]byte, 10), int64(len(data)-5))
+	require.Equal(t, io.EOF, err)
+
+	// Positional writes.
+	rw, err := fs.OpenReadWrite("bar")
+	require.NoError(t, err)
+	_, err = rw.WriteAt([]byte("hello "), 0)
+	require.NoError(t, err)
+	_, err = rw.WriteAt([]byte("world"), 6)
+	require.NoError(t, err)
+	require.NoError(t, rw.Close())
+	rw, err = fs.OpenReadWrite("bar")
+	require.NoError(t, err)
+	got, err = io.ReadAll(rw)
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(got))
+	require.NoError(t, rw.Close())
+
+	// A file that wasn't written through the FS can't be opened.
+	f, err = mem.Create("plain")
+	require.NoError(t, err)
+	_, err = f.Write([]byte("plaintext"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	_, err = fs.Open("plain")
+	require.ErrorContains(t, err, "not encrypted")
+}
+
+func TestOverwrite(t *testing.T) {
+	mem := vfs.NewMem()
+	fs, err := New(mem, testKey(1))
+	require.NoError(t, err)
+
+	f, err := fs.Create("foo")
+	require.NoError(t, err)
+	_, err = f.Write([]byte("hello "))
+	require.NoError(t, err)
+	// Overwriting the contents would reuse their keystream.
+	_, err = f.WriteAt([]byte("HELLO"), 0)
+	require.ErrorIs(t, err, ErrOverwrite)
+	_, err = f.WriteAt([]byte("world"), 6)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	raw := readRaw(t, mem, "foo")
+
+	// Nor can the contents of an existing file be overwritten, sequentially or
+	// positionally, while the file can be extended.
+	rw, err := fs.OpenReadWrite("foo")
+	require.NoError(t, err)
+	_, err = rw.Write([]byte("HELLO"))
+	require.ErrorIs(t, err, ErrOverwrite)
+	_, err = rw.WriteAt([]byte("WORLD"), 6)
+	require.ErrorIs(t, err, ErrOverwrite)
+	_, err = rw.WriteAt([]byte("!"), 10)
+	require.ErrorIs(t, err, ErrOverwrite)
+	_, err = rw.WriteAt([]byte("!"), 11)
+	require.NoError(t, err)
+	require.NoError(t, rw.Close())
+
+	// The ciphertext of the existing contents is unchanged.
+	got := readRaw(t, mem, "foo")
+	require.Equal(t, raw, got[:len(raw)])
+	f, err = fs.Open("foo")
+	require.NoError(t, err)
+	data, err := io.ReadAll(f)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.Equal(t, "hello world!", string(data))
+}
+
+func TestReuseForWrite(t *testing.T) {
+	mem := vfs.NewMem()
+	fs, err := New(mem, testKey(1))
+	require.NoError(t, err)
+	write := func(f vfs.File, s string) {
+		_, err := f.Write([]byte(s))
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+	f, err := fs.Create("old")
+	require.NoError(t, err)
+	write(f, "aaaaaaaaaa")
+	oldRaw := readRaw(t, mem, "old")
+
+	f, err = fs.ReuseForWrite("old", "new")
+	require.NoError(t, err)
+	write(f, "bbbb")
+	// The reused file has a new data key, so the tail of its previous
+	// contents doesn't decrypt to the previous plaintext.
+	newRaw := readRaw(t, mem, "new")
+	require.Len(t, newRaw, len(oldRaw))
+	require.NotEqual(t, oldRaw[:headerSize], newRaw[:headerSize])
+	got := readRaw(t, fs, "new")
+	require.Equal(t, "bbbb", string(got[:4]))
+	require.NotEqual(t, "aaaaaa", string(got[4:]))
+}
+
+func TestRotateStoreKey(t *testing.T) {
+	mem := vfs.NewMem()
+	require.NoError(t, mem.MkdirAll("data", 0755))
+	fs, err := New(mem, testKey(1))
+	require.NoError(t, err)
+	create := func(fs vfs.FS, name string) {
+		f, err := fs.Create(name)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(name))
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+	create(fs, "data/a")
+	create(fs, "data/b")
+	require.NoError(t, fs.RotateStoreKey(testKey(2)))
+	create(fs, "data/c")
+	for _, name := range []string{"data/a", "data/b", "data/c"} {
+		require.Equal(t, name, string(readRaw(t, fs, name)))
+	}
+
+	// An FS with only the new store key can't read the files whose data keys
+	// are wrapped by the old one.
+	newFS, err := New(mem, testKey(2))
+	require.NoError(t, err)
+	_, err = newFS.Open("data/a")
+	require.ErrorContains(t, err, "unknown store key")
+	require.Equal(t, "data/c", string(readRaw(t, newFS, "data/c")))
+
+	// A file may be rewrapped while it's open.
+	f, err := fs.Open("data/a")
+	require.NoError(t, err)
+	defer f.Close()
+	n, err := fs.RewrapDir("data")
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	n, err = fs.RewrapDir("data")
+	require.NoError(t, err)
+	require.Zero(t, n)
+	got, err := io.ReadAll(f)
+	require.NoError(t, err)
+	require.Equal(t, "data/a", string(got))
+
+	// Once rewrapped, the old store key may be retired.
+	for _, name := range []string{"data/a", "data/b", "data/c"} {
+		require.Equal(t, name, string(readRaw(t, newFS, name)))
+	}
+	// A different key claiming the ID of the store key fails to unwrap the
+	// data key.
+	sk, err := newStoreKey(testKey(2))
+	require.NoError(t, err)
+	wrong, err := newStoreKey(testKey(3))
+	require.NoError(t, err)
+	wrong.id = sk.id
+	newFS.mu.keys[sk.id] = wrong
+	_, err = newFS.Open("data/a")
+	require.ErrorContains(t, err, "unwrapping data key")
+}
+
+func TestDB(t *testing.T) {
+	mem := vfs.NewMem()
+	fs, err := New(mem, testKey(1))
+	require.NoError(t, err)
+	opts := &pebble.Options{FS: fs}
+	d, err := pebble.Open("db", opts)
+	require.NoError(t, err)
+	value := []byte("secret-value")
+	for i := 0; i < 100; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("key%03d", i)), value, nil))
+	}
+	require.NoError(t, d.Flush())
+	for i := 100; i < 200; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("key%03d", i)), value, nil))
+	}
+	require.NoError(t, d.Close())
+
+	// None of the files of the store hold the plaintext, whether sstables,
+	// WALs or MANIFESTs.
+	names, err := mem.List("db")
+	require.NoError(t, err)
+	for _, name := range names {
+		raw := readRaw(t, mem, mem.PathJoin("db", name))
+		require.False(t, bytes.Contains(raw, []byte("key0")), "%s", name)
+		require.False(t, bytes.Contains(raw, value), "%s", name)
+	}
+
+	// Rotate the store key, and reopen the store with the new store key
+	// alone once the files are rewrapped.
+	require.NoError(t, fs.RotateStoreKey(testKey(2)))
+	_, err = fs.RewrapDir("db")
+	require.NoError(t, err)
+	fs, err = New(mem, testKey(2))
+	require.NoError(t, err)
+	opts.FS = fs
+	d, err = pebble.Open("db", opts)
+	require.NoError(t, err)
+	for i := 0; i < 200; i++ {
+		v, closer, err := d.Get([]byte(fmt.Sprintf("key%03d", i)))
+		require.NoError(t, err)
+		require.Equal(t, value, v)
+		require.NoError(t, closer.Close())
+	}
+	require.NoError(t, d.Close())
+}
+
+func TestReadKeyFile(t *testing.T) {
+	mem := vfs.NewMem()
+	f, err := mem.Create("keys")
+	require.NoError(t, err)
+	_, err = f.Write([]byte(fmt.Sprintf("# the active key\n%x\n\n%x\n", testKey(2), testKey(1)[:16])))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	keys, err := ReadKeyFile(mem, "keys")
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{testKey(2), testKey(1)[:16]}, keys)
+	_, err = New(mem, keys...)
+	require.NoError(t, err)
+
+	_, err = New(mem, []byte("short"))
+	require.ErrorContains(t, err, "invalid store key size")
+}
@@ -0,0 +1,206 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package encryptedfs
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// Each encrypted file begins with a header of headerSize bytes, followed by
+// the file's contents encrypted with AES-256 in CTR mode using the file's data
+// key. The header holds the data key, encrypted with AES-GCM using a store
+// key:
+//
+//	+--------------+---------+--------------+--------+-----------+-----------------+
+//	| magic (8B)   | version | store key ID | IV     | GCM nonce | wrapped data    |
+//	|              | (1B)    | (8B)         | (16B)  | (12B)     | key (32B + 16B) |
+//	+--------------+---------+--------------+--------+-----------+-----------------+
+//
+// The header is padded with zeroes to headerSize bytes. The magic, version,
+// store key ID and IV are authenticated when the data key is unwrapped. The
+// counter of the CTR keystream is initialized to the IV, and the keystream
+// block for offset o of the contents uses the counter IV+o/16.
+const (
+	headerSize = 128
+
+	headerMagic   = "\x89PEBENC\n"
+	headerVersion = 1
+
+	versionOffset    = len(headerMagic)
+	keyIDOffset      = versionOffset + 1
+	ivOffset         = keyIDOffset + keyIDSize
+	nonceOffset      = ivOffset + aes.BlockSize
+	wrappedKeyOffset = nonceOffset + nonceSize
+	headerDataSize   = wrappedKeyOffset + dataKeySize + tagSize
+
+	keyIDSize   = 8
+	nonceSize   = 12
+	tagSize     = 16
+	dataKeySize = 32
+)
+
+// keyID identifies a store key. It's the prefix of the SHA-256 digest of the
+// key.
+type keyID [keyIDSize]byte
+
+// String implements fmt.Stringer.
+func (id keyID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// storeKey is a key wrapping the data keys of files.
+type storeKey struct {
+	id   keyID
+	aead cipher.AEAD
+}
+
+func newStoreKey(key []byte) (*storeKey, error) {
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		return nil, errors.Newf("encryptedfs: invalid store key size %d; must be 16, 24 or 32 bytes", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	k := &storeKey{aead: aead}
+	digest := sha256.Sum256(key)
+	copy(k.id[:], digest[:])
+	return k, nil
+}
+
+// dataKey is the key encrypting the contents of a file.
+type dataKey struct {
+	key   [dataKeySize]byte
+	iv    [aes.BlockSize]byte
+	block cipher.Block
+}
+
+func newDataKey() (*dataKey, error) {
+	k := &dataKey{}
+	if _, err := rand.Read(k.key[:]); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(k.iv[:]); err != nil {
+		return nil, err
+	}
+	return k, k.init()
+}
+
+func (k *dataKey) init() (err error) {
+	k.block, err = aes.NewCipher(k.key[:])
+	return err
+}
+
+// xorKeyStream XORs src with the keystream for the contents at the given
+// offset, storing the result in dst.
+func (k *dataKey) xorKeyStream(dst, src []byte, offset int64) {
+	iv := k.iv
+	// Add the block number to the IV, interpreted as a big-endian 128-bit
+	// integer as by cipher.NewCTR.
+	hi, lo := binary.BigEndian.Uint64(iv[:8]), binary.BigEndian.Uint64(iv[8:])
+	sum := lo + uint64(offset/aes.BlockSize)
+	if sum < lo {
+		hi++
+	}
+	binary.BigEndian.PutUint64(iv[:8], hi)
+	binary.BigEndian.PutUint64(iv[8:], sum)
+	stream := cipher.NewCTR(k.block, iv[:])
+	if skip := int(offset % aes.BlockSize); skip > 0 {
+		var discard [aes.BlockSize]byte
+		stream.XORKeyStream(discard[:skip], discard[:skip])
+	}
+	stream.XORKeyStream(dst, src)
+}
+
+// encodeHeader encodes the header of a file whose data key is wrapped by the
+// store key.
+func encodeHeader(sk *storeKey, dk *dataKey) ([]byte, error) {
+	hdr := make([]byte, headerSize)
+	copy(hdr, headerMagic)
+	hdr[versionOffset] = headerVersion
+	copy(hdr[keyIDOffset:], sk.id[:])
+	copy(hdr[ivOffset:], dk.iv[:])
+	nonce := hdr[nonceOffset:wrappedKeyOffset]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sk.aead.Seal(hdr[wrappedKeyOffset:wrappedKeyOffset], nonce, dk.key[:], hdr[:nonceOffset])
+	return hdr, nil
+}
+
+// decodeHeaderKeyID returns the ID of the store key wrapping the data key of
+// the file with the given header.
+func decodeHeaderKeyID(hdr []byte) (keyID, error) {
+	if len(hdr) < headerSize || string(hdr[:len(headerMagic)]) != headerMagic {
+		return keyID{}, errors.New("encryptedfs: file is not encrypted")
+	}
+	if v := hdr[versionOffset]; v != headerVersion {
+		return keyID{}, errors.Newf("encryptedfs: unknown header version %d", errors.Safe(v))
+	}
+	var id keyID
+	copy(id[:], hdr[keyIDOffset:])
+	return id, nil
+}
+
+// decodeHeader unwraps the data key of the file with the given header using
+// the store key.
+func decodeHeader(sk *storeKey, hdr []byte) (*dataKey, error) {
+	dk := &dataKey{}
+	copy(dk.iv[:], hdr[ivOffset:])
+	nonce := hdr[nonceOffset:wrappedKeyOffset]
+	if _, err := sk.aead.Open(
+		dk.key[:0], nonce, hdr[wrappedKeyOffset:headerDataSize], hdr[:nonceOffset],
+	); err != nil {
+		return nil, errors.Wrap(err, "encryptedfs: unwrapping data key")
+	}
+	return dk, dk.init()
+}
+
+// ReadKeyFile reads the store keys from a key file. Each non-empty line of a
+// key file that isn't a comment (starting with #) holds a hex-encoded AES-128,
+// AES-192 or AES-256 key. The first key is the active key; see New.
+func ReadKeyFile(fs vfs.FS, path string) ([][]byte, error) {
+	f, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var keys [][]byte
+	s := bufio.NewScanner(f)
+	for lineNum := 1; s.Scan(); lineNum++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err := hex.DecodeString(line)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s:%d", path, lineNum)
+		}
+		keys = append(keys, key)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, errors.Newf("%s: no keys", path)
+	}
+	return keys, nil
+}
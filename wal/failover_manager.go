@@ -623,8 +623,14 @@ func (wm *failoverManager) Create(wn NumWAL, jobID int) (Writer, error) {
 		bytesPerSync:         wm.opts.BytesPerSync,
 		preallocateSize:      wm.opts.PreallocateSize,
 		minSyncInterval:      wm.opts.MinSyncInterval,
+		syncInterval:         wm.opts.SyncInterval,
+		maxSyncLatency:       wm.opts.MaxSyncLatency,
 		fsyncLatency:         wm.opts.FsyncLatency,
 		queueSemChan:         wm.opts.QueueSemChan,
+		writeRateLimit:       wm.opts.WriteRateLimit,
+		writeAlignment:       wm.opts.WriteAlignment,
+		padding:              wm.opts.Padding,
+		directIO:             wm.opts.DirectIO,
 		stopper:              wm.stopper,
 		writerClosed:         wm.writerClosed,
 		writerCreatedForTest: wm.opts.logWriterCreatedForTesting,
@@ -423,6 +423,9 @@ type failoverWriterOpts struct {
 	jobID int
 	logCreator
 
+	// directIO is Options.DirectIO.
+	directIO bool
+
 	// Options that feed into SyncingFileOptions.
 	noSyncOnClose   bool
 	bytesPerSync    int
@@ -430,8 +433,13 @@ type failoverWriterOpts struct {
 
 	// Options for record.LogWriter.
 	minSyncInterval func() time.Duration
+	syncInterval    time.Duration
+	maxSyncLatency  time.Duration
 	fsyncLatency    prometheus.Histogram
 	queueSemChan    chan struct{}
+	writeRateLimit  func(n int)
+	writeAlignment  int
+	padding         record.PaddingPolicy
 	stopper         *stopper
 
 	writerClosed func(logicalLogWithSizesEtc)
@@ -583,8 +591,13 @@ func (ww *failoverWriter) switchToNewDir(dir dirAndFileHandle) error {
 			handleErrFunc(err)
 			return
 		}
+		directIOFile, err := maybeEnableDirectIO(file, ww.opts.directIO)
+		if err != nil {
+			handleErrFunc(err)
+			return
+		}
 		// Wrap in a syncingFile.
-		syncingFile := vfs.NewSyncingFile(file, vfs.SyncingFileOptions{
+		syncingFile := vfs.NewSyncingFile(directIOFile, vfs.SyncingFileOptions{
 			NoSyncOnClose:   ww.opts.noSyncOnClose,
 			BytesPerSync:    ww.opts.bytesPerSync,
 			PreallocateSize: ww.opts.preallocateSize(),
@@ -600,9 +613,14 @@ func (ww *failoverWriter) switchToNewDir(dir dirAndFileHandle) error {
 		w := record.NewLogWriter(recorderAndWriter, base.DiskFileNum(ww.opts.wn),
 			record.LogWriterConfig{
 				WALMinSyncInterval:        ww.opts.minSyncInterval,
+				WALSyncInterval:           ww.opts.syncInterval,
+				WALMaxSyncLatency:         ww.opts.maxSyncLatency,
 				WALFsyncLatency:           ww.opts.fsyncLatency,
 				QueueSemChan:              ww.opts.queueSemChan,
 				ExternalSyncQueueCallback: ww.doneSyncCallback,
+				WriteRateLimit:            ww.opts.writeRateLimit,
+				WriteAlignment:            ww.opts.writeAlignment,
+				Padding:                   ww.opts.padding,
 			})
 		closeWriter := func() bool {
 			ww.mu.Lock()
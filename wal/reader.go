@@ -71,6 +71,16 @@ func (ll LogicalLog) OpenForRead() Reader {
 	return newVirtualWALReader(ll)
 }
 
+// OpenForReadWithLogData opens a logical WAL for reading, like OpenForRead,
+// except that the reader also returns the records of batches only containing
+// LogData. Such a record is skipped if a record of a batch containing KVs at
+// the same or a later sequence number has already been returned.
+func (ll LogicalLog) OpenForReadWithLogData() Reader {
+	r := newVirtualWALReader(ll)
+	r.logData = true
+	return r
+}
+
 // String implements fmt.Stringer.
 func (ll LogicalLog) String() string {
 	var sb strings.Builder
@@ -228,6 +238,9 @@ type virtualWALReader struct {
 	// ever observe a batch encoding a sequence number <= lastSeqNum, we must
 	// have already returned the batch and should skip it.
 	lastSeqNum uint64
+	// logData is true if the records of batches only containing LogData are
+	// returned rather than skipped.
+	logData bool
 	// recordBuf is a buffer used to hold the latest record read from a physical
 	// file, and then returned to the user. A pointer to this buffer is returned
 	// directly to the caller of NextRecord.
@@ -322,6 +335,12 @@ func (r *virtualWALReader) NextRecord() (io.Reader, Offset, error) {
 		// sequence number. We can differentiate LogData-only batches through
 		// their batch headers: they'll encode a count of zero.
 		if h.Count == 0 {
+			// If the caller asked for LogData-only batches, return the batch
+			// unless it's a duplicate, recognizable by a subsequent batch with
+			// KVs having been returned. Its sequence number is not recorded.
+			if r.logData && h.SeqNum > r.lastSeqNum {
+				return &r.recordBuf, r.off, nil
+			}
 			r.recordBuf.Reset()
 			continue
 		}
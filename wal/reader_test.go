@@ -142,9 +142,16 @@ func TestReader(t *testing.T) {
 					if len(repr) >= batchrepr.HeaderLen {
 						count := uint32(fields.MustKeyValue("count").Uint64())
 						seq = fields.MustKeyValue("seq").Uint64()
-						rng.Read(repr[batchrepr.HeaderLen:])
 						batchrepr.SetSeqNum(repr, seq)
 						batchrepr.SetCount(repr, count)
+						if fields.HasValue("compressed") {
+							// Leave the body zeroed so that it compresses.
+							var ok bool
+							repr, ok = batchrepr.Compress(nil, repr, batchrepr.SnappyCompression)
+							require.True(t, ok)
+						} else {
+							rng.Read(repr[batchrepr.HeaderLen:])
+						}
 					}
 
 					var tailOffset int64
@@ -196,6 +203,7 @@ func TestReader(t *testing.T) {
 			var forceLogNameIndexes []uint64
 			td.ScanArgs(t, "logNum", &logNum)
 			td.MaybeScanArgs(t, "forceLogNameIndexes", &forceLogNameIndexes)
+			logData := td.HasArg("log-data")
 			logs, err := Scan(Dir{FS: fs})
 			require.NoError(t, err)
 			log, ok := logs.Get(NumWAL(logNum))
@@ -218,6 +226,9 @@ func TestReader(t *testing.T) {
 			}
 			ll := LogicalLog{Num: log.Num, segments: segments}
 			r := ll.OpenForRead()
+			if logData {
+				r = ll.OpenForReadWithLogData()
+			}
 			for {
 				rr, off, err := r.NextRecord()
 				fmt.Fprintf(&buf, "r.NextRecord() = (rr, %s, %v)\n", off, err)
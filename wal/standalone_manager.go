@@ -188,7 +188,11 @@ func (m *StandaloneManager) Create(wn NumWAL, jobID int) (Writer, error) {
 		err = firstError(err, newLogFile.Close())
 		return nil, err
 	}
-	newLogFile = vfs.NewSyncingFile(newLogFile, vfs.SyncingFileOptions{
+	directIOFile, err := maybeEnableDirectIO(newLogFile, m.o.DirectIO)
+	if err != nil {
+		return nil, firstError(err, newLogFile.Close())
+	}
+	newLogFile = vfs.NewSyncingFile(directIOFile, vfs.SyncingFileOptions{
 		NoSyncOnClose:   m.o.NoSyncOnClose,
 		BytesPerSync:    m.o.BytesPerSync,
 		PreallocateSize: m.o.PreallocateSize(),
@@ -196,7 +200,12 @@ func (m *StandaloneManager) Create(wn NumWAL, jobID int) (Writer, error) {
 	w := record.NewLogWriter(newLogFile, newLogNum, record.LogWriterConfig{
 		WALFsyncLatency:    m.o.FsyncLatency,
 		WALMinSyncInterval: m.o.MinSyncInterval,
+		WALSyncInterval:    m.o.SyncInterval,
+		WALMaxSyncLatency:  m.o.MaxSyncLatency,
 		QueueSemChan:       m.o.QueueSemChan,
+		WriteRateLimit:     m.o.WriteRateLimit,
+		WriteAlignment:     m.o.WriteAlignment,
+		Padding:            m.o.Padding,
 	})
 	m.w = &standaloneWriter{
 		m: m,
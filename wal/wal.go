@@ -12,6 +12,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/record"
 	"github.com/cockroachdb/pebble/vfs"
@@ -121,6 +122,10 @@ type Options struct {
 
 	// MinSyncInterval is documented in Options.WALMinSyncInterval.
 	MinSyncInterval func() time.Duration
+	// SyncInterval is documented in Options.WALSyncInterval.
+	SyncInterval time.Duration
+	// MaxSyncLatency is documented in Options.WALMaxSyncLatency.
+	MaxSyncLatency time.Duration
 	// FsyncLatency records fsync latency. This doesn't differentiate between
 	// fsyncs on the primary and secondary dir.
 	//
@@ -134,6 +139,14 @@ type Options struct {
 	// there is no syncQueue, so the pushback into the commit pipeline is
 	// unnecessary, but possibly harmless.
 	QueueSemChan chan struct{}
+	// WriteRateLimit is documented in record.LogWriterConfig.WriteRateLimit.
+	WriteRateLimit func(n int)
+	// WriteAlignment is documented in record.LogWriterConfig.WriteAlignment.
+	WriteAlignment int
+	// Padding is documented in record.LogWriterConfig.Padding.
+	Padding record.PaddingPolicy
+	// DirectIO is documented in Options.WALDirectIO.
+	DirectIO bool
 
 	// Logger for logging.
 	Logger base.Logger
@@ -159,6 +172,22 @@ func Init(o Options, initial Logs) (Manager, error) {
 	return m, nil
 }
 
+// maybeEnableDirectIO enables direct I/O on a log file if directIO is set.
+// If the file doesn't support direct I/O, the file is written with buffered
+// I/O.
+func maybeEnableDirectIO(f vfs.File, directIO bool) (vfs.File, error) {
+	if !directIO {
+		return f, nil
+	}
+	df, err := vfs.EnableDirectIO(f)
+	if errors.Is(err, vfs.ErrUnsupported) {
+		return f, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return df, nil
+}
+
 // Dirs returns the primary Dir and the secondary if provided.
 func (o *Options) Dirs() []Dir {
 	if o.Secondary == (Dir{}) {
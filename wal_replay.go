@@ -0,0 +1,163 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/cockroachdb/pebble/batchrepr"
+	"github.com/cockroachdb/pebble/wal"
+)
+
+// walReplayRecord is a record read from a WAL being replayed, and the batch it
+// holds.
+type walReplayRecord struct {
+	offset wal.Offset
+	// err is the error encountered reading the record, in which case the other
+	// fields are unset.
+	err error
+	buf bytes.Buffer
+	// decompressed holds the batch's representation if the record is
+	// compressed.
+	decompressed []byte
+	// b is the batch held by the record, with its memTableSize computed. It's
+	// unset if the record is too short to hold a batch or decodeErr is set.
+	b Batch
+	// decodeErr is the error encountered decompressing the record.
+	decodeErr error
+}
+
+// walReplayReader reads the records of a WAL being replayed, decoding the
+// batches they hold. Unless Options.WALReplayConcurrency is 1, the records are
+// read ahead of the caller while the caller applies the batches, and the
+// batches are decompressed and decoded on a pool of workers. The records are
+// always returned in the order they were written, so that the batches are
+// applied in sequence number order.
+type walReplayReader struct {
+	d  *DB
+	rr wal.Reader
+	// rec is the record returned by next, if the records aren't read ahead. It's
+	// reused by every call to next.
+	rec walReplayRecord
+
+	// The following are only set if the records are read ahead. results holds
+	// a channel for each record that has been read, in order, on which the
+	// record is sent once it's decoded.
+	results chan chan *walReplayRecord
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+type walReplayJob struct {
+	rec    *walReplayRecord
+	result chan *walReplayRecord
+}
+
+func (d *DB) newWALReplayReader(rr wal.Reader) *walReplayReader {
+	r := &walReplayReader{d: d, rr: rr}
+	concurrency := d.opts.WALReplayConcurrency
+	if concurrency <= 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+	if concurrency == 1 {
+		return r
+	}
+	// Bound the number of records that are read ahead, and so the memory they
+	// consume.
+	r.results = make(chan chan *walReplayRecord, 2*concurrency)
+	r.stop = make(chan struct{})
+	jobs := make(chan walReplayJob, concurrency)
+	r.wg.Add(concurrency + 1)
+	go r.readAhead(jobs)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer r.wg.Done()
+			for j := range jobs {
+				r.decode(j.rec)
+				j.result <- j.rec
+			}
+		}()
+	}
+	return r
+}
+
+// readAhead reads the records, queueing them to be decoded by the workers.
+func (r *walReplayReader) readAhead(jobs chan<- walReplayJob) {
+	defer r.wg.Done()
+	defer close(jobs)
+	defer close(r.results)
+	for {
+		rec := &walReplayRecord{}
+		result := make(chan *walReplayRecord, 1)
+		r.read(rec)
+		if rec.err != nil {
+			result <- rec
+		}
+		select {
+		case r.results <- result:
+		case <-r.stop:
+			return
+		}
+		if rec.err != nil {
+			return
+		}
+		jobs <- walReplayJob{rec: rec, result: result}
+	}
+}
+
+func (r *walReplayReader) read(rec *walReplayRecord) {
+	var rd io.Reader
+	rd, rec.offset, rec.err = r.rr.NextRecord()
+	if rec.err == nil {
+		rec.buf.Reset()
+		_, rec.err = io.Copy(&rec.buf, rd)
+	}
+}
+
+func (r *walReplayReader) decode(rec *walReplayRecord) {
+	rec.b = Batch{}
+	repr := rec.buf.Bytes()
+	if len(repr) < batchrepr.HeaderLen {
+		return
+	}
+	if batchrepr.IsCompressed(repr) {
+		rec.decompressed, rec.decodeErr = batchrepr.Decompress(rec.decompressed[:0], repr)
+		if rec.decodeErr != nil {
+			return
+		}
+		repr = rec.decompressed
+	}
+	// Specify Batch.db so that Batch.SetRepr will compute Batch.memTableSize
+	// which is used when applying the batch.
+	rec.b.db = r.d
+	_ = rec.b.SetRepr(repr)
+}
+
+// next returns the next record. Once a record with err set is returned, next
+// must not be called again. The record, and the batch it holds, are only valid
+// until the next call to next.
+func (r *walReplayReader) next() *walReplayRecord {
+	if r.results == nil {
+		r.read(&r.rec)
+		if r.rec.err == nil {
+			r.decode(&r.rec)
+		}
+		return &r.rec
+	}
+	return <-<-r.results
+}
+
+// close stops reading ahead, waiting for the workers to exit. It must be called
+// before the wal.Reader is closed.
+func (r *walReplayReader) close() {
+	if r.results == nil {
+		return
+	}
+	close(r.stop)
+	r.wg.Wait()
+}
@@ -0,0 +1,220 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/rangekey"
+	"github.com/cockroachdb/tokenbucket"
+)
+
+// ErrWriteThrottled is returned by PrefixWriteAdmission when a batch is
+// rejected because it would have to wait longer than
+// PrefixWriteAdmissionOptions.MaxWait to be admitted.
+var ErrWriteThrottled = errors.New("pebble: write throttled")
+
+// WriteAdmissionController controls the admission of the batches committed to
+// a DB, so that writes to overloaded key ranges may be delayed or rejected
+// without affecting the writes to other key ranges. See Options.WriteAdmission
+// and NewPrefixWriteAdmission.
+type WriteAdmissionController interface {
+	// Admit is invoked before a non-empty batch is committed, with the span of
+	// the keys it writes and its size. Admit may block to delay the commit, and
+	// may return an error to reject the batch, in which case the batch isn't
+	// committed and the error is returned to the caller. Admit is invoked
+	// concurrently by committing goroutines, and must not call into the DB.
+	Admit(ctx context.Context, info WriteAdmissionInfo) error
+}
+
+// WriteAdmissionInfo describes a batch submitted to a
+// WriteAdmissionController.
+type WriteAdmissionInfo struct {
+	// Start is the smallest user key written by the batch, and End the largest
+	// user key written by the batch, or the exclusive end key of its range
+	// deletions and range keys if larger: the batch only writes keys within
+	// [Start, End].
+	Start, End []byte
+	// Count is the number of operations of the batch, and Bytes the size of its
+	// representation.
+	Count uint32
+	Bytes int
+}
+
+// makeWriteAdmissionInfo returns the WriteAdmissionInfo of a non-empty batch.
+func makeWriteAdmissionInfo(b *Batch, cmp Compare) (WriteAdmissionInfo, error) {
+	info := WriteAdmissionInfo{Count: b.Count(), Bytes: len(b.data)}
+	for r := b.Reader(); ; {
+		kind, ukey, value, ok, err := r.Next()
+		if err != nil {
+			return WriteAdmissionInfo{}, err
+		} else if !ok {
+			return info, nil
+		}
+		end := ukey
+		switch kind {
+		case InternalKeyKindLogData:
+			continue
+		case InternalKeyKindRangeDelete:
+			end = value
+		case InternalKeyKindRangeKeySet, InternalKeyKindRangeKeyUnset, InternalKeyKindRangeKeyDelete:
+			if end, _, ok = rangekey.DecodeEndKey(kind, value); !ok {
+				return WriteAdmissionInfo{}, errors.Wrapf(ErrInvalidBatch, "invalid %s", kind)
+			}
+		}
+		if info.Start == nil || cmp(ukey, info.Start) < 0 {
+			info.Start = ukey
+		}
+		if info.End == nil || cmp(end, info.End) > 0 {
+			info.End = end
+		}
+	}
+}
+
+// PrefixWriteLimit limits the rate of the writes to the keys prefixed by
+// Prefix. See PrefixWriteAdmissionOptions.
+type PrefixWriteLimit struct {
+	Prefix []byte
+	// BytesPerSecond is the rate at which the batches writing keys prefixed by
+	// Prefix are admitted, in bytes of batch representation. Bursts of up to a
+	// second worth of writes are admitted without delay.
+	BytesPerSecond int64
+}
+
+// PrefixWriteAdmissionOptions configures a PrefixWriteAdmission.
+type PrefixWriteAdmissionOptions struct {
+	// Limits are the rate limits of the key prefixes. A batch writing keys with
+	// several of the prefixes must be admitted by the limits of all of them.
+	Limits []PrefixWriteLimit
+	// MaxWait is the longest a batch is delayed before being admitted. Batches
+	// that would be delayed longer are rejected with ErrWriteThrottled. If
+	// zero, batches are delayed for as long as necessary, and are never
+	// rejected.
+	MaxWait time.Duration
+}
+
+// PrefixWriteAdmission is a WriteAdmissionController limiting the rate of the
+// writes to key prefixes, using a token bucket per prefix. Batches writing
+// keys without any of the prefixes are admitted immediately. Prefixes are
+// compared bytewise, so they're only meaningful if the Comparer orders keys
+// bytewise, as the default Comparer does.
+type PrefixWriteAdmission struct {
+	maxWait time.Duration
+	// limits are ordered by prefix.
+	limits []*prefixLimiter
+
+	// timeNow and sleep are replaced by tests.
+	timeNow func() time.Time
+	sleep   func(ctx context.Context, d time.Duration) error
+}
+
+type prefixLimiter struct {
+	start, end []byte
+	mu         struct {
+		sync.Mutex
+		tb tokenbucket.TokenBucket
+	}
+}
+
+var _ WriteAdmissionController = (*PrefixWriteAdmission)(nil)
+
+// NewPrefixWriteAdmission returns a PrefixWriteAdmission enforcing the limits
+// of opts.
+func NewPrefixWriteAdmission(opts PrefixWriteAdmissionOptions) *PrefixWriteAdmission {
+	return newPrefixWriteAdmission(opts, time.Now, sleepCtx)
+}
+
+func newPrefixWriteAdmission(
+	opts PrefixWriteAdmissionOptions,
+	timeNow func() time.Time,
+	sleep func(ctx context.Context, d time.Duration) error,
+) *PrefixWriteAdmission {
+	a := &PrefixWriteAdmission{
+		maxWait: opts.MaxWait,
+		timeNow: timeNow,
+		sleep:   sleep,
+	}
+	for _, l := range opts.Limits {
+		pl := &prefixLimiter{
+			start: slices.Clone(l.Prefix),
+			end:   prefixSuccessor(l.Prefix),
+		}
+		pl.mu.tb.InitWithNowFn(tokenbucket.TokensPerSecond(l.BytesPerSecond),
+			tokenbucket.Tokens(l.BytesPerSecond), timeNow)
+		a.limits = append(a.limits, pl)
+	}
+	slices.SortFunc(a.limits, func(x, y *prefixLimiter) int {
+		return bytes.Compare(x.start, y.start)
+	})
+	return a
+}
+
+// Admit implements WriteAdmissionController.
+func (a *PrefixWriteAdmission) Admit(ctx context.Context, info WriteAdmissionInfo) error {
+	start := a.timeNow()
+	for i, l := range a.limits {
+		if bytes.Compare(l.start, info.End) > 0 {
+			// The following prefixes are all past the end of the span.
+			break
+		}
+		if !l.overlaps(info) {
+			continue
+		}
+		if err := a.wait(ctx, l, info.Bytes, start); err != nil {
+			// Return the tokens removed for the prefixes that admitted the
+			// batch, as it isn't committed.
+			for _, l := range a.limits[:i] {
+				if l.overlaps(info) {
+					l.mu.Lock()
+					l.mu.tb.Adjust(tokenbucket.Tokens(info.Bytes))
+					l.mu.Unlock()
+				}
+			}
+			return errors.Wrapf(err, "writing to prefix %q", l.start)
+		}
+	}
+	return nil
+}
+
+func (l *prefixLimiter) overlaps(info WriteAdmissionInfo) bool {
+	return bytes.Compare(l.start, info.End) <= 0 && (l.end == nil || bytes.Compare(info.Start, l.end) < 0)
+}
+
+// wait removes n tokens from the token bucket of l, waiting until they're
+// available.
+func (a *PrefixWriteAdmission) wait(
+	ctx context.Context, l *prefixLimiter, n int, start time.Time,
+) error {
+	for {
+		l.mu.Lock()
+		fulfilled, tryAgainAfter := l.mu.tb.TryToFulfill(tokenbucket.Tokens(n))
+		l.mu.Unlock()
+		if fulfilled {
+			return nil
+		}
+		if a.maxWait > 0 && a.timeNow().Sub(start)+tryAgainAfter > a.maxWait {
+			return ErrWriteThrottled
+		}
+		if err := a.sleep(ctx, tryAgainAfter); err != nil {
+			return err
+		}
+	}
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+type writeAdmissionFunc func(ctx context.Context, info WriteAdmissionInfo) error
+
+func (f writeAdmissionFunc) Admit(ctx context.Context, info WriteAdmissionInfo) error {
+	return f(ctx, info)
+}
+
+func TestWriteAdmission(t *testing.T) {
+	errOverloaded := errors.New("overloaded")
+	var infos []WriteAdmissionInfo
+	d, err := Open("", &Options{
+		FS:                 vfs.NewMem(),
+		FormatMajorVersion: FormatNewest,
+		WriteAdmission: writeAdmissionFunc(func(ctx context.Context, info WriteAdmissionInfo) error {
+			infos = append(infos, WriteAdmissionInfo{
+				Start: append([]byte(nil), info.Start...),
+				End:   append([]byte(nil), info.End...),
+				Count: info.Count,
+				Bytes: info.Bytes,
+			})
+			if string(info.Start) == "hot" {
+				return errOverloaded
+			}
+			return nil
+		}),
+	})
+	require.NoError(t, err)
+	defer d.Close()
+
+	b := d.NewBatch()
+	require.NoError(t, b.Set([]byte("m"), nil, nil))
+	require.NoError(t, b.LogData([]byte("zzz"), nil))
+	require.NoError(t, b.DeleteRange([]byte("c"), []byte("e"), nil))
+	require.NoError(t, b.RangeKeySet([]byte("n"), []byte("q"), nil, nil, nil))
+	require.NoError(t, b.Commit(nil))
+	require.Equal(t, WriteAdmissionInfo{
+		Start: []byte("c"),
+		End:   []byte("q"),
+		Count: 3,
+		Bytes: len(b.Repr()),
+	}, infos[0])
+	require.NoError(t, b.Close())
+
+	// Rejected batches aren't committed.
+	require.ErrorIs(t, d.Set([]byte("hot"), nil, nil), errOverloaded)
+	_, _, err = d.Get([]byte("hot"))
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// Empty batches aren't submitted.
+	require.NoError(t, d.Apply(d.NewBatch(), nil))
+	require.Len(t, infos, 2)
+}
+
+func TestPrefixWriteAdmission(t *testing.T) {
+	now := time.Unix(1, 0)
+	var slept time.Duration
+	a := newPrefixWriteAdmission(PrefixWriteAdmissionOptions{
+		Limits: []PrefixWriteLimit{
+			{Prefix: []byte("t2/"), BytesPerSecond: 1000},
+			{Prefix: []byte("t1/"), BytesPerSecond: 100},
+			{Prefix: []byte("t0/"), BytesPerSecond: 1000},
+		},
+		MaxWait: 500 * time.Millisecond,
+	}, func() time.Time { return now }, func(ctx context.Context, d time.Duration) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		slept += d
+		now = now.Add(d)
+		return nil
+	})
+	admit := func(start, end string, bytes int) (time.Duration, error) {
+		slept = 0
+		err := a.Admit(context.Background(), WriteAdmissionInfo{
+			Start: []byte(start), End: []byte(end), Bytes: bytes,
+		})
+		return slept, err
+	}
+
+	// A burst of up to a second worth of writes is admitted immediately.
+	wait, err := admit("t1/a", "t1/b", 80)
+	require.NoError(t, err)
+	require.Zero(t, wait)
+	// The next writes to t1/ are delayed until enough tokens have accumulated.
+	wait, err = admit("t1/c", "t1/c", 70)
+	require.NoError(t, err)
+	require.Equal(t, 500*time.Millisecond, wait)
+	// Writes to other prefixes, or to keys without a limit, aren't delayed.
+	for _, span := range [][2]string{{"t2/a", "t2/z"}, {"a", "t0"}, {"t3/", "z"}, {"t0/a", "t0/z"}} {
+		wait, err = admit(span[0], span[1], 100)
+		require.NoError(t, err)
+		require.Zero(t, wait)
+	}
+	// Writes that would be delayed longer than MaxWait are rejected, and don't
+	// consume the tokens of the other prefixes they write to.
+	_, err = admit("t0/a", "t2/a", 200)
+	require.ErrorIs(t, err, ErrWriteThrottled)
+	require.EqualError(t, err, `writing to prefix "t1/": pebble: write throttled`)
+	wait, err = admit("t0/a", "t0/a", 900)
+	require.NoError(t, err)
+	require.Zero(t, wait)
+	wait, err = admit("t2/a", "t2/a", 900)
+	require.NoError(t, err)
+	require.Zero(t, wait)
+
+	// A canceled context interrupts the wait.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, a.Admit(ctx, WriteAdmissionInfo{
+		Start: []byte("t1/a"), End: []byte("t1/a"), Bytes: 50,
+	}), context.Canceled)
+}